@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/agent"
+	"github.com/iliodor1/metrics-service/internal/certs"
+	"github.com/iliodor1/metrics-service/internal/gctune"
+	"github.com/iliodor1/metrics-service/internal/sign"
+)
+
+// parseConfig читает настройки агента из флагов командной строки.
+// Переменные окружения имеют приоритет над флагами.
+func parseConfig() agent.Config {
+	var (
+		cfg             agent.Config
+		pollInterval    int
+		reportInterval  int
+		commandInterval int
+		updateInterval  int
+		tlsCA           string
+		tlsCert         string
+		tlsKey          string
+		shards          string
+		mirrors         string
+		signHash        string
+		spoolSize       string
+	)
+
+	hostname, _ := os.Hostname()
+
+	flag.StringVar(&cfg.Address, "a", "localhost:8080", "адрес сервера метрик: host:port, URL (https://metrics:8080) или сокет unix:/путь")
+	flag.StringVar(&tlsCA, "tls-ca", "", "файл сертификата в формате PEM, которому доверять при HTTPS, например самоподписанный сертификат сервера")
+	flag.StringVar(&tlsCert, "tls-client-cert", "", "файл сертификата агента в формате PEM для сервера, проверяющего клиентов по mTLS")
+	flag.StringVar(&tlsKey, "tls-client-key", "", "файл ключа сертификата агента в формате PEM")
+	flag.IntVar(&pollInterval, "p", 2, "частота опроса метрик в секундах")
+	flag.IntVar(&reportInterval, "r", 10, "частота отправки метрик в секундах")
+	flag.IntVar(&cfg.RateLimit, "l", 1, "максимальное число одновременно исходящих запросов")
+	flag.StringVar(&cfg.Key, "k", "", "ключ для подписи запросов")
+	flag.StringVar(&cfg.Token, "token", "", "токен доступа к серверу с правом metrics:write")
+	flag.StringVar(&signHash, "sign-hash", "sha256", "алгоритм подписи: sha256, sha512-256 или blake2b-256; если сервер его не принимает, используется предложенный сервером")
+	flag.IntVar(&cfg.QueueSize, "queue", 10, "наибольшее число неотправленных пакетов метрик на сервер; старые пакеты сверх него объединяются")
+	flag.StringVar(&cfg.SpoolDir, "spool-dir", "", "каталог для пакетов, не отправленных и после повторов и при остановке; они отправляются, когда сервер снова доступен (пустой — только очередь в памяти)")
+	flag.StringVar(&spoolSize, "spool-max-size", "100MiB", "наибольший размер пакетов в -spool-dir на сервер; старые пакеты сверх него объединяются (0 — без ограничения)")
+	flag.StringVar(&cfg.ID, "id", hostname, "идентификатор агента для получения команд от сервера")
+	flag.IntVar(&commandInterval, "command-interval", 5, "частота запроса команд у сервера в секундах (0 — не запрашивать)")
+	flag.StringVar(&cfg.UpdateURL, "update-url", "", "адрес для проверки новой версии агента")
+	flag.IntVar(&updateInterval, "update-interval", 3600, "частота проверки новой версии в секундах")
+	flag.StringVar(&cfg.RestartCommand, "restart-cmd", "", "команда, запускаемая при обнаружении новой версии")
+	flag.StringVar(&shards, "shards", "", "серверы, между которыми метрики делятся по хешу имени, как в хранилище sharded: имя=адрес,..., например a=metrics1:8080,b=metrics2:8080")
+	flag.StringVar(&mirrors, "mirrors", "", "серверы, получающие копию всех метрик, например резервная площадка: адрес,...")
+	flag.Parse()
+
+	if v, ok := os.LookupEnv("ADDRESS"); ok {
+		cfg.Address = v
+	}
+	if v, ok := os.LookupEnv("TLS_CA"); ok {
+		tlsCA = v
+	}
+	if v, ok := os.LookupEnv("TLS_CLIENT_CERT"); ok {
+		tlsCert = v
+	}
+	if v, ok := os.LookupEnv("TLS_CLIENT_KEY"); ok {
+		tlsKey = v
+	}
+	if tlsCA != "" || tlsCert != "" {
+		tlsConfig, err := certs.ClientConfig(tlsCA, tlsCert, tlsKey)
+		if err != nil {
+			log.Fatalf("Не удалось прочитать сертификаты TLS: %v", err)
+		}
+		cfg.TLS = tlsConfig
+	}
+	if v, ok := os.LookupEnv("POLL_INTERVAL"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			pollInterval = n
+		}
+	}
+	if v, ok := os.LookupEnv("REPORT_INTERVAL"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			reportInterval = n
+		}
+	}
+	if v, ok := os.LookupEnv("RATE_LIMIT"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.RateLimit = n
+		}
+	}
+	if v, ok := os.LookupEnv("KEY"); ok {
+		cfg.Key = v
+	}
+	if v, ok := os.LookupEnv("TOKEN"); ok {
+		cfg.Token = v
+	}
+	if v, ok := os.LookupEnv("SIGN_HASH"); ok {
+		signHash = v
+	}
+	if a, ok := sign.Lookup(signHash); ok {
+		cfg.SignHash = a
+	} else {
+		log.Fatalf("Неверный параметр sign-hash: неизвестный алгоритм подписи %q", signHash)
+	}
+	if v, ok := os.LookupEnv("QUEUE_SIZE"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.QueueSize = n
+		}
+	}
+	if v, ok := os.LookupEnv("SPOOL_DIR"); ok {
+		cfg.SpoolDir = v
+	}
+	if v, ok := os.LookupEnv("SPOOL_MAX_SIZE"); ok {
+		spoolSize = v
+	}
+	if size, err := gctune.ParseBytes(spoolSize); err == nil {
+		cfg.SpoolMaxSize = size
+	} else {
+		log.Fatalf("Неверный параметр spool-max-size: %v", err)
+	}
+
+	if v, ok := os.LookupEnv("AGENT_ID"); ok {
+		cfg.ID = v
+	}
+	if v, ok := os.LookupEnv("COMMAND_INTERVAL"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			commandInterval = n
+		}
+	}
+
+	if v, ok := os.LookupEnv("UPDATE_URL"); ok {
+		cfg.UpdateURL = v
+	}
+	if v, ok := os.LookupEnv("UPDATE_INTERVAL"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			updateInterval = n
+		}
+	}
+	if v, ok := os.LookupEnv("RESTART_COMMAND"); ok {
+		cfg.RestartCommand = v
+	}
+
+	if v, ok := os.LookupEnv("SHARDS"); ok {
+		shards = v
+	}
+	var err error
+	if cfg.Shards, err = parseShards(shards); err != nil {
+		log.Fatalf("Неверный параметр shards: %v", err)
+	}
+	if v, ok := os.LookupEnv("MIRRORS"); ok {
+		mirrors = v
+	}
+	for _, addr := range strings.Split(mirrors, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.Mirrors = append(cfg.Mirrors, addr)
+		}
+	}
+
+	cfg.PollInterval = time.Duration(pollInterval) * time.Second
+	cfg.ReportInterval = time.Duration(reportInterval) * time.Second
+	cfg.CommandInterval = time.Duration(commandInterval) * time.Second
+	cfg.UpdateInterval = time.Duration(updateInterval) * time.Second
+	return cfg
+}
+
+// parseShards разбирает список частей вида имя=адрес,имя=адрес
+func parseShards(s string) ([]agent.Shard, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var shards []agent.Shard
+	for _, pair := range strings.Split(s, ",") {
+		name, addr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" || addr == "" {
+			return nil, fmt.Errorf("ожидается имя=адрес, получено %q", pair)
+		}
+		shards = append(shards, agent.Shard{Name: name, Address: addr})
+	}
+	return shards, nil
+}
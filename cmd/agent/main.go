@@ -1,3 +1,48 @@
 package main
 
-func main() {}
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/iliodor1/metrics-service/internal/agent"
+	"github.com/iliodor1/metrics-service/internal/buildinfo"
+)
+
+// Сведения о сборке агента, задаются флагами компоновщика:
+// go build -ldflags "-X main.buildVersion=v1.2.3 -X main.buildDate=... -X main.buildCommit=..."
+var (
+	buildVersion string
+	buildDate    string
+	buildCommit  string
+)
+
+func main() {
+	build := buildinfo.New(buildVersion, buildDate, buildCommit)
+	build.Log()
+
+	// Читаем настройки
+	cfg := parseConfig()
+	cfg.Version = build.Version
+
+	a, err := agent.New(cfg)
+	if err != nil {
+		log.Fatalf("Неверные настройки агента: %v", err)
+	}
+	log.Printf("Агент запущен, сервер метрик: %s, одновременных запросов: %d\n", cfg.Address, cfg.RateLimit)
+	for _, shard := range cfg.Shards {
+		log.Printf("Часть метрик %s отправляется на %s\n", shard.Name, shard.Address)
+	}
+	for _, mirror := range cfg.Mirrors {
+		log.Printf("Копия метрик отправляется на %s\n", mirror)
+	}
+
+	// По SIGTERM, SIGINT и SIGQUIT агент отправляет последние метрики и завершается
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	defer stop()
+
+	// Запускаем сбор и отправку метрик
+	a.Run(ctx)
+	log.Println("Агент остановлен")
+}
@@ -0,0 +1,214 @@
+// Команда benchcmp сравнивает результаты тестов производительности
+// из вывода go test -bench с базовыми значениями и завершается с ошибкой
+// при регрессии. Вывод читается из файлов или стандартного ввода.
+//
+//	go test -run '^$' -bench . -benchmem -count 3 ./... | go run ./cmd/benchcmp
+//	go test -run '^$' -bench . -benchmem -count 3 ./... | go run ./cmd/benchcmp -update
+//
+// При нескольких запусках теста (-count) учитывается лучший результат.
+// Базовое значение без результата в выводе тоже считается ошибкой:
+// тест удалён, переименован или не запускался. С -update такие значения
+// удаляются из файла, поэтому обновлять базу нужно по полному запуску.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Result результат одного теста производительности
+type Result struct {
+	NsPerOp     int64 `json:"ns_per_op"`
+	AllocsPerOp int64 `json:"allocs_per_op"`
+	BytesPerOp  int64 `json:"bytes_per_op"`
+}
+
+func main() {
+	var (
+		baselinePath string
+		threshold    float64
+		update       bool
+	)
+	flag.StringVar(&baselinePath, "baseline", "cmd/benchcmp/baseline.json", "файл с базовыми значениями")
+	flag.Float64Var(&threshold, "threshold", 0.2, "допустимое ухудшение времени и памяти, доля от базового значения")
+	flag.BoolVar(&update, "update", false, "записать результаты как новые базовые значения")
+	flag.Parse()
+
+	baseline := make(map[string]Result)
+	if data, err := os.ReadFile(baselinePath); err == nil {
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			log.Fatalf("Неверный файл базовых значений: %v", err)
+		}
+	} else if !update {
+		log.Fatalf("Не удалось прочитать базовые значения: %v", err)
+	}
+
+	var in io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		var readers []io.Reader
+		for _, name := range flag.Args() {
+			f, err := os.Open(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			readers = append(readers, f)
+		}
+		in = io.MultiReader(readers...)
+	}
+	results, err := parse(in)
+	if err != nil {
+		log.Fatalf("Неверный вывод go test -bench: %v", err)
+	}
+	if len(results) == 0 {
+		log.Fatal("В выводе go test нет результатов тестов производительности")
+	}
+
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	regressions := 0
+	for _, name := range names {
+		res := results[name]
+		base, ok := baseline[name]
+		status := "новый"
+		if ok {
+			status = "ok"
+			if worse(res.NsPerOp, base.NsPerOp, threshold) || worse(res.AllocsPerOp, base.AllocsPerOp, threshold) ||
+				worse(res.BytesPerOp, base.BytesPerOp, threshold) {
+				status = "РЕГРЕССИЯ"
+				regressions++
+			}
+		}
+		fmt.Printf("%-28s %12d ns/op %8d B/op %6d allocs/op   база %12d ns/op %8d B/op %6d allocs/op  %s\n",
+			name, res.NsPerOp, res.BytesPerOp, res.AllocsPerOp, base.NsPerOp, base.BytesPerOp, base.AllocsPerOp, status)
+
+		if update {
+			baseline[name] = res
+		}
+	}
+
+	absent := missing(results, baseline)
+	for _, name := range absent {
+		base := baseline[name]
+		fmt.Printf("%-28s %12s %8s %6s             база %12d ns/op %8d B/op %6d allocs/op  НЕТ РЕЗУЛЬТАТА\n",
+			name, "-", "-", "-", base.NsPerOp, base.BytesPerOp, base.AllocsPerOp)
+		if update {
+			delete(baseline, name)
+		}
+	}
+
+	if update {
+		data, err := json.MarshalIndent(baseline, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(baselinePath, append(data, '\n'), 0o644); err != nil {
+			log.Fatalf("Не удалось записать базовые значения: %v", err)
+		}
+		return
+	}
+	if regressions > 0 || len(absent) > 0 {
+		log.Fatalf("Обнаружено регрессий: %d, базовых значений без результата: %d", regressions, len(absent))
+	}
+}
+
+// missing возвращает отсортированные имена тестов из базовых значений,
+// которых нет в результатах
+func missing(results, baseline map[string]Result) []string {
+	var names []string
+	for name := range baseline {
+		if _, ok := results[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parse читает вывод go test -bench -benchmem и возвращает лучший результат
+// каждого теста по имени без префикса Benchmark и суффикса GOMAXPROCS.
+// Упавшие тесты считаются ошибкой: сравнивать их не с чем.
+func parse(r io.Reader) (map[string]Result, error) {
+	results := make(map[string]Result)
+	// pkgs пакет каждого теста: имена должны быть уникальны между пакетами
+	pkgs := make(map[string]string)
+	pkg := ""
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "--- FAIL") || strings.HasPrefix(line, "FAIL") {
+			return nil, fmt.Errorf("тесты завершились ошибкой: %s", line)
+		}
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = p
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		name := strings.TrimPrefix(fields[0], "Benchmark")
+		if i := strings.LastIndexByte(name, '-'); i > 0 {
+			if _, err := strconv.Atoi(name[i+1:]); err == nil {
+				name = name[:i]
+			}
+		}
+		res, err := parseResult(fields[2:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fields[0], err)
+		}
+		if p, ok := pkgs[name]; ok && p != pkg {
+			return nil, fmt.Errorf("тест %s есть в пакетах %s и %s", name, p, pkg)
+		}
+		pkgs[name] = pkg
+		if best, ok := results[name]; !ok || res.NsPerOp < best.NsPerOp {
+			results[name] = res
+		}
+	}
+	return results, sc.Err()
+}
+
+// parseResult разбирает пары «значение единица» строки результата
+func parseResult(fields []string) (Result, error) {
+	var res Result
+	seen := false
+	for i := 0; i+1 < len(fields); i += 2 {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return res, fmt.Errorf("неверное значение %q", fields[i])
+		}
+		switch fields[i+1] {
+		case "ns/op":
+			res.NsPerOp, seen = int64(v+0.5), true
+		case "B/op":
+			res.BytesPerOp = int64(v)
+		case "allocs/op":
+			res.AllocsPerOp = int64(v)
+		}
+	}
+	if !seen {
+		return res, errors.New("нет ns/op")
+	}
+	return res, nil
+}
+
+// worse сообщает, превышает ли значение базовое более чем на долю threshold
+func worse(value, base int64, threshold float64) bool {
+	// Для тестов без выделений памяти любое выделение считается регрессией
+	if base == 0 {
+		return value > 0
+	}
+	return float64(value) > float64(base)*(1+threshold)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]Result
+		wantErr bool
+	}{
+		{
+			name: "лучший из запусков",
+			input: `goos: linux
+pkg: example/storage
+BenchmarkMemStorageGauge-8   	30000000	        45.2 ns/op	       0 B/op	       0 allocs/op
+BenchmarkMemStorageGauge-8   	30000000	        41.6 ns/op	       0 B/op	       0 allocs/op
+BenchmarkSnapshot10k-8       	     170	   7081867 ns/op	 1491945 B/op	   10041 allocs/op
+PASS
+ok  	example/storage	3.1s
+`,
+			want: map[string]Result{
+				"MemStorageGauge": {NsPerOp: 42},
+				"Snapshot10k":     {NsPerOp: 7081867, BytesPerOp: 1491945, AllocsPerOp: 10041},
+			},
+		},
+		{
+			name:  "без GOMAXPROCS и -benchmem",
+			input: "BenchmarkIngestURL \t 1000\t 3097 ns/op\n",
+			want:  map[string]Result{"IngestURL": {NsPerOp: 3097}},
+		},
+		{
+			name:  "дефис в имени подтеста",
+			input: "BenchmarkSnapshot/format-json-4 \t 10\t 100 ns/op\n",
+			want:  map[string]Result{"Snapshot/format-json": {NsPerOp: 100}},
+		},
+		{
+			name:    "упавший тест",
+			input:   "--- FAIL: BenchmarkIngestURL\nFAIL\n",
+			wantErr: true,
+		},
+		{
+			name:    "одно имя в двух пакетах",
+			input:   "pkg: a\nBenchmarkX-8 \t 1\t 1 ns/op\npkg: b\nBenchmarkX-8 \t 1\t 1 ns/op\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parse(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse() = %v, ожидалась ошибка: %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parse() = %v, ожидалось %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s = %+v, ожидалось %+v", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestMissing(t *testing.T) {
+	results := map[string]Result{"IngestURL": {NsPerOp: 1}, "Snapshot10k": {NsPerOp: 1}}
+	tests := []struct {
+		name     string
+		baseline map[string]Result
+		want     []string
+	}{
+		{name: "все тесты запущены", baseline: map[string]Result{"IngestURL": {NsPerOp: 1}}},
+		{name: "пустая база", baseline: map[string]Result{}},
+		{
+			name: "тесты удалены или переименованы",
+			baseline: map[string]Result{
+				"MemStorageGauge": {NsPerOp: 1},
+				"IngestURL":       {NsPerOp: 1},
+				"IngestBatch100":  {NsPerOp: 1},
+			},
+			want: []string{"IngestBatch100", "MemStorageGauge"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missing(results, tt.baseline); !slices.Equal(got, tt.want) {
+				t.Errorf("missing() = %v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+}
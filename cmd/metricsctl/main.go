@@ -0,0 +1,335 @@
+// Команда metricsctl читает и меняет метрики сервера из командной строки
+// через JSON API: для дежурных, которым некогда собирать URL для curl.
+//
+//	metricsctl get gauge Alloc
+//	metricsctl set gauge foo 1.5
+//	metricsctl set counter PollCount 3         # прибавить 3
+//	metricsctl list -format json
+//	metricsctl watch PollCount
+//	metricsctl -a https://metrics:8443 -tls-ca server.pem watch -prefix http_
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/certs"
+	"github.com/iliodor1/metrics-service/internal/netaddr"
+	"github.com/iliodor1/metrics-service/pkg/client"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Форматы вывода
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// watchRetry пауза перед повторным подключением к потоку обновлений
+const watchRetry = time.Second
+
+// usage краткая справка по командам
+const usage = `Использование: metricsctl [флаги] <команда> [аргументы]
+
+Команды:
+  get [-format text|json] <type> <name>   значение метрики
+  set <type> <name> <value>               установить gauge или прибавить к counter
+  list [-format text|json] [-prefix p]    все метрики
+  watch [-format text|json] [-prefix] <name>
+                                          обновления метрики по мере поступления
+
+Флаги:
+`
+
+func main() {
+	log.SetFlags(0)
+	var (
+		addr   string
+		key    string
+		apiKey string
+		token  string
+		tlsCA  string
+		tlsCrt string
+		tlsKey string
+	)
+	flag.StringVar(&addr, "a", "localhost:8080", "адрес сервера: host:port, URL или unix:/путь")
+	flag.StringVar(&key, "k", "", "ключ подписи запросов к серверу")
+	flag.StringVar(&apiKey, "api-key", "", "API-ключ арендатора")
+	flag.StringVar(&token, "token", "", "токен доступа к серверу")
+	flag.StringVar(&tlsCA, "tls-ca", "", "файл сертификата в формате PEM, которому доверять при HTTPS")
+	flag.StringVar(&tlsCrt, "tls-client-cert", "", "файл сертификата клиента в формате PEM для сервера, проверяющего клиентов по mTLS")
+	flag.StringVar(&tlsKey, "tls-client-key", "", "файл ключа сертификата клиента в формате PEM")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if v, ok := os.LookupEnv("ADDRESS"); ok {
+		addr = v
+	}
+	if v, ok := os.LookupEnv("KEY"); ok {
+		key = v
+	}
+	if v, ok := os.LookupEnv("API_KEY"); ok {
+		apiKey = v
+	}
+	if v, ok := os.LookupEnv("TOKEN"); ok {
+		token = v
+	}
+	if v, ok := os.LookupEnv("TLS_CA"); ok {
+		tlsCA = v
+	}
+	if v, ok := os.LookupEnv("TLS_CLIENT_CERT"); ok {
+		tlsCrt = v
+	}
+	if v, ok := os.LookupEnv("TLS_CLIENT_KEY"); ok {
+		tlsKey = v
+	}
+
+	var tlsConfig *tls.Config
+	if tlsCA != "" || tlsCrt != "" {
+		var err error
+		if tlsConfig, err = certs.ClientConfig(tlsCA, tlsCrt, tlsKey); err != nil {
+			log.Fatalf("Не удалось прочитать сертификаты TLS: %v", err)
+		}
+	}
+	_, transport := netaddr.Client(addr, tlsConfig)
+	c := client.New(addr,
+		client.WithHTTPClient(&http.Client{Timeout: 10 * time.Second, Transport: transport}),
+		client.WithKey(key),
+		client.WithAPIKey(apiKey),
+		client.WithBearerToken(token),
+		client.WithRetries(),
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var err error
+	switch args[0] {
+	case "get":
+		err = get(ctx, c, args[1:])
+	case "set":
+		err = set(ctx, c, args[1:])
+	case "list":
+		err = list(ctx, c, args[1:])
+	case "watch":
+		err = watch(ctx, c, args[1:])
+	default:
+		log.Printf("Неизвестная команда %q", args[0])
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// subcommand разбирает флаги команды name и проверяет число аргументов
+func subcommand(name string, args []string, define func(fs *flag.FlagSet), want int, usage string) []string {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Использование: metricsctl %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	if define != nil {
+		define(fs)
+	}
+	fs.Parse(args)
+	if fs.NArg() != want {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return fs.Args()
+}
+
+// checkFormat проверяет формат вывода
+func checkFormat(format string) error {
+	if format != formatText && format != formatJSON {
+		return fmt.Errorf("неверный формат %q: %s или %s", format, formatText, formatJSON)
+	}
+	return nil
+}
+
+// checkType проверяет тип метрики
+func checkType(mType string) error {
+	if mType != models.Gauge && mType != models.Counter {
+		return fmt.Errorf("неверный тип метрики %q: %s или %s", mType, models.Gauge, models.Counter)
+	}
+	return nil
+}
+
+// get выводит значение метрики
+func get(ctx context.Context, c *client.Client, args []string) error {
+	var format string
+	args = subcommand("get", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&format, "format", formatText, "формат вывода: text или json")
+	}, 2, "[-format text|json] <type> <name>")
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if err := checkType(args[0]); err != nil {
+		return err
+	}
+	m, err := c.GetMetric(ctx, args[0], args[1])
+	if errors.Is(err, client.ErrNotFound) {
+		return fmt.Errorf("метрика %s %s не найдена", args[0], args[1])
+	}
+	if err != nil {
+		return err
+	}
+	if format == formatJSON {
+		return printJSON(m)
+	}
+	fmt.Println(value(m))
+	return nil
+}
+
+// set устанавливает gauge или прибавляет приращение к counter
+// и выводит значение после обновления
+func set(ctx context.Context, c *client.Client, args []string) error {
+	args = subcommand("set", args, nil, 3, "<type> <name> <value>")
+	mType, name, raw := args[0], args[1], args[2]
+	if err := checkType(mType); err != nil {
+		return err
+	}
+	var err error
+	if mType == models.Gauge {
+		v, perr := strconv.ParseFloat(raw, 64)
+		if perr != nil {
+			return fmt.Errorf("неверное значение gauge %q", raw)
+		}
+		err = c.UpdateGauge(ctx, name, v)
+	} else {
+		delta, perr := strconv.ParseInt(raw, 10, 64)
+		if perr != nil {
+			return fmt.Errorf("неверное приращение counter %q", raw)
+		}
+		err = c.UpdateCounter(ctx, name, delta)
+	}
+	if err != nil {
+		return err
+	}
+	m, err := c.GetMetric(ctx, mType, name)
+	if err != nil {
+		return err
+	}
+	fmt.Println(value(m))
+	return nil
+}
+
+// list выводит все метрики, упорядоченные по имени
+func list(ctx context.Context, c *client.Client, args []string) error {
+	var format, prefix string
+	subcommand("list", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&format, "format", formatText, "формат вывода: text или json")
+		fs.StringVar(&prefix, "prefix", "", "только метрики с именами, начинающимися с префикса")
+	}, 0, "[-format text|json] [-prefix p]")
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	all, err := c.List(ctx)
+	if err != nil {
+		return err
+	}
+	metrics := make([]models.Metrics, 0, len(all))
+	for _, m := range all {
+		if strings.HasPrefix(m.ID, prefix) {
+			metrics = append(metrics, m)
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].ID != metrics[j].ID {
+			return metrics[i].ID < metrics[j].ID
+		}
+		return metrics[i].MType < metrics[j].MType
+	})
+	if format == formatJSON {
+		return printJSON(metrics)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, m := range metrics {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", m.MType, m.ID, value(m))
+	}
+	return tw.Flush()
+}
+
+// watch выводит обновления метрики по мере их поступления до прерывания.
+// При обрыве потока подключается заново.
+func watch(ctx context.Context, c *client.Client, args []string) error {
+	var format string
+	var byPrefix bool
+	args = subcommand("watch", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&format, "format", formatText, "формат вывода: text или json")
+		fs.BoolVar(&byPrefix, "prefix", false, "все метрики с именами, начинающимися с name")
+	}, 1, "[-format text|json] [-prefix] <name>")
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	name := args[0]
+	enc := json.NewEncoder(os.Stdout)
+	show := func(m models.Metrics) {
+		if !byPrefix && m.ID != name {
+			return
+		}
+		if format == formatJSON {
+			enc.Encode(m)
+			return
+		}
+		fmt.Printf("%s  %s  %s  %s\n", time.Now().Format("15:04:05.000"), m.MType, m.ID, value(m))
+	}
+	for {
+		err := c.Watch(ctx, name, show)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var se *client.StatusError
+		if errors.As(err, &se) && se.StatusCode < http.StatusInternalServerError {
+			return err
+		}
+		log.Printf("Поток обновлений прерван: %v; повтор через %s", err, watchRetry)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchRetry):
+		}
+	}
+}
+
+// value значение метрики для вывода
+func value(m models.Metrics) string {
+	switch {
+	case m.Value != nil:
+		return strconv.FormatFloat(*m.Value, 'f', -1, 64)
+	case m.Delta != nil:
+		return strconv.FormatInt(*m.Delta, 10)
+	}
+	return ""
+}
+
+// printJSON выводит v в формате JSON с отступами
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
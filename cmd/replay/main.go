@@ -0,0 +1,157 @@
+// Команда replay применяет журнал обновлений сервера (-wal) к другому
+// серверу или к файловому снимку: для учений по восстановлению после сбоя
+// и для воспроизведения нагрузки с рабочего сервера.
+//
+//	go run ./cmd/replay -wal metrics.wal -a localhost:8080             # как можно быстрее
+//	go run ./cmd/replay -wal metrics.wal -a localhost:8080 -speed 1    # в исходном темпе
+//	go run ./cmd/replay -wal metrics.wal -base metrics.db -o restored.db
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/pkg/client"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// batchSize наибольшее число обновлений в одном запросе к серверу
+const batchSize = 1000
+
+func main() {
+	var (
+		walPath string
+		addr    string
+		key     string
+		speed   float64
+		base    string
+		out     string
+		format  string
+	)
+	flag.StringVar(&walPath, "wal", "", "журнал обновлений сервера")
+	flag.StringVar(&addr, "a", "localhost:8080", "адрес сервера, к которому применяется журнал: host:port, URL или unix:/путь")
+	flag.StringVar(&key, "k", "", "ключ подписи запросов к серверу")
+	flag.Float64Var(&speed, "speed", 0, "темп воспроизведения относительно исходного, например 1 или 10 (0 — как можно быстрее)")
+	flag.StringVar(&base, "base", "", "снимок, поверх которого применяется журнал при записи в файл")
+	flag.StringVar(&out, "o", "", "записать результат в файл снимка вместо отправки на сервер")
+	flag.StringVar(&format, "format", storage.FormatJSON, "формат снимка -o: json или binary")
+	flag.Parse()
+
+	if walPath == "" {
+		log.Fatal("Не задан журнал обновлений -wal")
+	}
+	if speed < 0 {
+		log.Fatal("Темп -speed не может быть отрицательным")
+	}
+	f, err := os.Open(walPath)
+	if err != nil {
+		log.Fatalf("Не удалось открыть журнал: %v", err)
+	}
+	defer f.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	var applied int
+	var size int64
+	if out != "" {
+		applied, size, err = replayToFile(ctx, f, base, out, format)
+	} else {
+		applied, size, err = replayToServer(ctx, f, client.New(addr, client.WithKey(key)), speed)
+	}
+	if err != nil {
+		log.Fatalf("Применено %d обновлений, затем ошибка: %v", applied, err)
+	}
+	if info, err := f.Stat(); err == nil && info.Size() > size {
+		log.Printf("Повреждённый хвост журнала пропущен: %d байт", info.Size()-size)
+	}
+	log.Printf("Применено %d обновлений за %s", applied, time.Since(start).Round(time.Millisecond))
+}
+
+// replayToFile применяет журнал к снимку base и сохраняет результат в out
+func replayToFile(ctx context.Context, f *os.File, base, out, format string) (int, int64, error) {
+	mem := storage.NewMemStorage()
+	if base != "" {
+		if err := storage.LoadFile(ctx, mem, base); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	applied := 0
+	size, err := storage.ReadWAL(f, func(rec storage.WALRecord) error {
+		if err := storage.Update(ctx, mem, rec.Metric); err != nil {
+			log.Printf("Обновление %s пропущено: %v", rec.Metric.ID, err)
+			return nil
+		}
+		applied++
+		return nil
+	})
+	if err != nil {
+		return applied, size, err
+	}
+	_, err = storage.SaveFile(ctx, mem, out, format)
+	return applied, size, err
+}
+
+// replayToServer отправляет обновления журнала на сервер пакетами.
+// Если speed больше нуля, паузы между обновлениями повторяют исходные,
+// делённые на speed.
+func replayToServer(ctx context.Context, f *os.File, c *client.Client, speed float64) (int, int64, error) {
+	var (
+		applied int
+		batch   []models.Metrics
+		first   time.Time
+		start   = time.Now()
+	)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := c.UpdateBatch(ctx, batch); err != nil {
+			return err
+		}
+		applied += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	size, err := storage.ReadWAL(f, func(rec storage.WALRecord) error {
+		// Журналы без времени обновлений воспроизводятся без пауз
+		if speed > 0 && !rec.Time.IsZero() {
+			if first.IsZero() {
+				first = rec.Time
+			}
+			at := start.Add(time.Duration(float64(rec.Time.Sub(first)) / speed))
+			if wait := time.Until(at); wait > 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+		batch = append(batch, rec.Metric)
+		if len(batch) == batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if errors.Is(err, context.Canceled) {
+		err = errors.New("прервано")
+	}
+	return applied, size, err
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/iliodor1/metrics-service/internal/auth"
+	"github.com/iliodor1/metrics-service/internal/middleware"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+)
+
+// Обёртки запросов, из которых собирается цепочка вокруг маршрутизатора
+const (
+	mwRecover       = "recover"
+	mwLog           = "log"
+	mwCORS          = "cors"
+	mwTrustedSubnet = "trusted_subnet"
+	mwAuth          = "auth"
+	mwRateLimit     = "ratelimit"
+	mwGzip          = "gzip"
+	mwSign          = "sign"
+)
+
+// middlewareNames возвращает имена обёрток цепочки. По умолчанию
+// паники перехватываются, предварительные запросы CORS обрабатываются
+// до проверки подсети, а подпись и сжатие применяются ко всем ответам.
+// Проверка подсети в цепочке по умолчанию есть всегда, чтобы подсети
+// можно было задать на ходу.
+func middlewareNames(cfg Config) ([]string, error) {
+	names := cfg.Middlewares
+	if names == nil {
+		names = []string{mwRecover, mwCORS, mwTrustedSubnet, mwGzip, mwSign}
+	}
+	if err := checkTrustedSubnet(cfg, names); err != nil {
+		return nil, err
+	}
+	if slices.Contains(names, mwAuth) && cfg.Tenants == nil && !cfg.Auth.Enabled() {
+		return nil, errors.New("auth в цепочке, но не заданы ни арендаторы, ни проверка клиентов")
+	}
+	return names, nil
+}
+
+// checkTrustedSubnet проверяет, что заданные доверенные подсети
+// проверяются цепочкой names
+func checkTrustedSubnet(cfg Config, names []string) error {
+	if cfg.trustedSubnet() != "" && !slices.Contains(names, mwTrustedSubnet) {
+		return errors.New("доверенная подсеть задана, но trusted_subnet нет в цепочке")
+	}
+	return nil
+}
+
+// buildChain собирает цепочку обёрток по настройкам. Ограничитель
+// в цепочке применяется ко всем запросам; без него он оборачивает
+// только маршруты обновления метрик.
+func buildChain(cfg Config, names []string, limiter *middleware.RateLimiter, subnets *middleware.SubnetFilter, tenants *tenant.Registry, a auth.Authenticator) ([]middleware.Middleware, error) {
+	available := map[string]middleware.Middleware{
+		mwRecover:       middleware.Recover,
+		mwLog:           middleware.Logging,
+		mwCORS:          middleware.CORS(cfg.CORS),
+		mwTrustedSubnet: subnets.Middleware,
+		mwAuth:          identify(tenants, a),
+		mwRateLimit:     limiter.Middleware,
+		mwGzip:          middleware.Gzip,
+		mwSign:          middleware.Sign(cfg.Key, cfg.SignAlgorithms),
+	}
+	return middleware.Build(names, available)
+}
+
+// identify определяет арендатора и проверенного клиента запроса ещё
+// в цепочке, чтобы следующие за ней обёртки, например ограничитель,
+// различали клиентов. Запросы не отклоняются: это делают маршруты,
+// не проверяя клиента повторно.
+func identify(tenants *tenant.Registry, a auth.Authenticator) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		if a != nil {
+			next = auth.Identify(a)(next)
+		}
+		if tenants != nil {
+			next = tenants.Identify(next)
+		}
+		return next
+	}
+}
+
+// requestPrincipal проверенный клиент запроса для ограничителя частоты
+// и ключей идемпотентности: арендатор API-ключа или клиент, прошедший
+// проверку токена. Ограничитель в цепочке до auth работает до проверки
+// и ограничивает запросы по IP.
+func requestPrincipal(r *http.Request) string {
+	if t := tenant.FromContext(r.Context()); t != "" {
+		return "tenant:" + t
+	}
+	if p, ok := auth.FromContext(r.Context()); ok {
+		return "auth:" + p.Name
+	}
+	return ""
+}
@@ -1,130 +1,586 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"log"
 	"net/http"
-	"strconv"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/alerts"
+	"github.com/iliodor1/metrics-service/internal/audit"
+	"github.com/iliodor1/metrics-service/internal/auth"
+	"github.com/iliodor1/metrics-service/internal/buildinfo"
+	"github.com/iliodor1/metrics-service/internal/certs"
+	"github.com/iliodor1/metrics-service/internal/collectd"
+	"github.com/iliodor1/metrics-service/internal/commands"
+	"github.com/iliodor1/metrics-service/internal/freeze"
+	"github.com/iliodor1/metrics-service/internal/gctune"
+	"github.com/iliodor1/metrics-service/internal/handlers"
+	"github.com/iliodor1/metrics-service/internal/history"
+	"github.com/iliodor1/metrics-service/internal/hygiene"
+	"github.com/iliodor1/metrics-service/internal/middleware"
+	"github.com/iliodor1/metrics-service/internal/namepolicy"
+	"github.com/iliodor1/metrics-service/internal/namespace"
+	"github.com/iliodor1/metrics-service/internal/netaddr"
+	"github.com/iliodor1/metrics-service/internal/offsets"
+	"github.com/iliodor1/metrics-service/internal/openapi"
+	"github.com/iliodor1/metrics-service/internal/privacy"
+	"github.com/iliodor1/metrics-service/internal/publish"
+	"github.com/iliodor1/metrics-service/internal/push"
+	"github.com/iliodor1/metrics-service/internal/relay"
+	"github.com/iliodor1/metrics-service/internal/replica"
+	"github.com/iliodor1/metrics-service/internal/selfmetrics"
+	"github.com/iliodor1/metrics-service/internal/slo"
+	"github.com/iliodor1/metrics-service/internal/statsd"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/internal/stream"
+	"github.com/iliodor1/metrics-service/internal/synthetic"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/internal/tracing"
+	"github.com/iliodor1/metrics-service/internal/units"
+	"github.com/iliodor1/metrics-service/internal/zabbix"
+	"github.com/iliodor1/metrics-service/pkg/models"
 )
 
-// Storage интерфейс для хранения метрик
-type Storage interface {
-	UpdateGauge(name string, value float64) error
-	UpdateCounter(name string, delta int64) error
-}
+// maxIdempotencyKeys наибольшее число запоминаемых ключей идемпотентности
+const maxIdempotencyKeys = 100000
 
-// MemStorage структура для хранения метрик в памяти
-type MemStorage struct {
-	gauges   map[string]float64
-	counters map[string]int64
-}
+// maxSourcePartitions наибольшее число учитываемых разделов источников конвейеров
+const maxSourcePartitions = 10000
+
+// Сведения о сборке, задаются флагами компоновщика:
+// go build -ldflags "-X main.buildVersion=v1.2.3 -X main.buildDate=... -X main.buildCommit=..."
+var (
+	buildVersion string
+	buildDate    string
+	buildCommit  string
+)
+
+func main() {
+	started := time.Now()
+	build := buildinfo.New(buildVersion, buildDate, buildCommit)
+	build.Log()
+
+	// Читаем настройки
+	cfg := parseConfig()
 
-// NewMemStorage создаёт новое хранилище метрик
-func NewMemStorage() *MemStorage {
-	return &MemStorage{
-		gauges:   make(map[string]float64),
-		counters: make(map[string]int64),
+	// Контекст отменяется при остановке сервера
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// В режиме самотестирования проверяем окружение и завершаемся
+	if cfg.SelfTest {
+		stop()
+		os.Exit(runSelfTest(context.Background(), cfg, os.Stdout))
+	}
+	// В режиме миграций обновляем схему баз и завершаемся
+	if cfg.MigrateOnly {
+		code := runMigrations(ctx, cfg)
+		stop()
+		os.Exit(code)
 	}
-}
 
-// UpdateGauge обновляет или добавляет метрику типа gauge
-func (m *MemStorage) UpdateGauge(name string, value float64) error {
-	m.gauges[name] = value
-	return nil
-}
+	// Фоновые задачи, которые должны завершиться до выхода
+	var background sync.WaitGroup
 
-// UpdateCounter обновляет или добавляет метрику типа counter
-func (m *MemStorage) UpdateCounter(name string, delta int64) error {
-	m.counters[name] += delta
-	return nil
-}
+	// Статистика записей механизмов сохранения для отчёта об усилении записи
+	stats := storage.NewWriteStats()
 
-// Handler структура для хранения зависимостей обработчика
-type Handler struct {
-	storage Storage
-}
+	// История значений заводится до хранилищ: они удаляют историю
+	// вытесненных метрик и учитывают её в бюджете памяти
+	var hist *history.Store
+	if cfg.HistorySize > 0 {
+		hist = history.NewStore(cfg.HistorySize)
+	}
 
-// NewHandler создаёт новый экземпляр обработчика
-func NewHandler(storage Storage) *Handler {
-	return &Handler{
-		storage: storage,
+	// Открываем общее хранилище и хранилища арендаторов
+	def, err := openBackend(ctx, "", defaultBackendConfig(cfg), stats, hist)
+	if err != nil {
+		log.Fatalf("Не удалось открыть хранилище: %v", err)
+	}
+	backends := []*backend{def}
+	var store storage.Storage = def.store
+	if len(cfg.TenantBackends) > 0 {
+		router := storage.NewRouter(def.store, tenant.Separator)
+		names := make([]string, 0, len(cfg.TenantBackends))
+		for name := range cfg.TenantBackends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b, err := openBackend(ctx, name, cfg.TenantBackends[name], stats, hist)
+			if err != nil {
+				log.Fatalf("Не удалось открыть хранилище арендатора %s: %v", name, err)
+			}
+			router.Route(name, b.store)
+			backends = append(backends, b)
+		}
+		store = router
+	}
+	// Части хранилищ sharded сохраняются и закрываются как отдельные хранилища
+	var all []*backend
+	for _, b := range backends {
+		all = append(all, b.flatten()...)
+	}
+	backends = all
+	for _, b := range backends {
+		defer b.close()
+		log.Println(b.describe())
 	}
-}
 
-// webhook обработчик для приёма метрик
-func (h *Handler) webhook(w http.ResponseWriter, r *http.Request) {
-	// Проверка метода запроса
-	if r.Method != http.MethodPost {
-		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
-		return
+	// При необходимости записываем историю значений
+	if hist != nil {
+		store = storage.NewHistory(store, hist)
+		// Хранилища postgres хранят историю в базе и переживают перезапуск
+		persistHistory(ctx, backends, hist, cfg.HistorySize, cfg.HistoryRetention, cfg.CompactInterval)
+		// Фоновое сворачивание истории в агрегаты 1m/5m/1h
+		go hist.RunCompaction(ctx, cfg.CompactInterval, cfg.HistoryRetention)
 	}
 
-	// Разбор URL
-	// Ожидаемый формат: /update/<type>/<name>/<value>
-	path := strings.TrimPrefix(r.URL.Path, "/update/")
-	parts := strings.Split(path, "/")
+	// В режиме ретранслятора пересылаем агрегаты обновлений на вышестоящий сервер
+	if cfg.Relay != nil {
+		r, err := relay.New(*cfg.Relay)
+		if err != nil {
+			log.Fatalf("Неверные настройки ретранслятора: %v", err)
+		}
+		store = storage.NewTee(store, r)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			r.Run(ctx)
+		}()
+		log.Printf("Агрегаты метрик пересылаются на %s\n", cfg.Relay.Upstream)
+	}
 
-	// Проверка наличия имени метрики
-	if len(parts) != 3 {
-		http.Error(w, "Имя метрики не может быть пустым.", http.StatusNotFound)
-		return
+	// Правила имён проверяются при приёме метрик и при поиске неиспользуемых
+	policy, err := namepolicy.New(cfg.MetricNames)
+	if err != nil {
+		log.Fatalf("Неверные правила имён метрик: %v", err)
+	}
+	// При необходимости отмечаем изменения метрик для поиска неиспользуемых
+	var detector *hygiene.Detector
+	if cfg.HygieneInterval > 0 {
+		detector = hygiene.New(store, cfg.HygieneWindow, policy.Check)
 	}
 
-	metricType, metricName, metricValue := parts[0], parts[1], parts[2]
+	// Рассылаем принятые обновления подписчикам потоков и учитываем их
+	// для отчёта об усилении записи
+	hub := stream.NewHub()
+	store = storage.NewNotify(store, func(m models.Metrics) {
+		hub.Publish(m)
+		stats.Accept()
+		if detector != nil {
+			detector.Observe(m)
+		}
+	})
+	saveSettings := storage.SaveSettings{Path: def.file.Path, Format: cfg.SnapshotFormat, Interval: cfg.StoreInterval, WAL: def.wal != nil}
 
-	// Обработка в зависимости от типа метрики
-	switch metricType {
-	case "gauge":
-		// Парсинг значения как float64
-		value, err := strconv.ParseFloat(metricValue, 64)
+	// Создаём обязательные метрики, которых нет после восстановления.
+	// Реплика получает их от основного сервера.
+	if len(cfg.Bootstrap) > 0 && cfg.ReplicaOf == "" {
+		n, err := storage.Bootstrap(ctx, store, cfg.Bootstrap)
 		if err != nil {
-			http.Error(w, "Неверное значение для gauge. Ожидается float64.", http.StatusBadRequest)
-			return
+			log.Fatalf("Не удалось создать обязательные метрики: %v", err)
+		}
+		log.Printf("Обязательных метрик %d, создано %d\n", len(cfg.Bootstrap), n)
+	}
+
+	// Реплика повторяет записи основного сервера, а сама их не принимает
+	var rep *replica.Replica
+	if cfg.ReplicaOf != "" {
+		rep = replica.New(cfg.ReplicaOf, cfg.ReplicaToken, store)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			rep.Run(ctx)
+		}()
+		store = storage.NewReadOnly(store)
+		log.Printf("Сервер работает репликой %s\n", cfg.ReplicaOf)
+	}
+
+	// Во время окон заморозки отклоняем обновления метрик с заданными
+	// префиксами на всех путях приёма; реплика получает записи в обход
+	freezer, err := freeze.New(cfg.Freeze)
+	if err != nil {
+		log.Fatalf("Неверные окна заморозки: %v", err)
+	}
+	store = storage.NewGuarded(store, freezer.Check)
+
+	// Подстраиваем сборщик мусора под бюджет памяти и публикуем его метрики
+	if cfg.MemoryLimit > 0 {
+		go gctune.New(cfg.MemoryLimit, store).Run(ctx, 10*time.Second)
+	}
+
+	// Публикуем метрики самого сервера в _internal/. Реплика получает
+	// их от основного сервера, поэтому свои не публикует.
+	var recorder *selfmetrics.Recorder
+	if cfg.SelfMetricsInterval > 0 && rep == nil {
+		recorder = selfmetrics.New(store)
+		for _, b := range backends {
+			b.recorder = recorder
 		}
-		// Обновление метрики
-		if err := h.storage.UpdateGauge(metricName, value); err != nil {
-			http.Error(w, "Ошибка при обновлении gauge метрики.", http.StatusInternalServerError)
-			return
+		go recorder.Run(ctx, cfg.SelfMetricsInterval)
+	}
+
+	// Генерируем тестовые ряды, если включён режим -synthetic
+	var generator *synthetic.Generator
+	if cfg.Synthetic {
+		var sc synthetic.Config
+		if cfg.SyntheticSeries != nil {
+			sc = *cfg.SyntheticSeries
 		}
-	case "counter":
-		// Парсинг значения как int64
-		delta, err := strconv.ParseInt(metricValue, 10, 64)
+		generator, err = synthetic.New(store, sc)
 		if err != nil {
-			http.Error(w, "Неверное значение для counter. Ожидается int64.", http.StatusBadRequest)
-			return
+			log.Fatalf("Неверные настройки тестовых рядов: %v", err)
 		}
-		// Обновление метрики
-		if err := h.storage.UpdateCounter(metricName, delta); err != nil {
+		go generator.Run(ctx)
+		log.Printf("Генерируются тестовые ряды: %d\n", len(generator.Series()))
+	}
 
-			http.Error(w, "Ошибка при обновлении counter метрики.", http.StatusInternalServerError)
-			return
+	// Создаём реестр единиц измерения
+	registry, err := units.NewRegistry(cfg.UnitRules)
+	if err != nil {
+		log.Fatalf("Неверные правила перевода единиц: %v", err)
+	}
+	// Единица задаётся метрике типа вида counter/name или метрикам обоих
+	// типов с именем name
+	for key, unit := range cfg.MetricUnits {
+		types := []string{models.Gauge, models.Counter}
+		name := key
+		if mType, rest, ok := strings.Cut(key, "/"); ok {
+			if mType != models.Gauge && mType != models.Counter {
+				log.Fatalf("Неверный тип метрики %s в единицах измерения", key)
+			}
+			types, name = []string{mType}, rest
+		}
+		for _, mType := range types {
+			if err := registry.SetUnit(mType, name, unit); err != nil {
+				log.Fatalf("Неверная единица измерения метрики %s: %v", key, err)
+			}
 		}
-	default:
-		http.Error(w, "Неподдерживаемый тип метрики. Допустимые типы: gauge, counter.", http.StatusBadRequest)
-		return
 	}
 
-	// Успешный ответ
-	w.WriteHeader(http.StatusOK)
-}
+	// Запускаем периодическую отправку отчётов во внешние системы
+	if len(cfg.Push) > 0 {
+		go push.New(store, cfg.Push).Run(ctx)
+	}
 
-func main() {
-	// Создаём новое хранилище
-	storage := NewMemStorage()
+	// Искажаем чувствительные метрики для внешних потребителей
+	var obfuscation *privacy.Policy
+	if cfg.Privacy != nil {
+		obfuscation, err = privacy.New(*cfg.Privacy)
+		if err != nil {
+			log.Fatalf("Неверные правила искажения метрик: %v", err)
+		}
+	}
+
+	// Запускаем публикацию публичных снимков метрик
+	if len(cfg.Publish) > 0 {
+		go publish.New(store, cfg.Publish, obfuscation).Run(ctx)
+	}
+
+	// Запускаем приём метрик по протоколу StatsD
+	if cfg.StatsDAddress != "" {
+		listener := statsd.NewListener(cfg.StatsDAddress, store, policy)
+		go func() {
+			if err := listener.Run(ctx); err != nil {
+				log.Fatalf("Не удалось запустить приём StatsD: %v", err)
+			}
+		}()
+		log.Printf("Приём StatsD на udp://%s\n", cfg.StatsDAddress)
+	}
+
+	// Запускаем приём пакетов collectd
+	if cfg.CollectdAddress != "" {
+		listener, err := collectd.NewListener(cfg.CollectdAddress, store, policy, cfg.Collectd)
+		if err != nil {
+			log.Fatalf("Неверные настройки приёма collectd: %v", err)
+		}
+		go func() {
+			if err := listener.Run(ctx); err != nil {
+				log.Fatalf("Не удалось запустить приём collectd: %v", err)
+			}
+		}()
+		log.Printf("Приём collectd на udp://%s\n", cfg.CollectdAddress)
+	}
+
+	// Запускаем приём данных Zabbix sender
+	if cfg.ZabbixAddress != "" {
+		listener, err := zabbix.NewListener(cfg.ZabbixAddress, store, policy, cfg.Zabbix)
+		if err != nil {
+			log.Fatalf("Неверные настройки приёма Zabbix: %v", err)
+		}
+		go func() {
+			if err := listener.Run(ctx); err != nil {
+				log.Fatalf("Не удалось запустить приём Zabbix: %v", err)
+			}
+		}()
+		log.Printf("Приём Zabbix sender на tcp://%s\n", cfg.ZabbixAddress)
+	}
+
+	// Запускаем проверку правил оповещений
+	var engine *alerts.Engine
+	if cfg.Alerts != nil {
+		engine, err = alerts.NewEngine(store, *cfg.Alerts)
+		if err != nil {
+			log.Fatalf("Неверные правила оповещений: %v", err)
+		}
+		go engine.Run(ctx)
+	}
+
+	// Отслеживаем цели уровня обслуживания; оповещения о расходовании
+	// бюджета ошибок проверяет движок оповещений
+	var tracker *slo.Tracker
+	if cfg.SLO != nil {
+		tracker, err = slo.New(store, store, *cfg.SLO)
+		if err != nil {
+			log.Fatalf("Неверные настройки SLO: %v", err)
+		}
+		for _, rule := range tracker.Rules() {
+			if engine == nil {
+				log.Fatal("Для оповещений SLO нужен раздел alerts файла конфигурации")
+			}
+			if err := engine.Put(rule); err != nil {
+				log.Fatalf("Неверное оповещение SLO: %v", err)
+			}
+		}
+		go tracker.Run(ctx)
+	}
 
 	// Создаём новый обработчик с зависимостями
-	handler := NewHandler(storage)
+	names, err := namespace.New(cfg.Namespaces)
+	if err != nil {
+		log.Fatalf("Неверные настройки пространств имён: %v", err)
+	}
+	opts := []handlers.Option{
+		handlers.WithHistory(hist),
+		handlers.WithNamePolicy(policy),
+		handlers.WithGaugePrecision(cfg.GaugePrecision),
+		handlers.WithFreeze(freezer),
+		handlers.WithMaxBodySize(cfg.MaxBodySize),
+	}
+	if detector != nil {
+		opts = append(opts, handlers.WithHygiene(detector))
+		go detector.Run(ctx, cfg.HygieneInterval)
+	}
 
-	// Регистрируем обработчик для пути /update/
-	// Функция ServeMux автоматически передаст запросы, начинающиеся с /update/, этому обработчику
-	http.HandleFunc("/update/", handler.webhook)
+	// При необходимости ведём журнал аудита изменений метрик и настроек
+	var auditLog *audit.Log
+	if cfg.AuditFile != "" {
+		auditLog, err = audit.Open(cfg.AuditFile, cfg.AuditMaxSize, cfg.AuditMaxFiles)
+		if err != nil {
+			log.Fatalf("Не удалось открыть журнал аудита: %v", err)
+		}
+		defer auditLog.Close()
+		opts = append(opts, handlers.WithAudit(auditLog))
+		log.Printf("Журнал аудита: %s\n", cfg.AuditFile)
+	}
+	handler := handlers.New(store, registry, names, opts...)
+
+	// Обработчики обновления метрик защищены ограничителем частоты; он создаётся
+	// и без лимита, чтобы лимит можно было включить на ходу
+	l := cfg.limits()
+	limiter := middleware.NewRateLimiter(l.Rate, l.Burst, l.By, requestPrincipal)
+
+	// Повторы обновлений с тем же ключом идемпотентности не применяются
+	var idempotency func(http.Handler) http.Handler
+	if cfg.IdempotencyWindow > 0 {
+		idempotency = middleware.NewIdempotency(cfg.IdempotencyWindow, maxIdempotencyKeys, requestPrincipal).Middleware
+	}
+
+	// Разделяем метрики по арендаторам, если заданы их ключи
+	var tenants *tenant.Registry
+	var tenantKeys auth.KeyLookup
+	if cfg.Tenants != nil {
+		// Без токена администратора ключи арендаторов некому выдавать,
+		// а административные снимки и копии содержат метрики всех арендаторов
+		if cfg.AdminToken == "" {
+			log.Fatal("Для разделения метрик по арендаторам задайте токен администратора (-admin-token или ADMIN_TOKEN)")
+		}
+		tenants, err = tenant.NewRegistry(*cfg.Tenants)
+		if err != nil {
+			log.Fatalf("Неверные ключи арендаторов: %v", err)
+		}
+		tenantKeys = tenants
+	}
+
+	// Проверяем клиентов маршрутов метрик, если в разделе auth задан
+	// хотя бы один способ проверки
+	var authChain *auth.Chain
+	var authenticator auth.Authenticator
+	if cfg.Auth.Enabled() {
+		authChain, err = auth.New(cfg.Auth, tenantKeys)
+		if err != nil {
+			log.Fatalf("Неверные настройки проверки клиентов: %v", err)
+		}
+		authenticator = authChain
+	}
+
+	// Доверенные подсети, как и лимиты, перечитываются на ходу
+	subnets, err := middleware.NewSubnetFilter(cfg.trustedSubnet())
+	if err != nil {
+		log.Fatalf("Неверная доверенная подсеть: %v", err)
+	}
+
+	// Сквозные обёртки запросов собираются в цепочку вокруг маршрутизатора
+	chainNames, err := middlewareNames(cfg)
+	if err != nil {
+		log.Fatalf("Неверная цепочка обёрток: %v", err)
+	}
+	chain, err := buildChain(cfg, chainNames, limiter, subnets, tenants, authenticator)
+	if err != nil {
+		log.Fatalf("Неверная цепочка обёрток: %v", err)
+	}
+	limitUpdates := limiter.Middleware
+	if slices.Contains(chainNames, mwRateLimit) {
+		limitUpdates = nil
+	}
+
+	// Перечитываем лимиты, доверенные подсети, правила оповещений и способы
+	// проверки клиентов по SIGHUP и POST /admin/reload
+	reload := newReloader(cfg, chainNames, limiter, subnets, engine, tracker, authChain, auditLog)
+	go reload.watchSIGHUP(ctx)
+	if cfg.AdminToken == "" {
+		if cfg.BackupDir != "" {
+			log.Fatal("Для резервных копий задайте токен администратора (-admin-token или ADMIN_TOKEN)")
+		}
+		log.Println("Токен администратора не задан: административное API /admin/ отключено")
+	}
+
+	// Регистрируем маршруты и строим по ним спецификацию OpenAPI
+	// Трассируем запросы, если задан сборщик OpenTelemetry
+	var tracer *tracing.Tracer
+	if cfg.OTLPEndpoint != "" {
+		tracer, err = tracing.New(cfg.OTLPEndpoint, cfg.ServiceName)
+		if err != nil {
+			log.Fatalf("Неверные настройки трассировки: %v", err)
+		}
+		log.Printf("Трассировки отправляются в %s\n", cfg.OTLPEndpoint)
+	}
+
+	health := handlers.NewHealth()
+	mux := http.NewServeMux()
+	spec := openapi.New("Сервер сбора метрик", "1.0.0")
+	handlers.Register(mux, spec, handler, handlers.Services{
+		Commands:  commands.NewQueue(),
+		Alerts:    engine,
+		Freeze:    freezer,
+		Privacy:   obfuscation,
+		Self:      recorder,
+		Tracer:    tracer,
+		SLO:       tracker,
+		Synthetic: generator,
+		Stream:    hub,
+		Tenants:   tenants,
+		Persistence: &handlers.Persistence{
+			Stats:    stats,
+			Settings: saveSettings,
+		},
+		Replica:     rep,
+		Health:      health,
+		Backup:      &handlers.Backup{Dir: cfg.BackupDir},
+		Limit:       limitUpdates,
+		Idempotency: idempotency,
+		Offsets:     offsets.New(maxSourcePartitions),
+		Reload:      reload.Reload,
+		Settings:    reload.Settings,
+		AdminToken:  cfg.AdminToken,
+		Auth:        authenticator,
+		Build:       build,
+	})
+
+	root := middleware.Chain(mux, chain...)
+	log.Printf("Цепочка обёрток запросов: %s\n", strings.Join(chainNames, ", "))
+
+	// Периодически сохраняем снимки хранилищ
+	for _, b := range backends {
+		go b.saveLoop(ctx, stats)
+	}
 
 	// Настройка адреса сервера
-	addr := "localhost:8080"
-	log.Printf("Сервер запущен на http://%s\n", addr)
+	ln, err := netaddr.Listen(cfg.Address)
+	if err != nil {
+		log.Fatalf("Не удалось открыть адрес %s: %v", cfg.Address, err)
+	}
+	srv := &http.Server{
+		Handler:           root,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	srv.RegisterOnShutdown(hub.Close)
+	scheme := "http"
+	if cfg.EnableHTTPS {
+		cert, generated, err := certs.Load(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			log.Fatalf("Не удалось загрузить сертификат TLS: %v", err)
+		}
+		if generated {
+			log.Printf("Выпущен самоподписанный сертификат, SHA-256: %s", certs.Fingerprint(cert))
+			if cfg.TLSCert != "" {
+				log.Printf("Сертификат сохранён в %s: передайте его агентам (-tls-ca)", cfg.TLSCert)
+			}
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		if cfg.TLSClientCA != "" {
+			// Сертификат клиента необязателен: без него клиент проверяется
+			// другими способами раздела auth
+			pool, err := certs.Pool(cfg.TLSClientCA)
+			if err != nil {
+				log.Fatalf("Не удалось загрузить сертификаты клиентов: %v", err)
+			}
+			srv.TLSConfig.ClientCAs = pool
+			srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		scheme = "https"
+	}
+	health.Started()
+	log.Printf("Сервер запущен на %s\n", netaddr.URL(cfg.Address, scheme))
 
 	// Запуск HTTP-сервера
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatalf("Не удалось запустить сервер: %v", err)
+	go func() {
+		var err error
+		if cfg.EnableHTTPS {
+			// Сертификат уже задан в TLSConfig
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Не удалось запустить сервер: %v", err)
+		}
+	}()
+
+	// Дожидаемся остановки, завершаем запросы, сохраняем последние снимки
+	// и сообщаем, не пропали ли данные
+	<-ctx.Done()
+	health.Stopping()
+	if cfg.ShutdownDelay > 0 {
+		log.Printf("Сервер остановится через %s\n", cfg.ShutdownDelay)
+		time.Sleep(cfg.ShutdownDelay)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Ошибка при остановке сервера: %v", err)
+	}
+	background.Wait()
+	if err := tracer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Не удалось отправить последние трассировки: %v", err)
+	}
+	report := newShutdownReport(started, stats)
+	for _, b := range backends {
+		report.flush(b, stats)
 	}
+	report.write(cfg.ShutdownReport)
 }
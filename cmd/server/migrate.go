@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+)
+
+// runMigrations применяет миграции схемы ко всем хранилищам postgres
+// из настроек — общему, арендаторов и их частям — и возвращает код
+// завершения: 0, если все базы обновлены. Другие хранилища не открываются.
+func runMigrations(ctx context.Context, cfg Config) int {
+	backendConfigs := map[string]backendConfig{"общее хранилище": defaultBackendConfig(cfg)}
+	for name, bc := range cfg.TenantBackends {
+		backendConfigs["хранилище арендатора "+name] = bc
+	}
+	titles := make([]string, 0, len(backendConfigs))
+	for title := range backendConfigs {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+
+	found, failed := 0, 0
+	for _, title := range titles {
+		for _, pc := range postgresConfigs(title, backendConfigs[title]) {
+			found++
+			ps, err := openPostgres(ctx, pc.title, pc.bc)
+			if err != nil {
+				log.Printf("%s: %v", pc.title, err)
+				failed++
+				continue
+			}
+			ps.Close()
+			log.Printf("%s: схема базы актуальна", pc.title)
+		}
+	}
+	if found == 0 {
+		log.Print("Не задано ни одного хранилища PostgreSQL (-d или тип postgres в файле конфигурации)")
+		return 1
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// titledConfig настройки хранилища с его названием для журнала
+type titledConfig struct {
+	title string
+	bc    backendConfig
+}
+
+// postgresConfigs возвращает хранилища postgres среди bc и его частей
+func postgresConfigs(title string, bc backendConfig) []titledConfig {
+	switch bc.Type {
+	case backendPostgres:
+		return []titledConfig{{title: title, bc: bc}}
+	case backendSharded:
+		shards := make([]string, 0, len(bc.Shards))
+		for shard := range bc.Shards {
+			shards = append(shards, shard)
+		}
+		sort.Strings(shards)
+		var all []titledConfig
+		for _, shard := range shards {
+			all = append(all, postgresConfigs(title+", часть "+shard, bc.Shards[shard])...)
+		}
+		return all
+	}
+	return nil
+}
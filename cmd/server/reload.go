@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/alerts"
+	"github.com/iliodor1/metrics-service/internal/audit"
+	"github.com/iliodor1/metrics-service/internal/auth"
+	"github.com/iliodor1/metrics-service/internal/middleware"
+	"github.com/iliodor1/metrics-service/internal/slo"
+)
+
+// reloader перечитывает файл конфигурации на ходу, не теряя метрик
+// в памяти. Меняются только лимиты запросов, доверенные подсети, правила
+// оповещений и токены доступа; остальные разделы файла применяются после
+// перезапуска. Уровней журнала у сервера нет: он пишет все сообщения.
+type reloader struct {
+	// mu не даёт двум перечитываниям применяться вперемешку
+	mu      sync.Mutex
+	current atomic.Pointer[Config]
+
+	// chain имена обёрток цепочки, собранной при запуске
+	chain   []string
+	limiter *middleware.RateLimiter
+	subnets *middleware.SubnetFilter
+	engine  *alerts.Engine
+	tracker *slo.Tracker
+	auth    *auth.Chain
+	// audit журнал, в который отмечаются перечитывания по SIGHUP
+	// (nil — журнал не ведётся)
+	audit *audit.Log
+}
+
+// reloadSettings перечитываемые настройки в журнале аудита
+type reloadSettings struct {
+	RateLimit     rateLimits    `json:"rate_limit"`
+	TrustedSubnet string        `json:"trusted_subnet,omitempty"`
+	Webhook       string        `json:"webhook,omitempty"`
+	Rules         []alerts.Rule `json:"rules,omitempty"`
+	// AuthClients имена постоянных токенов и клиентов mTLS, RevokedSubjects отозванные
+	// клиенты JWT; сами токены и секреты в журнал не попадают
+	AuthClients     []string `json:"auth_clients,omitempty"`
+	RevokedSubjects []string `json:"revoked_subjects,omitempty"`
+}
+
+// newReloader создаёт перечитывание настроек cfg
+func newReloader(cfg Config, chain []string, limiter *middleware.RateLimiter, subnets *middleware.SubnetFilter, engine *alerts.Engine, tracker *slo.Tracker, authenticator *auth.Chain, auditLog *audit.Log) *reloader {
+	r := &reloader{chain: chain, limiter: limiter, subnets: subnets, engine: engine, tracker: tracker, auth: authenticator, audit: auditLog}
+	r.current.Store(&cfg)
+	return r
+}
+
+// Reload перечитывает файл конфигурации и возвращает обновлённые разделы.
+// Если файл неверен, ни одна настройка не меняется.
+func (r *reloader) Reload() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cur := r.current.Load()
+	if cur.ConfigFile == "" {
+		return nil, errors.New("файл конфигурации не задан (-c или CONFIG)")
+	}
+	next := *cur
+	if err := loadConfigFile(cur.ConfigFile, &next); err != nil {
+		return nil, err
+	}
+	if r.engine == nil && next.Alerts != nil {
+		return nil, errors.New("оповещения были отключены при запуске: раздел alerts применится после перезапуска")
+	}
+	if (r.auth != nil) != next.Auth.Enabled() {
+		return nil, errors.New("проверка токенов включается и отключается только при запуске: раздел auth применится после перезапуска")
+	}
+	if next.Auth.MTLS != nil && next.TLSClientCA == "" {
+		return nil, errors.New("раздел auth.mtls требует удостоверяющих центров клиентов (-tls-client-ca)")
+	}
+	if err := checkTrustedSubnet(next, r.chain); err != nil {
+		return nil, err
+	}
+
+	var reloaded []string
+	if r.engine != nil {
+		var cfg alerts.Config
+		if next.Alerts != nil {
+			cfg = *next.Alerts
+		}
+		// Правила SLO задаются не разделом alerts, поэтому сохраняются
+		rules := append([]alerts.Rule(nil), cfg.Rules...)
+		if r.tracker != nil {
+			rules = append(rules, r.tracker.Rules()...)
+		}
+		if err := r.engine.Replace(cfg.Webhook, rules); err != nil {
+			return nil, err
+		}
+		reloaded = append(reloaded, "alerts")
+	}
+	l := next.limits()
+	r.limiter.SetLimits(l.Rate, l.Burst, l.By)
+	reloaded = append(reloaded, "rate_limit")
+	if err := r.subnets.SetSubnets(next.trustedSubnet()); err != nil {
+		return nil, err
+	}
+	reloaded = append(reloaded, "trusted_subnet")
+	if r.auth != nil {
+		if err := r.auth.Replace(next.Auth); err != nil {
+			return nil, err
+		}
+		reloaded = append(reloaded, "auth")
+	}
+
+	r.current.Store(&next)
+	return reloaded, nil
+}
+
+// Settings возвращает действующие перечитываемые настройки
+func (r *reloader) Settings() any {
+	cur := r.current.Load()
+	s := reloadSettings{RateLimit: cur.limits(), TrustedSubnet: cur.trustedSubnet()}
+	if cur.Alerts != nil {
+		s.Webhook = cur.Alerts.Webhook
+	}
+	if r.engine != nil {
+		s.Rules = r.engine.Definitions()
+	}
+	s.AuthClients = cur.Auth.Clients()
+	if cur.Auth.JWT != nil {
+		s.RevokedSubjects = cur.Auth.JWT.RevokedSubjects
+	}
+	return s
+}
+
+// watchSIGHUP перечитывает настройки по сигналу SIGHUP до отмены контекста
+func (r *reloader) watchSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			before := r.Settings()
+			reloaded, err := r.Reload()
+			if err != nil {
+				log.Printf("Настройки не перечитаны: %v", err)
+				continue
+			}
+			log.Printf("Настройки перечитаны: %v", reloaded)
+			if r.audit != nil {
+				e := audit.Entry{Time: time.Now(), Remote: audit.RemoteSIGHUP, Section: audit.SectionReload}
+				r.audit.RecordChange(e, before, r.Settings())
+			}
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+)
+
+// Итоги проверок самотестирования
+const (
+	checkOK   = "OK"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// Самотестирование
+const (
+	// probeGauge и probeCounter значения пробной метрики
+	probeGauge   = 42.5
+	probeCounter = 42
+	// certWarnBefore за сколько до истечения сертификата предупреждать
+	certWarnBefore = 30 * 24 * time.Hour
+	// minKeyLength длина ключа подписи, короче которой он считается слабым
+	minKeyLength = 16
+)
+
+// deleter хранилище, из которого можно удалить метрику
+type deleter interface {
+	DeleteGauge(ctx context.Context, name string) error
+	DeleteCounter(ctx context.Context, name string) error
+}
+
+// selfTest результаты самотестирования
+type selfTest struct {
+	w      io.Writer
+	failed int
+	warned int
+}
+
+// report выводит результат одной проверки
+func (t *selfTest) report(status, subject, format string, args ...any) {
+	switch status {
+	case checkFail:
+		t.failed++
+	case checkWarn:
+		t.warned++
+	}
+	fmt.Fprintf(t.w, "[%-4s] %s: %s\n", status, subject, fmt.Sprintf(format, args...))
+}
+
+// runSelfTest открывает настроенные хранилища, записывает, читает и удаляет
+// в них пробную метрику, проверяет права на запись снимков и файлов сервера
+// и ключи, выводит отчёт в w и возвращает код завершения: 0, если ни одна
+// проверка не провалилась. Сервер при этом не запускается, снимки хранилищ
+// не сохраняются.
+func runSelfTest(ctx context.Context, cfg Config, w io.Writer) int {
+	t := &selfTest{w: w}
+	fmt.Fprintln(w, "Самотестирование сервера метрик")
+
+	backendConfigs := map[string]backendConfig{"": defaultBackendConfig(cfg)}
+	for name, bc := range cfg.TenantBackends {
+		backendConfigs[name] = bc
+	}
+	names := make([]string, 0, len(backendConfigs))
+	for name := range backendConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stats := storage.NewWriteStats()
+	for _, name := range names {
+		subject := "общее хранилище"
+		if name != "" {
+			subject = "хранилище арендатора " + name
+		}
+		b, err := openBackend(ctx, name, backendConfigs[name], stats, nil)
+		if err != nil {
+			t.report(checkFail, subject, "не открывается: %v", err)
+			continue
+		}
+		for _, part := range b.flatten() {
+			t.checkBackend(part)
+		}
+		for _, part := range b.flatten() {
+			part.close()
+		}
+	}
+
+	t.checkWritable("журнал аудита", cfg.AuditFile)
+	if cfg.BackupDir != "" && cfg.AdminToken == "" {
+		t.report(checkFail, "каталог резервных копий", "задан без токена администратора")
+	} else if cfg.BackupDir != "" {
+		t.checkDir("каталог резервных копий", cfg.BackupDir)
+	}
+	t.checkTLS(cfg)
+	t.checkKeys(cfg)
+
+	fmt.Fprintf(w, "Итог: ошибок %d, предупреждений %d\n", t.failed, t.warned)
+	if t.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkBackend проверяет хранилище пробной метрикой и право на запись снимка.
+// Хранилище sharded проверяется по частям. В хранилище с журналом
+// обновлений пробная метрика пишется в обход журнала, иначе она
+// восстановилась бы из него при следующем запуске.
+func (t *selfTest) checkBackend(b *backend) {
+	if _, ok := b.store.(*storage.Sharded); ok {
+		t.report(checkOK, b.title, "открыто, частей %d", len(b.parts))
+		return
+	}
+	if storage.IsReadOnly(b.store) {
+		gauges, counters, err := b.store.GetAll(context.Background())
+		if err != nil {
+			t.report(checkFail, b.title, "чтение метрик: %v", err)
+			return
+		}
+		t.report(checkOK, b.title, "только чтение, метрик %d", len(gauges)+len(counters))
+		return
+	}
+	store := b.store
+	if b.wal != nil {
+		store = b.wal.Unwrap()
+		t.report(checkOK, b.title, "журнал обновлений открыт на запись")
+	}
+	if err := probe(context.Background(), store); err != nil {
+		t.report(checkFail, b.title, "пробная метрика: %v", err)
+	} else {
+		t.report(checkOK, b.title, "пробная метрика записана, прочитана и удалена")
+	}
+	if b.file.Path != "" {
+		t.checkSnapshot(b.title, b.file.Path)
+	}
+}
+
+// probe записывает, читает и удаляет пробные gauge и counter с именем,
+// которого нет в хранилище
+func probe(ctx context.Context, s storage.Storage) error {
+	del, ok := s.(deleter)
+	if !ok {
+		return errors.New("хранилище не поддерживает удаление метрик")
+	}
+	name := "__selftest_" + strconv.Itoa(os.Getpid()) + "_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := absent(ctx, s, name); err != nil {
+		return err
+	}
+
+	gaugeErr := s.UpdateGauge(ctx, name, probeGauge)
+	counterErr := s.UpdateCounter(ctx, name, probeCounter)
+	// Удаляем пробную метрику, даже если проверка провалилась
+	defer del.DeleteGauge(ctx, name)
+	defer del.DeleteCounter(ctx, name)
+	if gaugeErr != nil {
+		return fmt.Errorf("запись gauge: %w", gaugeErr)
+	}
+	if counterErr != nil {
+		return fmt.Errorf("запись counter: %w", counterErr)
+	}
+	if v, err := s.GetGauge(ctx, name); err != nil || v != probeGauge {
+		return fmt.Errorf("чтение gauge: ожидалось %v, получено %v (ошибка: %v)", probeGauge, v, err)
+	}
+	if v, err := s.GetCounter(ctx, name); err != nil || v != probeCounter {
+		return fmt.Errorf("чтение counter: ожидалось %d, получено %d (ошибка: %v)", probeCounter, v, err)
+	}
+
+	if err := del.DeleteGauge(ctx, name); err != nil {
+		return fmt.Errorf("удаление gauge: %w", err)
+	}
+	if err := del.DeleteCounter(ctx, name); err != nil {
+		return fmt.Errorf("удаление counter: %w", err)
+	}
+	if err := absent(ctx, s, name); err != nil {
+		return fmt.Errorf("после удаления: %w", err)
+	}
+	return nil
+}
+
+// absent проверяет, что в хранилище нет ни gauge, ни counter с именем name
+func absent(ctx context.Context, s storage.Storage, name string) error {
+	if _, err := s.GetGauge(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		if err != nil {
+			return fmt.Errorf("чтение gauge: %w", err)
+		}
+		return fmt.Errorf("gauge %s есть в хранилище", name)
+	}
+	if _, err := s.GetCounter(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		if err != nil {
+			return fmt.Errorf("чтение counter: %w", err)
+		}
+		return fmt.Errorf("counter %s есть в хранилище", name)
+	}
+	return nil
+}
+
+// checkSnapshot проверяет, что снимок path можно сохранить так же, как это
+// делает сервер: через временный файл в том же каталоге
+func (t *selfTest) checkSnapshot(subject, path string) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		t.report(checkFail, subject, "снимок %s не сохранить: %v", path, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString("selftest\n")
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.report(checkFail, subject, "снимок %s не сохранить: %v", path, err)
+		return
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		t.report(checkFail, subject, "путь снимка %s — каталог", path)
+		return
+	}
+	t.report(checkOK, subject, "снимок %s доступен для записи", path)
+}
+
+// checkWritable проверяет, что файл path можно открыть на дозапись.
+// Пустой путь — файл не используется.
+func (t *selfTest) checkWritable(subject, path string) {
+	if path == "" {
+		return
+	}
+	_, statErr := os.Stat(path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.report(checkFail, subject, "%s недоступен для записи: %v", path, err)
+		return
+	}
+	f.Close()
+	// Файл, созданный проверкой, не оставляем
+	if errors.Is(statErr, os.ErrNotExist) {
+		os.Remove(path)
+	}
+	t.report(checkOK, subject, "%s доступен для записи", path)
+}
+
+// checkDir проверяет, что в каталоге dir можно создавать файлы
+func (t *selfTest) checkDir(subject, dir string) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.report(checkFail, subject, "каталог %s не создать: %v", dir, err)
+		return
+	}
+	f, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		t.report(checkFail, subject, "%s недоступен для записи: %v", dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+	t.report(checkOK, subject, "%s доступен для записи", dir)
+}
+
+// checkTLS проверяет сертификат и ключ TLS, не выпуская новых
+func (t *selfTest) checkTLS(cfg Config) {
+	const subject = "сертификат TLS"
+	if !cfg.EnableHTTPS {
+		return
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		t.report(checkFail, subject, "файлы сертификата и ключа задаются вместе")
+		return
+	}
+	if cfg.TLSCert == "" {
+		t.report(checkOK, subject, "будет выпущен самоподписанный сертификат в памяти")
+		return
+	}
+	_, certErr := os.Stat(cfg.TLSCert)
+	_, keyErr := os.Stat(cfg.TLSKey)
+	if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+		t.checkWritable(subject, cfg.TLSCert)
+		t.checkWritable("ключ TLS", cfg.TLSKey)
+		t.report(checkWarn, subject, "файлов нет: при запуске будет выпущен самоподписанный сертификат")
+		return
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		t.report(checkFail, subject, "не загружается: %v", err)
+		return
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.report(checkFail, subject, "не разбирается: %v", err)
+		return
+	}
+	now := time.Now()
+	switch {
+	case now.After(leaf.NotAfter):
+		t.report(checkFail, subject, "истёк %s", leaf.NotAfter.Format(time.DateOnly))
+	case now.Before(leaf.NotBefore):
+		t.report(checkFail, subject, "действует только с %s", leaf.NotBefore.Format(time.DateOnly))
+	case leaf.NotAfter.Sub(now) < certWarnBefore:
+		t.report(checkWarn, subject, "истекает %s", leaf.NotAfter.Format(time.DateOnly))
+	default:
+		t.report(checkOK, subject, "%s, ключ подходит, действует до %s", cfg.TLSCert, leaf.NotAfter.Format(time.DateOnly))
+	}
+}
+
+// checkKeys проверяет ключ подписи, токены и ключи арендаторов
+func (t *selfTest) checkKeys(cfg Config) {
+	switch {
+	case cfg.Key == "":
+		t.report(checkWarn, "ключ подписи", "не задан: запросы и ответы не подписываются")
+	case len(cfg.Key) < minKeyLength:
+		t.report(checkWarn, "ключ подписи", "короче %d символов", minKeyLength)
+	default:
+		t.report(checkOK, "ключ подписи", "задан")
+	}
+	if cfg.AdminToken == "" {
+		t.report(checkWarn, "токен администратора", "не задан: административное API /admin/ отключено")
+	} else {
+		t.report(checkOK, "токен администратора", "задан")
+	}
+	if cfg.ReplicaOf != "" && cfg.ReplicaToken == "" {
+		t.report(checkWarn, "токен реплики", "не задан: основной сервер может отклонить подписку")
+	}
+	if cfg.Tenants != nil {
+		if _, err := tenant.NewRegistry(*cfg.Tenants); err != nil {
+			t.report(checkFail, "ключи арендаторов", "%v", err)
+		} else if cfg.AdminToken == "" {
+			t.report(checkFail, "ключи арендаторов", "заданы без токена администратора")
+		} else {
+			t.report(checkOK, "ключи арендаторов", "разобраны")
+		}
+	}
+}
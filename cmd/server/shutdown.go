@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// Судьба метрик хранилища при остановке
+const (
+	// persistSaved последний снимок сохранён при остановке
+	persistSaved = "saved"
+	// persistJournaled снимок не сохранён, но обновления есть в журнале
+	persistJournaled = "journaled"
+	// persistExternal метрики хранятся вне процесса (Redis, PostgreSQL)
+	persistExternal = "external"
+	// persistReadOnly хранилище только для чтения не меняется
+	persistReadOnly = "read_only"
+	// persistLost метрики, не попавшие в снимок, потеряны
+	persistLost = "lost"
+)
+
+// shutdownBackend сведения об одном хранилище в отчёте об остановке
+type shutdownBackend struct {
+	Name     string `json:"name"`
+	Snapshot string `json:"snapshot,omitempty"`
+	// LastSnapshot время последнего снимка до остановки
+	LastSnapshot *time.Time `json:"last_snapshot,omitempty"`
+	// PendingUpdates обновления, принятые сервером после последнего снимка
+	PendingUpdates int64 `json:"pending_updates"`
+	// Persistence судьба метрик: saved, journaled, external, read_only или lost
+	Persistence string `json:"persistence"`
+	Error       string `json:"error,omitempty"`
+}
+
+// shutdownReport машиночитаемый отчёт об остановке сервера: по нему после
+// перезапуска видно, могли ли пропасть данные
+type shutdownReport struct {
+	Event         string    `json:"event"`
+	StartedAt     time.Time `json:"started_at"`
+	StoppedAt     time.Time `json:"stopped_at"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+	// Updates обновления метрик, принятые за время работы
+	Updates  int64             `json:"updates"`
+	Backends []shutdownBackend `json:"backends"`
+	// DataLost часть принятых обновлений не сохранена
+	DataLost bool `json:"data_lost"`
+}
+
+// newShutdownReport начинает отчёт об остановке сервера, запущенного в started
+func newShutdownReport(started time.Time, stats *storage.WriteStats) *shutdownReport {
+	now := time.Now()
+	return &shutdownReport{
+		Event:         "shutdown",
+		StartedAt:     started,
+		StoppedAt:     now,
+		UptimeSeconds: now.Sub(started).Seconds(),
+		Updates:       stats.Updates(),
+		Backends:      []shutdownBackend{},
+	}
+}
+
+// flush сохраняет последний снимок хранилища b и добавляет его в отчёт.
+// Хранилище sharded сохраняется по частям, поэтому в отчёт не попадает.
+func (r *shutdownReport) flush(b *backend, stats *storage.WriteStats) {
+	lastSaved, savedUpdates := b.lastSave()
+	// Контекст сервера к этому времени отменён, а снимок нужно дописать
+	err := b.save(context.Background(), stats)
+
+	entry := shutdownBackend{Name: b.title, Snapshot: b.file.Path}
+	if !lastSaved.IsZero() {
+		entry.LastSnapshot = &lastSaved
+	}
+	switch b.store.(type) {
+	case *storage.Sharded:
+		return
+	case *storage.RedisStorage, *storage.PostgresStorage:
+		entry.Persistence = persistExternal
+	case *storage.MmapStorage:
+		entry.Persistence = persistReadOnly
+	default:
+		entry.PendingUpdates = r.Updates - savedUpdates
+		switch {
+		case b.file.Path == "":
+			entry.Persistence = persistLost
+		case err == nil:
+			entry.Persistence = persistSaved
+		case b.wal != nil:
+			entry.Persistence = persistJournaled
+		default:
+			entry.Persistence = persistLost
+		}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	// Хранилище только в памяти ничего не теряет, если обновлений не было
+	if entry.Persistence == persistLost && entry.PendingUpdates > 0 {
+		r.DataLost = true
+	}
+	r.Backends = append(r.Backends, entry)
+}
+
+// write записывает отчёт в журнал и, если задан путь, в файл path
+func (r *shutdownReport) write(path string) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("Не удалось составить отчёт об остановке: %v", err)
+		return
+	}
+	log.Printf("Отчёт об остановке: %s", data)
+	if path == "" {
+		return
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		log.Printf("Не удалось записать отчёт об остановке в %s: %v", path, err)
+	}
+}
@@ -0,0 +1,513 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/commands"
+	"github.com/iliodor1/metrics-service/internal/hashring"
+	"github.com/iliodor1/metrics-service/internal/sign"
+	"github.com/iliodor1/metrics-service/pkg/client"
+)
+
+// Config настройки агента
+type Config struct {
+	// Address адрес сервера метрик: host:port, URL (https://host:port)
+	// или сокет Unix (unix:/путь)
+	Address string
+	// TLS проверка сертификата сервера при HTTPS (nil — системные сертификаты)
+	TLS *tls.Config
+	// PollInterval частота опроса метрик
+	PollInterval time.Duration
+	// ReportInterval частота отправки метрик на сервер
+	ReportInterval time.Duration
+	// RateLimit максимальное число одновременно исходящих запросов
+	RateLimit int
+	// Key ключ подписи запросов HMAC (пустой — без подписи)
+	Key string
+	// SignHash алгоритм подписи (nil — sha256); если сервер его не
+	// принимает, агент переходит на предложенный сервером
+	SignHash *sign.Algorithm
+	// Token токен доступа с правом metrics:write (пустой — без токена)
+	Token string
+	// QueueSize наибольшее число неотправленных пакетов метрик на сервер
+	QueueSize int
+	// SpoolDir каталог, в который записываются пакеты, не отправленные
+	// и после повторов, и неотправленные при остановке; они отправляются
+	// по порядку, когда сервер снова доступен (пустой — пакеты хранятся
+	// только в очереди в памяти)
+	SpoolDir string
+	// SpoolMaxSize наибольший размер пакетов в SpoolDir на сервер в байтах
+	// (0 — без ограничения)
+	SpoolMaxSize int64
+	// ID идентификатор агента, по которому сервер адресует ему команды
+	ID string
+	// CommandInterval частота запроса команд у сервера (0 — не запрашивать)
+	CommandInterval time.Duration
+	// Version версия агента
+	Version string
+	// UpdateURL адрес, по которому проверяется наличие новой версии (пустой — не проверять)
+	UpdateURL string
+	// UpdateInterval частота проверки новой версии
+	UpdateInterval time.Duration
+	// RestartCommand команда, запускаемая при обнаружении новой версии
+	RestartCommand string
+	// Shards серверы, между которыми метрики делятся по хешу имени так же,
+	// как в хранилище sharded сервера (пусто — все метрики на Address).
+	// Команды и обновления по-прежнему запрашиваются у Address.
+	Shards []Shard
+	// Mirrors адреса серверов, получающих копию всех метрик, например
+	// резервной площадки. У каждого своя очередь и свои повторы, поэтому
+	// недоступное зеркало не задерживает отправку на основные серверы.
+	Mirrors []string
+}
+
+// Shard сервер, получающий часть метрик агента
+type Shard struct {
+	// Name постоянное имя части, определяющее её положение на кольце хешей
+	Name string
+	// Address адрес сервера части
+	Address string
+}
+
+// Agent периодически собирает метрики и отправляет их на сервер
+// пакетами через ограниченные очереди
+type Agent struct {
+	cfg       Config
+	collector *Collector
+	sender    *Sender
+	// shards отправители частей и ring их кольцо хешей, если метрики делятся
+	shards []*Sender
+	ring   *hashring.Ring
+	// mirrors отправители на зеркала
+	mirrors []*Sender
+	// queues очереди пакетов к каждому из серверов targets()
+	queues []*queue
+	// spools каталоги неотправленных пакетов к серверам targets()
+	// (nil — каталог не задан)
+	spools []*spool
+}
+
+// New создаёт нового агента
+func New(cfg Config) (*Agent, error) {
+	if cfg.RateLimit < 1 {
+		cfg.RateLimit = 1
+	}
+	if cfg.UpdateInterval <= 0 {
+		cfg.UpdateInterval = time.Hour
+	}
+	if cfg.QueueSize < 1 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	a := &Agent{
+		cfg:       cfg,
+		collector: NewCollector(),
+		sender:    NewSender(cfg.Address, cfg.TLS, cfg.Key, cfg.SignHash, cfg.Token),
+	}
+	if len(cfg.Shards) > 0 {
+		names := make([]string, 0, len(cfg.Shards))
+		for _, shard := range cfg.Shards {
+			names = append(names, shard.Name)
+			a.shards = append(a.shards, NewSender(shard.Address, cfg.TLS, cfg.Key, cfg.SignHash, cfg.Token))
+		}
+		ring, err := hashring.New(names)
+		if err != nil {
+			return nil, err
+		}
+		a.ring = ring
+	}
+	for _, addr := range cfg.Mirrors {
+		a.mirrors = append(a.mirrors, NewSender(addr, cfg.TLS, cfg.Key, cfg.SignHash, cfg.Token))
+	}
+	for _, target := range a.targets() {
+		a.queues = append(a.queues, newQueue(cfg.QueueSize))
+		if cfg.SpoolDir == "" {
+			continue
+		}
+		sp, err := newSpool(filepath.Join(cfg.SpoolDir, spoolDir(target.baseURL)), cfg.SpoolMaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("каталог неотправленных пакетов: %w", err)
+		}
+		a.spools = append(a.spools, sp)
+	}
+	return a, nil
+}
+
+// defaultQueueSize число неотправленных пакетов на сервер по умолчанию
+const defaultQueueSize = 10
+
+// targets возвращает отправителей на серверы, получающие метрики:
+// сначала основные, затем зеркала
+func (a *Agent) targets() []*Sender {
+	primary := []*Sender{a.sender}
+	if a.ring != nil {
+		primary = a.shards
+	}
+	return append(primary[:len(primary):len(primary)], a.mirrors...)
+}
+
+// primaries возвращает число основных серверов в начале targets()
+func (a *Agent) primaries() int {
+	if a.ring == nil {
+		return 1
+	}
+	return len(a.shards)
+}
+
+// targetFor возвращает номер основного сервера для метрики name
+func (a *Agent) targetFor(name string) int {
+	if a.ring == nil {
+		return 0
+	}
+	return a.ring.Part(name)
+}
+
+// shutdownTimeout наибольшее время отправки последних метрик при остановке
+const shutdownTimeout = 15 * time.Second
+
+// Run запускает опрос и отправку метрик и блокируется до отмены контекста.
+// После отмены агент отправляет собранные, но ещё не отправленные метрики,
+// дожидается запросов к серверу и только затем возвращает управление.
+func (a *Agent) Run(ctx context.Context) {
+	// Запросы к серверу не прерываются отменой ctx: при остановке агент
+	// дожидается их, но не дольше shutdownTimeout
+	sendCtx, cancelSend := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelSend()
+	stop := make(chan struct{})
+
+	// Пакеты каждому серверу отправляются по очереди, а всего
+	// одновременно выполняется не более RateLimit запросов к основным
+	// серверам и не более RateLimit к зеркалам
+	var senders sync.WaitGroup
+	slots := make(chan struct{}, a.cfg.RateLimit)
+	mirrorSlots := make(chan struct{}, a.cfg.RateLimit)
+	for i, target := range a.targets() {
+		s := slots
+		if i >= a.primaries() {
+			s = mirrorSlots
+		}
+		sp := a.spool(i)
+		if sp != nil && sp.len() > 0 {
+			// Пакеты, оставшиеся с прошлого запуска, отправляются сразу
+			log.Printf("Неотправленных пакетов на %s: %d", target.baseURL, sp.len())
+			a.queues[i].signal()
+		}
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			a.deliver(sendCtx, target, a.queues[i], sp, s, stop)
+		}()
+	}
+
+	var wg sync.WaitGroup
+
+	// Системные метрики собираются в отдельной горутине
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.pollSystem(ctx)
+	}()
+
+	// Проверка обновлений агента
+	if a.cfg.UpdateURL != "" {
+		checker := NewUpgradeChecker(a.cfg.UpdateURL, a.cfg.Version, a.cfg.RestartCommand, a.collector)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checker.Run(ctx, a.cfg.UpdateInterval)
+		}()
+	}
+
+	// Команды от сервера запрашиваются в отдельной горутине
+	cmds := make(chan commands.Command)
+	if a.cfg.CommandInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.pollCommands(ctx, cmds)
+		}()
+	}
+
+	pollTicker := time.NewTicker(a.cfg.PollInterval)
+	defer pollTicker.Stop()
+	reportTicker := time.NewTicker(a.cfg.ReportInterval)
+	defer reportTicker.Stop()
+
+	a.collector.Poll()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			a.shutdown(stop, cancelSend, &senders)
+			return
+		case <-pollTicker.C:
+			a.collector.Poll()
+		case <-reportTicker.C:
+			a.report()
+		case cmd := <-cmds:
+			a.execute(cmd, reportTicker)
+		}
+	}
+}
+
+// execute выполняет команду, полученную от сервера
+func (a *Agent) execute(cmd commands.Command, reportTicker *time.Ticker) {
+	log.Printf("Получена команда %s", cmd.Type)
+	if err := cmd.Validate(); err != nil {
+		log.Printf("Неверная команда: %v", err)
+		return
+	}
+
+	switch cmd.Type {
+	case commands.SetReportInterval:
+		interval, _ := time.ParseDuration(cmd.Interval)
+		a.cfg.ReportInterval = interval
+		reportTicker.Reset(interval)
+	case commands.FullSync:
+		a.collector.Poll()
+		if err := a.collector.PollSystem(); err != nil {
+			log.Printf("Ошибка сбора системных метрик: %v", err)
+		}
+		a.report()
+	case commands.Collect:
+		switch cmd.Collector {
+		case commands.CollectorRuntime:
+			a.collector.Poll()
+		case commands.CollectorSystem:
+			if err := a.collector.PollSystem(); err != nil {
+				log.Printf("Ошибка сбора системных метрик: %v", err)
+			}
+		default:
+			log.Printf("Неизвестный сборщик %q", cmd.Collector)
+		}
+	default:
+		log.Printf("Неизвестная команда %q", cmd.Type)
+	}
+}
+
+// pollCommands периодически запрашивает команды у сервера до отмены контекста
+func (a *Agent) pollCommands(ctx context.Context, out chan<- commands.Command) {
+	ticker := time.NewTicker(a.cfg.CommandInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cmds, err := a.sender.FetchCommands(a.cfg.ID)
+		if err != nil {
+			log.Printf("Ошибка получения команд: %v", err)
+			continue
+		}
+		for _, cmd := range cmds {
+			select {
+			case out <- cmd:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// pollSystem периодически опрашивает системные метрики до отмены контекста
+func (a *Agent) pollSystem(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.collector.PollSystem(); err != nil {
+			log.Printf("Ошибка сбора системных метрик: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// report раскладывает накопленные метрики по очередям основных серверов
+// и кладёт их копию в очередь каждого зеркала
+func (a *Agent) report() {
+	batches := make([][]Metric, len(a.queues))
+	snapshot := a.collector.Snapshot()
+	for _, m := range snapshot {
+		i := a.targetFor(m.Name)
+		batches[i] = append(batches[i], m)
+	}
+	for i := a.primaries(); i < len(batches); i++ {
+		batches[i] = snapshot
+	}
+	for i, batch := range batches {
+		if len(batch) > 0 {
+			a.queues[i].push(batch)
+		}
+	}
+}
+
+// shutdown отправляет последние собранные метрики и дожидается отправителей
+func (a *Agent) shutdown(stop chan struct{}, cancelSend context.CancelFunc, senders *sync.WaitGroup) {
+	a.report()
+	close(stop)
+
+	done := make(chan struct{})
+	go func() {
+		senders.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		cancelSend()
+		<-done
+	}
+
+	unsent, spooled := 0, 0
+	for i, q := range a.queues {
+		if sp := a.spool(i); sp != nil {
+			a.spoolQueue(q, sp)
+			spooled += sp.len()
+		}
+		unsent += q.len()
+	}
+	if spooled > 0 {
+		log.Printf("Неотправленные пакеты метрик сохранены в %s: %d", a.cfg.SpoolDir, spooled)
+	}
+	if unsent > 0 {
+		log.Printf("При остановке не отправлено пакетов метрик: %d", unsent)
+		return
+	}
+	if spooled == 0 {
+		log.Println("Последние метрики отправлены")
+	}
+}
+
+// spool возвращает каталог неотправленных пакетов к серверу i (nil — не задан)
+func (a *Agent) spool(i int) *spool {
+	if a.spools == nil {
+		return nil
+	}
+	return a.spools[i]
+}
+
+// spoolQueue переносит пакеты из очереди в каталог: они новее пакетов
+// каталога и должны отправляться после них. Если записать пакет
+// не удалось, он и остальные остаются в очереди.
+func (a *Agent) spoolQueue(q *queue, sp *spool) {
+	for {
+		b, ok := q.pop()
+		if !ok {
+			return
+		}
+		if err := sp.put(b.Key, b.Metrics, b.Pending); err != nil {
+			log.Printf("Не удалось сохранить неотправленный пакет: %v", err)
+			q.requeue(b)
+			return
+		}
+	}
+}
+
+// deliver отправляет пакеты из очереди q на сервер target, пока не закрыт
+// stop, а затем отправляет оставшиеся в очереди пакеты. Пакет, который
+// не удалось отправить и после повторов, записывается в каталог sp вместе
+// с остальной очередью, а без каталога возвращается в очередь и уходит
+// со следующим отчётом.
+func (a *Agent) deliver(ctx context.Context, target *Sender, q *queue, sp *spool, slots chan struct{}, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			a.drain(ctx, target, q, sp, slots)
+			return
+		case <-q.ready:
+			if a.drain(ctx, target, q, sp, slots) {
+				continue
+			}
+			// Пакет, не отправленный и после повторов, при остановке
+			// повторно не отправляется
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// drain отправляет сначала пакеты из каталога sp, затем из очереди, пока
+// они не закончатся или отправка не завершится ошибкой; false — отправка
+// завершилась ошибкой
+func (a *Agent) drain(ctx context.Context, target *Sender, q *queue, sp *spool, slots chan struct{}) bool {
+	for sp != nil {
+		name, b, ok := sp.oldest()
+		if !ok {
+			break
+		}
+		if err := sp.sending(name, b); err != nil {
+			log.Printf("Не удалось отметить пакет отправляемым: %v", err)
+			return false
+		}
+		err := a.send(ctx, target, slots, b.Key, b.Metrics)
+		if err != nil && !rejected(err) {
+			a.spoolQueue(q, sp)
+			return false
+		}
+		sp.remove(name)
+	}
+	for {
+		b, ok := q.pop()
+		if !ok {
+			return true
+		}
+		b.Pending = false
+		err := a.send(ctx, target, slots, b.Key, b.Metrics)
+		if err == nil {
+			continue
+		}
+		if rejected(err) {
+			return false
+		}
+		if sp == nil {
+			q.requeue(b)
+			return false
+		}
+		if err := sp.put(b.Key, b.Metrics, false); err != nil {
+			log.Printf("Не удалось сохранить неотправленный пакет: %v", err)
+			q.requeue(b)
+			return false
+		}
+		a.spoolQueue(q, sp)
+		return false
+	}
+}
+
+// send отправляет пакет с ключом идемпотентности key, занимая место
+// среди одновременных запросов
+func (a *Agent) send(ctx context.Context, target *Sender, slots chan struct{}, key string, batch []Metric) error {
+	slots <- struct{}{}
+	err := target.SendBatch(client.WithIdempotencyKey(ctx, key), batch)
+	<-slots
+	if err != nil {
+		log.Printf("Ошибка отправки метрик на %s: %v", target.baseURL, err)
+	}
+	return err
+}
+
+// rejected сообщает, что сервер отверг пакет и повторять его бесполезно
+func rejected(err error) bool {
+	var se *client.StatusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	return se.StatusCode >= 400 && se.StatusCode < 500 &&
+		se.StatusCode != http.StatusConflict && se.StatusCode != http.StatusTooManyRequests
+}
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// Типы метрик
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+)
+
+// Metric метрика, подготовленная к отправке на сервер
+type Metric struct {
+	Type  string
+	Name  string
+	Value float64
+	Delta int64
+}
+
+// Collector собирает метрики рантайма и хранит последние значения
+type Collector struct {
+	mu       sync.Mutex
+	gauges   map[string]float64
+	counters map[string]int64
+}
+
+// NewCollector создаёт новый сборщик метрик
+func NewCollector() *Collector {
+	return &Collector{
+		gauges:   make(map[string]float64),
+		counters: make(map[string]int64),
+	}
+}
+
+// Poll считывает текущие метрики рантайма
+func (c *Collector) Poll() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gauges["Alloc"] = float64(ms.Alloc)
+	c.gauges["BuckHashSys"] = float64(ms.BuckHashSys)
+	c.gauges["Frees"] = float64(ms.Frees)
+	c.gauges["GCCPUFraction"] = ms.GCCPUFraction
+	c.gauges["GCSys"] = float64(ms.GCSys)
+	c.gauges["HeapAlloc"] = float64(ms.HeapAlloc)
+	c.gauges["HeapIdle"] = float64(ms.HeapIdle)
+	c.gauges["HeapInuse"] = float64(ms.HeapInuse)
+	c.gauges["HeapObjects"] = float64(ms.HeapObjects)
+	c.gauges["HeapReleased"] = float64(ms.HeapReleased)
+	c.gauges["HeapSys"] = float64(ms.HeapSys)
+	c.gauges["LastGC"] = float64(ms.LastGC)
+	c.gauges["Lookups"] = float64(ms.Lookups)
+	c.gauges["MCacheInuse"] = float64(ms.MCacheInuse)
+	c.gauges["MCacheSys"] = float64(ms.MCacheSys)
+	c.gauges["MSpanInuse"] = float64(ms.MSpanInuse)
+	c.gauges["MSpanSys"] = float64(ms.MSpanSys)
+	c.gauges["Mallocs"] = float64(ms.Mallocs)
+	c.gauges["NextGC"] = float64(ms.NextGC)
+	c.gauges["NumForcedGC"] = float64(ms.NumForcedGC)
+	c.gauges["NumGC"] = float64(ms.NumGC)
+	c.gauges["OtherSys"] = float64(ms.OtherSys)
+	c.gauges["PauseTotalNs"] = float64(ms.PauseTotalNs)
+	c.gauges["StackInuse"] = float64(ms.StackInuse)
+	c.gauges["StackSys"] = float64(ms.StackSys)
+	c.gauges["Sys"] = float64(ms.Sys)
+	c.gauges["TotalAlloc"] = float64(ms.TotalAlloc)
+	c.gauges["RandomValue"] = rand.Float64()
+
+	c.counters["PollCount"]++
+}
+
+// PollSystem считывает метрики системы: объём памяти и загрузку каждого ядра.
+// Системные вызовы могут быть медленными, поэтому метод вызывается
+// в отдельной горутине и не блокирует опрос метрик рантайма.
+func (c *Collector) PollSystem() error {
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return fmt.Errorf("чтение памяти: %w", err)
+	}
+	// Загрузка ядер с момента предыдущего вызова
+	percents, err := cpu.Percent(0, true)
+	if err != nil {
+		return fmt.Errorf("чтение загрузки процессора: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gauges["TotalMemory"] = float64(vm.Total)
+	c.gauges["FreeMemory"] = float64(vm.Free)
+	for i, p := range percents {
+		c.gauges[fmt.Sprintf("CPUutilization%d", i+1)] = p
+	}
+	return nil
+}
+
+// SetGauge устанавливает значение метрики типа gauge
+func (c *Collector) SetGauge(name string, value float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gauges[name] = value
+}
+
+// Snapshot возвращает накопленные метрики для отправки.
+// Счётчики передаются как приращение с момента предыдущего снимка и обнуляются.
+func (c *Collector) Snapshot() []Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics := make([]Metric, 0, len(c.gauges)+len(c.counters))
+	for name, value := range c.gauges {
+		metrics = append(metrics, Metric{Type: Gauge, Name: name, Value: value})
+	}
+	for name, delta := range c.counters {
+		metrics = append(metrics, Metric{Type: Counter, Name: name, Delta: delta})
+		delete(c.counters, name)
+	}
+	return metrics
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"log"
+	"slices"
+	"sync"
+
+	"github.com/iliodor1/metrics-service/pkg/client"
+)
+
+// queue очередь пакетов метрик к одному серверу. Ключ идемпотентности
+// пакет получает при добавлении и сохраняет при повторных отправках.
+// Если сервер недоступен и пакетов больше max, два самых старых соседних
+// пакета, которые ещё не отправлялись, объединяются в один: gauge берутся
+// из нового пакета, приращения counter складываются. Так память агента
+// ограничена, а приращения counter не теряются. Отправленный пакет мог
+// быть применён сервером под своим ключом, поэтому он не объединяется
+// с другими; если объединять нечего, удаляется самый старый пакет.
+type queue struct {
+	mu    sync.Mutex
+	items []spooled
+	max   int
+	// ready сигнализирует, что в очереди появились пакеты
+	ready chan struct{}
+}
+
+// newQueue создаёт очередь не более чем из max пакетов
+func newQueue(max int) *queue {
+	if max < 1 {
+		max = 1
+	}
+	return &queue{max: max, ready: make(chan struct{}, 1)}
+}
+
+// push добавляет пакет в конец очереди с новым ключом идемпотентности
+func (q *queue) push(batch []Metric) {
+	q.mu.Lock()
+	q.items = append(q.items, spooled{Key: client.NewIdempotencyKey(), Metrics: batch, Pending: true})
+	q.shrink()
+	q.mu.Unlock()
+	q.signal()
+}
+
+// requeue возвращает неотправленный пакет в начало очереди с прежним
+// ключом. Очередь не сигнализирует: пакет будет отправлен вместе
+// со следующими.
+func (q *queue) requeue(b spooled) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append([]spooled{b}, q.items...)
+	q.shrink()
+}
+
+// pop извлекает пакет из начала очереди
+func (q *queue) pop() (spooled, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return spooled{}, false
+	}
+	b := q.items[0]
+	q.items[0] = spooled{}
+	q.items = q.items[1:]
+	return b, true
+}
+
+// len возвращает число пакетов в очереди
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// shrink объединяет самые старые соседние неотправленные пакеты, пока
+// их больше max; объединённый пакет сохраняет ключ более нового. Если
+// таких пакетов нет, удаляет самый старый. Вызывается под блокировкой.
+func (q *queue) shrink() {
+	for len(q.items) > q.max {
+		i := q.mergeable()
+		if i < 0 {
+			log.Printf("Пакет метрик не помещается в очередь и удалён: %d метрик", len(q.items[0].Metrics))
+			i = 0
+		} else {
+			q.items[i+1].Metrics = merge(q.items[i].Metrics, q.items[i+1].Metrics)
+		}
+		q.items = slices.Delete(q.items, i, i+1)
+	}
+}
+
+// mergeable возвращает индекс первого из двух соседних неотправленных
+// пакетов; -1 — таких нет
+func (q *queue) mergeable() int {
+	for i := 0; i+1 < len(q.items); i++ {
+		if q.items[i].Pending && q.items[i+1].Pending {
+			return i
+		}
+	}
+	return -1
+}
+
+// signal сообщает отправителю о новых пакетах
+func (q *queue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// merge объединяет пакет older с более новым пакетом newer
+func merge(older, newer []Metric) []Metric {
+	type key struct{ typ, name string }
+	index := make(map[key]int, len(newer))
+	merged := append([]Metric(nil), newer...)
+	for i, m := range merged {
+		index[key{m.Type, m.Name}] = i
+	}
+	for _, m := range older {
+		i, ok := index[key{m.Type, m.Name}]
+		switch {
+		case !ok:
+			index[key{m.Type, m.Name}] = len(merged)
+			merged = append(merged, m)
+		case m.Type == Counter:
+			merged[i].Delta += m.Delta
+		}
+	}
+	return merged
+}
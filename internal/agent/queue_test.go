@@ -0,0 +1,83 @@
+package agent
+
+import "testing"
+
+func TestQueueShrink(t *testing.T) {
+	type want struct {
+		key     string
+		delta   int64
+		pending bool
+	}
+	tests := []struct {
+		name    string
+		pending []bool
+		want    []want
+	}{
+		{
+			name:    "неотправленные объединяются",
+			pending: []bool{true, true, true},
+			want:    []want{{"k2", 2, true}, {"k3", 1, true}},
+		},
+		{
+			name:    "отправленный не объединяется",
+			pending: []bool{false, true, true},
+			want:    []want{{"k1", 1, false}, {"k3", 2, true}},
+		},
+		{
+			name:    "соседние только отправленные",
+			pending: []bool{false, false, false},
+			want:    []want{{"k2", 1, false}, {"k3", 1, false}},
+		},
+		{
+			name:    "неотправленные не соседи",
+			pending: []bool{true, false, true},
+			want:    []want{{"k2", 1, false}, {"k3", 1, true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newQueue(len(tt.pending) - 1)
+			for i, pending := range tt.pending {
+				q.items = append(q.items, spooled{
+					Key:     "k" + string(rune('1'+i)),
+					Metrics: []Metric{{Type: Counter, Name: "hits", Delta: 1}},
+					Pending: pending,
+				})
+			}
+			q.shrink()
+
+			if len(q.items) != len(tt.want) {
+				t.Fatalf("пакетов %d, ожидалось %d", len(q.items), len(tt.want))
+			}
+			for i, w := range tt.want {
+				b := q.items[i]
+				if b.Key != w.key || b.Pending != w.pending || len(b.Metrics) != 1 || b.Metrics[0].Delta != w.delta {
+					t.Errorf("пакет %d = %+v, ожидался %+v", i, b, w)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueRequeue(t *testing.T) {
+	q := newQueue(2)
+	q.push([]Metric{{Type: Counter, Name: "hits", Delta: 1}})
+	sent, _ := q.pop()
+	sent.Pending = false
+	q.push([]Metric{{Type: Counter, Name: "hits", Delta: 2}})
+	q.requeue(sent)
+	q.push([]Metric{{Type: Counter, Name: "hits", Delta: 3}})
+
+	// Отправленный пакет повторяется с прежним ключом и без новых приращений
+	b, _ := q.pop()
+	if b.Key != sent.Key || b.Metrics[0].Delta != 1 {
+		t.Errorf("первый пакет = %+v, ожидался %+v", b, sent)
+	}
+	b, _ = q.pop()
+	if b.Key == sent.Key || !b.Pending || b.Metrics[0].Delta != 5 {
+		t.Errorf("второй пакет = %+v, ожидалось объединение с приращением 5", b)
+	}
+	if _, ok := q.pop(); ok {
+		t.Error("очередь не пуста")
+	}
+}
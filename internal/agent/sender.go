@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/commands"
+	"github.com/iliodor1/metrics-service/internal/netaddr"
+	"github.com/iliodor1/metrics-service/internal/sign"
+	"github.com/iliodor1/metrics-service/pkg/client"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Sender отправляет метрики на сервер
+type Sender struct {
+	client  *http.Client
+	baseURL string
+	// api отправляет пакеты метрик: сжимает, подписывает и повторяет запросы
+	api *client.Client
+}
+
+// NewSender создаёт отправителя для сервера по адресу addr (host:port,
+// URL, например https://metrics:8443, или unix:/путь/к/сокету).
+// tlsConfig задаёт проверку сертификата сервера при HTTPS; nil — настройки
+// по умолчанию. key — ключ подписи запросов (пустой — без подписи),
+// hash — алгоритм подписи (nil — sha256), token — токен доступа (пустой —
+// без токена).
+func NewSender(addr string, tlsConfig *tls.Config, key string, hash *sign.Algorithm, token string) *Sender {
+	baseURL, transport := netaddr.Client(addr, tlsConfig)
+	hc := &http.Client{Timeout: 5 * time.Second, Transport: transport}
+	return &Sender{
+		client:  hc,
+		baseURL: baseURL,
+		api:     client.New(addr, client.WithHTTPClient(hc), client.WithKey(key), client.WithSignHash(hash), client.WithBearerToken(token)),
+	}
+}
+
+// SendBatch отправляет метрики одним запросом POST /updates/ со сжатием
+// gzip и подписью. При ошибках соединения запрос повторяется через 1, 3
+// и 5 секунд.
+func (s *Sender) SendBatch(ctx context.Context, batch []Metric) error {
+	list := make([]models.Metrics, 0, len(batch))
+	for _, m := range batch {
+		switch m.Type {
+		case Gauge:
+			list = append(list, models.NewGauge(m.Name, m.Value))
+		case Counter:
+			list = append(list, models.NewCounter(m.Name, m.Delta))
+		default:
+			return fmt.Errorf("неизвестный тип метрики %q", m.Type)
+		}
+	}
+	if err := s.api.UpdateBatch(ctx, list); err != nil {
+		return fmt.Errorf("отправка %d метрик: %w", len(list), err)
+	}
+	return nil
+}
+
+// FetchCommands забирает с сервера команды для агента id
+func (s *Sender) FetchCommands(id string) ([]commands.Command, error) {
+	resp, err := s.client.Get(s.baseURL + "/agent/commands?id=" + url.QueryEscape(id))
+	if err != nil {
+		return nil, fmt.Errorf("получение команд: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("получение команд: сервер ответил %s", resp.Status)
+	}
+
+	var cmds []commands.Command
+	if err := json.NewDecoder(resp.Body).Decode(&cmds); err != nil {
+		return nil, fmt.Errorf("получение команд: %w", err)
+	}
+	return cmds, nil
+}
@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// spool каталог пакетов метрик, которые не удалось отправить на сервер
+// и после повторов. Каждый пакет хранится в своём файле с ключом
+// идемпотентности; когда сервер снова доступен, пакеты отправляются по
+// порядку записи с тем же ключом, поэтому пакет, дошедший до сервера без
+// ответа, не применяется дважды. Каталог переживает перезапуск агента.
+//
+// Если файлы занимают больше max байт, два самых старых соседних пакета,
+// которые ещё не отправлялись, объединяются так же, как в очереди: теряются
+// только промежуточные значения gauge, приращения counter сохраняются.
+// Отправленный пакет мог быть применён сервером под своим ключом, поэтому
+// он не объединяется с другими; если объединять нечего, удаляется самый
+// старый пакет.
+type spool struct {
+	dir string
+	max int64
+
+	mu sync.Mutex
+	// seq номер последнего записанного файла
+	seq uint64
+}
+
+// spooled пакет в файле каталога
+type spooled struct {
+	Key     string   `json:"key"`
+	Metrics []Metric `json:"metrics"`
+	// Pending пакет ещё не отправлялся, и его можно объединить с соседним
+	Pending bool `json:"pending,omitempty"`
+}
+
+// spoolExt расширение файлов пакетов
+const spoolExt = ".json"
+
+// newSpool открывает каталог dir, создавая его при необходимости
+func newSpool(dir string, max int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	s := &spool{dir: dir, max: max}
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		s.seq = fileSeq(files[len(files)-1])
+	}
+	return s, nil
+}
+
+// spoolDir имя подкаталога пакетов к серверу addr
+func spoolDir(addr string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, addr)
+}
+
+// fileSeq номер файла пакета по его имени
+func fileSeq(name string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimSuffix(name, spoolExt), 10, 64)
+	return n
+}
+
+// files имена файлов пакетов от старых к новым
+func (s *spool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), spoolExt) && fileSeq(e.Name()) > 0 {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return fileSeq(names[i]) < fileSeq(names[j]) })
+	return names, nil
+}
+
+// put записывает пакет в конец каталога; pending — пакет ещё не отправлялся
+func (s *spool) put(key string, batch []Metric, pending bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	if err := s.write(fmt.Sprintf("%020d%s", s.seq, spoolExt), spooled{Key: key, Metrics: batch, Pending: pending}); err != nil {
+		return err
+	}
+	return s.shrink()
+}
+
+// write атомарно записывает пакет в файл name
+func (s *spool) write(name string, b spooled) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+// read читает пакет из файла name
+func (s *spool) read(name string) (spooled, error) {
+	var b spooled
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return b, err
+	}
+	err = json.Unmarshal(data, &b)
+	return b, err
+}
+
+// oldest возвращает самый старый пакет каталога. Повреждённые файлы
+// удаляются: отправить их всё равно нельзя.
+func (s *spool) oldest() (name string, b spooled, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := s.files()
+	if err != nil {
+		log.Printf("Не удалось прочитать каталог неотправленных пакетов %s: %v", s.dir, err)
+		return "", b, false
+	}
+	for _, name := range files {
+		b, err := s.read(name)
+		if err == nil {
+			return name, b, true
+		}
+		log.Printf("Повреждённый пакет %s удалён: %v", filepath.Join(s.dir, name), err)
+		os.Remove(filepath.Join(s.dir, name))
+	}
+	return "", b, false
+}
+
+// sending отмечает пакет из файла name отправляемым до отправки: после
+// неё исход неизвестен, даже если агент остановится, не дождавшись ответа
+func (s *spool) sending(name string, b spooled) error {
+	if !b.Pending {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b.Pending = false
+	return s.write(name, b)
+}
+
+// remove удаляет отправленный пакет
+func (s *spool) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Не удалось удалить отправленный пакет: %v", err)
+	}
+}
+
+// len возвращает число пакетов в каталоге
+func (s *spool) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, _ := s.files()
+	return len(files)
+}
+
+// shrink объединяет самые старые соседние неотправленные пакеты, пока
+// файлы занимают больше max байт; объединённый пакет сохраняет ключ более
+// нового. Если таких пакетов нет, удаляет самый старый. Вызывается под
+// блокировкой.
+func (s *spool) shrink() error {
+	if s.max <= 0 {
+		return nil
+	}
+	for {
+		files, err := s.files()
+		if err != nil {
+			return err
+		}
+		var size int64
+		for _, name := range files {
+			if info, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+				size += info.Size()
+			}
+		}
+		if size <= s.max {
+			return nil
+		}
+		merged, err := s.mergeOldest(files)
+		if err != nil {
+			return err
+		}
+		if merged {
+			continue
+		}
+		// Хранить пакет негде: он больше ограничения или отправлялся
+		log.Printf("Пакет %s не помещается в каталог и удалён", filepath.Join(s.dir, files[0]))
+		if err := os.Remove(filepath.Join(s.dir, files[0])); err != nil {
+			return err
+		}
+	}
+}
+
+// mergeOldest объединяет первую пару соседних неотправленных пакетов из
+// files; false — такой пары нет. Повреждённые файлы удаляются.
+func (s *spool) mergeOldest(files []string) (bool, error) {
+	var older *spooled
+	for i, name := range files {
+		b, err := s.read(name)
+		if err != nil {
+			return true, os.Remove(filepath.Join(s.dir, name))
+		}
+		if !b.Pending {
+			older = nil
+			continue
+		}
+		if older == nil {
+			older = &b
+			continue
+		}
+		merged := spooled{Key: b.Key, Metrics: merge(older.Metrics, b.Metrics), Pending: true}
+		if err := s.write(name, merged); err != nil {
+			return false, err
+		}
+		return true, os.Remove(filepath.Join(s.dir, files[i-1]))
+	}
+	return false, nil
+}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSpoolShrink(t *testing.T) {
+	type want struct {
+		key     string
+		delta   int64
+		pending bool
+	}
+	tests := []struct {
+		name    string
+		pending []bool
+		want    []want
+	}{
+		{
+			name:    "неотправленные объединяются",
+			pending: []bool{true, true, true},
+			want:    []want{{"k2", 2, true}, {"k3", 1, true}},
+		},
+		{
+			name:    "отправленный не объединяется",
+			pending: []bool{false, true, true},
+			want:    []want{{"k1", 1, false}, {"k3", 2, true}},
+		},
+		{
+			name:    "соседние только отправленные",
+			pending: []bool{false, false, false},
+			want:    []want{{"k2", 1, false}, {"k3", 1, false}},
+		},
+		{
+			name:    "неотправленные не соседи",
+			pending: []bool{true, false, true},
+			want:    []want{{"k2", 1, false}, {"k3", 1, true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSpool(t.TempDir(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, pending := range tt.pending {
+				key := "k" + string(rune('1'+i))
+				if err := s.put(key, []Metric{{Type: Counter, Name: "hits", Delta: 1}}, pending); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Ограничение на байт меньше занятого: освободить место нужно один раз
+			files, _ := s.files()
+			var size int64
+			for _, name := range files {
+				info, err := os.Stat(filepath.Join(s.dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				size += info.Size()
+			}
+			s.max = size - 1
+			s.mu.Lock()
+			err = s.shrink()
+			s.mu.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files, _ = s.files()
+			if len(files) != len(tt.want) {
+				t.Fatalf("пакетов %d, ожидалось %d", len(files), len(tt.want))
+			}
+			for i, name := range files {
+				b, err := s.read(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				w := tt.want[i]
+				if b.Key != w.key || b.Pending != w.pending || len(b.Metrics) != 1 || b.Metrics[0].Delta != w.delta {
+					t.Errorf("пакет %d = %+v, ожидался ключ %s, приращение %d, неотправлен %t", i, b, w.key, w.delta, w.pending)
+				}
+			}
+		})
+	}
+}
+
+func TestSpoolSending(t *testing.T) {
+	s, err := newSpool(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.put("k1", []Metric{{Type: Counter, Name: "hits", Delta: 1}}, true); err != nil {
+		t.Fatal(err)
+	}
+	name, b, ok := s.oldest()
+	if !ok || !b.Pending {
+		t.Fatalf("пакет %+v не отмечен неотправленным", b)
+	}
+	if err := s.sending(name, b); err != nil {
+		t.Fatal(err)
+	}
+	if _, b, _ := s.oldest(); b.Pending || b.Key != "k1" {
+		t.Errorf("после отправки пакет %+v", b)
+	}
+}
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releaseInfo ответ сервера обновлений
+type releaseInfo struct {
+	Version string `json:"version"`
+}
+
+// UpgradeChecker периодически проверяет наличие новой версии агента
+// и публикует сведения о версии в виде метрик
+type UpgradeChecker struct {
+	url        string
+	current    string
+	hook       string
+	client     *http.Client
+	collector  *Collector
+	staleSince time.Time
+	hookRun    bool
+}
+
+// NewUpgradeChecker создаёт проверку обновлений для версии current.
+// hook — необязательная команда, запускаемая при обнаружении новой версии.
+func NewUpgradeChecker(url, current, hook string, collector *Collector) *UpgradeChecker {
+	if _, ok := parseVersion(current); !ok {
+		log.Printf("Версия агента %q не распознана: устаревание не определяется, команда обновления не запускается", current)
+	}
+	return &UpgradeChecker{
+		url:       url,
+		current:   current,
+		hook:      hook,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		collector: collector,
+	}
+}
+
+// Run проверяет обновления с периодичностью interval до отмены контекста
+func (u *UpgradeChecker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := u.Check(ctx); err != nil {
+			log.Printf("Ошибка проверки обновлений: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check запрашивает последнюю версию и обновляет метрики:
+// AgentVersion — текущая версия в числовом виде (major*1e6 + minor*1e3 + patch),
+// AgentUpdateAvailable — 1, если доступна новая версия,
+// AgentStaleSeconds — сколько секунд агент работает на устаревшей версии.
+func (u *UpgradeChecker) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("сервер обновлений ответил %s", resp.Status)
+	}
+	var info releaseInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("неверный ответ сервера обновлений: %w", err)
+	}
+
+	available := newerVersion(info.Version, u.current)
+	if available && u.staleSince.IsZero() {
+		u.staleSince = time.Now()
+		log.Printf("Доступна новая версия агента %s (текущая %s)", info.Version, u.current)
+	}
+	if !available {
+		u.staleSince = time.Time{}
+	}
+
+	var stale, flag float64
+	if available {
+		stale = time.Since(u.staleSince).Seconds()
+		flag = 1
+	}
+	u.collector.SetGauge("AgentVersion", versionNumber(u.current))
+	u.collector.SetGauge("AgentUpdateAvailable", flag)
+	u.collector.SetGauge("AgentStaleSeconds", stale)
+
+	if available && u.hook != "" && !u.hookRun {
+		u.hookRun = true
+		u.runHook(ctx, info.Version)
+	}
+	return nil
+}
+
+// runHook запускает команду перезапуска, передавая ей новую версию
+// в переменной окружения AGENT_NEW_VERSION
+func (u *UpgradeChecker) runHook(ctx context.Context, version string) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", u.hook)
+	cmd.Env = append(cmd.Environ(), "AGENT_NEW_VERSION="+version)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("Ошибка команды обновления: %v: %s", err, out)
+		return
+	}
+	log.Printf("Команда обновления выполнена: %s", strings.TrimSpace(string(out)))
+}
+
+// parseVersion разбирает версию вида v1.2.3
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	fields := strings.Split(strings.TrimPrefix(strings.TrimSpace(v), "v"), ".")
+	if len(fields) == 0 || len(fields) > 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		// Суффиксы вида -rc1 не учитываются
+		f, _, _ = strings.Cut(f, "-")
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// newerVersion сообщает, новее ли latest текущей версии current.
+// Версию, которую нельзя разобрать, например N/A у сборки без версии,
+// не с чем сравнить: новая версия при ней не определяется.
+func newerVersion(latest, current string) bool {
+	l, ok1 := parseVersion(latest)
+	c, ok2 := parseVersion(current)
+	if !ok1 || !ok2 {
+		return false
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+// versionNumber переводит версию в число для публикации метрикой
+func versionNumber(v string) float64 {
+	p, ok := parseVersion(v)
+	if !ok {
+		return 0
+	}
+	return float64(p[0])*1e6 + float64(p[1])*1e3 + float64(p[2])
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/buildinfo"
+)
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.2.4", "v1.2.3", true},
+		{"v1.3", "v1.2.9", true},
+		{"v2.0.0", "v1.9.9", true},
+		{"v1.2.3", "v1.2.3", false},
+		{"v1.2.2", "v1.2.3", false},
+		{"v1.2.3-rc1", "v1.2.3", false},
+		{"v1.2.4", buildinfo.NA, false},
+		{"v1.2.4", "", false},
+		{"nightly", "v1.2.3", false},
+		{"", "v1.2.3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.latest+" "+tt.current, func(t *testing.T) {
+			if got := newerVersion(tt.latest, tt.current); got != tt.want {
+				t.Errorf("newerVersion(%q, %q) = %t, ожидалось %t", tt.latest, tt.current, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckUnknownVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  string
+		wantFlag float64
+		wantHook bool
+	}{
+		{name: "устаревшая версия", current: "v1.0.0", wantFlag: 1, wantHook: true},
+		{name: "версия не задана при сборке", current: buildinfo.NA, wantFlag: 0, wantHook: false},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version":"v2.0.0"}`)
+	}))
+	defer srv.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marker := filepath.Join(t.TempDir(), "hook")
+			c := NewCollector()
+			u := NewUpgradeChecker(srv.URL, tt.current, "touch "+marker, c)
+			if err := u.Check(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			var flag float64 = -1
+			for _, m := range c.Snapshot() {
+				if m.Name == "AgentUpdateAvailable" {
+					flag = m.Value
+				}
+			}
+			if flag != tt.wantFlag {
+				t.Errorf("AgentUpdateAvailable = %v, ожидалось %v", flag, tt.wantFlag)
+			}
+			if _, err := os.Stat(marker); (err == nil) != tt.wantHook {
+				t.Errorf("команда обновления запущена: %t, ожидалось %t", err == nil, tt.wantHook)
+			}
+		})
+	}
+}
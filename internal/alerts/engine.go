@@ -0,0 +1,325 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// Состояния правила
+const (
+	StateInactive = "inactive"
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Source источник значений метрик
+type Source interface {
+	GetGauge(ctx context.Context, name string) (float64, error)
+	GetCounter(ctx context.Context, name string) (int64, error)
+}
+
+// Config настройки оповещений
+type Config struct {
+	// Webhook общий адрес оповещений
+	Webhook string `json:"webhook"`
+	// Interval частота проверки правил, например "10s"
+	Interval string `json:"interval"`
+	// Rules правила оповещений
+	Rules []Rule `json:"rules"`
+}
+
+// Alert оповещение, отправляемое на веб-хук
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Expr      string    `json:"expr"`
+	Status    string    `json:"status"`
+	Value     float64   `json:"value"`
+	Since     time.Time `json:"since"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// RuleState правило вместе с текущим состоянием
+type RuleState struct {
+	Rule
+	State string    `json:"state"`
+	Value *float64  `json:"value,omitempty"`
+	Since time.Time `json:"since,omitempty"`
+}
+
+// Engine периодически проверяет правила и отправляет оповещения
+type Engine struct {
+	mu       sync.Mutex
+	source   Source
+	webhook  string
+	interval time.Duration
+	rules    map[string]*RuleState
+	client   *http.Client
+}
+
+// NewEngine проверяет правила и создаёт движок оповещений
+func NewEngine(source Source, cfg Config) (*Engine, error) {
+	interval := 10 * time.Second
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("неверный интервал проверки %q", cfg.Interval)
+		}
+		interval = d
+	}
+
+	e := &Engine{
+		source:   source,
+		webhook:  cfg.Webhook,
+		interval: interval,
+		rules:    make(map[string]*RuleState),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, r := range cfg.Rules {
+		if err := e.Put(r); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Put добавляет правило или заменяет правило с тем же именем
+func (e *Engine) Put(r Rule) error {
+	if err := r.Parse(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if r.Webhook == "" && e.webhook == "" {
+		return fmt.Errorf("правило %s: не задан адрес оповещения", r.Name)
+	}
+	e.rules[r.Name] = &RuleState{Rule: r, State: StateInactive}
+	return nil
+}
+
+// Replace заменяет общий адрес оповещений и все правила. Правила с прежним
+// условием сохраняют своё состояние. Если хотя бы одно правило неверно,
+// движок не меняется.
+func (e *Engine) Replace(webhook string, rules []Rule) error {
+	for i := range rules {
+		if err := rules[i].Parse(); err != nil {
+			return err
+		}
+		if rules[i].Webhook == "" && webhook == "" {
+			return fmt.Errorf("правило %s: не задан адрес оповещения", rules[i].Name)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	next := make(map[string]*RuleState, len(rules))
+	for _, r := range rules {
+		if old, ok := e.rules[r.Name]; ok && old.Expr == r.Expr {
+			old.Rule = r
+			next[r.Name] = old
+			continue
+		}
+		next[r.Name] = &RuleState{Rule: r, State: StateInactive}
+	}
+	e.webhook = webhook
+	e.rules = next
+	return nil
+}
+
+// Delete удаляет правило; возвращает false, если правила нет
+func (e *Engine) Delete(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.rules[name]; !ok {
+		return false
+	}
+	delete(e.rules, name)
+	return true
+}
+
+// Rules возвращает правила с их состояниями, упорядоченные по имени
+func (e *Engine) Rules() []RuleState {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules := make([]RuleState, 0, len(e.rules))
+	for _, rs := range e.rules {
+		rules = append(rules, *rs)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// Definitions возвращает правила без состояний, упорядоченные по имени
+func (e *Engine) Definitions() []Rule {
+	states := e.Rules()
+	rules := make([]Rule, len(states))
+	for i, rs := range states {
+		rules[i] = rs.Rule
+	}
+	return rules
+}
+
+// Run проверяет правила до отмены контекста
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, alert := range e.evaluate(ctx, now) {
+				if err := e.notify(ctx, alert.webhook, alert.Alert); err != nil {
+					log.Printf("Ошибка отправки оповещения %s: %v", alert.Rule, err)
+				}
+			}
+		}
+	}
+}
+
+// pendingAlert оповещение вместе с адресом отправки
+type pendingAlert struct {
+	Alert
+	webhook string
+}
+
+// evaluate проверяет правила в момент now и возвращает оповещения
+// о сработавших и снятых тревогах
+func (e *Engine) evaluate(ctx context.Context, now time.Time) []pendingAlert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var alerts []pendingAlert
+	for _, rs := range e.rules {
+		value, err := e.value(ctx, rs.metricType, rs.metric)
+		if err != nil {
+			// Отсутствующая метрика просто не проверяется, ошибку
+			// хранилища стоит заметить в журнале
+			if !errors.Is(err, storage.ErrNotFound) {
+				log.Printf("Правило %s: %v", rs.Name, err)
+			}
+			continue
+		}
+		rs.Value = &value
+
+		webhook := rs.Webhook
+		if webhook == "" {
+			webhook = e.webhook
+		}
+
+		if rs.holds(value) {
+			switch rs.State {
+			case StateInactive, StateResolved:
+				rs.State = StatePending
+				rs.Since = now
+			}
+			if rs.State == StatePending && now.Sub(rs.Since) >= rs.duration {
+				rs.State = StateFiring
+				alerts = append(alerts, pendingAlert{e.alert(rs, value, now), webhook})
+			}
+			continue
+		}
+
+		switch rs.State {
+		case StateFiring:
+			rs.State = StateResolved
+			alerts = append(alerts, pendingAlert{e.alert(rs, value, now), webhook})
+			rs.Since = now
+		case StatePending:
+			rs.State = StateInactive
+			rs.Since = time.Time{}
+		}
+	}
+	return alerts
+}
+
+// alert формирует оповещение о текущем состоянии правила
+func (e *Engine) alert(rs *RuleState, value float64, now time.Time) Alert {
+	return Alert{
+		Rule:      rs.Name,
+		Expr:      rs.Expr,
+		Status:    rs.State,
+		Value:     value,
+		Since:     rs.Since,
+		Timestamp: now,
+	}
+}
+
+// value возвращает текущее значение метрики
+func (e *Engine) value(ctx context.Context, metricType, name string) (float64, error) {
+	if metricType == "counter" {
+		v, err := e.source.GetCounter(ctx, name)
+		return float64(v), err
+	}
+	return e.source.GetGauge(ctx, name)
+}
+
+// notify отправляет оповещение на веб-хук
+func (e *Engine) notify(ctx context.Context, url string, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("получен ответ %s", resp.Status)
+	}
+	return nil
+}
+
+// Handler обработчик административного API правил:
+// GET /admin/alerts/rules — список правил с состояниями,
+// POST /admin/alerts/rules — добавить или заменить правило,
+// DELETE /admin/alerts/rules/{name} — удалить правило
+func (e *Engine) Handler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e.Rules())
+	case r.Method == http.MethodPost && name == "":
+		var rule Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, "Неверный формат правила.", http.StatusBadRequest)
+			return
+		}
+		if err := e.Put(rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete && name != "":
+		if !e.Delete(name) {
+			http.Error(w, "Правило не найдено.", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Метод не разрешён.", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,79 @@
+// Package alerts проверяет правила по значениям метрик и оповещает веб-хуки
+// о срабатывании и снятии тревоги
+package alerts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule правило оповещения
+type Rule struct {
+	// Name уникальное имя правила
+	Name string `json:"name"`
+	// Expr условие вида "gauge Alloc > 1e9 for 5m"
+	Expr string `json:"expr"`
+	// Webhook адрес оповещения; если пуст, используется общий адрес
+	Webhook string `json:"webhook,omitempty"`
+
+	metricType string
+	metric     string
+	op         string
+	threshold  float64
+	duration   time.Duration
+}
+
+// Parse разбирает условие правила.
+// Формат: <type> <metric> <op> <threshold> [for <duration>], op — один из > >= < <= == !=.
+func (r *Rule) Parse() error {
+	if r.Name == "" {
+		return fmt.Errorf("не задано имя правила")
+	}
+	fields := strings.Fields(r.Expr)
+	if len(fields) != 4 && len(fields) != 6 {
+		return fmt.Errorf("правило %s: ожидается условие вида \"gauge Alloc > 1e9 for 5m\"", r.Name)
+	}
+
+	r.metricType, r.metric, r.op = fields[0], fields[1], fields[2]
+	if r.metricType != "gauge" && r.metricType != "counter" {
+		return fmt.Errorf("правило %s: неизвестный тип метрики %q", r.Name, r.metricType)
+	}
+	if _, ok := compare[r.op]; !ok {
+		return fmt.Errorf("правило %s: неизвестный оператор %q", r.Name, r.op)
+	}
+	threshold, err := strconv.ParseFloat(fields[3], 64)
+	if err != nil {
+		return fmt.Errorf("правило %s: неверный порог %q", r.Name, fields[3])
+	}
+	r.threshold = threshold
+
+	r.duration = 0
+	if len(fields) == 6 {
+		if fields[4] != "for" {
+			return fmt.Errorf("правило %s: ожидается for, получено %q", r.Name, fields[4])
+		}
+		d, err := time.ParseDuration(fields[5])
+		if err != nil || d < 0 {
+			return fmt.Errorf("правило %s: неверная длительность %q", r.Name, fields[5])
+		}
+		r.duration = d
+	}
+	return nil
+}
+
+// compare операторы сравнения
+var compare = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// holds проверяет условие правила для значения
+func (r *Rule) holds(value float64) bool {
+	return compare[r.op](value, r.threshold)
+}
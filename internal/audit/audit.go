@@ -0,0 +1,280 @@
+// Package audit ведёт журнал изменений метрик через API: кто (адрес
+// и API-ключ клиента), когда и какое значение записал. Журнал пишется
+// в файл в формате JSON Lines и сменяется при достижении заданного размера.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Действия, отмечаемые в журнале
+const (
+	// ActionUpdate обновление метрики клиентом
+	ActionUpdate = "update"
+	// ActionRestore восстановление значения из резервной копии
+	ActionRestore = "restore"
+	// ActionImport установка значения из выгрузки Prometheus
+	ActionImport = "import"
+	// ActionConfig изменение настроек через административное API
+	// или перечитывание файла конфигурации
+	ActionConfig = "config"
+)
+
+// Разделы настроек в записях ActionConfig
+const (
+	// SectionAlerts правила оповещений
+	SectionAlerts = "alerts"
+	// SectionTenantKeys API-ключи арендаторов
+	SectionTenantKeys = "tenant_keys"
+	// SectionSynthetic генерируемые тестовые ряды
+	SectionSynthetic = "synthetic"
+	// SectionFreeze окна заморозки обновлений метрик
+	SectionFreeze = "freeze"
+	// SectionReload настройки, перечитываемые из файла конфигурации
+	SectionReload = "reload"
+)
+
+// RemoteSIGHUP клиент записи о перечитывании настроек по сигналу SIGHUP
+const RemoteSIGHUP = "SIGHUP"
+
+// Entry запись журнала об изменении одной метрики или раздела настроек
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Remote IP-адрес клиента (или SIGHUP), KeyID идентификатор его API-ключа,
+	// Client имя его токена доступа или subject JWT
+	Remote string `json:"remote"`
+	KeyID  string `json:"key_id,omitempty"`
+	Client string `json:"client,omitempty"`
+	Action string `json:"action"`
+	Type   string `json:"type,omitempty"`
+	// Name имя метрики в хранилище, с префиксом арендатора
+	Name string `json:"name,omitempty"`
+	// Delta приращение counter при обновлении
+	Delta *int64 `json:"delta,omitempty"`
+	// Value значение метрики после изменения
+	Value *float64 `json:"value,omitempty"`
+	// Section раздел настроек, Before и After его состояние до и после изменения
+	Section string          `json:"section,omitempty"`
+	Before  json.RawMessage `json:"before,omitempty"`
+	After   json.RawMessage `json:"after,omitempty"`
+}
+
+// Filter условия выборки записей; пустые поля не ограничивают выборку
+type Filter struct {
+	Name    string
+	KeyID   string
+	Client  string
+	Remote  string
+	Action  string
+	Section string
+	From    time.Time
+	To      time.Time
+	// Limit наибольшее число последних подходящих записей
+	Limit int
+}
+
+// match сообщает, подходит ли запись под условия
+func (f Filter) match(e Entry) bool {
+	return (f.Name == "" || e.Name == f.Name) &&
+		(f.KeyID == "" || e.KeyID == f.KeyID) &&
+		(f.Client == "" || e.Client == f.Client) &&
+		(f.Remote == "" || e.Remote == f.Remote) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Section == "" || e.Section == f.Section) &&
+		(f.From.IsZero() || !e.Time.Before(f.From)) &&
+		(f.To.IsZero() || !e.Time.After(f.To))
+}
+
+// Log журнал изменений в файле. Когда файл превышает maxSize, он
+// переименовывается в path.1 (прежний path.1 — в path.2 и так далее),
+// и хранится не более maxFiles таких файлов.
+type Log struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	closed   bool
+}
+
+// Open открывает журнал path для дописывания. maxSize 0 — без смены файла.
+func Open(path string, maxSize int64, maxFiles int) (*Log, error) {
+	if maxSize < 0 || maxFiles < 0 {
+		return nil, errors.New("размер и число файлов журнала не могут быть отрицательными")
+	}
+	l := &Log{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open открывает текущий файл журнала
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// rotated путь n-го сменённого файла
+func (l *Log) rotated(n int) string {
+	return l.path + "." + strconv.Itoa(n)
+}
+
+// rotate сменяет текущий файл журнала. Новый файл открывается, даже
+// если переименовать прежние не удалось.
+func (l *Log) rotate() error {
+	l.file.Close()
+	l.file = nil
+	var err error
+	os.Remove(l.rotated(l.maxFiles))
+	for n := l.maxFiles - 1; n >= 1 && err == nil; n-- {
+		if e := os.Rename(l.rotated(n), l.rotated(n+1)); e != nil && !os.IsNotExist(e) {
+			err = e
+		}
+	}
+	if err == nil {
+		if l.maxFiles > 0 {
+			err = os.Rename(l.path, l.rotated(1))
+		} else {
+			err = os.Remove(l.path)
+		}
+	}
+	return errors.Join(err, l.open())
+}
+
+// Record дописывает записи в журнал. Ошибки записи не прерывают
+// изменение метрик и только выводятся в лог сервера.
+func (l *Log) Record(entries ...Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	var buf []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	// Файл, не открывшийся после смены, открывается при следующей записи
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			log.Printf("Не удалось открыть журнал аудита: %v", err)
+			return
+		}
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(buf)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			log.Printf("Не удалось сменить файл журнала аудита: %v", err)
+			if l.file == nil {
+				return
+			}
+		}
+	}
+	n, err := l.file.Write(buf)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("Не удалось записать журнал аудита: %v", err)
+	}
+}
+
+// RecordChange отмечает изменение раздела настроек e.Section, если его
+// состояние before отличается от after
+func (l *Log) RecordChange(e Entry, before, after any) {
+	b, err := json.Marshal(before)
+	if err != nil {
+		return
+	}
+	a, err := json.Marshal(after)
+	if err != nil || bytes.Equal(a, b) {
+		return
+	}
+	e.Action, e.Before, e.After = ActionConfig, b, a
+	l.Record(e)
+}
+
+// Query возвращает последние записи, подходящие под условия,
+// от старых к новым
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	// Файлы открываются под блокировкой, а читаются без неё: смена файла
+	// во время чтения не мешает уже открытым файлам
+	l.mu.Lock()
+	var files []io.Reader
+	for n := l.maxFiles; n >= 1; n-- {
+		rf, err := os.Open(l.rotated(n))
+		if err != nil {
+			continue
+		}
+		defer rf.Close()
+		files = append(files, rf)
+	}
+	cur, err := os.Open(l.path)
+	size := l.size
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close()
+	files = append(files, io.LimitReader(cur, size))
+
+	var res []Entry
+	for _, r := range files {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 1<<20)
+		for sc.Scan() {
+			var e Entry
+			if json.Unmarshal(sc.Bytes(), &e) != nil || !f.match(e) {
+				continue
+			}
+			res = append(res, e)
+			if f.Limit > 0 && len(res) > 2*f.Limit {
+				res = append(res[:0], res[len(res)-f.Limit:]...)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if f.Limit > 0 && len(res) > f.Limit {
+		res = res[len(res)-f.Limit:]
+	}
+	return res, nil
+}
+
+// Close закрывает файл журнала
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
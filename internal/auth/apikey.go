@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/iliodor1/metrics-service/internal/middleware"
+)
+
+// APIKeyConfig права, которые дают API-ключи арендаторов
+type APIKeyConfig struct {
+	Scopes []string `json:"scopes"`
+}
+
+// KeyLookup источник API-ключей; ему соответствует реестр арендаторов
+type KeyLookup interface {
+	// Tenant возвращает арендатора ключа
+	Tenant(key string) (string, bool)
+}
+
+// APIKeys проверка по API-ключу арендатора из заголовка X-API-Key
+type APIKeys struct {
+	Keys   KeyLookup
+	Scopes []string
+}
+
+// Authenticate находит арендатора по ключу
+func (a *APIKeys) Authenticate(r *http.Request) (Principal, error) {
+	key := r.Header.Get(middleware.APIKeyHeader)
+	if key == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	tenant, ok := a.Keys.Tenant(key)
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: неизвестный API-ключ", ErrInvalidCredentials)
+	}
+	return Principal{Name: "tenant:" + tenant, Scopes: a.Scopes}, nil
+}
@@ -0,0 +1,331 @@
+// Package auth проверяет, кто обращается к API метрик и с какими правами.
+// Способы проверки реализуют интерфейс Authenticator и пробуются по очереди:
+//
+//   - постоянные токены из файла конфигурации (Authorization: Bearer);
+//   - JWT, подписанные общим секретом (HS256/384/512) или ключами из JWKS
+//     (RS256/384/512, ES256/384/512, EdDSA);
+//   - сертификат клиента при mTLS;
+//   - API-ключи арендаторов (X-API-Key);
+//   - собственные способы, зарегистрированные функцией Register, например
+//     единый вход организации.
+//
+// Маршруты, изменяющие метрики, требуют права metrics:write, остальные
+// маршруты метрик — metrics:read. В отличие от подписи тел общим ключом,
+// доступ отзывается у одного клиента: его токен или сертификат удаляется
+// из конфигурации или его subject вносится в revoked_subjects, после чего
+// настройки перечитываются.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Права доступа
+const (
+	ScopeRead  = "metrics:read"
+	ScopeWrite = "metrics:write"
+)
+
+// Principal клиент, прошедший проверку
+type Principal struct {
+	// Name имя клиента в журнале аудита: имя токена, subject JWT,
+	// имя из сертификата или арендатор API-ключа
+	Name   string
+	Scopes []string
+}
+
+// Has сообщает, есть ли у клиента право scope. Право записи
+// включает право чтения.
+func (p Principal) Has(scope string) bool {
+	return slices.Contains(p.Scopes, scope) ||
+		(scope == ScopeRead && slices.Contains(p.Scopes, ScopeWrite))
+}
+
+// Authenticator способ проверки клиента по запросу
+type Authenticator interface {
+	// Authenticate возвращает клиента запроса. Если в запросе нет
+	// учётных данных этого способа, возвращается ErrNoCredentials
+	// и запрос проверяется следующим способом; если они есть, но
+	// недействительны, — ошибка, оборачивающая ErrInvalidCredentials.
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Ошибки проверки
+var (
+	ErrNoCredentials      = errors.New("не переданы учётные данные")
+	ErrInvalidCredentials = errors.New("недействительные учётные данные")
+)
+
+// Factory создаёт способ проверки по его настройкам из раздела auth.custom
+type Factory func(config json.RawMessage) (Authenticator, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register регистрирует собственный способ проверки под именем name,
+// которое указывается в поле type раздела auth.custom. Вызывается из init
+// файла, добавленного в сборку сервера; повторная регистрация имени —
+// ошибка программы:
+//
+//	func init() {
+//		auth.Register("sso", func(config json.RawMessage) (auth.Authenticator, error) {
+//			var cfg ssoConfig
+//			if err := json.Unmarshal(config, &cfg); err != nil {
+//				return nil, err
+//			}
+//			return newSSO(cfg), nil
+//		})
+//	}
+//
+// и в файле конфигурации: "auth": {"custom": [{"type": "sso", "config": {...}}]}.
+func Register(name string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("auth: способ проверки " + name + " зарегистрирован дважды")
+	}
+	factories[name] = f
+}
+
+// factory возвращает зарегистрированный способ проверки
+func factory(name string) (Factory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	f, ok := factories[name]
+	return f, ok
+}
+
+// Registered имена зарегистрированных способов проверки
+func Registered() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Config раздел auth файла конфигурации
+type Config struct {
+	// Tokens постоянные токены клиентов
+	Tokens []Token `json:"tokens"`
+	// JWT проверка JWT (nil — JWT не принимаются)
+	JWT *JWTConfig `json:"jwt"`
+	// MTLS клиенты, допущенные по сертификату (nil — сертификаты не проверяются)
+	MTLS *MTLSConfig `json:"mtls"`
+	// APIKeys права, которые дают API-ключи арендаторов (nil — ключи
+	// сами по себе доступа не дают)
+	APIKeys *APIKeyConfig `json:"api_keys"`
+	// Custom собственные способы проверки в порядке опроса
+	Custom []CustomConfig `json:"custom"`
+}
+
+// CustomConfig настройки собственного способа проверки
+type CustomConfig struct {
+	// Type имя, под которым способ зарегистрирован
+	Type   string          `json:"type"`
+	Config json.RawMessage `json:"config"`
+}
+
+// Validate проверяет раздел auth
+func Validate(cfg Config) error {
+	if err := validateTokens(cfg.Tokens); err != nil {
+		return err
+	}
+	if cfg.JWT != nil {
+		if err := cfg.JWT.validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.MTLS != nil {
+		if err := cfg.MTLS.validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.APIKeys != nil {
+		if err := validateScopes("api_keys", cfg.APIKeys.Scopes); err != nil {
+			return err
+		}
+	}
+	for i, c := range cfg.Custom {
+		if _, ok := factory(c.Type); !ok {
+			return fmt.Errorf("auth: custom №%d: способ %q не зарегистрирован (есть: %v)", i+1, c.Type, Registered())
+		}
+	}
+	return nil
+}
+
+// validateScopes проверяет список прав
+func validateScopes(who string, scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("auth: у %s нет прав", who)
+	}
+	for _, s := range scopes {
+		if s != ScopeRead && s != ScopeWrite {
+			return fmt.Errorf("auth: %s: неизвестное право %q", who, s)
+		}
+	}
+	return nil
+}
+
+// Enabled сообщает, задан ли в разделе хотя бы один способ проверки
+func (cfg Config) Enabled() bool {
+	return len(cfg.Tokens) > 0 || cfg.JWT != nil || cfg.MTLS != nil || cfg.APIKeys != nil || len(cfg.Custom) > 0
+}
+
+// Clients имена постоянных токенов и клиентов mTLS для журнала аудита:
+// сами токены в журнал не попадают
+func (cfg Config) Clients() []string {
+	names := make([]string, 0, len(cfg.Tokens))
+	for _, t := range cfg.Tokens {
+		names = append(names, t.Name)
+	}
+	if cfg.MTLS != nil {
+		for _, c := range cfg.MTLS.Clients {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// Chain проверяет запросы способами из раздела auth по очереди:
+// постоянные токены, JWT, mTLS, API-ключи, собственные способы
+type Chain struct {
+	keys    KeyLookup
+	current atomic.Pointer[[]Authenticator]
+}
+
+// New создаёт проверку по разделу auth. keys — API-ключи арендаторов
+// (nil — арендаторы не настроены).
+func New(cfg Config, keys KeyLookup) (*Chain, error) {
+	c := &Chain{keys: keys}
+	if err := c.Replace(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Replace заменяет способы проверки, например при перечитывании файла
+// конфигурации. Ключи JWKS сохраняются, если адрес не изменился.
+func (c *Chain) Replace(cfg Config) error {
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	var list []Authenticator
+	if len(cfg.Tokens) > 0 {
+		list = append(list, StaticTokens(cfg.Tokens))
+	}
+	if cfg.JWT != nil {
+		var prev *JWT
+		if cur := c.current.Load(); cur != nil {
+			for _, a := range *cur {
+				if j, ok := a.(*JWT); ok {
+					prev = j
+				}
+			}
+		}
+		list = append(list, NewJWT(*cfg.JWT, prev))
+	}
+	if cfg.MTLS != nil {
+		list = append(list, NewMTLS(*cfg.MTLS))
+	}
+	if cfg.APIKeys != nil {
+		if c.keys == nil {
+			return errors.New("auth: api_keys: ключи арендаторов не настроены (раздел tenants)")
+		}
+		list = append(list, &APIKeys{Keys: c.keys, Scopes: cfg.APIKeys.Scopes})
+	}
+	for _, cc := range cfg.Custom {
+		f, _ := factory(cc.Type)
+		a, err := f(cc.Config)
+		if err != nil {
+			return fmt.Errorf("auth: custom %s: %w", cc.Type, err)
+		}
+		list = append(list, a)
+	}
+	c.current.Store(&list)
+	return nil
+}
+
+// Authenticate проверяет запрос способами по очереди: первый способ,
+// нашедший в запросе свои учётные данные, решает исход проверки
+func (c *Chain) Authenticate(r *http.Request) (Principal, error) {
+	for _, a := range *c.current.Load() {
+		p, err := a.Authenticate(r)
+		if !errors.Is(err, ErrNoCredentials) {
+			return p, err
+		}
+	}
+	return Principal{}, ErrNoCredentials
+}
+
+// principalKey ключ клиента в контексте запроса
+type principalKey struct{}
+
+// FromContext возвращает клиента запроса, прошедшего проверку
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Identify передаёт обработчику в контексте запроса клиента, прошедшего
+// проверку a. Запросы без учётных данных и с недействительными
+// пропускаются без клиента: их отклоняет Require на маршруте.
+func Identify(a Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p, err := a.Authenticate(r); err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Require пропускает только запросы клиентов, прошедших проверку a
+// и имеющих право scope. Без учётных данных и с недействительными — 401,
+// без права — 403; причина передаётся в WWW-Authenticate по RFC 6750.
+// Клиент, уже определённый Identify, повторно не проверяется.
+func Require(a Authenticator, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := FromContext(r.Context())
+			var err error
+			if !ok {
+				p, err = a.Authenticate(r)
+			}
+			switch {
+			case errors.Is(err, ErrNoCredentials) && r.Header.Get("Authorization") == "":
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, "Требуется токен доступа.", http.StatusUnauthorized)
+				return
+			case errors.Is(err, ErrNoCredentials):
+				// Токен передан, но ни один способ его не узнал
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics", error="invalid_token"`)
+				http.Error(w, ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+				return
+			case err != nil:
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics", error="invalid_token"`)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			case !p.Has(scope):
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics", error="insufficient_scope", scope="`+scope+`"`)
+				http.Error(w, "У клиента нет права "+scope+".", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// countingAuth узнаёт токен "w" с правом записи и считает проверки
+type countingAuth struct {
+	calls int
+}
+
+func (a *countingAuth) Authenticate(r *http.Request) (Principal, error) {
+	a.calls++
+	switch r.Header.Get("Authorization") {
+	case "":
+		return Principal{}, ErrNoCredentials
+	case "Bearer w":
+		return Principal{Name: "writer", Scopes: []string{ScopeWrite}}, nil
+	}
+	return Principal{}, ErrInvalidCredentials
+}
+
+func TestIdentifyRequire(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		scope string
+		want  int
+		// wantName клиент в контексте обработчика маршрута
+		wantName string
+	}{
+		{name: "клиент с правом", token: "w", scope: ScopeRead, want: http.StatusOK, wantName: "writer"},
+		{name: "без токена", scope: ScopeRead, want: http.StatusUnauthorized},
+		{name: "неверный токен", token: "x", scope: ScopeRead, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &countingAuth{}
+			var inChain, inRoute string
+			route := Require(a, tt.scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				p, _ := FromContext(r.Context())
+				inRoute = p.Name
+			}))
+			h := Identify(a)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				p, _ := FromContext(r.Context())
+				inChain = p.Name
+				route.ServeHTTP(w, r)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/value/gauge/cpu", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("код ответа %d, ожидался %d", w.Code, tt.want)
+			}
+			if inChain != tt.wantName || inRoute != tt.wantName {
+				t.Errorf("клиент в цепочке %q, на маршруте %q; ожидался %q", inChain, inRoute, tt.wantName)
+			}
+			// Клиент, определённый в цепочке, на маршруте не проверяется заново
+			wantCalls := 2
+			if tt.wantName != "" {
+				wantCalls = 1
+			}
+			if a.calls != wantCalls {
+				t.Errorf("проверок %d, ожидалось %d", a.calls, wantCalls)
+			}
+		})
+	}
+}
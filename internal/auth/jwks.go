@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksRefresh как часто перечитывается набор ключей
+	jwksRefresh = 15 * time.Minute
+	// jwksMinRefresh не чаще скольких раз набор перечитывается из-за
+	// неизвестного kid: иначе токены с выдуманным kid нагружали бы издателя
+	jwksMinRefresh = 30 * time.Second
+	// jwksTimeout ограничение времени загрузки набора
+	jwksTimeout = 10 * time.Second
+	// maxJWKSSize наибольший размер набора ключей
+	maxJWKSSize = 1 << 20
+)
+
+// jwks открытые ключи издателя по kid. Набор загружается при первой
+// проверке токена и перечитывается раз в jwksRefresh, а также при
+// появлении неизвестного kid — издатель сменил ключи.
+type jwks struct {
+	url string
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// newJWKS создаёт набор ключей по адресу url
+func newJWKS(url string) *jwks {
+	return &jwks{url: url}
+}
+
+// key возвращает ключ kid
+func (j *jwks) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	age := time.Since(j.fetched)
+	_, known := j.keys[kid]
+	if j.keys == nil || age > jwksRefresh || (!known && age > jwksMinRefresh) {
+		keys, err := fetchJWKS(ctx, j.url)
+		if err != nil {
+			// Прежний набор остаётся в силе, если издатель недоступен
+			log.Printf("Не удалось загрузить JWKS %s: %v", j.url, err)
+			if j.keys == nil {
+				return nil, errors.New("набор ключей издателя недоступен")
+			}
+		} else {
+			j.keys = keys
+		}
+		j.fetched = time.Now()
+	}
+
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	// Токен без kid принимается, только если ключ у издателя один
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("неизвестный ключ %q", kid)
+}
+
+// jwk открытый ключ в формате JWK (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// N и E модуль и экспонента RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// Crv кривая, X и Y координаты ключа EC и OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchJWKS загружает набор ключей. Ключи неизвестных типов и ключи
+// шифрования (use=enc) пропускаются.
+func fetchJWKS(ctx context.Context, url string) (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, jwksTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ответ %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("JWKS %s: ключ %q пропущен: %v", url, k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// publicKey разбирает открытый ключ
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := func(s string) ([]byte, error) { return base64.RawURLEncoding.DecodeString(s) }
+	switch k.Kty {
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("слишком большая экспонента")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("кривая %q не поддерживается", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("точка не на кривой")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("кривая %q не поддерживается", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("неверный ключ Ed25519")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("тип ключа %q не поддерживается", k.Kty)
+}
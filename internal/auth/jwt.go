@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew допустимое расхождение часов сервера и издателя токенов
+const clockSkew = time.Minute
+
+// JWTConfig проверка JWT
+type JWTConfig struct {
+	// Secret общий секрет подписей HS256, HS384 и HS512
+	Secret string `json:"secret"`
+	// JWKSURL адрес набора открытых ключей издателя (JWKS) для подписей
+	// RS256/384/512, ES256/384/512 и EdDSA
+	JWKSURL string `json:"jwks_url"`
+	// Issuer и Audience ожидаемые значения iss и aud (пустые — не проверяются)
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+	// RevokedSubjects клиенты (sub), токены которых больше не принимаются
+	RevokedSubjects []string `json:"revoked_subjects"`
+}
+
+// validate проверяет настройки JWT
+func (c *JWTConfig) validate() error {
+	if c.Secret == "" && c.JWKSURL == "" {
+		return errors.New("auth: jwt: задайте secret или jwks_url")
+	}
+	if c.Secret != "" && len(c.Secret) < minTokenLength {
+		return fmt.Errorf("auth: jwt: secret короче %d символов", minTokenLength)
+	}
+	if c.JWKSURL != "" {
+		u, err := url.Parse(c.JWKSURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("auth: jwt: неверный jwks_url %q", c.JWKSURL)
+		}
+	}
+	return nil
+}
+
+// jwtHeader заголовок JWT
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwtClaims проверяемые утверждения JWT
+type jwtClaims struct {
+	Sub string     `json:"sub"`
+	Iss string     `json:"iss"`
+	Aud stringList `json:"aud"`
+	Exp *int64     `json:"exp"`
+	Nbf *int64     `json:"nbf"`
+	// Scope права через пробел (RFC 8693); Scp — они же списком,
+	// как в токенах Azure AD и Okta
+	Scope string     `json:"scope"`
+	Scp   stringList `json:"scp"`
+}
+
+// stringList утверждение, которое бывает строкой (значения через пробел)
+// или списком строк
+type stringList []string
+
+// UnmarshalJSON разбирает строку или список строк
+func (a *stringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = strings.Fields(s)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// JWT проверка JWT из заголовка Authorization: Bearer
+type JWT struct {
+	cfg  JWTConfig
+	jwks *jwks
+}
+
+// NewJWT создаёт проверку JWT. Набор ключей prev переиспользуется,
+// если адрес JWKS не изменился (nil — загрузить заново).
+func NewJWT(cfg JWTConfig, prev *JWT) *JWT {
+	j := &JWT{cfg: cfg}
+	if cfg.JWKSURL != "" {
+		if prev != nil && prev.jwks != nil && prev.jwks.url == cfg.JWKSURL {
+			j.jwks = prev.jwks
+		} else {
+			j.jwks = newJWKS(cfg.JWKSURL)
+		}
+	}
+	return j
+}
+
+// Authenticate проверяет JWT; токены другого вида остаются следующим способам
+func (j *JWT) Authenticate(r *http.Request) (Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return Principal{}, ErrNoCredentials
+	}
+	p, err := j.cfg.verify(r.Context(), token, j.jwks)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return p, nil
+}
+
+// verify проверяет подпись и утверждения JWT
+func (c *JWTConfig) verify(ctx context.Context, token string, keys *jwks) (Principal, error) {
+	parts := strings.Split(token, ".")
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, fmt.Errorf("заголовок: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, errors.New("подпись не в base64url")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	// Алгоритм определяется источником ключа: токен, подписанный открытым
+	// ключом как секретом HMAC, не пройдёт проверку
+	if strings.HasPrefix(header.Alg, "HS") {
+		if c.Secret == "" {
+			return Principal{}, fmt.Errorf("алгоритм %s не принимается", header.Alg)
+		}
+		if err := verifyHMAC(header.Alg, c.Secret, signed, signature); err != nil {
+			return Principal{}, err
+		}
+	} else {
+		if keys == nil {
+			return Principal{}, fmt.Errorf("алгоритм %s не принимается", header.Alg)
+		}
+		key, err := keys.key(ctx, header.Kid)
+		if err != nil {
+			return Principal{}, err
+		}
+		if err := verifyKey(header.Alg, key, signed, signature); err != nil {
+			return Principal{}, err
+		}
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, fmt.Errorf("утверждения: %w", err)
+	}
+	now := time.Now()
+	switch {
+	case claims.Exp == nil:
+		return Principal{}, errors.New("у токена нет срока действия exp")
+	case now.After(time.Unix(*claims.Exp, 0).Add(clockSkew)):
+		return Principal{}, errors.New("срок действия токена истёк")
+	case claims.Nbf != nil && now.Add(clockSkew).Before(time.Unix(*claims.Nbf, 0)):
+		return Principal{}, errors.New("токен ещё не действует")
+	case c.Issuer != "" && claims.Iss != c.Issuer:
+		return Principal{}, errors.New("токен выпущен другим издателем")
+	case c.Audience != "" && !slices.Contains(claims.Aud, c.Audience):
+		return Principal{}, errors.New("токен выпущен для другого получателя")
+	case claims.Sub == "":
+		return Principal{}, errors.New("у токена нет subject")
+	case slices.Contains(c.RevokedSubjects, claims.Sub):
+		return Principal{}, errors.New("доступ клиента отозван")
+	}
+	scopes := append(strings.Fields(claims.Scope), claims.Scp...)
+	return Principal{Name: claims.Sub, Scopes: scopes}, nil
+}
+
+// decodeSegment разбирает часть JWT в формате base64url JSON
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("не base64url")
+	}
+	return json.Unmarshal(b, v)
+}
+
+// hashes хеши алгоритмов подписи по длине: 256, 384 и 512
+var hashes = map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+
+// curveBits размеры кривых ES256, ES384 и ES512
+var curveBits = map[string]int{"256": 256, "384": 384, "512": 521}
+
+// verifyHMAC проверяет подпись HS256, HS384 или HS512
+func verifyHMAC(alg, secret string, signed, signature []byte) error {
+	var h func() hash.Hash
+	switch alg {
+	case "HS256":
+		h = sha256.New
+	case "HS384":
+		h = sha512.New384
+	case "HS512":
+		h = sha512.New
+	default:
+		return fmt.Errorf("алгоритм %s не поддерживается", alg)
+	}
+	m := hmac.New(h, []byte(secret))
+	m.Write(signed)
+	if !hmac.Equal(m.Sum(nil), signature) {
+		return errors.New("неверная подпись")
+	}
+	return nil
+}
+
+// verifyKey проверяет подпись открытым ключом из JWKS. Алгоритм должен
+// соответствовать типу ключа.
+func verifyKey(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	bad := errors.New("неверная подпись")
+	if alg == "EdDSA" {
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("ключ не подходит для алгоритма %s", alg)
+		}
+		if !ed25519.Verify(k, signed, signature) {
+			return bad
+		}
+		return nil
+	}
+	if len(alg) != 5 {
+		return fmt.Errorf("алгоритм %s не поддерживается", alg)
+	}
+	h, ok := hashes[alg[2:]]
+	if !ok {
+		return fmt.Errorf("алгоритм %s не поддерживается", alg)
+	}
+	hw := h.New()
+	hw.Write(signed)
+	digest := hw.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("ключ не подходит для алгоритма %s", alg)
+		}
+		if rsa.VerifyPKCS1v15(k, h, digest, signature) != nil {
+			return bad
+		}
+	case "ES":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || k.Curve.Params().BitSize != curveBits[alg[2:]] {
+			return fmt.Errorf("ключ не подходит для алгоритма %s", alg)
+		}
+		// Подпись ES — r и s фиксированной длины подряд
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return bad
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return bad
+		}
+	default:
+		return fmt.Errorf("алгоритм %s не поддерживается", alg)
+	}
+	return nil
+}
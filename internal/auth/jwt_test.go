@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123"
+
+// signJWT собирает токен из заголовка и утверждений; sign подписывает
+// «заголовок.утверждения»
+func signJWT(t *testing.T, header, claims map[string]any, sign func(signed []byte) []byte) string {
+	t.Helper()
+	segment := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := segment(header) + "." + segment(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hs256(secret string) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func TestJWTVerifyHMAC(t *testing.T) {
+	now := time.Now().Unix()
+	claims := func(edit func(c map[string]any)) map[string]any {
+		c := map[string]any{"sub": "agent-1", "exp": now + 60, "iss": "idp", "aud": "metrics", "scope": "write read"}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	cfg := JWTConfig{Secret: testSecret, Issuer: "idp", Audience: "metrics", RevokedSubjects: []string{"agent-old"}}
+	tests := []struct {
+		name       string
+		cfg        JWTConfig
+		alg        string
+		claims     map[string]any
+		sign       func([]byte) []byte
+		wantScopes []string
+		wantErr    bool
+	}{
+		{name: "верный токен", cfg: cfg, claims: claims(nil), wantScopes: []string{"write", "read"}},
+		{name: "права списком scp", cfg: cfg, claims: claims(func(c map[string]any) {
+			delete(c, "scope")
+			c["scp"] = []string{"admin"}
+		}), wantScopes: []string{"admin"}},
+		{name: "получатель в списке", cfg: cfg, claims: claims(func(c map[string]any) { c["aud"] = []string{"other", "metrics"} }),
+			wantScopes: []string{"write", "read"}},
+		{name: "истёк в пределах расхождения часов", cfg: cfg, claims: claims(func(c map[string]any) { c["exp"] = now - 30 }),
+			wantScopes: []string{"write", "read"}},
+		{name: "чужой секрет", cfg: cfg, claims: claims(nil), sign: hs256("another-secret-0123"), wantErr: true},
+		{name: "HS384 подписан как HS256", cfg: cfg, alg: "HS384", claims: claims(nil), wantErr: true},
+		{name: "истёк", cfg: cfg, claims: claims(func(c map[string]any) { c["exp"] = now - 120 }), wantErr: true},
+		{name: "без exp", cfg: cfg, claims: claims(func(c map[string]any) { delete(c, "exp") }), wantErr: true},
+		{name: "ещё не действует", cfg: cfg, claims: claims(func(c map[string]any) { c["nbf"] = now + 600 }), wantErr: true},
+		{name: "другой издатель", cfg: cfg, claims: claims(func(c map[string]any) { c["iss"] = "evil" }), wantErr: true},
+		{name: "другой получатель", cfg: cfg, claims: claims(func(c map[string]any) { c["aud"] = "billing" }), wantErr: true},
+		{name: "без sub", cfg: cfg, claims: claims(func(c map[string]any) { delete(c, "sub") }), wantErr: true},
+		{name: "отозванный клиент", cfg: cfg, claims: claims(func(c map[string]any) { c["sub"] = "agent-old" }), wantErr: true},
+		{name: "HMAC без секрета", cfg: JWTConfig{}, claims: claims(nil), wantErr: true},
+		{name: "алгоритм none", cfg: cfg, alg: "none", claims: claims(nil), sign: func([]byte) []byte { return nil }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alg, sign := tt.alg, tt.sign
+			if alg == "" {
+				alg = "HS256"
+			}
+			if sign == nil {
+				sign = hs256(testSecret)
+			}
+			token := signJWT(t, map[string]any{"alg": alg, "typ": "JWT"}, tt.claims, sign)
+			p, err := tt.cfg.verify(context.Background(), token, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verify() = %v, ожидалась ошибка: %t", err, tt.wantErr)
+			}
+			if err == nil && (p.Name != "agent-1" || !slices.Equal(p.Scopes, tt.wantScopes)) {
+				t.Errorf("клиент %+v, ожидались права %v", p, tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestJWTVerifyJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	keys := []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)},
+		// Ключ шифрования не используется для подписи
+		{"kty": "OKP", "kid": "enc", "use": "enc", "crv": "Ed25519", "x": b64(edPub)},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer srv.Close()
+
+	rs256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	es256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	eddsa := func(signed []byte) []byte { return ed25519.Sign(edKey, signed) }
+
+	claims := map[string]any{"sub": "agent-1", "exp": time.Now().Add(time.Hour).Unix()}
+	tests := []struct {
+		name    string
+		alg     string
+		kid     string
+		sign    func([]byte) []byte
+		wantErr bool
+	}{
+		{name: "RS256", alg: "RS256", kid: "rsa", sign: rs256},
+		{name: "ES256", alg: "ES256", kid: "ec", sign: es256},
+		{name: "EdDSA", alg: "EdDSA", kid: "ed", sign: eddsa},
+		{name: "алгоритм не для ключа", alg: "ES256", kid: "rsa", sign: rs256, wantErr: true},
+		{name: "неизвестный kid", alg: "RS256", kid: "missing", sign: rs256, wantErr: true},
+		{name: "ключ шифрования", alg: "EdDSA", kid: "enc", sign: eddsa, wantErr: true},
+		// Открытый ключ в роли секрета HMAC не принимается
+		{name: "подмена алгоритма", alg: "HS256", kid: "rsa", sign: hs256(string(rsaKey.N.Bytes())), wantErr: true},
+		{name: "повреждённая подпись", alg: "EdDSA", kid: "ed", sign: func(signed []byte) []byte {
+			sig := eddsa(signed)
+			sig[0] ^= 1
+			return sig
+		}, wantErr: true},
+	}
+	j := NewJWT(JWTConfig{JWKSURL: srv.URL}, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signJWT(t, map[string]any{"alg": tt.alg, "kid": tt.kid}, claims, tt.sign)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			p, err := j.Authenticate(r)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("Authenticate() = %v, ожидалась %v", err, ErrInvalidCredentials)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate(): %v", err)
+			}
+			if p.Name != "agent-1" {
+				t.Errorf("клиент %q, ожидался agent-1", p.Name)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticateNotJWT(t *testing.T) {
+	j := NewJWT(JWTConfig{Secret: testSecret}, nil)
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "без заголовка"},
+		{name: "не Bearer", header: "Basic dXNlcjpwYXNz"},
+		{name: "постоянный токен", header: "Bearer static-token-0123456789"},
+		{name: "пустой токен", header: "Bearer "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if _, err := j.Authenticate(r); !errors.Is(err, ErrNoCredentials) {
+				t.Errorf("Authenticate() = %v, ожидалась %v", err, ErrNoCredentials)
+			}
+		})
+	}
+}
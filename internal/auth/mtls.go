@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// MTLSConfig клиенты, допущенные по сертификату. Сертификат проверяется
+// сервером по удостоверяющему центру -tls-client-ca; здесь задаётся, какие
+// права даёт имя из него.
+type MTLSConfig struct {
+	Clients []MTLSClient `json:"clients"`
+}
+
+// MTLSClient клиент с сертификатом
+type MTLSClient struct {
+	// Name имя в сертификате: CommonName, DNS-имя, адрес почты или URI
+	// из SubjectAltName (например, spiffe://example.org/agent)
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// validate проверяет клиентов mTLS
+func (c *MTLSConfig) validate() error {
+	if len(c.Clients) == 0 {
+		return errors.New("auth: mtls: не задан ни один клиент")
+	}
+	names := make(map[string]bool)
+	for i, cl := range c.Clients {
+		switch {
+		case cl.Name == "":
+			return fmt.Errorf("auth: mtls: клиент №%d: не задано имя", i+1)
+		case names[cl.Name]:
+			return fmt.Errorf("auth: mtls: клиент %s задан дважды", cl.Name)
+		}
+		names[cl.Name] = true
+		if err := validateScopes("клиента "+cl.Name, cl.Scopes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MTLS проверка по сертификату клиента, подтверждённому при установке TLS
+type MTLS struct {
+	clients map[string][]string
+}
+
+// NewMTLS создаёт проверку по сертификатам
+func NewMTLS(cfg MTLSConfig) *MTLS {
+	m := &MTLS{clients: make(map[string][]string, len(cfg.Clients))}
+	for _, c := range cfg.Clients {
+		m.clients[c.Name] = c.Scopes
+	}
+	return m
+}
+
+// Authenticate находит клиента по именам в его сертификате
+func (m *MTLS) Authenticate(r *http.Request) (Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return Principal{}, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	for _, name := range certNames(cert) {
+		if scopes, ok := m.clients[name]; ok {
+			return Principal{Name: name, Scopes: scopes}, nil
+		}
+	}
+	return Principal{}, fmt.Errorf("%w: сертификат %q не допущен", ErrInvalidCredentials, cert.Subject.CommonName)
+}
+
+// certNames имена клиента в сертификате
+func certNames(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	return names
+}
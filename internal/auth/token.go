@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Token постоянный токен клиента
+type Token struct {
+	// Name имя клиента в журнале аудита
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	// Scopes права токена
+	Scopes []string `json:"scopes"`
+}
+
+// minTokenLength длина постоянного токена, короче которой он легко подбирается
+const minTokenLength = 16
+
+// validateTokens проверяет постоянные токены
+func validateTokens(tokens []Token) error {
+	names := make(map[string]bool)
+	for i, t := range tokens {
+		switch {
+		case t.Name == "":
+			return fmt.Errorf("auth: токен №%d: не задано имя", i+1)
+		case names[t.Name]:
+			return fmt.Errorf("auth: токен %s задан дважды", t.Name)
+		case len(t.Token) < minTokenLength:
+			return fmt.Errorf("auth: токен %s короче %d символов", t.Name, minTokenLength)
+		}
+		names[t.Name] = true
+		if err := validateScopes("токена "+t.Name, t.Scopes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bearerToken возвращает токен из заголовка Authorization: Bearer
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// StaticTokens проверка постоянными токенами. Незнакомый токен остаётся
+// следующим способам: он может оказаться JWT или токеном единого входа.
+type StaticTokens []Token
+
+// Authenticate находит клиента по токену
+func (s StaticTokens) Authenticate(r *http.Request) (Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return Principal{}, ErrNoCredentials
+	}
+	for _, t := range s {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return Principal{Name: t.Name, Scopes: t.Scopes}, nil
+		}
+	}
+	return Principal{}, ErrNoCredentials
+}
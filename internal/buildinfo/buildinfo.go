@@ -0,0 +1,67 @@
+// Package buildinfo описывает сборку сервера и агента: версию, дату
+// и коммит, которые задаются при сборке флагами компоновщика:
+//
+//	go build -ldflags "-X main.buildVersion=v1.2.3 -X main.buildDate=$(date -u +%FT%TZ) -X main.buildCommit=$(git rev-parse --short HEAD)"
+package buildinfo
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// NA значение, не заданное при сборке
+const NA = "N/A"
+
+// Info сведения о сборке
+type Info struct {
+	Version string `json:"version"`
+	Date    string `json:"date"`
+	Commit  string `json:"commit"`
+	// GoVersion версия Go, которой собрана программа
+	GoVersion string `json:"go_version"`
+}
+
+// New собирает сведения о сборке. Незаданные дата и коммит берутся
+// из сведений системы контроля версий, которые go build записывает сам,
+// а остальные незаданные значения становятся N/A.
+func New(version, date, commit string) Info {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && commit == "":
+				commit = s.Value
+			case s.Key == "vcs.time" && date == "":
+				date = s.Value
+			}
+		}
+	}
+	return Info{Version: orNA(version), Date: orNA(date), Commit: orNA(commit), GoVersion: runtime.Version()}
+}
+
+// orNA заменяет пустое значение на N/A
+func orNA(v string) string {
+	if v == "" {
+		return NA
+	}
+	return v
+}
+
+// Log выводит сведения о сборке в журнал
+func (i Info) Log() {
+	log.Printf("Версия сборки: %s", i.Version)
+	log.Printf("Дата сборки: %s", i.Date)
+	log.Printf("Коммит сборки: %s", i.Commit)
+}
+
+// Handler обработчик GET /version: сведения о сборке в JSON
+func (i Info) Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(i)
+}
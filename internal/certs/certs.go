@@ -0,0 +1,163 @@
+// Package certs загружает сертификаты TLS сервера, при необходимости
+// выпускает самоподписанный сертификат, и настраивает проверку
+// сертификата сервера на стороне агента, а при mTLS — сертификат агента.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// validity срок действия самоподписанного сертификата
+const validity = 365 * 24 * time.Hour
+
+// SelfSigned выпускает самоподписанный сертификат ECDSA P-256 для имён
+// и адресов hosts и возвращает его вместе с сертификатом и ключом в PEM
+func SelfSigned(hosts []string) (cert tls.Certificate, certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"metrics-service"}, CommonName: hosts[0]},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		// Сертификат сам себе удостоверяющий центр: агент может доверять ему напрямую
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	return
+}
+
+// DefaultHosts имена, на которые выпускается самоподписанный сертификат:
+// localhost, адреса петли и имя хоста
+func DefaultHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil && name != "" && name != "localhost" {
+		hosts = append(hosts, name)
+	}
+	return hosts
+}
+
+// Load загружает сертификат сервера из файлов certFile и keyFile.
+// Если оба файла не существуют, выпускает самоподписанный сертификат
+// и сохраняет его в них, чтобы агентам можно было передать certFile.
+// Без путей сертификат выпускается только в памяти.
+// generated сообщает, что сертификат выпущен при этом вызове.
+func Load(certFile, keyFile string) (cert tls.Certificate, generated bool, err error) {
+	if (certFile == "") != (keyFile == "") {
+		return cert, false, errors.New("файлы сертификата и ключа задаются вместе")
+	}
+	if certFile != "" && (exists(certFile) || exists(keyFile)) {
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+		return cert, false, err
+	}
+
+	cert, certPEM, keyPEM, err := SelfSigned(DefaultHosts())
+	if err != nil || certFile == "" {
+		return cert, err == nil, err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return cert, true, err
+	}
+	return cert, true, os.WriteFile(certFile, certPEM, 0o644)
+}
+
+// exists проверяет, существует ли файл path
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Fingerprint возвращает отпечаток SHA-256 сертификата для сверки вручную
+func Fingerprint(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientConfig возвращает настройки TLS клиента, доверяющего сертификатам
+// из файла caFile в формате PEM в дополнение к системным.
+// Пустой caFile — только системные сертификаты. Если заданы certFile
+// и keyFile, клиент предъявляет этот сертификат серверу, проверяющему
+// клиентов по mTLS.
+func ClientConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("в файле " + caFile + " нет сертификатов PEM")
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+// Pool загружает сертификаты удостоверяющих центров из файла в формате
+// PEM, например для проверки сертификатов клиентов
+func Pool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("в файле " + caFile + " нет сертификатов PEM")
+	}
+	return pool, nil
+}
@@ -0,0 +1,463 @@
+// Package collectd принимает метрики по двоичному сетевому протоколу
+// collectd (плагин network) через UDP, в том числе подписанные
+// и зашифрованные пакеты.
+//
+// Значение записывается в метрику <plugin>_<type>[_<ds>] (<plugin>[_<ds>],
+// если имена плагина и типа совпадают) с метками host, plugin_instance
+// и type_instance: например, load_shortterm{host=web1}
+// или interface_if_octets_rx{host=web1,plugin_instance=eth0}. GAUGE становится gauge,
+// DERIVE и COUNTER — counter, который растёт на разницу соседних значений,
+// ABSOLUTE — counter, к которому значение прибавляется.
+package collectd
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/internal/namepolicy"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// maxPacketSize максимальный размер UDP-пакета
+const maxPacketSize = 65535
+
+// Уровни защиты
+const (
+	// SecurityNone принимает все пакеты; подписи проверяются, если пользователь известен
+	SecurityNone = "none"
+	// SecuritySign принимает только подписанные или зашифрованные пакеты
+	SecuritySign = "sign"
+	// SecurityEncrypt принимает только зашифрованные пакеты
+	SecurityEncrypt = "encrypt"
+)
+
+// Типы частей пакета
+const (
+	partHost           = 0x0000
+	partPlugin         = 0x0002
+	partPluginInstance = 0x0003
+	partType           = 0x0004
+	partTypeInstance   = 0x0005
+	partValues         = 0x0006
+	partSignature      = 0x0200
+	partEncryption     = 0x0210
+)
+
+// Типы значений
+const (
+	dsCounter  = 0
+	dsGauge    = 1
+	dsDerive   = 2
+	dsAbsolute = 3
+)
+
+// builtinTypes имена значений распространённых типов с несколькими
+// значениями из types.db collectd
+var builtinTypes = map[string][]string{
+	"load":           {"shortterm", "midterm", "longterm"},
+	"if_octets":      {"rx", "tx"},
+	"if_packets":     {"rx", "tx"},
+	"if_errors":      {"rx", "tx"},
+	"if_dropped":     {"rx", "tx"},
+	"disk_octets":    {"read", "write"},
+	"disk_ops":       {"read", "write"},
+	"disk_time":      {"read", "write"},
+	"disk_merged":    {"read", "write"},
+	"disk_io_time":   {"io_time", "weighted_io_time"},
+	"ps_cputime":     {"user", "syst"},
+	"ps_count":       {"processes", "threads"},
+	"ps_pagefaults":  {"minflt", "majflt"},
+	"ps_disk_octets": {"read", "write"},
+	"ps_disk_ops":    {"read", "write"},
+	"io_octets":      {"rx", "tx"},
+	"io_packets":     {"rx", "tx"},
+}
+
+// Config настройки приёма
+type Config struct {
+	// SecurityLevel уровень защиты: none (по умолчанию), sign или encrypt
+	SecurityLevel string `json:"security_level"`
+	// AuthFile файл пользователей collectd: строки "пользователь: пароль"
+	AuthFile string `json:"auth_file"`
+	// TypesDB файлы types.db с именами значений типов; без них имена
+	// берутся из встроенного списка, а иначе значения нумеруются
+	TypesDB []string `json:"types_db"`
+}
+
+// Storage хранилище, в которое записываются принятые метрики
+type Storage interface {
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+	GetCounter(ctx context.Context, name string) (int64, error)
+}
+
+// Listener принимает пакеты collectd и сохраняет значения в хранилище
+type Listener struct {
+	addr    string
+	storage Storage
+	policy  *namepolicy.Policy
+	level   string
+	users   map[string]string
+	types   map[string][]string
+
+	mu sync.Mutex
+	// last последние значения накопительных рядов для подсчёта приращений
+	last map[string]uint64
+}
+
+// NewListener создаёт приёмник на UDP-адресе addr. Имена метрик
+// проверяются правилами policy, как и в HTTP API.
+func NewListener(addr string, storage Storage, policy *namepolicy.Policy, cfg Config) (*Listener, error) {
+	l := &Listener{
+		addr:    addr,
+		storage: storage,
+		policy:  policy,
+		level:   cfg.SecurityLevel,
+		users:   make(map[string]string),
+		types:   make(map[string][]string),
+		last:    make(map[string]uint64),
+	}
+	switch l.level {
+	case "":
+		l.level = SecurityNone
+	case SecurityNone, SecuritySign, SecurityEncrypt:
+	default:
+		return nil, fmt.Errorf("неверный уровень защиты %q: none, sign или encrypt", cfg.SecurityLevel)
+	}
+	if cfg.AuthFile != "" {
+		if err := readPairs(cfg.AuthFile, ':', func(user, password string) { l.users[user] = password }); err != nil {
+			return nil, err
+		}
+	} else if l.level != SecurityNone {
+		return nil, errors.New("для подписи и шифрования нужен файл пользователей auth_file")
+	}
+	for k, v := range builtinTypes {
+		l.types[k] = v
+	}
+	for _, path := range cfg.TypesDB {
+		if err := readPairs(path, 0, l.addType); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// readPairs читает из файла path строки "ключ<sep> значение" без пустых
+// строк и комментариев; при sep, равном 0, ключ отделяется пробелом
+func readPairs(path string, sep byte, fn func(k, v string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var k, v string
+		var ok bool
+		if sep == 0 {
+			k, v, ok = strings.Cut(strings.ReplaceAll(line, "\t", " "), " ")
+		} else {
+			k, v, ok = strings.Cut(line, string(sep))
+		}
+		if !ok {
+			return fmt.Errorf("%s: неверная строка %q", path, line)
+		}
+		fn(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	return sc.Err()
+}
+
+// addType запоминает имена значений типа из строки types.db вида
+// "if_octets rx:DERIVE:0:U, tx:DERIVE:0:U"
+func (l *Listener) addType(name, spec string) {
+	var ds []string
+	for _, f := range strings.Split(spec, ",") {
+		dsName, _, _ := strings.Cut(strings.TrimSpace(f), ":")
+		ds = append(ds, dsName)
+	}
+	l.types[name] = ds
+}
+
+// Run принимает пакеты до отмены контекста
+func (l *Listener) Run(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", l.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("Ошибка чтения collectd: %v", err)
+			continue
+		}
+		if err := l.Apply(ctx, buf[:n]); err != nil {
+			log.Printf("Пропущен пакет collectd от %s: %v", from, err)
+		}
+	}
+}
+
+// state значения частей, действующие до следующей части того же типа
+type state struct {
+	host, plugin, pluginInstance, typ, typeInstance string
+}
+
+// Apply разбирает пакет и сохраняет его значения
+func (l *Listener) Apply(ctx context.Context, packet []byte) error {
+	return l.parse(ctx, packet, &state{}, false, false)
+}
+
+// parse разбирает части пакета. signed и encrypted сообщают, что
+// остаток пакета уже проверен подписью или расшифрован.
+func (l *Listener) parse(ctx context.Context, b []byte, st *state, signed, encrypted bool) error {
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return errors.New("оборванный заголовок части")
+		}
+		typ := binary.BigEndian.Uint16(b)
+		size := int(binary.BigEndian.Uint16(b[2:]))
+		if size < 4 || size > len(b) {
+			return errors.New("неверная длина части")
+		}
+		body := b[4:size]
+
+		switch typ {
+		case partSignature:
+			// Подпись покрывает всё, что идёт после неё
+			return l.verify(ctx, body, b[size:], st, encrypted)
+		case partEncryption:
+			plain, err := l.decrypt(body)
+			if err != nil {
+				return err
+			}
+			if err := l.parse(ctx, plain, st, true, true); err != nil {
+				return err
+			}
+			b = b[size:]
+			continue
+		}
+
+		if l.level == SecurityEncrypt && !encrypted || l.level == SecuritySign && !signed {
+			return fmt.Errorf("пакет без защиты отклонён: уровень защиты %s", l.level)
+		}
+		switch typ {
+		case partHost:
+			st.host = cString(body)
+		case partPlugin:
+			st.plugin = cString(body)
+		case partPluginInstance:
+			st.pluginInstance = cString(body)
+		case partType:
+			st.typ = cString(body)
+		case partTypeInstance:
+			st.typeInstance = cString(body)
+		case partValues:
+			if err := l.values(ctx, body, st); err != nil {
+				return err
+			}
+		}
+		// Время, интервал и оповещения не используются
+		b = b[size:]
+	}
+	return nil
+}
+
+// verify проверяет подпись HMAC-SHA256 остатка пакета rest и разбирает его
+func (l *Listener) verify(ctx context.Context, body, rest []byte, st *state, encrypted bool) error {
+	if len(body) < sha256.Size {
+		return errors.New("неверная часть подписи")
+	}
+	mac, user := body[:sha256.Size], string(body[sha256.Size:])
+	password, ok := l.users[user]
+	if !ok {
+		if l.level == SecurityNone {
+			return l.parse(ctx, rest, st, false, encrypted)
+		}
+		return fmt.Errorf("неизвестный пользователь %q", user)
+	}
+	h := hmac.New(sha256.New, []byte(password))
+	h.Write([]byte(user))
+	h.Write(rest)
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return fmt.Errorf("неверная подпись пользователя %q", user)
+	}
+	return l.parse(ctx, rest, st, true, encrypted)
+}
+
+// decrypt расшифровывает часть, зашифрованную AES-256 в режиме OFB
+// ключом SHA-256 пароля, и проверяет хеш SHA-1 её содержимого
+func (l *Listener) decrypt(body []byte) ([]byte, error) {
+	if len(body) < 2 {
+		return nil, errors.New("неверная часть шифрования")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n+aes.BlockSize+sha1.Size {
+		return nil, errors.New("неверная часть шифрования")
+	}
+	user := string(body[2 : 2+n])
+	password, ok := l.users[user]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный пользователь %q", user)
+	}
+	iv := body[2+n : 2+n+aes.BlockSize]
+	data := append([]byte(nil), body[2+n+aes.BlockSize:]...)
+
+	key := sha256.Sum256([]byte(password))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewOFB(block, iv).XORKeyStream(data, data)
+	sum := sha1.Sum(data[sha1.Size:])
+	if !hmac.Equal(sum[:], data[:sha1.Size]) {
+		return nil, fmt.Errorf("не удалось расшифровать пакет пользователя %q", user)
+	}
+	return data[sha1.Size:], nil
+}
+
+// cString строка части без завершающего нулевого байта
+func cString(b []byte) string {
+	return strings.TrimRight(string(b), "\x00")
+}
+
+// values сохраняет значения части values
+func (l *Listener) values(ctx context.Context, body []byte, st *state) error {
+	if len(body) < 2 {
+		return errors.New("неверная часть значений")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) != 2+n*9 {
+		return errors.New("неверная часть значений")
+	}
+	kinds, raw := body[2:2+n], body[2+n:]
+	names := l.types[st.typ]
+
+	var errs []error
+	prefix := st.plugin + "_" + st.typ
+	if st.plugin == st.typ {
+		// load/load, memory/memory и т. п. записываются одним словом
+		prefix = st.plugin
+	}
+	for i := 0; i < n; i++ {
+		base := prefix
+		if n > 1 {
+			ds := fmt.Sprint(i)
+			if i < len(names) {
+				ds = names[i]
+			}
+			base += "_" + ds
+		}
+		set := make(map[string]string)
+		for k, v := range map[string]string{"host": st.host, "plugin_instance": st.pluginInstance, "type_instance": st.typeInstance} {
+			if v != "" {
+				set[k] = v
+			}
+		}
+		name := labels.Format(base, set)
+		if err := l.policy.Check(name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		v := raw[i*8 : i*8+8]
+		errs = append(errs, l.store(ctx, name, kinds[i], v))
+	}
+	return errors.Join(errs...)
+}
+
+// increase приращение накопительного значения от last до cur. При первом
+// значении ряда и после сброса счётчика источника приращением считается cur.
+func increase(kind byte, last, cur uint64, seen bool) (int64, error) {
+	if kind == dsDerive {
+		// DERIVE — знаковое значение
+		d := int64(cur) - int64(last)
+		if !seen || d < 0 {
+			d = int64(cur)
+		}
+		return d, nil
+	}
+	d := cur
+	if seen && cur >= last {
+		d = cur - last
+	}
+	if d > math.MaxInt64 {
+		return 0, errors.New("приращение вне диапазона int64")
+	}
+	return int64(d), nil
+}
+
+// store сохраняет одно значение
+func (l *Listener) store(ctx context.Context, name string, kind byte, v []byte) error {
+	switch kind {
+	case dsGauge:
+		// GAUGE передаётся в порядке байт x86
+		f := math.Float64frombits(binary.LittleEndian.Uint64(v))
+		if math.IsNaN(f) {
+			// NaN означает отсутствие значения
+			return nil
+		}
+		if err := models.CheckGauge(f); err != nil {
+			return err
+		}
+		return l.storage.UpdateGauge(ctx, name, f)
+	case dsAbsolute:
+		u := binary.BigEndian.Uint64(v)
+		if u > math.MaxInt64 {
+			return fmt.Errorf("%s: значение вне диапазона int64", name)
+		}
+		return l.storage.UpdateCounter(ctx, name, int64(u))
+	case dsCounter, dsDerive:
+		u := binary.BigEndian.Uint64(v)
+		l.mu.Lock()
+		last, seen := l.last[name]
+		l.last[name] = u
+		l.mu.Unlock()
+		if !seen {
+			// После перезапуска сервера продолжаем с сохранённого значения
+			cur, err := l.storage.GetCounter(ctx, name)
+			switch {
+			case err == nil:
+				last, seen = uint64(cur), true
+			case !errors.Is(err, storage.ErrNotFound):
+				return err
+			}
+		}
+		delta, err := increase(kind, last, u, seen)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if delta == 0 {
+			return nil
+		}
+		return l.storage.UpdateCounter(ctx, name, delta)
+	default:
+		return fmt.Errorf("%s: неизвестный тип значения %d", name, kind)
+	}
+}
@@ -0,0 +1,82 @@
+package collectd
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/namepolicy"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// stringPart часть пакета со строкой s
+func stringPart(typ uint16, s string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(4+len(s)+1))
+	b = append(b, s...)
+	return append(b, 0)
+}
+
+// gaugePart часть values с одним значением GAUGE
+func gaugePart(v float64) []byte {
+	b := binary.BigEndian.AppendUint16(nil, partValues)
+	b = binary.BigEndian.AppendUint16(b, 4+2+1+8)
+	b = binary.BigEndian.AppendUint16(b, 1)
+	b = append(b, dsGauge)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+func TestApplyChecksNames(t *testing.T) {
+	policy, err := namepolicy.New(namepolicy.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		host    string
+		plugin  string
+		typ     string
+		want    string
+		wantErr bool
+	}{
+		{name: "значение", host: "web1", plugin: "load", typ: "load", want: "load{host=web1}"},
+		{name: "пробел в модуле", host: "web1", plugin: "cpu load", typ: "gauge", wantErr: true},
+		{name: "перевод строки в типе", host: "web1", plugin: "cpu", typ: "x\nevent", wantErr: true},
+		{name: "разделитель арендатора", host: "web1", plugin: "A/cpu", typ: "gauge", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storage.NewMemStorage()
+			l, err := NewListener("", s, policy, Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var packet []byte
+			packet = append(packet, stringPart(partHost, tt.host)...)
+			packet = append(packet, stringPart(partPlugin, tt.plugin)...)
+			packet = append(packet, stringPart(partType, tt.typ)...)
+			packet = append(packet, gaugePart(1.5)...)
+
+			ctx := context.Background()
+			err = l.Apply(ctx, packet)
+			if tt.wantErr {
+				if !errors.Is(err, models.ErrInvalidName) {
+					t.Errorf("Apply = %v, ожидалась %v", err, models.ErrInvalidName)
+				}
+				if gauges, _, _ := s.GetAll(ctx); len(gauges) != 0 {
+					t.Errorf("записаны метрики %v", gauges)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if v, err := s.GetGauge(ctx, tt.want); err != nil || v != 1.5 {
+				t.Errorf("gauge %s = %v, %v", tt.want, v, err)
+			}
+		})
+	}
+}
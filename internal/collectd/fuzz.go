@@ -0,0 +1,36 @@
+//go:build gofuzz
+
+package collectd
+
+import (
+	"context"
+
+	"github.com/iliodor1/metrics-service/internal/namepolicy"
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// nopStorage хранилище, отбрасывающее метрики
+type nopStorage struct{}
+
+func (nopStorage) UpdateGauge(context.Context, string, float64) error { return nil }
+func (nopStorage) UpdateCounter(context.Context, string, int64) error { return nil }
+func (nopStorage) GetCounter(context.Context, string) (int64, error) {
+	return 0, storage.ErrNotFound
+}
+
+// Fuzz точка входа go-fuzz для разбора пакетов collectd:
+// go-fuzz-build ./internal/collectd && go-fuzz
+func Fuzz(data []byte) int {
+	policy, err := namepolicy.New(namepolicy.Config{})
+	if err != nil {
+		panic(err)
+	}
+	l, err := NewListener("", nopStorage{}, policy, Config{})
+	if err != nil {
+		panic(err)
+	}
+	if err := l.Apply(context.Background(), data); err != nil {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Типы команд агенту
+const (
+	// SetReportInterval изменить частоту отправки метрик
+	SetReportInterval = "set_report_interval"
+	// FullSync немедленно отправить все метрики
+	FullSync = "full_sync"
+	// Collect немедленно запустить сборщик метрик
+	Collect = "collect"
+)
+
+// Сборщики метрик агента, которые можно запустить командой Collect
+const (
+	CollectorRuntime = "runtime"
+	CollectorSystem  = "system"
+)
+
+// MinReportInterval наименьшая частота отправки, которую можно задать командой
+const MinReportInterval = time.Second
+
+const (
+	// maxPending максимальное число неполученных команд одного агента
+	maxPending = 100
+	// maxAgents наибольшее число агентов, о которых помнит очередь
+	maxAgents = 10000
+	// maxAgentID наибольшая длина идентификатора агента в байтах
+	maxAgentID = 128
+)
+
+// ErrQueueFull возвращается, когда агент давно не забирал команды
+var ErrQueueFull = errors.New("очередь команд агента переполнена")
+
+// ErrTooManyAgents возвращается, когда команды ждут уже maxAgents агентов
+var ErrTooManyAgents = errors.New("слишком много агентов с неполученными командами")
+
+// Command команда, которую сервер передаёт агенту
+type Command struct {
+	Type string `json:"type"`
+	// Interval новая частота отправки для SetReportInterval, например "5s"
+	Interval string `json:"interval,omitempty"`
+	// Collector имя сборщика для Collect
+	Collector string `json:"collector,omitempty"`
+}
+
+// Validate проверяет корректность команды
+func (c Command) Validate() error {
+	switch c.Type {
+	case SetReportInterval:
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return fmt.Errorf("неверный интервал %q: %w", c.Interval, err)
+		}
+		if d < MinReportInterval {
+			return fmt.Errorf("интервал должен быть не меньше %s", MinReportInterval)
+		}
+	case FullSync:
+	case Collect:
+		if c.Collector != CollectorRuntime && c.Collector != CollectorSystem {
+			return fmt.Errorf("неизвестный сборщик %q", c.Collector)
+		}
+	default:
+		return fmt.Errorf("неизвестная команда %q", c.Type)
+	}
+	return nil
+}
+
+// Queue очереди команд для агентов
+type Queue struct {
+	mu      sync.Mutex
+	pending map[string][]Command
+	// seen время последнего запроса команд каждым агентом
+	seen map[string]time.Time
+}
+
+// NewQueue создаёт пустые очереди команд
+func NewQueue() *Queue {
+	return &Queue{pending: make(map[string][]Command), seen: make(map[string]time.Time)}
+}
+
+// Agent агент, запрашивавший команды
+type Agent struct {
+	ID       string    `json:"id"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Agents возвращает агентов, запрашивавших команды с запуска сервера,
+// упорядоченных по идентификатору
+func (q *Queue) Agents() []Agent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	agents := make([]Agent, 0, len(q.seen))
+	for id, t := range q.seen {
+		agents = append(agents, Agent{ID: id, LastSeen: t})
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+	return agents
+}
+
+// Push ставит команду в очередь агента
+func (q *Queue) Push(agentID string, cmd Command) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.pending[agentID]; !ok && len(q.pending) >= maxAgents {
+		return ErrTooManyAgents
+	}
+	if len(q.pending[agentID]) >= maxPending {
+		return ErrQueueFull
+	}
+	q.pending[agentID] = append(q.pending[agentID], cmd)
+	return nil
+}
+
+// Pop забирает все команды агента и отмечает, что агент на связи.
+// Когда известно maxAgents агентов, новый вытесняет дольше всех молчавшего.
+func (q *Queue) Pop(agentID string) []Command {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.seen[agentID]; !ok && len(q.seen) >= maxAgents {
+		q.forgetOldest()
+	}
+	q.seen[agentID] = time.Now()
+	cmds := q.pending[agentID]
+	delete(q.pending, agentID)
+	return cmds
+}
+
+// forgetOldest забывает агента, дольше всех не запрашивавшего команды
+func (q *Queue) forgetOldest() {
+	var oldest string
+	var at time.Time
+	for id, t := range q.seen {
+		if oldest == "" || t.Before(at) {
+			oldest, at = id, t
+		}
+	}
+	delete(q.seen, oldest)
+	delete(q.pending, oldest)
+}
+
+// agentID возвращает идентификатор агента из параметра id
+func agentID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Не задан идентификатор агента.", http.StatusBadRequest)
+		return "", false
+	}
+	if len(id) > maxAgentID {
+		http.Error(w, fmt.Sprintf("Идентификатор агента длиннее %d байт.", maxAgentID), http.StatusBadRequest)
+		return "", false
+	}
+	return id, true
+}
+
+// Poll обработчик GET /agent/commands: агент забирает свои команды.
+// Идентификатор агента передаётся параметром id.
+func (q *Queue) Poll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := agentID(w, r)
+	if !ok {
+		return
+	}
+	cmds := q.Pop(id)
+	if cmds == nil {
+		cmds = []Command{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cmds)
+}
+
+// Issue обработчик POST /admin/agents/commands: ставит команду в очередь
+// агента с идентификатором из параметра id
+func (q *Queue) Issue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := agentID(w, r)
+	if !ok {
+		return
+	}
+	var cmd Command
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+		http.Error(w, "Неверный формат команды.", http.StatusBadRequest)
+		return
+	}
+	if err := cmd.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := q.Push(id, cmd); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
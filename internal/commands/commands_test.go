@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCommandValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     Command
+		wantErr bool
+	}{
+		{name: "интервал", cmd: Command{Type: SetReportInterval, Interval: "5s"}},
+		{name: "наименьший интервал", cmd: Command{Type: SetReportInterval, Interval: "1s"}},
+		{name: "интервал меньше наименьшего", cmd: Command{Type: SetReportInterval, Interval: "1ns"}, wantErr: true},
+		{name: "нулевой интервал", cmd: Command{Type: SetReportInterval, Interval: "0s"}, wantErr: true},
+		{name: "отрицательный интервал", cmd: Command{Type: SetReportInterval, Interval: "-5s"}, wantErr: true},
+		{name: "неверный интервал", cmd: Command{Type: SetReportInterval, Interval: "often"}, wantErr: true},
+		{name: "полная отправка", cmd: Command{Type: FullSync}},
+		{name: "сборщик", cmd: Command{Type: Collect, Collector: CollectorSystem}},
+		{name: "неизвестный сборщик", cmd: Command{Type: Collect, Collector: "disk"}, wantErr: true},
+		{name: "неизвестная команда", cmd: Command{Type: "reboot"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cmd.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, ожидалась ошибка: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	q := NewQueue()
+	for i := 0; i < maxAgents; i++ {
+		if err := q.Push("agent"+strconv.Itoa(i), Command{Type: FullSync}); err != nil {
+			t.Fatalf("Push агенту %d: %v", i, err)
+		}
+	}
+	if err := q.Push("extra", Command{Type: FullSync}); !errors.Is(err, ErrTooManyAgents) {
+		t.Errorf("Push новому агенту = %v, ожидалась %v", err, ErrTooManyAgents)
+	}
+	if err := q.Push("agent0", Command{Type: FullSync}); err != nil {
+		t.Errorf("Push известному агенту: %v", err)
+	}
+
+	for i := 1; i < maxPending; i++ {
+		q.Push("agent1", Command{Type: FullSync})
+	}
+	if err := q.Push("agent1", Command{Type: FullSync}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Push в полную очередь = %v, ожидалась %v", err, ErrQueueFull)
+	}
+}
+
+func TestQueueForgetsOldestAgent(t *testing.T) {
+	q := NewQueue()
+	for i := 0; i < maxAgents; i++ {
+		q.Pop("agent" + strconv.Itoa(i))
+	}
+	q.Pop("new")
+	agents := q.Agents()
+	if len(agents) != maxAgents {
+		t.Fatalf("агентов %d, ожидалось %d", len(agents), maxAgents)
+	}
+	for _, a := range agents {
+		if a.ID == "agent0" {
+			t.Error("дольше всех молчавший агент не вытеснен")
+		}
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(q *Queue) http.HandlerFunc
+		method  string
+		target  string
+		body    string
+		want    int
+	}{
+		{name: "команда", handler: issue, method: http.MethodPost, target: "/?id=a", body: `{"type":"full_sync"}`, want: http.StatusAccepted},
+		{name: "слишком частая отправка", handler: issue, method: http.MethodPost, target: "/?id=a", body: `{"type":"set_report_interval","interval":"1ns"}`, want: http.StatusBadRequest},
+		{name: "неверное тело", handler: issue, method: http.MethodPost, target: "/?id=a", body: `{`, want: http.StatusBadRequest},
+		{name: "команда без агента", handler: issue, method: http.MethodPost, target: "/", body: `{"type":"full_sync"}`, want: http.StatusBadRequest},
+		{name: "команда методом GET", handler: issue, method: http.MethodGet, target: "/?id=a", want: http.StatusMethodNotAllowed},
+		{name: "запрос команд", handler: poll, method: http.MethodGet, target: "/?id=a", want: http.StatusOK},
+		{name: "длинный идентификатор", handler: poll, method: http.MethodGet, target: "/?id=" + strings.Repeat("a", maxAgentID+1), want: http.StatusBadRequest},
+		{name: "запрос команд методом POST", handler: poll, method: http.MethodPost, target: "/?id=a", want: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(NewQueue())(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("код %d, ожидался %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func issue(q *Queue) http.HandlerFunc { return q.Issue }
+
+func poll(q *Queue) http.HandlerFunc { return q.Poll }
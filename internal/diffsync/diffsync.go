@@ -0,0 +1,297 @@
+// Package diffsync сравнивает метрики двух серверов и переносит различия.
+//
+// Имена метрик раскладываются по корзинам хеша, и для каждой корзины
+// считается сумма хешей её метрик вместе со значениями. Серверы сначала
+// обмениваются суммами корзин, а затем передают только метрики корзин,
+// суммы которых не совпали, поэтому после небольшого расхождения
+// передаётся лишь малая часть данных.
+package diffsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Число корзин по умолчанию и наибольшее допустимое
+const (
+	DefaultBuckets = 256
+	MaxBuckets     = 1 << 16
+)
+
+// Направления синхронизации
+const (
+	// Pull переносит значения с удалённого сервера на локальный
+	Pull = "pull"
+	// Push переносит значения с локального сервера на удалённый
+	Push = "push"
+)
+
+// ErrDirection неизвестное направление синхронизации
+var ErrDirection = errors.New("направление синхронизации: pull или push")
+
+// Digest суммы хешей метрик по корзинам
+type Digest struct {
+	Buckets int      `json:"buckets"`
+	Hashes  []uint64 `json:"hashes"`
+}
+
+// bucket возвращает корзину метрики name
+func bucket(name string, buckets int) int {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int(h.Sum64() % uint64(buckets))
+}
+
+// metricHash хеш метрики вместе с её типом и значением
+func metricHash(mType, name string, bits uint64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(mType))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], bits)
+	h.Write(b[:])
+	return h.Sum64()
+}
+
+// NewDigest считает суммы корзин для метрик хранилища s
+func NewDigest(ctx context.Context, s storage.Storage, buckets int) (Digest, error) {
+	d := Digest{Buckets: buckets, Hashes: make([]uint64, buckets)}
+	gauges, counters, err := s.GetAll(ctx)
+	if err != nil {
+		return d, err
+	}
+	for name, v := range gauges {
+		d.Hashes[bucket(name, buckets)] += metricHash(models.Gauge, name, math.Float64bits(v))
+	}
+	for name, v := range counters {
+		d.Hashes[bucket(name, buckets)] += metricHash(models.Counter, name, uint64(v))
+	}
+	return d, nil
+}
+
+// Select возвращает метрики хранилища s из корзин want
+func Select(ctx context.Context, s storage.Storage, buckets int, want []int) ([]models.Metrics, error) {
+	wanted := make(map[int]bool, len(want))
+	for _, b := range want {
+		wanted[b] = true
+	}
+	gauges, counters, err := s.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics := []models.Metrics{}
+	for name, v := range gauges {
+		if wanted[bucket(name, buckets)] {
+			metrics = append(metrics, models.NewGauge(name, v))
+		}
+	}
+	for name, v := range counters {
+		if wanted[bucket(name, buckets)] {
+			metrics = append(metrics, models.NewCounter(name, v))
+		}
+	}
+	return metrics, nil
+}
+
+// Report итог сравнения и синхронизации
+type Report struct {
+	Direction string `json:"direction"`
+	DryRun    bool   `json:"dry_run"`
+	// Buckets число корзин и DifferentBuckets число несовпавших
+	Buckets          int `json:"buckets"`
+	DifferentBuckets int `json:"different_buckets"`
+	// OnlyLocal и OnlyRemote метрики, которые есть только на одном сервере
+	OnlyLocal  int `json:"only_local"`
+	OnlyRemote int `json:"only_remote"`
+	// Different метрики с разными значениями
+	Different int `json:"different"`
+	// Applied перенесённые метрики
+	Applied int `json:"applied"`
+}
+
+// Peer удалённый сервер
+type Peer struct {
+	addr  string
+	token string
+	http  *http.Client
+}
+
+// NewPeer создаёт клиента удалённого сервера addr (host:port или URL)
+// с токеном администратора token
+func NewPeer(addr, token string) *Peer {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &Peer{addr: strings.TrimRight(addr, "/"), token: token, http: &http.Client{Timeout: time.Minute}}
+}
+
+// do отправляет запрос удалённому серверу и читает ответ в out
+func (p *Peer) do(ctx context.Context, method, path string, in, out any) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.addr+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: удалённый сервер ответил %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Sync сравнивает метрики хранилища s с удалённым сервером и, если не dryRun,
+// переносит различия в направлении direction. Значения устанавливаются,
+// а не прибавляются; метрики, которых нет на источнике, не удаляются.
+func Sync(ctx context.Context, s storage.Storage, peer *Peer, direction string, buckets int, dryRun bool) (Report, error) {
+	r := Report{Direction: direction, DryRun: dryRun, Buckets: buckets}
+	if direction != Pull && direction != Push {
+		return r, ErrDirection
+	}
+
+	var remote Digest
+	if err := peer.do(ctx, http.MethodGet, "/admin/sync/digest?buckets="+strconv.Itoa(buckets), nil, &remote); err != nil {
+		return r, err
+	}
+	if remote.Buckets != buckets || len(remote.Hashes) != buckets {
+		return r, errors.New("удалённый сервер вернул суммы для другого числа корзин")
+	}
+	local, err := NewDigest(ctx, s, buckets)
+	if err != nil {
+		return r, err
+	}
+	var diff []int
+	for i := range local.Hashes {
+		if local.Hashes[i] != remote.Hashes[i] {
+			diff = append(diff, i)
+		}
+	}
+	r.DifferentBuckets = len(diff)
+	if len(diff) == 0 {
+		return r, nil
+	}
+
+	var theirs []models.Metrics
+	if err := peer.do(ctx, http.MethodPost, "/admin/sync/metrics", Request{Buckets: buckets, Select: diff}, &theirs); err != nil {
+		return r, err
+	}
+	ours, err := Select(ctx, s, buckets, diff)
+	if err != nil {
+		return r, err
+	}
+
+	ourIdx, theirIdx := index(ours), index(theirs)
+	for key, m := range ourIdx {
+		t, ok := theirIdx[key]
+		switch {
+		case !ok:
+			r.OnlyLocal++
+		case !sameValue(m, t):
+			r.Different++
+		}
+	}
+	for key := range theirIdx {
+		if _, ok := ourIdx[key]; !ok {
+			r.OnlyRemote++
+		}
+	}
+
+	// Метрики источника, которых нет на приёмнике или у которых там другое значение
+	src, dst := ourIdx, theirIdx
+	if direction == Pull {
+		src, dst = theirIdx, ourIdx
+	}
+	var changes []models.Metrics
+	for key, m := range src {
+		if old, ok := dst[key]; ok && sameValue(m, old) {
+			continue
+		}
+		changes = append(changes, m)
+	}
+	if dryRun || len(changes) == 0 {
+		return r, nil
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+
+	if direction == Push {
+		var res struct {
+			Metrics int `json:"metrics"`
+		}
+		if err := peer.do(ctx, http.MethodPost, "/admin/restore", changes, &res); err != nil {
+			return r, err
+		}
+		r.Applied = res.Metrics
+		return r, nil
+	}
+	gauges, counters := toMaps(changes)
+	n, err := storage.Restore(ctx, s, gauges, counters)
+	r.Applied = n
+	return r, err
+}
+
+// Request запрос метрик несовпавших корзин
+type Request struct {
+	Buckets int   `json:"buckets"`
+	Select  []int `json:"select"`
+}
+
+// index раскладывает метрики по типу и имени
+func index(metrics []models.Metrics) map[string]models.Metrics {
+	m := make(map[string]models.Metrics, len(metrics))
+	for _, metric := range metrics {
+		m[metric.MType+":"+metric.ID] = metric
+	}
+	return m
+}
+
+// sameValue сравнивает значения двух метрик одного типа
+func sameValue(a, b models.Metrics) bool {
+	if a.MType == models.Gauge {
+		return a.Value != nil && b.Value != nil && math.Float64bits(*a.Value) == math.Float64bits(*b.Value)
+	}
+	return a.Delta != nil && b.Delta != nil && *a.Delta == *b.Delta
+}
+
+// toMaps раскладывает метрики по типам
+func toMaps(metrics []models.Metrics) (map[string]float64, map[string]int64) {
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	for _, m := range metrics {
+		if m.MType == models.Gauge {
+			gauges[m.ID] = *m.Value
+		} else {
+			counters[m.ID] = *m.Delta
+		}
+	}
+	return gauges, counters
+}
@@ -0,0 +1,210 @@
+// Package freeze запрещает обновления метрик с заданными префиксами имён
+// на время окон заморозки, например на время закрытия финансового периода.
+// Чтение метрик во время заморозки не ограничивается.
+package freeze
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrFrozen возвращается при обновлении метрики во время заморозки
+var ErrFrozen = errors.New("обновления метрики заморожены")
+
+// Window окно заморозки
+type Window struct {
+	// Name постоянное имя окна
+	Name string `json:"name"`
+	// Prefixes префиксы имён метрик в хранилище; метрики арендаторов
+	// хранятся с префиксом арендатора
+	Prefixes []string  `json:"prefixes"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	// Reason причина заморозки для клиентов, получивших отказ
+	Reason string `json:"reason,omitempty"`
+}
+
+// Error отказ в обновлении метрики из-за окна заморозки
+type Error struct {
+	Metric string
+	Window Window
+}
+
+// Error возвращает описание отказа с временем окончания заморозки
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("обновления метрики %s заморожены до %s (окно %s)", e.Metric, e.Window.End.Format(time.RFC3339), e.Window.Name)
+	if e.Window.Reason != "" {
+		msg += ": " + e.Window.Reason
+	}
+	return msg
+}
+
+// Is сообщает, что отказ — это ErrFrozen
+func (e *Error) Is(target error) bool {
+	return target == ErrFrozen
+}
+
+// validate проверяет окно
+func (w Window) validate() error {
+	if w.Name == "" {
+		return errors.New("не задано имя окна")
+	}
+	if len(w.Prefixes) == 0 {
+		return errors.New("не заданы префиксы метрик")
+	}
+	for _, p := range w.Prefixes {
+		if p == "" {
+			return errors.New("пустой префикс заморозил бы все метрики: перечислите префиксы")
+		}
+	}
+	if w.Start.IsZero() || w.End.IsZero() {
+		return errors.New("не заданы начало и конец окна")
+	}
+	if !w.End.After(w.Start) {
+		return errors.New("конец окна должен быть позже начала")
+	}
+	return nil
+}
+
+// active сообщает, действует ли окно в момент now
+func (w Window) active(now time.Time) bool {
+	return !now.Before(w.Start) && now.Before(w.End)
+}
+
+// matches сообщает, попадает ли метрика name под окно
+func (w Window) matches(name string) bool {
+	for _, p := range w.Prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Status окно заморозки с признаком действия в ответе API
+type Status struct {
+	Window
+	Active bool `json:"active"`
+}
+
+// Registry окна заморозки
+type Registry struct {
+	mu      sync.RWMutex
+	windows map[string]Window
+	now     func() time.Time
+}
+
+// New создаёт реестр с окнами windows, например из файла конфигурации
+func New(windows []Window) (*Registry, error) {
+	r := &Registry{windows: make(map[string]Window), now: time.Now}
+	for _, w := range windows {
+		if err := r.Put(w); err != nil {
+			return nil, fmt.Errorf("окно %q: %w", w.Name, err)
+		}
+	}
+	return r, nil
+}
+
+// Put добавляет или заменяет окно
+func (r *Registry) Put(w Window) error {
+	if err := w.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.windows[w.Name] = w
+	return nil
+}
+
+// Delete удаляет окно и сообщает, было ли оно
+func (r *Registry) Delete(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.windows[name]
+	delete(r.windows, name)
+	return ok
+}
+
+// Windows возвращает окна, упорядоченные по началу
+func (r *Registry) Windows() []Status {
+	now := r.now()
+	r.mu.RLock()
+	list := make([]Status, 0, len(r.windows))
+	for _, w := range r.windows {
+		list = append(list, Status{Window: w, Active: w.active(now)})
+	}
+	r.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Start.Equal(list[j].Start) {
+			return list[i].Start.Before(list[j].Start)
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Definitions возвращает окна без признака действия для журнала аудита
+func (r *Registry) Definitions() []Window {
+	list := r.Windows()
+	defs := make([]Window, len(list))
+	for i, s := range list {
+		defs[i] = s.Window
+	}
+	return defs
+}
+
+// Check возвращает *Error, если обновления метрики name сейчас заморожены.
+// Из нескольких действующих окон выбирается заканчивающееся позже.
+func (r *Registry) Check(name string) error {
+	now := r.now()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var found *Window
+	for _, w := range r.windows {
+		if w.active(now) && w.matches(name) && (found == nil || w.End.After(found.End)) {
+			w := w
+			found = &w
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	return &Error{Metric: name, Window: *found}
+}
+
+// Handler обработчик административного API окон заморозки:
+// GET и POST /admin/freeze, DELETE /admin/freeze/{name}
+func (r *Registry) Handler(w http.ResponseWriter, req *http.Request) {
+	name := req.PathValue("name")
+
+	switch {
+	case req.Method == http.MethodGet && name == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Windows())
+	case req.Method == http.MethodPost && name == "":
+		var win Window
+		if err := json.NewDecoder(req.Body).Decode(&win); err != nil {
+			http.Error(w, "Неверный формат окна заморозки.", http.StatusBadRequest)
+			return
+		}
+		if err := r.Put(win); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodDelete && name != "":
+		if !r.Delete(name) {
+			http.Error(w, "Окно заморозки не найдено.", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Метод не разрешён.", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,212 @@
+// Package gctune настраивает сборщик мусора сервера под заданный бюджет памяти
+// и публикует метрики о влиянии сборки мусора на задержки.
+//
+// Вместо балласта в куче используется GOMEMLIMIT: он ограничивает рост кучи
+// сверху, а GOGC подбирается по размеру живой кучи так, чтобы при небольшом
+// наборе метрик сборки шли реже, а при приближении к бюджету — чаще.
+package gctune
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// headroom доля бюджета, до которой может вырасти куча между сборками
+	headroom = 0.7
+	// MinGCPercent и MaxGCPercent пределы подбираемого GOGC
+	MinGCPercent = 100
+	MaxGCPercent = 800
+)
+
+// Имена метрик, которые читаются из runtime/metrics
+const (
+	metricHeapLive = "/gc/heap/live:bytes"
+	metricCycles   = "/gc/cycles/total:gc-cycles"
+	metricPauses   = "/sched/pauses/total/gc:seconds"
+	metricGCCPU    = "/cpu/classes/gc/total:cpu-seconds"
+	metricTotalCPU = "/cpu/classes/total:cpu-seconds"
+)
+
+// Gauges хранилище, в которое публикуются метрики сборщика мусора
+type Gauges interface {
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+}
+
+// Tuner подстраивает GOGC под бюджет памяти и публикует метрики сборщика:
+// ServerGCPercent — текущий GOGC,
+// ServerHeapLiveBytes — живая куча после последней сборки,
+// ServerMemoryLimitBytes — бюджет памяти,
+// ServerGCCycles — число сборок (counter),
+// ServerGCPauseP99Seconds и ServerGCPauseMaxSeconds — паузы за интервал,
+// ServerGCCPUFraction — доля процессорного времени на сборку за интервал.
+type Tuner struct {
+	limit   int64
+	adapt   bool
+	percent int
+	store   Gauges
+	samples []metrics.Sample
+	prev    snapshot
+}
+
+// snapshot накопленные значения счётчиков среды выполнения
+type snapshot struct {
+	cycles   uint64
+	pauses   []uint64
+	gcCPU    float64
+	totalCPU float64
+}
+
+// New создаёт настройщик для бюджета limit байт и устанавливает GOMEMLIMIT.
+// Если GOGC задан в окружении, он не меняется.
+func New(limit int64, store Gauges) *Tuner {
+	debug.SetMemoryLimit(limit)
+	_, fixed := os.LookupEnv("GOGC")
+	gogc := []metrics.Sample{{Name: "/gc/gogc:percent"}}
+	metrics.Read(gogc)
+	t := &Tuner{
+		limit:   limit,
+		adapt:   !fixed,
+		percent: int(gogc[0].Value.Uint64()),
+		store:   store,
+		samples: []metrics.Sample{
+			{Name: metricHeapLive}, {Name: metricCycles}, {Name: metricPauses},
+			{Name: metricGCCPU}, {Name: metricTotalCPU},
+		},
+	}
+	t.prev = t.read()
+	return t
+}
+
+// Run подстраивает сборщик и публикует метрики с периодичностью interval
+func (t *Tuner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Tune(ctx); err != nil {
+				log.Printf("Не удалось опубликовать метрики сборщика мусора: %v", err)
+			}
+		}
+	}
+}
+
+// Tune пересчитывает GOGC по живой куче и публикует метрики за прошедший интервал
+func (t *Tuner) Tune(ctx context.Context) error {
+	cur := t.read()
+	live := t.samples[0].Value.Uint64()
+
+	if t.adapt && live > 0 {
+		if p := gcPercent(live, t.limit); p != t.percent {
+			debug.SetGCPercent(p)
+			t.percent = p
+		}
+	}
+
+	hist := t.samples[2].Value.Float64Histogram()
+	pauses := make([]uint64, len(cur.pauses))
+	for i := range pauses {
+		pauses[i] = cur.pauses[i] - t.prev.pauses[i]
+	}
+	var cpuFraction float64
+	if d := cur.totalCPU - t.prev.totalCPU; d > 0 {
+		cpuFraction = (cur.gcCPU - t.prev.gcCPU) / d
+	}
+	cycles := int64(cur.cycles - t.prev.cycles)
+	t.prev = cur
+
+	gauges := map[string]float64{
+		"ServerGCPercent":         float64(t.percent),
+		"ServerHeapLiveBytes":     float64(live),
+		"ServerMemoryLimitBytes":  float64(t.limit),
+		"ServerGCPauseP99Seconds": quantile(hist.Buckets, pauses, 0.99),
+		"ServerGCPauseMaxSeconds": quantile(hist.Buckets, pauses, 1),
+		"ServerGCCPUFraction":     cpuFraction,
+	}
+	for name, v := range gauges {
+		if err := t.store.UpdateGauge(ctx, name, v); err != nil {
+			return err
+		}
+	}
+	return t.store.UpdateCounter(ctx, "ServerGCCycles", cycles)
+}
+
+// read читает текущие значения метрик среды выполнения
+func (t *Tuner) read() snapshot {
+	metrics.Read(t.samples)
+	hist := t.samples[2].Value.Float64Histogram()
+	return snapshot{
+		cycles:   t.samples[1].Value.Uint64(),
+		pauses:   append([]uint64(nil), hist.Counts...),
+		gcCPU:    t.samples[3].Value.Float64(),
+		totalCPU: t.samples[4].Value.Float64(),
+	}
+}
+
+// gcPercent подбирает GOGC так, чтобы цель кучи live*(1+GOGC/100)
+// не превышала доли headroom бюджета limit
+func gcPercent(live uint64, limit int64) int {
+	p := (headroom*float64(limit)/float64(live) - 1) * 100
+	return int(math.Max(MinGCPercent, math.Min(MaxGCPercent, p)))
+}
+
+// quantile оценивает квантиль q по гистограмме с границами buckets
+// (верхней границей корзины); пустая гистограмма даёт 0
+func quantile(buckets []float64, counts []uint64, q float64) float64 {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, c := range counts {
+		seen += c
+		if seen >= rank {
+			if upper := buckets[i+1]; !math.IsInf(upper, 1) {
+				return upper
+			}
+			return buckets[i]
+		}
+	}
+	return 0
+}
+
+// ParseBytes разбирает размер памяти: число байт или число с суффиксом
+// B, KiB, MiB, GiB, TiB, KB, MB, GB, TB
+func ParseBytes(raw string) (int64, error) {
+	s := strings.TrimSpace(raw)
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12}, {"B", 1},
+	}
+	mult := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsInf(v*mult, 0) || v*mult > math.MaxInt64 {
+		return 0, fmt.Errorf("неверный размер памяти: %q", raw)
+	}
+	return int64(v * mult), nil
+}
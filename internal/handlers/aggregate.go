@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// aggregateResponse ответ на запрос агрегации по меткам или шаблону имени
+type aggregateResponse struct {
+	Name string `json:"name,omitempty"`
+	// Match шаблон имён при агрегации по всем подходящим метрикам
+	Match  string         `json:"match,omitempty"`
+	Type   string         `json:"type"`
+	Agg    string         `json:"agg"`
+	Groups []labels.Group `json:"groups"`
+}
+
+// splitList разбирает список через запятую, пропуская пустые элементы
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// aggregate обработчик GET /aggregate?name=cpu&by=core&agg=sum
+// агрегирует текущие значения рядов с метками по группам, а с параметром
+// match — значения всех метрик с подходящими именами
+func (h *Handler) aggregate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	agg := q.Get("agg")
+	if fn := q.Get("fn"); fn != "" {
+		agg = fn
+	}
+	if agg == "" {
+		agg = labels.Sum
+	}
+	if q.Has("match") {
+		h.aggregateMatch(w, r, q.Get("match"), agg)
+		return
+	}
+
+	name := q.Get("name")
+	if err := models.CheckName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.ContainsAny(name, "{}") {
+		http.Error(w, "Укажите базовое имя метрики без меток.", http.StatusBadRequest)
+		return
+	}
+	base := h.metricName(r, name)
+
+	g := labels.Grouping{By: splitList(q.Get("by")), Without: splitList(q.Get("without"))}
+
+	// Если тип не указан, ищем сначала gauge, затем counter
+	mType := q.Get("type")
+	switch mType {
+	case models.Gauge, models.Counter, "":
+	default:
+		http.Error(w, models.ErrInvalidType.Error(), http.StatusBadRequest)
+		return
+	}
+	gauges, counters, err := h.store(r).GetAll(r.Context())
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	var groups []labels.Group
+	for _, t := range []string{models.Gauge, models.Counter} {
+		if mType != "" && mType != t {
+			continue
+		}
+		series := gauges
+		if t == models.Counter {
+			series = make(map[string]float64, len(counters))
+			for n, v := range counters {
+				series[n] = float64(v)
+			}
+		}
+		var err error
+		if groups, err = labels.Aggregate(series, base, g, agg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(groups) > 0 {
+			mType = t
+			break
+		}
+	}
+	if len(groups) == 0 {
+		http.Error(w, "Метрика не найдена.", http.StatusNotFound)
+		return
+	}
+	writeFields(w, r, http.StatusOK, aggregateResponse{Name: clientName(r, base), Type: mType, Agg: agg, Groups: groups})
+}
+
+// aggregateMatch агрегирует функцией agg значения метрик, имена которых
+// (как их видит клиент) подходят под шаблон match в синтаксисе path.Match.
+// По умолчанию агрегируются gauge.
+func (h *Handler) aggregateMatch(w http.ResponseWriter, r *http.Request, match, agg string) {
+	if _, err := path.Match(match, ""); err != nil || match == "" {
+		http.Error(w, "Неверный шаблон match.", http.StatusBadRequest)
+		return
+	}
+	mType := r.URL.Query().Get("type")
+	switch mType {
+	case "":
+		mType = models.Gauge
+	case models.Gauge, models.Counter:
+	default:
+		http.Error(w, models.ErrInvalidType.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Значения берутся из одного снимка хранилища, поэтому согласованы между собой
+	metrics, err := h.listMetrics(r)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	var values []float64
+	for _, m := range metrics {
+		if m.MType != mType {
+			continue
+		}
+		if ok, _ := path.Match(match, m.ID); !ok {
+			continue
+		}
+		if m.Value != nil {
+			values = append(values, *m.Value)
+		} else {
+			values = append(values, float64(*m.Delta))
+		}
+	}
+	group, err := labels.Reduce(values, agg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(values) == 0 {
+		http.Error(w, "Метрики не найдены.", http.StatusNotFound)
+		return
+	}
+	writeFields(w, r, http.StatusOK, aggregateResponse{Match: match, Type: mType, Agg: agg, Groups: []labels.Group{group}})
+}
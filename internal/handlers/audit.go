@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/audit"
+	"github.com/iliodor1/metrics-service/internal/auth"
+	"github.com/iliodor1/metrics-service/internal/middleware"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Выборка журнала аудита
+const (
+	// defaultAuditLimit число записей в ответе по умолчанию
+	defaultAuditLimit = 100
+	// maxAuditLimit наибольшее число записей в ответе
+	maxAuditLimit = 10000
+)
+
+// auditEntry возвращает запись журнала с клиентом запроса
+func auditEntry(r *http.Request, action, mType, name string) audit.Entry {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	e := audit.Entry{Time: time.Now(), Remote: remote, Action: action, Type: mType, Name: name}
+	if key := r.Header.Get(middleware.APIKeyHeader); key != "" {
+		e.KeyID = tenant.KeyID(key)
+	}
+	if p, ok := auth.FromContext(r.Context()); ok {
+		e.Client = p.Name
+	}
+	return e
+}
+
+// auditUpdate отмечает в журнале обновление метрики клиентом.
+// Значение counter после обновления читается из хранилища;
+// у summary записывается наблюдение.
+func (h *Handler) auditUpdate(r *http.Request, m models.Metrics) {
+	if h.audit == nil {
+		return
+	}
+	e := auditEntry(r, audit.ActionUpdate, m.MType, m.ID)
+	value := 0.0
+	if m.Value != nil {
+		value = *m.Value
+	} else {
+		delta := *m.Delta
+		e.Delta = &delta
+		total, _ := h.storage.GetCounter(r.Context(), m.ID)
+		value = float64(total)
+	}
+	e.Value = &value
+	h.audit.Record(e)
+}
+
+// auditValues отмечает в журнале установку значений метрикам
+func (h *Handler) auditValues(r *http.Request, action string, gauges map[string]float64, counters map[string]int64) {
+	if h.audit == nil {
+		return
+	}
+	entries := make([]audit.Entry, 0, len(gauges)+len(counters))
+	for name, v := range gauges {
+		e := auditEntry(r, action, models.Gauge, name)
+		e.Value = &v
+		entries = append(entries, e)
+	}
+	for name, v := range counters {
+		e := auditEntry(r, action, models.Counter, name)
+		value := float64(v)
+		e.Value = &value
+		entries = append(entries, e)
+	}
+	h.audit.Record(entries...)
+}
+
+// statusWriter запоминает статус ответа
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader передаёт и запоминает статус ответа
+func (w *statusWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// auditSettings оборачивает обработчик административного API, меняющий
+// раздел настроек section: после успешного изменения в журнал пишется
+// состояние раздела до и после. Изменения одного раздела не выполняются
+// одновременно, чтобы состояния не перепутались.
+func (h *Handler) auditSettings(section string, settings func() any, next http.Handler) http.Handler {
+	if h.audit == nil {
+		return next
+	}
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		before := settings()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if sw.status < http.StatusMultipleChoices {
+			e := auditEntry(r, audit.ActionConfig, "", "")
+			e.Section = section
+			h.audit.RecordChange(e, before, settings())
+		}
+	})
+}
+
+// auditLog обработчик GET /admin/audit: последние записи журнала аудита
+// с отбором по метрике, ключу, адресу клиента, действию и времени
+func (h *Handler) auditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.audit == nil {
+		http.Error(w, "Журнал аудита отключён.", http.StatusNotImplemented)
+		return
+	}
+
+	q := r.URL.Query()
+	f := audit.Filter{
+		Name:    q.Get("name"),
+		KeyID:   q.Get("key_id"),
+		Client:  q.Get("client"),
+		Remote:  q.Get("remote"),
+		Action:  q.Get("action"),
+		Section: q.Get("section"),
+		Limit:   defaultAuditLimit,
+	}
+	var ok bool
+	if f.From, ok = parseTime(q.Get("from"), time.Time{}); !ok {
+		http.Error(w, "Неверное значение from.", http.StatusBadRequest)
+		return
+	}
+	if f.To, ok = parseTime(q.Get("to"), time.Time{}); !ok {
+		http.Error(w, "Неверное значение to.", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxAuditLimit {
+			http.Error(w, "Неверное значение limit.", http.StatusBadRequest)
+			return
+		}
+		f.Limit = n
+	}
+
+	entries, err := h.audit.Query(f)
+	if err != nil {
+		http.Error(w, "Не удалось прочитать журнал аудита.", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/iliodor1/metrics-service/internal/audit"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/internal/stream"
+)
+
+// maxBackupSize максимальный размер резервной копии в теле запроса
+const maxBackupSize = 256 << 20
+
+// Backup резервное копирование метрик в файлы на сервере
+type Backup struct {
+	// Dir каталог резервных копий (пустой — копии только скачиваются и загружаются)
+	Dir string
+}
+
+// errNoBackupDir каталог резервных копий не задан
+var errNoBackupDir = errors.New("каталог резервных копий не задан")
+
+// path возвращает путь к файлу копии name внутри каталога копий
+func (b *Backup) path(name string) (string, error) {
+	if b == nil || b.Dir == "" {
+		return "", errNoBackupDir
+	}
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", errors.New("имя файла копии не должно содержать каталогов")
+	}
+	return filepath.Join(b.Dir, name), nil
+}
+
+// backup обработчик POST /admin/backup: сохраняет согласованную копию всех
+// метрик в файл name из каталога копий или отдаёт её для скачивания.
+// Скачиваемая копия содержит все обновления потока hub до номера
+// из заголовка X-Last-Event-ID, с которого реплика продолжает поток.
+func (h *Handler) backup(b *Backup, hub *stream.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = storage.FormatJSON
+		}
+		if format != storage.FormatJSON && format != storage.FormatBinary {
+			http.Error(w, "Неверный формат копии: используйте json или binary.", http.StatusBadRequest)
+			return
+		}
+
+		if name := r.URL.Query().Get("file"); name != "" {
+			path, err := b.path(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			n, err := storage.SaveFile(r.Context(), h.storage, path, format)
+			if err != nil {
+				log.Printf("Не удалось сохранить резервную копию %s: %v", path, err)
+				http.Error(w, "Не удалось сохранить резервную копию.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"file": name, "format": format, "bytes": n})
+			return
+		}
+
+		// Номер читается до снимка: обновления с большими номерами реплика
+		// применит повторно, что не меняет итоговых значений
+		if hub != nil {
+			w.Header().Set("X-Last-Event-ID", strconv.FormatUint(hub.LastID(), 10))
+		}
+		gauges, counters, err := h.storage.GetAll(r.Context())
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		filename := "metrics-backup.json"
+		if format == storage.FormatBinary {
+			filename = "metrics-backup.bin"
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		if err := storage.WriteSnapshot(w, format, gauges, counters); err != nil {
+			log.Printf("Не удалось отдать резервную копию: %v", err)
+		}
+	}
+}
+
+// restore обработчик POST /admin/restore: устанавливает метрикам значения
+// из копии в теле запроса или из файла name каталога копий
+func (h *Handler) restore(b *Backup) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		src := http.MaxBytesReader(w, r.Body, maxBackupSize)
+		if name := r.URL.Query().Get("file"); name != "" {
+			path, err := b.path(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f, err := os.Open(path)
+			if os.IsNotExist(err) {
+				http.Error(w, "Резервная копия не найдена.", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Printf("Не удалось открыть резервную копию %s: %v", path, err)
+				http.Error(w, "Не удалось открыть резервную копию.", http.StatusInternalServerError)
+				return
+			}
+			defer f.Close()
+			src = f
+		}
+
+		gauges, counters, err := storage.ReadSnapshot(src)
+		if err != nil {
+			http.Error(w, "Неверная резервная копия: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		n, err := storage.Restore(r.Context(), h.storage, gauges, counters)
+		if err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+		h.auditValues(r, audit.ActionRestore, gauges, counters)
+		writeJSON(w, http.StatusOK, map[string]int{"metrics": n})
+	}
+}
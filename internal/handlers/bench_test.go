@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/commands"
+	"github.com/iliodor1/metrics-service/internal/namespace"
+	"github.com/iliodor1/metrics-service/internal/openapi"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/internal/units"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Тесты производительности пути приёма метрик. Результаты сравнивает
+// с базовыми значениями cmd/benchcmp.
+
+// newBenchServer собирает маршруты сервера поверх хранилища s
+func newBenchServer(s storage.Storage) http.Handler {
+	registry, _ := units.NewRegistry(nil)
+	names, _ := namespace.New(namespace.Config{})
+	mux := http.NewServeMux()
+	Register(mux, openapi.New("bench", "0"), New(s, registry, names), Services{Commands: commands.NewQueue()})
+	return mux
+}
+
+// serve выполняет запрос к серверу и проверяет код ответа
+func serve(b *testing.B, srv http.Handler, r *http.Request) {
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		b.Fatalf("сервер ответил %d: %s", w.Code, w.Body)
+	}
+}
+
+func BenchmarkIngestURL(b *testing.B) {
+	srv := newBenchServer(storage.NewMemStorage())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		path := "/update/gauge/metric" + strconv.Itoa(i%1000) + "/" + strconv.Itoa(i)
+		serve(b, srv, httptest.NewRequest(http.MethodPost, path, nil))
+	}
+}
+
+func BenchmarkIngestJSON(b *testing.B) {
+	srv := newBenchServer(storage.NewMemStorage())
+	body, _ := json.Marshal(models.NewCounter("requests", 1))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		serve(b, srv, httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(body)))
+	}
+}
+
+func BenchmarkIngestBatch100(b *testing.B) {
+	srv := newBenchServer(storage.NewMemStorage())
+	batch := make([]models.Metrics, 100)
+	for i := range batch {
+		batch[i] = models.NewGauge(fmt.Sprintf("metric%d", i), float64(i))
+	}
+	body, _ := json.Marshal(batch)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		serve(b, srv, httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body)))
+	}
+}
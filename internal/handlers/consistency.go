@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/iliodor1/metrics-service/internal/replica"
+)
+
+// consistencyHeader заголовок, в котором клиент выбирает согласованность
+// чтения, а сервер сообщает выбранную
+const consistencyHeader = "X-Read-Consistency"
+
+// Согласованность чтения
+const (
+	// consistencyStrong клиент видит все свои записи: на реплике чтение
+	// выполняет основной сервер
+	consistencyStrong = "strong"
+	// consistencyEventual быстрое чтение из локального хранилища реплики,
+	// которое может отставать от основного сервера (по умолчанию на реплике)
+	consistencyEventual = "eventual"
+)
+
+// consistencyWriter сообщает согласованность в ответе основного сервера,
+// заменяя его собственный заголовок
+type consistencyWriter struct {
+	http.ResponseWriter
+	mode string
+}
+
+// WriteHeader выставляет заголовок согласованности и передаёт статус
+func (w *consistencyWriter) WriteHeader(statusCode int) {
+	w.Header().Set(consistencyHeader, w.mode)
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// readConsistency выполняет чтение с согласованностью, выбранной параметром
+// consistency или заголовком X-Read-Consistency. Без реплики хранилище
+// сервера и есть источник записей, поэтому чтение всегда строгое.
+func readConsistency(rep *replica.Replica, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := r.URL.Query().Get("consistency")
+		if mode == "" {
+			mode = r.Header.Get(consistencyHeader)
+		}
+		switch mode {
+		case "", consistencyStrong, consistencyEventual:
+		default:
+			http.Error(w, "Согласованность чтения: strong или eventual.", http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case rep == nil:
+			w.Header().Set(consistencyHeader, consistencyStrong)
+			next.ServeHTTP(w, r)
+		case mode == consistencyStrong:
+			rep.ServeRead(&consistencyWriter{ResponseWriter: w, mode: consistencyStrong}, r)
+		default:
+			w.Header().Set(consistencyHeader, consistencyEventual)
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import "net/http"
+
+// consolePage страница управления сервером. Сама страница не содержит
+// данных: правила и ключи она загружает из административного API
+// с токеном администратора, который вводится на странице и хранится
+// только в sessionStorage вкладки.
+const consolePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Управление сервером метрик</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin: .5em 0; }
+th, td { border: 1px solid #ccc; padding: .3em .6em; text-align: left; }
+section { margin-bottom: 2em; }
+.error { color: #b00; }
+.note { color: #666; }
+</style>
+</head>
+<body>
+<h1>Управление сервером метрик</h1>
+
+<form id="login">
+<label>Токен администратора <input type="password" id="token"></label>
+<button>Войти</button>
+<span class="note">Если токен не задан на сервере, оставьте поле пустым.</span>
+</form>
+<p id="status" class="error"></p>
+
+<section>
+<h2>Правила оповещений</h2>
+<p id="rules-off" class="note" hidden>Оповещения отключены: в файле конфигурации нет раздела alerts.</p>
+<table id="rules"><thead><tr><th>Имя</th><th>Условие</th><th>Адрес оповещения</th><th>Состояние</th><th></th></tr></thead><tbody></tbody></table>
+<form id="rule-form">
+<input id="rule-name" placeholder="имя" required>
+<input id="rule-expr" placeholder="gauge Alloc > 1e9 for 5m" size="30" required>
+<input id="rule-webhook" placeholder="адрес оповещения (необязательно)" size="30">
+<button>Сохранить правило</button>
+</form>
+</section>
+
+<section>
+<h2>Арендаторы и API-ключи</h2>
+<p id="keys-off" class="note" hidden>Арендаторы не настроены: в файле конфигурации нет раздела tenants.</p>
+<table id="keys"><thead><tr><th>Арендатор</th><th>Ключ</th><th></th></tr></thead><tbody></tbody></table>
+<form id="key-form">
+<input id="key-tenant" placeholder="арендатор" required>
+<button>Выпустить ключ</button>
+</form>
+<p id="issued" class="note"></p>
+</section>
+
+<section>
+<h2>Подозрительные метрики</h2>
+<p id="hygiene-off" class="note" hidden>Поиск отключён: задайте -hygiene-interval.</p>
+<p id="hygiene-summary" class="note"></p>
+<table id="hygiene"><thead><tr><th>Метрика</th><th>Тип</th><th>Признаки</th><th>Подробности</th></tr></thead><tbody></tbody></table>
+<button id="hygiene-refresh">Проверить сейчас</button>
+</section>
+
+<script>
+"use strict";
+const $ = id => document.getElementById(id);
+
+async function api(method, path, body) {
+	const headers = {};
+	const token = sessionStorage.getItem("adminToken");
+	if (token) headers["Authorization"] = "Bearer " + token;
+	if (body !== undefined) headers["Content-Type"] = "application/json";
+	const resp = await fetch(path, {method, headers, body: body === undefined ? undefined : JSON.stringify(body)});
+	if (resp.status === 401) throw new Error("Неверный токен администратора.");
+	return resp;
+}
+
+async function check(resp) {
+	if (!resp.ok) throw new Error((await resp.text()).trim() || resp.statusText);
+	return resp;
+}
+
+function row(tbody, cells, action) {
+	const tr = tbody.insertRow();
+	for (const text of cells) tr.insertCell().textContent = text;
+	const btn = document.createElement("button");
+	btn.textContent = "Удалить";
+	btn.onclick = () => action().then(load).catch(show);
+	tr.insertCell().appendChild(btn);
+}
+
+function show(err) {
+	$("status").textContent = err ? err.message : "";
+}
+
+async function loadRules() {
+	const resp = await api("GET", "/admin/alerts/rules");
+	$("rules-off").hidden = resp.status !== 404;
+	$("rules").hidden = $("rule-form").hidden = resp.status === 404;
+	if (resp.status === 404) return;
+	const tbody = $("rules").tBodies[0];
+	tbody.replaceChildren();
+	for (const r of await (await check(resp)).json()) {
+		row(tbody, [r.name, r.expr, r.webhook || "общий", r.state],
+			() => api("DELETE", "/admin/alerts/rules/" + encodeURIComponent(r.name)).then(check));
+	}
+}
+
+async function loadKeys() {
+	const resp = await api("GET", "/admin/tenants/keys");
+	$("keys-off").hidden = resp.status !== 404;
+	$("keys").hidden = $("key-form").hidden = resp.status === 404;
+	if (resp.status === 404) return;
+	const tbody = $("keys").tBodies[0];
+	tbody.replaceChildren();
+	const keys = await (await check(resp)).json();
+	keys.sort((a, b) => a.tenant.localeCompare(b.tenant));
+	for (const k of keys) {
+		row(tbody, [k.tenant, k.id],
+			() => api("DELETE", "/admin/tenants/keys/" + encodeURIComponent(k.id)).then(check));
+	}
+}
+
+const issueNames = {
+	never_read: "не читается",
+	constant: "не меняется",
+	naming: "имя нарушает правила",
+	near_duplicate: "похожее имя",
+};
+
+async function loadHygiene(refresh) {
+	const resp = await api("GET", "/admin/hygiene" + (refresh ? "?refresh=true" : ""));
+	$("hygiene-off").hidden = resp.status !== 404;
+	$("hygiene").hidden = $("hygiene-refresh").hidden = resp.status === 404;
+	if (resp.status === 404) return;
+	const report = await (await check(resp)).json();
+	$("hygiene-summary").textContent = "Проверено метрик: " + report.metrics + ", подозрительных: " +
+		report.findings.length + ". Окно: " + report.window + ". Проверка: " + new Date(report.generated_at).toLocaleString();
+	const tbody = $("hygiene").tBodies[0];
+	tbody.replaceChildren();
+	for (const f of report.findings) {
+		const details = [f.naming, f.similar && "похожие: " + f.similar.join(", ")].filter(Boolean).join("; ");
+		const tr = tbody.insertRow();
+		for (const text of [f.name, f.type, f.issues.map(i => issueNames[i] || i).join(", "), details]) {
+			tr.insertCell().textContent = text;
+		}
+	}
+}
+
+function load() {
+	show(null);
+	return Promise.all([loadRules(), loadKeys(), loadHygiene(false)]).catch(show);
+}
+
+$("login").onsubmit = e => {
+	e.preventDefault();
+	sessionStorage.setItem("adminToken", $("token").value);
+	load();
+};
+
+$("rule-form").onsubmit = e => {
+	e.preventDefault();
+	const rule = {name: $("rule-name").value, expr: $("rule-expr").value, webhook: $("rule-webhook").value};
+	api("POST", "/admin/alerts/rules", rule).then(check).then(() => e.target.reset()).then(load).catch(show);
+};
+
+$("key-form").onsubmit = e => {
+	e.preventDefault();
+	api("POST", "/admin/tenants/keys", {tenant: $("key-tenant").value}).then(check).then(r => r.json()).then(k => {
+		$("issued").textContent = "Ключ арендатора " + k.tenant + ": " + k.key + " — сохраните его, он показывается один раз.";
+		e.target.reset();
+	}).then(load).catch(show);
+};
+
+$("hygiene-refresh").onclick = () => loadHygiene(true).catch(show);
+
+load();
+</script>
+</body>
+</html>
+`
+
+// console обработчик GET /admin/ui: страница управления правилами
+// оповещений, арендаторами и их API-ключами, а также отчёт
+// о подозрительных метриках
+func console(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(consolePage))
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+func TestStorageErrorStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage func() storage.Storage
+		method  string
+		target  string
+		body    string
+		want    int
+	}{
+		{name: "нет метрики", method: http.MethodGet, target: "/value/gauge/missing", want: http.StatusNotFound},
+		{name: "нет counter в JSON", method: http.MethodPost, target: "/value/",
+			body: `{"id":"missing","type":"counter"}`, want: http.StatusNotFound},
+		{name: "неизвестный тип", method: http.MethodGet, target: "/value/histogram/x", want: http.StatusBadRequest},
+		{name: "переполнение counter", method: http.MethodPost,
+			target: fmt.Sprintf("/update/counter/big/%d", int64(math.MaxInt64)), want: http.StatusBadRequest},
+		{name: "слишком много метрик", method: http.MethodPost, target: "/update/gauge/new/1", want: http.StatusTooManyRequests,
+			storage: func() storage.Storage { return storage.NewLimitedMemStorage(storage.Limits{MaxMetrics: 2}) }},
+		{name: "бюджет памяти", method: http.MethodPost, target: "/update/gauge/new/1", want: http.StatusRequestEntityTooLarge,
+			storage: func() storage.Storage { return storage.NewLimitedMemStorage(storage.Limits{MaxBytes: 1}) }},
+		{name: "пакет сверх ограничения", method: http.MethodPost, target: "/updates/",
+			body: `[{"id":"x","type":"gauge","value":1},{"id":"y","type":"gauge","value":1}]`, want: http.StatusTooManyRequests,
+			storage: func() storage.Storage { return storage.NewLimitedMemStorage(storage.Limits{MaxMetrics: 3}) }},
+		{name: "только для чтения", method: http.MethodPost, target: "/update/gauge/cpu/1", want: http.StatusForbidden,
+			storage: func() storage.Storage { return storage.NewReadOnly(storage.NewMemStorage()) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s storage.Storage = storage.NewMemStorage()
+			if tt.storage != nil {
+				s = tt.storage()
+			}
+			// Две метрики уже есть, counter big переполнится при прибавлении
+			// MaxInt64. Без места под них хранилище остаётся пустым.
+			if mem, ok := s.(*storage.MemStorage); ok {
+				ctx := context.Background()
+				_ = mem.UpdateGauge(ctx, "cpu", 1)
+				_ = mem.UpdateCounter(ctx, "big", 1)
+			}
+			srv := newTestServer(t, s, Services{})
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s %s: код %d (%s), ожидался %d", tt.method, tt.target, w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdatesAllOrNothing(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "новые метрики сверх ограничения", want: http.StatusTooManyRequests,
+			body: `[{"id":"hits","type":"counter","delta":5},{"id":"x","type":"gauge","value":1},{"id":"y","type":"gauge","value":1}]`},
+		{name: "ряды summary сверх ограничения", want: http.StatusTooManyRequests,
+			body: `[{"id":"hits","type":"counter","delta":5},{"id":"latency","type":"summary","value":0.2}]`},
+		{name: "переполнение в конце пакета", want: http.StatusBadRequest,
+			body: fmt.Sprintf(`[{"id":"hits","type":"counter","delta":5},{"id":"hits","type":"counter","delta":%d}]`, int64(math.MaxInt64))},
+		{name: "пакет помещается", want: http.StatusOK,
+			body: `[{"id":"hits","type":"counter","delta":5},{"id":"x","type":"gauge","value":1}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := storage.NewLimitedMemStorage(storage.Limits{MaxMetrics: 2})
+			if err := s.UpdateCounter(ctx, "hits", 1); err != nil {
+				t.Fatal(err)
+			}
+			srv := newTestServer(t, s, Services{})
+			r := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("код %d (%s), ожидался %d", w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+			}
+			// Отклонённый пакет не меняет ни одной метрики
+			want := int64(1)
+			if tt.want == http.StatusOK {
+				want = 6
+			}
+			if v, _ := s.GetCounter(ctx, "hits"); v != want {
+				t.Errorf("hits = %d, ожидалось %d", v, want)
+			}
+		})
+	}
+}
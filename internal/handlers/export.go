@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/internal/audit"
+	"github.com/iliodor1/metrics-service/internal/privacy"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Форматы выгрузки, параметр format
+const (
+	exportJSON   = "json"
+	exportNDJSON = "ndjson"
+)
+
+// export обработчик GET /export: выгружает все метрики арендатора одним
+// документом JSON — массивом метрик — или NDJSON по метрике на строку.
+// Формат задаётся параметром format, а без него — заголовком Accept.
+// Параметры type и prefix отбирают метрики по типу и началу имени.
+// Значения выгружаются точно, без округления gauge; counter выгружается
+// итоговым значением в delta, поэтому выгрузка загружается обратно через
+// POST /import, а не через /updates.
+func (h *Handler) export(w http.ResponseWriter, r *http.Request) {
+	h.writeExport(w, r, nil)
+}
+
+// exportPublic обработчик GET /export/public: та же выгрузка для внешних
+// потребителей, но значения чувствительных метрик искажены правилами p
+func (h *Handler) exportPublic(p *privacy.Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.writeExport(w, r, p)
+	}
+}
+
+// writeExport выгружает метрики, искажая значения правилами p (nil — точно)
+func (h *Handler) writeExport(w http.ResponseWriter, r *http.Request, p *privacy.Policy) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	mType, prefix := q.Get("type"), q.Get("prefix")
+	if mType != "" && mType != models.Gauge && mType != models.Counter {
+		http.Error(w, "Неподдерживаемый тип метрики. Допустимые типы: gauge, counter.", http.StatusBadRequest)
+		return
+	}
+	var format string
+	switch q.Get("format") {
+	case exportJSON:
+		format = mediaJSON
+	case exportNDJSON:
+		format = ContentTypeNDJSON
+	case "":
+		offers := []string{mediaJSON, ContentTypeNDJSON}
+		if format = negotiate(r, offers...); format == "" {
+			notAcceptable(w, offers...)
+			return
+		}
+	default:
+		http.Error(w, "Неверное значение format: json или ndjson.", http.StatusBadRequest)
+		return
+	}
+
+	all, err := h.listMetrics(r)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	metrics := make([]models.Metrics, 0, len(all))
+	for _, m := range all {
+		if (mType == "" || m.MType == mType) && strings.HasPrefix(m.ID, prefix) {
+			metrics = append(metrics, m)
+		}
+	}
+	if p != nil {
+		metrics = p.Metrics(metrics)
+	}
+
+	if format == mediaJSON {
+		writeJSON(w, http.StatusOK, metrics)
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for _, m := range metrics {
+		enc.Encode(m)
+	}
+}
+
+// Режимы импорта, параметр mode
+const (
+	importMerge   = "merge"
+	importReplace = "replace"
+)
+
+// importChange изменение метрики при импорте
+type importChange struct {
+	ID    string `json:"id"`
+	MType string `json:"type"`
+	// Before значение до импорта (нет — метрика будет создана), After после него
+	Before *float64 `json:"before,omitempty"`
+	After  float64  `json:"after"`
+}
+
+// importReport итог импорта выгрузки
+type importReport struct {
+	Mode   string `json:"mode"`
+	DryRun bool   `json:"dry_run"`
+	// Created новые метрики, Changed метрики с другим значением,
+	// Unchanged метрики, значение которых не изменится
+	Created   int `json:"created"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+	// Changes созданные и изменённые метрики; только при dry_run
+	Changes []importChange `json:"changes,omitempty"`
+}
+
+// decodeDump читает выгрузку GET /export: массив метрик JSON или NDJSON.
+// Формат определяется по первому символу тела.
+func decodeDump(body io.Reader) ([]models.Metrics, error) {
+	br := bufio.NewReader(body)
+	dec := json.NewDecoder(br)
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+		br.UnreadByte()
+		if c == '[' {
+			var metrics []models.Metrics
+			if err := dec.Decode(&metrics); err != nil {
+				return nil, err
+			}
+			return metrics, nil
+		}
+		break
+	}
+	var metrics []models.Metrics
+	for {
+		var m models.Metrics
+		err := dec.Decode(&m)
+		if err == io.EOF {
+			return metrics, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("метрика №%d: %w", len(metrics)+1, err)
+		}
+		metrics = append(metrics, m)
+	}
+}
+
+// importDump обработчик POST /import: загружает выгрузку GET /export
+// в метрики арендатора. В режиме merge выгрузка применяется как пакет
+// POST /updates — counter прибавляется к текущему значению, — а в режиме
+// replace метрики получают значения из выгрузки, и повторный импорт ничего
+// не меняет. Метрики, которых нет в выгрузке, не удаляются ни в одном режиме.
+// С dry_run=true хранилище не меняется, а в ответе перечислены изменения.
+func (h *Handler) importDump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	mode := q.Get("mode")
+	switch mode {
+	case "":
+		mode = importMerge
+	case importMerge, importReplace:
+	default:
+		http.Error(w, "Неверное значение mode: merge или replace.", http.StatusBadRequest)
+		return
+	}
+	dryRun := q.Get("dry_run") == "true"
+	if !dryRun && storage.IsReadOnly(h.storage) {
+		http.Error(w, storage.ErrReadOnly.Error(), http.StatusForbidden)
+		return
+	}
+
+	dump, err := decodeDump(http.MaxBytesReader(w, r.Body, maxBackupSize))
+	if err != nil {
+		http.Error(w, "Неверная выгрузка: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Выгрузка проверяется целиком, чтобы не применить её частично
+	t := tenant.FromContext(r.Context())
+	for _, m := range dump {
+		if err := models.Validate(m); err != nil {
+			http.Error(w, fmt.Sprintf("Неверная выгрузка: метрика %s: %v", m.ID, err), http.StatusBadRequest)
+			return
+		}
+		if err := h.checkMetric(m); err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+		if h.freeze != nil {
+			if err := h.freeze.Check(tenant.Scope(t, m.ID)); err != nil {
+				writeUpdateError(w, err)
+				return
+			}
+		}
+	}
+
+	// Повторы имени в выгрузке в режиме merge складываются,
+	// в режиме replace побеждает последний
+	s := h.store(r)
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	deltas := make(map[string]int64)
+	for _, m := range dump {
+		name := tenant.Scope(t, m.ID)
+		switch {
+		case m.MType == models.Gauge:
+			gauges[name] = *m.Value
+		case mode == importReplace:
+			counters[name] = *m.Delta
+		default:
+			total, ok := counters[name]
+			if !ok {
+				var err error
+				total, err = s.GetCounter(r.Context(), name)
+				if err != nil && !errors.Is(err, storage.ErrNotFound) {
+					writeReadError(w, err)
+					return
+				}
+			}
+			if (*m.Delta > 0 && total > math.MaxInt64-*m.Delta) || (*m.Delta < 0 && total < math.MinInt64-*m.Delta) {
+				writeUpdateError(w, storage.ErrOverflow)
+				return
+			}
+			counters[name] = total + *m.Delta
+			deltas[name] += *m.Delta
+		}
+	}
+
+	report := importReport{Mode: mode, DryRun: dryRun}
+	note := func(mType, name string, before float64, exists bool, after float64) {
+		switch {
+		case !exists:
+			report.Created++
+		case before != after:
+			report.Changed++
+		default:
+			report.Unchanged++
+			return
+		}
+		if dryRun {
+			c := importChange{ID: clientName(r, name), MType: mType, After: after}
+			if exists {
+				c.Before = &before
+			}
+			report.Changes = append(report.Changes, c)
+		}
+	}
+	for name, v := range gauges {
+		before, err := s.GetGauge(r.Context(), name)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			writeReadError(w, err)
+			return
+		}
+		note(models.Gauge, name, before, err == nil, v)
+	}
+	for name, v := range counters {
+		before, err := s.GetCounter(r.Context(), name)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			writeReadError(w, err)
+			return
+		}
+		note(models.Counter, name, float64(before), err == nil, float64(v))
+	}
+	sort.Slice(report.Changes, func(i, j int) bool {
+		a, b := report.Changes[i], report.Changes[j]
+		return a.ID < b.ID || (a.ID == b.ID && a.MType < b.MType)
+	})
+
+	if !dryRun {
+		if err := applyDump(r.Context(), s, mode, gauges, counters, deltas); err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+		h.auditValues(r, audit.ActionImport, gauges, counters)
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// applyDump записывает выгрузку в хранилище: в режиме merge counter
+// получает приращения deltas, чтобы не потерять обновления, пришедшие
+// во время импорта, а в режиме replace — значения counters
+func applyDump(ctx context.Context, s storage.Storage, mode string, gauges map[string]float64, counters, deltas map[string]int64) error {
+	if mode == importReplace {
+		_, err := storage.Restore(ctx, s, gauges, counters)
+		return err
+	}
+	for name, v := range gauges {
+		if err := s.UpdateGauge(ctx, name, v); err != nil {
+			return err
+		}
+	}
+	for name, d := range deltas {
+		if err := s.UpdateCounter(ctx, name, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
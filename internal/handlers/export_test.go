@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/privacy"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+func TestExportPublic(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	if err := s.UpdateGauge(ctx, "revenue", 1234.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateCounter(ctx, "orders", 17); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateGauge(ctx, "cpu", 0.25); err != nil {
+		t.Fatal(err)
+	}
+	p, err := privacy.New(privacy.Config{Rules: []privacy.Rule{
+		{Names: []string{"revenue"}, Round: 100},
+		{Names: []string{"orders"}, Buckets: []float64{0, 10, 100}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, s, Services{Privacy: p})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: код %d (%s)", target, w.Code, strings.TrimSpace(w.Body.String()))
+		}
+		return w
+	}
+	export := func(target string) map[string]float64 {
+		var metrics []models.Metrics
+		if err := json.NewDecoder(get(target).Body).Decode(&metrics); err != nil {
+			t.Fatal(err)
+		}
+		values := make(map[string]float64, len(metrics))
+		for _, m := range metrics {
+			if m.Value != nil {
+				values[m.ID] = *m.Value
+			} else {
+				values[m.ID] = float64(*m.Delta)
+			}
+		}
+		return values
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   map[string]float64
+	}{
+		{
+			name:   "внешняя выгрузка искажена",
+			target: "/export/public?format=json",
+			want:   map[string]float64{"revenue": 1200, "orders": 10, "cpu": 0.25},
+		},
+		{
+			name:   "внутренняя выгрузка точна",
+			target: "/export?format=json",
+			want:   map[string]float64{"revenue": 1234.5, "orders": 17, "cpu": 0.25},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := export(tt.target)
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Errorf("%s = %v, ожидалось %v", id, got[id], want)
+				}
+			}
+		})
+	}
+
+	// Чтение отдельных метрик не искажается
+	for target, want := range map[string]string{
+		"/value/gauge/revenue":  "1234.5",
+		"/value/counter/orders": "17",
+	} {
+		if got := strings.TrimSpace(get(target).Body.String()); got != want {
+			t.Errorf("GET %s = %q, ожидалось %q", target, got, want)
+		}
+	}
+	// Выгрузка не меняет хранилище
+	if v, _ := s.GetGauge(ctx, "revenue"); v != 1234.5 {
+		t.Errorf("revenue в хранилище %v, ожидалось 1234.5", v)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// fieldsParam параметр запроса со списком полей ответа
+const fieldsParam = "fields"
+
+// errFields неверный список полей ответа
+var errFields = errors.New("неверное значение fields: ожидаются имена полей через запятую")
+
+// parseFields разбирает параметр fields. Пустой результат — поля
+// не выбраны и ответ передаётся целиком.
+func parseFields(r *http.Request) (map[string]bool, error) {
+	raw, ok := r.URL.Query()[fieldsParam]
+	if !ok {
+		return nil, nil
+	}
+	fields := make(map[string]bool)
+	for _, v := range raw {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				return nil, errFields
+			}
+			fields[f] = true
+		}
+	}
+	return fields, nil
+}
+
+// writeFields отправляет ответ в формате JSON только с полями, перечисленными
+// в параметре fields: ?fields=value,timestamp. Поля выбираются в каждом
+// объекте ответа; массивы объектов, например точки ряда, остаются в ответе
+// и сокращаются так же. Без параметра ответ передаётся целиком.
+func writeFields(w http.ResponseWriter, r *http.Request, status int, v any) {
+	fields, err := parseFields(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if fields == nil {
+		writeJSON(w, status, v)
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Ошибка формирования ответа.", http.StatusInternalServerError)
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		http.Error(w, "Ошибка формирования ответа.", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status, project(doc, fields))
+}
+
+// project оставляет в объектах документа doc только поля fields
+func project(doc any, fields map[string]bool) any {
+	switch v := doc.(type) {
+	case []any:
+		for i := range v {
+			v[i] = project(v[i], fields)
+		}
+		return v
+	case map[string]any:
+		for k, item := range v {
+			switch {
+			case fields[k]:
+			case hasObjects(item):
+				v[k] = project(item, fields)
+			default:
+				delete(v, k)
+			}
+		}
+		return v
+	}
+	return doc
+}
+
+// hasObjects сообщает, что значение — массив объектов. Пустой массив
+// тоже остаётся в ответе: по нему не видно, что в нём могло быть.
+func hasObjects(v any) bool {
+	list, ok := v.([]any)
+	if !ok {
+		return false
+	}
+	if len(list) == 0 {
+		return true
+	}
+	_, ok = list[0].(map[string]any)
+	return ok
+}
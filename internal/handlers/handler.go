@@ -0,0 +1,327 @@
+// Package handlers содержит HTTP-обработчики сервера метрик
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/internal/audit"
+	"github.com/iliodor1/metrics-service/internal/freeze"
+	"github.com/iliodor1/metrics-service/internal/history"
+	"github.com/iliodor1/metrics-service/internal/hygiene"
+	"github.com/iliodor1/metrics-service/internal/middleware"
+	"github.com/iliodor1/metrics-service/internal/namepolicy"
+	"github.com/iliodor1/metrics-service/internal/namespace"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/internal/summary"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/internal/tracing"
+	"github.com/iliodor1/metrics-service/internal/units"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Handler структура для хранения зависимостей обработчика
+type Handler struct {
+	storage storage.Storage
+	units   *units.Registry
+	names   *namespace.Resolver
+	history *history.Store
+	audit   *audit.Log
+	policy  *namepolicy.Policy
+	hygiene *hygiene.Detector
+	freeze  *freeze.Registry
+	// summaries оценки квантилей метрик summary
+	summaries *summary.Registry
+	// precision число знаков после запятой в значениях gauge (-1 — столько,
+	// сколько нужно для точного представления)
+	precision int
+	// maxBody наибольший размер тела обновлений метрик
+	maxBody int64
+}
+
+// Option необязательная зависимость обработчика
+type Option func(*Handler)
+
+// WithHistory подключает историю значений для запросов /query
+func WithHistory(hist *history.Store) Option {
+	return func(h *Handler) {
+		h.history = hist
+	}
+}
+
+// WithAudit подключает журнал аудита изменений метрик
+func WithAudit(log *audit.Log) Option {
+	return func(h *Handler) {
+		h.audit = log
+	}
+}
+
+// WithMaxBodySize задаёт наибольший размер тела обновлений метрик в формате
+// JSON и Protocol Buffers; тела больше него отклоняются с кодом 413
+func WithMaxBodySize(n int64) Option {
+	return func(h *Handler) {
+		h.maxBody = n
+	}
+}
+
+// WithNamePolicy подключает проверку имён метрик, присланных клиентами
+func WithNamePolicy(p *namepolicy.Policy) Option {
+	return func(h *Handler) {
+		h.policy = p
+	}
+}
+
+// WithHygiene подключает учёт чтений метрик для поиска неиспользуемых
+func WithHygiene(d *hygiene.Detector) Option {
+	return func(h *Handler) {
+		h.hygiene = d
+	}
+}
+
+// WithFreeze проверяет пакеты обновлений по окнам заморозки целиком,
+// чтобы замороженная метрика не оставила пакет применённым частично
+func WithFreeze(reg *freeze.Registry) Option {
+	return func(h *Handler) {
+		h.freeze = reg
+	}
+}
+
+// WithGaugePrecision выводит значения gauge с n знаками после запятой
+func WithGaugePrecision(n int) Option {
+	return func(h *Handler) {
+		h.precision = n
+	}
+}
+
+// New создаёт новый экземпляр обработчика
+func New(s storage.Storage, units *units.Registry, names *namespace.Resolver, opts ...Option) *Handler {
+	h := &Handler{
+		storage:   s,
+		units:     units,
+		names:     names,
+		summaries: summary.New(),
+		precision: -1,
+		maxBody:   defaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// formatGauge выводит значение десятичной дробью без экспоненты:
+// разборщики клиентов не понимают запись вида 1.2e+06
+func (h *Handler) formatGauge(value float64) string {
+	return strconv.FormatFloat(value, 'f', h.precision, 64)
+}
+
+// markRead отмечает чтение метрики клиентом
+func (h *Handler) markRead(mType, name string) {
+	if h.hygiene != nil {
+		h.hygiene.Read(mType, name)
+	}
+}
+
+// metricName возвращает имя метрики в хранилище с учётом пространства имён
+// ключа клиента и его арендатора
+func (h *Handler) metricName(r *http.Request, name string) string {
+	name = h.names.Name(r.Header.Get(middleware.APIKeyHeader), name)
+	return tenant.Scope(tenant.FromContext(r.Context()), name)
+}
+
+// store возвращает хранилище, обращения к которому записываются
+// в трассировку запроса r
+func (h *Handler) store(r *http.Request) storage.Storage {
+	return tracing.WrapStorage(r.Context(), h.storage)
+}
+
+// clientName возвращает имя метрики, которое видит клиент, по имени в хранилище
+func clientName(r *http.Request, stored string) string {
+	name, _ := tenant.Unscope(tenant.FromContext(r.Context()), stored)
+	return name
+}
+
+// webhook обработчик для приёма метрик
+func (h *Handler) webhook(w http.ResponseWriter, r *http.Request) {
+	// Проверка метода запроса
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Разбор URL
+	// Ожидаемый формат: /update/<type>/<name>/<value>
+	path := strings.TrimPrefix(r.URL.Path, "/update/")
+	parts := strings.Split(path, "/")
+
+	// Проверка наличия имени метрики
+	if len(parts) != 3 {
+		http.Error(w, "Имя метрики не может быть пустым.", http.StatusNotFound)
+		return
+	}
+
+	metricType, metricName, metricValue := parts[0], parts[1], parts[2]
+
+	// Необязательная единица измерения метрики
+	unit := r.URL.Query().Get("unit")
+	if unit != "" && !units.Valid(unit) {
+		http.Error(w, "Неизвестная единица измерения.", http.StatusBadRequest)
+		return
+	}
+
+	// Разбор и проверка метрики
+	m, err := models.ParseMetric(metricType, metricName, metricValue)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, models.ErrEmptyName) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err := h.checkMetric(m); err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+	m.ID = h.metricName(r, m.ID)
+	metricName = m.ID
+
+	// Обновление метрики
+	if err := h.applyMetric(r, m); err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+
+	// Запоминаем единицу измерения метрики
+	if unit != "" {
+		if err := h.units.SetUnit(m.MType, metricName, unit); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Успешный ответ
+	w.WriteHeader(http.StatusOK)
+}
+
+// valueTemplate страница со значением одной метрики
+var valueTemplate = template.Must(template.New("value").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Name}}</title></head>
+<body>
+<p>{{.Type}} {{.Name}}: {{.Value}}{{with .Unit}} {{.}}{{end}}</p>
+</body>
+</html>
+`))
+
+// valueResponse значение метрики в формате JSON. Counter, переведённый
+// в другую единицу без остатка, передаётся целым в delta, остальные
+// значения — в value.
+type valueResponse struct {
+	metricJSON
+	Unit string `json:"unit,omitempty"`
+}
+
+// exportValue переводит значение метрики m с именем name в хранилище
+// в единицу to и возвращает его текст и единицу. Counter переводится без
+// округления до float64: если перевод точен, значение остаётся целым.
+func (h *Handler) exportValue(m *models.Metrics, name, to string) (string, string, error) {
+	if m.Delta == nil {
+		value, unit, err := h.units.Export(m.MType, name, *m.Value, to)
+		if err != nil {
+			return "", "", err
+		}
+		m.Value = &value
+		return h.formatGauge(value), unit, nil
+	}
+	value, unit, err := h.units.ExportInt(m.MType, name, *m.Delta, to)
+	if err != nil {
+		return "", "", err
+	}
+	if value.IsInt() && value.Num().IsInt64() {
+		delta := value.Num().Int64()
+		m.Delta = &delta
+		return strconv.FormatInt(delta, 10), unit, nil
+	}
+	f, _ := value.Float64()
+	m.Delta, m.Value = nil, &f
+	return h.formatGauge(f), unit, nil
+}
+
+// value обработчик для получения значения метрики. Формат выбирается
+// по заголовку Accept: текст (по умолчанию), JSON или HTML.
+func (h *Handler) value(w http.ResponseWriter, r *http.Request) {
+	// Проверка метода запроса
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	offers := []string{mediaText, mediaJSON, mediaHTML}
+	format := negotiate(r, offers...)
+	if format == "" {
+		notAcceptable(w, offers...)
+		return
+	}
+
+	// Разбор URL
+	// Ожидаемый формат: /value/<type>/<name>
+	path := strings.TrimPrefix(r.URL.Path, "/value/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 {
+		http.Error(w, "Метрика не найдена.", http.StatusNotFound)
+		return
+	}
+
+	metricType, metricName := parts[0], h.metricName(r, parts[1])
+	if metricType == models.Summary {
+		h.markRead(metricType, metricName)
+		h.summaryValue(w, r, format, metricName)
+		return
+	}
+
+	m, err := h.lookupMetric(r, metricType, metricName)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	h.markRead(metricType, metricName)
+
+	// Перевод значения в нужную единицу измерения
+	text, unit, err := h.exportValue(&m, metricName, r.URL.Query().Get("unit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if unit != "" {
+		w.Header().Set("X-Metric-Unit", unit)
+	}
+	m.ID = clientName(r, m.ID)
+
+	switch format {
+	case mediaJSON:
+		writeFields(w, r, http.StatusOK, valueResponse{metricJSON: h.toJSON(m), Unit: unit})
+	case mediaHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		valueTemplate.Execute(w, indexRow{Name: m.ID, Type: m.MType, Value: text, Unit: unit})
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(text))
+	}
+}
+
+// ping обработчик проверки доступности хранилища.
+// Хранилища, которым нужна проверка соединения, реализуют метод Ping.
+func (h *Handler) ping(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := storage.Ping(r.Context(), h.storage); err != nil {
+		http.Error(w, "Хранилище недоступно.", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/replica"
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// readyTimeout наибольшее время проверки хранилища пробой готовности
+const readyTimeout = 2 * time.Second
+
+// Итоги проверок готовности
+const (
+	readyOK       = "ok"
+	readyPending  = "pending"
+	readyStopping = "stopping"
+)
+
+// Health состояние сервера для проб живости и готовности Kubernetes
+type Health struct {
+	started  atomic.Bool
+	stopping atomic.Bool
+}
+
+// NewHealth создаёт состояние сервера, который ещё не готов принимать запросы
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// Started отмечает, что метрики восстановлены и сервер принимает запросы
+func (hl *Health) Started() {
+	hl.started.Store(true)
+}
+
+// Stopping отмечает начало остановки: сервер больше не готов
+func (hl *Health) Stopping() {
+	hl.stopping.Store(true)
+}
+
+// readiness ответ GET /readyz
+type readiness struct {
+	Ready bool `json:"ready"`
+	// Checks итоги проверок: ok или причина неготовности
+	Checks map[string]string `json:"checks"`
+}
+
+// healthz обработчик GET /healthz: процесс жив и отвечает на запросы
+func healthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// readyz обработчик GET /readyz: хранилище доступно, метрики восстановлены
+// (реплика получила первую копию с основного сервера) и сервер не
+// останавливается. Неготовый сервер отвечает 503.
+func (h *Handler) readyz(hl *Health, rep *replica.Replica) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+			return
+		}
+		res := readiness{Ready: true, Checks: map[string]string{}}
+		check := func(name, result string) {
+			res.Checks[name] = result
+			if result != readyOK {
+				res.Ready = false
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		if err := storage.Ping(ctx, h.storage); err != nil {
+			check("storage", err.Error())
+		} else {
+			check("storage", readyOK)
+		}
+
+		restore := readyOK
+		if hl != nil && !hl.started.Load() {
+			restore = readyPending
+		}
+		if rep != nil && rep.Status().LastSync.IsZero() {
+			restore = readyPending
+		}
+		check("restore", restore)
+
+		if hl != nil && hl.stopping.Load() {
+			check("shutdown", readyStopping)
+		} else {
+			check("shutdown", readyOK)
+		}
+
+		status := http.StatusOK
+		if !res.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, res)
+	}
+}
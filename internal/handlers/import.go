@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/iliodor1/metrics-service/internal/audit"
+	"github.com/iliodor1/metrics-service/internal/openmetrics"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// importResult итог импорта выгрузки Prometheus
+type importResult struct {
+	// Metrics метрики, получившие последние значения рядов
+	Metrics int `json:"metrics"`
+	// Samples прочитанные значения и Skipped пропущенные из них
+	Samples int `json:"samples"`
+	Skipped int `json:"skipped"`
+	// History значения, записанные в историю, и HistorySkipped ряды,
+	// история которых не записана, потому что у них уже есть своя
+	History        int `json:"history"`
+	HistorySkipped int `json:"history_skipped"`
+}
+
+// importProm обработчик POST /admin/import: загружает выгрузку Prometheus
+// (текстовый формат или OpenMetrics) — метрикам устанавливаются последние
+// значения рядов, а с history=true все значения записываются и в историю
+func (h *Handler) importProm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+	if storage.IsReadOnly(h.storage) {
+		http.Error(w, storage.ErrReadOnly.Error(), http.StatusForbidden)
+		return
+	}
+	withHistory := r.URL.Query().Get("history") == "true"
+	if withHistory && h.history == nil {
+		http.Error(w, "Запись истории отключена.", http.StatusNotImplemented)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	dump, err := openmetrics.Parse(http.MaxBytesReader(w, r.Body, maxBackupSize), mediaType == openmetrics.ContentType)
+	if err != nil {
+		http.Error(w, "Неверная выгрузка: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := importResult{Samples: dump.Samples, Skipped: dump.Skipped}
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	for _, s := range dump.Series {
+		if s.Type == models.Gauge {
+			gauges[s.Name] = s.Last()
+		} else {
+			counters[s.Name] = int64(s.Last())
+		}
+		if !withHistory {
+			continue
+		}
+		// История дописывается только по возрастанию времени, поэтому
+		// старые значения нельзя вставить перед уже записанными
+		if h.history.Has(s.Type, s.Name) {
+			res.HistorySkipped++
+			continue
+		}
+		for _, sample := range s.Samples {
+			if !sample.Time.IsZero() {
+				h.history.Append(s.Type, s.Name, sample.Time, sample.Value)
+				res.History++
+			}
+		}
+	}
+
+	res.Metrics, err = storage.Restore(r.Context(), h.storage, gauges, counters)
+	if err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+	h.auditValues(r, audit.ActionImport, gauges, counters)
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// indexTemplate страница со списком всех метрик
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Метрики</title></head>
+<body>
+<table>
+<tr><th>Имя</th><th>Тип</th><th>Значение</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// indexRow строка таблицы метрик
+type indexRow struct {
+	Name  string
+	Type  string
+	Value string
+	Unit  string
+}
+
+// listMetrics возвращает все метрики арендатора запроса, упорядоченные по имени и типу
+func (h *Handler) listMetrics(r *http.Request) ([]models.Metrics, error) {
+	gauges, counters, err := h.store(r).GetAll(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	if t := tenant.FromContext(r.Context()); t != "" {
+		gauges, counters = ownMetrics(t, gauges), ownMetrics(t, counters)
+	}
+	return models.FromMaps(gauges, counters), nil
+}
+
+// ownMetrics оставляет только метрики арендатора t с именами без его префикса
+func ownMetrics[V any](t string, all map[string]V) map[string]V {
+	own := make(map[string]V)
+	for stored, v := range all {
+		if name, ok := tenant.Unscope(t, stored); ok {
+			own[name] = v
+		}
+	}
+	return own
+}
+
+// index обработчик GET / со списком всех метрик. Формат выбирается по
+// заголовку Accept: HTML (по умолчанию), JSON или текст по строке на метрику.
+func (h *Handler) index(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	offers := []string{mediaHTML, mediaJSON, mediaText}
+	format := negotiate(r, offers...)
+	if format == "" {
+		notAcceptable(w, offers...)
+		return
+	}
+
+	metrics, err := h.listMetrics(r)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	if format == mediaJSON {
+		list := make([]metricJSON, len(metrics))
+		for i, m := range metrics {
+			list[i] = h.toJSON(m)
+		}
+		writeFields(w, r, http.StatusOK, list)
+		return
+	}
+	rows := make([]indexRow, 0, len(metrics))
+	for _, m := range metrics {
+		row := indexRow{Name: m.ID, Type: m.MType}
+		if m.Value != nil {
+			row.Value = h.formatGauge(*m.Value)
+		} else if m.Delta != nil {
+			row.Value = strconv.FormatInt(*m.Delta, 10)
+		}
+		rows = append(rows, row)
+	}
+
+	if format == mediaText {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, row := range rows {
+			fmt.Fprintf(w, "%s %s %s\n", row.Type, row.Name, row.Value)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, rows); err != nil {
+		http.Error(w, "Ошибка формирования страницы.", http.StatusInternalServerError)
+	}
+}
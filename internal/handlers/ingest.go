@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// ContentTypeNDJSON тип содержимого потока JSON Lines
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// Приём потока JSON Lines
+const (
+	// maxIngestLine наибольшая длина строки потока
+	maxIngestLine = 1 << 20
+	// ingestAckInterval частота подтверждений принятых строк
+	ingestAckInterval = time.Second
+	// ingestIdleTimeout наибольшее время чтения одной строки потока
+	// и записи одного подтверждения
+	ingestIdleTimeout = time.Minute
+)
+
+// Трейлеры итогового подтверждения потока
+const (
+	trailerApplied   = "X-Ingest-Applied"
+	trailerFailed    = "X-Ingest-Failed"
+	trailerLastError = "X-Ingest-Last-Error"
+)
+
+// ingestAck подтверждение принятых строк потока
+type ingestAck struct {
+	// Lines прочитанные строки, Applied применённые и Failed отклонённые из них
+	Lines   int `json:"lines"`
+	Applied int `json:"applied"`
+	Failed  int `json:"failed"`
+	// LastError причина последнего отказа
+	LastError string `json:"last_error,omitempty"`
+}
+
+// streamIngest обработчик POST /api/stream-ingest: принимает метрики
+// по одной в строке (JSON Lines) в долгом запросе и применяет их по мере
+// поступления. Каждую секунду, пока идёт приём, в тело ответа пишется
+// строка с подтверждением; итог передаётся в трейлерах ответа. Неверные
+// строки пропускаются и не прерывают поток. Поток, в котором строка
+// не приходит за ingestIdleTimeout, завершается.
+func (h *Handler) streamIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+	if storage.IsReadOnly(h.storage) {
+		http.Error(w, storage.ErrReadOnly.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Ответ пишется, пока тело запроса ещё читается
+	rc := http.NewResponseController(w)
+	if err := rc.EnableFullDuplex(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		http.Error(w, "Не удалось начать потоковый приём.", http.StatusInternalServerError)
+		return
+	}
+	// Поток длится дольше -read-timeout и -write-timeout сервера: сроки
+	// продлеваются на ingestIdleTimeout для каждой строки и подтверждения
+	rc.SetWriteDeadline(time.Now().Add(ingestIdleTimeout))
+	w.Header().Set("Trailer", trailerApplied+", "+trailerFailed+", "+trailerLastError)
+	w.Header().Set("Content-Type", ContentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	var ack ingestAck
+	enc := json.NewEncoder(w)
+	lastAck := time.Now()
+	sc := bufio.NewScanner(r.Body)
+	sc.Buffer(make([]byte, 64*1024), maxIngestLine)
+	scan := func() bool {
+		rc.SetReadDeadline(time.Now().Add(ingestIdleTimeout))
+		return sc.Scan()
+	}
+	for scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		ack.Lines++
+		if err := h.ingestLine(r, line); err != nil {
+			ack.Failed++
+			ack.LastError = "строка " + strconv.Itoa(ack.Lines) + ": " + err.Error()
+		} else {
+			ack.Applied++
+		}
+		// Подтверждение отправляется при поступлении строк; поток без
+		// данных подтверждений не получает
+		if time.Since(lastAck) >= ingestAckInterval {
+			rc.SetWriteDeadline(time.Now().Add(ingestIdleTimeout))
+			enc.Encode(ack)
+			rc.Flush()
+			lastAck = time.Now()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		ack.LastError = "поток прерван: " + err.Error()
+	}
+
+	rc.SetWriteDeadline(time.Now().Add(ingestIdleTimeout))
+	enc.Encode(ack)
+	w.Header().Set(trailerApplied, strconv.Itoa(ack.Applied))
+	w.Header().Set(trailerFailed, strconv.Itoa(ack.Failed))
+	// Текст ошибки не в ASCII кодируется по RFC 2047
+	w.Header().Set(trailerLastError, mime.QEncoding.Encode("utf-8", ack.LastError))
+}
+
+// ingestLine применяет метрику из одной строки потока
+func (h *Handler) ingestLine(r *http.Request, line []byte) error {
+	var m models.Metrics
+	if err := json.Unmarshal(line, &m); err != nil {
+		return errors.New("неверный формат JSON")
+	}
+	if err := h.checkMetric(m); err != nil {
+		return err
+	}
+	m.ID = h.metricName(r, m.ID)
+	return h.applyMetric(r, m)
+}
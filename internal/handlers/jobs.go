@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// События пакетного задания
+const (
+	jobStart   = "start"
+	jobSuccess = "success"
+	jobFailure = "failure"
+)
+
+// Метрики пакетных заданий; у каждой метка job с именем задания
+const (
+	// jobLastStart время последнего запуска в секундах Unix
+	jobLastStart = "JobLastStartTime"
+	// jobRunning 1, пока задание выполняется, 0 после завершения
+	jobRunning = "JobRunning"
+	// jobLastSuccess и jobLastFailure время последнего успешного
+	// и неудачного завершения в секундах Unix
+	jobLastSuccess = "JobLastSuccessTime"
+	jobLastFailure = "JobLastFailureTime"
+	// jobLastStatus 1, если последний запуск успешен, 0 — если нет
+	jobLastStatus = "JobLastStatus"
+	// jobDuration длительность последнего завершённого запуска в секундах
+	jobDuration = "JobLastDurationSeconds"
+	// jobRuns число завершённых запусков с меткой status=success|failure
+	jobRuns = "JobRuns"
+)
+
+// jobState состояние задания после события
+type jobState struct {
+	Job     string `json:"job"`
+	Event   string `json:"event"`
+	Running bool   `json:"running"`
+	// Duration длительность завершённого запуска в секундах; нет —
+	// запуск не был отмечен и длительность не передана
+	Duration *float64 `json:"duration_seconds,omitempty"`
+}
+
+// jobEvent обработчик POST /jobs/{name}/{event}: отмечает запуск (start)
+// или завершение (success, failure) пакетного задания, например
+// задания cron, и обновляет его метрики JobLastStartTime, JobRunning,
+// JobLastSuccessTime, JobLastFailureTime, JobLastStatus,
+// JobLastDurationSeconds и JobRuns с меткой job. Длительность завершённого
+// запуска отсчитывается от отмеченного запуска или передаётся параметром
+// duration, если задание сообщает только о завершении.
+func (h *Handler) jobEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+	job, event := r.PathValue("name"), r.PathValue("event")
+	if job == "" || strings.ContainsAny(job, "{}=,") {
+		http.Error(w, "Неверное имя задания.", http.StatusBadRequest)
+		return
+	}
+	if event != jobStart && event != jobSuccess && event != jobFailure {
+		http.Error(w, "Неизвестное событие: start, success или failure.", http.StatusNotFound)
+		return
+	}
+	var duration *float64
+	if v := r.URL.Query().Get("duration"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || event == jobStart {
+			http.Error(w, "Неверная длительность: задаётся при success и failure, например 90s.", http.StatusBadRequest)
+			return
+		}
+		seconds := d.Seconds()
+		duration = &seconds
+	}
+
+	name := func(base string) string {
+		return labels.Format(base, map[string]string{"job": job})
+	}
+	now := float64(time.Now().UnixNano()) / 1e9
+	state := jobState{Job: job, Event: event}
+	var updates []models.Metrics
+	if event == jobStart {
+		state.Running = true
+		updates = append(updates,
+			models.NewGauge(name(jobLastStart), now),
+			models.NewGauge(name(jobRunning), 1),
+		)
+	} else {
+		if duration == nil {
+			// Длительность известна, только если запуск отмечен и ещё не завершён
+			running, err := h.store(r).GetGauge(r.Context(), h.metricName(r, name(jobRunning)))
+			started, serr := h.store(r).GetGauge(r.Context(), h.metricName(r, name(jobLastStart)))
+			if err == nil && serr == nil && running == 1 {
+				seconds := math.Max(0, now-started)
+				duration = &seconds
+			}
+		}
+		state.Duration = duration
+		last, status := jobLastSuccess, 1.0
+		if event == jobFailure {
+			last, status = jobLastFailure, 0
+		}
+		updates = append(updates,
+			models.NewGauge(name(jobRunning), 0),
+			models.NewGauge(name(last), now),
+			models.NewGauge(name(jobLastStatus), status),
+			models.NewCounter(labels.Format(jobRuns, map[string]string{"job": job, "status": event}), 1),
+		)
+		if duration != nil {
+			updates = append(updates, models.NewGauge(name(jobDuration), *duration))
+		}
+	}
+
+	// Метрики проверяются все до применения, чтобы не обновить их частично
+	for _, m := range updates {
+		if err := h.checkMetric(m); err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+	}
+	for _, m := range updates {
+		m.ID = h.metricName(r, m.ID)
+		if err := h.applyMetric(r, m); err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, state)
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/iliodor1/metrics-service/internal/freeze"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/internal/summary"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Ограничения на запросы в формате JSON
+const (
+	// defaultMaxBodySize наибольший размер тела запроса по умолчанию
+	defaultMaxBodySize = 1 << 20
+	// maxBatchSize максимальное число метрик в пакете
+	maxBatchSize = 10000
+)
+
+// applyMetric проверяет метрику и сохраняет её в хранилище,
+// отмечая изменение в журнале аудита
+func (h *Handler) applyMetric(r *http.Request, m models.Metrics) error {
+	if err := models.ValidateUpdate(m); err != nil {
+		return err
+	}
+	var err error
+	if m.MType == models.Summary {
+		err = h.summaries.Observe(r.Context(), h.store(r), m.ID, *m.Value)
+	} else {
+		err = storage.Update(r.Context(), h.store(r), m)
+	}
+	if err == nil {
+		h.auditUpdate(r, m)
+	}
+	return err
+}
+
+// storageUpdates возвращает обновления хранилища, которыми применяется
+// метрика m: summary записывается в несколько рядов (см. пакет summary)
+func storageUpdates(m models.Metrics) []models.Metrics {
+	if m.MType != models.Summary {
+		return []models.Metrics{m}
+	}
+	n := summary.NamesOf(m.ID)
+	updates := []models.Metrics{models.NewCounter(n.Count, 1), models.NewGauge(n.Sum, 0)}
+	for _, q := range n.Quantiles {
+		updates = append(updates, models.NewGauge(q, 0))
+	}
+	return updates
+}
+
+// checkMetric проверяет метрику клиента до добавления к имени
+// пространства имён и арендатора, в том числе имя по правилам сервера
+func (h *Handler) checkMetric(m models.Metrics) error {
+	if err := models.ValidateUpdate(m); err != nil {
+		return err
+	}
+	if h.policy != nil {
+		return h.policy.Check(m.ID)
+	}
+	return nil
+}
+
+// writeUpdateError отвечает клиенту об ошибке обновления метрики:
+// ошибки в данных клиента — 400, хранилище только для чтения — 403,
+// превышено число метрик — 429, бюджет памяти на метрики — 413,
+// метрика заморожена — 423 с концом окна заморозки, хранилище не ответило
+// вовремя — 504, остальные ошибки хранилища — 500
+func writeUpdateError(w http.ResponseWriter, err error) {
+	var frozen *freeze.Error
+	switch {
+	case errors.As(err, &frozen):
+		w.Header().Set("Retry-After", frozen.Window.End.UTC().Format(http.TimeFormat))
+		http.Error(w, err.Error(), http.StatusLocked)
+	case errors.Is(err, storage.ErrReadOnly):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, storage.ErrTooManyMetrics):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, storage.ErrMemoryBudget):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, models.ErrEmptyName), errors.Is(err, models.ErrInvalidName),
+		errors.Is(err, models.ErrInvalidType), errors.Is(err, models.ErrInvalidValue),
+		errors.Is(err, storage.ErrOverflow), errors.Is(err, storage.ErrUnsupportedType):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "Хранилище не ответило вовремя.", http.StatusGatewayTimeout)
+	default:
+		http.Error(w, "Ошибка при обновлении метрики.", http.StatusInternalServerError)
+	}
+}
+
+// writeReadError отвечает клиенту об ошибке чтения метрик: метрики
+// нет — 404, тип не поддерживается — 400, хранилище не ответило
+// вовремя — 504, остальные ошибки хранилища — 500
+func writeReadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Метрика не найдена.", http.StatusNotFound)
+	case errors.Is(err, storage.ErrUnsupportedType), errors.Is(err, models.ErrInvalidType):
+		http.Error(w, err.Error()+". Допустимые типы: gauge, counter, summary.", http.StatusBadRequest)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "Хранилище не ответило вовремя.", http.StatusGatewayTimeout)
+	default:
+		http.Error(w, "Ошибка при чтении метрик.", http.StatusInternalServerError)
+	}
+}
+
+// lookupMetric возвращает текущее значение метрики
+func (h *Handler) lookupMetric(r *http.Request, mType, name string) (models.Metrics, error) {
+	return storage.Get(r.Context(), h.store(r), mType, name)
+}
+
+// metricJSON метрика в ответе в формате JSON: значение gauge выводится
+// так же, как в текстовом ответе
+type metricJSON struct {
+	ID    string      `json:"id"`
+	MType string      `json:"type"`
+	Delta *int64      `json:"delta,omitempty"`
+	Value json.Number `json:"value,omitempty"`
+}
+
+// toJSON готовит метрику к выводу в формате JSON
+func (h *Handler) toJSON(m models.Metrics) metricJSON {
+	out := metricJSON{ID: m.ID, MType: m.MType, Delta: m.Delta}
+	if m.Value != nil {
+		out.Value = json.Number(h.formatGauge(*m.Value))
+	}
+	return out
+}
+
+// decodeJSON читает тело запроса в формате JSON с ограничением размера
+func (h *Handler) decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBody)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		if !bodyTooLarge(w, err) {
+			http.Error(w, "Неверный формат JSON.", http.StatusBadRequest)
+		}
+		return false
+	}
+	return true
+}
+
+// bodyTooLarge отвечает 413, если тело запроса превысило ограничение размера
+func bodyTooLarge(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	http.Error(w, fmt.Sprintf("Тело запроса больше %d байт.", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+	return true
+}
+
+// writeJSON отправляет ответ в формате JSON
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// updateJSON обработчик POST /update/ для метрики в формате JSON
+// или Protocol Buffers. В ответе возвращается актуальное значение метрики.
+func (h *Handler) updateJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var m models.Metrics
+	if !h.decodeMetric(w, r, &m) {
+		return
+	}
+	if err := h.checkMetric(m); err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+	m.ID = h.metricName(r, m.ID)
+	if err := h.applyMetric(r, m); err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+	if m.MType == models.Summary {
+		h.writeSummary(w, r, m.ID)
+		return
+	}
+
+	current, err := h.lookupMetric(r, m.MType, m.ID)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	current.ID = clientName(r, current.ID)
+	h.writeMetric(w, r, current)
+}
+
+// updates обработчик POST /updates/ для пакета метрик в формате JSON
+// или Protocol Buffers (сообщение MetricList)
+func (h *Handler) updates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var batch []models.Metrics
+	if !h.decodeBatch(w, r, &batch) {
+		return
+	}
+	if len(batch) > maxBatchSize {
+		http.Error(w, "Слишком много метрик в пакете.", http.StatusBadRequest)
+		return
+	}
+
+	// Проверяем пакет целиком, чтобы не применить его частично
+	for _, m := range batch {
+		if err := h.checkMetric(m); err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+	}
+	updates := make([]models.Metrics, 0, len(batch))
+	for i := range batch {
+		batch[i].ID = h.metricName(r, batch[i].ID)
+		updates = append(updates, storageUpdates(batch[i])...)
+	}
+	if h.freeze != nil {
+		for _, m := range batch {
+			if err := h.freeze.Check(m.ID); err != nil {
+				writeUpdateError(w, err)
+				return
+			}
+		}
+	}
+	// Ограничения числа метрик и переполнение counter хранилище проверяет
+	// для всего пакета до первого обновления
+	if err := storage.Admit(r.Context(), h.store(r), updates); err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+	for _, m := range batch {
+		if err := h.applyMetric(r, m); err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"updated": len(batch)})
+}
+
+// valueJSON обработчик POST /value/ для запроса метрики в формате JSON
+// или Protocol Buffers
+func (h *Handler) valueJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.Metrics
+	if !h.decodeMetric(w, r, &req) {
+		return
+	}
+	if err := models.CheckName(req.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.MType == models.Summary {
+		name := h.metricName(r, req.ID)
+		h.markRead(req.MType, name)
+		h.writeSummary(w, r, name)
+		return
+	}
+	m, err := h.lookupMetric(r, req.MType, h.metricName(r, req.ID))
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	h.markRead(m.MType, m.ID)
+	m.ID = clientName(r, m.ID)
+	h.writeMetric(w, r, m)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Форматы ответов на запросы чтения
+const (
+	mediaHTML = "text/html"
+	mediaText = "text/plain"
+	mediaJSON = "application/json"
+)
+
+// negotiate выбирает по заголовку Accept наиболее предпочтительный
+// для клиента формат из offers. Без Accept возвращается первый из offers,
+// а если клиент не принимает ни одного — пустая строка.
+func negotiate(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQ, bestSpecific := "", 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		// Точное совпадение важнее type/*, а type/* — важнее */*
+		for _, offer := range offers {
+			specific := -1
+			switch {
+			case mediaType == offer:
+				specific = 2
+			case strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaType, "*")):
+				specific = 1
+			case mediaType == "*/*":
+				specific = 0
+			}
+			if specific < 0 {
+				continue
+			}
+			if q > bestQ || q == bestQ && specific > bestSpecific {
+				best, bestQ, bestSpecific = offer, q, specific
+			}
+			// Для */* и type/* подходит первый, то есть основной, из offers
+			if specific < 2 {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// notAcceptable отвечает, что ни один из форматов offers клиенту не подходит
+func notAcceptable(w http.ResponseWriter, offers ...string) {
+	http.Error(w, "Доступные форматы: "+strings.Join(offers, ", ")+".", http.StatusNotAcceptable)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/alerts"
+	"github.com/iliodor1/metrics-service/internal/commands"
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// defaultOfflineAfter время без запросов команд, после которого агент
+// считается недоступным
+const defaultOfflineAfter = time.Minute
+
+// overview ответ GET /api/overview
+type overview struct {
+	Metrics    []models.Metrics    `json:"metrics"`
+	Summary    overviewSummary     `json:"summary"`
+	Aggregates []overviewAggregate `json:"aggregates"`
+	// Alerts состояния правил оповещений (nil — оповещения отключены)
+	Alerts []overviewAlert `json:"alerts,omitempty"`
+	Fleet  overviewFleet   `json:"fleet"`
+}
+
+// overviewSummary число метрик по типам
+type overviewSummary struct {
+	Gauges   int `json:"gauges"`
+	Counters int `json:"counters"`
+	// Names число базовых имён без учёта меток
+	Names int `json:"names"`
+	// AlertStates число правил оповещений в каждом состоянии
+	AlertStates map[string]int `json:"alert_states,omitempty"`
+}
+
+// overviewAggregate сводка рядов одного базового имени с метками
+type overviewAggregate struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Series int     `json:"series"`
+	Sum    float64 `json:"sum"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Avg    float64 `json:"avg"`
+}
+
+// overviewAlert состояние правила оповещения без адреса веб-хука
+type overviewAlert struct {
+	Name  string    `json:"name"`
+	Expr  string    `json:"expr"`
+	State string    `json:"state"`
+	Value *float64  `json:"value,omitempty"`
+	Since time.Time `json:"since,omitempty"`
+}
+
+// overviewFleet состояние агентов по времени последнего запроса команд
+type overviewFleet struct {
+	Online  int             `json:"online"`
+	Offline int             `json:"offline"`
+	Agents  []overviewAgent `json:"agents"`
+}
+
+// overviewAgent агент и его доступность
+type overviewAgent struct {
+	commands.Agent
+	Online bool `json:"online"`
+}
+
+// overview обработчик GET /api/overview: список метрик, сводки по ним,
+// состояния оповещений и агентов одним ответом, чтобы панель при
+// обновлении не обращалась к нескольким маршрутам. Агент недоступен, если
+// не запрашивал команды дольше offline_after (по умолчанию минуту).
+func (h *Handler) overview(queue *commands.Queue, engine *alerts.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+			return
+		}
+		offlineAfter := defaultOfflineAfter
+		if v := r.URL.Query().Get("offline_after"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				http.Error(w, "Неверный параметр offline_after: ожидается положительная длительность, например 30s.", http.StatusBadRequest)
+				return
+			}
+			offlineAfter = d
+		}
+
+		// Список и сводки строятся по одному снимку хранилища
+		metrics, err := h.listMetrics(r)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		res := overview{Metrics: metrics, Aggregates: []overviewAggregate{}}
+		type key struct{ name, mType string }
+		aggs := make(map[key]*overviewAggregate)
+		names := make(map[string]bool)
+		for _, m := range res.Metrics {
+			var v float64
+			if m.MType == models.Gauge {
+				res.Summary.Gauges++
+				v = *m.Value
+			} else {
+				res.Summary.Counters++
+				v = float64(*m.Delta)
+			}
+			base, _, ok := labels.Parse(m.ID)
+			names[base] = true
+			if !ok {
+				continue
+			}
+			a := aggs[key{base, m.MType}]
+			if a == nil {
+				a = &overviewAggregate{Name: base, Type: m.MType, Min: v, Max: v}
+				aggs[key{base, m.MType}] = a
+			}
+			a.Series++
+			a.Sum += v
+			a.Min = math.Min(a.Min, v)
+			a.Max = math.Max(a.Max, v)
+		}
+		res.Summary.Names = len(names)
+		for _, a := range aggs {
+			a.Avg = a.Sum / float64(a.Series)
+			res.Aggregates = append(res.Aggregates, *a)
+		}
+		sort.Slice(res.Aggregates, func(i, j int) bool {
+			if res.Aggregates[i].Name != res.Aggregates[j].Name {
+				return res.Aggregates[i].Name < res.Aggregates[j].Name
+			}
+			return res.Aggregates[i].Type < res.Aggregates[j].Type
+		})
+
+		if engine != nil {
+			res.Alerts = []overviewAlert{}
+			res.Summary.AlertStates = make(map[string]int)
+			for _, rs := range engine.Rules() {
+				res.Alerts = append(res.Alerts, overviewAlert{Name: rs.Name, Expr: rs.Expr, State: rs.State, Value: rs.Value, Since: rs.Since})
+				res.Summary.AlertStates[rs.State]++
+			}
+		}
+
+		res.Fleet.Agents = []overviewAgent{}
+		now := time.Now()
+		for _, a := range queue.Agents() {
+			online := now.Sub(a.LastSeen) <= offlineAfter
+			if online {
+				res.Fleet.Online++
+			} else {
+				res.Fleet.Offline++
+			}
+			res.Fleet.Agents = append(res.Fleet.Agents, overviewAgent{Agent: a, Online: online})
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// Persistence сведения о сохранении метрик для отчёта об усилении записи
+type Persistence struct {
+	// Stats учёт записанных байт
+	Stats *storage.WriteStats
+	// Settings текущие настройки сохранения
+	Settings storage.SaveSettings
+}
+
+// writeReport обработчик GET /admin/persistence: сколько байт записано каждым
+// механизмом сохранения в расчёте на принятое обновление
+func (p *Persistence) writeReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.Stats.Report())
+}
+
+// guide обработчик GET /admin/persistence/guide: рекомендации по частоте
+// и формату сохранения для текущего набора метрик и потока обновлений
+func (h *Handler) guide(p *Persistence) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+			return
+		}
+		g, err := storage.NewGuide(r.Context(), h.storage, p.Stats, p.Settings)
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, g)
+	}
+}
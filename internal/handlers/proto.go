@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// isProto сообщает, передано ли тело запроса в формате Protocol Buffers
+func isProto(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == models.ContentTypeProto
+}
+
+// wantsProto выбирает формат ответа: явно запрошенный в Accept,
+// а иначе тот же, что у тела запроса
+func wantsProto(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, models.ContentTypeProto):
+		return true
+	case strings.Contains(accept, "application/json"):
+		return false
+	}
+	return isProto(r)
+}
+
+// readProto читает тело запроса в формате Protocol Buffers с ограничением размера
+func (h *Handler) readProto(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBody))
+	if err != nil {
+		if !bodyTooLarge(w, err) {
+			http.Error(w, "Не удалось прочитать тело запроса.", http.StatusBadRequest)
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+// decodeMetric читает метрику из тела запроса в формате JSON или Protocol Buffers
+func (h *Handler) decodeMetric(w http.ResponseWriter, r *http.Request, m *models.Metrics) bool {
+	if !isProto(r) {
+		return h.decodeJSON(w, r, m)
+	}
+	body, ok := h.readProto(w, r)
+	if !ok {
+		return false
+	}
+	var err error
+	if *m, err = models.UnmarshalProto(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// decodeBatch читает пакет метрик из тела запроса в формате JSON или Protocol Buffers
+func (h *Handler) decodeBatch(w http.ResponseWriter, r *http.Request, batch *[]models.Metrics) bool {
+	if !isProto(r) {
+		return h.decodeJSON(w, r, batch)
+	}
+	body, ok := h.readProto(w, r)
+	if !ok {
+		return false
+	}
+	var err error
+	if *batch, err = models.UnmarshalProtoList(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeMetric отправляет метрику в формате, выбранном по запросу
+func (h *Handler) writeMetric(w http.ResponseWriter, r *http.Request, m models.Metrics) {
+	if !wantsProto(r) {
+		writeFields(w, r, http.StatusOK, h.toJSON(m))
+		return
+	}
+	w.Header().Set("Content-Type", models.ContentTypeProto)
+	w.WriteHeader(http.StatusOK)
+	w.Write(models.AppendProto(nil, m))
+}
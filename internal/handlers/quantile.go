@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/history"
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// maxHeatmapSteps наибольшее число интервалов в одном запросе квантилей
+const maxHeatmapSteps = 1000
+
+// bucketJSON корзина гистограммы в ответе; граница — строка, чтобы
+// передать +Inf, которого нет в JSON
+type bucketJSON struct {
+	Le    string  `json:"le"`
+	Count float64 `json:"count"`
+}
+
+// quantileJSON значение квантиля; null, если по гистограмме его не оценить
+type quantileJSON struct {
+	Q     float64  `json:"q"`
+	Value *float64 `json:"value"`
+}
+
+// histogramPoint объединённая гистограмма за интервал, заканчивающийся в Timestamp
+type histogramPoint struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Count     float64        `json:"count"`
+	Quantiles []quantileJSON `json:"quantiles"`
+	Buckets   []bucketJSON   `json:"buckets"`
+}
+
+// histogramGroup точки одной группы гистограмм
+type histogramGroup struct {
+	Labels map[string]string `json:"labels"`
+	Series int               `json:"series"`
+	Points []histogramPoint  `json:"points"`
+}
+
+// quantileResponse ответ на запрос квантилей
+type quantileResponse struct {
+	Name   string           `json:"name"`
+	Groups []histogramGroup `json:"groups"`
+}
+
+// parseQuantiles разбирает список квантилей через запятую
+func parseQuantiles(s string) ([]float64, bool) {
+	if s == "" {
+		return []float64{0.5, 0.9, 0.99}, true
+	}
+	var qs []float64
+	for _, item := range splitList(s) {
+		q, err := strconv.ParseFloat(item, 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, false
+		}
+		qs = append(qs, q)
+	}
+	return qs, len(qs) > 0
+}
+
+// histogramPointOf переводит объединённую гистограмму в точку ответа
+func histogramPointOf(t time.Time, h labels.Histogram, qs []float64) histogramPoint {
+	p := histogramPoint{Timestamp: t, Count: h.Count(), Quantiles: make([]quantileJSON, 0, len(qs)), Buckets: make([]bucketJSON, 0, len(h.Buckets))}
+	for _, q := range qs {
+		qj := quantileJSON{Q: q}
+		if v := h.Quantile(q); !math.IsNaN(v) {
+			qj.Value = &v
+		}
+		p.Quantiles = append(p.Quantiles, qj)
+	}
+	for _, b := range h.Buckets {
+		p.Buckets = append(p.Buckets, bucketJSON{Le: strconv.FormatFloat(b.Le, 'g', -1, 64), Count: b.Count})
+	}
+	return p
+}
+
+// counterAt возвращает значение counter в момент t по его истории
+func counterAt(points []history.Sample, t time.Time) float64 {
+	i := sort.Search(len(points), func(i int) bool { return points[i].Timestamp.After(t) })
+	if i == 0 {
+		return 0
+	}
+	return points[i-1].Value
+}
+
+// quantile обработчик GET /quantile?name=latency&q=0.5,0.99&by=region
+// объединяет гистограммы рядов и оценивает квантили. Без from берутся
+// накопленные значения корзин; с from — прирост корзин за интервал
+// [from, to] из истории, а со step — за каждый шаг (тепловая карта).
+func (h *Handler) quantile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	name := q.Get("name")
+	if err := models.CheckName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.ContainsAny(name, "{}") {
+		http.Error(w, "Укажите базовое имя гистограммы без меток.", http.StatusBadRequest)
+		return
+	}
+	base := h.metricName(r, name)
+	qs, ok := parseQuantiles(q.Get("q"))
+	if !ok {
+		http.Error(w, "Неверное значение q: ожидаются числа от 0 до 1 через запятую.", http.StatusBadRequest)
+		return
+	}
+	g := labels.Grouping{By: splitList(q.Get("by")), Without: splitList(q.Get("without"))}
+	if len(g.By) > 0 && len(g.Without) > 0 {
+		http.Error(w, "Группировка задаётся либо by, либо without.", http.StatusBadRequest)
+		return
+	}
+
+	// Накопленные значения корзин всех рядов гистограммы
+	_, counters, err := h.store(r).GetAll(r.Context())
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	current := make(map[string]float64)
+	for n, v := range counters {
+		if b, _, ok := labels.Parse(n); ok && b == base+labels.BucketSuffix {
+			current[n] = float64(v)
+		}
+	}
+	if len(current) == 0 {
+		http.Error(w, "Гистограмма не найдена.", http.StatusNotFound)
+		return
+	}
+
+	var (
+		ends   []time.Time
+		frames []map[string]float64
+	)
+	if q.Get("from") == "" {
+		ends = []time.Time{time.Now()}
+		frames = []map[string]float64{current}
+	} else {
+		if h.history == nil {
+			http.Error(w, "Запись истории отключена.", http.StatusNotImplemented)
+			return
+		}
+		to, ok := parseTime(q.Get("to"), time.Now())
+		if !ok {
+			http.Error(w, "Неверное значение to.", http.StatusBadRequest)
+			return
+		}
+		from, ok := parseTime(q.Get("from"), to)
+		if !ok || !from.Before(to) {
+			http.Error(w, "Неверное значение from.", http.StatusBadRequest)
+			return
+		}
+		step, ok := parseStep(q.Get("step"))
+		if !ok {
+			http.Error(w, "Неверное значение step.", http.StatusBadRequest)
+			return
+		}
+		if step == 0 {
+			step = to.Sub(from)
+		}
+		if to.Sub(from)/step > maxHeatmapSteps {
+			http.Error(w, "Слишком много интервалов: увеличьте step.", http.StatusBadRequest)
+			return
+		}
+		bounds := []time.Time{from}
+		for t := from.Add(step); t.Before(to); t = t.Add(step) {
+			bounds = append(bounds, t)
+		}
+		bounds = append(bounds, to)
+		ends = bounds[1:]
+		frames = make([]map[string]float64, len(ends))
+		for i := range frames {
+			frames[i] = make(map[string]float64, len(current))
+		}
+		for n := range current {
+			points := h.history.Range(models.Counter, n, time.Time{}, to, 0)
+			prev := counterAt(points, bounds[0])
+			for i, end := range ends {
+				v := counterAt(points, end)
+				// Уменьшение counter — сброс: прирост считается от нуля
+				if v >= prev {
+					frames[i][n] = v - prev
+				} else {
+					frames[i][n] = v
+				}
+				prev = v
+			}
+		}
+	}
+
+	// Группы и число рядов берутся из текущих значений, точки — по интервалам
+	resp := quantileResponse{Name: clientName(r, base), Groups: []histogramGroup{}}
+	index := make(map[string]int)
+	for _, hist := range labels.MergeHistograms(current, base, g) {
+		index[labels.Format("", hist.Labels)] = len(resp.Groups)
+		resp.Groups = append(resp.Groups, histogramGroup{Labels: hist.Labels, Series: hist.Series, Points: []histogramPoint{}})
+	}
+	for i, frame := range frames {
+		for _, hist := range labels.MergeHistograms(frame, base, g) {
+			gi := index[labels.Format("", hist.Labels)]
+			resp.Groups[gi].Points = append(resp.Groups[gi].Points, histogramPointOf(ends[i], hist, qs))
+		}
+	}
+	writeFields(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/history"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// defaultQueryRange интервал запроса истории по умолчанию
+const defaultQueryRange = time.Hour
+
+// seriesResponse ответ на запрос истории
+type seriesResponse struct {
+	Name   string           `json:"name"`
+	Type   string           `json:"type"`
+	Points []history.Sample `json:"points"`
+}
+
+// parseTime разбирает время в формате RFC 3339 или в секундах Unix
+func parseTime(s string, def time.Time) (time.Time, bool) {
+	if s == "" {
+		return def, true
+	}
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(sec*float64(time.Second))), true
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, err == nil
+}
+
+// parseStep разбирает шаг в виде длительности (30s) или числа секунд
+func parseStep(s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, true
+	}
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(sec * float64(time.Second)), sec >= 0
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d >= 0
+}
+
+// query обработчик GET /query?name=X&type=gauge&from=...&to=...&step=...
+// возвращает историю значений метрики
+func (h *Handler) query(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.history == nil {
+		http.Error(w, "Запись истории отключена.", http.StatusNotImplemented)
+		return
+	}
+
+	q := r.URL.Query()
+	name := q.Get("name")
+	if err := models.CheckName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name = h.metricName(r, name)
+
+	// Если тип не указан, ищем сначала gauge, затем counter
+	mType := q.Get("type")
+	switch mType {
+	case models.Gauge, models.Counter:
+	case "":
+		mType = models.Gauge
+		if !h.history.Has(mType, name) && h.history.Has(models.Counter, name) {
+			mType = models.Counter
+		}
+	default:
+		http.Error(w, models.ErrInvalidType.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to, ok := parseTime(q.Get("to"), time.Now())
+	if !ok {
+		http.Error(w, "Неверное значение to.", http.StatusBadRequest)
+		return
+	}
+	from, ok := parseTime(q.Get("from"), to.Add(-defaultQueryRange))
+	if !ok || from.After(to) {
+		http.Error(w, "Неверное значение from.", http.StatusBadRequest)
+		return
+	}
+	step, ok := parseStep(q.Get("step"))
+	if !ok {
+		http.Error(w, "Неверное значение step.", http.StatusBadRequest)
+		return
+	}
+
+	h.markRead(mType, name)
+
+	// Запрос агрегатов: resolution — шаг уровня агрегации, agg — функция
+	if res := q.Get("resolution"); res != "" {
+		resolution, err := time.ParseDuration(res)
+		if err != nil {
+			http.Error(w, "Неверное значение resolution.", http.StatusBadRequest)
+			return
+		}
+		points, err := h.rollupPoints(mType, name, resolution, q.Get("agg"), from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeFields(w, r, http.StatusOK, seriesResponse{Name: clientName(r, name), Type: mType, Points: points})
+		return
+	}
+
+	writeFields(w, r, http.StatusOK, seriesResponse{
+		Name:   clientName(r, name),
+		Type:   mType,
+		Points: h.history.Range(mType, name, from, to, step),
+	})
+}
+
+// rollupPoints возвращает значения функции agg (по умолчанию avg)
+// по агрегатам ряда с шагом resolution
+func (h *Handler) rollupPoints(mType, name string, resolution time.Duration, agg string, from, to time.Time) ([]history.Sample, error) {
+	if agg == "" {
+		agg = "avg"
+	}
+	aggs, err := h.history.Rollups(mType, name, resolution, from, to)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]history.Sample, 0, len(aggs))
+	for _, a := range aggs {
+		v, err := a.Value(agg)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, history.Sample{Timestamp: a.Timestamp, Value: v})
+	}
+	return points, nil
+}
@@ -0,0 +1,1751 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/internal/alerts"
+	"github.com/iliodor1/metrics-service/internal/audit"
+	"github.com/iliodor1/metrics-service/internal/auth"
+	"github.com/iliodor1/metrics-service/internal/buildinfo"
+	"github.com/iliodor1/metrics-service/internal/commands"
+	"github.com/iliodor1/metrics-service/internal/freeze"
+	"github.com/iliodor1/metrics-service/internal/hygiene"
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/internal/middleware"
+	"github.com/iliodor1/metrics-service/internal/offsets"
+	"github.com/iliodor1/metrics-service/internal/openapi"
+	"github.com/iliodor1/metrics-service/internal/privacy"
+	"github.com/iliodor1/metrics-service/internal/replica"
+	"github.com/iliodor1/metrics-service/internal/selfmetrics"
+	"github.com/iliodor1/metrics-service/internal/slo"
+	"github.com/iliodor1/metrics-service/internal/stream"
+	"github.com/iliodor1/metrics-service/internal/synthetic"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/internal/tracing"
+)
+
+// route маршрут сервера вместе с его описанием для спецификации OpenAPI.
+// Спецификация строится из тех же маршрутов, что регистрируются в ServeMux,
+// поэтому она не расходится с обработчиками.
+type route struct {
+	pattern string
+	handler http.Handler
+	docs    []openapi.Endpoint
+	// tenant маршрут работает с метриками арендатора запроса
+	tenant bool
+	// admin маршрут административного API
+	admin bool
+	// idempotent повторы обновления с тем же ключом идемпотентности
+	// или смещением источника не применяются
+	idempotent bool
+	// read маршрут чтения метрик: клиент выбирает согласованность чтения
+	read bool
+	// write маршрут изменяет метрики арендатора: при проверке токенов
+	// он требует права metrics:write, остальные маршруты арендатора —
+	// metrics:read
+	write bool
+	// settings состояние раздела настроек section, который меняет маршрут;
+	// изменения отмечаются в журнале аудита (nil — маршрут настроек не меняет)
+	section  string
+	settings func() any
+}
+
+// Общие элементы описания API
+var (
+	typeParam = openapi.PathParam("type", "тип метрики", &openapi.Schema{Type: "string", Enum: []string{"gauge", "counter", "summary"}})
+	nameParam = openapi.PathParam("name", "имя метрики", &openapi.Schema{Type: "string"})
+	unitParam = openapi.QueryParam("unit", "единица измерения", &openapi.Schema{Type: "string"})
+
+	respOK            = openapi.Response{Description: "успешно"}
+	respBadRequest    = openapi.Response{Description: "неверный запрос", Content: openapi.Text()}
+	respNotFound      = openapi.Response{Description: "метрика не найдена", Content: openapi.Text()}
+	respTooMany       = openapi.Response{Description: "превышен лимит запросов или наибольшее число метрик", Headers: rateLimitHeaders, Content: openapi.Text()}
+	respReadOnly      = openapi.Response{Description: "хранилище доступно только для чтения", Content: openapi.Text()}
+	respNotAcceptable = openapi.Response{Description: "клиент не принимает ни один из доступных форматов", Content: openapi.Text()}
+	respNoKey         = openapi.Response{Description: "не передан действительный API-ключ арендатора", Content: openapi.Text()}
+	respNoToken       = openapi.Response{Description: "не передан токен администратора", Content: openapi.Text()}
+	respAdminOff      = openapi.Response{Description: "административное API отключено: токен администратора не задан", Content: openapi.Text()}
+	respNoAuth        = openapi.Response{Description: "не переданы действительные токен доступа или сертификат клиента", Headers: authHeaders, Content: openapi.Text()}
+	respNoKeyOrAuth   = openapi.Response{Description: "не передан действительный API-ключ арендатора или токен доступа", Headers: authHeaders, Content: openapi.Text()}
+	respNoScope       = openapi.Response{Description: "у клиента нет нужного права", Headers: authHeaders, Content: openapi.Text()}
+	respMemoryBudget  = openapi.Response{Description: "превышен бюджет памяти на метрики", Content: openapi.Text()}
+	respBodyTooLarge  = openapi.Response{Description: "тело запроса больше -max-body-size или превышен бюджет памяти на метрики", Content: openapi.Text()}
+	respInFlight      = openapi.Response{Description: "запрос с тем же ключом идемпотентности ещё выполняется", Content: openapi.Text()}
+	respFrozen        = openapi.Response{Description: "обновления метрики заморожены; Retry-After — конец окна заморозки", Content: openapi.Text()}
+
+	consistencyParams = []openapi.Parameter{
+		openapi.QueryParam("consistency", "согласованность чтения на реплике: strong — через основной сервер, eventual — из локального хранилища (по умолчанию)", &openapi.Schema{Type: "string", Enum: []string{consistencyStrong, consistencyEventual}}),
+		openapi.HeaderParam(consistencyHeader, "то же, что параметр consistency", &openapi.Schema{Type: "string", Enum: []string{consistencyStrong, consistencyEventual}}),
+	}
+	fieldsQuery   = openapi.QueryParam(fieldsParam, "поля ответа JSON через запятую, например value,timestamp: в объектах ответа остаются только они", &openapi.Schema{Type: "string"})
+	respNoPrimary = openapi.Response{Description: "основной сервер недоступен для чтения со строгой согласованностью", Content: openapi.Text()}
+
+	idempotencyParam = openapi.HeaderParam(middleware.IdempotencyHeader, "ключ идемпотентности: повтор запроса с тем же ключом не применяется заново", &openapi.Schema{Type: "string"})
+	partitionParam   = openapi.HeaderParam(offsets.PartitionHeader, "раздел источника конвейера, например orders/3; передаётся вместе со смещением", &openapi.Schema{Type: "string"})
+	offsetParam      = openapi.HeaderParam(offsets.OffsetHeader, "смещение сообщения в разделе: сообщение со смещением не больше применённого не применяется и получает ответ с заголовком "+offsets.DuplicateHeader, &openapi.Schema{Type: "integer", Format: "int64"})
+	respMetric       = openapi.Response{Description: "текущее значение метрики; формат выбирается по Accept или по телу запроса", Content: openapi.WithProto(openapi.JSON(openapi.Ref("Metrics")), "Metric")}
+)
+
+// rateLimitHeaders заголовки ограничителя частоты запросов
+var rateLimitHeaders = map[string]openapi.Header{
+	"X-RateLimit-Limit":     {Description: "наибольшее число запросов подряд", Schema: &openapi.Schema{Type: "integer"}},
+	"X-RateLimit-Remaining": {Description: "число запросов, которые можно сделать сразу", Schema: &openapi.Schema{Type: "integer"}},
+	"X-RateLimit-Reset":     {Description: "секунд до полного восстановления лимита", Schema: &openapi.Schema{Type: "integer"}},
+	"Retry-After":           {Description: "секунд до следующей попытки", Schema: &openapi.Schema{Type: "integer"}},
+}
+
+// authHeaders заголовки отказа в доступе по токену
+var authHeaders = map[string]openapi.Header{
+	"WWW-Authenticate": {Description: "причина отказа по RFC 6750: invalid_token или insufficient_scope с нужным правом", Schema: &openapi.Schema{Type: "string"}},
+}
+
+// schemas схемы данных API
+func schemas() map[string]*openapi.Schema {
+	return map[string]*openapi.Schema{
+		"Metrics": {
+			Type:     "object",
+			Required: []string{"id", "type"},
+			Properties: map[string]*openapi.Schema{
+				"id":    {Type: "string", Description: "имя метрики"},
+				"type":  {Type: "string", Enum: []string{"gauge", "counter", "summary"}},
+				"delta": {Type: "integer", Format: "int64", Description: "значение counter"},
+				"value": {Type: "number", Format: "double", Description: "значение gauge или наблюдение summary"},
+				"unit":  {Type: "string", Description: "единица измерения в ответе GET /value/{type}/{name}"},
+			},
+		},
+		"Summary": {
+			Type:        "object",
+			Description: "значение summary: число и сумма наблюдений, оценки квантилей (null — оценки ещё нет)",
+			Properties: map[string]*openapi.Schema{
+				"id":    {Type: "string"},
+				"type":  {Type: "string", Enum: []string{"summary"}},
+				"count": {Type: "integer", Format: "int64"},
+				"sum":   {Type: "number", Format: "double"},
+				"quantiles": {Type: "array", Items: &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"q":     {Type: "number", Format: "double"},
+						"value": {Type: "number", Format: "double"},
+					},
+				}},
+			},
+		},
+		"Series": {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"name": {Type: "string"},
+				"type": {Type: "string", Enum: []string{"gauge", "counter"}},
+				"points": {Type: "array", Items: &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"timestamp": {Type: "string", Format: "date-time"},
+						"value":     {Type: "number", Format: "double"},
+					},
+				}},
+			},
+		},
+		"Aggregate": {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"name":  {Type: "string"},
+				"match": {Type: "string", Description: "шаблон имён при агрегации по match"},
+				"type":  {Type: "string", Enum: []string{"gauge", "counter"}},
+				"agg":   {Type: "string", Enum: labels.Funcs},
+				"groups": {Type: "array", Items: &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"labels": {Type: "object", Description: "метки группы"},
+						"value":  {Type: "number", Format: "double"},
+						"series": {Type: "integer", Description: "число рядов группы"},
+					},
+				}},
+			},
+		},
+		"Histogram": {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"name": {Type: "string"},
+				"groups": {Type: "array", Items: &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"labels": {Type: "object", Description: "метки группы"},
+						"series": {Type: "integer", Description: "число объединённых гистограмм"},
+						"points": {Type: "array", Items: &openapi.Schema{
+							Type: "object",
+							Properties: map[string]*openapi.Schema{
+								"timestamp": {Type: "string", Format: "date-time", Description: "конец интервала"},
+								"count":     {Type: "number", Format: "double", Description: "число наблюдений"},
+								"quantiles": {Type: "array", Items: &openapi.Schema{
+									Type: "object",
+									Properties: map[string]*openapi.Schema{
+										"q":     {Type: "number", Format: "double"},
+										"value": {Type: "number", Format: "double", Description: "null, если наблюдений нет"},
+									},
+								}},
+								"buckets": {Type: "array", Items: &openapi.Schema{
+									Type: "object",
+									Properties: map[string]*openapi.Schema{
+										"le":    {Type: "string", Description: "верхняя граница корзины, в том числе +Inf"},
+										"count": {Type: "number", Format: "double"},
+									},
+								}},
+							},
+						}},
+					},
+				}},
+			},
+		},
+		"AlertRule": {
+			Type:     "object",
+			Required: []string{"name", "expr"},
+			Properties: map[string]*openapi.Schema{
+				"name":    {Type: "string"},
+				"expr":    {Type: "string", Description: "условие, например gauge Alloc > 1e9 for 5m"},
+				"webhook": {Type: "string", Description: "адрес оповещения; по умолчанию общий"},
+				"state":   {Type: "string", Enum: []string{alerts.StateInactive, alerts.StatePending, alerts.StateFiring, alerts.StateResolved}},
+			},
+		},
+		"FreezeWindow": {
+			Type:     "object",
+			Required: []string{"name", "prefixes", "start", "end"},
+			Properties: map[string]*openapi.Schema{
+				"name":     {Type: "string"},
+				"prefixes": {Type: "array", Items: &openapi.Schema{Type: "string"}, Description: "префиксы имён метрик; метрики арендатора хранятся с префиксом арендатора"},
+				"start":    {Type: "string", Format: "date-time"},
+				"end":      {Type: "string", Format: "date-time"},
+				"reason":   {Type: "string", Description: "причина заморозки в ответах 423"},
+				"active":   {Type: "boolean", Description: "окно действует сейчас; только в ответе"},
+			},
+		},
+		"SLO": {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"name":                   {Type: "string"},
+				"target":                 {Type: "number", Format: "double", Description: "целевая доля успешных событий"},
+				"window":                 {Type: "string", Description: "окно цели, например 30d"},
+				"good":                   {Type: "number", Format: "double", Description: "успешных событий за окно"},
+				"total":                  {Type: "number", Format: "double", Description: "всех событий за окно"},
+				"compliance":             {Type: "number", Format: "double", Description: "доля успешных событий; null без событий"},
+				"error_budget_remaining": {Type: "number", Format: "double", Description: "доля неизрасходованного бюджета ошибок"},
+				"burn_rates":             {Type: "object", Description: "скорость расходования бюджета по окнам"},
+				"since":                  {Type: "string", Format: "date-time", Description: "начало наблюдения"},
+			},
+		},
+		"BuildInfo": {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"version":    {Type: "string", Description: "N/A, если не задана при сборке"},
+				"date":       {Type: "string"},
+				"commit":     {Type: "string"},
+				"go_version": {Type: "string"},
+			},
+		},
+		"AuditEntry": {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"time":    {Type: "string", Format: "date-time"},
+				"remote":  {Type: "string", Description: "IP-адрес клиента или SIGHUP"},
+				"key_id":  {Type: "string", Description: "идентификатор API-ключа клиента"},
+				"client":  {Type: "string", Description: "имя токена доступа клиента или subject JWT"},
+				"action":  {Type: "string", Enum: []string{audit.ActionUpdate, audit.ActionRestore, audit.ActionImport, audit.ActionConfig}},
+				"type":    {Type: "string", Enum: []string{"gauge", "counter"}},
+				"name":    {Type: "string", Description: "имя метрики в хранилище"},
+				"delta":   {Type: "integer", Format: "int64", Description: "приращение counter при обновлении"},
+				"value":   {Type: "number", Format: "double", Description: "значение после изменения"},
+				"section": {Type: "string", Description: "раздел настроек (action config)"},
+				"before":  {Description: "состояние раздела настроек до изменения"},
+				"after":   {Description: "состояние раздела настроек после изменения"},
+			},
+		},
+		"Readiness": {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"ready": {Type: "boolean"},
+				"checks": {
+					Type:        "object",
+					Description: "итоги проверок: ok или причина неготовности",
+					Properties: map[string]*openapi.Schema{
+						"storage":  {Type: "string", Description: "доступность хранилища"},
+						"restore":  {Type: "string", Description: "pending — метрики ещё не восстановлены"},
+						"shutdown": {Type: "string", Description: "stopping — сервер останавливается"},
+					},
+				},
+			},
+		},
+		"HygieneReport": {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"generated_at": {Type: "string", Format: "date-time"},
+				"window":       {Type: "string", Description: "срок без чтений или изменений, после которого метрика подозрительна"},
+				"metrics":      {Type: "integer", Description: "число проверенных метрик"},
+				"findings": {Type: "array", Items: &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"name":        {Type: "string", Description: "имя метрики в хранилище"},
+						"type":        {Type: "string", Enum: []string{"gauge", "counter"}},
+						"issues":      {Type: "array", Items: &openapi.Schema{Type: "string", Enum: []string{hygiene.IssueNeverRead, hygiene.IssueConstant, hygiene.IssueNaming, hygiene.IssueNearDuplicate}}},
+						"naming":      {Type: "string", Description: "чем имя нарушает правила"},
+						"similar":     {Type: "array", Items: &openapi.Schema{Type: "string"}, Description: "метрики с почти совпадающими именами"},
+						"last_change": {Type: "string", Format: "date-time"},
+						"last_read":   {Type: "string", Format: "date-time"},
+					},
+				}},
+			},
+		},
+		"SourceOffset": {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"key_id":    {Type: "string", Description: "идентификатор API-ключа клиента"},
+				"partition": {Type: "string"},
+				"offset":    {Type: "integer", Format: "int64", Description: "последнее применённое смещение"},
+			},
+		},
+		"SyntheticSeries": {
+			Type:     "object",
+			Required: []string{"name", "kind"},
+			Properties: map[string]*openapi.Schema{
+				"name":        {Type: "string", Description: "имя метрики, может содержать метки"},
+				"kind":        {Type: "string", Enum: synthetic.Kinds},
+				"min":         {Type: "number", Format: "double"},
+				"max":         {Type: "number", Format: "double"},
+				"period":      {Type: "string", Description: "период синусоиды, например 5m"},
+				"step":        {Type: "number", Format: "double", Description: "средний шаг блуждания"},
+				"probability": {Type: "number", Format: "double", Description: "вероятность всплеска при обновлении"},
+				"rate":        {Type: "number", Format: "double", Description: "средний прирост counter в секунду"},
+				"noise":       {Type: "number", Format: "double", Description: "доля случайного шума"},
+			},
+		},
+		"TenantKey": {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"id":     {Type: "string", Description: "идентификатор ключа"},
+				"tenant": {Type: "string"},
+				"key":    {Type: "string", Description: "сам ключ; возвращается только при выпуске"},
+			},
+		},
+		"Command": {
+			Type:     "object",
+			Required: []string{"type"},
+			Properties: map[string]*openapi.Schema{
+				"type":      {Type: "string", Enum: []string{commands.SetReportInterval, commands.FullSync, commands.Collect}},
+				"interval":  {Type: "string", Description: "новая частота отправки, например 5s"},
+				"collector": {Type: "string", Enum: []string{commands.CollectorRuntime, commands.CollectorSystem}},
+			},
+		},
+	}
+}
+
+// Services подсистемы сервера, маршруты которых регистрируются
+// вместе с обработчиками метрик
+type Services struct {
+	// Commands очереди команд агентам
+	Commands *commands.Queue
+	// Alerts движок оповещений (nil — оповещения отключены)
+	Alerts *alerts.Engine
+	// SLO цели уровня обслуживания (nil — не отслеживаются)
+	SLO *slo.Tracker
+	// Synthetic генератор тестовых рядов (nil — режим -synthetic выключен)
+	Synthetic *synthetic.Generator
+	// Stream рассылка обновлений метрик по WebSocket (nil — поток отключён)
+	Stream *stream.Hub
+	// Tenants API-ключи арендаторов (nil — метрики не разделяются по арендаторам)
+	Tenants *tenant.Registry
+	// Limit оборачивает обработчики обновления ограничителем частоты запросов
+	Limit func(http.Handler) http.Handler
+	// Idempotency оборачивает обработчики обновления проверкой ключа
+	// идемпотентности (nil — ключи не учитываются)
+	Idempotency func(http.Handler) http.Handler
+	// Offsets отбрасывает повторно доставленные сообщения конвейеров
+	// по смещениям источника (nil — смещения не учитываются)
+	Offsets *offsets.Tracker
+	// Persistence учёт записей механизмов сохранения (nil — отчёт отключён)
+	Persistence *Persistence
+	// Replica репликация с основного сервера (nil — сервер не реплика)
+	Replica *replica.Replica
+	// Privacy искажение чувствительных метрик для внешних потребителей
+	// (nil — маршрута GET /export/public нет)
+	Privacy *privacy.Policy
+	// Freeze окна заморозки обновлений метрик (nil — заморозка отключена)
+	Freeze *freeze.Registry
+	// Tracer трассировка запросов OpenTelemetry (nil — выключена)
+	Tracer *tracing.Tracer
+	// Self сборщик метрик самого сервера (nil — запросы не учитываются)
+	Self *selfmetrics.Recorder
+	// Health состояние сервера для пробы готовности (nil — готовность
+	// определяется только доступностью хранилища)
+	Health *Health
+	// Backup каталог резервных копий (nil — копии только скачиваются и загружаются)
+	Backup *Backup
+	// AdminToken токен доступа к административным маршрутам (пустой —
+	// маршруты отклоняют все запросы)
+	AdminToken string
+	// Auth проверка клиентов маршрутов метрик (nil — без проверки)
+	Auth auth.Authenticator
+	// Build сведения о сборке сервера для GET /version
+	Build buildinfo.Info
+	// Reload перечитывает изменяемые на ходу настройки и возвращает
+	// обновлённые разделы (nil — перечитывание недоступно)
+	Reload func() ([]string, error)
+	// Settings состояние перечитываемых настроек для журнала аудита
+	Settings func() any
+}
+
+// routes возвращает маршруты сервера
+func routes(h *Handler, svc Services) []route {
+	limit := svc.Limit
+	if limit == nil {
+		limit = func(h http.Handler) http.Handler { return h }
+	}
+	if idem := svc.Idempotency; idem != nil {
+		// Запрос, отклонённый ограничителем, не запоминается по ключу
+		rateLimit := limit
+		limit = func(h http.Handler) http.Handler { return rateLimit(idem(h)) }
+	}
+	if tr := svc.Offsets; tr != nil {
+		// Смещение запоминается, только когда обновление применено
+		outer := limit
+		limit = func(h http.Handler) http.Handler { return outer(tr.Middleware(h)) }
+	}
+	queue := svc.Commands
+
+	rs := []route{
+		{
+			pattern: "/{$}",
+			read:    true,
+			tenant:  true,
+			handler: http.HandlerFunc(h.index),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/",
+				Operation: openapi.Operation{
+					Summary:     "Список всех метрик, упорядоченный по имени и типу",
+					Description: "Формат выбирается по заголовку Accept: HTML (по умолчанию), JSON или текст.",
+					Tags:        []string{"value"},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "список метрик", Content: map[string]openapi.MediaType{
+							"text/html":        {Schema: &openapi.Schema{Type: "string"}},
+							"application/json": {Schema: &openapi.Schema{Type: "array", Items: openapi.Ref("Metrics")}},
+							"text/plain":       {Schema: &openapi.Schema{Type: "string", Description: "строки вида <type> <name> <value>"}},
+						}},
+						"406": respNotAcceptable,
+					},
+				},
+			}},
+		},
+		{
+			pattern:    "/update/",
+			write:      true,
+			tenant:     true,
+			idempotent: true,
+			handler:    limit(http.HandlerFunc(h.webhook)),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/update/{type}/{name}/{value}",
+				Operation: openapi.Operation{
+					Summary:    "Обновить метрику",
+					Tags:       []string{"update"},
+					Parameters: []openapi.Parameter{typeParam, nameParam, openapi.PathParam("value", "значение", &openapi.Schema{Type: "string"}), unitParam},
+					Responses:  map[string]openapi.Response{"200": respOK, "400": respBadRequest, "403": respReadOnly, "404": respNotFound, "413": respMemoryBudget, "423": respFrozen, "429": respTooMany},
+				},
+			}},
+		},
+		{
+			pattern:    "/update/{$}",
+			write:      true,
+			tenant:     true,
+			idempotent: true,
+			handler:    limit(http.HandlerFunc(h.updateJSON)),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/update/",
+				Operation: openapi.Operation{
+					Summary:     "Обновить метрику в формате JSON или Protocol Buffers",
+					Tags:        []string{"update"},
+					RequestBody: &openapi.RequestBody{Required: true, Content: openapi.WithProto(openapi.JSON(openapi.Ref("Metrics")), "Metric")},
+					Responses:   map[string]openapi.Response{"200": respMetric, "400": respBadRequest, "403": respReadOnly, "413": respBodyTooLarge, "423": respFrozen, "429": respTooMany},
+				},
+			}},
+		},
+		{
+			pattern:    "/updates/{$}",
+			write:      true,
+			tenant:     true,
+			idempotent: true,
+			handler:    limit(http.HandlerFunc(h.updates)),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/updates/",
+				Operation: openapi.Operation{
+					Summary:     "Обновить пакет метрик",
+					Tags:        []string{"update"},
+					RequestBody: &openapi.RequestBody{Required: true, Content: openapi.WithProto(openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("Metrics")}), "MetricList")},
+					Responses:   map[string]openapi.Response{"200": respOK, "400": respBadRequest, "403": respReadOnly, "413": respBodyTooLarge, "423": respFrozen, "429": respTooMany},
+				},
+			}},
+		},
+		{
+			pattern: "/value/",
+			read:    true,
+			tenant:  true,
+			handler: http.HandlerFunc(h.value),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/value/{type}/{name}",
+				Operation: openapi.Operation{
+					Summary: "Получить значение метрики",
+					Description: "Формат выбирается по заголовку Accept: текст (по умолчанию), JSON или HTML. " +
+						"Summary возвращается в JSON по схеме Summary, а в тексте — строкой count=… sum=… p50=… p90=… p99=….",
+					Tags:       []string{"value"},
+					Parameters: []openapi.Parameter{typeParam, nameParam, unitParam},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "значение метрики", Content: map[string]openapi.MediaType{
+							"text/plain":       {Schema: &openapi.Schema{Type: "string"}},
+							"application/json": {Schema: openapi.Ref("Metrics")},
+							"text/html":        {Schema: &openapi.Schema{Type: "string"}},
+						}},
+						"400": respBadRequest,
+						"404": respNotFound,
+						"406": respNotAcceptable,
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/value/{$}",
+			read:    true,
+			tenant:  true,
+			handler: http.HandlerFunc(h.valueJSON),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/value/",
+				Operation: openapi.Operation{
+					Summary:     "Получить значение метрики в формате JSON или Protocol Buffers",
+					Tags:        []string{"value"},
+					RequestBody: &openapi.RequestBody{Required: true, Content: openapi.WithProto(openapi.JSON(openapi.Ref("Metrics")), "Metric")},
+					Responses:   map[string]openapi.Response{"200": respMetric, "400": respBadRequest, "404": respNotFound},
+				},
+			}},
+		},
+		{
+			pattern: "/query",
+			read:    true,
+			tenant:  true,
+			handler: http.HandlerFunc(h.query),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/query",
+				Operation: openapi.Operation{
+					Summary: "Получить историю значений метрики",
+					Tags:    []string{"value"},
+					Parameters: []openapi.Parameter{
+						{Name: "name", In: "query", Required: true, Description: "имя метрики", Schema: &openapi.Schema{Type: "string"}},
+						openapi.QueryParam("type", "тип метрики; по умолчанию gauge, затем counter", &openapi.Schema{Type: "string", Enum: []string{"gauge", "counter"}}),
+						openapi.QueryParam("from", "начало интервала: RFC 3339 или секунды Unix; по умолчанию час назад", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("to", "конец интервала: RFC 3339 или секунды Unix; по умолчанию сейчас", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("step", "шаг разбиения: длительность (30s) или секунды", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("resolution", "шаг агрегатов: 1m, 5m или 1h", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("agg", "функция агрегации; по умолчанию avg", &openapi.Schema{Type: "string", Enum: []string{"min", "max", "sum", "avg", "count"}}),
+					},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "ряд значений", Content: openapi.JSON(openapi.Ref("Series"))},
+						"400": respBadRequest,
+						"501": {Description: "запись истории отключена", Content: openapi.Text()},
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/aggregate",
+			read:    true,
+			tenant:  true,
+			handler: http.HandlerFunc(h.aggregate),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/aggregate",
+				Operation: openapi.Operation{
+					Summary:     "Агрегировать текущие значения рядов по меткам или метрик по шаблону имени",
+					Description: "Метки записываются в имени метрики: cpu{host=web1,core=0}. Ряды с базовым именем name группируются по меткам by или по всем, кроме without. С параметром match вместо name значения всех метрик с подходящими именами сводятся в одну группу.",
+					Tags:        []string{"value"},
+					Parameters: []openapi.Parameter{
+						openapi.QueryParam("name", "базовое имя метрики без меток; обязательно без match", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("match", "шаблон имён метрик в синтаксисе path.Match, например prefix.*", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("type", "тип метрики; по умолчанию gauge, затем counter, а с match — gauge", &openapi.Schema{Type: "string", Enum: []string{"gauge", "counter"}}),
+						openapi.QueryParam("by", "метки группировки через запятую; без by и without все ряды сводятся в один", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("without", "метки, по которым ряды сводятся, через запятую", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("agg", "функция агрегации; по умолчанию sum", &openapi.Schema{Type: "string", Enum: labels.Funcs}),
+						openapi.QueryParam("fn", "то же, что agg", &openapi.Schema{Type: "string", Enum: labels.Funcs}),
+					},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "значения по группам", Content: openapi.JSON(openapi.Ref("Aggregate"))},
+						"400": respBadRequest,
+						"404": respNotFound,
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/quantile",
+			read:    true,
+			tenant:  true,
+			handler: http.HandlerFunc(h.quantile),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/quantile",
+				Operation: openapi.Operation{
+					Summary:     "Объединить гистограммы и оценить квантили",
+					Description: "Гистограмма name хранится как counter корзин name_bucket{...,le=0.1} ... name_bucket{...,le=+Inf}. Корзины рядов складываются по группам by или without.",
+					Tags:        []string{"value"},
+					Parameters: []openapi.Parameter{
+						{Name: "name", In: "query", Required: true, Description: "базовое имя гистограммы без _bucket и меток", Schema: &openapi.Schema{Type: "string"}},
+						openapi.QueryParam("q", "квантили через запятую; по умолчанию 0.5,0.9,0.99", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("by", "метки группировки через запятую", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("without", "метки, по которым гистограммы объединяются, через запятую", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("from", "начало интервала: RFC 3339 или секунды Unix; без него — накопленные значения", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("to", "конец интервала; по умолчанию сейчас", &openapi.Schema{Type: "string"}),
+						openapi.QueryParam("step", "шаг тепловой карты: длительность (1m) или секунды", &openapi.Schema{Type: "string"}),
+					},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "квантили и корзины по группам", Content: openapi.JSON(openapi.Ref("Histogram"))},
+						"400": respBadRequest,
+						"404": {Description: "гистограмма не найдена", Content: openapi.Text()},
+						"501": {Description: "запись истории отключена", Content: openapi.Text()},
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/export",
+			tenant:  true,
+			handler: http.HandlerFunc(h.export),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/export",
+				Operation: openapi.Operation{
+					Summary:     "Выгрузить все метрики одним документом JSON или NDJSON",
+					Description: "Значения gauge выгружаются точно, counter — итоговым значением в delta.",
+					Tags:        []string{"value"},
+					Parameters: []openapi.Parameter{
+						openapi.QueryParam("format", "формат выгрузки; без него выбирается по Accept", &openapi.Schema{Type: "string", Enum: []string{exportJSON, exportNDJSON}}),
+						openapi.QueryParam("type", "тип метрики", &openapi.Schema{Type: "string", Enum: []string{"gauge", "counter"}}),
+						openapi.QueryParam("prefix", "начало имени метрики", &openapi.Schema{Type: "string"}),
+					},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "метрики, упорядоченные по имени и типу", Content: map[string]openapi.MediaType{
+							"application/json": {Schema: &openapi.Schema{Type: "array", Items: openapi.Ref("Metrics")}},
+							ContentTypeNDJSON:  {Schema: openapi.Ref("Metrics")},
+						}},
+						"400": respBadRequest,
+						"406": respNotAcceptable,
+					},
+				},
+			}},
+		},
+		{
+			pattern:    "/import",
+			write:      true,
+			tenant:     true,
+			idempotent: true,
+			handler:    limit(http.HandlerFunc(h.importDump)),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/import",
+				Operation: openapi.Operation{
+					Summary: "Загрузить выгрузку GET /export в формате JSON или NDJSON",
+					Description: "В режиме merge counter прибавляется к текущему значению, как в /updates; в режиме replace метрики получают значения из выгрузки. " +
+						"Метрики, которых нет в выгрузке, не удаляются.",
+					Tags: []string{"update"},
+					Parameters: []openapi.Parameter{
+						openapi.QueryParam("mode", "режим импорта; по умолчанию merge", &openapi.Schema{Type: "string", Enum: []string{importMerge, importReplace}}),
+						openapi.QueryParam("dry_run", "не менять метрики, а перечислить изменения", &openapi.Schema{Type: "boolean"}),
+					},
+					RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+						"application/json": {Schema: &openapi.Schema{Type: "array", Items: openapi.Ref("Metrics")}},
+						ContentTypeNDJSON:  {Schema: openapi.Ref("Metrics")},
+					}},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "число созданных, изменённых и неизменных метрик; при dry_run — и сами изменения", Content: openapi.JSON(&openapi.Schema{Type: "object"})},
+						"400": respBadRequest,
+						"403": respReadOnly,
+						"413": respMemoryBudget,
+						"423": respFrozen,
+						"429": respTooMany,
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/api/stream-ingest",
+			write:   true,
+			tenant:  true,
+			handler: limit(http.HandlerFunc(h.streamIngest)),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/api/stream-ingest",
+				Operation: openapi.Operation{
+					Summary:     "Потоковый приём метрик в формате JSON Lines: по метрике в строке в долгом запросе",
+					Tags:        []string{"update"},
+					RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{ContentTypeNDJSON: {Schema: openapi.Ref("Metrics")}}},
+					Responses: map[string]openapi.Response{
+						"200": {
+							Description: "подтверждения раз в секунду и итоговое в конце потока; итог также в трейлерах " + trailerApplied + ", " + trailerFailed + " и " + trailerLastError,
+							Content: map[string]openapi.MediaType{ContentTypeNDJSON: {Schema: &openapi.Schema{
+								Type: "object",
+								Properties: map[string]*openapi.Schema{
+									"lines":      {Type: "integer", Description: "прочитанные строки"},
+									"applied":    {Type: "integer", Description: "применённые метрики"},
+									"failed":     {Type: "integer", Description: "отклонённые строки"},
+									"last_error": {Type: "string", Description: "причина последнего отказа"},
+								},
+							}}},
+						},
+						"403": respReadOnly,
+						"423": respFrozen,
+						"429": respTooMany,
+					},
+				},
+			}},
+		},
+		{
+			pattern:    "/jobs/{name}/{event}",
+			write:      true,
+			tenant:     true,
+			idempotent: true,
+			handler:    limit(http.HandlerFunc(h.jobEvent)),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/jobs/{name}/{event}",
+				Operation: openapi.Operation{
+					Summary:     "Отметить запуск или завершение пакетного задания",
+					Description: "Сервер сам ведёт метрики задания с меткой job: JobLastStartTime, JobRunning, JobLastSuccessTime, JobLastFailureTime, JobLastStatus, JobLastDurationSeconds и JobRuns{status=success|failure}. Оповещение о задании, давно не завершавшемся успешно, строится по JobLastSuccessTime.",
+					Tags:        []string{"update"},
+					Parameters: []openapi.Parameter{
+						openapi.PathParam("name", "имя задания", &openapi.Schema{Type: "string"}),
+						openapi.PathParam("event", "событие", &openapi.Schema{Type: "string", Enum: []string{jobStart, jobSuccess, jobFailure}}),
+						openapi.QueryParam("duration", "длительность запуска, например 90s, если запуск не отмечался; только для success и failure", &openapi.Schema{Type: "string"}),
+					},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "состояние задания", Content: openapi.JSON(&openapi.Schema{
+							Type: "object",
+							Properties: map[string]*openapi.Schema{
+								"job":              {Type: "string"},
+								"event":            {Type: "string"},
+								"running":          {Type: "boolean"},
+								"duration_seconds": {Type: "number", Description: "длительность завершённого запуска"},
+							},
+						})},
+						"400": respBadRequest,
+						"403": respReadOnly,
+						"404": {Description: "неизвестное событие", Content: openapi.Text()},
+						"413": respMemoryBudget,
+						"423": respFrozen,
+						"429": respTooMany,
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/api/overview",
+			read:    true,
+			tenant:  true,
+			handler: h.overview(queue, svc.Alerts),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/api/overview",
+				Operation: openapi.Operation{
+					Summary:     "Сводка для панели одним запросом",
+					Description: "Список метрик, число метрик по типам, сводки рядов с метками по базовым именам, состояния правил оповещений и доступность агентов. Агент доступен, если запрашивал команды не дольше offline_after назад.",
+					Tags:        []string{"value"},
+					Parameters: []openapi.Parameter{
+						openapi.QueryParam("offline_after", "время без запросов команд, после которого агент недоступен; по умолчанию 1m", &openapi.Schema{Type: "string"}),
+					},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "сводка", Content: openapi.JSON(&openapi.Schema{
+							Type: "object",
+							Properties: map[string]*openapi.Schema{
+								"metrics": {Type: "array", Items: openapi.Ref("Metrics")},
+								"summary": {
+									Type: "object",
+									Properties: map[string]*openapi.Schema{
+										"gauges":       {Type: "integer"},
+										"counters":     {Type: "integer"},
+										"names":        {Type: "integer", Description: "число базовых имён без учёта меток"},
+										"alert_states": {Type: "object", Description: "число правил оповещений в каждом состоянии"},
+									},
+								},
+								"aggregates": {Type: "array", Items: &openapi.Schema{
+									Type: "object",
+									Properties: map[string]*openapi.Schema{
+										"name":   {Type: "string", Description: "базовое имя"},
+										"type":   {Type: "string"},
+										"series": {Type: "integer"},
+										"sum":    {Type: "number"},
+										"min":    {Type: "number"},
+										"max":    {Type: "number"},
+										"avg":    {Type: "number"},
+									},
+								}},
+								"alerts": {Type: "array", Description: "нет, если оповещения отключены", Items: &openapi.Schema{
+									Type: "object",
+									Properties: map[string]*openapi.Schema{
+										"name":  {Type: "string"},
+										"expr":  {Type: "string"},
+										"state": {Type: "string", Enum: []string{"inactive", "pending", "firing", "resolved"}},
+										"value": {Type: "number"},
+										"since": {Type: "string", Format: "date-time"},
+									},
+								}},
+								"fleet": {
+									Type: "object",
+									Properties: map[string]*openapi.Schema{
+										"online":  {Type: "integer"},
+										"offline": {Type: "integer"},
+										"agents": {Type: "array", Items: &openapi.Schema{
+											Type: "object",
+											Properties: map[string]*openapi.Schema{
+												"id":        {Type: "string"},
+												"last_seen": {Type: "string", Format: "date-time"},
+												"online":    {Type: "boolean"},
+											},
+										}},
+									},
+								},
+							},
+						})},
+						"400": respBadRequest,
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/ping",
+			handler: http.HandlerFunc(h.ping),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/ping",
+				Operation: openapi.Operation{
+					Summary:   "Проверить доступность хранилища",
+					Tags:      []string{"service"},
+					Responses: map[string]openapi.Response{"200": respOK, "500": {Description: "хранилище недоступно", Content: openapi.Text()}},
+				},
+			}},
+		},
+		{
+			pattern: "/healthz",
+			handler: http.HandlerFunc(healthz),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/healthz",
+				Operation: openapi.Operation{
+					Summary:   "Проба живости: процесс отвечает на запросы",
+					Tags:      []string{"service"},
+					Responses: map[string]openapi.Response{"200": respOK},
+				},
+			}},
+		},
+		{
+			pattern: "/readyz",
+			handler: h.readyz(svc.Health, svc.Replica),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/readyz",
+				Operation: openapi.Operation{
+					Summary:     "Проба готовности: хранилище доступно, метрики восстановлены, сервер не останавливается",
+					Description: "Реплика готова после первой копии метрик с основного сервера.",
+					Tags:        []string{"service"},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "сервер готов", Content: openapi.JSON(openapi.Ref("Readiness"))},
+						"503": {Description: "сервер не готов", Content: openapi.JSON(openapi.Ref("Readiness"))},
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/version",
+			handler: http.HandlerFunc(svc.Build.Handler),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/version",
+				Operation: openapi.Operation{
+					Summary:   "Версия, дата и коммит сборки сервера",
+					Tags:      []string{"service"},
+					Responses: map[string]openapi.Response{"200": {Description: "сведения о сборке", Content: openapi.JSON(openapi.Ref("BuildInfo"))}},
+				},
+			}},
+		},
+		{
+			// Страница не требует токена: данные она загружает из
+			// административного API с токеном, введённым на ней
+			pattern: "/admin/ui",
+			handler: http.HandlerFunc(console),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/admin/ui",
+				Operation: openapi.Operation{
+					Summary:   "Страница управления правилами оповещений, арендаторами и API-ключами",
+					Tags:      []string{"service"},
+					Responses: map[string]openapi.Response{"200": {Description: "страница HTML", Content: map[string]openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}}}},
+				},
+			}},
+		},
+		{
+			pattern: "/admin/snapshot",
+			admin:   true,
+			handler: http.HandlerFunc(h.snapshot),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/admin/snapshot",
+				Operation: openapi.Operation{
+					Summary: "Снимок всех метрик в компактном двоичном формате",
+					Tags:    []string{"service"},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "снимок для реплики только для чтения", Content: map[string]openapi.MediaType{"application/octet-stream": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}},
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/agent/commands",
+			handler: http.HandlerFunc(queue.Poll),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/agent/commands",
+				Operation: openapi.Operation{
+					Summary:    "Забрать команды агента",
+					Tags:       []string{"agent"},
+					Parameters: []openapi.Parameter{{Name: "id", In: "query", Required: true, Schema: &openapi.Schema{Type: "string"}}},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "команды агента", Content: openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("Command")})},
+						"400": respBadRequest,
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/admin/agents/commands",
+			admin:   true,
+			handler: http.HandlerFunc(queue.Issue),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/admin/agents/commands",
+				Operation: openapi.Operation{
+					Summary:     "Поставить команду агенту",
+					Tags:        []string{"agent"},
+					Parameters:  []openapi.Parameter{{Name: "id", In: "query", Required: true, Schema: &openapi.Schema{Type: "string"}}},
+					RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.Ref("Command"))},
+					Responses: map[string]openapi.Response{
+						"202": {Description: "команда принята"},
+						"400": respBadRequest,
+						"503": {Description: "очередь команд агента или число агентов с командами переполнены", Content: openapi.Text()},
+					},
+				},
+			}},
+		},
+	}
+
+	if svc.Stream != nil {
+		rs = append(rs, streamRoutes(svc.Stream)...)
+	}
+	if svc.Alerts != nil {
+		rs = append(rs, alertRoutes(svc.Alerts)...)
+	}
+	if svc.Freeze != nil {
+		rs = append(rs, freezeRoutes(svc.Freeze)...)
+	}
+	if svc.SLO != nil {
+		rs = append(rs, sloRoutes(svc.SLO)...)
+	}
+	if svc.Privacy != nil {
+		rs = append(rs, privacyRoutes(h, svc.Privacy)...)
+	}
+	if svc.Synthetic != nil {
+		rs = append(rs, syntheticRoutes(svc.Synthetic)...)
+	}
+	if svc.Tenants != nil {
+		rs = append(rs, tenantRoutes(svc.Tenants)...)
+	}
+	if svc.Persistence != nil {
+		rs = append(rs, persistenceRoutes(h, svc.Persistence)...)
+	}
+	// Восстановление из копии перезаписывает все метрики, поэтому без
+	// токена администратора маршруты копий не регистрируются вовсе
+	if svc.AdminToken != "" {
+		rs = append(rs, backupRoutes(h, svc.Backup, svc.Stream)...)
+	}
+	rs = append(rs, syncRoutes(h)...)
+	rs = append(rs, auditRoutes(h)...)
+	if h.hygiene != nil {
+		rs = append(rs, hygieneRoutes(h.hygiene)...)
+	}
+	if svc.Replica != nil {
+		rs = append(rs, replicaRoutes(svc.Replica)...)
+	}
+	if svc.Reload != nil {
+		rs = append(rs, reloadRoutes(svc.Reload, svc.Settings)...)
+	}
+	if svc.Offsets != nil {
+		rs = append(rs, offsetRoutes(svc.Offsets)...)
+	}
+
+	for i := range rs {
+		if rs[i].settings != nil {
+			rs[i].handler = h.auditSettings(rs[i].section, rs[i].settings, rs[i].handler)
+		}
+		if rs[i].tenant && svc.Tenants != nil {
+			rs[i].handler = svc.Tenants.Middleware(rs[i].handler)
+			addResponse(rs[i].docs, "401", respNoKey)
+		}
+		if rs[i].idempotent && svc.Idempotency != nil {
+			for j := range rs[i].docs {
+				op := &rs[i].docs[j].Operation
+				op.Parameters = append(op.Parameters, idempotencyParam)
+			}
+			addResponse(rs[i].docs, "409", respInFlight)
+		}
+		if rs[i].idempotent && svc.Offsets != nil {
+			for j := range rs[i].docs {
+				op := &rs[i].docs[j].Operation
+				op.Parameters = append(op.Parameters, partitionParam, offsetParam)
+			}
+		}
+		if rs[i].tenant && svc.Auth != nil {
+			scope := auth.ScopeRead
+			if rs[i].write {
+				scope = auth.ScopeWrite
+			}
+			rs[i].handler = auth.Require(svc.Auth, scope)(rs[i].handler)
+			if svc.Tenants != nil {
+				addResponse(rs[i].docs, "401", respNoKeyOrAuth)
+			} else {
+				addResponse(rs[i].docs, "401", respNoAuth)
+			}
+			for _, d := range rs[i].docs {
+				resp := respNoScope
+				if prev, ok := d.Operation.Responses["403"]; ok {
+					resp.Description = prev.Description + " или " + resp.Description
+				}
+				d.Operation.Responses["403"] = resp
+			}
+		}
+		if rs[i].admin {
+			rs[i].handler = middleware.Admin(svc.AdminToken)(rs[i].handler)
+			if svc.AdminToken == "" {
+				addResponse(rs[i].docs, "403", respAdminOff)
+			} else {
+				addResponse(rs[i].docs, "401", respNoToken)
+			}
+		}
+		if rs[i].read {
+			rs[i].handler = readConsistency(svc.Replica, rs[i].handler)
+			for j := range rs[i].docs {
+				op := &rs[i].docs[j].Operation
+				op.Parameters = append(op.Parameters, consistencyParams...)
+				op.Parameters = append(op.Parameters, fieldsQuery)
+			}
+			if svc.Replica != nil {
+				addResponse(rs[i].docs, "502", respNoPrimary)
+			}
+		}
+		if svc.Self != nil {
+			// Учитываем и запросы, отклонённые обёртками маршрута
+			observe := svc.Self.Observer(rs[i].pattern, rs[i].idempotent)
+			rs[i].handler = middleware.Observe(observe)(rs[i].handler)
+		}
+		// Спан запроса охватывает все обёртки маршрута и обращения к хранилищу
+		rs[i].handler = svc.Tracer.Handler(strings.TrimSuffix(rs[i].pattern, "{$}"), rs[i].handler)
+	}
+	return rs
+}
+
+// addResponse добавляет ответ code к описаниям маршрута
+func addResponse(docs []openapi.Endpoint, code string, resp openapi.Response) {
+	for _, d := range docs {
+		d.Operation.Responses[code] = resp
+	}
+}
+
+// persistenceRoutes маршруты отчёта об усилении записи
+func persistenceRoutes(h *Handler, p *Persistence) []route {
+	return []route{
+		{
+			pattern: "/admin/persistence",
+			admin:   true,
+			handler: http.HandlerFunc(p.writeReport),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/admin/persistence",
+				Operation: openapi.Operation{
+					Summary:   "Байт, записанных механизмами сохранения на одно принятое обновление",
+					Tags:      []string{"service"},
+					Responses: map[string]openapi.Response{"200": {Description: "отчёт об усилении записи", Content: openapi.JSON(&openapi.Schema{Type: "object"})}},
+				},
+			}},
+		},
+		{
+			pattern: "/admin/persistence/guide",
+			admin:   true,
+			handler: h.guide(p),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/admin/persistence/guide",
+				Operation: openapi.Operation{
+					Summary:   "Рекомендации по частоте и формату сохранения",
+					Tags:      []string{"service"},
+					Responses: map[string]openapi.Response{"200": {Description: "оценка размера снимков и рекомендации", Content: openapi.JSON(&openapi.Schema{Type: "object"})}},
+				},
+			}},
+		},
+	}
+}
+
+// backupRoutes маршруты резервного копирования метрик
+func backupRoutes(h *Handler, b *Backup, hub *stream.Hub) []route {
+	formatParam := openapi.QueryParam("format", "формат копии", &openapi.Schema{Type: "string", Enum: []string{"json", "binary"}})
+	fileParam := openapi.QueryParam("file", "имя файла копии в каталоге копий сервера", &openapi.Schema{Type: "string"})
+	binaryContent := map[string]openapi.MediaType{"application/octet-stream": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}
+	return []route{
+		{
+			pattern: "/admin/backup",
+			admin:   true,
+			handler: h.backup(b, hub),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/admin/backup",
+				Operation: openapi.Operation{
+					Summary:    "Резервная копия всех метрик: в файл на сервере или для скачивания",
+					Tags:       []string{"service"},
+					Parameters: []openapi.Parameter{formatParam, fileParam},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "копия для скачивания или сведения о сохранённом файле", Content: binaryContent},
+						"400": respBadRequest,
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/admin/restore",
+			admin:   true,
+			handler: h.restore(b),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/admin/restore",
+				Operation: openapi.Operation{
+					Summary:     "Восстановить метрики из резервной копии в теле запроса или из файла на сервере",
+					Tags:        []string{"service"},
+					Parameters:  []openapi.Parameter{fileParam},
+					RequestBody: &openapi.RequestBody{Content: binaryContent},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "число восстановленных метрик", Content: openapi.JSON(&openapi.Schema{Type: "object"})},
+						"400": respBadRequest,
+						"403": respReadOnly,
+						"404": {Description: "файл копии не найден", Content: openapi.Text()},
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/admin/import",
+			admin:   true,
+			handler: http.HandlerFunc(h.importProm),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/admin/import",
+				Operation: openapi.Operation{
+					Summary: "Импорт выгрузки Prometheus: текстовый формат, OpenMetrics или вывод promtool tsdb dump-openmetrics",
+					Tags:    []string{"service"},
+					Parameters: []openapi.Parameter{
+						openapi.QueryParam("history", "записать все значения рядов в историю", &openapi.Schema{Type: "boolean"}),
+					},
+					RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+						"text/plain":                   {Schema: &openapi.Schema{Type: "string"}},
+						"application/openmetrics-text": {Schema: &openapi.Schema{Type: "string"}},
+					}},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "число метрик и значений", Content: openapi.JSON(&openapi.Schema{Type: "object"})},
+						"400": respBadRequest,
+						"403": respReadOnly,
+						"501": {Description: "запись истории отключена", Content: openapi.Text()},
+					},
+				},
+			}},
+		},
+	}
+}
+
+// syncRoutes маршруты сравнения и синхронизации метрик с другим сервером
+func syncRoutes(h *Handler) []route {
+	bucketsParam := openapi.QueryParam("buckets", "число корзин хеша", &openapi.Schema{Type: "integer"})
+	object := openapi.JSON(&openapi.Schema{Type: "object"})
+	return []route{
+		{
+			pattern: "/admin/sync",
+			admin:   true,
+			handler: http.HandlerFunc(h.sync),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/admin/sync",
+				Operation: openapi.Operation{
+					Summary:     "Сравнить метрики с другим сервером и перенести различия (pull или push)",
+					Tags:        []string{"service"},
+					RequestBody: &openapi.RequestBody{Required: true, Content: object},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "число различий и перенесённых метрик", Content: object},
+						"400": respBadRequest,
+						"403": respReadOnly,
+						"502": {Description: "другой сервер недоступен или отклонил запрос", Content: openapi.Text()},
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/admin/sync/digest",
+			admin:   true,
+			handler: http.HandlerFunc(h.syncDigest),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/admin/sync/digest",
+				Operation: openapi.Operation{
+					Summary:    "Суммы хешей метрик по корзинам для сравнения серверов",
+					Tags:       []string{"service"},
+					Parameters: []openapi.Parameter{bucketsParam},
+					Responses:  map[string]openapi.Response{"200": {Description: "суммы корзин", Content: object}, "400": respBadRequest},
+				},
+			}},
+		},
+		{
+			pattern: "/admin/sync/metrics",
+			admin:   true,
+			handler: http.HandlerFunc(h.syncMetrics),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodPost,
+				Path:   "/admin/sync/metrics",
+				Operation: openapi.Operation{
+					Summary:     "Метрики выбранных корзин",
+					Tags:        []string{"service"},
+					RequestBody: &openapi.RequestBody{Required: true, Content: object},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "метрики корзин", Content: openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("Metrics")})},
+						"400": respBadRequest,
+					},
+				},
+			}},
+		},
+	}
+}
+
+// auditRoutes маршрут журнала аудита изменений метрик
+func auditRoutes(h *Handler) []route {
+	return []route{{
+		pattern: "/admin/audit",
+		admin:   true,
+		handler: http.HandlerFunc(h.auditLog),
+		docs: []openapi.Endpoint{{
+			Method: http.MethodGet,
+			Path:   "/admin/audit",
+			Operation: openapi.Operation{
+				Summary: "Журнал аудита: кто, когда и какое значение записал метрикам или как изменил настройки",
+				Tags:    []string{"service"},
+				Parameters: []openapi.Parameter{
+					openapi.QueryParam("name", "имя метрики в хранилище, с префиксом арендатора", &openapi.Schema{Type: "string"}),
+					openapi.QueryParam("key_id", "идентификатор API-ключа клиента", &openapi.Schema{Type: "string"}),
+					openapi.QueryParam("client", "имя токена доступа клиента или subject JWT", &openapi.Schema{Type: "string"}),
+					openapi.QueryParam("remote", "IP-адрес клиента", &openapi.Schema{Type: "string"}),
+					openapi.QueryParam("action", "действие", &openapi.Schema{Type: "string", Enum: []string{audit.ActionUpdate, audit.ActionRestore, audit.ActionImport, audit.ActionConfig}}),
+					openapi.QueryParam("section", "раздел настроек", &openapi.Schema{Type: "string", Enum: []string{audit.SectionAlerts, audit.SectionTenantKeys, audit.SectionSynthetic, audit.SectionFreeze, audit.SectionReload}}),
+					openapi.QueryParam("from", "начало интервала: RFC 3339 или секунды Unix", &openapi.Schema{Type: "string"}),
+					openapi.QueryParam("to", "конец интервала: RFC 3339 или секунды Unix", &openapi.Schema{Type: "string"}),
+					openapi.QueryParam("limit", "число последних записей; по умолчанию 100, не более 10000", &openapi.Schema{Type: "integer"}),
+				},
+				Responses: map[string]openapi.Response{
+					"200": {Description: "записи от старых к новым", Content: openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("AuditEntry")})},
+					"400": respBadRequest,
+					"501": {Description: "журнал аудита отключён", Content: openapi.Text()},
+				},
+			},
+		}},
+	}}
+}
+
+// hygieneRoutes маршрут отчёта о неиспользуемых метриках
+func hygieneRoutes(d *hygiene.Detector) []route {
+	return []route{{
+		pattern: "/admin/hygiene",
+		admin:   true,
+		handler: http.HandlerFunc(d.Handler),
+		docs: []openapi.Endpoint{{
+			Method: http.MethodGet,
+			Path:   "/admin/hygiene",
+			Operation: openapi.Operation{
+				Summary:     "Отчёт о подозрительных метриках: не читаются, не меняются, с неправильными или почти совпадающими именами",
+				Description: "Чтением считаются запросы /value и /query. Сведения о чтениях и изменениях накапливаются с запуска сервера.",
+				Tags:        []string{"service"},
+				Parameters: []openapi.Parameter{
+					openapi.QueryParam("issue", "только метрики с этим признаком", &openapi.Schema{Type: "string", Enum: []string{hygiene.IssueNeverRead, hygiene.IssueConstant, hygiene.IssueNaming, hygiene.IssueNearDuplicate}}),
+					openapi.QueryParam("refresh", "true — проверить метрики сейчас, не дожидаясь очередной проверки", &openapi.Schema{Type: "boolean"}),
+				},
+				Responses: map[string]openapi.Response{
+					"200": {Description: "отчёт последней проверки", Content: openapi.JSON(openapi.Ref("HygieneReport"))},
+				},
+			},
+		}},
+	}}
+}
+
+// replicaRoutes маршруты состояния репликации
+func replicaRoutes(rep *replica.Replica) []route {
+	return []route{{
+		pattern: "/admin/replication",
+		admin:   true,
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+				return
+			}
+			writeJSON(w, http.StatusOK, rep.Status())
+		}),
+		docs: []openapi.Endpoint{{
+			Method: http.MethodGet,
+			Path:   "/admin/replication",
+			Operation: openapi.Operation{
+				Summary:   "Состояние репликации с основного сервера",
+				Tags:      []string{"service"},
+				Responses: map[string]openapi.Response{"200": {Description: "подключение, номер последнего применённого обновления, отставание и скорость потока", Content: openapi.JSON(&openapi.Schema{Type: "object"})}},
+			},
+		}},
+	}}
+}
+
+// reloadRoutes маршрут перечитывания настроек на ходу
+func reloadRoutes(reload func() ([]string, error), settings func() any) []route {
+	return []route{{
+		pattern:  "/admin/reload",
+		admin:    true,
+		section:  audit.SectionReload,
+		settings: settings,
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+				return
+			}
+			reloaded, err := reload()
+			if err != nil {
+				http.Error(w, "Настройки не перечитаны: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string][]string{"reloaded": reloaded})
+		}),
+		docs: []openapi.Endpoint{{
+			Method: http.MethodPost,
+			Path:   "/admin/reload",
+			Operation: openapi.Operation{
+				Summary: "Перечитать лимиты запросов, правила оповещений и токены доступа из файла конфигурации (как по SIGHUP)",
+				Tags:    []string{"service"},
+				Responses: map[string]openapi.Response{
+					"200": {Description: "перечитанные разделы", Content: openapi.JSON(&openapi.Schema{Type: "object"})},
+					"400": {Description: "файл конфигурации не задан или неверен; настройки не изменены", Content: openapi.Text()},
+				},
+			},
+		}},
+	}}
+}
+
+// offsetRoutes маршрут смещений разделов источников
+func offsetRoutes(t *offsets.Tracker) []route {
+	return []route{{
+		pattern: "/admin/offsets",
+		admin:   true,
+		handler: http.HandlerFunc(t.Handler),
+		docs: []openapi.Endpoint{
+			{
+				Method: http.MethodGet,
+				Path:   "/admin/offsets",
+				Operation: openapi.Operation{
+					Summary: "Последние применённые смещения разделов источников конвейеров",
+					Tags:    []string{"service"},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "смещения", Content: openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("SourceOffset")})},
+					},
+				},
+			},
+			{
+				Method: http.MethodDelete,
+				Path:   "/admin/offsets",
+				Operation: openapi.Operation{
+					Summary: "Забыть смещение раздела, например после пересоздания темы",
+					Tags:    []string{"service"},
+					Parameters: []openapi.Parameter{
+						{Name: "partition", In: "query", Required: true, Description: "раздел источника", Schema: &openapi.Schema{Type: "string"}},
+						openapi.QueryParam("key_id", "идентификатор API-ключа клиента; пустой — раздел запросов без ключа", &openapi.Schema{Type: "string"}),
+					},
+					Responses: map[string]openapi.Response{
+						"204": {Description: "смещение забыто"},
+						"400": respBadRequest,
+						"404": {Description: "раздел не найден", Content: openapi.Text()},
+					},
+				},
+			},
+		},
+	}}
+}
+
+// tenantRoutes маршруты административного API ключей арендаторов
+func tenantRoutes(reg *tenant.Registry) []route {
+	return []route{
+		{
+			pattern:  "/admin/tenants/keys",
+			admin:    true,
+			section:  audit.SectionTenantKeys,
+			settings: func() any { return reg.Keys() },
+			handler:  http.HandlerFunc(reg.Handler),
+			docs: []openapi.Endpoint{
+				{
+					Method: http.MethodGet,
+					Path:   "/admin/tenants/keys",
+					Operation: openapi.Operation{
+						Summary: "Список API-ключей арендаторов без самих ключей",
+						Tags:    []string{"tenants"},
+						Responses: map[string]openapi.Response{
+							"200": {Description: "ключи", Content: openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("TenantKey")})},
+						},
+					},
+				},
+				{
+					Method: http.MethodPost,
+					Path:   "/admin/tenants/keys",
+					Operation: openapi.Operation{
+						Summary: "Выпустить API-ключ арендатора",
+						Tags:    []string{"tenants"},
+						RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(&openapi.Schema{
+							Type:       "object",
+							Required:   []string{"tenant"},
+							Properties: map[string]*openapi.Schema{"tenant": {Type: "string"}},
+						})},
+						Responses: map[string]openapi.Response{
+							"201": {Description: "выпущенный ключ; показывается один раз", Content: openapi.JSON(openapi.Ref("TenantKey"))},
+							"400": respBadRequest,
+						},
+					},
+				},
+			},
+		},
+		{
+			pattern:  "/admin/tenants/keys/{id}",
+			admin:    true,
+			section:  audit.SectionTenantKeys,
+			settings: func() any { return reg.Keys() },
+			handler:  http.HandlerFunc(reg.Handler),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodDelete,
+				Path:   "/admin/tenants/keys/{id}",
+				Operation: openapi.Operation{
+					Summary:    "Отозвать API-ключ арендатора",
+					Tags:       []string{"tenants"},
+					Parameters: []openapi.Parameter{openapi.PathParam("id", "идентификатор ключа", &openapi.Schema{Type: "string"})},
+					Responses:  map[string]openapi.Response{"204": {Description: "ключ отозван"}, "404": {Description: "ключ не найден", Content: openapi.Text()}},
+				},
+			}},
+		},
+	}
+}
+
+// streamRoutes маршруты потоков обновлений метрик
+func streamRoutes(hub *stream.Hub) []route {
+	filterParams := []openapi.Parameter{
+		openapi.QueryParam("prefix", "префикс имени метрики", &openapi.Schema{Type: "string"}),
+		openapi.QueryParam("type", "тип метрики", &openapi.Schema{Type: "string", Enum: []string{"gauge", "counter"}}),
+	}
+	return []route{
+		{
+			pattern: "/ws/metrics",
+			tenant:  true,
+			handler: http.HandlerFunc(hub.Handler),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/ws/metrics",
+				Operation: openapi.Operation{
+					Summary:    "Поток обновлений метрик по WebSocket; каждое сообщение — метрика в формате JSON",
+					Tags:       []string{"value"},
+					Parameters: filterParams,
+					Responses: map[string]openapi.Response{
+						"101": {Description: "соединение переведено на WebSocket", Content: openapi.JSON(openapi.Ref("Metrics"))},
+						"400": respBadRequest,
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/admin/replication/events",
+			admin:   true,
+			handler: http.HandlerFunc(hub.EventsHandler),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/admin/replication/events",
+				Operation: openapi.Operation{
+					Summary: "Поток обновлений всех метрик для реплик: как /events, но без разделения по арендаторам",
+					Tags:    []string{"service"},
+					Parameters: []openapi.Parameter{{
+						Name: "Last-Event-ID", In: "header", Description: "номер последнего применённого события",
+						Schema: &openapi.Schema{Type: "integer", Format: "int64"},
+					}, openapi.QueryParam("encoding", "кодирование событий: json — события metric; delta — ряды объявляются событием series, "+
+						"обновления передаются событием delta с разностью итоговых значений counter, вместо keep-alive приходит head с номером последнего обновления",
+						&openapi.Schema{Type: "string", Enum: []string{stream.EncodingJSON, stream.EncodingDelta}})},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "поток событий", Content: map[string]openapi.MediaType{"text/event-stream": {Schema: &openapi.Schema{Type: "string"}}}},
+						"400": respBadRequest,
+					},
+				},
+			}},
+		},
+		{
+			pattern: "/events",
+			tenant:  true,
+			handler: http.HandlerFunc(hub.EventsHandler),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/events",
+				Operation: openapi.Operation{
+					Summary: "Поток обновлений метрик как Server-Sent Events; событие metric содержит метрику в формате JSON",
+					Tags:    []string{"value"},
+					Parameters: append(filterParams, openapi.Parameter{
+						Name: "Last-Event-ID", In: "header", Description: "номер последнего полученного события для продолжения потока",
+						Schema: &openapi.Schema{Type: "integer", Format: "int64"},
+					}),
+					Responses: map[string]openapi.Response{
+						"200": {Description: "поток событий", Content: map[string]openapi.MediaType{"text/event-stream": {Schema: &openapi.Schema{Type: "string"}}}},
+						"400": respBadRequest,
+					},
+				},
+			}},
+		},
+	}
+}
+
+// alertRoutes маршруты административного API правил оповещений
+func alertRoutes(e *alerts.Engine) []route {
+	return []route{
+		{
+			pattern:  "/admin/alerts/rules",
+			admin:    true,
+			section:  audit.SectionAlerts,
+			settings: func() any { return e.Definitions() },
+			handler:  http.HandlerFunc(e.Handler),
+			docs: []openapi.Endpoint{
+				{
+					Method: http.MethodGet,
+					Path:   "/admin/alerts/rules",
+					Operation: openapi.Operation{
+						Summary: "Список правил оповещений с состояниями",
+						Tags:    []string{"alerts"},
+						Responses: map[string]openapi.Response{
+							"200": {Description: "правила", Content: openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("AlertRule")})},
+						},
+					},
+				},
+				{
+					Method: http.MethodPost,
+					Path:   "/admin/alerts/rules",
+					Operation: openapi.Operation{
+						Summary:     "Добавить или заменить правило оповещения",
+						Tags:        []string{"alerts"},
+						RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.Ref("AlertRule"))},
+						Responses:   map[string]openapi.Response{"201": {Description: "правило сохранено"}, "400": respBadRequest},
+					},
+				},
+			},
+		},
+		{
+			pattern:  "/admin/alerts/rules/{name}",
+			admin:    true,
+			section:  audit.SectionAlerts,
+			settings: func() any { return e.Definitions() },
+			handler:  http.HandlerFunc(e.Handler),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodDelete,
+				Path:   "/admin/alerts/rules/{name}",
+				Operation: openapi.Operation{
+					Summary:    "Удалить правило оповещения",
+					Tags:       []string{"alerts"},
+					Parameters: []openapi.Parameter{openapi.PathParam("name", "имя правила", &openapi.Schema{Type: "string"})},
+					Responses:  map[string]openapi.Response{"204": {Description: "правило удалено"}, "404": {Description: "правило не найдено", Content: openapi.Text()}},
+				},
+			}},
+		},
+	}
+}
+
+// freezeRoutes маршруты административного API окон заморозки
+func freezeRoutes(reg *freeze.Registry) []route {
+	return []route{
+		{
+			pattern:  "/admin/freeze",
+			admin:    true,
+			section:  audit.SectionFreeze,
+			settings: func() any { return reg.Definitions() },
+			handler:  http.HandlerFunc(reg.Handler),
+			docs: []openapi.Endpoint{
+				{
+					Method: http.MethodGet,
+					Path:   "/admin/freeze",
+					Operation: openapi.Operation{
+						Summary: "Список окон заморозки обновлений",
+						Tags:    []string{"service"},
+						Responses: map[string]openapi.Response{
+							"200": {Description: "окна заморозки", Content: openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("FreezeWindow")})},
+						},
+					},
+				},
+				{
+					Method: http.MethodPost,
+					Path:   "/admin/freeze",
+					Operation: openapi.Operation{
+						Summary:     "Добавить или заменить окно заморозки",
+						Description: "Во время окна обновления метрик с указанными префиксами отклоняются с кодом 423, чтение не ограничивается.",
+						Tags:        []string{"service"},
+						RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.Ref("FreezeWindow"))},
+						Responses:   map[string]openapi.Response{"201": {Description: "окно сохранено"}, "400": respBadRequest},
+					},
+				},
+			},
+		},
+		{
+			pattern:  "/admin/freeze/{name}",
+			admin:    true,
+			section:  audit.SectionFreeze,
+			settings: func() any { return reg.Definitions() },
+			handler:  http.HandlerFunc(reg.Handler),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodDelete,
+				Path:   "/admin/freeze/{name}",
+				Operation: openapi.Operation{
+					Summary:    "Удалить окно заморозки",
+					Tags:       []string{"service"},
+					Parameters: []openapi.Parameter{openapi.PathParam("name", "имя окна", &openapi.Schema{Type: "string"})},
+					Responses:  map[string]openapi.Response{"204": {Description: "окно удалено"}, "404": {Description: "окно не найдено", Content: openapi.Text()}},
+				},
+			}},
+		},
+	}
+}
+
+// privacyRoutes маршрут выгрузки для внешних потребителей
+func privacyRoutes(h *Handler, p *privacy.Policy) []route {
+	return []route{
+		{
+			pattern: "/export/public",
+			tenant:  true,
+			handler: h.exportPublic(p),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/export/public",
+				Operation: openapi.Operation{
+					Summary:     "Выгрузить метрики для внешних потребителей",
+					Description: "То же, что GET /export, но значения метрик из раздела privacy искажены: к ним добавлен шум Лапласа, они заменены границей корзины или округлены. Пока значение метрики не меняется, ответ на повторные запросы тот же.",
+					Tags:        []string{"value"},
+					Parameters: []openapi.Parameter{
+						openapi.QueryParam("format", "формат выгрузки; без него выбирается по Accept", &openapi.Schema{Type: "string", Enum: []string{exportJSON, exportNDJSON}}),
+						openapi.QueryParam("type", "тип метрики", &openapi.Schema{Type: "string", Enum: []string{"gauge", "counter"}}),
+						openapi.QueryParam("prefix", "начало имени метрики", &openapi.Schema{Type: "string"}),
+					},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "метрики, упорядоченные по имени и типу", Content: map[string]openapi.MediaType{
+							"application/json": {Schema: &openapi.Schema{Type: "array", Items: openapi.Ref("Metrics")}},
+							ContentTypeNDJSON:  {Schema: openapi.Ref("Metrics")},
+						}},
+						"400": respBadRequest,
+						"406": respNotAcceptable,
+					},
+				},
+			}},
+		},
+	}
+}
+
+// sloRoutes маршруты показателей целей уровня обслуживания
+func sloRoutes(t *slo.Tracker) []route {
+	return []route{
+		{
+			pattern: "/admin/slo",
+			admin:   true,
+			handler: http.HandlerFunc(t.Handler),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodGet,
+				Path:   "/admin/slo",
+				Operation: openapi.Operation{
+					Summary:     "Выполнение целей уровня обслуживания и расходование бюджета ошибок",
+					Description: "Те же показатели публикуются как gauge SLOCompliance{slo=...}, SLOErrorBudgetRemaining{slo=...} и SLOBurnRate{slo=...,window=...}.",
+					Tags:        []string{"alerts"},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "показатели целей", Content: openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("SLO")})},
+					},
+				},
+			}},
+		},
+	}
+}
+
+// syntheticRoutes маршруты административного API генератора тестовых рядов
+func syntheticRoutes(g *synthetic.Generator) []route {
+	return []route{
+		{
+			pattern:  "/admin/synthetic",
+			admin:    true,
+			section:  audit.SectionSynthetic,
+			settings: func() any { return g.Series() },
+			handler:  http.HandlerFunc(g.Handler),
+			docs: []openapi.Endpoint{
+				{
+					Method: http.MethodGet,
+					Path:   "/admin/synthetic",
+					Operation: openapi.Operation{
+						Summary: "Список генерируемых тестовых рядов",
+						Tags:    []string{"service"},
+						Responses: map[string]openapi.Response{
+							"200": {Description: "ряды", Content: openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("SyntheticSeries")})},
+						},
+					},
+				},
+				{
+					Method: http.MethodPost,
+					Path:   "/admin/synthetic",
+					Operation: openapi.Operation{
+						Summary:     "Добавить или заменить тестовый ряд",
+						Tags:        []string{"service"},
+						RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.Ref("SyntheticSeries"))},
+						Responses:   map[string]openapi.Response{"201": {Description: "ряд сохранён"}, "400": respBadRequest},
+					},
+				},
+			},
+		},
+		{
+			pattern:  "/admin/synthetic/{name}",
+			admin:    true,
+			section:  audit.SectionSynthetic,
+			settings: func() any { return g.Series() },
+			handler:  http.HandlerFunc(g.Handler),
+			docs: []openapi.Endpoint{{
+				Method: http.MethodDelete,
+				Path:   "/admin/synthetic/{name}",
+				Operation: openapi.Operation{
+					Summary:    "Перестать генерировать тестовый ряд",
+					Tags:       []string{"service"},
+					Parameters: []openapi.Parameter{openapi.PathParam("name", "имя ряда", &openapi.Schema{Type: "string"})},
+					Responses:  map[string]openapi.Response{"204": {Description: "ряд удалён"}, "404": {Description: "ряд не найден", Content: openapi.Text()}},
+				},
+			}},
+		},
+	}
+}
+
+// Register регистрирует маршруты сервера в mux и добавляет их описание в спецификацию,
+// а также отдаёт спецификацию и Swagger UI по адресу /swagger/
+func Register(mux *http.ServeMux, spec *openapi.Spec, h *Handler, svc Services) {
+	for name, schema := range schemas() {
+		spec.Components.Schemas[name] = schema
+	}
+	for _, rt := range routes(h, svc) {
+		mux.Handle(rt.pattern, rt.handler)
+		spec.Add(rt.docs...)
+	}
+	mux.Handle("/swagger/openapi.json", spec.Handler())
+	mux.Handle("/swagger/{$}", spec.UIHandler("/swagger/openapi.json"))
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// snapshot обработчик GET /admin/snapshot: отдаёт текущие метрики в компактном
+// двоичном формате, который реплика может открыть через -mmap-snapshot
+func (h *Handler) snapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	gauges, counters, err := h.storage.GetAll(r.Context())
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="metrics.snap"`)
+	if err := storage.WriteCompact(w, gauges, counters); err != nil {
+		log.Printf("Не удалось отдать снимок: %v", err)
+	}
+}
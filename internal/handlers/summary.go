@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/internal/summary"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// summaryJSON значение summary в ответе
+type summaryJSON struct {
+	ID        string         `json:"id"`
+	MType     string         `json:"type"`
+	Count     int64          `json:"count"`
+	Sum       json.Number    `json:"sum"`
+	Quantiles []quantileJSON `json:"quantiles"`
+}
+
+// toSummaryJSON готовит значение summary к выводу в формате JSON
+func (h *Handler) toSummaryJSON(r *http.Request, name string, v summary.Value) summaryJSON {
+	out := summaryJSON{
+		ID:        clientName(r, name),
+		MType:     models.Summary,
+		Count:     v.Count,
+		Sum:       json.Number(h.formatGauge(v.Sum)),
+		Quantiles: make([]quantileJSON, 0, len(v.Quantiles)),
+	}
+	for _, q := range v.Quantiles {
+		qj := quantileJSON{Q: q.Q}
+		if !math.IsNaN(q.Value) {
+			value := q.Value
+			qj.Value = &value
+		}
+		out.Quantiles = append(out.Quantiles, qj)
+	}
+	return out
+}
+
+// writeSummary отвечает значением summary name в формате JSON:
+// в Protocol Buffers summary не передаётся
+func (h *Handler) writeSummary(w http.ResponseWriter, r *http.Request, name string) {
+	v, err := summary.Read(r.Context(), h.store(r), name)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	writeFields(w, r, http.StatusOK, h.toSummaryJSON(r, name, v))
+}
+
+// summaryValue отвечает на GET /value/summary/<name>: в тексте —
+// строкой «count=… sum=… p50=… p90=… p99=…»
+func (h *Handler) summaryValue(w http.ResponseWriter, r *http.Request, format, name string) {
+	v, err := summary.Read(r.Context(), h.store(r), name)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	if format == mediaJSON {
+		writeFields(w, r, http.StatusOK, h.toSummaryJSON(r, name, v))
+		return
+	}
+
+	parts := []string{"count=" + strconv.FormatInt(v.Count, 10), "sum=" + h.formatGauge(v.Sum)}
+	for _, q := range v.Quantiles {
+		value := "NaN"
+		if !math.IsNaN(q.Value) {
+			value = h.formatGauge(q.Value)
+		}
+		parts = append(parts, "p"+strconv.FormatFloat(q.Q*100, 'g', -1, 64)+"="+value)
+	}
+	text := strings.Join(parts, " ")
+	if format == mediaHTML {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		valueTemplate.Execute(w, indexRow{Name: clientName(r, name), Type: models.Summary, Value: text})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(text))
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/iliodor1/metrics-service/internal/diffsync"
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// validBuckets проверяет число корзин
+func validBuckets(n int) bool {
+	return n > 0 && n <= diffsync.MaxBuckets
+}
+
+// syncDigest обработчик GET /admin/sync/digest: суммы хешей метрик по корзинам
+func (h *Handler) syncDigest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	buckets := diffsync.DefaultBuckets
+	if v := r.URL.Query().Get("buckets"); v != "" {
+		buckets, _ = strconv.Atoi(v)
+	}
+	if !validBuckets(buckets) {
+		http.Error(w, "Неверное число корзин.", http.StatusBadRequest)
+		return
+	}
+	d, err := diffsync.NewDigest(r.Context(), h.storage, buckets)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// syncMetrics обработчик POST /admin/sync/metrics: метрики выбранных корзин
+func (h *Handler) syncMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+	var req diffsync.Request
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if !validBuckets(req.Buckets) {
+		http.Error(w, "Неверное число корзин.", http.StatusBadRequest)
+		return
+	}
+	metrics, err := diffsync.Select(r.Context(), h.storage, req.Buckets, req.Select)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, metrics)
+}
+
+// syncRequest параметры синхронизации с другим сервером
+type syncRequest struct {
+	// Peer адрес другого сервера
+	Peer string `json:"peer"`
+	// Token токен администратора другого сервера
+	Token string `json:"token"`
+	// Direction направление: pull или push
+	Direction string `json:"direction"`
+	// Buckets число корзин (0 — по умолчанию)
+	Buckets int `json:"buckets"`
+	// DryRun только сравнить, ничего не перенося
+	DryRun bool `json:"dry_run"`
+}
+
+// sync обработчик POST /admin/sync: сравнивает метрики с другим сервером
+// и переносит различия в заданном направлении
+func (h *Handler) sync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешён. Используйте POST.", http.StatusMethodNotAllowed)
+		return
+	}
+	var req syncRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Peer == "" {
+		http.Error(w, "Не задан адрес другого сервера.", http.StatusBadRequest)
+		return
+	}
+	if req.Buckets == 0 {
+		req.Buckets = diffsync.DefaultBuckets
+	}
+	if !validBuckets(req.Buckets) {
+		http.Error(w, "Неверное число корзин.", http.StatusBadRequest)
+		return
+	}
+
+	report, err := diffsync.Sync(r.Context(), h.storage, diffsync.NewPeer(req.Peer, req.Token), req.Direction, req.Buckets, req.DryRun)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, report)
+	case errors.Is(err, diffsync.ErrDirection):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrReadOnly):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, "Синхронизация не удалась: "+err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/commands"
+	"github.com/iliodor1/metrics-service/internal/middleware"
+	"github.com/iliodor1/metrics-service/internal/namespace"
+	"github.com/iliodor1/metrics-service/internal/openapi"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/internal/units"
+)
+
+// newTestServer собирает маршруты сервера поверх хранилища s с подсистемами svc
+func newTestServer(t *testing.T, s storage.Storage, svc Services) http.Handler {
+	t.Helper()
+	registry, err := units.NewRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := namespace.New(namespace.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.Commands == nil {
+		svc.Commands = commands.NewQueue()
+	}
+	mux := http.NewServeMux()
+	Register(mux, openapi.New("test", "0"), New(s, registry, names), svc)
+	return mux
+}
+
+func TestTenantScoping(t *testing.T) {
+	reg, err := tenant.NewRegistry(tenant.Config{Keys: map[string]string{"ka": "a", "kb": "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := storage.NewMemStorage()
+	srv := newTestServer(t, s, Services{Tenants: reg, AdminToken: "secret"})
+
+	do := func(method, target, key, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if key != "" {
+			r.Header.Set(middleware.APIKeyHeader, key)
+		}
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+	for key, value := range map[string]string{"ka": "1", "kb": "2"} {
+		if w := do(http.MethodPost, "/update/gauge/cpu/"+value, key, ""); w.Code != http.StatusOK {
+			t.Fatalf("обновление с ключом %s: %d %s", key, w.Code, w.Body)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		key      string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "значение арендатора a", method: http.MethodGet, target: "/value/gauge/cpu", key: "ka", wantCode: http.StatusOK, wantBody: "1"},
+		{name: "значение арендатора b", method: http.MethodGet, target: "/value/gauge/cpu", key: "kb", wantCode: http.StatusOK, wantBody: "2"},
+		{name: "чтение без ключа", method: http.MethodGet, target: "/value/gauge/cpu", wantCode: http.StatusUnauthorized},
+		{name: "неизвестный ключ", method: http.MethodGet, target: "/value/gauge/cpu", key: "kc", wantCode: http.StatusUnauthorized},
+		{name: "обновление без ключа", method: http.MethodPost, target: "/update/gauge/cpu/3", wantCode: http.StatusUnauthorized},
+		{name: "чужая метрика через разделитель", method: http.MethodGet, target: "/value/gauge/b%2Fcpu", key: "ka", wantCode: http.StatusNotFound},
+		{name: "ключи без токена", method: http.MethodGet, target: "/admin/tenants/keys", wantCode: http.StatusUnauthorized},
+		{name: "ключи с ключом арендатора", method: http.MethodGet, target: "/admin/tenants/keys", key: "ka", wantCode: http.StatusUnauthorized},
+		{name: "ключи с токеном", method: http.MethodGet, target: "/admin/tenants/keys", token: "secret", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.method, tt.target, tt.key, tt.token)
+			if w.Code != tt.wantCode {
+				t.Fatalf("код %d, ожидался %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(w.Body.String()) != tt.wantBody {
+				t.Errorf("тело %q, ожидалось %q", w.Body, tt.wantBody)
+			}
+		})
+	}
+
+	// В хранилище метрики разделены префиксами арендаторов
+	gauges, _, _ := s.GetAll(context.Background())
+	if len(gauges) != 2 || gauges["a/cpu"] != 1 || gauges["b/cpu"] != 2 {
+		t.Errorf("метрики в хранилище %v", gauges)
+	}
+}
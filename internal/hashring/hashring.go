@@ -0,0 +1,76 @@
+// Package hashring распределяет метрики между частями по согласованному
+// хешу имени. Им пользуются и хранилище sharded сервера, и агент при
+// отправке метрик на несколько серверов, поэтому метрика с одним именем
+// попадает в часть с одним и тем же именем на обеих сторонах.
+package hashring
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// replicas число точек каждой части на кольце хешей:
+// чем их больше, тем равномернее метрики делятся между частями
+const replicas = 128
+
+// point точка кольца хешей
+type point struct {
+	hash uint64
+	part int
+}
+
+// Ring кольцо согласованного хеширования. При добавлении или удалении
+// части переезжает лишь доля метрик, пропорциональная её доле на кольце,
+// а не почти все, как при делении хеша по модулю.
+type Ring struct {
+	points []point
+}
+
+// New создаёт кольцо из частей с постоянными именами names: положение
+// части на кольце зависит только от её имени, поэтому порядок частей
+// в настройках можно менять
+func New(names []string) (*Ring, error) {
+	if len(names) == 0 {
+		return nil, errors.New("не заданы части")
+	}
+	r := &Ring{points: make([]point, 0, len(names)*replicas)}
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		if seen[name] {
+			return nil, errors.New("повторяется имя части: " + name)
+		}
+		seen[name] = true
+		for n := 0; n < replicas; n++ {
+			r.points = append(r.points, point{hash: hash(name + "#" + strconv.Itoa(n)), part: i})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i].hash < r.points[j].hash })
+	return r, nil
+}
+
+// hash хеш FNV-1a строки с перемешиванием битов из MurmurHash3:
+// без него похожие короткие имена попадают на один участок кольца
+func hash(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// Part возвращает номер части (в порядке имён New) для метрики name
+func (r *Ring) Part(name string) int {
+	h := hash(name)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].part
+}
@@ -0,0 +1,103 @@
+package hashring
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// partOf возвращает имя части, в которую попадает каждая из метрик names
+func partOf(t *testing.T, parts []string, names []string) map[string]string {
+	t.Helper()
+	r, err := New(parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	placed := make(map[string]string, len(names))
+	for _, name := range names {
+		placed[name] = parts[r.Part(name)]
+	}
+	return placed
+}
+
+// metricNames возвращает n имён метрик, похожих на настоящие
+func metricNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("host-%d.cpu.usage", i)
+	}
+	return names
+}
+
+func TestPlacement(t *testing.T) {
+	names := metricNames(10000)
+	tests := []struct {
+		name   string
+		before []string
+		after  []string
+		// maxMoved наибольшая доля метрик, сменивших часть
+		maxMoved float64
+		// target часть, в которую переезжают метрики (пустая — любая)
+		target string
+	}{
+		{name: "те же части", before: []string{"a", "b", "c"}, after: []string{"a", "b", "c"}},
+		{name: "другой порядок частей", before: []string{"a", "b", "c"}, after: []string{"c", "a", "b"}},
+		{name: "добавлена четвёртая часть", before: []string{"a", "b", "c"}, after: []string{"a", "b", "c", "d"}, maxMoved: 0.35, target: "d"},
+		{name: "добавлена вторая часть", before: []string{"a"}, after: []string{"a", "b"}, maxMoved: 0.6, target: "b"},
+		{name: "удалена часть", before: []string{"a", "b", "c", "d"}, after: []string{"a", "b", "c"}, maxMoved: 0.35},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := partOf(t, tt.before, names)
+			after := partOf(t, tt.after, names)
+			moved := 0
+			for _, name := range names {
+				if before[name] == after[name] {
+					continue
+				}
+				moved++
+				if tt.target != "" && after[name] != tt.target {
+					t.Fatalf("%s переехала из %s в %s, а не в новую часть %s", name, before[name], after[name], tt.target)
+				}
+				if tt.target == "" && slices.Contains(tt.after, before[name]) {
+					t.Fatalf("%s переехала из оставшейся части %s", name, before[name])
+				}
+			}
+			if share := float64(moved) / float64(len(names)); share > tt.maxMoved {
+				t.Errorf("часть сменили %.1f%% метрик, ожидалось не больше %.0f%%", 100*share, 100*tt.maxMoved)
+			}
+		})
+	}
+}
+
+func TestBalance(t *testing.T) {
+	parts := []string{"a", "b", "c", "d"}
+	names := metricNames(10000)
+	counts := make(map[string]int)
+	for _, part := range partOf(t, parts, names) {
+		counts[part]++
+	}
+	even := len(names) / len(parts)
+	for _, part := range parts {
+		if n := counts[part]; n < even/2 || n > even*3/2 {
+			t.Errorf("в части %s %d метрик из %d, ожидалось около %d", part, n, len(names), even)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []string
+	}{
+		{name: "нет частей"},
+		{name: "повторяется имя", parts: []string{"a", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.parts); err == nil {
+				t.Fatal("ошибки нет")
+			}
+		})
+	}
+}
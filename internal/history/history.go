@@ -0,0 +1,232 @@
+// Package history хранит историю значений метрик во временных рядах
+package history
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Оценка памяти ряда: значения и агрегаты считаются по ёмкости их буферов
+const (
+	sampleSize    = int64(unsafe.Sizeof(Sample{}))
+	aggregateSize = int64(unsafe.Sizeof(Aggregate{}))
+	// seriesOverhead служебная память ряда: запись карты, ключ и карта агрегатов
+	seriesOverhead = 256
+	// initialSamples начальная ёмкость буфера ряда; буфер растёт до capacity
+	// по мере записи, чтобы ряд из одного значения не занимал весь буфер
+	initialSamples = 8
+)
+
+// Sample значение метрики в момент времени
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// ring кольцевой буфер последних значений одного ряда
+type ring struct {
+	samples []Sample
+	start   int
+	size    int
+	// limit наибольшая ёмкость буфера
+	limit int
+}
+
+// push добавляет значение, вытесняя самое старое при заполнении буфера
+func (r *ring) push(s Sample) {
+	if r.size == len(r.samples) && len(r.samples) < r.limit {
+		r.grow()
+	}
+	if r.size < len(r.samples) {
+		r.samples[(r.start+r.size)%len(r.samples)] = s
+		r.size++
+		return
+	}
+	r.samples[r.start] = s
+	r.start = (r.start + 1) % len(r.samples)
+}
+
+// grow увеличивает буфер вдвое, но не больше limit, и упорядочивает значения
+func (r *ring) grow() {
+	n := min(max(2*len(r.samples), initialSamples), r.limit)
+	samples := make([]Sample, n)
+	for i := 0; i < r.size; i++ {
+		samples[i] = r.at(i)
+	}
+	r.samples, r.start = samples, 0
+}
+
+// at возвращает i-е по времени значение
+func (r *ring) at(i int) Sample {
+	return r.samples[(r.start+i)%len(r.samples)]
+}
+
+// dropBefore удаляет значения, записанные раньше t
+func (r *ring) dropBefore(t time.Time) {
+	for r.size > 0 && r.at(0).Timestamp.Before(t) {
+		r.start = (r.start + 1) % len(r.samples)
+		r.size--
+	}
+}
+
+// series исходные значения ряда и их агрегаты
+type series struct {
+	raw     ring
+	rollups map[time.Duration][]Aggregate
+	// compacted момент, до которого исходные значения уже учтены в агрегатах
+	compacted time.Time
+	// bytes оценка памяти ряда
+	bytes int64
+	// usage счётчик памяти хранилища метрик, которому принадлежит ряд
+	usage *atomic.Int64
+}
+
+// account пересчитывает оценку памяти ряда и переносит разницу в usage
+func (sr *series) account() {
+	n := seriesOverhead + int64(cap(sr.raw.samples))*sampleSize
+	for _, aggs := range sr.rollups {
+		n += int64(cap(aggs)) * aggregateSize
+	}
+	if sr.usage != nil {
+		sr.usage.Add(n - sr.bytes)
+	}
+	sr.bytes = n
+}
+
+// Store хранит в памяти по capacity последних значений каждого ряда
+type Store struct {
+	mu       sync.RWMutex
+	capacity int
+	series   map[string]*series
+}
+
+// NewStore создаёт хранилище истории с буфером на capacity значений для каждого ряда
+func NewStore(capacity int) *Store {
+	return &Store{
+		capacity: capacity,
+		series:   make(map[string]*series),
+	}
+}
+
+// key ключ ряда в хранилище
+func key(mType, name string) string {
+	return mType + "/" + name
+}
+
+// get возвращает ряд, заводя его при отсутствии. Вызывается под блокировкой записи.
+func (s *Store) get(mType, name string) *series {
+	sr, ok := s.series[key(mType, name)]
+	if !ok {
+		sr = &series{
+			raw:     ring{limit: s.capacity},
+			rollups: make(map[time.Duration][]Aggregate),
+		}
+		sr.account()
+		s.series[key(mType, name)] = sr
+	}
+	return sr
+}
+
+// Append записывает значение ряда
+func (s *Store) Append(mType, name string, t time.Time, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sr := s.get(mType, name)
+	r := &sr.raw
+	// Сохраняем упорядоченность ряда при одновременных обновлениях
+	if r.size > 0 && t.Before(r.at(r.size-1).Timestamp) {
+		t = r.at(r.size - 1).Timestamp
+	}
+	grows := r.size == len(r.samples)
+	r.push(Sample{Timestamp: t, Value: value})
+	if grows {
+		sr.account()
+	}
+}
+
+// Track заводит ряд метрики, если его нет, и учитывает его память в usage.
+// Так хранилище метрик включает историю своих метрик в бюджет памяти.
+func (s *Store) Track(mType, name string, usage *atomic.Int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sr := s.get(mType, name)
+	if sr.usage != nil {
+		sr.usage.Add(-sr.bytes)
+	}
+	sr.usage = usage
+	usage.Add(sr.bytes)
+}
+
+// SeriesSize оценка памяти ряда, которую учтёт Track: у нового ряда —
+// его служебная память
+func (s *Store) SeriesSize(mType, name string) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sr, ok := s.series[key(mType, name)]; ok {
+		return sr.bytes
+	}
+	return seriesOverhead
+}
+
+// Delete удаляет ряд вместе с его агрегатами
+func (s *Store) Delete(mType, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sr, ok := s.series[key(mType, name)]
+	if !ok {
+		return
+	}
+	if sr.usage != nil {
+		sr.usage.Add(-sr.bytes)
+	}
+	delete(s.series, key(mType, name))
+}
+
+// Has сообщает, есть ли история у ряда
+func (s *Store) Has(mType, name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.series[key(mType, name)]
+	return ok
+}
+
+// Range возвращает значения ряда в интервале [from, to].
+// Если step больше нуля, время разбивается на шаги, кратные step,
+// и для каждого шага возвращается последнее значение, попавшее в него.
+func (s *Store) Range(mType, name string, from, to time.Time, step time.Duration) []Sample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	points := []Sample{}
+	sr, ok := s.series[key(mType, name)]
+	if !ok {
+		return points
+	}
+	r := &sr.raw
+
+	// Значения в буфере упорядочены по времени, ищем начало интервала двоичным поиском
+	first := sort.Search(r.size, func(i int) bool { return !r.at(i).Timestamp.Before(from) })
+	for i := first; i < r.size; i++ {
+		sample := r.at(i)
+		if sample.Timestamp.After(to) {
+			break
+		}
+		if step <= 0 {
+			points = append(points, sample)
+			continue
+		}
+		bucket := sample.Timestamp.Truncate(step)
+		if n := len(points); n > 0 && points[n-1].Timestamp.Equal(bucket) {
+			points[n-1].Value = sample.Value
+			continue
+		}
+		points = append(points, Sample{Timestamp: bucket, Value: sample.Value})
+	}
+	return points
+}
@@ -0,0 +1,81 @@
+package history
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAppendGrowsLazily(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		appends  int
+		wantCap  int
+		wantSize int
+	}{
+		{name: "одно значение", capacity: 1000, appends: 1, wantCap: initialSamples, wantSize: 1},
+		{name: "рост вдвое", capacity: 1000, appends: initialSamples + 1, wantCap: 2 * initialSamples, wantSize: initialSamples + 1},
+		{name: "не больше capacity", capacity: 20, appends: 100, wantCap: 20, wantSize: 20},
+		{name: "capacity меньше начальной", capacity: 3, appends: 5, wantCap: 3, wantSize: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(tt.capacity)
+			start := time.Unix(0, 0)
+			for i := 0; i < tt.appends; i++ {
+				s.Append("gauge", "cpu", start.Add(time.Duration(i)*time.Second), float64(i))
+			}
+			r := s.series[key("gauge", "cpu")].raw
+			if len(r.samples) != tt.wantCap || r.size != tt.wantSize {
+				t.Fatalf("буфер %d, значений %d; ожидалось %d, %d", len(r.samples), r.size, tt.wantCap, tt.wantSize)
+			}
+			// После роста и вытеснения значения остаются упорядоченными и последними
+			points := s.Range("gauge", "cpu", start, start.Add(time.Hour), 0)
+			if len(points) != tt.wantSize {
+				t.Fatalf("Range вернул %d значений, ожидалось %d", len(points), tt.wantSize)
+			}
+			for i, p := range points {
+				if want := float64(tt.appends - tt.wantSize + i); p.Value != want {
+					t.Errorf("значение %d = %v, ожидалось %v", i, p.Value, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackAndDelete(t *testing.T) {
+	s := NewStore(100)
+	var usage atomic.Int64
+	s.Track("gauge", "cpu", &usage)
+	if got := usage.Load(); got != seriesOverhead {
+		t.Fatalf("память пустого ряда %d, ожидалось %d", got, seriesOverhead)
+	}
+
+	start := time.Unix(0, 0)
+	for i := 0; i < 50; i++ {
+		s.Append("gauge", "cpu", start.Add(time.Duration(i)*time.Second), 1)
+	}
+	want := seriesOverhead + int64(len(s.series[key("gauge", "cpu")].raw.samples))*sampleSize
+	if got := usage.Load(); got != want {
+		t.Fatalf("память ряда %d, ожидалось %d", got, want)
+	}
+
+	s.Compact(start.Add(2*time.Minute), 0)
+	if got := usage.Load(); got <= want {
+		t.Errorf("агрегаты не учтены в памяти ряда: %d", got)
+	}
+
+	s.Delete("gauge", "cpu")
+	if s.Has("gauge", "cpu") {
+		t.Error("ряд не удалён")
+	}
+	if got := usage.Load(); got != 0 {
+		t.Errorf("после удаления учтено %d байт", got)
+	}
+	// Удаление отсутствующего ряда ничего не меняет
+	s.Delete("gauge", "cpu")
+	if got := usage.Load(); got != 0 {
+		t.Errorf("после повторного удаления учтено %d байт", got)
+	}
+}
@@ -0,0 +1,176 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Tier уровень агрегации: шаг агрегатов и срок их хранения
+type Tier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// Tiers уровни агрегации истории
+var Tiers = []Tier{
+	{Resolution: time.Minute, Retention: 24 * time.Hour},
+	{Resolution: 5 * time.Minute, Retention: 7 * 24 * time.Hour},
+	{Resolution: time.Hour, Retention: 90 * 24 * time.Hour},
+}
+
+// Aggregate агрегат значений ряда за один шаг
+type Aggregate struct {
+	Timestamp time.Time `json:"timestamp"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Sum       float64   `json:"sum"`
+	Count     int       `json:"count"`
+}
+
+// Avg возвращает среднее значение за шаг
+func (a Aggregate) Avg() float64 {
+	return a.Sum / float64(a.Count)
+}
+
+// add учитывает значение в агрегате
+func (a *Aggregate) add(v float64) {
+	if a.Count == 0 || v < a.Min {
+		a.Min = v
+	}
+	if a.Count == 0 || v > a.Max {
+		a.Max = v
+	}
+	a.Sum += v
+	a.Count++
+}
+
+// Value возвращает значение агрегата по имени функции: min, max, sum, avg или count
+func (a Aggregate) Value(fn string) (float64, error) {
+	switch fn {
+	case "min":
+		return a.Min, nil
+	case "max":
+		return a.Max, nil
+	case "sum":
+		return a.Sum, nil
+	case "avg":
+		return a.Avg(), nil
+	case "count":
+		return float64(a.Count), nil
+	default:
+		return 0, fmt.Errorf("неизвестная функция агрегации %q", fn)
+	}
+}
+
+// Compact учитывает в агрегатах исходные значения за завершённые минуты,
+// удаляет исходные значения старше retention (0 — не удалять)
+// и агрегаты старше срока хранения своего уровня
+func (s *Store) Compact(now time.Time, retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := now.Truncate(Tiers[0].Resolution)
+	for _, sr := range s.series {
+		r := &sr.raw
+		for i := 0; i < r.size; i++ {
+			sample := r.at(i)
+			if sample.Timestamp.Before(sr.compacted) {
+				continue
+			}
+			if !sample.Timestamp.Before(cutoff) {
+				break
+			}
+			for _, tier := range Tiers {
+				sr.rollup(tier.Resolution, sample)
+			}
+		}
+		if cutoff.After(sr.compacted) {
+			sr.compacted = cutoff
+		}
+
+		// Удаляем только уже учтённые в агрегатах значения
+		if retention > 0 {
+			expired := now.Add(-retention)
+			if expired.After(sr.compacted) {
+				expired = sr.compacted
+			}
+			r.dropBefore(expired)
+		}
+		for _, tier := range Tiers {
+			sr.prune(tier, now)
+		}
+		sr.account()
+	}
+}
+
+// rollup учитывает значение в агрегате соответствующего шага
+func (sr *series) rollup(resolution time.Duration, sample Sample) {
+	aggs := sr.rollups[resolution]
+	bucket := sample.Timestamp.Truncate(resolution)
+	if n := len(aggs); n == 0 || !aggs[n-1].Timestamp.Equal(bucket) {
+		aggs = append(aggs, Aggregate{Timestamp: bucket})
+	}
+	aggs[len(aggs)-1].add(sample.Value)
+	sr.rollups[resolution] = aggs
+}
+
+// prune удаляет агрегаты старше срока хранения уровня
+func (sr *series) prune(tier Tier, now time.Time) {
+	aggs := sr.rollups[tier.Resolution]
+	expired := now.Add(-tier.Retention)
+	i := 0
+	for i < len(aggs) && aggs[i].Timestamp.Before(expired) {
+		i++
+	}
+	if i > 0 {
+		sr.rollups[tier.Resolution] = append(aggs[:0:0], aggs[i:]...)
+	}
+}
+
+// Rollups возвращает агрегаты ряда с шагом resolution в интервале [from, to]
+func (s *Store) Rollups(mType, name string, resolution time.Duration, from, to time.Time) ([]Aggregate, error) {
+	if !validResolution(resolution) {
+		return nil, fmt.Errorf("шаг агрегации %s не поддерживается", resolution)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	aggs := []Aggregate{}
+	sr, ok := s.series[key(mType, name)]
+	if !ok {
+		return aggs, nil
+	}
+	for _, a := range sr.rollups[resolution] {
+		if !a.Timestamp.Before(from) && !a.Timestamp.After(to) {
+			aggs = append(aggs, a)
+		}
+	}
+	return aggs, nil
+}
+
+// validResolution проверяет, что для шага есть уровень агрегации
+func validResolution(resolution time.Duration) bool {
+	for _, tier := range Tiers {
+		if tier.Resolution == resolution {
+			return true
+		}
+	}
+	return false
+}
+
+// RunCompaction периодически сворачивает историю до отмены контекста
+func (s *Store) RunCompaction(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Compact(now, retention)
+		}
+	}
+}
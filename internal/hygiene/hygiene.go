@@ -0,0 +1,292 @@
+// Package hygiene ищет метрики, которые, скорее всего, никому не нужны:
+// их не читают, они не меняются неделями, их имена нарушают правила
+// или почти совпадают с именами других метрик. Отчёт помогает командам
+// чистить хранилище, но сами метрики не удаляет.
+package hygiene
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Признаки подозрительной метрики
+const (
+	// IssueNeverRead метрику не запрашивали через API чтения
+	IssueNeverRead = "never_read"
+	// IssueConstant значение метрики не менялось дольше окна
+	IssueConstant = "constant"
+	// IssueNaming имя нарушает правила имён
+	IssueNaming = "naming"
+	// IssueNearDuplicate имя отличается от другого только регистром и разделителями
+	IssueNearDuplicate = "near_duplicate"
+)
+
+// Source хранилище, метрики которого проверяются
+type Source interface {
+	GetAll(ctx context.Context) (map[string]float64, map[string]int64, error)
+}
+
+// key метрика в учёте
+type key struct {
+	mType string
+	name  string
+}
+
+// state сведения о метрике, накопленные с запуска сервера
+type state struct {
+	value      float64
+	firstSeen  time.Time
+	lastChange time.Time
+	lastRead   time.Time
+}
+
+// Finding подозрительная метрика
+type Finding struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Issues []string `json:"issues"`
+	// Naming чем имя нарушает правила
+	Naming string `json:"naming,omitempty"`
+	// Similar метрики с почти совпадающими именами
+	Similar    []string   `json:"similar,omitempty"`
+	LastChange time.Time  `json:"last_change"`
+	LastRead   *time.Time `json:"last_read,omitempty"`
+}
+
+// Report итог последней проверки
+type Report struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// Window срок без чтений или изменений, после которого метрика подозрительна
+	Window string `json:"window"`
+	// Metrics число проверенных метрик
+	Metrics  int       `json:"metrics"`
+	Findings []Finding `json:"findings"`
+}
+
+// Detector учитывает чтения и изменения метрик и периодически составляет
+// отчёт. Сведения хранятся в памяти, поэтому после перезапуска метрика
+// может попасть в отчёт не раньше, чем через окно.
+type Detector struct {
+	source Source
+	window time.Duration
+	// check проверяет имя метрики по правилам (nil — не проверяется)
+	check func(name string) error
+
+	mu      sync.Mutex
+	metrics map[key]*state
+	report  *Report
+}
+
+// New создаёт обнаружение для хранилища source с окном window
+func New(source Source, window time.Duration, check func(name string) error) *Detector {
+	return &Detector{source: source, window: window, check: check, metrics: make(map[key]*state)}
+}
+
+// get возвращает сведения о метрике, заводя их при первом обращении.
+// Вызывается под блокировкой.
+func (d *Detector) get(k key, now time.Time) *state {
+	s, ok := d.metrics[k]
+	if !ok {
+		s = &state{firstSeen: now, lastChange: now}
+		d.metrics[k] = s
+	}
+	return s
+}
+
+// Observe отмечает принятое значение метрики
+func (d *Detector) Observe(m models.Metrics) {
+	var value float64
+	if m.Value != nil {
+		value = *m.Value
+	} else if m.Delta != nil {
+		value = float64(*m.Delta)
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := key{m.MType, m.ID}
+	if s, ok := d.metrics[k]; ok && s.value != value {
+		s.lastChange = now
+	}
+	d.get(k, now).value = value
+}
+
+// Read отмечает чтение метрики name типа mType через API
+func (d *Detector) Read(mType, name string) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.get(key{mType, name}, now).lastRead = now
+}
+
+// Run составляет отчёт сразу и затем с периодом interval до отмены контекста
+func (d *Detector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.Scan(ctx); err != nil {
+			log.Printf("Проверка метрик не удалась: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan проверяет метрики хранилища и сохраняет отчёт
+func (d *Detector) Scan(ctx context.Context) (Report, error) {
+	gauges, counters, err := d.source.GetAll(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	now := time.Now()
+	current := make(map[key]float64, len(gauges)+len(counters))
+	for name, v := range gauges {
+		current[key{models.Gauge, name}] = v
+	}
+	for name, v := range counters {
+		current[key{models.Counter, name}] = float64(v)
+	}
+
+	d.mu.Lock()
+	findings := make(map[key]*Finding)
+	flag := func(k key, s *state, issue string) *Finding {
+		f, ok := findings[k]
+		if !ok {
+			f = &Finding{Name: k.name, Type: k.mType, LastChange: s.lastChange}
+			if !s.lastRead.IsZero() {
+				lastRead := s.lastRead
+				f.LastRead = &lastRead
+			}
+			findings[k] = f
+		}
+		f.Issues = append(f.Issues, issue)
+		return f
+	}
+	// Метрики, которых больше нет в хранилище, забываются
+	for k := range d.metrics {
+		if _, ok := current[k]; !ok {
+			delete(d.metrics, k)
+		}
+	}
+	similar := make(map[string][]key)
+	for k, v := range current {
+		s := d.get(k, now)
+		if s.value != v {
+			s.value, s.lastChange = v, now
+		}
+		if s.lastRead.IsZero() && now.Sub(s.firstSeen) >= d.window {
+			flag(k, s, IssueNeverRead)
+		}
+		if now.Sub(s.lastChange) >= d.window {
+			flag(k, s, IssueConstant)
+		}
+		if d.check != nil {
+			if err := d.check(clientName(k.name)); err != nil {
+				flag(k, s, IssueNaming).Naming = err.Error()
+			}
+		}
+		norm := k.mType + " " + normalize(k.name)
+		similar[norm] = append(similar[norm], k)
+	}
+	for _, keys := range similar {
+		if len(keys) < 2 {
+			continue
+		}
+		for _, k := range keys {
+			f := flag(k, d.metrics[k], IssueNearDuplicate)
+			for _, other := range keys {
+				if other != k {
+					f.Similar = append(f.Similar, other.name)
+				}
+			}
+			sort.Strings(f.Similar)
+		}
+	}
+	d.mu.Unlock()
+
+	report := Report{GeneratedAt: now, Window: d.window.String(), Metrics: len(current), Findings: make([]Finding, 0, len(findings))}
+	for _, f := range findings {
+		report.Findings = append(report.Findings, *f)
+	}
+	sort.Slice(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Type < b.Type
+	})
+
+	d.mu.Lock()
+	d.report = &report
+	d.mu.Unlock()
+	return report, nil
+}
+
+// clientName имя метрики без префикса арендатора
+func clientName(stored string) string {
+	base, _, _ := labels.Parse(stored)
+	if i := strings.Index(base, tenant.Separator); i >= 0 {
+		return stored[i+len(tenant.Separator):]
+	}
+	return stored
+}
+
+// normalize приводит имя к виду, в котором почти совпадающие имена
+// равны: без учёта регистра и разделителей слов
+func normalize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '_', '-', '.', ':':
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+// Handler обработчик GET /admin/hygiene: последний отчёт, а с параметром
+// refresh=true — отчёт по свежей проверке
+func (d *Detector) Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	d.mu.Lock()
+	report := d.report
+	d.mu.Unlock()
+	if report == nil || r.URL.Query().Get("refresh") == "true" {
+		fresh, err := d.Scan(r.Context())
+		if err != nil {
+			http.Error(w, "Не удалось прочитать метрики.", http.StatusInternalServerError)
+			return
+		}
+		report = &fresh
+	}
+	if issue := r.URL.Query().Get("issue"); issue != "" {
+		filtered := *report
+		filtered.Findings = []Finding{}
+		for _, f := range report.Findings {
+			for _, i := range f.Issues {
+				if i == issue {
+					filtered.Findings = append(filtered.Findings, f)
+					break
+				}
+			}
+		}
+		report = &filtered
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,141 @@
+package labels
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Гистограмма хранится как набор counter с накопленным числом наблюдений
+// по верхним границам корзин, как в Prometheus:
+//
+//	latency_bucket{host=web1,le=0.1}  наблюдения не больше 0.1
+//	latency_bucket{host=web1,le=+Inf} все наблюдения
+//
+// Корзины с одинаковыми границами из разных рядов складываются,
+// и квантили считаются по объединённому распределению.
+
+// BucketSuffix окончание имени counter корзины гистограммы
+const BucketSuffix = "_bucket"
+
+// LeLabel метка верхней границы корзины
+const LeLabel = "le"
+
+// Bucket корзина гистограммы: число наблюдений не больше Le
+type Bucket struct {
+	Le    float64
+	Count float64
+}
+
+// Histogram объединённая гистограмма группы рядов
+type Histogram struct {
+	Labels map[string]string
+	// Buckets корзины по возрастанию границ
+	Buckets []Bucket
+	// Series число объединённых гистограмм
+	Series int
+}
+
+// Count общее число наблюдений гистограммы
+func (h Histogram) Count() float64 {
+	if len(h.Buckets) == 0 {
+		return 0
+	}
+	return h.Buckets[len(h.Buckets)-1].Count
+}
+
+// MergeHistograms объединяет гистограммы с базовым именем base по группам g.
+// series — накопленные значения counter корзин (имя — значение).
+// Группы упорядочены по меткам.
+func MergeHistograms(series map[string]float64, base string, g Grouping) []Histogram {
+	type merged struct {
+		labels  map[string]string
+		buckets map[float64]float64
+		// hosts метки рядов без le: по ним считается число гистограмм
+		hosts map[string]bool
+	}
+	groups := make(map[string]*merged)
+	for name, v := range series {
+		b, set, ok := Parse(name)
+		if !ok || b != base+BucketSuffix {
+			continue
+		}
+		le, err := strconv.ParseFloat(set[LeLabel], 64)
+		if err != nil {
+			continue
+		}
+		delete(set, LeLabel)
+		labels := g.key(set)
+		delete(labels, LeLabel)
+		id := Format("", labels)
+		m, ok := groups[id]
+		if !ok {
+			m = &merged{labels: labels, buckets: make(map[float64]float64), hosts: make(map[string]bool)}
+			groups[id] = m
+		}
+		m.buckets[le] += v
+		m.hosts[Format("", set)] = true
+	}
+
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := make([]Histogram, 0, len(ids))
+	for _, id := range ids {
+		m := groups[id]
+		h := Histogram{Labels: m.labels, Series: len(m.hosts)}
+		for le, n := range m.buckets {
+			h.Buckets = append(h.Buckets, Bucket{Le: le, Count: n})
+		}
+		sort.Slice(h.Buckets, func(i, j int) bool { return h.Buckets[i].Le < h.Buckets[j].Le })
+		result = append(result, h)
+	}
+	return result
+}
+
+// Quantile оценивает квантиль q (от 0 до 1) гистограммы линейной
+// интерполяцией внутри корзины, как histogram_quantile в Prometheus.
+// Если квантиль попадает в корзину +Inf, возвращается граница
+// предыдущей корзины. Без наблюдений или без корзины +Inf — NaN.
+func (h Histogram) Quantile(q float64) float64 {
+	n := len(h.Buckets)
+	if n == 0 || !math.IsInf(h.Buckets[n-1].Le, 1) || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	total := h.Buckets[n-1].Count
+	if total <= 0 {
+		return math.NaN()
+	}
+	rank := q * total
+
+	// Накопленные значения разных рядов могут быть немонотонны,
+	// если корзины отправлены в разное время: выравниваем их
+	counts := make([]float64, n)
+	for i, b := range h.Buckets {
+		counts[i] = b.Count
+		if i > 0 && counts[i] < counts[i-1] {
+			counts[i] = counts[i-1]
+		}
+	}
+
+	i := sort.Search(n, func(i int) bool { return counts[i] >= rank })
+	if i == n-1 {
+		if n == 1 {
+			return math.NaN()
+		}
+		return h.Buckets[n-2].Le
+	}
+	lower, below := 0.0, 0.0
+	if i > 0 {
+		lower, below = h.Buckets[i-1].Le, counts[i-1]
+	} else if h.Buckets[0].Le <= 0 {
+		return h.Buckets[0].Le
+	}
+	inBucket := counts[i] - below
+	if inBucket <= 0 {
+		return h.Buckets[i].Le
+	}
+	return lower + (h.Buckets[i].Le-lower)*(rank-below)/inBucket
+}
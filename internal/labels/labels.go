@@ -0,0 +1,201 @@
+// Package labels разбирает метки в именах метрик и агрегирует ряды по ним.
+//
+// Метки записываются в имени метрики в фигурных скобках после базового
+// имени: cpu_usage{host=web1,core=0}. Ряды с одним базовым именем
+// и разными метками складываются, усредняются и т. п. по группам,
+// чтобы получить, например, загрузку по всему парку без выгрузки
+// рядов каждого хоста.
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Функции агрегации
+const (
+	Sum   = "sum"
+	Avg   = "avg"
+	Min   = "min"
+	Max   = "max"
+	Count = "count"
+)
+
+// Funcs допустимые функции агрегации
+var Funcs = []string{Sum, Avg, Min, Max, Count}
+
+// ErrFunc неизвестная функция агрегации
+var ErrFunc = errors.New("функция агрегации: sum, avg, min, max или count")
+
+// Parse разбирает имя метрики на базовое имя и метки. Имя без меток или
+// с неверно записанными метками целиком считается базовым, а ok — false.
+func Parse(name string) (base string, set map[string]string, ok bool) {
+	open := strings.IndexByte(name, '{')
+	if open <= 0 || !strings.HasSuffix(name, "}") {
+		return name, nil, false
+	}
+	set = make(map[string]string)
+	body := name[open+1 : len(name)-1]
+	if body != "" {
+		for _, pair := range strings.Split(body, ",") {
+			k, v, found := strings.Cut(pair, "=")
+			if !found || k == "" || strings.ContainsAny(k, "{}") || strings.ContainsAny(v, "{}") {
+				return name, nil, false
+			}
+			if _, dup := set[k]; dup {
+				return name, nil, false
+			}
+			set[k] = v
+		}
+	}
+	return name[:open], set, true
+}
+
+// Format записывает имя метрики с метками в порядке их имён
+func Format(base string, set map[string]string) string {
+	if len(set) == 0 {
+		return base
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(base)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%s", k, set[k])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Grouping способ группировки рядов: по перечисленным меткам (By)
+// или по всем меткам, кроме перечисленных (Without).
+// Пустая группировка сводит все ряды в один.
+type Grouping struct {
+	By      []string
+	Without []string
+}
+
+// key возвращает метки группы ряда
+func (g Grouping) key(set map[string]string) map[string]string {
+	group := make(map[string]string)
+	if len(g.Without) > 0 {
+		for k, v := range set {
+			group[k] = v
+		}
+		for _, k := range g.Without {
+			delete(group, k)
+		}
+		return group
+	}
+	for _, k := range g.By {
+		// Ряд без метки попадает в группу с пустым значением
+		group[k] = set[k]
+	}
+	return group
+}
+
+// Group итог агрегации одной группы рядов
+type Group struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+	// Series число рядов группы
+	Series int `json:"series"`
+}
+
+// Aggregate агрегирует функцией fn ряды series (имя — значение) с базовым
+// именем base по группам g. Ряды без меток входят в группу с пустыми
+// метками. Группы упорядочены по меткам.
+func Aggregate(series map[string]float64, base string, g Grouping, fn string) ([]Group, error) {
+	switch fn {
+	case Sum, Avg, Min, Max, Count:
+	default:
+		return nil, ErrFunc
+	}
+	if len(g.By) > 0 && len(g.Without) > 0 {
+		return nil, errors.New("группировка задаётся либо by, либо without")
+	}
+
+	groups := make(map[string]*Group)
+	for name, v := range series {
+		b, set, _ := Parse(name)
+		if b != base {
+			continue
+		}
+		labels := g.key(set)
+		id := Format("", labels)
+		gr, ok := groups[id]
+		if !ok {
+			gr = &Group{Labels: labels, Value: v}
+			groups[id] = gr
+		} else {
+			switch fn {
+			case Sum, Avg:
+				gr.Value += v
+			case Min:
+				gr.Value = math.Min(gr.Value, v)
+			case Max:
+				gr.Value = math.Max(gr.Value, v)
+			}
+		}
+		gr.Series++
+	}
+
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := make([]Group, 0, len(ids))
+	for _, id := range ids {
+		gr := groups[id]
+		switch fn {
+		case Avg:
+			gr.Value /= float64(gr.Series)
+		case Count:
+			gr.Value = float64(gr.Series)
+		}
+		result = append(result, *gr)
+	}
+	return result, nil
+}
+
+// Reduce сводит функцией fn значения рядов values в одну группу без меток
+func Reduce(values []float64, fn string) (Group, error) {
+	gr := Group{Labels: map[string]string{}, Series: len(values)}
+	for i, v := range values {
+		switch {
+		case i == 0:
+			gr.Value = v
+		case fn == Sum || fn == Avg:
+			gr.Value += v
+		case fn == Min:
+			gr.Value = math.Min(gr.Value, v)
+		case fn == Max:
+			gr.Value = math.Max(gr.Value, v)
+		case fn != Count:
+			return Group{}, ErrFunc
+		}
+	}
+	switch fn {
+	case Avg:
+		if gr.Series > 0 {
+			gr.Value /= float64(gr.Series)
+		}
+	case Count:
+		gr.Value = float64(gr.Series)
+	case Sum, Min, Max:
+	default:
+		return Group{}, ErrFunc
+	}
+	return gr, nil
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdmin(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{name: "верный токен", token: "secret", header: "Bearer secret", want: http.StatusOK},
+		{name: "неверный токен", token: "secret", header: "Bearer other", want: http.StatusUnauthorized},
+		{name: "без заголовка", token: "secret", want: http.StatusUnauthorized},
+		{name: "токен без Bearer", token: "secret", header: "secret", want: http.StatusUnauthorized},
+		{name: "токен не задан", want: http.StatusForbidden},
+		{name: "токен не задан, пустой Bearer", header: "Bearer ", want: http.StatusForbidden},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/snapshot", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			Admin(tt.token)(next).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("код %d, ожидался %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Middleware обёртка обработчика HTTP
+type Middleware func(http.Handler) http.Handler
+
+// Chain оборачивает обработчик h цепочкой mws. Первая обёртка внешняя:
+// она первой получает запрос и последней — ответ.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Build собирает цепочку из обёрток available по их именам names в заданном
+// порядке. Неизвестное или повторённое имя — ошибка.
+func Build(names []string, available map[string]Middleware) ([]Middleware, error) {
+	seen := make(map[string]bool, len(names))
+	chain := make([]Middleware, 0, len(names))
+	for _, name := range names {
+		mw, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("неизвестная обёртка %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("обёртка %q указана дважды", name)
+		}
+		seen[name] = true
+		chain = append(chain, mw)
+	}
+	return chain, nil
+}
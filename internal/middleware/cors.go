@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/internal/sign"
+)
+
+// CORSConfig настройки запросов из браузера со страниц других источников
+type CORSConfig struct {
+	// Origins разрешённые источники, например https://dash.example.com;
+	// "*" разрешает любой источник
+	Origins []string `json:"origins"`
+	// Methods разрешённые методы; по умолчанию GET и POST
+	Methods []string `json:"methods"`
+	// Headers разрешённые заголовки запроса; по умолчанию заголовки,
+	// которые понимает сервер
+	Headers []string `json:"headers"`
+	// MaxAge сколько секунд браузер может хранить ответ на предварительный запрос
+	MaxAge int `json:"max_age"`
+	// Credentials разрешить запросы с cookie и заголовком Authorization
+	Credentials bool `json:"credentials"`
+}
+
+// Заголовки по умолчанию: разрешённые в запросе и доступные странице в ответе
+var (
+	corsHeaders       = []string{"Content-Type", "Content-Encoding", "Authorization", APIKeyHeader, sign.Header, sign.SHA512_256.Header, sign.BLAKE2b256.Header, "Last-Event-ID", "X-Read-Consistency"}
+	corsExposeHeaders = []string{"X-Metric-Unit", "X-Read-Consistency", sign.Header, sign.SHA512_256.Header, sign.BLAKE2b256.Header, sign.AlgorithmsHeader, "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"}
+)
+
+// CORS отвечает на предварительные запросы OPTIONS и добавляет заголовки
+// Access-Control-* к ответам на запросы разрешённых источников.
+// Без разрешённых источников возвращает обработчик без изменений.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(cfg.Origins) == 0 {
+			return next
+		}
+		anyOrigin := slices.Contains(cfg.Origins, "*")
+		methods := cfg.Methods
+		if len(methods) == 0 {
+			methods = []string{http.MethodGet, http.MethodPost}
+		}
+		headers := cfg.Headers
+		if len(headers) == 0 {
+			headers = corsHeaders
+		}
+		allowMethods := strings.Join(methods, ", ")
+		allowHeaders := strings.Join(headers, ", ")
+		exposeHeaders := strings.Join(corsExposeHeaders, ", ")
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if !anyOrigin && !slices.Contains(cfg.Origins, origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// С cookie браузер не принимает "*", поэтому источник возвращается как есть
+			if anyOrigin && !cfg.Credentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.Credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			// Предварительный запрос обрабатывается здесь и не доходит до обработчиков
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", allowMethods)
+				h.Set("Access-Control-Allow-Headers", allowHeaders)
+				if cfg.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h.Set("Access-Control-Expose-Headers", exposeHeaders)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
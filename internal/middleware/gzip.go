@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/iliodor1/metrics-service/internal/websocket"
+)
+
+// zstdWindow окно сжатия zstd. Браузеры принимают Content-Encoding: zstd
+// с окном не больше 8 МиБ, а потоку метрик хватает и меньшего.
+const zstdWindow = 1 << 20
+
+// zstdEncoders кодировщики zstd для повторного использования: создание
+// кодировщика дороже сжатия типичного ответа
+var zstdEncoders = sync.Pool{New: func() any {
+	enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(zstdWindow))
+	return enc
+}}
+
+// encoder сжимающий поток ответа
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// compressWriter сжимает ответ обработчика
+type compressWriter struct {
+	http.ResponseWriter
+	enc encoder
+	// encoding значение заголовка Content-Encoding
+	encoding    string
+	wroteHeader bool
+}
+
+// Write записывает сжатые данные. Если обработчик не отправил статус,
+// отправляется 200 с заголовком сжатия, как это сделал бы net/http.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.enc.Write(b)
+}
+
+// WriteHeader выставляет заголовок сжатия перед отправкой статуса
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Encoding", w.encoding)
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush отправляет клиенту уже сжатые данные, что нужно потоковым ответам
+func (w *compressWriter) Flush() {
+	w.enc.Flush()
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Gzip распаковывает тела запросов с Content-Encoding: gzip и сжимает
+// ответы клиентам, которые поддерживают сжатие. Клиенты, принимающие zstd,
+// получают ответ в zstd: он сжимает поток репликации плотнее и быстрее,
+// остальные — в gzip.
+func Gzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "Неверные сжатые данные.", http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			r.Body = zr
+			r.Header.Del("Content-Encoding")
+		}
+
+		// Соединения WebSocket перехватываются обработчиком и не сжимаются
+		accept := r.Header.Get("Accept-Encoding")
+		var cw *compressWriter
+		switch {
+		case websocket.IsUpgrade(r):
+			next.ServeHTTP(w, r)
+			return
+		case strings.Contains(accept, "zstd"):
+			enc := zstdEncoders.Get().(*zstd.Encoder)
+			enc.Reset(w)
+			defer func() {
+				// Кодировщик в пуле не должен удерживать завершённый ответ
+				enc.Reset(nil)
+				zstdEncoders.Put(enc)
+			}()
+			cw = &compressWriter{ResponseWriter: w, enc: enc, encoding: "zstd"}
+		case strings.Contains(accept, "gzip"):
+			cw = &compressWriter{ResponseWriter: w, enc: gzip.NewWriter(w), encoding: "gzip"}
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		next.ServeHTTP(cw, r)
+		// Пустой ответ без статуса отправляется как есть, без сжатых данных
+		if cw.wroteHeader {
+			cw.enc.Close()
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestGzipNegotiation(t *testing.T) {
+	body := strings.Repeat("event: delta\ndata: 0 1\n\n", 100)
+	tests := []struct {
+		name     string
+		accept   string
+		encoding string
+	}{
+		{name: "zstd", accept: "zstd", encoding: "zstd"},
+		{name: "zstd предпочтительнее gzip", accept: "gzip, deflate, br, zstd", encoding: "zstd"},
+		{name: "gzip", accept: "gzip", encoding: "gzip"},
+		{name: "без сжатия", accept: "", encoding: ""},
+		{name: "неизвестное сжатие", accept: "br", encoding: ""},
+	}
+	h := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept-Encoding", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Content-Encoding %q, ожидалось %q", got, tt.encoding)
+			}
+
+			var rd io.Reader = w.Body
+			switch tt.encoding {
+			case "zstd":
+				zr, err := zstd.NewReader(rd)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer zr.Close()
+				rd = zr
+			case "gzip":
+				zr, err := gzip.NewReader(rd)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rd = zr
+			}
+			got, err := io.ReadAll(rd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != body {
+				t.Errorf("тело после распаковки отличается: %d байт вместо %d", len(got), len(body))
+			}
+		})
+	}
+}
+
+func TestGzipEmptyResponse(t *testing.T) {
+	h := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, accept := range []string{"zstd", "gzip"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Body.Len() != 0 || w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: пустой ответ сжат: %d байт, %q", accept, w.Body.Len(), w.Header().Get("Content-Encoding"))
+		}
+	}
+}
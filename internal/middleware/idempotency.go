@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyHeader заголовок, в котором клиент передаёт ключ
+// идемпотентности: повторы запроса с тем же ключом не применяются заново
+const IdempotencyHeader = "Idempotency-Key"
+
+// ReplayedHeader отмечает ответ, повторённый по ключу идемпотентности
+const ReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKey наибольшая длина ключа идемпотентности
+const maxIdempotencyKey = 255
+
+// idempotentResponse запомненный ответ на запрос с ключом
+type idempotentResponse struct {
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyKey ключ в очереди на удаление
+type idempotencyKey struct {
+	key     string
+	expires time.Time
+}
+
+// Idempotency запоминает ответы на запросы с ключом идемпотентности
+// на время window, чтобы повтор запроса после сетевой ошибки (например,
+// пакета приращений counter) не применялся дважды.
+type Idempotency struct {
+	mu        sync.Mutex
+	window    time.Duration
+	maxKeys   int
+	responses map[string]*idempotentResponse
+	// queue ключи в порядке запоминания для удаления устаревших
+	queue []idempotencyKey
+	now   func() time.Time
+	// principal возвращает проверенного клиента запроса или пустую строку
+	principal func(r *http.Request) string
+}
+
+// NewIdempotency создаёт хранилище ключей идемпотентности на время window
+// не более чем для maxKeys запросов: при переполнении забываются самые старые.
+// principal возвращает клиента, прошедшего проверку ключа или токена
+// (nil — проверки нет); ключи разных клиентов не пересекаются.
+func NewIdempotency(window time.Duration, maxKeys int, principal func(r *http.Request) string) *Idempotency {
+	return &Idempotency{
+		window:    window,
+		maxKeys:   maxKeys,
+		responses: make(map[string]*idempotentResponse),
+		now:       time.Now,
+		principal: principal,
+	}
+}
+
+// scope клиент, в пределах которого действует ключ: проверенный клиент,
+// а без проверки — API-ключ из заголовка
+func (c *Idempotency) scope(r *http.Request) string {
+	if c.principal != nil {
+		if p := c.principal(r); p != "" {
+			return p
+		}
+	}
+	return "key:" + r.Header.Get(APIKeyHeader)
+}
+
+// sweep забывает устаревшие ключи и самые старые при переполнении
+func (c *Idempotency) sweep(now time.Time) {
+	for len(c.queue) > 0 {
+		k := c.queue[0]
+		resp, ok := c.responses[k.key]
+		switch {
+		case !ok || !resp.expires.Equal(k.expires):
+			// Ключ уже забыт или запомнен заново
+		case now.After(k.expires) || len(c.responses) > c.maxKeys:
+			delete(c.responses, k.key)
+		default:
+			return
+		}
+		c.queue = c.queue[1:]
+	}
+}
+
+// recordWriter передаёт ответ клиенту и запоминает его
+type recordWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+// Write передаёт и запоминает тело ответа
+func (w *recordWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteHeader передаёт и запоминает статус ответа
+func (w *recordWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Middleware оборачивает обработчик обновлений. Ключ действует в пределах
+// пути запроса и клиента. Повтор выполненного запроса получает
+// запомненный ответ с заголовком Idempotent-Replayed, повтор выполняющегося —
+// ответ 409. Ответы 5xx не запоминаются, чтобы запрос можно было повторить.
+func (c *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			http.Error(w, "Слишком длинный ключ идемпотентности.", http.StatusBadRequest)
+			return
+		}
+		key = c.scope(r) + "\x00" + r.URL.Path + "\x00" + key
+
+		c.mu.Lock()
+		now := c.now()
+		c.sweep(now)
+		if resp, ok := c.responses[key]; ok {
+			c.mu.Unlock()
+			if !resp.done {
+				http.Error(w, "Запрос с этим ключом идемпотентности ещё выполняется.", http.StatusConflict)
+				return
+			}
+			if resp.contentType != "" {
+				w.Header().Set("Content-Type", resp.contentType)
+			}
+			w.Header().Set(ReplayedHeader, "true")
+			w.WriteHeader(resp.status)
+			w.Write(resp.body)
+			return
+		}
+		pending := &idempotentResponse{expires: now.Add(c.window)}
+		c.responses[key] = pending
+		c.queue = append(c.queue, idempotencyKey{key: key, expires: pending.expires})
+		c.mu.Unlock()
+
+		rw := &recordWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.responses[key] != pending {
+			return
+		}
+		if rw.status >= http.StatusInternalServerError {
+			delete(c.responses, key)
+			return
+		}
+		// Срок отсчитывается от завершения запроса
+		pending.done = true
+		pending.status = rw.status
+		pending.contentType = w.Header().Get("Content-Type")
+		pending.body = rw.buf.Bytes()
+		pending.expires = c.now().Add(c.window)
+		c.queue = append(c.queue, idempotencyKey{key: key, expires: pending.expires})
+	})
+}
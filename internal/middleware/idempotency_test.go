@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// idempotencyRequest описывает запрос к обработчику с ключом идемпотентности
+type idempotencyRequest struct {
+	path      string
+	key       string
+	apiKey    string
+	principal string
+	// after сдвиг часов перед запросом
+	after      time.Duration
+	wantStatus int
+	wantReplay bool
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	req := func(key string) idempotencyRequest {
+		return idempotencyRequest{path: "/updates/", key: key, wantStatus: http.StatusOK}
+	}
+	replay := func(r idempotencyRequest) idempotencyRequest {
+		r.wantReplay = true
+		return r
+	}
+	tests := []struct {
+		name     string
+		maxKeys  int
+		failures int
+		requests []idempotencyRequest
+		// wantCalls число выполнений обработчика
+		wantCalls int
+	}{
+		{name: "повтор получает запомненный ответ", requests: []idempotencyRequest{req("a"), replay(req("a")), replay(req("a"))}, wantCalls: 1},
+		{name: "без ключа", requests: []idempotencyRequest{req(""), req("")}, wantCalls: 2},
+		{name: "разные ключи", requests: []idempotencyRequest{req("a"), req("b")}, wantCalls: 2},
+		{name: "другой путь", requests: []idempotencyRequest{req("a"), {path: "/update/counter/hits/1", key: "a", wantStatus: http.StatusOK}}, wantCalls: 2},
+		{name: "другой API-ключ", requests: []idempotencyRequest{
+			{path: "/updates/", key: "a", apiKey: "k1", wantStatus: http.StatusOK},
+			{path: "/updates/", key: "a", apiKey: "k2", wantStatus: http.StatusOK},
+			{path: "/updates/", key: "a", apiKey: "k1", wantStatus: http.StatusOK, wantReplay: true},
+		}, wantCalls: 2},
+		{name: "разные проверенные клиенты", requests: []idempotencyRequest{
+			{path: "/updates/", key: "a", principal: "auth:alice", wantStatus: http.StatusOK},
+			{path: "/updates/", key: "a", principal: "auth:bob", wantStatus: http.StatusOK},
+		}, wantCalls: 2},
+		{name: "проверенный клиент с разными API-ключами", requests: []idempotencyRequest{
+			{path: "/updates/", key: "a", apiKey: "k1", principal: "tenant:a", wantStatus: http.StatusOK},
+			{path: "/updates/", key: "a", apiKey: "k2", principal: "tenant:a", wantStatus: http.StatusOK, wantReplay: true},
+		}, wantCalls: 1},
+		{name: "ключ устарел", requests: []idempotencyRequest{req("a"), {path: "/updates/", key: "a", after: 2 * time.Minute, wantStatus: http.StatusOK}}, wantCalls: 2},
+		{name: "ключ ещё действует", requests: []idempotencyRequest{req("a"), {path: "/updates/", key: "a", after: 30 * time.Second, wantStatus: http.StatusOK, wantReplay: true}}, wantCalls: 1},
+		{name: "старые ключи забываются при переполнении", maxKeys: 2, requests: []idempotencyRequest{req("a"), req("b"), req("c"), req("a")}, wantCalls: 4},
+		{name: "ответ 5xx не запоминается", failures: 1, requests: []idempotencyRequest{
+			{path: "/updates/", key: "a", wantStatus: http.StatusInternalServerError}, req("a"), replay(req("a")),
+		}, wantCalls: 2},
+		{name: "слишком длинный ключ", requests: []idempotencyRequest{
+			{path: "/updates/", key: strings.Repeat("k", maxIdempotencyKey+1), wantStatus: http.StatusBadRequest},
+		}, wantCalls: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxKeys := tt.maxKeys
+			if maxKeys == 0 {
+				maxKeys = 100
+			}
+			c := NewIdempotency(time.Minute, maxKeys, func(r *http.Request) string { return r.Header.Get("X-Test-Principal") })
+			now := time.Unix(1700000000, 0)
+			c.now = func() time.Time { return now }
+
+			var calls atomic.Int32
+			h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				if int(n) <= tt.failures {
+					http.Error(w, "сбой", http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"call":%d}`, n)
+			}))
+
+			var first string
+			for i, rq := range tt.requests {
+				now = now.Add(rq.after)
+				r := httptest.NewRequest(http.MethodPost, rq.path, nil)
+				if rq.key != "" {
+					r.Header.Set(IdempotencyHeader, rq.key)
+				}
+				if rq.apiKey != "" {
+					r.Header.Set(APIKeyHeader, rq.apiKey)
+				}
+				if rq.principal != "" {
+					r.Header.Set("X-Test-Principal", rq.principal)
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				if w.Code != rq.wantStatus {
+					t.Fatalf("запрос %d: код %d, ожидался %d", i, w.Code, rq.wantStatus)
+				}
+				if replayed := w.Header().Get(ReplayedHeader) == "true"; replayed != rq.wantReplay {
+					t.Fatalf("запрос %d: повтор %t, ожидался %t", i, replayed, rq.wantReplay)
+				}
+				if w.Code == http.StatusOK && first == "" {
+					first = w.Body.String()
+				}
+				if rq.wantReplay {
+					if w.Body.String() != first || w.Header().Get("Content-Type") != "application/json" {
+						t.Errorf("запрос %d: повторён ответ %q (%s), ожидался %q", i, w.Body.String(), w.Header().Get("Content-Type"), first)
+					}
+				}
+			}
+			if n := int(calls.Load()); n != tt.wantCalls {
+				t.Errorf("обработчик выполнен %d раз, ожидалось %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	c := NewIdempotency(time.Minute, 100, nil)
+	started, release := make(chan struct{}), make(chan struct{})
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		r.Header.Set(IdempotencyHeader, "a")
+		return r
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(httptest.NewRecorder(), newRequest())
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newRequest())
+	if w.Code != http.StatusConflict {
+		t.Errorf("код повтора выполняющегося запроса %d, ожидался %d", w.Code, http.StatusConflict)
+	}
+	close(release)
+	<-done
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newRequest())
+	if w.Code != http.StatusOK || w.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("код %d, повтор %q после завершения запроса", w.Code, w.Header().Get(ReplayedHeader))
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// loggingWriter запоминает статус и размер ответа
+type loggingWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+// WriteHeader передаёт и запоминает статус ответа
+func (w *loggingWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write передаёт тело ответа и считает его размер
+func (w *loggingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+// Hijack передаёт соединение обработчику WebSocket
+func (w *loggingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Flush отправляет клиенту записанные данные потоковых ответов
+func (w *loggingWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController
+func (w *loggingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Logging записывает в журнал каждый запрос: метод, путь, статус,
+// размер ответа и время обработки
+func Logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &loggingWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+		if lw.status == 0 {
+			lw.status = http.StatusOK
+		}
+		log.Printf("%s %s %d %dB %s", r.Method, r.URL.RequestURI(), lw.status, lw.size, time.Since(start).Round(time.Microsecond))
+	})
+}
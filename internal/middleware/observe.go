@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// Observe сообщает функции observe статус и время обработки каждого запроса
+func Observe(observe func(status int, elapsed time.Duration)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			lw := &loggingWriter{ResponseWriter: w}
+			next.ServeHTTP(lw, r)
+			if lw.status == 0 {
+				lw.status = http.StatusOK
+			}
+			observe(lw.status, time.Since(start))
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Способы определения клиента для ограничителя запросов
+const (
+	LimitByIP  = "ip"
+	LimitByKey = "key"
+)
+
+// APIKeyHeader заголовок, в котором клиент передаёт свой API-ключ
+const APIKeyHeader = "X-API-Key"
+
+// bucketTTL время простоя, после которого корзина клиента удаляется
+const bucketTTL = 10 * time.Minute
+
+// maxBuckets наибольшее число корзин. Когда корзин столько, новые клиенты
+// до удаления простаивающих корзин делят одну общую корзину overflowKey:
+// клиент с множеством адресов не может ни исчерпать память, ни сбросить
+// чужие корзины.
+const (
+	maxBuckets  = 100000
+	overflowKey = "overflow"
+)
+
+// bucket корзина токенов одного клиента
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter ограничитель частоты запросов по алгоритму token bucket.
+// Для каждого клиента (по IP или проверенному ключу) ведётся своя корзина.
+type RateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	keyBy     string
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+	// principal возвращает проверенного клиента запроса или пустую строку
+	principal func(r *http.Request) string
+}
+
+// NewRateLimiter создаёт ограничитель, пропускающий rate запросов в секунду
+// с допустимым всплеском burst. keyBy задаёт способ определения клиента.
+// При rate, равном нулю, запросы не ограничиваются. principal возвращает
+// клиента, прошедшего проверку ключа или токена (nil — проверки нет);
+// при keyBy, равном LimitByKey, корзины ведутся по нему, а запросы
+// без проверенного клиента ограничиваются по IP.
+func NewRateLimiter(rate float64, burst int, keyBy string, principal func(r *http.Request) string) *RateLimiter {
+	l := &RateLimiter{
+		buckets:   make(map[string]*bucket),
+		now:       time.Now,
+		principal: principal,
+	}
+	l.SetLimits(rate, burst, keyBy)
+	return l
+}
+
+// SetLimits меняет лимиты на ходу. Корзины клиентов сохраняются,
+// если не изменился способ определения клиента.
+func (l *RateLimiter) SetLimits(rate float64, burst int, keyBy string) {
+	if burst < 1 {
+		burst = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if keyBy != l.keyBy {
+		l.buckets = make(map[string]*bucket)
+	}
+	l.rate, l.burst, l.keyBy = rate, float64(burst), keyBy
+	for _, b := range l.buckets {
+		b.tokens = math.Min(b.tokens, l.burst)
+	}
+}
+
+// Usage состояние корзины клиента после запроса
+type Usage struct {
+	// Limit ёмкость корзины — наибольшее число запросов подряд
+	Limit int
+	// Remaining число запросов, которые можно сделать сразу
+	Remaining int
+	// Reset время до полного пополнения корзины
+	Reset time.Duration
+	// RetryAfter время до появления следующего токена, если запрос отклонён
+	RetryAfter time.Duration
+}
+
+// Allow списывает токен из корзины клиента. Если токенов нет,
+// возвращает false и время, через которое появится следующий токен.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	ok, u := l.Take(key)
+	return ok, u.RetryAfter
+}
+
+// Take списывает токен из корзины клиента и возвращает её состояние.
+// Пока ограничитель выключен, запрос пропускается с пустым состоянием.
+func (l *RateLimiter) Take(key string) (bool, Usage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return true, Usage{}
+	}
+	return l.take(key)
+}
+
+// take списывает токен из корзины клиента. Вызывается под блокировкой
+// при включённом ограничителе: лимиты читаются один раз.
+func (l *RateLimiter) take(key string) (bool, Usage) {
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			key = overflowKey
+			b = l.buckets[key]
+		}
+		if b == nil {
+			b = &bucket{tokens: l.burst, last: now}
+			l.buckets[key] = b
+		}
+	}
+
+	// Пополняем корзину за прошедшее время
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	u := Usage{
+		Limit:     int(l.burst),
+		Remaining: int(b.tokens),
+		Reset:     time.Duration((l.burst - b.tokens) / l.rate * float64(time.Second)),
+	}
+	if !allowed {
+		u.RetryAfter = time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	return allowed, u
+}
+
+// sweep удаляет корзины клиентов, которые давно не присылали запросов
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketTTL {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > bucketTTL {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientKey определяет клиента по проверенному ключу или IP-адресу.
+// Заголовок API-ключа не проверен, пока его не проверит арендатор или
+// способ проверки, поэтому по нему самому корзины не ведутся: иначе клиент
+// получал бы новую корзину с каждым выдуманным ключом. Вызывается под
+// блокировкой.
+func (l *RateLimiter) clientKey(r *http.Request) string {
+	if l.keyBy == LimitByKey && l.principal != nil {
+		if p := l.principal(r); p != "" {
+			return "key:" + p
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Middleware оборачивает обработчик ограничителем.
+// Каждый ответ содержит заголовки X-RateLimit-Limit, X-RateLimit-Remaining
+// и X-RateLimit-Reset (секунды до полного пополнения), чтобы клиент мог
+// подстроить частоту запросов. При превышении лимита отвечает 429
+// с заголовком Retry-After. Пока ограничитель выключен, запросы
+// передаются без заголовков.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, u, enabled := l.limit(r)
+		if !enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("X-RateLimit-Limit", strconv.Itoa(u.Limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(u.Remaining))
+		h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(u.Reset)))
+		if !ok {
+			h.Set("Retry-After", strconv.Itoa(max(ceilSeconds(u.RetryAfter), 1)))
+			http.Error(w, "Слишком много запросов. Повторите позже.", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limit списывает токен клиента запроса r; enabled — ограничитель включён.
+// Лимиты и способ определения клиента читаются под одной блокировкой,
+// чтобы SetLimits не выключил ограничитель посреди расчёта.
+func (l *RateLimiter) limit(r *http.Request) (ok bool, u Usage, enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return true, Usage{}, false
+	}
+	ok, u = l.take(l.clientKey(r))
+	return ok, u, true
+}
+
+// ceilSeconds округляет d до целых секунд вверх
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestRateLimiterClientKey(t *testing.T) {
+	principal := func(r *http.Request) string { return r.Header.Get("X-Test-Principal") }
+	tests := []struct {
+		name      string
+		keyBy     string
+		principal func(r *http.Request) string
+		apiKey    string
+		verified  string
+		want      string
+	}{
+		{name: "по IP", keyBy: LimitByIP, apiKey: "k1", verified: "t1", principal: principal, want: "ip:192.0.2.1"},
+		{name: "по проверенному клиенту", keyBy: LimitByKey, verified: "tenant:a", principal: principal, want: "key:tenant:a"},
+		{name: "непроверенный ключ", keyBy: LimitByKey, apiKey: "forged", principal: principal, want: "ip:192.0.2.1"},
+		{name: "без проверки", keyBy: LimitByKey, apiKey: "forged", want: "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(1, 1, tt.keyBy, tt.principal)
+			r := httptest.NewRequest(http.MethodPost, "/update", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			if tt.apiKey != "" {
+				r.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			if tt.verified != "" {
+				r.Header.Set("X-Test-Principal", tt.verified)
+			}
+			if got := l.clientKey(r); got != tt.want {
+				t.Errorf("clientKey() = %q, ожидался %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterForgedKeys(t *testing.T) {
+	l := NewRateLimiter(1, 2, LimitByKey, func(*http.Request) string { return "" })
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/update", nil)
+		r.Header.Set(APIKeyHeader, "forged"+strconv.Itoa(i))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		codes = append(codes, w.Code)
+	}
+	if codes[2] != http.StatusTooManyRequests {
+		t.Errorf("коды %v: новые ключи обходят ограничение", codes)
+	}
+}
+
+func TestRateLimiterBucketCap(t *testing.T) {
+	l := NewRateLimiter(1, 1, LimitByIP, nil)
+	for i := 0; i < maxBuckets; i++ {
+		l.Take("ip:" + strconv.Itoa(i))
+	}
+	if ok, _ := l.Take("ip:new1"); !ok {
+		t.Fatal("первый клиент сверх ограничения отклонён")
+	}
+	if ok, _ := l.Take("ip:new2"); ok {
+		t.Error("клиенты сверх ограничения не делят общую корзину")
+	}
+	if n := len(l.buckets); n != maxBuckets+1 {
+		t.Errorf("корзин %d, ожидалось %d", n, maxBuckets+1)
+	}
+}
+
+func TestRateLimiterSetLimitsRace(t *testing.T) {
+	l := NewRateLimiter(1000, 10, LimitByIP, nil)
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			l.SetLimits(float64(i%2)*1000, 10, LimitByIP)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/update", nil))
+		if v := w.Header().Get("X-RateLimit-Reset"); v != "" {
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				t.Fatalf("X-RateLimit-Reset = %q", v)
+			}
+		}
+	}
+	wg.Wait()
+}
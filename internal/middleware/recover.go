@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover перехватывает панику обработчика: записывает её со стеком
+// в журнал и отвечает 500, не роняя сервер. Намеренный обрыв ответа
+// http.ErrAbortHandler передаётся дальше.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+			log.Printf("Паника при обработке %s %s: %v\n%s", r.Method, r.URL.Path, v, debug.Stack())
+			http.Error(w, "Внутренняя ошибка сервера.", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
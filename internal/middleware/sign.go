@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/internal/sign"
+	"github.com/iliodor1/metrics-service/internal/websocket"
+)
+
+// signWriter накапливает ответ обработчика, чтобы подписать его целиком
+type signWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+// Write накапливает тело ответа
+func (w *signWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+// WriteHeader запоминает статус ответа
+func (w *signWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+}
+
+// Sign проверяет подпись тел запросов и подписывает ответы ключом key.
+// Сервер принимает подписи алгоритмами algs (пустой — только HMAC-SHA256)
+// и перечисляет их в порядке предпочтения в заголовке ответа
+// sign.AlgorithmsHeader. Ответ подписывается тем же алгоритмом, что и
+// запрос, а неподписанный запрос — первым из algs.
+// Запросы без заголовка подписи пропускаются без проверки; подпись
+// алгоритмом не из algs отклоняется.
+// Потоки WebSocket, Server-Sent Events и JSON Lines не подписываются: ответ на них не накапливается.
+func Sign(key string, algs []*sign.Algorithm) func(http.Handler) http.Handler {
+	if len(algs) == 0 {
+		algs = []*sign.Algorithm{sign.SHA256}
+	}
+	advertised := sign.FormatAlgorithms(algs)
+	return func(next http.Handler) http.Handler {
+		if key == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStream(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set(sign.AlgorithmsHeader, advertised)
+
+			alg, signature := requestSignature(r, algs)
+			if alg == nil && signature != "" {
+				http.Error(w, "Алгоритм подписи запроса не разрешён. Допустимые: "+advertised+".", http.StatusBadRequest)
+				return
+			}
+			if alg != nil {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, "Не удалось прочитать тело запроса.", http.StatusBadRequest)
+					return
+				}
+				if !alg.Verify(body, key, signature) {
+					http.Error(w, "Неверная подпись запроса.", http.StatusBadRequest)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			} else {
+				alg = algs[0]
+			}
+
+			sw := &signWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			w.Header().Set(alg.Header, alg.Sum(sw.buf.Bytes(), key))
+			w.WriteHeader(sw.status)
+			w.Write(sw.buf.Bytes())
+		})
+	}
+}
+
+// requestSignature возвращает подпись запроса самым предпочтительным
+// из разрешённых алгоритмов. Если запрос подписан только алгоритмами
+// не из algs, алгоритм nil, а подпись — одна из переданных.
+func requestSignature(r *http.Request, algs []*sign.Algorithm) (*sign.Algorithm, string) {
+	for _, a := range algs {
+		if signature := r.Header.Get(a.Header); signature != "" {
+			return a, signature
+		}
+	}
+	for _, a := range sign.Algorithms {
+		if signature := r.Header.Get(a.Header); signature != "" {
+			return nil, signature
+		}
+	}
+	return nil, ""
+}
+
+// isStream сообщает, запрашивает ли клиент потоковый ответ
+// или передаёт поток JSON Lines, на который отвечают по ходу приёма
+func isStream(r *http.Request) bool {
+	return websocket.IsUpgrade(r) || strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-ndjson")
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// RealIPHeader заголовок, в котором агент или прокси передаёт адрес клиента
+const RealIPHeader = "X-Real-IP"
+
+// SubnetFilter пропускает только запросы из доверенных подсетей. Адрес
+// клиента берётся из заголовка X-Real-IP, а без него — из адреса
+// соединения. Остальным запросам отвечает 403. Подсети меняются на ходу;
+// пока они не заданы, запросы не проверяются.
+type SubnetFilter struct {
+	nets atomic.Pointer[[]*net.IPNet]
+}
+
+// NewSubnetFilter создаёт проверку подсетей cidrs, заданных через
+// запятую, например 10.0.0.0/8,192.168.1.0/24 (пустая строка — проверка
+// отключена)
+func NewSubnetFilter(cidrs string) (*SubnetFilter, error) {
+	f := &SubnetFilter{}
+	if err := f.SetSubnets(cidrs); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetSubnets меняет доверенные подсети на ходу. При ошибке подсети
+// остаются прежними.
+func (f *SubnetFilter) SetSubnets(cidrs string) error {
+	nets, err := ParseSubnets(cidrs)
+	if err != nil {
+		return err
+	}
+	f.nets.Store(&nets)
+	return nil
+}
+
+// ParseSubnets разбирает подсети, заданные через запятую; пустая строка —
+// подсетей нет
+func ParseSubnets(cidrs string) ([]*net.IPNet, error) {
+	if cidrs == "" {
+		return nil, nil
+	}
+	var nets []*net.IPNet
+	for _, s := range strings.Split(cidrs, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("неверная подсеть %q", s)
+		}
+		nets = append(nets, n)
+	}
+	if len(nets) == 0 {
+		return nil, errors.New("не задано ни одной подсети")
+	}
+	return nets, nil
+}
+
+// Middleware оборачивает обработчик проверкой подсети клиента
+func (f *SubnetFilter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nets := *f.nets.Load()
+		if nets == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		addr := r.Header.Get(RealIPHeader)
+		if addr == "" {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			addr = host
+		}
+		ip := net.ParseIP(strings.TrimSpace(addr))
+		for _, n := range nets {
+			if ip != nil && n.Contains(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.Error(w, "Адрес клиента не входит в доверенную подсеть.", http.StatusForbidden)
+	})
+}
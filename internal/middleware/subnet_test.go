@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSubnetFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		// subnets подсети при создании и после перечитывания
+		subnets []string
+		realIP  string
+		want    int
+	}{
+		{name: "проверка отключена", subnets: []string{""}, want: http.StatusOK},
+		{name: "адрес соединения в подсети", subnets: []string{"192.0.2.0/24"}, want: http.StatusOK},
+		{name: "X-Real-IP вне подсети", subnets: []string{"192.0.2.0/24"}, realIP: "198.51.100.1", want: http.StatusForbidden},
+		{name: "X-Real-IP во второй подсети", subnets: []string{"192.0.2.0/28, 198.51.100.0/24"}, realIP: "198.51.100.1", want: http.StatusOK},
+		{name: "подсеть задана на ходу", subnets: []string{"", "10.0.0.0/8"}, want: http.StatusForbidden},
+		{name: "подсеть снята на ходу", subnets: []string{"10.0.0.0/8", ""}, want: http.StatusOK},
+		{name: "неверная подсеть не применяется", subnets: []string{"10.0.0.0/8", "10.0.0.0/33"}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewSubnetFilter(tt.subnets[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.subnets[1:] {
+				f.SetSubnets(s)
+			}
+			h := f.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			if tt.realIP != "" {
+				r.Header.Set(RealIPHeader, tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("код ответа %d, ожидался %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSubnetsErrors(t *testing.T) {
+	for _, cidrs := range []string{"10.0.0.1", "10.0.0.0/33", " , ", "10.0.0.0/8,x"} {
+		if _, err := ParseSubnets(cidrs); err == nil {
+			t.Errorf("ParseSubnets(%q): ожидалась ошибка", cidrs)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package namepolicy проверяет имена метрик, присланные клиентами,
+// до записи в хранилище. Без проверки имена со служебными символами
+// создают метрики, которые нельзя запросить через URL или отличить
+// от метрик арендатора.
+package namepolicy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Допустимые наборы символов имени
+const (
+	// CharsetUTF8 любые печатные символы Unicode (по умолчанию)
+	CharsetUTF8 = "utf8"
+	// CharsetASCII только печатные символы ASCII
+	CharsetASCII = "ascii"
+)
+
+// Config настройки проверки имён
+type Config struct {
+	// MaxLength наибольшая длина имени в байтах (0 — models.MaxNameLength)
+	MaxLength int `json:"max_length"`
+	// Charset набор символов имени: utf8 или ascii
+	Charset string `json:"charset"`
+	// Pattern регулярное выражение, которому должно целиком соответствовать
+	// имя вместе с метками (пустое — без проверки)
+	Pattern string `json:"pattern"`
+}
+
+// Policy правила проверки имён. Пробельные и управляющие символы
+// запрещены всегда, как и разделитель арендатора в базовом имени
+// (вне меток в фигурных скобках).
+type Policy struct {
+	maxLength int
+	ascii     bool
+	pattern   *regexp.Regexp
+	// source шаблон в том виде, в каком он задан
+	source string
+}
+
+// New проверяет настройки и создаёт правила
+func New(cfg Config) (*Policy, error) {
+	p := &Policy{maxLength: cfg.MaxLength}
+	if p.maxLength < 0 || p.maxLength > models.MaxNameLength {
+		return nil, fmt.Errorf("max_length: от 1 до %d", models.MaxNameLength)
+	}
+	if p.maxLength == 0 {
+		p.maxLength = models.MaxNameLength
+	}
+	switch cfg.Charset {
+	case CharsetUTF8, "":
+	case CharsetASCII:
+		p.ascii = true
+	default:
+		return nil, fmt.Errorf("charset: %s или %s", CharsetUTF8, CharsetASCII)
+	}
+	if cfg.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + cfg.Pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("pattern: %w", err)
+		}
+		p.pattern, p.source = re, cfg.Pattern
+	}
+	return p, nil
+}
+
+// Check проверяет имя метрики; ошибка оборачивает models.ErrInvalidName
+// и объясняет, что не так с именем
+func (p *Policy) Check(name string) error {
+	if err := models.CheckName(name); err != nil {
+		return err
+	}
+	if len(name) > p.maxLength {
+		return fmt.Errorf("%w: длина превышает %d байт", models.ErrInvalidName, p.maxLength)
+	}
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r) || !unicode.IsPrint(r):
+			return fmt.Errorf("%w: недопустимый символ %q", models.ErrInvalidName, r)
+		case p.ascii && r > unicode.MaxASCII:
+			return fmt.Errorf("%w: допустимы только символы ASCII, встретился %q", models.ErrInvalidName, r)
+		}
+	}
+	if base, _, _ := labels.Parse(name); strings.Contains(base, tenant.Separator) {
+		return fmt.Errorf("%w: символ %s в имени зарезервирован для арендаторов", models.ErrInvalidName, tenant.Separator)
+	}
+	if p.pattern != nil && !p.pattern.MatchString(name) {
+		return fmt.Errorf("%w: имя не соответствует шаблону %s", models.ErrInvalidName, p.source)
+	}
+	return nil
+}
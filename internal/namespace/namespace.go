@@ -0,0 +1,94 @@
+// Package namespace переименовывает метрики по шаблону в зависимости от ключа клиента,
+// чтобы несколько окружений могли отправлять метрики на один сервер
+package namespace
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// MetricVar переменная шаблона, в которую подставляется исходное имя метрики
+const MetricVar = "metric"
+
+// placeholder переменная шаблона вида {name}
+var placeholder = regexp.MustCompile(`\{([a-zA-Z0-9_]+)\}`)
+
+// Key настройки пространства имён для одного ключа клиента
+type Key struct {
+	// Template шаблон имени; если пуст, используется общий шаблон
+	Template string `json:"template,omitempty"`
+	// Vars значения переменных шаблона, например env и service
+	Vars map[string]string `json:"vars"`
+}
+
+// Config настройки пространств имён
+type Config struct {
+	// Template общий шаблон имени, например {env}_{service}_{metric}
+	Template string `json:"template"`
+	// Keys настройки по ключам клиентов
+	Keys map[string]Key `json:"keys"`
+}
+
+// Resolver вычисляет итоговые имена метрик
+type Resolver struct {
+	cfg Config
+}
+
+// New проверяет настройки и создаёт Resolver.
+// Каждый шаблон должен содержать {metric}, а все его переменные — быть заданы.
+func New(cfg Config) (*Resolver, error) {
+	for key, k := range cfg.Keys {
+		tpl := k.Template
+		if tpl == "" {
+			tpl = cfg.Template
+		}
+		if tpl == "" {
+			return nil, fmt.Errorf("ключ %s: не задан шаблон имени", key)
+		}
+		for _, m := range placeholder.FindAllStringSubmatch(tpl, -1) {
+			if m[1] == MetricVar {
+				continue
+			}
+			if _, ok := k.Vars[m[1]]; !ok {
+				return nil, fmt.Errorf("ключ %s: не задана переменная {%s}", key, m[1])
+			}
+		}
+		if !hasMetric(tpl) {
+			return nil, fmt.Errorf("ключ %s: шаблон %q не содержит {%s}", key, tpl, MetricVar)
+		}
+	}
+	return &Resolver{cfg: cfg}, nil
+}
+
+// hasMetric проверяет, что шаблон содержит переменную {metric}
+func hasMetric(tpl string) bool {
+	for _, m := range placeholder.FindAllStringSubmatch(tpl, -1) {
+		if m[1] == MetricVar {
+			return true
+		}
+	}
+	return false
+}
+
+// Name возвращает итоговое имя метрики name для клиента с ключом key.
+// Для неизвестных ключей имя не меняется.
+func (r *Resolver) Name(key, name string) string {
+	if r == nil || key == "" {
+		return name
+	}
+	k, ok := r.cfg.Keys[key]
+	if !ok {
+		return name
+	}
+	tpl := k.Template
+	if tpl == "" {
+		tpl = r.cfg.Template
+	}
+	return placeholder.ReplaceAllStringFunc(tpl, func(m string) string {
+		v := m[1 : len(m)-1]
+		if v == MetricVar {
+			return name
+		}
+		return k.Vars[v]
+	})
+}
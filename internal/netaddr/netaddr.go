@@ -0,0 +1,91 @@
+// Package netaddr разбирает адреса сервера: host:port, URL
+// или unix:/путь/к/сокету для связи агентов и сервера на одном хосте
+// без открытия TCP-порта.
+package netaddr
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// UnixPrefix префикс адреса сокета Unix
+const UnixPrefix = "unix:"
+
+// unixHost имя хоста в URL запросов через сокет Unix: сам хост не
+// используется, соединение всегда открывается с сокетом
+const unixHost = "unix"
+
+// SocketPath возвращает путь к сокету Unix, если addr — адрес сокета
+func SocketPath(addr string) (string, bool) {
+	path, ok := strings.CutPrefix(addr, UnixPrefix)
+	return path, ok && path != ""
+}
+
+// Listen открывает слушающий сокет по адресу addr. Оставшийся от прошлого
+// запуска файл сокета Unix удаляется, только если к нему не подключиться:
+// сокет, который слушает другой процесс, не отбирается. При закрытии
+// слушателя файл удаляется автоматически.
+func Listen(addr string) (net.Listener, error) {
+	path, ok := SocketPath(addr)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, errors.New(path + " существует и не является сокетом")
+		}
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			return nil, errors.New(path + " уже слушает другой процесс")
+		}
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, err
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// URL возвращает адрес для журнала и ссылок: URL со схемой scheme
+// или unix:/путь для сокета
+func URL(addr, scheme string) string {
+	if _, ok := SocketPath(addr); ok {
+		return addr
+	}
+	return scheme + "://" + addr
+}
+
+// Client возвращает базовый URL запросов к серверу по адресу addr
+// (host:port, URL или unix:/путь) и транспорт для них. tlsConfig задаёт
+// проверку сертификата при HTTPS; через сокет Unix запросы идут без TLS.
+// Транспорт nil означает транспорт по умолчанию.
+func Client(addr string, tlsConfig *tls.Config) (string, http.RoundTripper) {
+	if path, ok := SocketPath(addr); ok {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		return "http://" + unixHost, transport
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	addr = strings.TrimRight(addr, "/")
+	if tlsConfig == nil {
+		return addr, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return addr, transport
+}
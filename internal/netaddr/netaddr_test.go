@@ -0,0 +1,81 @@
+package netaddr
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare создаёт файл по пути path до вызова Listen
+		prepare func(t *testing.T, path string)
+		wantErr bool
+	}{
+		{
+			name:    "файла нет",
+			prepare: func(t *testing.T, path string) {},
+		},
+		{
+			name: "сокет прошлого запуска",
+			prepare: func(t *testing.T, path string) {
+				l, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Файл остаётся, как после аварийного завершения
+				l.(*net.UnixListener).SetUnlinkOnClose(false)
+				l.Close()
+			},
+		},
+		{
+			name: "сокет слушает другой процесс",
+			prepare: func(t *testing.T, path string) {
+				l, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { l.Close() })
+			},
+			wantErr: true,
+		},
+		{
+			name: "обычный файл",
+			prepare: func(t *testing.T, path string) {
+				if err := os.WriteFile(path, nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "s.sock")
+			tt.prepare(t, path)
+
+			l, err := Listen(UnixPrefix + path)
+			if tt.wantErr {
+				if err == nil {
+					l.Close()
+					t.Fatal("ожидалась ошибка")
+				}
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("файл удалён: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			conn, err := net.Dial("unix", path)
+			if err != nil {
+				t.Fatalf("нет подключения к новому сокету: %v", err)
+			}
+			conn.Close()
+		})
+	}
+}
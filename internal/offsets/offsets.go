@@ -0,0 +1,210 @@
+// Package offsets отбрасывает повторно доставленные обновления из
+// конвейеров с доставкой «хотя бы один раз» (Kafka, NATS и подобных).
+// Конвейер передаёт в заголовках раздел источника и смещение сообщения
+// в нём; сервер помнит последнее применённое смещение каждого раздела
+// и не применяет сообщения со смещением не больше него, поэтому counter
+// не растёт повторно после переподключения потребителя.
+package offsets
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/iliodor1/metrics-service/internal/middleware"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+)
+
+// Заголовки запроса с положением сообщения в источнике
+const (
+	// PartitionHeader раздел источника, например orders/3 для раздела 3 темы orders
+	PartitionHeader = "X-Source-Partition"
+	// OffsetHeader смещение сообщения в разделе
+	OffsetHeader = "X-Source-Offset"
+)
+
+// DuplicateHeader отмечает ответ на уже применённое сообщение
+const DuplicateHeader = "X-Source-Duplicate"
+
+// maxPartition наибольшая длина имени раздела
+const maxPartition = 255
+
+// partition последнее применённое смещение раздела. mu удерживается на
+// время обработки сообщения, поэтому сообщения раздела применяются по одному.
+type partition struct {
+	mu     sync.Mutex
+	keyID  string
+	name   string
+	offset uint64
+	// applied применялось ли сообщение раздела
+	applied bool
+}
+
+// Offset смещение раздела источника
+type Offset struct {
+	// KeyID идентификатор API-ключа клиента (пустой — запросы без ключа)
+	KeyID     string `json:"key_id,omitempty"`
+	Partition string `json:"partition"`
+	Offset    uint64 `json:"offset"`
+}
+
+// Tracker последние применённые смещения разделов источников
+type Tracker struct {
+	mu            sync.Mutex
+	maxPartitions int
+	partitions    map[string]*partition
+}
+
+// New создаёт учёт смещений не более чем для maxPartitions разделов
+func New(maxPartitions int) *Tracker {
+	return &Tracker{maxPartitions: maxPartitions, partitions: make(map[string]*partition)}
+}
+
+// statusWriter запоминает статус ответа
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader передаёт и запоминает статус ответа
+func (w *statusWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Unwrap открывает исходный ResponseWriter для http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware оборачивает обработчик обновлений. Разделы учитываются
+// отдельно для каждого API-ключа. Сообщение со смещением не больше
+// последнего применённого получает ответ 200 с заголовком
+// X-Source-Duplicate и не применяется; смещение запоминается только
+// после успешного ответа, чтобы отклонённое сообщение можно было повторить.
+// Запросы без заголовков источника передаются без проверки.
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, rawOffset := r.Header.Get(PartitionHeader), r.Header.Get(OffsetHeader)
+		if name == "" && rawOffset == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if name == "" || rawOffset == "" {
+			http.Error(w, "Раздел и смещение источника передаются вместе.", http.StatusBadRequest)
+			return
+		}
+		if len(name) > maxPartition {
+			http.Error(w, "Слишком длинное имя раздела источника.", http.StatusBadRequest)
+			return
+		}
+		offset, err := strconv.ParseUint(rawOffset, 10, 64)
+		if err != nil {
+			http.Error(w, "Смещение источника должно быть неотрицательным целым.", http.StatusBadRequest)
+			return
+		}
+
+		p := t.partition(r.Header.Get(middleware.APIKeyHeader), name)
+		if p == nil {
+			http.Error(w, "Слишком много разделов источника.", http.StatusBadRequest)
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.applied && offset <= p.offset {
+			w.Header().Set(DuplicateHeader, "true")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if sw.status < http.StatusMultipleChoices {
+			p.offset, p.applied = offset, true
+		}
+	})
+}
+
+// partition возвращает раздел клиента с ключом key, создавая его
+func (t *Tracker) partition(key, name string) *partition {
+	keyID := ""
+	if key != "" {
+		keyID = tenant.KeyID(key)
+	}
+	id := keyID + "\x00" + name
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.partitions[id]
+	if !ok {
+		if len(t.partitions) >= t.maxPartitions {
+			return nil
+		}
+		p = &partition{keyID: keyID, name: name}
+		t.partitions[id] = p
+	}
+	return p
+}
+
+// Offsets возвращает смещения всех разделов, упорядоченные по ключу и разделу
+func (t *Tracker) Offsets() []Offset {
+	t.mu.Lock()
+	parts := make([]*partition, 0, len(t.partitions))
+	for _, p := range t.partitions {
+		parts = append(parts, p)
+	}
+	t.mu.Unlock()
+
+	res := make([]Offset, 0, len(parts))
+	for _, p := range parts {
+		p.mu.Lock()
+		if p.applied {
+			res = append(res, Offset{KeyID: p.keyID, Partition: p.name, Offset: p.offset})
+		}
+		p.mu.Unlock()
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].KeyID != res[j].KeyID {
+			return res[i].KeyID < res[j].KeyID
+		}
+		return res[i].Partition < res[j].Partition
+	})
+	return res
+}
+
+// Reset забывает смещение раздела, например после пересоздания темы,
+// когда смещения в ней начинаются заново
+func (t *Tracker) Reset(keyID, name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := keyID + "\x00" + name
+	_, ok := t.partitions[id]
+	delete(t.partitions, id)
+	return ok
+}
+
+// Handler обработчик административного API смещений:
+// GET /admin/offsets — смещения разделов,
+// DELETE /admin/offsets?partition=...&key_id=... — забыть смещение раздела
+func (t *Tracker) Handler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Offsets())
+	case http.MethodDelete:
+		q := r.URL.Query()
+		if q.Get("partition") == "" {
+			http.Error(w, "Не задан раздел источника.", http.StatusBadRequest)
+			return
+		}
+		if !t.Reset(q.Get("key_id"), q.Get("partition")) {
+			http.Error(w, "Раздел не найден.", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Метод не разрешён.", http.StatusMethodNotAllowed)
+	}
+}
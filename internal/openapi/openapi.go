@@ -0,0 +1,186 @@
+// Package openapi строит спецификацию OpenAPI 3 и отдаёт её вместе со Swagger UI
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Spec спецификация OpenAPI 3
+type Spec struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info общие сведения об API
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem операции одного пути по HTTP-методам (в нижнем регистре)
+type PathItem map[string]Operation
+
+// Components переиспользуемые схемы
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Operation описание операции
+type Operation struct {
+	Summary     string              `json:"summary"`
+	Description string              `json:"description,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter параметр пути, запроса или заголовка
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody тело запроса
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response ответ операции
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header заголовок ответа
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType содержимое заданного типа
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema схема данных
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+}
+
+// Endpoint описание одной операции API
+type Endpoint struct {
+	Method string
+	Path   string
+	Operation
+}
+
+// New создаёт пустую спецификацию
+func New(title, version string) *Spec {
+	return &Spec{
+		OpenAPI:    "3.0.3",
+		Info:       Info{Title: title, Version: version},
+		Paths:      make(map[string]PathItem),
+		Components: Components{Schemas: make(map[string]*Schema)},
+	}
+}
+
+// Add добавляет операции в спецификацию
+func (s *Spec) Add(endpoints ...Endpoint) {
+	for _, e := range endpoints {
+		item, ok := s.Paths[e.Path]
+		if !ok {
+			item = make(PathItem)
+			s.Paths[e.Path] = item
+		}
+		item[strings.ToLower(e.Method)] = e.Operation
+	}
+}
+
+// Ref возвращает ссылку на схему из components
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// JSON возвращает содержимое типа application/json со схемой schema
+func JSON(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+// WithProto добавляет к содержимому content вариант в формате Protocol Buffers;
+// message — имя сообщения схемы
+func WithProto(content map[string]MediaType, message string) map[string]MediaType {
+	content["application/x-protobuf"] = MediaType{Schema: &Schema{Type: "string", Format: "binary", Description: "сообщение " + message + " из metrics.proto"}}
+	return content
+}
+
+// Text возвращает содержимое типа text/plain
+func Text() map[string]MediaType {
+	return map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}
+}
+
+// PathParam описывает обязательный параметр пути
+func PathParam(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: schema}
+}
+
+// QueryParam описывает необязательный параметр запроса
+func QueryParam(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// HeaderParam описывает необязательный заголовок запроса
+func HeaderParam(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "header", Description: description, Schema: schema}
+}
+
+// Handler отдаёт спецификацию в формате JSON
+func (s *Spec) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(s)
+	})
+}
+
+// uiPage страница Swagger UI; скрипты загружаются с CDN
+const uiPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: %q, dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// UIHandler отдаёт страницу Swagger UI для спецификации по адресу specURL
+func (s *Spec) UIHandler(specURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, uiPage, s.Info.Title, specURL)
+	})
+}
@@ -0,0 +1,280 @@
+// Package openmetrics читает выгрузки Prometheus в текстовом формате
+// и в формате OpenMetrics для переноса метрик в этот сервис.
+//
+// Блоки TSDB и снимки Prometheus выгружаются в OpenMetrics командой
+//
+//	promtool tsdb dump-openmetrics <каталог данных или снимка>
+//
+// а текущие значения — запросом /federate или /metrics.
+// Метки рядов записываются в имени метрики по соглашению пакета labels.
+package openmetrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// ContentType тип содержимого выгрузки в формате OpenMetrics
+const ContentType = "application/openmetrics-text"
+
+// maxLine наибольшая длина строки выгрузки
+const maxLine = 1 << 20
+
+// Sample значение ряда; Time нулевое, если в выгрузке нет времени
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series ряд выгрузки
+type Series struct {
+	// Name имя метрики вместе с метками
+	Name string
+	// Type gauge или counter
+	Type string
+	// Samples значения в порядке времени
+	Samples []Sample
+}
+
+// Last последнее значение ряда
+func (s *Series) Last() float64 {
+	return s.Samples[len(s.Samples)-1].Value
+}
+
+// Dump прочитанная выгрузка
+type Dump struct {
+	Series []*Series
+	// Samples число прочитанных значений
+	Samples int
+	// Skipped число пропущенных значений: NaN (в том числе отметки
+	// устаревания рядов), отрицательные счётчики и метки, которые
+	// нельзя записать в имени метрики
+	Skipped int
+}
+
+// rawSample значение со временем в исходных единицах выгрузки
+type rawSample struct {
+	ts    float64
+	hasTS bool
+	value float64
+}
+
+// Parse читает выгрузку из r. Время значений в OpenMetrics записывается
+// в секундах, в текстовом формате Prometheus — в миллисекундах; формат
+// OpenMetrics выбирается параметром openMetrics или строкой "# EOF".
+//
+// Счётчики, а также _bucket, _count и _sum гистограмм и сводок
+// становятся counter (значения округляются до целых), остальные ряды — gauge.
+func Parse(r io.Reader, openMetrics bool) (*Dump, error) {
+	types := make(map[string]string)
+	series := make(map[string]*Series)
+	raw := make(map[string][]rawSample)
+	var order []string
+	d := &Dump{}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLine)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			fields := strings.Fields(text)
+			switch {
+			case len(fields) == 2 && fields[1] == "EOF":
+				openMetrics = true
+			case len(fields) >= 4 && fields[1] == "TYPE":
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		name, set, rest, err := parseSeries(text)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %w", line, err)
+		}
+		s, err := parseSample(rest)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %w", line, err)
+		}
+		d.Samples++
+
+		mType := metricType(types, name)
+		if mType == "" {
+			// _created и прочие служебные ряды не переносятся
+			d.Skipped++
+			continue
+		}
+		full := labels.Format(name, set)
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) || (mType == models.Counter && s.value < 0) ||
+			!validLabels(set) || models.CheckName(full) != nil {
+			d.Skipped++
+			continue
+		}
+		key := mType + "/" + full
+		if _, ok := series[key]; !ok {
+			series[key] = &Series{Name: full, Type: mType}
+			order = append(order, key)
+		}
+		raw[key] = append(raw[key], s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	unit := float64(time.Millisecond)
+	if openMetrics {
+		unit = float64(time.Second)
+	}
+	for _, key := range order {
+		sr := series[key]
+		samples := raw[key]
+		// Значения без времени остаются в порядке выгрузки
+		sort.SliceStable(samples, func(i, j int) bool {
+			return samples[i].hasTS && samples[j].hasTS && samples[i].ts < samples[j].ts
+		})
+		sr.Samples = make([]Sample, len(samples))
+		for i, s := range samples {
+			v := s.value
+			if sr.Type == models.Counter {
+				v = math.Round(v)
+			}
+			sr.Samples[i].Value = v
+			if s.hasTS {
+				sr.Samples[i].Time = time.Unix(0, int64(s.ts*unit))
+			}
+		}
+		d.Series = append(d.Series, sr)
+	}
+	return d, nil
+}
+
+// metricType тип ряда name по объявлениям TYPE его семейства.
+// Пустая строка — ряд не переносится.
+func metricType(types map[string]string, name string) string {
+	if t, ok := types[name]; ok {
+		if t == "counter" {
+			return models.Counter
+		}
+		return models.Gauge
+	}
+	for _, suffix := range []string{"_total", "_bucket", "_count", "_sum", "_created", "_gcount", "_gsum"} {
+		family, found := strings.CutSuffix(name, suffix)
+		if !found {
+			continue
+		}
+		t, ok := types[family]
+		if !ok {
+			continue
+		}
+		switch {
+		case suffix == "_created":
+			return ""
+		case t == "counter" || t == "histogram" || t == "summary":
+			return models.Counter
+		default:
+			return models.Gauge
+		}
+	}
+	return models.Gauge
+}
+
+// validLabels проверяет, что метки можно записать в имени метрики
+func validLabels(set map[string]string) bool {
+	for _, v := range set {
+		if strings.ContainsAny(v, ",{}") {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSeries разбирает имя ряда и метки в начале строки
+func parseSeries(text string) (name string, set map[string]string, rest string, err error) {
+	i := strings.IndexAny(text, "{ \t")
+	if i <= 0 {
+		return "", nil, "", errors.New("нет значения ряда")
+	}
+	name, rest = text[:i], text[i:]
+	if rest[0] != '{' {
+		return name, nil, rest, nil
+	}
+
+	set = make(map[string]string)
+	rest = rest[1:]
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			return "", nil, "", errors.New("не закрыт список меток")
+		}
+		if rest[0] == '}' {
+			return name, set, rest[1:], nil
+		}
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return "", nil, "", errors.New("неверная метка")
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = strings.TrimLeft(rest[eq+1:], " \t")
+		if rest == "" || rest[0] != '"' {
+			return "", nil, "", errors.New("значение метки " + key + " должно быть в кавычках")
+		}
+		var value strings.Builder
+		j := 1
+		for ; j < len(rest) && rest[j] != '"'; j++ {
+			if rest[j] == '\\' && j+1 < len(rest) {
+				j++
+				switch rest[j] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(rest[j])
+				}
+				continue
+			}
+			value.WriteByte(rest[j])
+		}
+		if j == len(rest) {
+			return "", nil, "", errors.New("не закрыты кавычки значения метки " + key)
+		}
+		set[key] = value.String()
+		rest = rest[j+1:]
+	}
+}
+
+// parseSample разбирает значение ряда и необязательное время.
+// Пример (exemplar) OpenMetrics после " # " отбрасывается.
+func parseSample(rest string) (rawSample, error) {
+	if i := strings.Index(rest, " # "); i >= 0 {
+		rest = rest[:i]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return rawSample{}, errors.New("ожидается значение и необязательное время")
+	}
+	var s rawSample
+	var err error
+	if s.value, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return rawSample{}, fmt.Errorf("неверное значение %q", fields[0])
+	}
+	if len(fields) == 2 {
+		if s.ts, err = strconv.ParseFloat(fields[1], 64); err != nil {
+			return rawSample{}, fmt.Errorf("неверное время %q", fields[1])
+		}
+		s.hasTS = true
+	}
+	return s, nil
+}
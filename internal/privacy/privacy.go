@@ -0,0 +1,172 @@
+// Package privacy искажает значения чувствительных метрик для внешних
+// потребителей: округляет их, заменяет границей корзины или добавляет шум
+// Лапласа (дифференциальная приватность). Искажаются только выгрузка
+// GET /export/public и публикуемые снимки; остальные чтения точны.
+//
+// Шум зависит от имени и значения метрики и от случайного ключа процесса:
+// пока значение не меняется, повторные запросы возвращают одно и то же
+// искажённое значение, и шум нельзя убрать усреднением ответов.
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Noise шум Лапласа с масштабом Sensitivity/Epsilon
+type Noise struct {
+	// Epsilon бюджет приватности: чем меньше, тем сильнее шум
+	Epsilon float64 `json:"epsilon"`
+	// Sensitivity наибольший вклад одного участника в значение,
+	// например наибольшая сумма одного заказа
+	Sensitivity float64 `json:"sensitivity"`
+}
+
+// Rule правило искажения отобранных метрик. Преобразования применяются
+// по порядку: шум, корзины, округление.
+type Rule struct {
+	// Names имена и Prefixes префиксы имён искажаемых метрик
+	Names    []string `json:"names"`
+	Prefixes []string `json:"prefixes"`
+	// Types типы искажаемых метрик (пустой — оба типа)
+	Types []string `json:"types"`
+	// Noise шум Лапласа (nil — без шума)
+	Noise *Noise `json:"noise"`
+	// Buckets возрастающие границы корзин: значение заменяется нижней
+	// границей своей корзины, значения меньше первой — первой границей
+	Buckets []float64 `json:"buckets"`
+	// Round шаг округления до ближайшего кратного (0 — без округления)
+	Round float64 `json:"round"`
+}
+
+// Config раздел privacy файла конфигурации
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Validate проверяет правила искажения
+func Validate(cfg Config) error {
+	for i, r := range cfg.Rules {
+		where := fmt.Sprintf("privacy: правило №%d", i+1)
+		switch {
+		case len(r.Names) == 0 && len(r.Prefixes) == 0:
+			return fmt.Errorf("%s: перечислите метрики в names или prefixes", where)
+		case r.Noise == nil && len(r.Buckets) == 0 && r.Round == 0:
+			return fmt.Errorf("%s: задайте noise, buckets или round", where)
+		case r.Noise != nil && !(r.Noise.Epsilon > 0 && r.Noise.Sensitivity > 0):
+			return fmt.Errorf("%s: epsilon и sensitivity должны быть положительными", where)
+		case r.Round < 0 || math.IsInf(r.Round, 0) || math.IsNaN(r.Round):
+			return fmt.Errorf("%s: неверный шаг округления", where)
+		}
+		for j := 1; j < len(r.Buckets); j++ {
+			if !(r.Buckets[j] > r.Buckets[j-1]) {
+				return fmt.Errorf("%s: границы корзин должны возрастать", where)
+			}
+		}
+		for _, mType := range r.Types {
+			if mType != models.Gauge && mType != models.Counter {
+				return fmt.Errorf("%s: неизвестный тип метрики %q", where, mType)
+			}
+		}
+	}
+	return nil
+}
+
+// match проверяет, относится ли правило к метрике
+func (r Rule) match(metricType, name string) bool {
+	if len(r.Types) > 0 && !slices.Contains(r.Types, metricType) {
+		return false
+	}
+	if slices.Contains(r.Names, name) {
+		return true
+	}
+	for _, p := range r.Prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy искажение значений по правилам
+type Policy struct {
+	rules []Rule
+	// key ключ шума; новый при каждом запуске
+	key [32]byte
+}
+
+// New создаёт искажение по правилам cfg
+func New(cfg Config) (*Policy, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	p := &Policy{rules: cfg.Rules}
+	if _, err := rand.Read(p.key[:]); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Value возвращает искажённое значение метрики по первому подходящему
+// правилу; метрики без правила возвращаются точно
+func (p *Policy) Value(metricType, name string, v float64) float64 {
+	for _, r := range p.rules {
+		if !r.match(metricType, name) {
+			continue
+		}
+		if r.Noise != nil {
+			v += p.laplace(metricType, name, v, r.Noise.Sensitivity/r.Noise.Epsilon)
+		}
+		if len(r.Buckets) > 0 {
+			i, found := slices.BinarySearch(r.Buckets, v)
+			if !found && i > 0 {
+				i--
+			}
+			v = r.Buckets[min(i, len(r.Buckets)-1)]
+		}
+		if r.Round > 0 {
+			v = math.Round(v/r.Round) * r.Round
+		}
+		return v
+	}
+	return v
+}
+
+// Metrics возвращает копии метрик с искажёнными значениями. Значения
+// counter округляются до целого и не становятся отрицательными.
+func (p *Policy) Metrics(metrics []models.Metrics) []models.Metrics {
+	out := make([]models.Metrics, len(metrics))
+	for i, m := range metrics {
+		if m.Value != nil {
+			v := p.Value(m.MType, m.ID, *m.Value)
+			m.Value = &v
+		} else if m.Delta != nil {
+			d := int64(math.Max(0, math.Round(p.Value(m.MType, m.ID, float64(*m.Delta)))))
+			m.Delta = &d
+		}
+		out[i] = m
+	}
+	return out
+}
+
+// laplace шум Лапласа с масштабом scale, определяемый метрикой и её значением
+func (p *Policy) laplace(metricType, name string, v, scale float64) float64 {
+	h := hmac.New(sha256.New, p.key[:])
+	h.Write([]byte(metricType + "/" + name + "/"))
+	binary.Write(h, binary.BigEndian, math.Float64bits(v))
+	sum := h.Sum(nil)
+	// u равномерно в (-0.5, 0.5) по 53 битам хеша
+	u := (float64(binary.BigEndian.Uint64(sum)>>11)+0.5)/(1<<53) - 0.5
+	if u < 0 {
+		return scale * math.Log(1+2*u)
+	}
+	return -scale * math.Log(1-2*u)
+}
@@ -0,0 +1,153 @@
+package privacy
+
+import (
+	"math"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{name: "округление", rule: Rule{Names: []string{"a"}, Round: 10}},
+		{name: "шум по префиксу", rule: Rule{Prefixes: []string{"orders_"}, Noise: &Noise{Epsilon: 1, Sensitivity: 5}}},
+		{name: "без метрик", rule: Rule{Round: 10}, wantErr: true},
+		{name: "без искажения", rule: Rule{Names: []string{"a"}}, wantErr: true},
+		{name: "нулевой epsilon", rule: Rule{Names: []string{"a"}, Noise: &Noise{Sensitivity: 1}}, wantErr: true},
+		{name: "отрицательная чувствительность", rule: Rule{Names: []string{"a"}, Noise: &Noise{Epsilon: 1, Sensitivity: -1}}, wantErr: true},
+		{name: "отрицательный шаг", rule: Rule{Names: []string{"a"}, Round: -1}, wantErr: true},
+		{name: "бесконечный шаг", rule: Rule{Names: []string{"a"}, Round: math.Inf(1)}, wantErr: true},
+		{name: "корзины не возрастают", rule: Rule{Names: []string{"a"}, Buckets: []float64{0, 10, 10}}, wantErr: true},
+		{name: "неизвестный тип", rule: Rule{Names: []string{"a"}, Round: 1, Types: []string{"summary"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(Config{Rules: []Rule{tt.rule}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, ошибка ожидалась: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValueRules(t *testing.T) {
+	p, err := New(Config{Rules: []Rule{
+		{Names: []string{"revenue"}, Round: 100},
+		{Prefixes: []string{"latency_"}, Types: []string{models.Gauge}, Buckets: []float64{0, 10, 100}},
+		// Правило после подходящего не применяется
+		{Prefixes: []string{"rev"}, Round: 1000},
+		{Names: []string{"price"}, Buckets: []float64{10, 20}, Round: 3},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		mType string
+		id    string
+		v     float64
+		want  float64
+	}{
+		{name: "округление вниз", mType: models.Gauge, id: "revenue", v: 1249, want: 1200},
+		{name: "округление вверх", mType: models.Gauge, id: "revenue", v: 1250, want: 1300},
+		{name: "округление отрицательного", mType: models.Gauge, id: "revenue", v: -149, want: -100},
+		{name: "первое подходящее правило", mType: models.Counter, id: "revenue", v: 1249, want: 1200},
+		{name: "префикс следующего правила", mType: models.Gauge, id: "revenue_eu", v: 1249, want: 1000},
+		{name: "ниже первой корзины", mType: models.Gauge, id: "latency_p99", v: -5, want: 0},
+		{name: "на границе корзины", mType: models.Gauge, id: "latency_p99", v: 10, want: 10},
+		{name: "внутри корзины", mType: models.Gauge, id: "latency_p99", v: 99.9, want: 10},
+		{name: "выше последней корзины", mType: models.Gauge, id: "latency_p99", v: 1e9, want: 100},
+		{name: "тип вне правила", mType: models.Counter, id: "latency_p99", v: 42, want: 42},
+		{name: "корзина, затем округление", mType: models.Gauge, id: "price", v: 19, want: 9},
+		{name: "без правила", mType: models.Gauge, id: "cpu", v: 0.123, want: 0.123},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Value(tt.mType, tt.id, tt.v); got != tt.want {
+				t.Errorf("Value(%s, %s, %v) = %v, ожидалось %v", tt.mType, tt.id, tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLaplaceNoise(t *testing.T) {
+	const (
+		epsilon     = 0.5
+		sensitivity = 10
+		scale       = sensitivity / epsilon
+		n           = 20000
+	)
+	cfg := Config{Rules: []Rule{{Names: []string{"orders"}, Noise: &Noise{Epsilon: epsilon, Sensitivity: sensitivity}}}}
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sum, sumAbs float64
+	for i := 0; i < n; i++ {
+		v := float64(i)
+		noise := p.Value(models.Gauge, "orders", v) - v
+		// u берётся из 53 бит хеша, поэтому |шум| не больше scale·ln(2^53)
+		if math.Abs(noise) > scale*53*math.Ln2 || math.IsNaN(noise) {
+			t.Fatalf("шум %v для значения %v вне границ", noise, v)
+		}
+		sum += noise
+		sumAbs += math.Abs(noise)
+		// Тот же запрос — то же искажённое значение
+		if again := p.Value(models.Gauge, "orders", v) - v; again != noise {
+			t.Fatalf("повторный шум %v, ожидался %v", again, noise)
+		}
+	}
+	// У распределения Лапласа среднее 0, среднее отклонение равно масштабу.
+	// Стандартная ошибка среднего scale·√2/√n ≈ 0.2, отклонения — scale/√n ≈ 0.14.
+	if mean := sum / n; math.Abs(mean) > 1 {
+		t.Errorf("среднее шума %v, ожидалось около 0", mean)
+	}
+	if mad := sumAbs / n; math.Abs(mad-scale) > 1 {
+		t.Errorf("среднее отклонение шума %v, ожидалось около %v", mad, float64(scale))
+	}
+
+	// Ключ шума новый при каждом запуске
+	other, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Value(models.Gauge, "orders", 1) == other.Value(models.Gauge, "orders", 1) {
+		t.Error("шум не зависит от ключа процесса")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	p, err := New(Config{Rules: []Rule{
+		{Names: []string{"refunds"}, Round: 10},
+		{Names: []string{"orders"}, Noise: &Noise{Epsilon: 0.01, Sensitivity: 100}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := []models.Metrics{
+		models.NewGauge("refunds", 14),
+		models.NewCounter("refunds", 16),
+		models.NewCounter("orders", 3),
+		models.NewCounter("visits", 7),
+	}
+	out := p.Metrics(in)
+
+	if *in[0].Value != 14 || *in[1].Delta != 16 {
+		t.Error("исходные метрики изменены")
+	}
+	if *out[0].Value != 10 || *out[1].Delta != 20 {
+		t.Errorf("округлено %v и %v, ожидалось 10 и 20", *out[0].Value, *out[1].Delta)
+	}
+	// Сильный шум не делает counter отрицательным
+	if *out[2].Delta < 0 {
+		t.Errorf("counter с шумом %d отрицательный", *out[2].Delta)
+	}
+	if *out[3].Delta != 7 {
+		t.Errorf("counter без правила %d, ожидалось 7", *out[3].Delta)
+	}
+}
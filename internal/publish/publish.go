@@ -0,0 +1,244 @@
+// Package publish периодически публикует снимок выбранных метрик в виде
+// статического файла JSON — в локальный каталог (например, корень сайта)
+// или в корзину S3 с хостингом сайта. Публичные страницы состояния читают
+// файл, не обращаясь к API сервера.
+//
+// В снимок попадают только явно перечисленные метрики; их имена можно
+// заменить публичными, а значения gauge — округлить, чтобы не раскрывать
+// внутренние имена и лишнюю точность. Значения чувствительных метрик
+// дополнительно искажаются правилами раздела privacy.
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/privacy"
+	"github.com/iliodor1/metrics-service/internal/push"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// defaultFile имя файла снимка по умолчанию
+const defaultFile = "metrics.json"
+
+// Source источник текущих значений метрик
+type Source interface {
+	GetAll(ctx context.Context) (map[string]float64, map[string]int64, error)
+}
+
+// Target место публикации снимка и отбор метрик для него
+type Target struct {
+	// Dir локальный каталог, в который записывается файл снимка
+	Dir string `json:"dir"`
+	// S3 корзина S3, в которую загружается файл снимка
+	S3 *S3 `json:"s3"`
+	// File имя файла снимка; по умолчанию metrics.json
+	File string `json:"file"`
+	// Interval периодичность публикации
+	Interval push.Duration `json:"interval"`
+	// Names имена и Prefixes префиксы имён публикуемых метрик; хотя бы
+	// один из списков обязателен, чтобы снимок не раскрыл все метрики
+	Names    []string `json:"names"`
+	Prefixes []string `json:"prefixes"`
+	// Types типы публикуемых метрик (пустой — оба типа)
+	Types []string `json:"types"`
+	// Rename публичные имена метрик по их именам на сервере
+	Rename map[string]string `json:"rename"`
+	// Precision число знаков после запятой в значениях gauge (nil — без округления)
+	Precision *int `json:"precision"`
+}
+
+// file имя файла снимка
+func (t Target) file() string {
+	if t.File == "" {
+		return defaultFile
+	}
+	return t.File
+}
+
+// name описание места публикации для журнала
+func (t Target) name() string {
+	if t.S3 != nil {
+		return "s3://" + t.S3.Bucket + "/" + t.S3.key(t.file())
+	}
+	return filepath.Join(t.Dir, t.file())
+}
+
+// Match проверяет, попадает ли метрика в снимок
+func (t Target) Match(metricType, name string) bool {
+	if len(t.Types) > 0 && !slices.Contains(t.Types, metricType) {
+		return false
+	}
+	if slices.Contains(t.Names, name) {
+		return true
+	}
+	for _, p := range t.Prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot публикуемый снимок: значения метрик по публичным именам
+type Snapshot struct {
+	UpdatedAt time.Time              `json:"updated_at"`
+	Metrics   map[string]json.Number `json:"metrics"`
+}
+
+// Publisher периодически публикует снимки метрик
+type Publisher struct {
+	source  Source
+	targets []Target
+	privacy *privacy.Policy
+}
+
+// New создаёт публикатор снимков. Значения искажаются правилами policy
+// (nil — публикуются точно).
+func New(source Source, targets []Target, policy *privacy.Policy) *Publisher {
+	return &Publisher{source: source, targets: targets, privacy: policy}
+}
+
+// Run публикует снимки по всем местам сразу и затем с их периодичностью;
+// блокируется до отмены контекста
+func (p *Publisher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range p.targets {
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			p.loop(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// loop публикует снимки в одно место
+func (p *Publisher) loop(ctx context.Context, t Target) {
+	ticker := time.NewTicker(time.Duration(t.Interval))
+	defer ticker.Stop()
+	for {
+		if err := p.Publish(ctx, t); err != nil {
+			log.Printf("Ошибка публикации снимка %s: %v", t.name(), err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Build собирает снимок из текущих значений метрик
+func (p *Publisher) Build(ctx context.Context, t Target) (Snapshot, error) {
+	gauges, counters, err := p.source.GetAll(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap := Snapshot{UpdatedAt: time.Now().UTC().Truncate(time.Second), Metrics: make(map[string]json.Number)}
+	var metrics []models.Metrics
+	for _, m := range models.FromMaps(gauges, counters) {
+		if t.Match(m.MType, m.ID) {
+			metrics = append(metrics, m)
+		}
+	}
+	if p.privacy != nil {
+		metrics = p.privacy.Metrics(metrics)
+	}
+	for _, m := range metrics {
+		name := m.ID
+		if public, ok := t.Rename[name]; ok {
+			name = public
+		}
+		if m.Value != nil {
+			precision := -1
+			if t.Precision != nil {
+				precision = *t.Precision
+			}
+			snap.Metrics[name] = json.Number(strconv.FormatFloat(*m.Value, 'f', precision, 64))
+		} else {
+			snap.Metrics[name] = json.Number(strconv.FormatInt(*m.Delta, 10))
+		}
+	}
+	return snap, nil
+}
+
+// Publish публикует снимок в место t
+func (p *Publisher) Publish(ctx context.Context, t Target) error {
+	snap, err := p.Build(ctx, t)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if t.S3 != nil {
+		return t.S3.put(ctx, t.file(), body, time.Duration(t.Interval))
+	}
+	return writeFile(filepath.Join(t.Dir, t.file()), body)
+}
+
+// writeFile атомарно заменяет файл: читатели не увидят его записанным наполовину
+func writeFile(path string, body []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Validate проверяет настройки мест публикации
+func Validate(targets []Target) error {
+	for i, t := range targets {
+		where := fmt.Sprintf("место публикации №%d", i+1)
+		switch {
+		case (t.Dir == "") == (t.S3 == nil):
+			return fmt.Errorf("%s: задайте либо dir, либо s3", where)
+		case t.Interval <= 0:
+			return fmt.Errorf("%s: интервал должен быть положительным", where)
+		case len(t.Names) == 0 && len(t.Prefixes) == 0:
+			return fmt.Errorf("%s: перечислите публикуемые метрики в names или prefixes", where)
+		case strings.ContainsAny(t.file(), `/\`):
+			return fmt.Errorf("%s: file — имя файла без каталога", where)
+		case t.Precision != nil && (*t.Precision < 0 || *t.Precision > 17):
+			return fmt.Errorf("%s: precision от 0 до 17", where)
+		}
+		for _, mType := range t.Types {
+			if mType != models.Gauge && mType != models.Counter {
+				return fmt.Errorf("%s: неизвестный тип метрики %q", where, mType)
+			}
+		}
+		if t.S3 != nil {
+			if err := t.S3.validate(); err != nil {
+				return fmt.Errorf("%s: %w", where, err)
+			}
+		}
+	}
+	return nil
+}
+
+// errNoCredentials не заданы ключи доступа S3
+var errNoCredentials = errors.New("s3: не заданы access_key и secret_key или AWS_ACCESS_KEY_ID и AWS_SECRET_ACCESS_KEY")
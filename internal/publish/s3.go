@@ -0,0 +1,196 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Timeout ограничение времени загрузки снимка
+const s3Timeout = 30 * time.Second
+
+// S3 корзина S3 или совместимого хранилища (MinIO, Ceph RGW).
+// Объект загружается запросом PUT с подписью AWS Signature Version 4
+// по адресу endpoint/bucket/key.
+type S3 struct {
+	// Bucket имя корзины
+	Bucket string `json:"bucket"`
+	// Region регион корзины, например eu-central-1
+	Region string `json:"region"`
+	// Endpoint адрес хранилища; по умолчанию https://s3.<region>.amazonaws.com
+	Endpoint string `json:"endpoint"`
+	// Prefix начало ключа объекта, например status/
+	Prefix string `json:"prefix"`
+	// ACL готовый список доступа объекта, например public-read
+	// (пустой — доступ задаётся политикой корзины)
+	ACL string `json:"acl"`
+	// AccessKey и SecretKey ключи доступа; пустые берутся из переменных
+	// окружения AWS_ACCESS_KEY_ID и AWS_SECRET_ACCESS_KEY
+	// (вместе с AWS_SESSION_TOKEN для временных ключей)
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+// key ключ объекта файла file
+func (s *S3) key(file string) string {
+	return s.Prefix + file
+}
+
+// endpoint адрес хранилища
+func (s *S3) endpoint() string {
+	if s.Endpoint != "" {
+		return strings.TrimRight(s.Endpoint, "/")
+	}
+	return "https://s3." + s.Region + ".amazonaws.com"
+}
+
+// credentials ключи доступа и токен сессии
+func (s *S3) credentials() (access, secret, token string) {
+	if s.AccessKey != "" {
+		return s.AccessKey, s.SecretKey, ""
+	}
+	return os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+}
+
+// validate проверяет настройки корзины
+func (s *S3) validate() error {
+	switch {
+	case s.Bucket == "":
+		return errors.New("s3: не задан bucket")
+	case s.Region == "":
+		return errors.New("s3: не задан region")
+	case (s.AccessKey == "") != (s.SecretKey == ""):
+		return errors.New("s3: access_key и secret_key задаются вместе")
+	}
+	if s.Endpoint != "" {
+		u, err := url.Parse(s.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("s3: неверный endpoint %q", s.Endpoint)
+		}
+	}
+	return nil
+}
+
+// put загружает объект file с телом body. Cache-Control ограничивает
+// хранение снимка в кешах интервалом публикации.
+func (s *S3) put(ctx context.Context, file string, body []byte, maxAge time.Duration) error {
+	access, secret, token := s.credentials()
+	if access == "" || secret == "" {
+		return errNoCredentials
+	}
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+
+	target := s.endpoint() + "/" + uriEncode(s.Bucket+"/"+s.key(file))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	if s.ACL != "" {
+		req.Header.Set("X-Amz-Acl", s.ACL)
+	}
+	if token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	sign(req, body, s.Region, access, secret, time.Now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 ответил %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// sign подписывает запрос к S3 по AWS Signature Version 4. Подписываются
+// хост, Content-Type и все заголовки x-amz-*.
+func sign(req *http.Request, body []byte, region, access, secret string, now time.Time) {
+	const service = "s3"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+access+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// hmacSHA256 подпись HMAC-SHA256 строки data ключом key
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// uriEncode кодирует путь по правилам SigV4: без изменений остаются
+// только буквы, цифры, -._~ и разделитель /
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,182 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Source источник текущих значений метрик
+type Source interface {
+	GetAll(ctx context.Context) (map[string]float64, map[string]int64, error)
+}
+
+// Duration интервал, задаваемый в конфигурации строкой вида "30s"
+type Duration time.Duration
+
+// UnmarshalJSON разбирает интервал из строки
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Destination внешний адрес, куда периодически отправляются метрики
+type Destination struct {
+	// URL адрес, на который отправляется отчёт методом POST
+	URL string `json:"url"`
+	// Interval периодичность отправки
+	Interval Duration `json:"interval"`
+	// Names имена метрик, попадающих в отчёт
+	Names []string `json:"names"`
+	// Prefixes префиксы имён метрик, попадающих в отчёт
+	Prefixes []string `json:"prefixes"`
+	// Types типы метрик, попадающих в отчёт
+	Types []string `json:"types"`
+}
+
+// Match проверяет, попадает ли метрика в отчёт.
+// Пустые фильтры пропускают все метрики.
+func (d Destination) Match(metricType, name string) bool {
+	if len(d.Types) > 0 && !slices.Contains(d.Types, metricType) {
+		return false
+	}
+	if len(d.Names) == 0 && len(d.Prefixes) == 0 {
+		return true
+	}
+	if slices.Contains(d.Names, name) {
+		return true
+	}
+	for _, p := range d.Prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report отчёт, отправляемый во внешнюю систему
+type Report struct {
+	Timestamp time.Time        `json:"timestamp"`
+	Metrics   []models.Metrics `json:"metrics"`
+}
+
+// Pusher периодически отправляет отчёты с метриками во внешние системы
+type Pusher struct {
+	source       Source
+	destinations []Destination
+	client       *http.Client
+}
+
+// New создаёт отправителя отчётов
+func New(source Source, destinations []Destination) *Pusher {
+	return &Pusher{
+		source:       source,
+		destinations: destinations,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run запускает отправку отчётов по всем адресам и блокируется до отмены контекста
+func (p *Pusher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, d := range p.destinations {
+		wg.Add(1)
+		go func(d Destination) {
+			defer wg.Done()
+			p.loop(ctx, d)
+		}(d)
+	}
+	wg.Wait()
+}
+
+// loop отправляет отчёты по одному адресу с заданной периодичностью
+func (p *Pusher) loop(ctx context.Context, d Destination) {
+	ticker := time.NewTicker(time.Duration(d.Interval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Push(ctx, d); err != nil {
+				log.Printf("Ошибка отправки отчёта на %s: %v", d.URL, err)
+			}
+		}
+	}
+}
+
+// Build собирает отчёт из текущих значений метрик по фильтру адреса
+func (p *Pusher) Build(ctx context.Context, d Destination) (Report, error) {
+	gauges, counters, err := p.source.GetAll(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Timestamp: time.Now().UTC(), Metrics: []models.Metrics{}}
+	for _, m := range models.FromMaps(gauges, counters) {
+		if d.Match(m.MType, m.ID) {
+			report.Metrics = append(report.Metrics, m)
+		}
+	}
+	return report, nil
+}
+
+// Push отправляет отчёт на адрес d
+func (p *Pusher) Push(ctx context.Context, d Destination) error {
+	report, err := p.Build(ctx, d)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("получен ответ %s", resp.Status)
+	}
+	return nil
+}
+
+// Validate проверяет настройки адресов
+func Validate(destinations []Destination) error {
+	for i, d := range destinations {
+		if d.URL == "" {
+			return fmt.Errorf("адрес №%d: не задан url", i+1)
+		}
+		if d.Interval <= 0 {
+			return fmt.Errorf("адрес %s: интервал должен быть положительным", d.URL)
+		}
+	}
+	return nil
+}
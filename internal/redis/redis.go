@@ -0,0 +1,214 @@
+// Package redis минимальный клиент Redis по протоколу RESP2:
+// отправка команд и разбор ответов через пул соединений
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// poolSize наибольшее число простаивающих соединений в пуле
+const poolSize = 8
+
+// ErrNil ответ Redis «нет значения»
+var ErrNil = errors.New("redis: нет значения")
+
+// Error ошибка, которую вернул сервер Redis
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Options настройки подключения
+type Options struct {
+	// Addr адрес сервера, например localhost:6379, или unix:/путь/к/сокету
+	Addr string
+	// Password пароль для AUTH (пустой — без авторизации)
+	Password string
+	// DB номер базы для SELECT
+	DB int
+	// Timeout ограничение времени подключения и одной команды
+	Timeout time.Duration
+}
+
+// Client клиент Redis с пулом соединений
+type Client struct {
+	opts Options
+
+	mu   sync.Mutex
+	idle []*conn
+}
+
+// conn одно соединение с сервером
+type conn struct {
+	nc net.Conn
+	br *bufio.Reader
+	bw *bufio.Writer
+}
+
+// New создаёт клиента; соединения открываются при первой команде
+func New(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return &Client{opts: opts}
+}
+
+// Do выполняет команду и возвращает ответ: string для простых строк,
+// int64 для целых, []byte для строк, []any для массивов.
+// Отсутствующее значение возвращается как ErrNil.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(c.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	cn.nc.SetDeadline(deadline)
+
+	reply, err := cn.do(args)
+	var rerr Error
+	if err != nil && !errors.As(err, &rerr) && !errors.Is(err, ErrNil) {
+		// Соединение в неизвестном состоянии: закрываем его
+		cn.nc.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Close закрывает простаивающие соединения
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cn := range c.idle {
+		cn.nc.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// get берёт соединение из пула или открывает новое
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	network, addr := "tcp", c.opts.Addr
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", path
+	}
+	d := net.Dialer{Timeout: c.opts.Timeout}
+	nc, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{nc: nc, br: bufio.NewReader(nc), bw: bufio.NewWriter(nc)}
+	nc.SetDeadline(time.Now().Add(c.opts.Timeout))
+	if c.opts.Password != "" {
+		if _, err := cn.do([]string{"AUTH", c.opts.Password}); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	if c.opts.DB != 0 {
+		if _, err := cn.do([]string{"SELECT", strconv.Itoa(c.opts.DB)}); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// put возвращает соединение в пул
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle) >= poolSize {
+		cn.nc.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// do отправляет команду и читает ответ
+func (cn *conn) do(args []string) (any, error) {
+	fmt.Fprintf(cn.bw, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(cn.bw, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := cn.bw.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(cn.br)
+}
+
+// readReply разбирает один ответ RESP2
+func readReply(br *bufio.Reader) (any, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: неверный ответ %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: неверная длина строки %q", body)
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: неверная длина массива %q", body)
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		items := make([]any, n)
+		for i := range items {
+			item, err := readReply(br)
+			if err != nil && !errors.Is(err, ErrNil) {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: неизвестный тип ответа %q", kind)
+	}
+}
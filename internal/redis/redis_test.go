@@ -0,0 +1,281 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    any
+		wantErr error
+		// invalid ответ нарушает протокол
+		invalid bool
+	}{
+		{name: "простая строка", in: "+OK\r\n", want: "OK"},
+		{name: "пустая простая строка", in: "+\r\n", want: ""},
+		{name: "целое", in: ":-42\r\n", want: int64(-42)},
+		{name: "строка", in: "$5\r\nhe\r\no\r\n", want: []byte("he\r\no")},
+		{name: "пустая строка", in: "$0\r\n\r\n", want: []byte{}},
+		{name: "нет значения", in: "$-1\r\n", wantErr: ErrNil},
+		{name: "нет массива", in: "*-1\r\n", wantErr: ErrNil},
+		{
+			name: "массив с пропуском",
+			in:   "*3\r\n$1\r\na\r\n$-1\r\n:7\r\n",
+			want: []any{[]byte("a"), nil, int64(7)},
+		},
+		{
+			name: "вложенный массив",
+			in:   "*2\r\n*1\r\n+x\r\n*0\r\n",
+			want: []any{[]any{"x"}, []any{}},
+		},
+		{name: "ошибка сервера", in: "-ERR unknown command\r\n", wantErr: Error("ERR unknown command")},
+		{name: "без CRLF", in: "+OK\n", invalid: true},
+		{name: "неизвестный тип", in: "?1\r\n", invalid: true},
+		{name: "неверное целое", in: ":x\r\n", invalid: true},
+		{name: "неверная длина строки", in: "$x\r\n", invalid: true},
+		{name: "неверная длина массива", in: "*x\r\n", invalid: true},
+		{name: "обрыв строки", in: "$5\r\nab", wantErr: io.ErrUnexpectedEOF},
+		{name: "обрыв массива", in: "*2\r\n:1\r\n", wantErr: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.in)))
+			switch {
+			case tt.invalid:
+				if err == nil {
+					t.Fatalf("ожидалась ошибка, получен ответ %#v", got)
+				}
+				var rerr Error
+				if errors.As(err, &rerr) || errors.Is(err, ErrNil) {
+					t.Errorf("нарушение протокола принято за ответ сервера: %v", err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ошибка %v, ожидалась %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !reflect.DeepEqual(got, tt.want):
+				t.Errorf("ответ %#v, ожидался %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteReadCommand(t *testing.T) {
+	// Ответ WriteReply разбирается клиентом, команда клиента — ReadCommand
+	var b strings.Builder
+	bw := bufio.NewWriter(&b)
+	for _, v := range []any{"OK", int64(3), []byte("v"), []string{"a", ""}, Error("ERR x"), nil} {
+		if err := WriteReply(bw, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteReply(bw, 1.5); err == nil {
+		t.Error("неподдерживаемый тип записан")
+	}
+	want := []any{"OK", int64(3), []byte("v"), []any{[]byte("a"), []byte{}}, Error("ERR x"), ErrNil}
+	br := bufio.NewReader(strings.NewReader(b.String()))
+	for _, w := range want {
+		got, err := readReply(br)
+		if werr, ok := w.(error); ok {
+			if !errors.Is(err, werr) {
+				t.Errorf("ошибка %v, ожидалась %v", err, werr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, w) {
+			t.Errorf("ответ %#v (%v), ожидался %#v", got, err, w)
+		}
+	}
+
+	args, err := ReadCommand(bufio.NewReader(strings.NewReader("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n")))
+	if err != nil || !reflect.DeepEqual(args, []string{"GET", "k"}) {
+		t.Errorf("команда %q (%v)", args, err)
+	}
+	for _, in := range []string{"*0\r\n", "+GET\r\n", "*1\r\n:1\r\n"} {
+		if _, err := ReadCommand(bufio.NewReader(strings.NewReader(in))); err == nil {
+			t.Errorf("ReadCommand(%q): ожидалась ошибка", in)
+		}
+	}
+}
+
+// fakeServer сервер Redis для проверки пула: отвечает на команды handle
+// и записывает принятые команды каждого соединения
+type fakeServer struct {
+	ln     net.Listener
+	handle func(args []string) any
+
+	mu    sync.Mutex
+	conns [][]string
+}
+
+func newFakeServer(t *testing.T, handle func(args []string) any) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, handle: handle}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, nil)
+			i := len(s.conns) - 1
+			s.mu.Unlock()
+			go s.serve(nc, i)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(nc net.Conn, i int) {
+	defer nc.Close()
+	br, bw := bufio.NewReader(nc), bufio.NewWriter(nc)
+	for {
+		args, err := ReadCommand(br)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[i] = append(s.conns[i], strings.Join(args, " "))
+		s.mu.Unlock()
+		reply := s.handle(args)
+		if raw, ok := reply.(rawReply); ok {
+			// Ответ с нарушением протокола
+			bw.WriteString(string(raw))
+			bw.Flush()
+			continue
+		}
+		if err := WriteReply(bw, reply); err != nil {
+			return
+		}
+	}
+}
+
+// commands возвращает команды, принятые каждым соединением
+func (s *fakeServer) commands() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([][]string, len(s.conns))
+	for i, c := range s.conns {
+		out[i] = append([]string(nil), c...)
+	}
+	return out
+}
+
+// rawReply ответ, который сервер пишет как есть
+type rawReply string
+
+func TestClientPool(t *testing.T) {
+	s := newFakeServer(t, func(args []string) any {
+		switch args[0] {
+		case "AUTH", "SELECT":
+			return "OK"
+		case "GET":
+			if args[1] == "missing" {
+				return nil
+			}
+			return []byte("v")
+		case "BROKEN":
+			return rawReply("?\r\n")
+		}
+		return Error("ERR unknown command '" + args[0] + "'")
+	})
+	c := New(Options{Addr: s.ln.Addr().String(), Password: "secret", DB: 2, Timeout: time.Second})
+	defer c.Close()
+	ctx := context.Background()
+
+	if v, err := c.Do(ctx, "GET", "k"); err != nil || string(v.([]byte)) != "v" {
+		t.Fatalf("GET k = %v (%v)", v, err)
+	}
+	// Нет значения и ошибка сервера оставляют соединение в пуле
+	if _, err := c.Do(ctx, "GET", "missing"); !errors.Is(err, ErrNil) {
+		t.Errorf("GET missing: ошибка %v, ожидалась ErrNil", err)
+	}
+	var rerr Error
+	if _, err := c.Do(ctx, "NOPE"); !errors.As(err, &rerr) {
+		t.Errorf("NOPE: ошибка %v, ожидалась ошибка сервера", err)
+	}
+	// Нарушение протокола закрывает соединение: следующая команда
+	// открывает новое и снова авторизуется
+	if _, err := c.Do(ctx, "BROKEN"); err == nil {
+		t.Error("BROKEN: ожидалась ошибка")
+	}
+	if _, err := c.Do(ctx, "GET", "k"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"AUTH secret", "SELECT 2", "GET k", "GET missing", "NOPE", "BROKEN"},
+		{"AUTH secret", "SELECT 2", "GET k"},
+	}
+	if got := s.commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("команды соединений %q, ожидались %q", got, want)
+	}
+}
+
+func TestClientAuthError(t *testing.T) {
+	s := newFakeServer(t, func(args []string) any {
+		return Error("WRONGPASS invalid password")
+	})
+	c := New(Options{Addr: s.ln.Addr().String(), Password: "bad", Timeout: time.Second})
+	defer c.Close()
+
+	var rerr Error
+	if _, err := c.Do(context.Background(), "PING"); !errors.As(err, &rerr) {
+		t.Fatalf("ошибка %v, ожидалась ошибка сервера", err)
+	}
+	// Соединение без авторизации в пул не попадает
+	c.mu.Lock()
+	idle := len(c.idle)
+	c.mu.Unlock()
+	if idle != 0 {
+		t.Errorf("в пуле %d соединений, ожидалось 0", idle)
+	}
+}
+
+func TestClientPoolSize(t *testing.T) {
+	s := newFakeServer(t, func(args []string) any { return "PONG" })
+	c := New(Options{Addr: s.ln.Addr().String(), Timeout: time.Second})
+	defer c.Close()
+
+	// Одновременные команды открывают несколько соединений; в пуле
+	// остаётся не больше poolSize
+	var conns []*conn
+	for i := 0; i < poolSize+2; i++ {
+		cn, err := c.get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, cn)
+	}
+	for _, cn := range conns {
+		c.put(cn)
+	}
+	c.mu.Lock()
+	idle := len(c.idle)
+	c.mu.Unlock()
+	if idle != poolSize {
+		t.Errorf("в пуле %d соединений, ожидалось %d", idle, poolSize)
+	}
+	if _, err := c.Do(context.Background(), "PING"); err != nil {
+		t.Fatal(err)
+	}
+}
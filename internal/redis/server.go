@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ReadCommand читает команду клиента — массив строк RESP2
+func ReadCommand(br *bufio.Reader) ([]string, error) {
+	reply, err := readReply(br)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items) == 0 {
+		return nil, errors.New("redis: команда должна быть непустым массивом строк")
+	}
+	args := make([]string, len(items))
+	for i, item := range items {
+		b, ok := item.([]byte)
+		if !ok {
+			return nil, errors.New("redis: команда должна быть непустым массивом строк")
+		}
+		args[i] = string(b)
+	}
+	return args, nil
+}
+
+// WriteReply записывает ответ RESP2: string — простая строка, int64 — целое,
+// []byte — строка, []string — массив строк, Error — ошибка, nil — нет значения
+func WriteReply(bw *bufio.Writer, v any) error {
+	switch r := v.(type) {
+	case nil:
+		bw.WriteString("$-1\r\n")
+	case string:
+		fmt.Fprintf(bw, "+%s\r\n", r)
+	case int64:
+		bw.WriteString(":" + strconv.FormatInt(r, 10) + "\r\n")
+	case []byte:
+		fmt.Fprintf(bw, "$%d\r\n%s\r\n", len(r), r)
+	case []string:
+		fmt.Fprintf(bw, "*%d\r\n", len(r))
+		for _, s := range r {
+			fmt.Fprintf(bw, "$%d\r\n%s\r\n", len(s), s)
+		}
+	case Error:
+		bw.WriteString("-" + string(r) + "\r\n")
+	default:
+		return fmt.Errorf("redis: неподдерживаемый тип ответа %T", v)
+	}
+	return bw.Flush()
+}
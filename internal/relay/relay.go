@@ -0,0 +1,309 @@
+// Package relay реализует режим ретранслятора: частые локальные обновления
+// сворачиваются в окна большей длительности и пересылаются на вышестоящий
+// сервер пакетами, что сокращает трафик из удалённых площадок.
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/pkg/client"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Функции агрегации gauge за окно
+const (
+	AggLast  = "last"
+	AggAvg   = "avg"
+	AggMin   = "min"
+	AggMax   = "max"
+	AggSum   = "sum"
+	AggCount = "count"
+)
+
+// defaultInterval длительность окна по умолчанию
+const defaultInterval = time.Minute
+
+// batchSize наибольшее число метрик в одном запросе к вышестоящему серверу
+const batchSize = 1000
+
+// Rule правило агрегации для метрик, имена которых подходят под шаблон
+type Rule struct {
+	// Pattern шаблон имени в синтаксисе path.Match, например cpu*
+	Pattern string `json:"pattern"`
+	// Agg функция агрегации gauge; counter всегда суммируются
+	Agg string `json:"agg"`
+	// Interval длительность окна, например "10s"; по умолчанию общая
+	Interval string `json:"interval"`
+}
+
+// Config настройки ретранслятора
+type Config struct {
+	// Upstream адрес вышестоящего сервера
+	Upstream string `json:"upstream"`
+	// Key ключ подписи запросов к вышестоящему серверу
+	Key string `json:"key"`
+	// Interval длительность окна по умолчанию, например "60s"
+	Interval string `json:"interval"`
+	// Agg функция агрегации gauge по умолчанию; по умолчанию last
+	Agg string `json:"agg"`
+	// Rules правила для отдельных метрик; применяется первое подходящее
+	Rules []Rule `json:"rules"`
+}
+
+// policy разобранное правило агрегации
+type policy struct {
+	pattern  string
+	agg      string
+	interval time.Duration
+}
+
+// window значения одной метрики за окно
+type window struct {
+	mType string
+	last  float64
+	min   float64
+	max   float64
+	sum   float64
+	count int64
+	delta int64
+}
+
+// add учитывает значение gauge
+func (w *window) add(v float64) {
+	if w.count == 0 {
+		w.min, w.max = v, v
+	}
+	w.last = v
+	w.min = math.Min(w.min, v)
+	w.max = math.Max(w.max, v)
+	w.sum += v
+	w.count++
+}
+
+// merge добавляет к окну более раннее окно old, не отправленное из-за ошибки
+func (w *window) merge(old *window) {
+	w.delta += old.delta
+	if old.count == 0 {
+		return
+	}
+	if w.count == 0 {
+		w.last = old.last
+		w.min, w.max = old.min, old.max
+	}
+	w.min = math.Min(w.min, old.min)
+	w.max = math.Max(w.max, old.max)
+	w.sum += old.sum
+	w.count += old.count
+}
+
+// value значение gauge за окно по функции agg
+func (w *window) value(agg string) float64 {
+	switch agg {
+	case AggAvg:
+		return w.sum / float64(w.count)
+	case AggMin:
+		return w.min
+	case AggMax:
+		return w.max
+	case AggSum:
+		return w.sum
+	case AggCount:
+		return float64(w.count)
+	default:
+		return w.last
+	}
+}
+
+// seriesKey метрика в окне
+type seriesKey struct {
+	mType string
+	name  string
+}
+
+// Relay накапливает обновления по окнам и пересылает их агрегаты
+type Relay struct {
+	upstream string
+	client   *client.Client
+	def      policy
+	rules    []policy
+
+	mu      sync.Mutex
+	windows map[time.Duration]map[seriesKey]*window
+	aggs    map[seriesKey]string
+}
+
+// New проверяет настройки и создаёт ретранслятор
+func New(cfg Config) (*Relay, error) {
+	if cfg.Upstream == "" {
+		return nil, errors.New("не задан адрес вышестоящего сервера")
+	}
+	def, err := newPolicy("*", cfg.Agg, cfg.Interval, defaultInterval)
+	if err != nil {
+		return nil, err
+	}
+	r := &Relay{
+		upstream: cfg.Upstream,
+		client:   client.New(cfg.Upstream, client.WithKey(cfg.Key)),
+		def:      def,
+		windows:  map[time.Duration]map[seriesKey]*window{def.interval: {}},
+		aggs:     make(map[seriesKey]string),
+	}
+	for _, rule := range cfg.Rules {
+		p, err := newPolicy(rule.Pattern, rule.Agg, rule.Interval, def.interval)
+		if err != nil {
+			return nil, err
+		}
+		if rule.Agg == "" {
+			p.agg = def.agg
+		}
+		r.rules = append(r.rules, p)
+		r.windows[p.interval] = map[seriesKey]*window{}
+	}
+	return r, nil
+}
+
+// newPolicy разбирает правило агрегации
+func newPolicy(pattern, agg, interval string, defInterval time.Duration) (policy, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return policy{}, fmt.Errorf("неверный шаблон %q: %w", pattern, err)
+	}
+	switch agg {
+	case "":
+		agg = AggLast
+	case AggLast, AggAvg, AggMin, AggMax, AggSum, AggCount:
+	default:
+		return policy{}, fmt.Errorf("неизвестная функция агрегации %q", agg)
+	}
+	p := policy{pattern: pattern, agg: agg, interval: defInterval}
+	if interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return policy{}, fmt.Errorf("неверный интервал %q", interval)
+		}
+		p.interval = d
+	}
+	return p, nil
+}
+
+// policyFor возвращает правило для метрики name
+func (r *Relay) policyFor(name string) policy {
+	for _, p := range r.rules {
+		if ok, _ := path.Match(p.pattern, name); ok {
+			return p
+		}
+	}
+	return r.def
+}
+
+// series возвращает окно метрики, создавая его при необходимости
+func (r *Relay) series(mType, name string) *window {
+	key := seriesKey{mType, name}
+	p := r.policyFor(name)
+	w, ok := r.windows[p.interval][key]
+	if !ok {
+		w = &window{mType: mType}
+		r.windows[p.interval][key] = w
+		r.aggs[key] = p.agg
+	}
+	return w
+}
+
+// UpdateGauge учитывает значение gauge в текущем окне
+func (r *Relay) UpdateGauge(_ context.Context, name string, value float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(models.Gauge, name).add(value)
+	return nil
+}
+
+// UpdateCounter учитывает приращение counter в текущем окне
+func (r *Relay) UpdateCounter(_ context.Context, name string, delta int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(models.Counter, name).delta += delta
+	return nil
+}
+
+// Run пересылает агрегаты каждого окна по его завершении до отмены контекста,
+// после чего отправляет накопленное
+func (r *Relay) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for interval := range r.windows {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := r.Flush(ctx, interval); err != nil {
+						log.Printf("Не удалось переслать метрики на %s: %v", r.upstream, err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for interval := range r.windows {
+		if err := r.Flush(flushCtx, interval); err != nil {
+			log.Printf("Не удалось переслать метрики при остановке: %v", err)
+		}
+	}
+}
+
+// Flush пересылает агрегаты окон длительностью interval.
+// При ошибке неотправленные окна возвращаются и будут отправлены вместе со следующими.
+func (r *Relay) Flush(ctx context.Context, interval time.Duration) error {
+	r.mu.Lock()
+	windows := r.windows[interval]
+	r.windows[interval] = make(map[seriesKey]*window, len(windows))
+	batch := make([]models.Metrics, 0, len(windows))
+	for key, w := range windows {
+		switch {
+		case w.mType == models.Counter && w.delta != 0:
+			batch = append(batch, models.NewCounter(key.name, w.delta))
+		case w.mType == models.Gauge && w.count > 0:
+			batch = append(batch, models.NewGauge(key.name, w.value(r.aggs[key])))
+		}
+	}
+	r.mu.Unlock()
+
+	models.Sort(batch)
+	for start := 0; start < len(batch); start += batchSize {
+		end := min(start+batchSize, len(batch))
+		if err := r.client.UpdateBatch(ctx, batch[start:end]); err != nil {
+			r.restore(interval, windows, batch[start:])
+			return err
+		}
+	}
+	return nil
+}
+
+// restore возвращает окна неотправленных метрик unsent,
+// объединяя их с накопленными с тех пор
+func (r *Relay) restore(interval time.Duration, old map[seriesKey]*window, unsent []models.Metrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range unsent {
+		key := seriesKey{m.MType, m.ID}
+		w := old[key]
+		if cur, ok := r.windows[interval][key]; ok {
+			cur.merge(w)
+			continue
+		}
+		r.windows[interval][key] = w
+	}
+}
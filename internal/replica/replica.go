@@ -0,0 +1,464 @@
+// Package replica реализует режим реплики: сервер повторяет все записи
+// основного сервера по его потоку обновлений и обслуживает чтение локально.
+package replica
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/iliodor1/metrics-service/internal/sign"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/internal/stream"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// retryDelay пауза перед повторным подключением к основному серверу
+const retryDelay = 3 * time.Second
+
+// maxStreamWindow наибольшее окно zstd потока: основной сервер сжимает
+// с окном 1 МиБ, а большее окно потребовало бы от реплики лишней памяти
+const maxStreamWindow = 8 << 20
+
+// errReset основной сервер не хранит часть пропущенных обновлений
+var errReset = errors.New("поток обновлений прерван: нужна полная синхронизация")
+
+// Replica повторяет записи основного сервера в локальном хранилище.
+//
+// При первом подключении и после разрыва, который основной сервер не может
+// восполнить, реплика скачивает полную копию метрик (POST /admin/backup),
+// а затем читает поток /admin/replication/events, продолжая его с номера
+// последнего применённого обновления. Обновления содержат итоговые значения
+// метрик, поэтому повторное применение не искажает counter.
+//
+// Поток запрашивается в компактном кодировании delta и со сжатием zstd;
+// основной сервер прежней версии сжимает поток gzip и присылает обычные
+// события metric, и они тоже применяются.
+type Replica struct {
+	primary string
+	token   string
+	store   storage.Storage
+	http    *http.Client
+	// proxy передаёт основному серверу чтения со строгой согласованностью
+	proxy *httputil.ReverseProxy
+
+	// received и decoded байты потока: принятые по сети и после распаковки
+	received atomic.Int64
+	decoded  atomic.Int64
+
+	mu        sync.Mutex
+	last      uint64
+	connected bool
+	synced    time.Time
+	// encoding кодирование, в котором основной сервер присылает поток
+	encoding string
+	// head последний известный номер обновления основного сервера
+	head uint64
+	// events число применённых событий с запуска
+	events int64
+	// since время подключения к потоку; connEvents и connBytes — события
+	// и принятые байты этого подключения
+	since      time.Time
+	connEvents int64
+	connBytes  int64
+}
+
+// series ряд потока в кодировании delta
+type series struct {
+	mType string
+	name  string
+	total int64
+}
+
+// New создаёт реплику основного сервера primary (host:port или URL).
+// token — токен администратора основного сервера (пустой — без токена).
+func New(primary, token string, store storage.Storage) *Replica {
+	if !strings.Contains(primary, "://") {
+		primary = "http://" + primary
+	}
+	r := &Replica{
+		primary: strings.TrimRight(primary, "/"),
+		token:   token,
+		store:   store,
+		http:    &http.Client{},
+	}
+	r.proxy = r.newProxy()
+	return r
+}
+
+// Status состояние репликации
+type Status struct {
+	Primary string `json:"primary"`
+	// Connected подключена ли реплика к потоку обновлений
+	Connected bool `json:"connected"`
+	// LastEventID номер последнего применённого обновления основного сервера
+	LastEventID uint64 `json:"last_event_id"`
+	// LastSync время последней полной синхронизации
+	LastSync time.Time `json:"last_sync"`
+	// Encoding кодирование потока: delta или json у основного сервера
+	// прежней версии (пустое — поток ещё не читался)
+	Encoding string `json:"encoding,omitempty"`
+	// PrimaryEventID последний известный номер обновления основного сервера
+	PrimaryEventID uint64 `json:"primary_event_id"`
+	// LagEvents отставание реплики от основного сервера в обновлениях
+	LagEvents uint64 `json:"lag_events"`
+	// Events число применённых событий с запуска
+	Events int64 `json:"events"`
+	// BytesReceived и BytesDecoded байты потока с запуска: принятые по сети
+	// и после распаковки
+	BytesReceived int64 `json:"bytes_received"`
+	BytesDecoded  int64 `json:"bytes_decoded"`
+	// CompressionRatio во сколько раз сжатие уменьшает поток
+	CompressionRatio float64 `json:"compression_ratio"`
+	// EventsPerSecond и BytesPerSecond средняя скорость текущего подключения
+	// (байты — принятые по сети)
+	EventsPerSecond float64 `json:"events_per_second"`
+	BytesPerSecond  float64 `json:"bytes_per_second"`
+}
+
+// Status возвращает текущее состояние репликации
+func (r *Replica) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := Status{
+		Primary: r.primary, Connected: r.connected, LastEventID: r.last, LastSync: r.synced,
+		Encoding: r.encoding, PrimaryEventID: r.head, Events: r.events,
+		BytesReceived: r.received.Load(), BytesDecoded: r.decoded.Load(),
+	}
+	if r.head > r.last {
+		st.LagEvents = r.head - r.last
+	}
+	if st.BytesReceived > 0 {
+		st.CompressionRatio = float64(st.BytesDecoded) / float64(st.BytesReceived)
+	}
+	if r.connected {
+		if elapsed := time.Since(r.since).Seconds(); elapsed > 0 {
+			st.EventsPerSecond = float64(r.connEvents) / elapsed
+			st.BytesPerSecond = float64(r.received.Load()-r.connBytes) / elapsed
+		}
+	}
+	return st
+}
+
+// Run повторяет записи основного сервера до отмены контекста
+func (r *Replica) Run(ctx context.Context) {
+	needSync := true
+	for ctx.Err() == nil {
+		var err error
+		if needSync {
+			err = r.sync(ctx)
+			needSync = err != nil
+		}
+		if err == nil {
+			err = r.follow(ctx)
+			r.setConnected(false)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errReset) {
+			log.Printf("Реплика: %v", err)
+			needSync = true
+			continue
+		}
+		log.Printf("Реплика: нет связи с %s: %v", r.primary, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// sync скачивает полную копию метрик и устанавливает их значения
+func (r *Replica) sync(ctx context.Context) error {
+	resp, err := r.request(ctx, http.MethodPost, "/admin/backup?format=binary", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	last, err := strconv.ParseUint(resp.Header.Get("X-Last-Event-ID"), 10, 64)
+	if err != nil {
+		return errors.New("основной сервер не сообщил номер обновления копии")
+	}
+	gauges, counters, err := storage.ReadSnapshot(resp.Body)
+	if err != nil {
+		return err
+	}
+	n, err := storage.Restore(ctx, r.store, gauges, counters)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.last = last
+	r.synced = time.Now()
+	r.mu.Unlock()
+	log.Printf("Реплика: синхронизировано %d метрик с %s", n, r.primary)
+	return nil
+}
+
+// follow читает поток обновлений с номера последнего применённого
+func (r *Replica) follow(ctx context.Context) error {
+	r.mu.Lock()
+	last := r.last
+	r.mu.Unlock()
+
+	resp, err := r.request(ctx, http.MethodGet, "/admin/replication/events?encoding="+stream.EncodingDelta, func(req *http.Request) {
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(last, 10))
+		// Сжатие запрашивается явно, чтобы считать принятые по сети байты
+		req.Header.Set("Accept-Encoding", "zstd, gzip")
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = &countingReader{r: resp.Body, n: &r.received}
+	switch resp.Header.Get("Content-Encoding") {
+	case "zstd":
+		zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxStreamWindow))
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		body = zr
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		body = zr
+	}
+	body = &countingReader{r: body, n: &r.decoded}
+	r.setConnected(true)
+
+	// Ряды кодирования delta действуют в пределах подключения
+	rows := make(map[int]*series)
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	var (
+		id    uint64
+		event string
+		data  []byte
+	)
+	for sc.Scan() {
+		line := sc.Text()
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch {
+		case line == "":
+			// Пустая строка завершает событие
+			if err := r.dispatch(ctx, rows, id, event, data); err != nil {
+				return err
+			}
+			id, event, data = 0, "", nil
+		case field == "id":
+			id, _ = strconv.ParseUint(value, 10, 64)
+		case field == "event":
+			event = value
+		case field == "data":
+			data = append(data, value...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return errors.New("основной сервер закрыл поток")
+}
+
+// dispatch применяет одно событие потока; rows — ряды кодирования delta
+func (r *Replica) dispatch(ctx context.Context, rows map[int]*series, id uint64, event string, data []byte) error {
+	var m models.Metrics
+	switch event {
+	case "reset":
+		return errReset
+	case "head":
+		head, err := strconv.ParseUint(string(data), 10, 64)
+		if err != nil {
+			return fmt.Errorf("неверное событие head: %q", data)
+		}
+		r.mu.Lock()
+		r.head = max(r.head, head)
+		r.mu.Unlock()
+		return nil
+	case "series":
+		// Основной сервер нумерует ряды подряд и объявляет каждый один раз,
+		// поэтому повторное объявление не может перенаправить обновления ряда
+		var s stream.Series
+		if err := json.Unmarshal(data, &s); err != nil || s.Index != len(rows) {
+			return fmt.Errorf("неверное объявление ряда: %q", data)
+		}
+		rows[s.Index] = &series{mType: s.MType, name: s.ID}
+		return nil
+	case "delta":
+		var err error
+		if m, err = decodeDelta(rows, data); err != nil {
+			return fmt.Errorf("неверное событие %d: %w", id, err)
+		}
+	case "metric":
+		if err := json.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("неверное событие %d: %w", id, err)
+		}
+	default:
+		return nil
+	}
+
+	if err := models.Validate(m); err != nil {
+		return fmt.Errorf("неверное событие %d: %w", id, err)
+	}
+	var err error
+	if m.MType == models.Gauge {
+		err = r.store.UpdateGauge(ctx, m.ID, *m.Value)
+	} else {
+		_, err = storage.Restore(ctx, r.store, nil, map[string]int64{m.ID: *m.Delta})
+	}
+	if err != nil {
+		log.Printf("Реплика: не удалось применить %s: %v", m.ID, err)
+	}
+
+	r.mu.Lock()
+	r.last = id
+	r.head = max(r.head, id)
+	r.events++
+	r.connEvents++
+	r.encoding = stream.EncodingJSON
+	if event == "delta" {
+		r.encoding = stream.EncodingDelta
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// decodeDelta восстанавливает метрику из события delta «номер значение»
+// с итоговым значением counter
+func decodeDelta(rows map[int]*series, data []byte) (models.Metrics, error) {
+	var m models.Metrics
+	ref, value, ok := strings.Cut(string(data), " ")
+	index, err := strconv.Atoi(ref)
+	if !ok || err != nil {
+		return m, fmt.Errorf("неверные данные %q", data)
+	}
+	row, ok := rows[index]
+	if !ok {
+		return m, fmt.Errorf("ряд %d не объявлен", index)
+	}
+	m.ID, m.MType = row.name, row.mType
+	switch row.mType {
+	case models.Gauge:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return m, fmt.Errorf("неверное значение %q", value)
+		}
+		m.Value = &v
+	case models.Counter:
+		d, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return m, fmt.Errorf("неверное значение %q", value)
+		}
+		row.total += d
+		total := row.total
+		m.Delta = &total
+	}
+	return m, nil
+}
+
+// countingReader считает прочитанные байты
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// request отправляет запрос основному серверу с токеном администратора
+func (r *Replica) request(ctx context.Context, method, path string, prepare func(*http.Request)) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.primary+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: основной сервер ответил %s", method, path, resp.Status)
+	}
+	return resp, nil
+}
+
+// setConnected отмечает подключение к потоку обновлений
+func (r *Replica) setConnected(ok bool) {
+	r.mu.Lock()
+	r.connected = ok
+	if ok {
+		r.since, r.connEvents, r.connBytes = time.Now(), 0, r.received.Load()
+	}
+	r.mu.Unlock()
+}
+
+// newProxy создаёт передачу запросов чтения основному серверу
+func (r *Replica) newProxy() *httputil.ReverseProxy {
+	target, err := url.Parse(r.primary)
+	if err != nil {
+		return nil
+	}
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			// Ответ сжимается и подписывается уже на реплике
+			pr.Out.Header.Del("Accept-Encoding")
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			for _, a := range sign.Algorithms {
+				resp.Header.Del(a.Header)
+			}
+			resp.Header.Del(sign.AlgorithmsHeader)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			log.Printf("Реплика: чтение с %s: %v", r.primary, err)
+			http.Error(w, "Основной сервер недоступен.", http.StatusBadGateway)
+		},
+	}
+}
+
+// ServeRead передаёт запрос чтения основному серверу и возвращает клиенту
+// его ответ: так клиент видит свои записи, ещё не дошедшие до реплики.
+// Заголовки клиента, в том числе API-ключ, передаются без изменений.
+func (r *Replica) ServeRead(w http.ResponseWriter, req *http.Request) {
+	if r.proxy == nil {
+		http.Error(w, "Неверный адрес основного сервера.", http.StatusBadGateway)
+		return
+	}
+	r.proxy.ServeHTTP(w, req)
+}
@@ -0,0 +1,68 @@
+package replica
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+func TestDispatchSeries(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  [][2]string
+		wantErr bool
+		want    map[string]int64
+	}{
+		{
+			name:   "ряд и обновление",
+			events: [][2]string{{"series", `{"index":0,"type":"counter","id":"hits"}`}, {"delta", "0 5"}},
+			want:   map[string]int64{"hits": 5},
+		},
+		{
+			name:    "повторное объявление ряда",
+			events:  [][2]string{{"series", `{"index":0,"type":"counter","id":"hits"}`}, {"series", `{"index":0,"type":"counter","id":"victim"}`}},
+			wantErr: true,
+		},
+		{
+			name:    "пропуск номера",
+			events:  [][2]string{{"series", `{"index":1,"type":"counter","id":"hits"}`}},
+			wantErr: true,
+		},
+		{
+			name:    "прежний формат объявления",
+			events:  [][2]string{{"series", "0 counter hits"}},
+			wantErr: true,
+		},
+		{
+			name:    "обновление необъявленного ряда",
+			events:  [][2]string{{"delta", "0 5"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storage.NewMemStorage()
+			r := New("localhost:1", "", s)
+			rows := make(map[int]*series)
+			var err error
+			for i, e := range tt.events {
+				if err = r.dispatch(context.Background(), rows, uint64(i+1), e[0], []byte(e[1])); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dispatch = %v, ожидалась ошибка: %t", err, tt.wantErr)
+			}
+			_, counters, _ := s.GetAll(context.Background())
+			if len(counters) != len(tt.want) {
+				t.Fatalf("counter %v, ожидалось %v", counters, tt.want)
+			}
+			for name, v := range tt.want {
+				if counters[name] != v {
+					t.Errorf("counter %s = %d, ожидалось %d", name, counters[name], v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Package selfmetrics собирает метрики самого сервера: запросы и ошибки
+// по маршрутам, задержку обновлений, число метрик в хранилище и время
+// сохранения снимков. Метрики публикуются в хранилище в зарезервированном
+// пространстве имён _internal/ и читаются обычным API чтения.
+package selfmetrics
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/internal/tenant"
+)
+
+// Имена публикуемых метрик без пространства имён
+const (
+	// metricRequests число запросов по маршрутам (counter)
+	metricRequests = "http_requests"
+	// metricErrors число ответов с кодом 4xx и 5xx по маршрутам (counter)
+	metricErrors = "http_errors"
+	// metricUpdateLatency квантили задержки обновлений за интервал (gauge)
+	metricUpdateLatency = "update_latency_seconds"
+	// metricCount число метрик в хранилище по типам (gauge)
+	metricCount = "metrics"
+	// metricFlush длительность последнего сохранения снимка (gauge)
+	metricFlush = "storage_flush_seconds"
+	// metricFlushes и metricFlushErrors число сохранений снимка и неудач (counter)
+	metricFlushes     = "storage_flushes"
+	metricFlushErrors = "storage_flush_errors"
+)
+
+// maxSamples наибольшее число задержек обновлений, хранимых за интервал:
+// при большем потоке квантили считаются по первым обновлениям интервала
+const maxSamples = 1 << 14
+
+// quantiles публикуемые квантили задержки обновлений
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+// Store хранилище, в которое публикуются метрики сервера
+type Store interface {
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+	GetAll(ctx context.Context) (map[string]float64, map[string]int64, error)
+}
+
+// Name возвращает имя метрики сервера base с метками set в хранилище
+func Name(base string, set map[string]string) string {
+	return tenant.Scope(tenant.Internal, labels.Format(base, set))
+}
+
+// flush сведения о сохранениях снимка одного хранилища
+type flush struct {
+	last   time.Duration
+	count  int64
+	errors int64
+}
+
+// Recorder накапливает измерения между публикациями. Счётчики
+// публикуются приращениями, поэтому переживают перезапуск вместе
+// со снимком хранилища.
+type Recorder struct {
+	store Store
+
+	mu       sync.Mutex
+	requests map[string]int64
+	errors   map[[2]string]int64
+	samples  []float64
+	flushes  map[string]*flush
+}
+
+// New создаёт сборщик метрик сервера, публикующий их в store
+func New(store Store) *Recorder {
+	return &Recorder{
+		store:    store,
+		requests: make(map[string]int64),
+		errors:   make(map[[2]string]int64),
+		flushes:  make(map[string]*flush),
+	}
+}
+
+// Observer возвращает функцию учёта запросов к маршруту pattern.
+// Для маршрутов обновления (update) учитывается и задержка ответа.
+func (r *Recorder) Observer(pattern string, update bool) func(status int, elapsed time.Duration) {
+	endpoint := endpointLabel(pattern)
+	return func(status int, elapsed time.Duration) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests[endpoint]++
+		switch {
+		case status >= http.StatusInternalServerError:
+			r.errors[[2]string{endpoint, "5xx"}]++
+		case status >= http.StatusBadRequest:
+			r.errors[[2]string{endpoint, "4xx"}]++
+		}
+		if update && len(r.samples) < maxSamples {
+			r.samples = append(r.samples, elapsed.Seconds())
+		}
+	}
+}
+
+// ObserveFlush учитывает сохранение снимка хранилища backend
+func (r *Recorder) ObserveFlush(backend string, elapsed time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.flushes[backend]
+	if f == nil {
+		f = &flush{}
+		r.flushes[backend] = f
+	}
+	f.count++
+	if err != nil {
+		f.errors++
+		return
+	}
+	f.last = elapsed
+}
+
+// Run публикует метрики сервера с периодичностью interval до отмены контекста
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Publish(ctx); err != nil {
+				log.Printf("Не удалось опубликовать метрики сервера: %v", err)
+			}
+		}
+	}
+}
+
+// Publish записывает накопленные с прошлой публикации измерения в хранилище
+func (r *Recorder) Publish(ctx context.Context) error {
+	r.mu.Lock()
+	requests, errors, samples := r.requests, r.errors, r.samples
+	r.requests = make(map[string]int64)
+	r.errors = make(map[[2]string]int64)
+	r.samples = nil
+	flushes := make(map[string]flush, len(r.flushes))
+	for backend, f := range r.flushes {
+		flushes[backend] = *f
+		f.count, f.errors = 0, 0
+	}
+	r.mu.Unlock()
+
+	var firstErr error
+	check := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for endpoint, n := range requests {
+		check(r.store.UpdateCounter(ctx, Name(metricRequests, map[string]string{"endpoint": endpoint}), n))
+	}
+	for key, n := range errors {
+		check(r.store.UpdateCounter(ctx, Name(metricErrors, map[string]string{"endpoint": key[0], "class": key[1]}), n))
+	}
+
+	// Без обновлений за интервал задержка нулевая, а не прошлая
+	sort.Float64s(samples)
+	for _, q := range quantiles {
+		check(r.store.UpdateGauge(ctx, Name(metricUpdateLatency, map[string]string{"quantile": strconv.FormatFloat(q, 'f', -1, 64)}), quantile(samples, q)))
+	}
+
+	for backend, f := range flushes {
+		set := map[string]string{"backend": backend}
+		if f.count > f.errors {
+			check(r.store.UpdateGauge(ctx, Name(metricFlush, set), f.last.Seconds()))
+		}
+		if f.count > 0 {
+			check(r.store.UpdateCounter(ctx, Name(metricFlushes, set), f.count))
+		}
+		if f.errors > 0 {
+			check(r.store.UpdateCounter(ctx, Name(metricFlushErrors, set), f.errors))
+		}
+	}
+
+	gauges, counters, err := r.store.GetAll(ctx)
+	check(err)
+	if err == nil {
+		check(r.store.UpdateGauge(ctx, Name(metricCount, map[string]string{"type": "gauge"}), float64(len(gauges))))
+		check(r.store.UpdateGauge(ctx, Name(metricCount, map[string]string{"type": "counter"}), float64(len(counters))))
+	}
+	return firstErr
+}
+
+// quantile возвращает квантиль q упорядоченной выборки (0 для пустой)
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+// endpointLabel значение метки маршрута: шаблон ServeMux без {$}
+// и с параметрами пути вида :name, чтобы фигурные скобки не ломали метки
+func endpointLabel(pattern string) string {
+	pattern = strings.ReplaceAll(pattern, "{$}", "")
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(pattern, '{')
+		end := strings.IndexByte(pattern, '}')
+		if open < 0 || end < open {
+			break
+		}
+		b.WriteString(pattern[:open])
+		b.WriteByte(':')
+		b.WriteString(strings.TrimSuffix(pattern[open+1:end], "..."))
+		pattern = pattern[end+1:]
+	}
+	b.WriteString(pattern)
+	return Label(b.String())
+}
+
+// Label заменяет в значении метки символы, недопустимые в именах метрик
+func Label(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', ',', '=', '{', '}':
+			return '_'
+		}
+		return r
+	}, v)
+}
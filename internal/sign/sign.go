@@ -0,0 +1,117 @@
+// Package sign подписывает тела запросов и ответов ключом HMAC. Хеш
+// подписи выбирается из SHA-256, SHA-512/256 и BLAKE2b-256; подпись
+// каждого алгоритма передаётся в своём заголовке.
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Header заголовок, в котором передаётся подпись HMAC-SHA256
+const Header = "HashSHA256"
+
+// AlgorithmsHeader заголовок ответа со списком алгоритмов подписи,
+// которые принимает сервер, в порядке предпочтения
+const AlgorithmsHeader = "X-Sign-Algorithms"
+
+// Algorithm алгоритм хеширования подписи
+type Algorithm struct {
+	// Name имя алгоритма в настройках и в AlgorithmsHeader
+	Name string
+	// Header заголовок с подписью этим алгоритмом
+	Header string
+	new    func() hash.Hash
+}
+
+// Алгоритмы подписи
+var (
+	SHA256     = &Algorithm{Name: "sha256", Header: Header, new: sha256.New}
+	SHA512_256 = &Algorithm{Name: "sha512-256", Header: "HashSHA512-256", new: sha512.New512_256}
+	BLAKE2b256 = &Algorithm{Name: "blake2b-256", Header: "HashBLAKE2b-256", new: newBLAKE2b256}
+)
+
+// newBLAKE2b256 создаёт BLAKE2b-256 без ключа: подпись строится из него
+// так же, как из SHA-2, конструкцией HMAC
+func newBLAKE2b256() hash.Hash {
+	// Ошибку New256 возвращает только для ключа длиннее 64 байт
+	h, _ := blake2b.New256(nil)
+	return h
+}
+
+// Algorithms все алгоритмы подписи
+var Algorithms = []*Algorithm{SHA256, SHA512_256, BLAKE2b256}
+
+// Lookup возвращает алгоритм по имени
+func Lookup(name string) (*Algorithm, bool) {
+	for _, a := range Algorithms {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+// ParseAlgorithms разбирает список имён алгоритмов через запятую
+func ParseAlgorithms(list string) ([]*Algorithm, error) {
+	var algs []*Algorithm
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		a, ok := Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("неизвестный алгоритм подписи %q: допустимы sha256, sha512-256, blake2b-256", name)
+		}
+		algs = append(algs, a)
+	}
+	if len(algs) == 0 {
+		return nil, fmt.Errorf("не задан ни один алгоритм подписи")
+	}
+	return algs, nil
+}
+
+// FormatAlgorithms перечисляет имена алгоритмов через запятую
+func FormatAlgorithms(algs []*Algorithm) string {
+	names := make([]string, len(algs))
+	for i, a := range algs {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Sum вычисляет подпись данных ключом key
+func (a *Algorithm) Sum(data []byte, key string) string {
+	h := hmac.New(a.new, []byte(key))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify проверяет подпись данных
+func (a *Algorithm) Verify(data []byte, key, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	h := hmac.New(a.new, []byte(key))
+	h.Write(data)
+	return hmac.Equal(h.Sum(nil), expected)
+}
+
+// Sum вычисляет подпись HMAC-SHA256 данных ключом key
+func Sum(data []byte, key string) string {
+	return SHA256.Sum(data, key)
+}
+
+// Verify проверяет подпись HMAC-SHA256 данных
+func Verify(data []byte, key, signature string) bool {
+	return SHA256.Verify(data, key, signature)
+}
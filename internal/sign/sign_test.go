@@ -0,0 +1,95 @@
+package sign
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// data n байт, одинаковых с эталонными значениями
+func data(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestBLAKE2b256(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		// RFC 7693, приложение A, и эталонная реализация с длиной 32 байта
+		{name: "пусто", data: nil, want: "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8"},
+		{name: "abc", data: []byte("abc"), want: "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{name: "3 байта", data: data(3), want: "3d8c3d594928271f44aad7a04b177154806867bcf918e1549c0bc16f9da2b09b"},
+		{name: "ровно блок", data: data(128), want: "c3582f71ebb2be66fa5dd750f80baae97554f3b015663c8be377cfcb2488c1d1"},
+		{name: "блок и байт", data: data(129), want: "f7f3c46ba2564ff4c4c162da1f5b605f9f1c4aa6a20652a9f9a337c1a2f5b9c9"},
+		{name: "1000 байт", data: data(1000), want: "b372d0608f720c8c3dd41e9c8eecb10143b41abe520b616607e754bf79c08331"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newBLAKE2b256()
+			h.Write(tt.data)
+			if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+				t.Errorf("BLAKE2b-256 = %s, ожидалось %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlgorithmSum(t *testing.T) {
+	// RFC 4231, тест 1: ключ из 20 байт 0x0b и данные «Hi There»
+	key := strings.Repeat("\x0b", 20)
+	msg := []byte("Hi There")
+	tests := []struct {
+		alg  *Algorithm
+		want string
+	}{
+		{alg: SHA256, want: "b0344c61d8db38535ca8afceaf0bf12b881dc200c9833da726e9376c2e32cff7"},
+		{alg: SHA512_256, want: "9f9126c3d9c3c330d760425ca8a217e31feae31bfe70196ff81642b868402eab"},
+		{alg: BLAKE2b256, want: "b6996ecae165cdb17a02becfbf442b5dee41c5075ded9a5763185cd68bd261d0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg.Name, func(t *testing.T) {
+			if got := tt.alg.Sum(msg, key); got != tt.want {
+				t.Errorf("Sum = %s, ожидалось %s", got, tt.want)
+			}
+			if !tt.alg.Verify(msg, key, tt.want) {
+				t.Error("Verify отклонил верную подпись")
+			}
+			if tt.alg.Verify([]byte("Hi there"), key, tt.want) {
+				t.Error("Verify принял подпись других данных")
+			}
+			if tt.alg.Verify(msg, key, "не hex") {
+				t.Error("Verify принял подпись не в hex")
+			}
+		})
+	}
+}
+
+func TestParseAlgorithms(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    string
+		wantErr bool
+	}{
+		{list: "sha256", want: "sha256"},
+		{list: " BLAKE2b-256 , sha256", want: "blake2b-256, sha256"},
+		{list: "md5", wantErr: true},
+		{list: " , ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			algs, err := ParseAlgorithms(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAlgorithms(%q) = %v", tt.list, err)
+			}
+			if err == nil && FormatAlgorithms(algs) != tt.want {
+				t.Errorf("алгоритмы %s, ожидалось %s", FormatAlgorithms(algs), tt.want)
+			}
+		})
+	}
+}
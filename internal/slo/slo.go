@@ -0,0 +1,402 @@
+// Package slo отслеживает цели уровня обслуживания (SLO): долю успешных
+// событий за скользящее окно по двум counter — успешных и всех событий.
+//
+// Для каждой цели периодически считаются выполнение цели, остаток бюджета
+// ошибок и скорость его расходования (burn rate) за короткие окна. Они
+// публикуются как gauge с метками:
+//
+//	SLOCompliance{slo=api}
+//	SLOErrorBudgetRemaining{slo=api}
+//	SLOBurnRate{slo=api,window=1h}
+//
+// поэтому их можно читать как обычные метрики и проверять правилами
+// оповещений. Скорость 1 означает, что бюджет закончится ровно к концу
+// окна цели; 14.4 за час — что месячный бюджет уйдёт за двое суток.
+package slo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/alerts"
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// Имена публикуемых метрик
+const (
+	MetricCompliance = "SLOCompliance"
+	MetricBudget     = "SLOErrorBudgetRemaining"
+	MetricBurnRate   = "SLOBurnRate"
+)
+
+// maxSamples примерное число хранимых отсчётов на цель
+const maxSamples = 4096
+
+// Окна скорости расходования бюджета по умолчанию
+var defaultBurnWindows = []string{"1h", "6h"}
+
+// Source источник значений counter
+type Source interface {
+	GetCounter(ctx context.Context, name string) (int64, error)
+}
+
+// Gauges хранилище, в которое публикуются показатели целей
+type Gauges interface {
+	UpdateGauge(ctx context.Context, name string, value float64) error
+}
+
+// Config настройки целей
+type Config struct {
+	// Interval частота пересчёта, например "30s"
+	Interval string `json:"interval"`
+	// Objectives цели
+	Objectives []Objective `json:"objectives"`
+}
+
+// Objective цель уровня обслуживания
+type Objective struct {
+	// Name уникальное имя цели, оно же значение метки slo
+	Name string `json:"name"`
+	// Good counter успешных событий, Total — всех событий
+	Good  string `json:"good"`
+	Total string `json:"total"`
+	// Target целевая доля успешных событий, например 0.999
+	Target float64 `json:"target"`
+	// Window окно цели, например "30d" или "720h"
+	Window string `json:"window"`
+	// BurnWindows окна скорости расходования бюджета; по умолчанию 1h и 6h
+	BurnWindows []string `json:"burn_windows"`
+	// Alerts оповещения о быстром расходовании бюджета
+	Alerts []BurnAlert `json:"alerts"`
+}
+
+// BurnAlert оповещение, когда скорость расходования бюджета за окно Window
+// превышает Threshold в течение For
+type BurnAlert struct {
+	Window    string  `json:"window"`
+	Threshold float64 `json:"threshold"`
+	For       string  `json:"for"`
+	// Webhook адрес оповещения; если пуст, используется общий адрес оповещений
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// parseWindow разбирает длительность, допуская дни: 30d, 7d12h
+func parseWindow(s string) (time.Duration, error) {
+	var days time.Duration
+	if i := strings.IndexByte(s, 'd'); i > 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("неверная длительность %q", s)
+		}
+		days, s = time.Duration(n)*24*time.Hour, s[i+1:]
+		if s == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("неверная длительность %q", s)
+	}
+	return days + d, nil
+}
+
+// sample накопленные значения counter в момент t с учётом их сбросов
+type sample struct {
+	t           time.Time
+	good, total float64
+}
+
+// objective цель вместе с накопленными отсчётами
+type objective struct {
+	Objective
+	window     time.Duration
+	burn       []time.Duration
+	resolution time.Duration
+
+	samples []sample
+	// cur накопленные значения на момент последнего пересчёта
+	cur sample
+	// prevGood и prevTotal последние прочитанные значения counter
+	prevGood, prevTotal float64
+	started             bool
+	status              Status
+}
+
+// Status показатели цели
+type Status struct {
+	Name   string  `json:"name"`
+	Target float64 `json:"target"`
+	Window string  `json:"window"`
+	// Good и Total число событий за окно (с начала наблюдения, если оно короче окна)
+	Good  float64 `json:"good"`
+	Total float64 `json:"total"`
+	// Compliance доля успешных событий; null, если событий не было
+	Compliance *float64 `json:"compliance"`
+	// ErrorBudgetRemaining доля неизрасходованного бюджета ошибок, может быть отрицательной
+	ErrorBudgetRemaining *float64 `json:"error_budget_remaining"`
+	// BurnRates скорость расходования бюджета по окнам
+	BurnRates map[string]float64 `json:"burn_rates"`
+	// Since начало наблюдения
+	Since time.Time `json:"since"`
+}
+
+// Tracker периодически пересчитывает показатели целей
+type Tracker struct {
+	source   Source
+	out      Gauges
+	interval time.Duration
+
+	mu         sync.Mutex
+	objectives []*objective
+	failed     bool
+}
+
+// New проверяет цели и создаёт Tracker, читающий counter из source
+// и публикующий показатели в out
+func New(source Source, out Gauges, cfg Config) (*Tracker, error) {
+	t := &Tracker{source: source, out: out, interval: 30 * time.Second}
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("неверный интервал пересчёта %q", cfg.Interval)
+		}
+		t.interval = d
+	}
+
+	seen := make(map[string]bool)
+	for _, o := range cfg.Objectives {
+		switch {
+		case o.Name == "" || strings.ContainsAny(o.Name, "{},="):
+			return nil, fmt.Errorf("цель %q: неверное имя", o.Name)
+		case seen[o.Name]:
+			return nil, fmt.Errorf("цель %s задана дважды", o.Name)
+		case o.Good == "" || o.Total == "":
+			return nil, fmt.Errorf("цель %s: не заданы counter good и total", o.Name)
+		case o.Target <= 0 || o.Target >= 1:
+			return nil, fmt.Errorf("цель %s: target должен быть между 0 и 1", o.Name)
+		}
+		seen[o.Name] = true
+
+		obj := &objective{Objective: o}
+		var err error
+		if obj.window, err = parseWindow(o.Window); err != nil || obj.window <= 0 {
+			return nil, fmt.Errorf("цель %s: неверное окно %q", o.Name, o.Window)
+		}
+		if len(obj.BurnWindows) == 0 {
+			obj.BurnWindows = defaultBurnWindows
+		}
+		for _, w := range obj.BurnWindows {
+			d, err := parseWindow(w)
+			if err != nil || d <= 0 || d > obj.window {
+				return nil, fmt.Errorf("цель %s: неверное окно скорости расходования %q", o.Name, w)
+			}
+			obj.burn = append(obj.burn, d)
+		}
+		for _, a := range o.Alerts {
+			if !slices.Contains(obj.BurnWindows, a.Window) {
+				return nil, fmt.Errorf("цель %s: окно оповещения %q не входит в burn_windows", o.Name, a.Window)
+			}
+			if a.Threshold <= 0 {
+				return nil, fmt.Errorf("цель %s: порог оповещения должен быть больше нуля", o.Name)
+			}
+		}
+
+		// Отсчёты хранятся с шагом, при котором их хватает на окно цели
+		// и на самое короткое окно скорости приходится хотя бы десять отсчётов
+		obj.resolution = obj.window / maxSamples
+		for _, d := range obj.burn {
+			obj.resolution = min(obj.resolution, d/10)
+		}
+		obj.resolution = max(obj.resolution, t.interval)
+		obj.status = Status{Name: o.Name, Target: o.Target, Window: o.Window, BurnRates: map[string]float64{}}
+		t.objectives = append(t.objectives, obj)
+	}
+	return t, nil
+}
+
+// Rules возвращает правила оповещений о скорости расходования бюджета
+// для движка оповещений
+func (t *Tracker) Rules() []alerts.Rule {
+	var rules []alerts.Rule
+	for _, o := range t.objectives {
+		for _, a := range o.Alerts {
+			expr := fmt.Sprintf("gauge %s > %g", burnMetric(o.Name, a.Window), a.Threshold)
+			if a.For != "" {
+				expr += " for " + a.For
+			}
+			rules = append(rules, alerts.Rule{
+				Name:    "slo:" + o.Name + ":" + a.Window,
+				Expr:    expr,
+				Webhook: a.Webhook,
+			})
+		}
+	}
+	return rules
+}
+
+// burnMetric имя gauge скорости расходования бюджета цели name за окно window
+func burnMetric(name, window string) string {
+	return labels.Format(MetricBurnRate, map[string]string{"slo": name, "window": window})
+}
+
+// Run пересчитывает показатели до отмены контекста
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.Evaluate(ctx, now)
+		}
+	}
+}
+
+// Evaluate читает counter целей, пересчитывает и публикует показатели
+func (t *Tracker) Evaluate(ctx context.Context, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	for _, o := range t.objectives {
+		good, errGood := t.source.GetCounter(ctx, o.Good)
+		total, errTotal := t.source.GetCounter(ctx, o.Total)
+		if errors.Is(errGood, storage.ErrNotFound) && errors.Is(errTotal, storage.ErrNotFound) {
+			continue
+		}
+		if err := readError(errGood, errTotal); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		o.observe(now, float64(good), float64(total))
+		errs = append(errs, t.publish(ctx, o))
+	}
+	// Ошибку чтения или записи (например, на реплике только для чтения)
+	// пишем в журнал один раз
+	if err := errors.Join(errs...); err != nil && !t.failed {
+		log.Printf("Не удалось обновить показатели SLO: %v", err)
+		t.failed = true
+	}
+}
+
+// observe добавляет отсчёт и пересчитывает показатели цели
+func (o *objective) observe(now time.Time, good, total float64) {
+	// Уменьшение counter — сброс: прирост считается от нуля
+	if o.started {
+		o.cur.good += increase(o.prevGood, good)
+		o.cur.total += increase(o.prevTotal, total)
+	} else {
+		o.started = true
+		o.status.Since = now
+	}
+	o.cur.t = now
+	o.prevGood, o.prevTotal = good, total
+
+	// Отсчёты сохраняются не чаще resolution; последний из них — начало
+	// коротких окон, а текущие значения — их конец
+	if n := len(o.samples); n == 0 || now.Sub(o.samples[n-1].t) >= o.resolution {
+		o.samples = append(o.samples, o.cur)
+	}
+	// Один отсчёт старше окна нужен как его начало
+	keep := sort.Search(len(o.samples), func(i int) bool { return o.samples[i].t.After(now.Add(-o.window)) })
+	if keep > 1 {
+		o.samples = append(o.samples[:0], o.samples[keep-1:]...)
+	}
+
+	budget := 1 - o.Target
+	g, tot := o.delta(now, o.window)
+	o.status.Good, o.status.Total = g, tot
+	o.status.Compliance, o.status.ErrorBudgetRemaining = nil, nil
+	if tot > 0 {
+		c := g / tot
+		r := 1 - (1-c)/budget
+		o.status.Compliance, o.status.ErrorBudgetRemaining = &c, &r
+	}
+	for i, d := range o.burn {
+		var rate float64
+		if g, tot := o.delta(now, d); tot > 0 {
+			rate = (1 - g/tot) / budget
+		}
+		o.status.BurnRates[o.BurnWindows[i]] = rate
+	}
+}
+
+// readError ошибки чтения counter цели, кроме отсутствия одного из
+// них: такой counter считается нулевым
+func readError(errs ...error) error {
+	var failed []error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			failed = append(failed, err)
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// increase возвращает прирост counter с prev до cur
+func increase(prev, cur float64) float64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// delta возвращает прирост событий за последние d
+func (o *objective) delta(now time.Time, d time.Duration) (good, total float64) {
+	i := sort.Search(len(o.samples), func(i int) bool { return o.samples[i].t.After(now.Add(-d)) })
+	base := o.samples[max(i-1, 0)]
+	return o.cur.good - base.good, o.cur.total - base.total
+}
+
+// publish записывает показатели цели в хранилище
+func (t *Tracker) publish(ctx context.Context, o *objective) error {
+	set := map[string]string{"slo": o.Name}
+	var errs []error
+	if o.status.Compliance != nil {
+		errs = append(errs,
+			t.out.UpdateGauge(ctx, labels.Format(MetricCompliance, set), *o.status.Compliance),
+			t.out.UpdateGauge(ctx, labels.Format(MetricBudget, set), *o.status.ErrorBudgetRemaining))
+	}
+	for w, rate := range o.status.BurnRates {
+		errs = append(errs, t.out.UpdateGauge(ctx, burnMetric(o.Name, w), rate))
+	}
+	return errors.Join(errs...)
+}
+
+// Statuses возвращает показатели целей в порядке их настройки
+func (t *Tracker) Statuses() []Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	statuses := make([]Status, 0, len(t.objectives))
+	for _, o := range t.objectives {
+		s := o.status
+		s.BurnRates = make(map[string]float64, len(o.status.BurnRates))
+		for w, r := range o.status.BurnRates {
+			s.BurnRates[w] = r
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// Handler обработчик GET /admin/slo со списком целей и их показателями
+func (t *Tracker) Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.Statuses())
+}
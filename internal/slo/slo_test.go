@@ -0,0 +1,153 @@
+package slo
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// counters источник значений counter для теста
+type counters map[string]int64
+
+func (c counters) GetCounter(_ context.Context, name string) (int64, error) {
+	v, ok := c[name]
+	if !ok {
+		return 0, storage.ErrNotFound
+	}
+	return v, nil
+}
+
+func TestEvaluate(t *testing.T) {
+	type step struct {
+		// at минута от начала наблюдения
+		at          int
+		good, total int64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		// wantCompliance nil — событий за окно не было
+		wantCompliance *float64
+		wantBurn       float64
+	}{
+		{
+			name:           "цель выполнена ровно",
+			steps:          []step{{0, 0, 0}, {1, 990, 1000}},
+			wantCompliance: ptr(0.99),
+			wantBurn:       1,
+		},
+		{
+			name:           "нет событий",
+			steps:          []step{{0, 0, 0}, {1, 0, 0}},
+			wantCompliance: nil,
+			wantBurn:       0,
+		},
+		{
+			name:           "сброс counter",
+			steps:          []step{{0, 100, 100}, {1, 200, 210}, {2, 50, 60}},
+			wantCompliance: ptr(150.0 / 170),
+			wantBurn:       (1 - 150.0/170) / 0.01,
+		},
+		{
+			name:           "сброс до нуля",
+			steps:          []step{{0, 500, 1000}, {1, 0, 0}, {2, 90, 100}},
+			wantCompliance: ptr(0.9),
+			wantBurn:       10,
+		},
+		{
+			name:           "ошибки вне окна скорости",
+			steps:          []step{{0, 0, 0}, {5, 0, 100}, {30, 1000, 1100}},
+			wantCompliance: ptr(1000.0 / 1100),
+			wantBurn:       0,
+		},
+		{
+			name:           "ошибки вне окна цели",
+			steps:          []step{{0, 0, 0}, {10, 0, 100}, {80, 1000, 1100}},
+			wantCompliance: ptr(1.0),
+			wantBurn:       0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := counters{}
+			out := storage.NewMemStorage()
+			tr, err := New(src, out, Config{Interval: "1m", Objectives: []Objective{{
+				Name: "api", Good: "ok", Total: "all", Target: 0.99, Window: "1h", BurnWindows: []string{"10m"},
+			}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			for _, s := range tt.steps {
+				src["ok"], src["all"] = s.good, s.total
+				tr.Evaluate(ctx, start.Add(time.Duration(s.at)*time.Minute))
+			}
+
+			st := tr.Statuses()[0]
+			switch {
+			case tt.wantCompliance == nil && st.Compliance != nil:
+				t.Errorf("выполнение %v, ожидалось отсутствие", *st.Compliance)
+			case tt.wantCompliance != nil && (st.Compliance == nil || !near(*st.Compliance, *tt.wantCompliance)):
+				t.Errorf("выполнение %v, ожидалось %v", st.Compliance, *tt.wantCompliance)
+			}
+			if !near(st.BurnRates["10m"], tt.wantBurn) {
+				t.Errorf("скорость за 10m %v, ожидалась %v", st.BurnRates["10m"], tt.wantBurn)
+			}
+
+			// Показатели публикуются как gauge
+			set := map[string]string{"slo": "api"}
+			if burn, err := out.GetGauge(ctx, burnMetric("api", "10m")); err != nil || !near(burn, tt.wantBurn) {
+				t.Errorf("%s = %v (%v), ожидалось %v", burnMetric("api", "10m"), burn, err, tt.wantBurn)
+			}
+			if tt.wantCompliance != nil {
+				budget := 1 - (1-*tt.wantCompliance)/0.01
+				name := labels.Format(MetricBudget, set)
+				if got, err := out.GetGauge(ctx, name); err != nil || !near(got, budget) {
+					t.Errorf("%s = %v (%v), ожидалось %v", name, got, err, budget)
+				}
+			}
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	valid := Objective{Name: "api", Good: "ok", Total: "all", Target: 0.99, Window: "30d"}
+	tests := []struct {
+		name   string
+		modify func(o *Objective)
+	}{
+		{name: "имя с меткой", modify: func(o *Objective) { o.Name = "a=b" }},
+		{name: "нет total", modify: func(o *Objective) { o.Total = "" }},
+		{name: "target 1", modify: func(o *Objective) { o.Target = 1 }},
+		{name: "неверное окно", modify: func(o *Objective) { o.Window = "month" }},
+		{name: "окно скорости длиннее окна цели", modify: func(o *Objective) { o.BurnWindows = []string{"31d"} }},
+		{name: "оповещение вне окон скорости", modify: func(o *Objective) { o.Alerts = []BurnAlert{{Window: "5m", Threshold: 14.4}} }},
+		{name: "нулевой порог", modify: func(o *Objective) { o.Alerts = []BurnAlert{{Window: "1h", Threshold: 0}} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := valid
+			tt.modify(&o)
+			if _, err := New(counters{}, storage.NewMemStorage(), Config{Objectives: []Objective{o}}); err == nil {
+				t.Error("ожидалась ошибка")
+			}
+		})
+	}
+	if _, err := New(counters{}, storage.NewMemStorage(), Config{Objectives: []Objective{valid, valid}}); err == nil {
+		t.Error("повторная цель принята")
+	}
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
+
+// near сравнивает значения с точностью до ошибок округления
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
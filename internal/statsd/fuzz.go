@@ -0,0 +1,30 @@
+//go:build gofuzz
+
+package statsd
+
+import (
+	"context"
+
+	"github.com/iliodor1/metrics-service/internal/namepolicy"
+)
+
+// nopStorage хранилище, отбрасывающее метрики
+type nopStorage struct{}
+
+func (nopStorage) UpdateGauge(context.Context, string, float64) error { return nil }
+func (nopStorage) UpdateCounter(context.Context, string, int64) error { return nil }
+func (nopStorage) GetGauge(context.Context, string) (float64, error)  { return 1e308, nil }
+
+// Fuzz точка входа go-fuzz для разбора строк StatsD:
+// go-fuzz-build ./internal/statsd && go-fuzz
+func Fuzz(data []byte) int {
+	policy, err := namepolicy.New(namepolicy.Config{})
+	if err != nil {
+		panic(err)
+	}
+	l := NewListener("", nopStorage{}, policy)
+	if err := l.Apply(context.Background(), string(data)); err != nil {
+		return 0
+	}
+	return 1
+}
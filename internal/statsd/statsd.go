@@ -0,0 +1,141 @@
+// Package statsd принимает метрики по протоколу StatsD через UDP
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/internal/namepolicy"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// maxPacketSize максимальный размер UDP-пакета
+const maxPacketSize = 65535
+
+// Storage хранилище, в которое записываются принятые метрики
+type Storage interface {
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+	GetGauge(ctx context.Context, name string) (float64, error)
+}
+
+// Listener принимает метрики StatsD и сохраняет их в хранилище
+type Listener struct {
+	addr    string
+	storage Storage
+	policy  *namepolicy.Policy
+}
+
+// NewListener создаёт приёмник StatsD на адресе addr. Имена метрик
+// проверяются правилами policy, как и в HTTP API.
+func NewListener(addr string, storage Storage, policy *namepolicy.Policy) *Listener {
+	return &Listener{addr: addr, storage: storage, policy: policy}
+}
+
+// Run принимает пакеты до отмены контекста
+func (l *Listener) Run(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", l.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("Ошибка чтения StatsD: %v", err)
+			continue
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if err := l.Apply(ctx, line); err != nil {
+				log.Printf("Пропущена строка StatsD %q: %v", line, err)
+			}
+		}
+	}
+}
+
+// Apply разбирает строку вида name:value|g или name:delta|c[|@rate]
+// и сохраняет метрику
+func (l *Listener) Apply(ctx context.Context, line string) error {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok {
+		return errors.New("не задано имя метрики")
+	}
+	if err := l.policy.Check(name); err != nil {
+		return err
+	}
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return errors.New("не задан тип метрики")
+	}
+	value, metricType := fields[0], fields[1]
+
+	switch metricType {
+	case "g":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("неверное значение gauge: %w", err)
+		}
+		// Значение со знаком изменяет текущее значение gauge
+		if strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-") {
+			current, err := l.storage.GetGauge(ctx, name)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+			v += current
+		}
+		if err := models.CheckGauge(v); err != nil {
+			return err
+		}
+		return l.storage.UpdateGauge(ctx, name, v)
+	case "c":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("неверное значение counter: %w", err)
+		}
+		rate, err := sampleRate(fields[2:])
+		if err != nil {
+			return err
+		}
+		delta := math.Round(v / rate)
+		// Значения вне диапазона int64 (в том числе NaN и бесконечность) отбрасываются
+		if !(delta >= math.MinInt64 && delta < math.MaxInt64) {
+			return errors.New("значение counter вне диапазона int64")
+		}
+		return l.storage.UpdateCounter(ctx, name, int64(delta))
+	default:
+		return fmt.Errorf("неподдерживаемый тип %q", metricType)
+	}
+}
+
+// sampleRate возвращает частоту выборки из поля вида @0.1
+func sampleRate(fields []string) (float64, error) {
+	for _, f := range fields {
+		if !strings.HasPrefix(f, "@") {
+			continue
+		}
+		rate, err := strconv.ParseFloat(f[1:], 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return 0, fmt.Errorf("неверная частота выборки %q", f)
+		}
+		return rate, nil
+	}
+	return 1, nil
+}
@@ -0,0 +1,71 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/namepolicy"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+func TestApply(t *testing.T) {
+	policy, err := namepolicy.New(namepolicy.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		line     string
+		wantErr  error
+		gauge    string
+		value    float64
+		counter  string
+		delta    int64
+		noWrites bool
+	}{
+		{name: "gauge", line: "cpu:1.5|g", gauge: "cpu", value: 1.5},
+		{name: "counter", line: "hits:3|c", counter: "hits", delta: 3},
+		{name: "counter с частотой", line: "hits:1|c|@0.5", counter: "hits", delta: 2},
+		{name: "пробел в имени", line: "cpu load:1|g", wantErr: models.ErrInvalidName},
+		{name: "перевод строки в имени", line: "cpu\nevent:1|g", wantErr: models.ErrInvalidName},
+		{name: "управляющий символ", line: "cpu\x00:1|g", wantErr: models.ErrInvalidName},
+		{name: "разделитель арендатора", line: "A/cpu:1|g", wantErr: models.ErrInvalidName},
+		{name: "пустое имя", line: ":1|g", noWrites: true},
+		{name: "без типа", line: "cpu:1", noWrites: true},
+		{name: "неизвестный тип", line: "cpu:1|ms", noWrites: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storage.NewMemStorage()
+			ctx := context.Background()
+			err := NewListener("", s, policy).Apply(ctx, tt.line)
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Apply(%q) = %v, ожидалась %v", tt.line, err, tt.wantErr)
+			}
+			if tt.wantErr != nil || tt.noWrites {
+				if err == nil {
+					t.Fatalf("Apply(%q) без ошибки", tt.line)
+				}
+				if gauges, counters, _ := s.GetAll(ctx); len(gauges)+len(counters) != 0 {
+					t.Errorf("записаны метрики %v %v", gauges, counters)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply(%q): %v", tt.line, err)
+			}
+			if tt.gauge != "" {
+				if v, err := s.GetGauge(ctx, tt.gauge); err != nil || v != tt.value {
+					t.Errorf("gauge %s = %v, %v; ожидалось %v", tt.gauge, v, err, tt.value)
+				}
+			}
+			if tt.counter != "" {
+				if d, err := s.GetCounter(ctx, tt.counter); err != nil || d != tt.delta {
+					t.Errorf("counter %s = %v, %v; ожидалось %v", tt.counter, d, err, tt.delta)
+				}
+			}
+		})
+	}
+}
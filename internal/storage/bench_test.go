@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/history"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Тесты производительности хранилищ и снимков. Результаты сравнивает
+// с базовыми значениями cmd/benchcmp.
+
+func BenchmarkMemStorageGauge(b *testing.B) {
+	s := NewMemStorage()
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.UpdateGauge(ctx, "metric", float64(i))
+	}
+}
+
+func BenchmarkMemStorageCounterParallel(b *testing.B) {
+	s := NewMemStorage()
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.UpdateCounter(ctx, "metric", 1)
+		}
+	})
+}
+
+func BenchmarkHistoryStorageGauge(b *testing.B) {
+	s := NewHistory(NewMemStorage(), history.NewStore(1024))
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.UpdateGauge(ctx, "metric", float64(i))
+	}
+}
+
+// storage10k хранилище с 10 000 метрик
+func storage10k() *MemStorage {
+	s := NewMemStorage()
+	ctx := context.Background()
+	for i := 0; i < 5000; i++ {
+		s.UpdateGauge(ctx, fmt.Sprintf("gauge%d", i), float64(i))
+		s.UpdateCounter(ctx, fmt.Sprintf("counter%d", i), int64(i))
+	}
+	return s
+}
+
+func BenchmarkSnapshot10k(b *testing.B) {
+	s := storage10k()
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gauges, counters, _ := s.GetAll(ctx)
+		if _, err := json.Marshal(models.FromMaps(gauges, counters)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSnapshotBinary10k(b *testing.B) {
+	s := storage10k()
+	ctx := context.Background()
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		gauges, counters, _ := s.GetAll(ctx)
+		if err := WriteBinary(&buf, gauges, counters); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRestoreBinary10k(b *testing.B) {
+	var buf bytes.Buffer
+	gauges, counters, _ := storage10k().GetAll(context.Background())
+	if err := WriteBinary(&buf, gauges, counters); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ReadBinary(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+)
+
+// Двоичный формат файлового снимка.
+//
+// Файл начинается с заголовка: magic "MTRCBIN1" и версия формата (uint16).
+// Далее идут блоки:
+//
+//	kind    uint8    тип блока
+//	length  uvarint  длина содержимого
+//	payload [length]byte
+//	crc     uint32   CRC-32 (IEEE) содержимого
+//
+// Блок строк содержит число строк и сами строки с префиксом длины (uvarint).
+// Блок записей содержит число записей и записи с префиксом длины:
+// индекс имени в таблице строк (uvarint), тип (uint8) и значение —
+// 8 байт float64 для gauge или varint для counter.
+// Последний блок — блок конца без содержимого.
+// Блоки неизвестного типа пропускаются, что позволяет добавлять их
+// в следующих версиях без поломки старых читателей.
+// Все числа фиксированной длины записываются в порядке little-endian.
+const (
+	binaryMagic   = "MTRCBIN1"
+	binaryVersion = 1
+
+	blockEnd     = 0
+	blockStrings = 1
+	blockRecords = 2
+
+	// binaryBlockRecords число записей в одном блоке
+	binaryBlockRecords = 4096
+	// maxBlockSize ограничение размера блока при чтении
+	maxBlockSize = 64 << 20
+)
+
+// WriteBinary записывает метрики в двоичный снимок
+func WriteBinary(w io.Writer, gauges map[string]float64, counters map[string]int64) error {
+	// Таблица строк: каждое имя хранится один раз, даже если оно есть у обоих типов
+	names := make([]string, 0, len(gauges)+len(counters))
+	for name := range gauges {
+		names = append(names, name)
+	}
+	for name := range counters {
+		if _, ok := gauges[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, len(binaryMagic)+2)
+	copy(header, binaryMagic)
+	binary.LittleEndian.PutUint16(header[len(binaryMagic):], binaryVersion)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	payload := binary.AppendUvarint(nil, uint64(len(names)))
+	for _, name := range names {
+		payload = binary.AppendUvarint(payload, uint64(len(name)))
+		payload = append(payload, name...)
+	}
+	if err := writeBlock(bw, blockStrings, payload); err != nil {
+		return err
+	}
+
+	// Записи собираются в body, а число записей блока дописывается перед ними
+	var (
+		body  []byte
+		rec   []byte
+		count int
+	)
+	flush := func() error {
+		if count == 0 {
+			return nil
+		}
+		payload = binary.AppendUvarint(payload[:0], uint64(count))
+		payload = append(payload, body...)
+		body, count = body[:0], 0
+		return writeBlock(bw, blockRecords, payload)
+	}
+	for i, name := range names {
+		if v, ok := gauges[name]; ok {
+			rec = binary.AppendUvarint(rec[:0], uint64(i))
+			rec = append(rec, compactGauge)
+			rec = binary.LittleEndian.AppendUint64(rec, math.Float64bits(v))
+			body = append(binary.AppendUvarint(body, uint64(len(rec))), rec...)
+			count++
+		}
+		if v, ok := counters[name]; ok {
+			rec = binary.AppendUvarint(rec[:0], uint64(i))
+			rec = append(rec, compactCounter)
+			rec = binary.AppendVarint(rec, v)
+			body = append(binary.AppendUvarint(body, uint64(len(rec))), rec...)
+			count++
+		}
+		if count >= binaryBlockRecords {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if err := writeBlock(bw, blockEnd, nil); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeBlock записывает блок с префиксом длины и контрольной суммой
+func writeBlock(w *bufio.Writer, kind byte, payload []byte) error {
+	buf := []byte{kind}
+	buf = binary.AppendUvarint(buf, uint64(len(payload)))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, crc32.ChecksumIEEE(payload))
+}
+
+// ReadBinary читает метрики из двоичного снимка
+func ReadBinary(r io.Reader) (map[string]float64, map[string]int64, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(binaryMagic)+2)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(binaryMagic)]) != binaryMagic {
+		return nil, nil, ErrBadSnapshot
+	}
+	if v := binary.LittleEndian.Uint16(header[len(binaryMagic):]); v != binaryVersion {
+		return nil, nil, fmt.Errorf("%w: версия %d не поддерживается", ErrBadSnapshot, v)
+	}
+
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	var names []string
+	for block := 0; ; block++ {
+		kind, payload, err := readBlock(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: блок %d: %v", ErrBadSnapshot, block, err)
+		}
+		switch kind {
+		case blockEnd:
+			return gauges, counters, nil
+		case blockStrings:
+			names, err = decodeStrings(payload)
+		case blockRecords:
+			err = decodeRecords(payload, names, gauges, counters)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: блок %d: %v", ErrBadSnapshot, block, err)
+		}
+	}
+}
+
+// readBlock читает блок и проверяет его контрольную сумму
+func readBlock(br *bufio.Reader) (byte, []byte, error) {
+	kind, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	if size > maxBlockSize {
+		return 0, nil, fmt.Errorf("слишком большой блок: %d байт", size)
+	}
+	buf := make([]byte, size+4)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	payload := buf[:size]
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(buf[size:]) {
+		return 0, nil, errors.New("не совпадает контрольная сумма")
+	}
+	return kind, payload, nil
+}
+
+// unexpectedEOF превращает конец файла посреди снимка в ошибку
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decoder последовательно читает поля из содержимого блока
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) bytes(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// decodeStrings разбирает блок строк
+func decodeStrings(payload []byte) ([]string, error) {
+	d := &decoder{buf: payload}
+	count := d.uvarint()
+	if count > uint64(len(payload)) {
+		return nil, fmt.Errorf("неверное число строк: %d", count)
+	}
+	names := make([]string, 0, count)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		names = append(names, string(d.bytes(d.uvarint())))
+	}
+	return names, d.err
+}
+
+// decodeRecords разбирает блок записей
+func decodeRecords(payload []byte, names []string, gauges map[string]float64, counters map[string]int64) error {
+	d := &decoder{buf: payload}
+	count := d.uvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		rec := &decoder{buf: d.bytes(d.uvarint())}
+		if d.err != nil {
+			break
+		}
+		idx := rec.uvarint()
+		kind := rec.bytes(1)
+		if rec.err != nil {
+			return rec.err
+		}
+		if idx >= uint64(len(names)) {
+			return fmt.Errorf("запись %d ссылается на отсутствующую строку %d", i, idx)
+		}
+		switch kind[0] {
+		case compactGauge:
+			v := rec.bytes(8)
+			if rec.err != nil {
+				return rec.err
+			}
+			gauges[names[idx]] = math.Float64frombits(binary.LittleEndian.Uint64(v))
+		case compactCounter:
+			v, n := binary.Varint(rec.buf)
+			if n <= 0 {
+				return io.ErrUnexpectedEOF
+			}
+			counters[names[idx]] = v
+		default:
+			return fmt.Errorf("запись %d: неизвестный тип %d", i, kind[0])
+		}
+	}
+	return d.err
+}
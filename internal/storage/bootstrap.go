@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// ErrProtected возвращается при удалении обязательной метрики
+var ErrProtected = errors.New("обязательную метрику нельзя удалить")
+
+// Protect исключает метрику из вытеснения при превышении ограничений
+// и запрещает её удаление
+func (m *MemStorage) Protect(mType, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := metricKey{counter: mType == models.Counter, name: name}
+	if m.protected == nil {
+		m.protected = make(map[metricKey]bool)
+	}
+	m.protected[key] = true
+	if e, ok := m.elems[key]; ok {
+		m.lru.Remove(e)
+		delete(m.elems, key)
+	}
+}
+
+// protect защищает метрику в хранилище s, в котором она хранится.
+// Обёртки, реализующие Unwrap, проверяются вместе с обёрнутыми хранилищами;
+// у sharded и хранилищ арендаторов защищается часть, которой принадлежит метрика.
+// Хранилища вне памяти метрики сами не удаляют и защиты не требуют.
+func protect(s Storage, mType, name string) {
+	for {
+		switch st := s.(type) {
+		case *MemStorage:
+			st.Protect(mType, name)
+			return
+		case *Sharded:
+			s = st.pick(name)
+			continue
+		case *Router:
+			s = st.pick(name)
+			continue
+		}
+		u, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			return
+		}
+		s = u.Unwrap()
+	}
+}
+
+// Bootstrap создаёт обязательные метрики, которых нет в хранилище s,
+// с начальными значениями и защищает их от вытеснения и удаления.
+// Метрики, восстановленные из снимка, сохраняют свои значения.
+// Возвращает число созданных метрик.
+func Bootstrap(ctx context.Context, s Storage, metrics []models.Metrics) (int, error) {
+	created := 0
+	for _, m := range metrics {
+		if err := models.Validate(m); err != nil {
+			return created, fmt.Errorf("метрика %s: %w", m.ID, err)
+		}
+		_, err := Get(ctx, s, m.MType, m.ID)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			if err := Update(ctx, s, m); err != nil {
+				return created, fmt.Errorf("метрика %s: %w", m.ID, err)
+			}
+			created++
+		case err != nil:
+			return created, fmt.Errorf("метрика %s: %w", m.ID, err)
+		}
+		protect(s, m.MType, m.ID)
+	}
+	return created, nil
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Формат компактного снимка для отображения в память.
+//
+// Заголовок (32 байта):
+//
+//	magic     [8]byte  "MTRCSNAP"
+//	version   uint16   версия формата
+//	_         [2]byte
+//	count     uint32   число записей
+//	namesSize uint64   размер области имён
+//	_         [8]byte
+//
+// Далее count записей по 24 байта, упорядоченных по имени и типу:
+//
+//	nameOff uint64   смещение имени в области имён
+//	nameLen uint32   длина имени
+//	mtype   uint8    1 — gauge, 2 — counter
+//	_       [3]byte
+//	value   uint64   биты float64 для gauge или int64 для counter
+//
+// и область имён. Все числа записываются в порядке little-endian.
+const (
+	compactMagic      = "MTRCSNAP"
+	compactVersion    = 1
+	compactHeaderSize = 32
+	compactEntrySize  = 24
+
+	compactGauge   = 1
+	compactCounter = 2
+)
+
+// ErrBadSnapshot возвращается для повреждённого или несовместимого снимка
+var ErrBadSnapshot = errors.New("неверный формат снимка")
+
+// compactEntry запись снимка до сериализации
+type compactEntry struct {
+	name  string
+	mtype uint8
+	value uint64
+}
+
+// WriteCompact записывает метрики в компактный снимок
+func WriteCompact(w io.Writer, gauges map[string]float64, counters map[string]int64) error {
+	entries := make([]compactEntry, 0, len(gauges)+len(counters))
+	for name, v := range gauges {
+		entries = append(entries, compactEntry{name, compactGauge, math.Float64bits(v)})
+	}
+	for name, v := range counters {
+		entries = append(entries, compactEntry{name, compactCounter, uint64(v)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].name != entries[j].name {
+			return entries[i].name < entries[j].name
+		}
+		return entries[i].mtype < entries[j].mtype
+	})
+	if uint64(len(entries)) > math.MaxUint32 {
+		return fmt.Errorf("слишком много метрик для снимка: %d", len(entries))
+	}
+
+	var namesSize uint64
+	for _, e := range entries {
+		namesSize += uint64(len(e.name))
+	}
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, compactHeaderSize)
+	copy(header, compactMagic)
+	binary.LittleEndian.PutUint16(header[8:], compactVersion)
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(entries)))
+	binary.LittleEndian.PutUint64(header[16:], namesSize)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	rec := make([]byte, compactEntrySize)
+	var off uint64
+	for _, e := range entries {
+		clear(rec)
+		binary.LittleEndian.PutUint64(rec[0:], off)
+		binary.LittleEndian.PutUint32(rec[8:], uint32(len(e.name)))
+		rec[12] = e.mtype
+		binary.LittleEndian.PutUint64(rec[16:], e.value)
+		if _, err := bw.Write(rec); err != nil {
+			return err
+		}
+		off += uint64(len(e.name))
+	}
+	for _, e := range entries {
+		if _, err := bw.WriteString(e.name); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,37 @@
+package storage
+
+import "context"
+
+// Guarded хранилище, пропускающее обновление метрики, только если его
+// разрешает проверка: например, отклоняющее обновления во время заморозки
+type Guarded struct {
+	Storage
+	check func(name string) error
+}
+
+// NewGuarded оборачивает хранилище s, проверяя имя каждой обновляемой
+// метрики функцией check. Ошибка check возвращается вместо обновления.
+func NewGuarded(s Storage, check func(name string) error) *Guarded {
+	return &Guarded{Storage: s, check: check}
+}
+
+// UpdateGauge обновляет метрику, если проверка это разрешает
+func (s *Guarded) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := s.check(name); err != nil {
+		return err
+	}
+	return s.Storage.UpdateGauge(ctx, name, value)
+}
+
+// UpdateCounter обновляет метрику, если проверка это разрешает
+func (s *Guarded) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	if err := s.check(name); err != nil {
+		return err
+	}
+	return s.Storage.UpdateCounter(ctx, name, delta)
+}
+
+// Unwrap возвращает обёрнутое хранилище
+func (s *Guarded) Unwrap() Storage {
+	return s.Storage
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/history"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// History хранилище, дополнительно записывающее историю значений
+type History struct {
+	Storage
+	history *history.Store
+}
+
+// UpdateGauge обновляет метрику и записывает её значение в историю
+func (s *History) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := s.Storage.UpdateGauge(ctx, name, value); err != nil {
+		return err
+	}
+	s.history.Append(models.Gauge, name, time.Now(), value)
+	return nil
+}
+
+// UpdateCounter обновляет метрику и записывает в историю её итоговое значение
+func (s *History) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	if err := s.Storage.UpdateCounter(ctx, name, delta); err != nil {
+		return err
+	}
+	if value, err := s.Storage.GetCounter(ctx, name); err == nil {
+		s.history.Append(models.Counter, name, time.Now(), float64(value))
+	}
+	return nil
+}
+
+// NewHistory оборачивает хранилище s записью истории значений в hist
+func NewHistory(s Storage, hist *history.Store) *History {
+	return &History{Storage: s, history: hist}
+}
+
+// Unwrap возвращает обёрнутое хранилище
+func (s *History) Unwrap() Storage {
+	return s.Storage
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+
+	"github.com/iliodor1/metrics-service/internal/history"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Ошибки превышения ограничений MemStorage
+var (
+	// ErrTooManyMetrics новая метрика превысила бы наибольшее число метрик
+	ErrTooManyMetrics = errors.New("превышено наибольшее число метрик")
+	// ErrMemoryBudget новая метрика превысила бы бюджет памяти на метрики
+	ErrMemoryBudget = errors.New("превышен бюджет памяти на метрики")
+)
+
+// metricOverhead оценка служебной памяти на одну метрику сверх её имени:
+// записи карты и очереди вытеснения
+const metricOverhead = 112
+
+// Limits ограничения числа метрик MemStorage. Защищают сервер от клиента,
+// который создаёт метрики с новыми именами в каждом запросе.
+type Limits struct {
+	// MaxMetrics наибольшее число метрик обоих типов (0 — без ограничения)
+	MaxMetrics int
+	// MaxBytes бюджет памяти на метрики по оценке размера имён и их истории
+	// (0 — без ограничения)
+	MaxBytes int64
+	// Evict при превышении вытеснять дольше всех не обновлявшиеся метрики
+	// вместо отказа в новой метрике
+	Evict bool
+	// History история значений метрик. Её ряды удаляются вместе с метриками,
+	// а их память учитывается в MaxBytes.
+	History *history.Store
+}
+
+// metricKey метрика в очереди вытеснения
+type metricKey struct {
+	counter bool
+	name    string
+}
+
+// mType тип метрики для истории значений
+func (k metricKey) mType() string {
+	if k.counter {
+		return models.Counter
+	}
+	return models.Gauge
+}
+
+// NewLimitedMemStorage создаёт хранилище метрик в памяти с ограничениями limits
+func NewLimitedMemStorage(limits Limits) *MemStorage {
+	m := NewMemStorage()
+	m.limits = limits
+	if limits.Evict {
+		m.lru = list.New()
+		m.elems = make(map[metricKey]*list.Element)
+	}
+	return m
+}
+
+// metricSize оценка памяти метрики с именем name
+func metricSize(name string) int64 {
+	return int64(len(name)) + metricOverhead
+}
+
+// exceeded возвращает ошибку, если метрика размера size не помещается
+// после added новых метрик общим размером used
+func (m *MemStorage) exceeded(added int, used, size int64) error {
+	if m.limits.MaxMetrics > 0 && len(m.gauges)+len(m.counters)+added >= m.limits.MaxMetrics {
+		return ErrTooManyMetrics
+	}
+	if m.limits.MaxBytes > 0 && m.bytes+m.historyBytes.Load()+used+size > m.limits.MaxBytes {
+		return ErrMemoryBudget
+	}
+	return nil
+}
+
+// admit освобождает место для новой метрики name, вытесняя старые,
+// если это разрешено. Вызывается под блокировкой записи.
+func (m *MemStorage) admit(key metricKey) error {
+	size := metricSize(key.name)
+	for {
+		err := m.exceeded(0, 0, size)
+		if err == nil {
+			break
+		}
+		if m.lru == nil || m.lru.Len() == 0 {
+			return err
+		}
+		m.evict(m.lru.Remove(m.lru.Front()).(metricKey))
+	}
+	m.bytes += size
+	if m.limits.History != nil {
+		m.limits.History.Track(key.mType(), key.name, &m.historyBytes)
+	}
+	return nil
+}
+
+// evict удаляет метрику из хранилища
+func (m *MemStorage) evict(key metricKey) {
+	delete(m.elems, key)
+	if key.counter {
+		delete(m.counters, key.name)
+	} else {
+		delete(m.gauges, key.name)
+	}
+	m.bytes -= metricSize(key.name)
+	if m.limits.History != nil {
+		m.limits.History.Delete(key.mType(), key.name)
+	}
+}
+
+// Admit проверяет, что хранилище примет обновления batch, применённые
+// по порядку: новые метрики уместятся в ограничения, а counter не
+// переполнятся. Хранилище с вытеснением освобождает место само, поэтому
+// проверяет только переполнение.
+func (m *MemStorage) Admit(_ context.Context, batch []models.Metrics) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var (
+		added int
+		used  int64
+		seen  = make(map[metricKey]bool)
+		// totals значения counter после уже проверенных обновлений пакета
+		totals = make(map[string]int64)
+	)
+	for _, u := range batch {
+		key := metricKey{counter: u.MType == models.Counter, name: u.ID}
+		var exists bool
+		switch u.MType {
+		case models.Gauge:
+			_, exists = m.gauges[u.ID]
+		case models.Counter:
+			var current int64
+			current, exists = m.counters[u.ID]
+			if total, ok := totals[u.ID]; ok {
+				current = total
+			}
+			if u.Delta != nil {
+				if addOverflows(current, *u.Delta) {
+					return ErrOverflow
+				}
+				current += *u.Delta
+			}
+			totals[u.ID] = current
+		default:
+			continue
+		}
+		if exists || seen[key] || m.lru != nil {
+			continue
+		}
+		seen[key] = true
+		size := metricSize(u.ID)
+		if err := m.exceeded(added, used, size); err != nil {
+			return err
+		}
+		added++
+		used += size
+		if m.limits.History != nil {
+			used += m.limits.History.SeriesSize(key.mType(), key.name)
+		}
+	}
+	return nil
+}
+
+// touch отмечает обновление метрики в очереди вытеснения
+func (m *MemStorage) touch(key metricKey) {
+	if m.lru == nil || m.protected[key] {
+		return
+	}
+	if e, ok := m.elems[key]; ok {
+		m.lru.MoveToBack(e)
+		return
+	}
+	m.elems[key] = m.lru.PushBack(key)
+}
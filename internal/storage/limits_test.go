@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/history"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+func TestLimitsWithHistory(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		// names метрики gauge в порядке записи, каждая записывается values раз
+		names   []string
+		values  int
+		wantErr error
+		// kept и dropped метрики, история которых должна остаться и быть удалена
+		kept    []string
+		dropped []string
+	}{
+		{
+			name:    "вытеснение удаляет историю",
+			limits:  Limits{MaxMetrics: 2, Evict: true},
+			names:   []string{"a", "b", "c"},
+			values:  1,
+			kept:    []string{"b", "c"},
+			dropped: []string{"a"},
+		},
+		{
+			name:    "история учитывается в бюджете",
+			limits:  Limits{MaxBytes: 3 * (metricOverhead + 1 + 256)},
+			names:   []string{"a", "b", "c"},
+			values:  100,
+			wantErr: ErrMemoryBudget,
+			kept:    []string{"a"},
+		},
+		{
+			name:    "вытеснение ради памяти истории",
+			limits:  Limits{MaxBytes: 3 * (metricOverhead + 1 + 256), Evict: true},
+			names:   []string{"a", "b", "c"},
+			values:  100,
+			kept:    []string{"c"},
+			dropped: []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			hist := history.NewStore(100)
+			tt.limits.History = hist
+			mem := NewLimitedMemStorage(tt.limits)
+			s := NewHistory(mem, hist)
+			var err error
+			for _, name := range tt.names {
+				for i := 0; i < tt.values && err == nil; i++ {
+					err = s.UpdateGauge(ctx, name, float64(i))
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateGauge = %v, ожидалась %v", err, tt.wantErr)
+			}
+			for _, name := range tt.kept {
+				if !hist.Has(models.Gauge, name) {
+					t.Errorf("история %s удалена", name)
+				}
+			}
+			for _, name := range tt.dropped {
+				if hist.Has(models.Gauge, name) {
+					t.Errorf("история %s не удалена", name)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteDropsHistory(t *testing.T) {
+	ctx := context.Background()
+	hist := history.NewStore(10)
+	mem := NewLimitedMemStorage(Limits{History: hist})
+	s := NewHistory(mem, hist)
+	if err := s.UpdateCounter(ctx, "hits", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.DeleteCounter(ctx, "hits"); err != nil {
+		t.Fatal(err)
+	}
+	if hist.Has(models.Counter, "hits") {
+		t.Error("история удалённой метрики осталась")
+	}
+	if n := mem.historyBytes.Load(); n != 0 {
+		t.Errorf("после удаления учтено %d байт истории", n)
+	}
+}
+
+func TestMemStorageAdmit(t *testing.T) {
+	gauge := func(name string) models.Metrics { return models.NewGauge(name, 1) }
+	counter := func(name string, delta int64) models.Metrics { return models.NewCounter(name, delta) }
+	tests := []struct {
+		name   string
+		limits Limits
+		// history записывать ли историю новых метрик
+		history bool
+		batch   []models.Metrics
+		wantErr error
+	}{
+		{
+			name:   "новые метрики помещаются",
+			limits: Limits{MaxMetrics: 4},
+			batch:  []models.Metrics{gauge("a"), counter("b", 1)},
+		},
+		{
+			name:    "новые метрики сверх числа",
+			limits:  Limits{MaxMetrics: 4},
+			batch:   []models.Metrics{gauge("a"), counter("b", 1), gauge("c")},
+			wantErr: ErrTooManyMetrics,
+		},
+		{
+			name:   "повтор метрики в пакете считается один раз",
+			limits: Limits{MaxMetrics: 3},
+			batch:  []models.Metrics{counter("b", 1), counter("b", 2), gauge("cpu")},
+		},
+		{
+			name:    "gauge и counter с одним именем — две метрики",
+			limits:  Limits{MaxMetrics: 3},
+			batch:   []models.Metrics{gauge("a"), counter("a", 1)},
+			wantErr: ErrTooManyMetrics,
+		},
+		{
+			name:    "бюджет памяти",
+			limits:  Limits{MaxBytes: 2*metricOverhead + 6 + metricOverhead + 1},
+			batch:   []models.Metrics{gauge("a"), gauge("b")},
+			wantErr: ErrMemoryBudget,
+		},
+		{
+			name:    "бюджет памяти с историей",
+			limits:  Limits{MaxBytes: 2*metricOverhead + 6 + 2*(metricOverhead+1) + 256},
+			history: true,
+			batch:   []models.Metrics{gauge("a"), gauge("b")},
+			wantErr: ErrMemoryBudget,
+		},
+		{
+			name:   "вытеснение освобождает место",
+			limits: Limits{MaxMetrics: 2, Evict: true},
+			batch:  []models.Metrics{gauge("a"), gauge("b"), gauge("c")},
+		},
+		{
+			name:    "переполнение суммой пакета",
+			batch:   []models.Metrics{counter("hits", math.MaxInt64-10), counter("hits", 1)},
+			wantErr: ErrOverflow,
+		},
+		{
+			name:  "приращения пакета гасят друг друга",
+			batch: []models.Metrics{counter("hits", math.MaxInt64-10), counter("hits", -5), counter("hits", 5)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			limits := tt.limits
+			var hist *history.Store
+			if tt.history {
+				hist = history.NewStore(100)
+				limits.History = hist
+			}
+			mem := NewLimitedMemStorage(limits)
+			// Уже есть две метрики: gauge cpu и counter hits со значением 10
+			if err := mem.UpdateGauge(ctx, "cpu", 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := mem.UpdateCounter(ctx, "hits", 10); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Admit(ctx, NewNotify(mem, func(models.Metrics) {}), tt.batch)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ошибка %v, ожидалась %v", err, tt.wantErr)
+			}
+			// Проверка совпадает с тем, что произойдёт при записи по порядку
+			for _, m := range tt.batch {
+				if applyErr := Update(ctx, mem, m); applyErr != nil {
+					if err == nil {
+						t.Fatalf("пакет принят, но запись %s отклонена: %v", m.ID, applyErr)
+					}
+					return
+				}
+			}
+			if err != nil {
+				t.Fatalf("пакет отклонён с %v, но записан целиком", err)
+			}
+		})
+	}
+}
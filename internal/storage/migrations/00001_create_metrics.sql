@@ -0,0 +1,19 @@
+-- Метрики двух типов хранятся в отдельных таблицах: у gauge и counter
+-- с одним именем разные значения.
+
+-- +goose Up
+CREATE TABLE gauges (
+    name       text PRIMARY KEY,
+    value      double precision NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE counters (
+    name       text PRIMARY KEY,
+    value      bigint NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE counters;
+DROP TABLE gauges;
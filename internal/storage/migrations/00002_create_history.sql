@@ -0,0 +1,16 @@
+-- История значений метрик для GET /query. У counter записывается
+-- итоговое значение после обновления.
+
+-- +goose Up
+CREATE TABLE history (
+    type  text NOT NULL,
+    name  text NOT NULL,
+    ts    timestamptz NOT NULL,
+    value double precision NOT NULL
+);
+
+CREATE INDEX history_series_ts ON history (type, name, ts);
+CREATE INDEX history_ts ON history (ts);
+
+-- +goose Down
+DROP TABLE history;
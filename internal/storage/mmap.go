@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// ErrReadOnly возвращается при попытке изменить хранилище только для чтения
+var ErrReadOnly = errors.New("хранилище доступно только для чтения")
+
+// MmapStorage хранилище только для чтения, которое отображает компактный снимок
+// в память и читает значения прямо из него, не загружая метрики в map.
+// Подходит для реплик, восстанавливающих очень большие наборы метрик.
+type MmapStorage struct {
+	data    []byte
+	count   int
+	names   []byte
+	release func() error
+}
+
+// OpenMmap отображает в память компактный снимок из файла path
+func OpenMmap(path string) (*MmapStorage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, release, err := mapFile(f)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newMmapStorage(data)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	s.release = release
+	return s, nil
+}
+
+// newMmapStorage проверяет заголовок снимка и его записи: ссылки на имена
+// не выходят за область имён, а записи упорядочены по имени и типу, как
+// того требует двоичный поиск. Размеры сравниваются вычитанием, чтобы
+// повреждённый заголовок не вызвал переполнения.
+func newMmapStorage(data []byte) (*MmapStorage, error) {
+	if len(data) < compactHeaderSize || string(data[:8]) != compactMagic {
+		return nil, ErrBadSnapshot
+	}
+	if v := binary.LittleEndian.Uint16(data[8:]); v != compactVersion {
+		return nil, fmt.Errorf("%w: версия %d не поддерживается", ErrBadSnapshot, v)
+	}
+	size := uint64(len(data))
+	count := uint64(binary.LittleEndian.Uint32(data[12:]))
+	namesSize := binary.LittleEndian.Uint64(data[16:])
+	namesStart := compactHeaderSize + count*compactEntrySize
+	if namesStart > size || namesSize != size-namesStart {
+		return nil, fmt.Errorf("%w: размер файла не совпадает с заголовком", ErrBadSnapshot)
+	}
+
+	s := &MmapStorage{data: data, count: int(count), names: data[namesStart:]}
+	for i := 0; i < s.count; i++ {
+		off, n, t, _ := s.entry(i)
+		if off > namesSize || uint64(n) > namesSize-off {
+			return nil, fmt.Errorf("%w: запись %d ссылается за пределы области имён", ErrBadSnapshot, i)
+		}
+		if t != compactGauge && t != compactCounter {
+			return nil, fmt.Errorf("%w: запись %d неизвестного типа %d", ErrBadSnapshot, i, t)
+		}
+		if i > 0 && !s.less(i-1, i) {
+			return nil, fmt.Errorf("%w: записи %d и %d не упорядочены по имени и типу", ErrBadSnapshot, i-1, i)
+		}
+	}
+	return s, nil
+}
+
+// less сообщает, что запись i идёт строго раньше записи j
+func (s *MmapStorage) less(i, j int) bool {
+	if c := bytes.Compare(s.name(i), s.name(j)); c != 0 {
+		return c < 0
+	}
+	_, _, ti, _ := s.entry(i)
+	_, _, tj, _ := s.entry(j)
+	return ti < tj
+}
+
+// Close освобождает отображение файла
+func (s *MmapStorage) Close() error {
+	if s.release == nil {
+		return nil
+	}
+	return s.release()
+}
+
+// entry возвращает поля i-й записи
+func (s *MmapStorage) entry(i int) (nameOff uint64, nameLen uint32, mtype uint8, value uint64) {
+	rec := s.data[compactHeaderSize+i*compactEntrySize:]
+	return binary.LittleEndian.Uint64(rec[0:]), binary.LittleEndian.Uint32(rec[8:]), rec[12], binary.LittleEndian.Uint64(rec[16:])
+}
+
+// name возвращает имя i-й записи без копирования
+func (s *MmapStorage) name(i int) []byte {
+	off, n, _, _ := s.entry(i)
+	return s.names[off : off+uint64(n)]
+}
+
+// find ищет запись двоичным поиском по имени и типу
+func (s *MmapStorage) find(name string, mtype uint8) (uint64, bool) {
+	i := sort.Search(s.count, func(i int) bool {
+		n := string(s.name(i))
+		if n != name {
+			return n > name
+		}
+		_, _, t, _ := s.entry(i)
+		return t >= mtype
+	})
+	if i == s.count || string(s.name(i)) != name {
+		return 0, false
+	}
+	_, _, t, v := s.entry(i)
+	return v, t == mtype
+}
+
+// UpdateGauge недоступно: хранилище только для чтения
+func (s *MmapStorage) UpdateGauge(context.Context, string, float64) error {
+	return ErrReadOnly
+}
+
+// UpdateCounter недоступно: хранилище только для чтения
+func (s *MmapStorage) UpdateCounter(context.Context, string, int64) error {
+	return ErrReadOnly
+}
+
+// GetGauge возвращает значение метрики типа gauge
+func (s *MmapStorage) GetGauge(_ context.Context, name string) (float64, error) {
+	v, ok := s.find(name, compactGauge)
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return math.Float64frombits(v), nil
+}
+
+// GetCounter возвращает значение метрики типа counter
+func (s *MmapStorage) GetCounter(_ context.Context, name string) (int64, error) {
+	v, ok := s.find(name, compactCounter)
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return int64(v), nil
+}
+
+// GetAll возвращает копии всех метрик
+func (s *MmapStorage) GetAll(context.Context) (map[string]float64, map[string]int64, error) {
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	for i := 0; i < s.count; i++ {
+		_, _, t, v := s.entry(i)
+		if t == compactGauge {
+			gauges[string(s.name(i))] = math.Float64frombits(v)
+		} else {
+			counters[string(s.name(i))] = int64(v)
+		}
+	}
+	return gauges, counters, nil
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// compactSnapshot возвращает компактный снимок метрик
+func compactSnapshot(t *testing.T, gauges map[string]float64, counters map[string]int64) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteCompact(&buf, gauges, counters); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMmapStorageRead(t *testing.T) {
+	data := compactSnapshot(t,
+		map[string]float64{"cpu": 0.5, "x": -1, "температура": 21.5},
+		map[string]int64{"hits": math.MaxInt64, "x": 3})
+	s, err := newMmapStorage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		get     func() (float64, error)
+		want    float64
+		wantErr error
+	}{
+		{name: "gauge", get: func() (float64, error) { return s.GetGauge(ctx, "cpu") }, want: 0.5},
+		{name: "gauge UTF-8", get: func() (float64, error) { return s.GetGauge(ctx, "температура") }, want: 21.5},
+		{name: "gauge с именем counter", get: func() (float64, error) { return s.GetGauge(ctx, "x") }, want: -1},
+		{name: "counter с именем gauge", get: func() (float64, error) {
+			v, err := s.GetCounter(ctx, "x")
+			return float64(v), err
+		}, want: 3},
+		{name: "нет gauge с именем counter", get: func() (float64, error) { return s.GetGauge(ctx, "hits") }, wantErr: ErrNotFound},
+		{name: "нет метрики", get: func() (float64, error) { return s.GetGauge(ctx, "mem") }, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := tt.get()
+			if !errors.Is(err, tt.wantErr) || v != tt.want {
+				t.Errorf("= %v, %v, ожидалось %v, %v", v, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+	if err := s.UpdateGauge(ctx, "cpu", 1); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("UpdateGauge: ошибка %v, ожидалась %v", err, ErrReadOnly)
+	}
+}
+
+func TestMmapStorageCorrupt(t *testing.T) {
+	good := compactSnapshot(t, map[string]float64{"a": 1, "b": 2}, map[string]int64{"c": 3})
+	// corrupt возвращает копию снимка, изменённую fn
+	corrupt := func(fn func(data []byte) []byte) []byte {
+		return fn(append([]byte(nil), good...))
+	}
+	// entry возвращает i-ю запись снимка data
+	entry := func(data []byte, i int) []byte {
+		return data[compactHeaderSize+i*compactEntrySize:][:compactEntrySize]
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "короче заголовка", data: good[:compactHeaderSize-1]},
+		{name: "чужая сигнатура", data: corrupt(func(d []byte) []byte { d[0] = 'X'; return d })},
+		{name: "неизвестная версия", data: corrupt(func(d []byte) []byte {
+			binary.LittleEndian.PutUint16(d[8:], compactVersion+1)
+			return d
+		})},
+		{name: "обрезанный", data: good[:len(good)-1]},
+		{name: "записи за концом файла", data: corrupt(func(d []byte) []byte {
+			binary.LittleEndian.PutUint32(d[12:], 1000)
+			return d
+		})},
+		{
+			// Сумма начала и размера области имён переполняется и совпадает
+			// с длиной заголовка
+			name: "переполнение размера области имён",
+			data: func() []byte {
+				d := make([]byte, compactHeaderSize)
+				copy(d, compactMagic)
+				binary.LittleEndian.PutUint16(d[8:], compactVersion)
+				binary.LittleEndian.PutUint32(d[12:], 1000)
+				binary.LittleEndian.PutUint64(d[16:], math.MaxUint64-1000*compactEntrySize+1)
+				return d
+			}(),
+		},
+		{name: "переполнение смещения имени", data: corrupt(func(d []byte) []byte {
+			binary.LittleEndian.PutUint64(entry(d, 1), math.MaxUint64)
+			return d
+		})},
+		{name: "имя за областью имён", data: corrupt(func(d []byte) []byte {
+			binary.LittleEndian.PutUint32(entry(d, 2)[8:], 2)
+			return d
+		})},
+		{name: "неизвестный тип", data: corrupt(func(d []byte) []byte {
+			entry(d, 0)[12] = 7
+			return d
+		})},
+		{name: "записи не по порядку", data: corrupt(func(d []byte) []byte {
+			first := append([]byte(nil), entry(d, 0)...)
+			copy(entry(d, 0), entry(d, 1))
+			copy(entry(d, 1), first)
+			return d
+		})},
+		{name: "повторяется запись", data: corrupt(func(d []byte) []byte {
+			copy(entry(d, 1), entry(d, 0))
+			return d
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newMmapStorage(tt.data); !errors.Is(err, ErrBadSnapshot) {
+				t.Errorf("ошибка %v, ожидалась %v", err, ErrBadSnapshot)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Notify хранилище, сообщающее о каждом принятом обновлении метрики
+type Notify struct {
+	Storage
+	publish func(models.Metrics)
+}
+
+// UpdateGauge обновляет метрику и сообщает её новое значение
+func (s *Notify) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := s.Storage.UpdateGauge(ctx, name, value); err != nil {
+		return err
+	}
+	s.publish(models.NewGauge(name, value))
+	return nil
+}
+
+// UpdateCounter обновляет метрику и сообщает её итоговое значение
+func (s *Notify) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	if err := s.Storage.UpdateCounter(ctx, name, delta); err != nil {
+		return err
+	}
+	if value, err := s.Storage.GetCounter(ctx, name); err == nil {
+		s.publish(models.NewCounter(name, value))
+	}
+	return nil
+}
+
+// NewNotify оборачивает хранилище s, вызывая publish после каждого обновления
+func NewNotify(s Storage, publish func(models.Metrics)) *Notify {
+	return &Notify{Storage: s, publish: publish}
+}
+
+// Unwrap возвращает обёрнутое хранилище
+func (s *Notify) Unwrap() Storage {
+	return s.Storage
+}
@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/history"
+	"github.com/iliodor1/metrics-service/pkg/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// postgresTimeout ограничение времени одной операции хранилища PostgreSQL
+const postgresTimeout = 5 * time.Second
+
+// Коды ошибок PostgreSQL, которые переводятся в ошибки хранилища
+const (
+	// pgNumericOutOfRange значение counter вышло за пределы bigint
+	pgNumericOutOfRange = "22003"
+	// pgReadOnlyTransaction запись на реплику только для чтения
+	pgReadOnlyTransaction = "25006"
+)
+
+// Запросы обновления метрик, возвращающие итоговое значение
+const (
+	upsertGauge = `
+		INSERT INTO gauges (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+		RETURNING value`
+	upsertCounter = `
+		INSERT INTO counters (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = counters.value + EXCLUDED.value, updated_at = now()
+		RETURNING value`
+)
+
+// migrations схема базы: файлы goose с номерами версий по порядку.
+// Применённые версии goose отмечает в таблице goose_db_version.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// PostgresStorage хранилище в PostgreSQL, общее для нескольких реплик
+// сервера. Gauge хранятся в таблице gauges, counter — в таблице counters
+// и увеличиваются атомарно в одном запросе INSERT … ON CONFLICT.
+// С включённой историей итоговое значение каждого обновления тем же
+// запросом добавляется в таблицу history.
+type PostgresStorage struct {
+	db *sql.DB
+	// history записывать ли значения в таблицу history
+	history bool
+}
+
+// NewPostgresStorage подключается к PostgreSQL по строке dsn и проверяет
+// соединение. Схема не создаётся: её обновляет Migrate.
+func NewPostgresStorage(ctx context.Context, dsn string) (*PostgresStorage, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &PostgresStorage{db: db}
+	if err := s.Ping(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Migrate применяет к базе встроенные миграции, которых в ней ещё нет,
+// и возвращает имена применённых файлов. Серверы, запущенные одновременно,
+// применяют миграции по очереди под рекомендательной блокировкой.
+func (s *PostgresStorage) Migrate(ctx context.Context) ([]string, error) {
+	p, err := newMigrator(s.db)
+	if err != nil {
+		return nil, err
+	}
+	results, err := p.Up(ctx)
+	applied := make([]string, 0, len(results))
+	for _, r := range results {
+		if r.Error == nil {
+			applied = append(applied, r.Source.Path)
+		}
+	}
+	return applied, err
+}
+
+// newMigrator создаёт исполнителя встроенных миграций для базы db
+func newMigrator(db *sql.DB) (*goose.Provider, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, fsys, goose.WithSessionLocker(locker))
+}
+
+// EnableHistory включает запись значений метрик в таблицу history.
+// Вызывается до начала обслуживания запросов.
+func (s *PostgresStorage) EnableHistory() {
+	s.history = true
+}
+
+// Close закрывает соединения с PostgreSQL
+func (s *PostgresStorage) Close() error {
+	return s.db.Close()
+}
+
+// Ping проверяет доступность PostgreSQL
+func (s *PostgresStorage) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, postgresTimeout)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+// exec выполняет запрос, ограничивая его время postgresTimeout
+func (s *PostgresStorage) exec(ctx context.Context, name, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, postgresTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return postgresError(err, name)
+}
+
+// upsert выполняет запрос обновления метрики типа mType и, если история
+// включена, добавляет итоговое значение в таблицу history
+func (s *PostgresStorage) upsert(ctx context.Context, mType, query, name string, value any) error {
+	if s.history {
+		query = `WITH m AS (` + query + `)
+			INSERT INTO history (type, name, ts, value) SELECT $3::text, $1, now(), value FROM m`
+		return s.exec(ctx, name, query, name, value, mType)
+	}
+	return s.exec(ctx, name, query, name, value)
+}
+
+// UpdateGauge устанавливает значение метрики типа gauge
+func (s *PostgresStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	return s.upsert(ctx, models.Gauge, upsertGauge, name, value)
+}
+
+// UpdateCounter атомарно увеличивает метрику типа counter
+func (s *PostgresStorage) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	return s.upsert(ctx, models.Counter, upsertCounter, name, delta)
+}
+
+// DeleteGauge удаляет метрику типа gauge, если она есть
+func (s *PostgresStorage) DeleteGauge(ctx context.Context, name string) error {
+	return s.exec(ctx, name, `DELETE FROM gauges WHERE name = $1`, name)
+}
+
+// DeleteCounter удаляет метрику типа counter, если она есть
+func (s *PostgresStorage) DeleteCounter(ctx context.Context, name string) error {
+	return s.exec(ctx, name, `DELETE FROM counters WHERE name = $1`, name)
+}
+
+// postgresError переводит ошибку PostgreSQL в ошибку хранилища:
+// переполнение bigint и запись на реплику только для чтения
+func postgresError(err error, name string) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case pgNumericOutOfRange:
+		return fmt.Errorf("%w: %s", ErrOverflow, name)
+	case pgReadOnlyTransaction:
+		return fmt.Errorf("%w: %s", ErrReadOnly, name)
+	}
+	return err
+}
+
+// GetGauge возвращает значение метрики типа gauge
+func (s *PostgresStorage) GetGauge(ctx context.Context, name string) (float64, error) {
+	var v float64
+	err := s.get(ctx, &v, `SELECT value FROM gauges WHERE name = $1`, name)
+	return v, err
+}
+
+// GetCounter возвращает значение метрики типа counter
+func (s *PostgresStorage) GetCounter(ctx context.Context, name string) (int64, error) {
+	var v int64
+	err := s.get(ctx, &v, `SELECT value FROM counters WHERE name = $1`, name)
+	return v, err
+}
+
+// get читает значение одной метрики; отсутствующая метрика — ErrNotFound
+func (s *PostgresStorage) get(ctx context.Context, dest any, query, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, postgresTimeout)
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, query, name).Scan(dest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка чтения из PostgreSQL: %w", err)
+	}
+	return nil
+}
+
+// GetAll возвращает все метрики
+func (s *PostgresStorage) GetAll(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, postgresTimeout)
+	defer cancel()
+	gauges := make(map[string]float64)
+	if err := s.query(ctx, `SELECT name, value FROM gauges`, func(rows *sql.Rows) error {
+		var (
+			name  string
+			value float64
+		)
+		if err := rows.Scan(&name, &value); err != nil {
+			return err
+		}
+		gauges[name] = value
+		return nil
+	}); err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения из PostgreSQL: %w", err)
+	}
+	counters := make(map[string]int64)
+	if err := s.query(ctx, `SELECT name, value FROM counters`, func(rows *sql.Rows) error {
+		var (
+			name  string
+			value int64
+		)
+		if err := rows.Scan(&name, &value); err != nil {
+			return err
+		}
+		counters[name] = value
+		return nil
+	}); err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения из PostgreSQL: %w", err)
+	}
+	return gauges, counters, nil
+}
+
+// query выполняет запрос и передаёт scan каждую строку результата
+func (s *PostgresStorage) query(ctx context.Context, query string, scan func(rows *sql.Rows) error, args ...any) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// LoadHistory передаёт fn по порядку времени не больше limit последних
+// значений каждого ряда из таблицы history, записанных не раньше since
+func (s *PostgresStorage) LoadHistory(ctx context.Context, limit int, since time.Time, fn func(mType, name string, sample history.Sample)) error {
+	err := s.query(ctx, `
+		SELECT type, name, ts, value FROM (
+			SELECT type, name, ts, value,
+				row_number() OVER (PARTITION BY type, name ORDER BY ts DESC) AS n
+			FROM history WHERE ts >= $2
+		) h WHERE n <= $1 ORDER BY ts`, func(rows *sql.Rows) error {
+		var (
+			mType, name string
+			sample      history.Sample
+		)
+		if err := rows.Scan(&mType, &name, &sample.Timestamp, &sample.Value); err != nil {
+			return err
+		}
+		fn(mType, name, sample)
+		return nil
+	}, limit, since)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения истории из PostgreSQL: %w", err)
+	}
+	return nil
+}
+
+// PruneHistory удаляет из таблицы history значения, записанные раньше before,
+// и возвращает их число
+func (s *PostgresStorage) PruneHistory(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, postgresTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM history WHERE ts < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
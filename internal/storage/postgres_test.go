@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/history"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestPostgresError(t *testing.T) {
+	other := errors.New("соединение разорвано")
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+		// wantPgErr ошибка PostgreSQL передаётся как есть
+		wantPgErr bool
+	}{
+		{name: "без ошибки"},
+		{name: "переполнение bigint", err: &pgconn.PgError{Code: pgNumericOutOfRange}, wantErr: ErrOverflow},
+		{name: "реплика только для чтения", err: fmt.Errorf("exec: %w", &pgconn.PgError{Code: pgReadOnlyTransaction}), wantErr: ErrReadOnly},
+		{name: "другая ошибка PostgreSQL", err: &pgconn.PgError{Code: "42P01"}, wantPgErr: true},
+		{name: "не ошибка PostgreSQL", err: other, wantErr: other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := postgresError(tt.err, "hits")
+			if tt.wantPgErr {
+				var pgErr *pgconn.PgError
+				if !errors.As(err, &pgErr) {
+					t.Fatalf("ошибка %v, ожидалась ошибка PostgreSQL", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ошибка %v, ожидалась %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	// Соединение не открывается, пока к базе нет запросов
+	db, err := sql.Open("pgx", "postgres://localhost:1/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	p, err := newMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := p.ListSources()
+	if len(sources) == 0 {
+		t.Fatal("нет встроенных миграций")
+	}
+	for i, src := range sources {
+		if src.Version != int64(i+1) {
+			t.Errorf("миграция %s версии %d, ожидалась %d: версии идут по порядку без пропусков", src.Path, src.Version, i+1)
+		}
+	}
+}
+
+// TestPostgresStorage проверяет хранилище на настоящей базе, строка
+// подключения к которой задана в TEST_DATABASE_DSN. Таблицы базы удаляются.
+func TestPostgresStorage(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN не задана")
+	}
+	ctx := context.Background()
+	s, err := NewPostgresStorage(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, table := range []string{"gauges", "counters", "history", "goose_db_version"} {
+		if _, err := s.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	applied, err := s.Migrate(ctx)
+	if err != nil || len(applied) == 0 {
+		t.Fatalf("Migrate() = %v, %v", applied, err)
+	}
+	if applied, err := s.Migrate(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("повторный Migrate() = %v, %v: миграции применены дважды", applied, err)
+	}
+	s.EnableHistory()
+
+	tests := []struct {
+		name    string
+		op      func() error
+		wantErr error
+	}{
+		{name: "запись gauge", op: func() error { return s.UpdateGauge(ctx, "cpu", 1.5) }},
+		{name: "перезапись gauge", op: func() error { return s.UpdateGauge(ctx, "cpu", 2.5) }},
+		{name: "counter у предела", op: func() error { return s.UpdateCounter(ctx, "hits", math.MaxInt64-1) }},
+		{name: "приращение counter", op: func() error { return s.UpdateCounter(ctx, "hits", 1) }},
+		{name: "переполнение counter", op: func() error { return s.UpdateCounter(ctx, "hits", 1) }, wantErr: ErrOverflow},
+		{name: "нет counter с именем gauge", op: func() error {
+			_, err := s.GetCounter(ctx, "cpu")
+			return err
+		}, wantErr: ErrNotFound},
+		{name: "удаление отсутствующей метрики", op: func() error { return s.DeleteGauge(ctx, "missing") }},
+	}
+	for _, tt := range tests {
+		if err := tt.op(); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: ошибка %v, ожидалась %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if err := probePostgres(ctx, s); err != nil {
+		t.Error(err)
+	}
+
+	gauges, counters, err := s.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gauges) != 1 || gauges["cpu"] != 2.5 || len(counters) != 1 || counters["hits"] != math.MaxInt64 {
+		t.Errorf("GetAll() = %v, %v", gauges, counters)
+	}
+
+	// В истории по два последних значения каждого ряда; отклонённое
+	// обновление в неё не попало
+	got := map[string][]float64{}
+	if err := s.LoadHistory(ctx, 2, time.Time{}, func(mType, name string, sample history.Sample) {
+		got[mType+"/"+name] = append(got[mType+"/"+name], sample.Value)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]float64{
+		"gauge/cpu":    {1.5, 2.5},
+		"counter/hits": {math.MaxInt64 - 1, math.MaxInt64},
+	}
+	for series, values := range want {
+		if fmt.Sprint(got[series]) != fmt.Sprint(values) {
+			t.Errorf("история %s = %v, ожидалась %v", series, got[series], values)
+		}
+	}
+	if n, err := s.PruneHistory(ctx, time.Now().Add(time.Minute)); err != nil || n == 0 {
+		t.Errorf("PruneHistory() = %d, %v", n, err)
+	}
+}
+
+// probePostgres записывает, читает и удаляет пробную метрику
+func probePostgres(ctx context.Context, s *PostgresStorage) error {
+	if err := s.UpdateCounter(ctx, "probe", 3); err != nil {
+		return err
+	}
+	if v, err := s.GetCounter(ctx, "probe"); err != nil || v != 3 {
+		return fmt.Errorf("GetCounter() = %d, %v", v, err)
+	}
+	if err := s.DeleteCounter(ctx, "probe"); err != nil {
+		return err
+	}
+	if _, err := s.GetCounter(ctx, "probe"); !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("после удаления: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import "context"
+
+// ReadOnly хранилище, отклоняющее обновления: чтение передаётся
+// обёрнутому хранилищу, которое изменяется только в обход обёртки
+type ReadOnly struct {
+	Storage
+}
+
+// NewReadOnly оборачивает хранилище s, запрещая его обновление
+func NewReadOnly(s Storage) *ReadOnly {
+	return &ReadOnly{Storage: s}
+}
+
+// UpdateGauge недоступно: хранилище только для чтения
+func (s *ReadOnly) UpdateGauge(context.Context, string, float64) error {
+	return ErrReadOnly
+}
+
+// UpdateCounter недоступно: хранилище только для чтения
+func (s *ReadOnly) UpdateCounter(context.Context, string, int64) error {
+	return ErrReadOnly
+}
+
+// Unwrap возвращает обёрнутое хранилище
+func (s *ReadOnly) Unwrap() Storage {
+	return s.Storage
+}
+
+// IsReadOnly сообщает, отклоняет ли хранилище s обновления.
+// Обёртки, реализующие Unwrap, проверяются вместе с обёрнутыми хранилищами.
+func IsReadOnly(s Storage) bool {
+	for {
+		switch s.(type) {
+		case *ReadOnly, *MmapStorage:
+			return true
+		}
+		u, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			return false
+		}
+		s = u.Unwrap()
+	}
+}
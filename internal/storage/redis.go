@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/redis"
+)
+
+// redisTimeout ограничение времени одной операции хранилища Redis
+const redisTimeout = 5 * time.Second
+
+// RedisStorage хранилище в Redis, общее для нескольких реплик сервера.
+// Gauge хранятся в хеше <prefix>gauges, counter — в хеше <prefix>counters
+// и увеличиваются атомарно командой HINCRBY.
+type RedisStorage struct {
+	client   *redis.Client
+	gauges   string
+	counters string
+}
+
+// NewRedisStorage подключается к Redis и проверяет соединение
+func NewRedisStorage(ctx context.Context, opts redis.Options, prefix string) (*RedisStorage, error) {
+	s := &RedisStorage{
+		client:   redis.New(opts),
+		gauges:   prefix + "gauges",
+		counters: prefix + "counters",
+	}
+	if err := s.Ping(ctx); err != nil {
+		s.client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close закрывает соединения с Redis
+func (s *RedisStorage) Close() error {
+	return s.client.Close()
+}
+
+// Ping проверяет доступность Redis
+func (s *RedisStorage) Ping(ctx context.Context) error {
+	_, err := s.client.Do(ctx, "PING")
+	return err
+}
+
+// do выполняет команду, ограничивая её время redisTimeout
+func (s *RedisStorage) do(ctx context.Context, args ...string) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+	return s.client.Do(ctx, args...)
+}
+
+// UpdateGauge устанавливает значение метрики типа gauge
+func (s *RedisStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	_, err := s.do(ctx, "HSET", s.gauges, name, strconv.FormatFloat(value, 'g', -1, 64))
+	return storageError(err, name)
+}
+
+// UpdateCounter атомарно увеличивает метрику типа counter
+func (s *RedisStorage) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	_, err := s.do(ctx, "HINCRBY", s.counters, name, strconv.FormatInt(delta, 10))
+	return storageError(err, name)
+}
+
+// DeleteGauge удаляет метрику типа gauge, если она есть
+func (s *RedisStorage) DeleteGauge(ctx context.Context, name string) error {
+	_, err := s.do(ctx, "HDEL", s.gauges, name)
+	return storageError(err, name)
+}
+
+// DeleteCounter удаляет метрику типа counter, если она есть
+func (s *RedisStorage) DeleteCounter(ctx context.Context, name string) error {
+	_, err := s.do(ctx, "HDEL", s.counters, name)
+	return storageError(err, name)
+}
+
+// storageError переводит ошибку Redis в ошибку хранилища: переполнение
+// HINCRBY и ошибки с кодами общего хранилища (READONLY реплики Redis
+// тоже означает хранилище только для чтения)
+func storageError(err error, name string) error {
+	var rerr redis.Error
+	if !errors.As(err, &rerr) {
+		return err
+	}
+	if strings.Contains(string(rerr), "overflow") {
+		return fmt.Errorf("%w: %s", ErrOverflow, name)
+	}
+	code, _, _ := strings.Cut(string(rerr), " ")
+	if e, ok := sharedErrors[code]; ok {
+		return fmt.Errorf("%w: %s", e, name)
+	}
+	return err
+}
+
+// GetGauge возвращает значение метрики типа gauge
+func (s *RedisStorage) GetGauge(ctx context.Context, name string) (float64, error) {
+	raw, err := s.get(ctx, s.gauges, name)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("неверное значение gauge %s в Redis: %w", name, err)
+	}
+	return v, nil
+}
+
+// GetCounter возвращает значение метрики типа counter
+func (s *RedisStorage) GetCounter(ctx context.Context, name string) (int64, error) {
+	raw, err := s.get(ctx, s.counters, name)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("неверное значение counter %s в Redis: %w", name, err)
+	}
+	return v, nil
+}
+
+// get читает поле хеша; отсутствующее поле — ErrNotFound
+func (s *RedisStorage) get(ctx context.Context, key, field string) (string, error) {
+	reply, err := s.do(ctx, "HGET", key, field)
+	if errors.Is(err, redis.ErrNil) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения из Redis: %w", err)
+	}
+	b, ok := reply.([]byte)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return string(b), nil
+}
+
+// GetAll возвращает все метрики. Поля с неверными значениями пропускаются.
+func (s *RedisStorage) GetAll(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	rawGauges, err := s.hash(ctx, s.gauges)
+	if err != nil {
+		return nil, nil, err
+	}
+	rawCounters, err := s.hash(ctx, s.counters)
+	if err != nil {
+		return nil, nil, err
+	}
+	gauges := make(map[string]float64, len(rawGauges))
+	counters := make(map[string]int64, len(rawCounters))
+	for field, raw := range rawGauges {
+		if v, err := strconv.ParseFloat(raw, 64); err == nil {
+			gauges[field] = v
+		}
+	}
+	for field, raw := range rawCounters {
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			counters[field] = v
+		}
+	}
+	return gauges, counters, nil
+}
+
+// hash читает хеш целиком
+func (s *RedisStorage) hash(ctx context.Context, key string) (map[string]string, error) {
+	reply, err := s.do(ctx, "HGETALL", key)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения из Redis: %w", err)
+	}
+	items, _ := reply.([]any)
+	fields := make(map[string]string, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		k, _ := items[i].([]byte)
+		v, _ := items[i+1].([]byte)
+		fields[string(k)] = string(v)
+	}
+	return fields, nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Router направляет метрики в хранилища по первой части имени до разделителя,
+// например по арендатору в имени team-a/cpu. Остальные метрики хранятся в общем хранилище.
+type Router struct {
+	def    Storage
+	sep    string
+	routes map[string]Storage
+}
+
+// NewRouter создаёт маршрутизатор с общим хранилищем def и разделителем sep
+func NewRouter(def Storage, sep string) *Router {
+	return &Router{def: def, sep: sep, routes: make(map[string]Storage)}
+}
+
+// Route направляет метрики с первой частью имени prefix в хранилище s
+func (r *Router) Route(prefix string, s Storage) {
+	r.routes[prefix] = s
+}
+
+// pick возвращает хранилище для метрики name
+func (r *Router) pick(name string) Storage {
+	if prefix, _, ok := strings.Cut(name, r.sep); ok {
+		if s, ok := r.routes[prefix]; ok {
+			return s
+		}
+	}
+	return r.def
+}
+
+// UpdateGauge обновляет метрику в её хранилище
+func (r *Router) UpdateGauge(ctx context.Context, name string, value float64) error {
+	return r.pick(name).UpdateGauge(ctx, name, value)
+}
+
+// UpdateCounter обновляет метрику в её хранилище
+func (r *Router) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	return r.pick(name).UpdateCounter(ctx, name, delta)
+}
+
+// GetGauge возвращает значение метрики из её хранилища
+func (r *Router) GetGauge(ctx context.Context, name string) (float64, error) {
+	return r.pick(name).GetGauge(ctx, name)
+}
+
+// GetCounter возвращает значение метрики из её хранилища
+func (r *Router) GetCounter(ctx context.Context, name string) (int64, error) {
+	return r.pick(name).GetCounter(ctx, name)
+}
+
+// GetAll объединяет метрики всех хранилищ
+func (r *Router) GetAll(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	gauges, counters, err := r.def.GetAll(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, s := range r.routes {
+		g, c, err := s.GetAll(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		for name, v := range g {
+			gauges[name] = v
+		}
+		for name, v := range c {
+			counters[name] = v
+		}
+	}
+	return gauges, counters, nil
+}
+
+// Ping проверяет доступность всех хранилищ
+func (r *Router) Ping(ctx context.Context) error {
+	errs := []error{Ping(ctx, r.def)}
+	for _, s := range r.routes {
+		errs = append(errs, Ping(ctx, s))
+	}
+	return errors.Join(errs...)
+}
+
+// Admit проверяет пакет в хранилищах его метрик
+func (r *Router) Admit(ctx context.Context, batch []models.Metrics) error {
+	return admitParts(ctx, batch, r.pick)
+}
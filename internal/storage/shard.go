@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/iliodor1/metrics-service/internal/hashring"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Sharded распределяет метрики между хранилищами по согласованному хешу
+// имени (см. пакет hashring)
+type Sharded struct {
+	shards []Storage
+	ring   *hashring.Ring
+}
+
+// NewSharded создаёт хранилище из частей shards. names — постоянные имена
+// частей: положение части на кольце зависит только от её имени, поэтому
+// порядок частей в настройках можно менять.
+func NewSharded(names []string, shards []Storage) (*Sharded, error) {
+	if len(shards) == 0 || len(names) != len(shards) {
+		return nil, errors.New("для каждой части хранилища нужно имя")
+	}
+	ring, err := hashring.New(names)
+	if err != nil {
+		return nil, err
+	}
+	return &Sharded{shards: shards, ring: ring}, nil
+}
+
+// Shard возвращает номер части, в которой хранится метрика name
+func (s *Sharded) Shard(name string) int {
+	return s.ring.Part(name)
+}
+
+// pick возвращает хранилище для метрики name
+func (s *Sharded) pick(name string) Storage {
+	return s.shards[s.Shard(name)]
+}
+
+// UpdateGauge обновляет метрику в её части
+func (s *Sharded) UpdateGauge(ctx context.Context, name string, value float64) error {
+	return s.pick(name).UpdateGauge(ctx, name, value)
+}
+
+// UpdateCounter обновляет метрику в её части
+func (s *Sharded) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	return s.pick(name).UpdateCounter(ctx, name, delta)
+}
+
+// GetGauge возвращает значение метрики из её части
+func (s *Sharded) GetGauge(ctx context.Context, name string) (float64, error) {
+	return s.pick(name).GetGauge(ctx, name)
+}
+
+// GetCounter возвращает значение метрики из её части
+func (s *Sharded) GetCounter(ctx context.Context, name string) (int64, error) {
+	return s.pick(name).GetCounter(ctx, name)
+}
+
+// GetAll параллельно читает все части и объединяет их метрики
+func (s *Sharded) GetAll(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	type part struct {
+		gauges   map[string]float64
+		counters map[string]int64
+		err      error
+	}
+	parts := make([]part, len(s.shards))
+	var wg sync.WaitGroup
+	for i, shard := range s.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parts[i].gauges, parts[i].counters, parts[i].err = shard.GetAll(ctx)
+		}()
+	}
+	wg.Wait()
+	for _, p := range parts {
+		if p.err != nil {
+			return nil, nil, p.err
+		}
+	}
+
+	gauges, counters := parts[0].gauges, parts[0].counters
+	for _, p := range parts[1:] {
+		for name, v := range p.gauges {
+			gauges[name] = v
+		}
+		for name, v := range p.counters {
+			counters[name] = v
+		}
+	}
+	return gauges, counters, nil
+}
+
+// Ping проверяет доступность всех частей
+func (s *Sharded) Ping(ctx context.Context) error {
+	errs := make([]error, 0, len(s.shards))
+	for _, shard := range s.shards {
+		errs = append(errs, Ping(ctx, shard))
+	}
+	return errors.Join(errs...)
+}
+
+// Admit проверяет пакет в частях его метрик
+func (s *Sharded) Admit(ctx context.Context, batch []models.Metrics) error {
+	return admitParts(ctx, batch, s.pick)
+}
@@ -0,0 +1,26 @@
+package storage
+
+import "testing"
+
+func TestNewShardedErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards []string
+		stores int
+	}{
+		{name: "нет частей"},
+		{name: "имён меньше, чем частей", shards: []string{"a"}, stores: 2},
+		{name: "повторяется имя", shards: []string{"a", "a"}, stores: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := make([]Storage, tt.stores)
+			for i := range stores {
+				stores[i] = NewMemStorage()
+			}
+			if _, err := NewSharded(tt.shards, stores); err == nil {
+				t.Fatal("ошибки нет")
+			}
+		})
+	}
+}
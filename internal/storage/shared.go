@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/redis"
+)
+
+// Общее хранилище нескольких процессов сервера на одном хосте.
+//
+// Процессы с одним путём сокета выбирают владельца блокировкой файла
+// <сокет>.lock: владелец держит метрики в своей памяти (со снимками и
+// журналом) и обслуживает остальных через сокет Unix по протоколу Redis,
+// а остальные процессы работают с ним как с хранилищем redis.
+// Поэтому все процессы видят одни и те же метрики.
+
+// sharedErrors коды ошибок общего хранилища в ответах владельца
+var sharedErrors = map[string]error{
+	"OVERFLOW":  ErrOverflow,
+	"LIMIT":     ErrTooManyMetrics,
+	"BUDGET":    ErrMemoryBudget,
+	"READONLY":  ErrReadOnly,
+	"PROTECTED": ErrProtected,
+}
+
+// sharedWait наибольшее время ожидания владельца общего хранилища при запуске
+const sharedWait = 30 * time.Second
+
+// SharedServer обслуживает хранилище владельца для других процессов
+type SharedServer struct {
+	ln    net.Listener
+	store Storage
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// ServeShared обслуживает хранилище s через слушатель ln до Close.
+// Поддерживается подмножество команд Redis, которым пользуется RedisStorage
+// с пустым префиксом: метрики gauge хранятся в хеше gauges, counter — в counters.
+func ServeShared(ln net.Listener, s Storage) *SharedServer {
+	srv := &SharedServer{ln: ln, store: s, conns: make(map[net.Conn]struct{})}
+	srv.wg.Add(1)
+	go srv.accept()
+	return srv
+}
+
+// Close прекращает приём соединений и закрывает открытые соединения
+func (srv *SharedServer) Close() error {
+	err := srv.ln.Close()
+	srv.mu.Lock()
+	for c := range srv.conns {
+		c.Close()
+	}
+	srv.mu.Unlock()
+	srv.wg.Wait()
+	return err
+}
+
+// accept принимает соединения процессов сервера
+func (srv *SharedServer) accept() {
+	defer srv.wg.Done()
+	for {
+		c, err := srv.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Общее хранилище: ошибка приёма соединения: %v", err)
+			}
+			return
+		}
+		srv.mu.Lock()
+		srv.conns[c] = struct{}{}
+		srv.mu.Unlock()
+		srv.wg.Add(1)
+		go srv.serve(c)
+	}
+}
+
+// serve выполняет команды одного соединения
+func (srv *SharedServer) serve(c net.Conn) {
+	defer srv.wg.Done()
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.conns, c)
+		srv.mu.Unlock()
+		c.Close()
+	}()
+	br, bw := bufio.NewReader(c), bufio.NewWriter(c)
+	for {
+		args, err := redis.ReadCommand(br)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Общее хранилище: %v", err)
+			}
+			return
+		}
+		if err := redis.WriteReply(bw, srv.exec(context.Background(), args)); err != nil {
+			return
+		}
+	}
+}
+
+// exec выполняет команду и возвращает ответ для redis.WriteReply
+func (srv *SharedServer) exec(ctx context.Context, args []string) any {
+	cmd := strings.ToUpper(args[0])
+	if cmd == "PING" {
+		return "PONG"
+	}
+	if len(args) < 2 || (args[1] != "gauges" && args[1] != "counters") {
+		return redis.Error("ERR неизвестный ключ или команда " + cmd)
+	}
+	gauge := args[1] == "gauges"
+	switch {
+	case cmd == "HSET" && gauge && len(args) == 4:
+		v, err := strconv.ParseFloat(args[3], 64)
+		if err != nil {
+			return redis.Error("ERR value is not a valid float")
+		}
+		if err := srv.store.UpdateGauge(ctx, args[2], v); err != nil {
+			return sharedError(err)
+		}
+		return int64(1)
+	case cmd == "HINCRBY" && !gauge && len(args) == 4:
+		delta, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return redis.Error("ERR value is not an integer or out of range")
+		}
+		if err := srv.store.UpdateCounter(ctx, args[2], delta); err != nil {
+			return sharedError(err)
+		}
+		v, err := srv.store.GetCounter(ctx, args[2])
+		if err != nil {
+			return sharedError(err)
+		}
+		return v
+	case cmd == "HGET" && len(args) == 3:
+		var reply any
+		var err error
+		if gauge {
+			var v float64
+			if v, err = srv.store.GetGauge(ctx, args[2]); err == nil {
+				reply = []byte(strconv.FormatFloat(v, 'g', -1, 64))
+			}
+		} else {
+			var v int64
+			if v, err = srv.store.GetCounter(ctx, args[2]); err == nil {
+				reply = []byte(strconv.FormatInt(v, 10))
+			}
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return sharedError(err)
+		}
+		return reply
+	case cmd == "HGETALL" && len(args) == 2:
+		gauges, counters, err := srv.store.GetAll(ctx)
+		if err != nil {
+			return sharedError(err)
+		}
+		var fields []string
+		if gauge {
+			fields = make([]string, 0, 2*len(gauges))
+			for name, v := range gauges {
+				fields = append(fields, name, strconv.FormatFloat(v, 'g', -1, 64))
+			}
+		} else {
+			fields = make([]string, 0, 2*len(counters))
+			for name, v := range counters {
+				fields = append(fields, name, strconv.FormatInt(v, 10))
+			}
+		}
+		return fields
+	case cmd == "HDEL" && len(args) == 3:
+		var err error
+		if gauge {
+			d, ok := srv.store.(interface {
+				DeleteGauge(context.Context, string) error
+			})
+			if !ok {
+				return redis.Error("ERR хранилище не поддерживает удаление")
+			}
+			err = d.DeleteGauge(ctx, args[2])
+		} else {
+			d, ok := srv.store.(interface {
+				DeleteCounter(context.Context, string) error
+			})
+			if !ok {
+				return redis.Error("ERR хранилище не поддерживает удаление")
+			}
+			err = d.DeleteCounter(ctx, args[2])
+		}
+		if err != nil {
+			return sharedError(err)
+		}
+		return int64(1)
+	}
+	return redis.Error("ERR неверная команда " + cmd)
+}
+
+// sharedError ответ владельца об ошибке хранилища с кодом известной ошибки
+func sharedError(err error) redis.Error {
+	for code, e := range sharedErrors {
+		if errors.Is(err, e) {
+			return redis.Error(code + " " + err.Error())
+		}
+	}
+	return redis.Error("ERR " + err.Error())
+}
+
+// DialShared подключается к владельцу общего хранилища через сокет path.
+// Владелец мог ещё не открыть сокет, пока восстанавливает метрики,
+// поэтому подключение повторяется до sharedWait.
+func DialShared(ctx context.Context, path string) (*RedisStorage, error) {
+	ctx, cancel := context.WithTimeout(ctx, sharedWait)
+	defer cancel()
+	for {
+		s, err := NewRedisStorage(ctx, redis.Options{Addr: "unix:" + path}, "")
+		if err == nil {
+			return s, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("владелец общего хранилища недоступен: %w", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
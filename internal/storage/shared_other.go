@@ -0,0 +1,10 @@
+//go:build !unix
+
+package storage
+
+import "errors"
+
+// LockShared на этой платформе не поддерживается: нет сокетов Unix и flock
+func LockShared(path string) (release func() error, ok bool, err error) {
+	return nil, false, errors.New("общее хранилище доступно только в Unix")
+}
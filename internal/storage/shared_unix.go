@@ -0,0 +1,27 @@
+//go:build unix
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// LockShared пытается стать владельцем общего хранилища с сокетом path.
+// Владелец получает функцию снятия блокировки; остальные процессы — ok=false.
+// Блокировка снимается и при аварийном завершении процесса.
+func LockShared(path string) (release func() error, ok bool, err error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return f.Close, true, nil
+}
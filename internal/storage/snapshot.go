@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Форматы файлового снимка
+const (
+	FormatJSON   = "json"
+	FormatBinary = "binary"
+)
+
+// SaveFile атомарно записывает все метрики s в файл path в формате format:
+// снимок пишется во временный файл, который затем переименовывается.
+// Возвращает размер записанного снимка.
+func SaveFile(ctx context.Context, s Storage, path, format string) (int64, error) {
+	gauges, counters, err := s.GetAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+
+	c := &countingWriter{w: tmp}
+	bw := bufio.NewWriter(c)
+	err = WriteSnapshot(bw, format, gauges, counters)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return c.n, os.Rename(tmp.Name(), path)
+}
+
+// WriteSnapshot записывает метрики в снимок формата format
+func WriteSnapshot(w io.Writer, format string, gauges map[string]float64, counters map[string]int64) error {
+	switch format {
+	case FormatJSON:
+		return writeJSONSnapshot(w, gauges, counters)
+	case FormatBinary:
+		return WriteBinary(w, gauges, counters)
+	default:
+		return fmt.Errorf("неизвестный формат снимка: %s", format)
+	}
+}
+
+// writeJSONSnapshot записывает метрики в снимок формата JSON
+func writeJSONSnapshot(w io.Writer, gauges map[string]float64, counters map[string]int64) error {
+	return json.NewEncoder(w).Encode(models.FromMaps(gauges, counters))
+}
+
+// LoadFile восстанавливает метрики из файла path в s.
+// Формат определяется по содержимому. Отсутствие файла не считается ошибкой.
+func LoadFile(ctx context.Context, s Storage, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gauges, counters, err := ReadSnapshot(f)
+	if err != nil {
+		return err
+	}
+	for name, v := range gauges {
+		if err := s.UpdateGauge(ctx, name, v); err != nil {
+			return err
+		}
+	}
+	for name, v := range counters {
+		if err := s.UpdateCounter(ctx, name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSnapshot читает снимок в формате JSON или двоичном.
+// Формат определяется по содержимому.
+func ReadSnapshot(r io.Reader) (map[string]float64, map[string]int64, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(binaryMagic))
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if bytes.Equal(magic, []byte(binaryMagic)) {
+		return ReadBinary(br)
+	}
+
+	var metrics []models.Metrics
+	if err := json.NewDecoder(br).Decode(&metrics); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+	}
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	for _, m := range metrics {
+		if err := models.Validate(m); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+		}
+		if m.MType == models.Gauge {
+			gauges[m.ID] = *m.Value
+		} else {
+			counters[m.ID] = *m.Delta
+		}
+	}
+	return gauges, counters, nil
+}
+
+// Restore устанавливает метрикам s значения из снимка. В отличие от LoadFile,
+// counter получает значение из снимка, а не прибавляет его к текущему,
+// поэтому восстановление в непустое хранилище не удваивает счётчики.
+// Возвращает число восстановленных метрик.
+func Restore(ctx context.Context, s Storage, gauges map[string]float64, counters map[string]int64) (int, error) {
+	n := 0
+	for name, v := range gauges {
+		if err := s.UpdateGauge(ctx, name, v); err != nil {
+			return n, err
+		}
+		n++
+	}
+	for name, v := range counters {
+		cur, err := s.GetCounter(ctx, name)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return n, err
+		}
+		delta := v - cur
+		if (cur > 0 && delta > v) || (cur < 0 && delta < v) {
+			return n, ErrOverflow
+		}
+		if delta != 0 {
+			if err := s.UpdateCounter(ctx, name, delta); err != nil {
+				return n, err
+			}
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		gauges   map[string]float64
+		counters map[string]int64
+	}{
+		{name: "пустой", gauges: map[string]float64{}, counters: map[string]int64{}},
+		{
+			name:     "оба типа",
+			gauges:   map[string]float64{"cpu": 0.5, "mem": -1e300, "zero": 0},
+			counters: map[string]int64{"hits": 42, "neg": -7},
+		},
+		{
+			name:     "одно имя у обоих типов",
+			gauges:   map[string]float64{"x": 1.25},
+			counters: map[string]int64{"x": 3},
+		},
+		{
+			name:     "крайние значения",
+			gauges:   map[string]float64{"max": math.MaxFloat64, "tiny": math.SmallestNonzeroFloat64},
+			counters: map[string]int64{"max": math.MaxInt64, "min": math.MinInt64},
+		},
+		{
+			name:     "имена UTF-8 и разделитель арендатора",
+			gauges:   map[string]float64{"температура": 21.5, "a/cpu": 1},
+			counters: map[string]int64{"запросы": 1},
+		},
+		{name: "несколько блоков", gauges: manyGauges(2*binaryBlockRecords + 1), counters: map[string]int64{}},
+	}
+	for _, tt := range tests {
+		for _, format := range []string{FormatJSON, FormatBinary} {
+			t.Run(tt.name+" "+format, func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := WriteSnapshot(&buf, format, tt.gauges, tt.counters); err != nil {
+					t.Fatal(err)
+				}
+				gauges, counters, err := ReadSnapshot(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(gauges, tt.gauges) || !reflect.DeepEqual(counters, tt.counters) {
+					t.Errorf("прочитано %v %v, ожидалось %v %v", gauges, counters, tt.gauges, tt.counters)
+				}
+			})
+		}
+	}
+}
+
+// manyGauges возвращает n метрик gauge
+func manyGauges(n int) map[string]float64 {
+	gauges := make(map[string]float64, n)
+	for i := 0; i < n; i++ {
+		gauges["gauge"+strconv.Itoa(i)] = float64(i)
+	}
+	return gauges
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	var good bytes.Buffer
+	if err := WriteBinary(&good, map[string]float64{"cpu": 1}, map[string]int64{"hits": 2}); err != nil {
+		t.Fatal(err)
+	}
+	data := good.Bytes()
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(binaryMagic)+4] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "обрезанный двоичный", data: data[:len(data)-3]},
+		{name: "повреждённый блок", data: corrupted},
+		{name: "только заголовок", data: data[:len(binaryMagic)]},
+		{name: "неверный JSON", data: []byte(`[{"id":"cpu"`)},
+		{name: "неверная метрика JSON", data: []byte(`[{"id":"cpu","type":"gauge"}]`)},
+		{name: "неизвестный тип JSON", data: []byte(`[{"id":"cpu","type":"summary","value":1}]`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ReadSnapshot(bytes.NewReader(tt.data)); err == nil {
+				t.Error("снимок прочитан без ошибки")
+			}
+		})
+	}
+	if _, _, err := ReadSnapshot(bytes.NewReader([]byte(`[{"id":"cpu","type":"gauge"}]`))); !errors.Is(err, ErrBadSnapshot) {
+		t.Errorf("ошибка %v, ожидалась %v", err, ErrBadSnapshot)
+	}
+}
+
+func TestSaveLoadFile(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatBinary} {
+		t.Run(format, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "metrics")
+			src := NewMemStorage()
+			src.UpdateGauge(ctx, "cpu", 0.75)
+			src.UpdateCounter(ctx, "hits", 5)
+			n, err := SaveFile(ctx, src, path, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info, err := os.Stat(path); err != nil || info.Size() != n {
+				t.Fatalf("размер файла %v, записано %d: %v", info, n, err)
+			}
+
+			dst := NewMemStorage()
+			if err := LoadFile(ctx, dst, path); err != nil {
+				t.Fatal(err)
+			}
+			if v, err := dst.GetGauge(ctx, "cpu"); err != nil || v != 0.75 {
+				t.Errorf("cpu = %v, %v", v, err)
+			}
+			if d, err := dst.GetCounter(ctx, "hits"); err != nil || d != 5 {
+				t.Errorf("hits = %v, %v", d, err)
+			}
+			if err := LoadFile(ctx, dst, path+".missing"); err != nil {
+				t.Errorf("отсутствующий снимок: %v", err)
+			}
+		})
+	}
+}
+
+func TestRestoreDoesNotDoubleCounters(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.UpdateCounter(ctx, "hits", 10)
+	if _, err := Restore(ctx, s, map[string]float64{"cpu": 1}, map[string]int64{"hits": 4, "new": 2}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]int64{"hits": 4, "new": 2} {
+		if d, _ := s.GetCounter(ctx, name); d != want {
+			t.Errorf("%s = %d, ожидалось %d", name, d, want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WriteStats учитывает, сколько байт записывают механизмы сохранения
+// в расчёте на одно принятое обновление метрики
+type WriteStats struct {
+	updates atomic.Int64
+	start   time.Time
+
+	mu       sync.Mutex
+	backends map[string]*backendStats
+}
+
+// backendStats накопленные записи одного механизма сохранения
+type backendStats struct {
+	writes    int64
+	bytes     int64
+	lastBytes int64
+	last      time.Time
+}
+
+// BackendReport сведения о записях механизма сохранения
+type BackendReport struct {
+	Name   string `json:"name"`
+	Writes int64  `json:"writes"`
+	Bytes  int64  `json:"bytes"`
+	// LastWriteBytes размер последней записи
+	LastWriteBytes int64     `json:"last_write_bytes"`
+	LastWrite      time.Time `json:"last_write"`
+	// BytesPerUpdate байт на одно принятое обновление — коэффициент усиления записи
+	BytesPerUpdate float64 `json:"bytes_per_update"`
+	// UpdatesPerWrite принятых обновлений на одну запись
+	UpdatesPerWrite float64 `json:"updates_per_write"`
+}
+
+// WriteReport отчёт об усилении записи
+type WriteReport struct {
+	Updates int64 `json:"updates"`
+	// UpdatesPerSecond средняя частота принятых обновлений
+	UpdatesPerSecond float64         `json:"updates_per_second"`
+	UptimeSeconds    float64         `json:"uptime_seconds"`
+	Backends         []BackendReport `json:"backends"`
+}
+
+// NewWriteStats создаёт пустую статистику записей
+func NewWriteStats() *WriteStats {
+	return &WriteStats{start: time.Now(), backends: make(map[string]*backendStats)}
+}
+
+// Accept учитывает одно принятое обновление метрики
+func (s *WriteStats) Accept() {
+	s.updates.Add(1)
+}
+
+// Updates возвращает число принятых обновлений
+func (s *WriteStats) Updates() int64 {
+	return s.updates.Load()
+}
+
+// Record учитывает запись n байт механизмом сохранения backend
+func (s *WriteStats) Record(backend string, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.backends[backend]
+	if !ok {
+		b = &backendStats{}
+		s.backends[backend] = b
+	}
+	b.writes++
+	b.bytes += n
+	b.lastBytes = n
+	b.last = time.Now()
+}
+
+// Report возвращает отчёт, упорядоченный по имени механизма
+func (s *WriteStats) Report() WriteReport {
+	updates := s.updates.Load()
+	uptime := time.Since(s.start).Seconds()
+	r := WriteReport{Updates: updates, UptimeSeconds: uptime, Backends: []BackendReport{}}
+	if uptime > 0 {
+		r.UpdatesPerSecond = float64(updates) / uptime
+	}
+
+	s.mu.Lock()
+	for name, b := range s.backends {
+		br := BackendReport{Name: name, Writes: b.writes, Bytes: b.bytes, LastWriteBytes: b.lastBytes, LastWrite: b.last}
+		if updates > 0 {
+			br.BytesPerUpdate = float64(b.bytes) / float64(updates)
+		}
+		if b.writes > 0 {
+			br.UpdatesPerWrite = float64(updates) / float64(b.writes)
+		}
+		r.Backends = append(r.Backends, br)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(r.Backends, func(i, j int) bool { return r.Backends[i].Name < r.Backends[j].Name })
+	return r
+}
+
+// countingWriter считает записанные байты
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// SaveSettings настройки сохранения, по которым строятся рекомендации
+type SaveSettings struct {
+	Path     string
+	Format   string
+	Interval time.Duration
+	// WAL ведётся ли журнал обновлений между снимками
+	WAL bool
+}
+
+// Advice рекомендация по настройке сохранения
+type Advice struct {
+	Setting   string `json:"setting"`
+	Current   string `json:"current"`
+	Suggested string `json:"suggested"`
+	Reason    string `json:"reason"`
+}
+
+// Guide рекомендации по настройке сохранения
+type Guide struct {
+	Settings struct {
+		Path     string `json:"path"`
+		Format   string `json:"format"`
+		Interval string `json:"interval"`
+		WAL      bool   `json:"wal"`
+	} `json:"settings"`
+	Metrics          int                `json:"metrics"`
+	SnapshotBytes    map[string]int64   `json:"snapshot_bytes"`
+	UpdatesPerSecond float64            `json:"updates_per_second"`
+	BytesPerUpdate   map[string]float64 `json:"projected_bytes_per_update"`
+	Advice           []Advice           `json:"advice"`
+}
+
+const (
+	// targetBytesPerUpdate приемлемое усиление записи: порядок размера одной записи снимка
+	targetBytesPerUpdate = 16
+	// maxSuggestedInterval наибольшая рекомендуемая частота сохранения
+	maxSuggestedInterval = 15 * time.Minute
+	// binaryAdviceMetrics число метрик, начиная с которого стоит перейти на двоичный формат
+	binaryAdviceMetrics = 1000
+)
+
+// NewGuide оценивает размер снимка s в обоих форматах и подбирает
+// частоту сохранения и формат так, чтобы усиление записи оставалось небольшим
+func NewGuide(ctx context.Context, s Storage, stats *WriteStats, settings SaveSettings) (Guide, error) {
+	var g Guide
+	g.Settings.Path = settings.Path
+	g.Settings.Format = settings.Format
+	g.Settings.Interval = settings.Interval.String()
+	g.Settings.WAL = settings.WAL
+	g.UpdatesPerSecond = stats.Report().UpdatesPerSecond
+	g.Advice = []Advice{}
+
+	gauges, counters, err := s.GetAll(ctx)
+	if err != nil {
+		return g, err
+	}
+	g.Metrics = len(gauges) + len(counters)
+	g.SnapshotBytes = map[string]int64{FormatJSON: jsonSize(gauges, counters), FormatBinary: binarySize(gauges, counters)}
+
+	// Снимок пишется целиком раз в интервал, за который приходит rate*interval обновлений
+	g.BytesPerUpdate = make(map[string]float64, len(g.SnapshotBytes))
+	if settings.Interval > 0 && g.UpdatesPerSecond > 0 {
+		perInterval := g.UpdatesPerSecond * settings.Interval.Seconds()
+		for format, size := range g.SnapshotBytes {
+			g.BytesPerUpdate[format] = float64(size) / perInterval
+		}
+	}
+
+	if settings.Path == "" {
+		g.Advice = append(g.Advice, Advice{
+			Setting: "FILE_STORAGE_PATH", Current: "", Suggested: "/var/lib/metrics/metrics.db",
+			Reason: "метрики хранятся только в памяти и теряются при перезапуске",
+		})
+		return g, nil
+	}
+
+	if settings.Format == FormatJSON && g.Metrics >= binaryAdviceMetrics {
+		g.Advice = append(g.Advice, Advice{
+			Setting: "SNAPSHOT_FORMAT", Current: FormatJSON, Suggested: FormatBinary,
+			Reason: fmt.Sprintf("двоичный снимок занимает %d байт вместо %d", g.SnapshotBytes[FormatBinary], g.SnapshotBytes[FormatJSON]),
+		})
+	}
+
+	// С журналом обновлений сбой не теряет данных, а редкий снимок лишь
+	// удлиняет журнал, который воспроизводится при запуске
+	switch {
+	case settings.Interval == 0 && !settings.WAL:
+		g.Advice = append(g.Advice, Advice{
+			Setting: "STORE_INTERVAL", Current: "0", Suggested: "5m",
+			Reason: "снимок сохраняется только при штатной остановке; при сбое теряются все обновления с запуска",
+		})
+	case g.BytesPerUpdate[settings.Format] > targetBytesPerUpdate:
+		size := g.SnapshotBytes[settings.Format]
+		suggested := time.Duration(float64(size) / (g.UpdatesPerSecond * targetBytesPerUpdate) * float64(time.Second))
+		suggested = min(suggested.Round(time.Second), maxSuggestedInterval)
+		if suggested > settings.Interval {
+			reason := fmt.Sprintf("на одно обновление записывается %.0f байт; при сбое будет потеряно до %.0f обновлений",
+				g.BytesPerUpdate[settings.Format], math.Ceil(g.UpdatesPerSecond*suggested.Seconds()))
+			if settings.WAL {
+				reason = fmt.Sprintf("на одно обновление записывается %.0f байт снимка; обновления между снимками сохраняет журнал",
+					g.BytesPerUpdate[settings.Format])
+			}
+			g.Advice = append(g.Advice, Advice{
+				Setting: "STORE_INTERVAL", Current: settings.Interval.String(), Suggested: suggested.String(),
+				Reason: reason,
+			})
+		}
+	}
+	return g, nil
+}
+
+// jsonSize размер снимка в формате JSON
+func jsonSize(gauges map[string]float64, counters map[string]int64) int64 {
+	c := &countingWriter{w: io.Discard}
+	writeJSONSnapshot(c, gauges, counters)
+	return c.n
+}
+
+// binarySize размер снимка в двоичном формате
+func binarySize(gauges map[string]float64, counters map[string]int64) int64 {
+	c := &countingWriter{w: io.Discard}
+	WriteBinary(c, gauges, counters)
+	return c.n
+}
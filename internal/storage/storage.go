@@ -0,0 +1,257 @@
+// Package storage хранит метрики
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Storage интерфейс для хранения метрик. Контекст ограничивает время
+// обращения к внешнему хранилищу и отменяет его вместе с запросом.
+type Storage interface {
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+	// GetGauge и GetCounter возвращают ErrNotFound, если метрики нет
+	GetGauge(ctx context.Context, name string) (float64, error)
+	GetCounter(ctx context.Context, name string) (int64, error)
+	// GetAll возвращает копии всех метрик
+	GetAll(ctx context.Context) (map[string]float64, map[string]int64, error)
+}
+
+// ErrOverflow возвращается, если значение counter вышло бы за пределы int64
+var ErrOverflow = errors.New("переполнение значения counter")
+
+// ErrNotFound возвращается при чтении отсутствующей метрики
+var ErrNotFound = errors.New("метрика не найдена")
+
+// ErrUnsupportedType возвращается для метрики типа, который хранилище не хранит
+var ErrUnsupportedType = errors.New("неподдерживаемый тип метрики")
+
+// MemStorage структура для хранения метрик в памяти
+type MemStorage struct {
+	mu       sync.RWMutex
+	gauges   map[string]float64
+	counters map[string]int64
+
+	limits Limits
+	// bytes оценка памяти метрик, учитывается при ограничениях
+	bytes int64
+	// historyBytes оценка памяти истории метрик, ведёт Limits.History
+	historyBytes atomic.Int64
+	// lru метрики от дольше всех не обновлявшихся; ведётся только при вытеснении
+	lru   *list.List
+	elems map[metricKey]*list.Element
+	// protected метрики, которые не вытесняются и не удаляются
+	protected map[metricKey]bool
+}
+
+// NewMemStorage создаёт новое хранилище метрик
+func NewMemStorage() *MemStorage {
+	return &MemStorage{
+		gauges:   make(map[string]float64),
+		counters: make(map[string]int64),
+	}
+}
+
+// UpdateGauge обновляет или добавляет метрику типа gauge
+func (m *MemStorage) UpdateGauge(_ context.Context, name string, value float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := metricKey{name: name}
+	if _, ok := m.gauges[name]; !ok {
+		if err := m.admit(key); err != nil {
+			return err
+		}
+	}
+	m.gauges[name] = value
+	m.touch(key)
+	return nil
+}
+
+// UpdateCounter обновляет или добавляет метрику типа counter
+func (m *MemStorage) UpdateCounter(_ context.Context, name string, delta int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.counters[name]
+	if addOverflows(current, delta) {
+		return ErrOverflow
+	}
+	key := metricKey{counter: true, name: name}
+	if !ok {
+		if err := m.admit(key); err != nil {
+			return err
+		}
+	}
+	m.counters[name] = current + delta
+	m.touch(key)
+	return nil
+}
+
+// addOverflows сообщает, что сумма a и b не помещается в int64
+func addOverflows(a, b int64) bool {
+	return (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b)
+}
+
+// GetGauge возвращает значение метрики типа gauge
+func (m *MemStorage) GetGauge(_ context.Context, name string) (float64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.gauges[name]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return value, nil
+}
+
+// GetCounter возвращает значение метрики типа counter
+func (m *MemStorage) GetCounter(_ context.Context, name string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.counters[name]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return value, nil
+}
+
+// DeleteGauge удаляет метрику типа gauge, если она есть
+func (m *MemStorage) DeleteGauge(_ context.Context, name string) error {
+	return m.delete(metricKey{name: name})
+}
+
+// DeleteCounter удаляет метрику типа counter, если она есть
+func (m *MemStorage) DeleteCounter(_ context.Context, name string) error {
+	return m.delete(metricKey{counter: true, name: name})
+}
+
+// delete удаляет метрику вместе с её местом в очереди вытеснения
+func (m *MemStorage) delete(key metricKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.protected[key] {
+		return ErrProtected
+	}
+	var ok bool
+	if key.counter {
+		_, ok = m.counters[key.name]
+	} else {
+		_, ok = m.gauges[key.name]
+	}
+	if !ok {
+		return nil
+	}
+	if e, ok := m.elems[key]; ok {
+		m.lru.Remove(e)
+	}
+	m.evict(key)
+	return nil
+}
+
+// GetAll возвращает копии всех метрик
+func (m *MemStorage) GetAll(context.Context) (map[string]float64, map[string]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	gauges := make(map[string]float64, len(m.gauges))
+	for name, value := range m.gauges {
+		gauges[name] = value
+	}
+	counters := make(map[string]int64, len(m.counters))
+	for name, value := range m.counters {
+		counters[name] = value
+	}
+	return gauges, counters, nil
+}
+
+// Ping проверяет доступность хранилища s, если оно это поддерживает.
+// Обёртки, реализующие Unwrap, пропускаются.
+func Ping(ctx context.Context, s Storage) error {
+	for {
+		if p, ok := s.(interface{ Ping(context.Context) error }); ok {
+			return p.Ping(ctx)
+		}
+		u, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			return nil
+		}
+		s = u.Unwrap()
+	}
+}
+
+// Admit проверяет, что хранилище s примет все обновления batch, если оно
+// умеет проверять пакет заранее. Обёртки, реализующие Unwrap, пропускаются.
+func Admit(ctx context.Context, s Storage, batch []models.Metrics) error {
+	for {
+		if a, ok := s.(interface {
+			Admit(context.Context, []models.Metrics) error
+		}); ok {
+			return a.Admit(ctx, batch)
+		}
+		u, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			return nil
+		}
+		s = u.Unwrap()
+	}
+}
+
+// admitParts проверяет пакет по частям хранилища: pick выбирает часть,
+// в которой хранится метрика
+func admitParts(ctx context.Context, batch []models.Metrics, pick func(name string) Storage) error {
+	var order []Storage
+	parts := make(map[Storage][]models.Metrics)
+	for _, m := range batch {
+		s := pick(m.ID)
+		if _, ok := parts[s]; !ok {
+			order = append(order, s)
+		}
+		parts[s] = append(parts[s], m)
+	}
+	for _, s := range order {
+		if err := Admit(ctx, s, parts[s]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get возвращает метрику типа mType из хранилища s
+func Get(ctx context.Context, s Storage, mType, name string) (models.Metrics, error) {
+	switch mType {
+	case models.Gauge:
+		v, err := s.GetGauge(ctx, name)
+		if err != nil {
+			return models.Metrics{}, err
+		}
+		return models.NewGauge(name, v), nil
+	case models.Counter:
+		d, err := s.GetCounter(ctx, name)
+		if err != nil {
+			return models.Metrics{}, err
+		}
+		return models.NewCounter(name, d), nil
+	default:
+		return models.Metrics{}, fmt.Errorf("%w: %s", ErrUnsupportedType, mType)
+	}
+}
+
+// Update применяет к хранилищу s обновление метрики m
+func Update(ctx context.Context, s Storage, m models.Metrics) error {
+	switch {
+	case m.MType == models.Gauge && m.Value != nil:
+		return s.UpdateGauge(ctx, m.ID, *m.Value)
+	case m.MType == models.Counter && m.Delta != nil:
+		return s.UpdateCounter(ctx, m.ID, *m.Delta)
+	case m.MType == models.Gauge, m.MType == models.Counter:
+		return models.ErrInvalidValue
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, m.MType)
+	}
+}
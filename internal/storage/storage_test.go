@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+func TestStorageErrors(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name string
+		// setup готовит хранилище и возвращает его
+		setup   func(ctx context.Context) (Storage, error)
+		op      func(ctx context.Context, s Storage) error
+		wantErr error
+	}{
+		{
+			name: "нет gauge",
+			op: func(ctx context.Context, s Storage) error {
+				_, err := s.GetGauge(ctx, "cpu")
+				return err
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "нет counter с именем gauge",
+			op: func(ctx context.Context, s Storage) error {
+				if err := s.UpdateGauge(ctx, "cpu", 1); err != nil {
+					return err
+				}
+				_, err := s.GetCounter(ctx, "cpu")
+				return err
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "чтение summary",
+			op: func(ctx context.Context, s Storage) error {
+				_, err := Get(ctx, s, models.Summary, "latency")
+				return err
+			},
+			wantErr: ErrUnsupportedType,
+		},
+		{
+			name:    "обновление summary",
+			op:      func(ctx context.Context, s Storage) error { return Update(ctx, s, models.NewSummary("latency", 1)) },
+			wantErr: ErrUnsupportedType,
+		},
+		{
+			name: "gauge без значения",
+			op: func(ctx context.Context, s Storage) error {
+				return Update(ctx, s, models.Metrics{ID: "cpu", MType: models.Gauge})
+			},
+			wantErr: models.ErrInvalidValue,
+		},
+		{
+			name: "gauge со значением",
+			op: func(ctx context.Context, s Storage) error {
+				return Update(ctx, s, models.Metrics{ID: "cpu", MType: models.Gauge, Value: value(1)})
+			},
+		},
+		{
+			name: "переполнение counter",
+			op: func(ctx context.Context, s Storage) error {
+				if err := s.UpdateCounter(ctx, "hits", math.MaxInt64); err != nil {
+					return err
+				}
+				return s.UpdateCounter(ctx, "hits", 1)
+			},
+			wantErr: ErrOverflow,
+		},
+		{
+			name: "переполнение counter вниз",
+			op: func(ctx context.Context, s Storage) error {
+				if err := s.UpdateCounter(ctx, "hits", math.MinInt64); err != nil {
+					return err
+				}
+				return s.UpdateCounter(ctx, "hits", -1)
+			},
+			wantErr: ErrOverflow,
+		},
+		{
+			name: "слишком много метрик",
+			setup: func(context.Context) (Storage, error) {
+				return NewLimitedMemStorage(Limits{MaxMetrics: 1}), nil
+			},
+			op: func(ctx context.Context, s Storage) error {
+				if err := s.UpdateGauge(ctx, "a", 1); err != nil {
+					return err
+				}
+				return s.UpdateCounter(ctx, "b", 1)
+			},
+			wantErr: ErrTooManyMetrics,
+		},
+		{
+			name: "обновление существующей метрики сверх ограничения",
+			setup: func(context.Context) (Storage, error) {
+				return NewLimitedMemStorage(Limits{MaxMetrics: 1}), nil
+			},
+			op: func(ctx context.Context, s Storage) error {
+				if err := s.UpdateGauge(ctx, "a", 1); err != nil {
+					return err
+				}
+				return s.UpdateGauge(ctx, "a", 2)
+			},
+		},
+		{
+			name: "бюджет памяти",
+			setup: func(context.Context) (Storage, error) {
+				return NewLimitedMemStorage(Limits{MaxBytes: metricOverhead + 8}), nil
+			},
+			op: func(ctx context.Context, s Storage) error {
+				return s.UpdateGauge(ctx, "a-very-long-metric-name", 1)
+			},
+			wantErr: ErrMemoryBudget,
+		},
+		{
+			name: "удаление обязательной метрики",
+			setup: func(ctx context.Context) (Storage, error) {
+				s := NewMemStorage()
+				_, err := Bootstrap(ctx, s, []models.Metrics{models.NewCounter("restarts", 0)})
+				return s, err
+			},
+			op:      func(ctx context.Context, s Storage) error { return s.(*MemStorage).DeleteCounter(ctx, "restarts") },
+			wantErr: ErrProtected,
+		},
+		{
+			name: "удаление отсутствующей метрики",
+			op:   func(ctx context.Context, s Storage) error { return s.(*MemStorage).DeleteGauge(ctx, "missing") },
+		},
+		{
+			name: "обновление только для чтения",
+			setup: func(context.Context) (Storage, error) {
+				return NewReadOnly(NewMemStorage()), nil
+			},
+			op:      func(ctx context.Context, s Storage) error { return s.UpdateGauge(ctx, "cpu", 1) },
+			wantErr: ErrReadOnly,
+		},
+		{
+			name: "чтение через обёртку",
+			setup: func(context.Context) (Storage, error) {
+				return NewReadOnly(NewMemStorage()), nil
+			},
+			op: func(ctx context.Context, s Storage) error {
+				_, err := s.GetCounter(ctx, "hits")
+				return err
+			},
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var s Storage = NewMemStorage()
+			if tt.setup != nil {
+				var err error
+				if s, err = tt.setup(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := tt.op(ctx, s)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("ошибка %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ошибка %v, ожидалась %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package storage
+
+import "context"
+
+// Sink получатель копий принятых обновлений
+type Sink interface {
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+}
+
+// Tee хранилище, передающее каждое принятое обновление ещё и в sink
+type Tee struct {
+	Storage
+	sink Sink
+}
+
+// UpdateGauge обновляет метрику и передаёт значение в sink
+func (s *Tee) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := s.Storage.UpdateGauge(ctx, name, value); err != nil {
+		return err
+	}
+	return s.sink.UpdateGauge(ctx, name, value)
+}
+
+// UpdateCounter обновляет метрику и передаёт приращение в sink
+func (s *Tee) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	if err := s.Storage.UpdateCounter(ctx, name, delta); err != nil {
+		return err
+	}
+	return s.sink.UpdateCounter(ctx, name, delta)
+}
+
+// NewTee оборачивает хранилище s, копируя принятые обновления в sink
+func NewTee(s Storage, sink Sink) *Tee {
+	return &Tee{Storage: s, sink: sink}
+}
+
+// Unwrap возвращает обёрнутое хранилище
+func (s *Tee) Unwrap() Storage {
+	return s.Storage
+}
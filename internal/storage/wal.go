@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Формат журнала упреждающей записи.
+//
+// Файл начинается с magic "MTRCWAL2", далее идут записи:
+//
+//	kind  uint8    тип метрики: 1 — gauge, 2 — counter
+//	name  uvarint  длина имени и само имя
+//	value          8 байт float64 для gauge или varint приращения counter
+//	time  varint   время обновления в наносекундах Unix (0 — неизвестно)
+//	crc   uint32   CRC-32 (IEEE) предыдущих байт записи
+//
+// Журналы первой версии ("MTRCWAL1") читаются так же, но без времени.
+// Запись, оборванная при аварийном завершении, отбрасывается при чтении
+// вместе со всем, что идёт после неё.
+const (
+	walMagic   = "MTRCWAL2"
+	walMagicV1 = "MTRCWAL1"
+)
+
+// WALRecord запись журнала: обновление gauge или приращение counter
+type WALRecord struct {
+	// Time время обновления; нулевое у журналов первой версии
+	Time   time.Time
+	Metric models.Metrics
+}
+
+// WAL хранилище, дописывающее каждое принятое обновление в журнал.
+// Журнал воспроизводится при запуске поверх восстановленного снимка
+// и начинается заново после сохранения очередного снимка (Checkpoint).
+type WAL struct {
+	Storage
+	record func(n int64)
+
+	mu  sync.Mutex
+	f   *os.File
+	buf []byte
+}
+
+// OpenWAL воспроизводит журнал path в хранилище s и открывает его для
+// дописывания. record, если задан, вызывается с размером каждой записи.
+func OpenWAL(ctx context.Context, s Storage, path string, record func(n int64)) (*WAL, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// Обновление, отклонённое хранилищем, не могло попасть в журнал;
+	// ошибку при воспроизведении (например, переполнение) пропускаем
+	current := isCurrentWAL(f)
+	var old []WALRecord
+	size, err := ReadWAL(f, func(rec WALRecord) error {
+		if !current {
+			old = append(old, rec)
+		}
+		_ = Update(ctx, s, rec.Metric)
+		return nil
+	})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("журнал %s: %w", path, err)
+	}
+	// Журнал первой версии переписывается в текущем формате
+	if !current {
+		size = 0
+	}
+	// Отбрасываем оборванный хвост и продолжаем запись с конца журнала
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if size == 0 {
+		if _, err := f.Write([]byte(walMagic)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	w := &WAL{Storage: s, record: record, f: f}
+	for _, rec := range old {
+		if err := w.appendRecord(rec); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// appendRecord дописывает в журнал прочитанную ранее запись
+func (w *WAL) appendRecord(rec WALRecord) error {
+	m := rec.Metric
+	if m.MType == models.Gauge {
+		b := w.begin(compactGauge, m.ID)
+		return w.append(binary.LittleEndian.AppendUint64(b, math.Float64bits(*m.Value)), rec.Time)
+	}
+	return w.append(binary.AppendVarint(w.begin(compactCounter, m.ID), *m.Delta), rec.Time)
+}
+
+// isCurrentWAL проверяет, записан ли журнал f в текущей версии формата
+func isCurrentWAL(f *os.File) bool {
+	magic := make([]byte, len(walMagic))
+	_, err := f.ReadAt(magic, 0)
+	return err == nil && string(magic) == walMagic
+}
+
+// ReadWAL вызывает fn для каждой записи журнала из r и возвращает размер
+// его целой части. Оборванный или повреждённый хвост журнала не считается
+// ошибкой: чтение на нём заканчивается. Пустой журнал допустим.
+func ReadWAL(r io.Reader, fn func(WALRecord) error) (int64, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(walMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		// Пустой файл или оборванный заголовок: журнал начинается заново
+		return 0, nil
+	}
+	if string(magic) != walMagic && string(magic) != walMagicV1 {
+		return 0, ErrBadSnapshot
+	}
+	withTime := string(magic) == walMagic
+
+	size := int64(len(walMagic))
+	for {
+		rec, n, err := readWALRecord(br, withTime)
+		if err != nil {
+			return size, nil
+		}
+		if err := fn(rec); err != nil {
+			return size, err
+		}
+		size += n
+	}
+}
+
+// readWALRecord читает одну запись журнала и возвращает её размер
+func readWALRecord(r *bufio.Reader, withTime bool) (rec WALRecord, n int64, err error) {
+	h := crc32.NewIEEE()
+	cr := &countingReader{r: r, h: h}
+
+	kind, err := cr.ReadByte()
+	if err != nil {
+		return
+	}
+	if kind != compactGauge && kind != compactCounter {
+		err = ErrBadSnapshot
+		return
+	}
+	size, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return
+	}
+	if size > maxBlockSize {
+		err = ErrBadSnapshot
+		return
+	}
+	b := make([]byte, size)
+	if _, err = io.ReadFull(cr, b); err != nil {
+		return
+	}
+	if kind == compactGauge {
+		var v [8]byte
+		if _, err = io.ReadFull(cr, v[:]); err != nil {
+			return
+		}
+		rec.Metric = models.NewGauge(string(b), math.Float64frombits(binary.LittleEndian.Uint64(v[:])))
+	} else {
+		var delta int64
+		if delta, err = binary.ReadVarint(cr); err != nil {
+			return
+		}
+		rec.Metric = models.NewCounter(string(b), delta)
+	}
+	if withTime {
+		var ns int64
+		if ns, err = binary.ReadVarint(cr); err != nil {
+			return
+		}
+		if ns != 0 {
+			rec.Time = time.Unix(0, ns)
+		}
+	}
+
+	sum := h.Sum32()
+	var c [4]byte
+	if _, err = io.ReadFull(r, c[:]); err != nil {
+		return
+	}
+	if binary.LittleEndian.Uint32(c[:]) != sum {
+		err = ErrBadSnapshot
+		return
+	}
+	n = cr.n + 4
+	return
+}
+
+// countingReader считает прочитанные байты и их контрольную сумму
+type countingReader struct {
+	r *bufio.Reader
+	h io.Writer
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.h.Write([]byte{b})
+		c.n++
+	}
+	return b, err
+}
+
+// UpdateGauge обновляет метрику и дописывает обновление в журнал
+func (w *WAL) UpdateGauge(ctx context.Context, name string, value float64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.Storage.UpdateGauge(ctx, name, value); err != nil {
+		return err
+	}
+	rec := w.begin(compactGauge, name)
+	rec = binary.LittleEndian.AppendUint64(rec, math.Float64bits(value))
+	return w.append(rec, time.Now())
+}
+
+// UpdateCounter обновляет метрику и дописывает приращение в журнал
+func (w *WAL) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.Storage.UpdateCounter(ctx, name, delta); err != nil {
+		return err
+	}
+	rec := w.begin(compactCounter, name)
+	rec = binary.AppendVarint(rec, delta)
+	return w.append(rec, time.Now())
+}
+
+// begin начинает запись в переиспользуемом буфере
+func (w *WAL) begin(kind byte, name string) []byte {
+	rec := append(w.buf[:0], kind)
+	rec = binary.AppendUvarint(rec, uint64(len(name)))
+	return append(rec, name...)
+}
+
+// append дописывает запись со временем t и контрольной суммой одним вызовом write.
+// Нулевое время записывается как 0.
+func (w *WAL) append(rec []byte, t time.Time) error {
+	var ns int64
+	if !t.IsZero() {
+		ns = t.UnixNano()
+	}
+	rec = binary.AppendVarint(rec, ns)
+	rec = binary.LittleEndian.AppendUint32(rec, crc32.ChecksumIEEE(rec))
+	w.buf = rec
+	if w.f == nil {
+		return errors.New("журнал закрыт")
+	}
+	if _, err := w.f.Write(rec); err != nil {
+		return fmt.Errorf("не удалось записать журнал: %w", err)
+	}
+	if w.record != nil {
+		w.record(int64(len(rec)))
+	}
+	return nil
+}
+
+// Checkpoint сохраняет снимок функцией save и начинает журнал заново.
+// На время сохранения обновления ожидают, чтобы ни одно из них не попало
+// одновременно в снимок и в новый журнал.
+func (w *WAL) Checkpoint(save func() error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := save(); err != nil {
+		return err
+	}
+	if w.f == nil {
+		return nil
+	}
+	// Файл открыт без O_APPEND, поэтому после усечения переходим в его конец
+	if err := w.f.Truncate(int64(len(walMagic))); err != nil {
+		return err
+	}
+	_, err := w.f.Seek(0, io.SeekEnd)
+	return err
+}
+
+// Close закрывает файл журнала
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+// Unwrap возвращает обёрнутое хранилище
+func (w *WAL) Unwrap() Storage {
+	return w.Storage
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWALReplay(t *testing.T) {
+	tests := []struct {
+		name string
+		// damage портит журнал после записи обновлений
+		damage       func(t *testing.T, path string)
+		wantGauges   map[string]float64
+		wantCounters map[string]int64
+	}{
+		{
+			name:         "целый журнал",
+			wantGauges:   map[string]float64{"cpu": 2},
+			wantCounters: map[string]int64{"hits": 6},
+		},
+		{
+			name:         "оборванная запись",
+			damage:       func(t *testing.T, path string) { truncateBy(t, path, 3) },
+			wantGauges:   map[string]float64{"cpu": 2},
+			wantCounters: map[string]int64{"hits": 1},
+		},
+		{
+			name: "повреждённая контрольная сумма",
+			damage: func(t *testing.T, path string) {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data[len(data)-1] ^= 0xff
+				if err := os.WriteFile(path, data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantGauges:   map[string]float64{"cpu": 2},
+			wantCounters: map[string]int64{"hits": 1},
+		},
+		{
+			name:         "только заголовок",
+			damage:       func(t *testing.T, path string) { os.Truncate(path, int64(len(walMagic))) },
+			wantGauges:   map[string]float64{},
+			wantCounters: map[string]int64{},
+		},
+		{
+			name:         "пустой файл",
+			damage:       func(t *testing.T, path string) { os.Truncate(path, 0) },
+			wantGauges:   map[string]float64{},
+			wantCounters: map[string]int64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "wal")
+			w, err := OpenWAL(ctx, NewMemStorage(), path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.UpdateGauge(ctx, "cpu", 1)
+			w.UpdateCounter(ctx, "hits", 1)
+			w.UpdateGauge(ctx, "cpu", 2)
+			w.UpdateCounter(ctx, "hits", 5)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.damage != nil {
+				tt.damage(t, path)
+			}
+
+			s := NewMemStorage()
+			w, err = OpenWAL(ctx, s, path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkMetrics(t, s, tt.wantGauges, tt.wantCounters)
+
+			// Запись продолжается после целой части журнала
+			if err := w.UpdateCounter(ctx, "after", 1); err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+			s = NewMemStorage()
+			w, err = OpenWAL(ctx, s, path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			wantCounters := map[string]int64{"after": 1}
+			for name, d := range tt.wantCounters {
+				wantCounters[name] = d
+			}
+			checkMetrics(t, s, tt.wantGauges, wantCounters)
+		})
+	}
+}
+
+func TestWALCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	walPath, snapPath := filepath.Join(dir, "wal"), filepath.Join(dir, "snapshot")
+	mem := NewMemStorage()
+	w, err := OpenWAL(ctx, mem, walPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.UpdateCounter(ctx, "hits", 2)
+	if err := w.Checkpoint(func() error {
+		_, err := SaveFile(ctx, mem, snapPath, FormatBinary)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	w.UpdateCounter(ctx, "hits", 3)
+	w.Close()
+
+	// Снимок и журнал вместе дают каждое обновление ровно один раз
+	s := NewMemStorage()
+	if err := LoadFile(ctx, s, snapPath); err != nil {
+		t.Fatal(err)
+	}
+	w, err = OpenWAL(ctx, s, walPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	checkMetrics(t, s, map[string]float64{}, map[string]int64{"hits": 5})
+}
+
+func TestWALUpgradesV1(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "wal")
+	// Журнал первой версии: записи без времени
+	data := []byte(walMagicV1)
+	rec := binary.AppendUvarint([]byte{compactGauge}, 3)
+	rec = append(rec, "cpu"...)
+	rec = binary.LittleEndian.AppendUint64(rec, math.Float64bits(0.5))
+	data = append(data, binary.LittleEndian.AppendUint32(rec, crc32.ChecksumIEEE(rec))...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewMemStorage()
+	w, err := OpenWAL(ctx, s, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	checkMetrics(t, s, map[string]float64{"cpu": 0.5}, map[string]int64{})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !isCurrentWAL(f) {
+		t.Error("журнал первой версии не переписан")
+	}
+	var records []WALRecord
+	if _, err := ReadWAL(f, func(rec WALRecord) error {
+		records = append(records, rec)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Metric.ID != "cpu" || !records[0].Time.IsZero() {
+		t.Errorf("записи после перезаписи %+v", records)
+	}
+}
+
+// truncateBy укорачивает файл path на n байт
+func truncateBy(t *testing.T, path string, n int64) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkMetrics сравнивает метрики хранилища с ожидаемыми
+func checkMetrics(t *testing.T, s Storage, gauges map[string]float64, counters map[string]int64) {
+	t.Helper()
+	gotGauges, gotCounters, err := s.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotGauges, gauges) || !reflect.DeepEqual(gotCounters, counters) {
+		t.Errorf("метрики %v %v, ожидалось %v %v", gotGauges, gotCounters, gauges, counters)
+	}
+}
@@ -0,0 +1,90 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Кодирование событий потока, параметр encoding
+const (
+	// EncodingJSON событие metric с метрикой в формате JSON (по умолчанию)
+	EncodingJSON = "json"
+	// EncodingDelta компактные события для реплик: см. deltaEncoder
+	EncodingDelta = "delta"
+)
+
+// deltaEncoder кодирует события одного потока по рядам. Ряд получает номер
+// при первом обновлении в потоке (событие series с объявлением Series), а
+// обновления ряда передаются событием delta: «номер значение». Для gauge
+// значение передаётся целиком, для counter — разность с итоговым значением,
+// переданным этим потоком ранее, поэтому частые обновления занимают
+// несколько байт и хорошо сжимаются. Номера рядов и значения действуют
+// только в пределах соединения: после переподключения ряды объявляются заново.
+type deltaEncoder struct {
+	series map[seriesKey]*deltaSeries
+}
+
+// Series объявление ряда в событии series. Объявление передаётся в формате
+// JSON: имя метрики с переводом строки не может завершить событие раньше
+// времени и подставить в поток чужие события.
+type Series struct {
+	Index int    `json:"index"`
+	MType string `json:"type"`
+	ID    string `json:"id"`
+}
+
+// seriesKey ряд потока
+type seriesKey struct {
+	mType string
+	name  string
+}
+
+// deltaSeries номер ряда и последнее переданное итоговое значение counter
+type deltaSeries struct {
+	index int
+	total int64
+}
+
+// newDeltaEncoder создаёт кодировщик потока без объявленных рядов
+func newDeltaEncoder() *deltaEncoder {
+	return &deltaEncoder{series: make(map[seriesKey]*deltaSeries)}
+}
+
+// write записывает событие e, при необходимости объявляя его ряд
+func (d *deltaEncoder) write(w io.Writer, f Filter, e Event) {
+	m := e.Metric
+	name := m.ID
+	if f.Tenant != "" {
+		name, _ = tenant.Unscope(f.Tenant, name)
+	}
+	key := seriesKey{mType: m.MType, name: name}
+	s, ok := d.series[key]
+	if !ok {
+		s = &deltaSeries{index: len(d.series)}
+		d.series[key] = s
+		data, _ := json.Marshal(Series{Index: s.index, MType: m.MType, ID: name})
+		fmt.Fprintf(w, "event: series\ndata: %s\n\n", data)
+	}
+	var value string
+	switch {
+	case m.MType == models.Gauge && m.Value != nil:
+		value = strconv.FormatFloat(*m.Value, 'g', -1, 64)
+	case m.MType == models.Counter && m.Delta != nil:
+		value = strconv.FormatInt(*m.Delta-s.total, 10)
+		s.total = *m.Delta
+	default:
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: delta\ndata: %d %s\n\n", e.ID, s.index, value)
+}
+
+// writeHead сообщает номер последнего опубликованного обновления, по
+// которому реплика оценивает своё отставание
+func writeHead(w io.Writer, id uint64) {
+	fmt.Fprintf(w, "event: head\ndata: %d\n\n", id)
+}
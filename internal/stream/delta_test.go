@@ -0,0 +1,59 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+func TestDeltaEncoderEscapesNames(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{name: "обычное имя", id: "cpu"},
+		{name: "перевод строки", id: "x\n\nevent: series\ndata: 0 counter victim"},
+		{name: "возврат каретки", id: "x\r\ndata: 1"},
+		{name: "пробелы", id: "a b c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := newDeltaEncoder()
+			enc.write(&buf, Filter{}, Event{ID: 1, Metric: models.NewCounter(tt.id, 5)})
+
+			events := strings.Split(strings.TrimSuffix(buf.String(), "\n\n"), "\n\n")
+			if len(events) != 2 {
+				t.Fatalf("событий %d, ожидалось 2: %q", len(events), buf.String())
+			}
+			lines := strings.Split(events[0], "\n")
+			if len(lines) != 2 || lines[0] != "event: series" {
+				t.Fatalf("неверное объявление ряда: %q", events[0])
+			}
+			var s Series
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &s); err != nil {
+				t.Fatalf("объявление ряда: %v", err)
+			}
+			if s != (Series{Index: 0, MType: models.Counter, ID: tt.id}) {
+				t.Errorf("объявлен ряд %+v", s)
+			}
+			if events[1] != "id: 1\nevent: delta\ndata: 0 5" {
+				t.Errorf("неверное событие delta: %q", events[1])
+			}
+		})
+	}
+}
+
+func TestDeltaEncoderCounterDifference(t *testing.T) {
+	var buf bytes.Buffer
+	enc := newDeltaEncoder()
+	enc.write(&buf, Filter{}, Event{ID: 1, Metric: models.NewCounter("hits", 10)})
+	buf.Reset()
+	enc.write(&buf, Filter{}, Event{ID: 2, Metric: models.NewCounter("hits", 13)})
+	if got := buf.String(); got != "id: 2\nevent: delta\ndata: 0 3\n\n" {
+		t.Errorf("второе обновление %q", got)
+	}
+}
@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// keepAliveInterval частота комментариев, не дающих прокси закрыть простаивающий поток
+const keepAliveInterval = 15 * time.Second
+
+// retryMillis пауза перед переподключением, которую сервер сообщает клиенту
+const retryMillis = 3000
+
+// EventsHandler обработчик GET /events: отправляет обновления метрик как
+// Server-Sent Events. Каждое событие metric содержит метрику в формате JSON
+// и её номер; при переподключении с заголовком Last-Event-ID клиент получает
+// пропущенные обновления, если они ещё хранятся. Если часть пропущенных
+// обновлений уже не хранится, первым приходит событие reset: клиенту нужно
+// заново прочитать текущие значения. Параметры prefix и type работают
+// так же, как у /ws/metrics. С encoding=delta события передаются
+// компактно по рядам (см. deltaEncoder), а вместо комментариев keep-alive
+// приходят события head с номером последнего обновления.
+func (h *Hub) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	f, ok := parseFilter(w, r)
+	if !ok {
+		return
+	}
+
+	var enc *deltaEncoder
+	switch r.URL.Query().Get("encoding") {
+	case "", EncodingJSON:
+	case EncodingDelta:
+		enc = newDeltaEncoder()
+	default:
+		http.Error(w, "Неверное значение encoding: json или delta.", http.StatusBadRequest)
+		return
+	}
+	write := func(e Event) {
+		if enc != nil {
+			enc.write(w, f, e)
+			return
+		}
+		writeEvent(w, e.ID, f.payload(e))
+	}
+
+	var after uint64
+	v := r.Header.Get("Last-Event-ID")
+	if v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Неверный Last-Event-ID.", http.StatusBadRequest)
+			return
+		}
+		after = id
+	}
+
+	rc := http.NewResponseController(w)
+	// Поток длится дольше -write-timeout сервера
+	rc.SetWriteDeadline(time.Time{})
+	s, backlog, complete := h.subscribe(f, after, v != "")
+	defer h.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", retryMillis)
+	if !complete {
+		fmt.Fprintf(w, "event: reset\ndata: %d\n\n", h.LastID())
+	}
+	for _, e := range backlog {
+		write(e)
+	}
+	if enc != nil {
+		writeHead(w, h.LastID())
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.slow:
+			return
+		case <-keepAlive.C:
+			if enc != nil {
+				writeHead(w, h.LastID())
+			} else {
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+		case e := <-s.events:
+			write(e)
+			// Накопившиеся обновления отправляются одним пакетом: так
+			// меньше сбросов буфера и лучше сжатие
+			for n := len(s.events); n > 0; n-- {
+				write(<-s.events)
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent записывает одно событие в формате text/event-stream
+func writeEvent(w http.ResponseWriter, id uint64, data []byte) {
+	fmt.Fprintf(w, "id: %d\nevent: metric\ndata: %s\n\n", id, data)
+}
@@ -0,0 +1,174 @@
+// Package stream рассылает принятые обновления метрик подписчикам
+// по WebSocket и Server-Sent Events
+package stream
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/iliodor1/metrics-service/internal/tenant"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+const (
+	// bufferSize число обновлений, которые подписчик может не успеть забрать.
+	// Подписчик, отставший сильнее, отключается: клиент переподключится
+	// и получит свежие значения, а сервер не копит для него очередь.
+	bufferSize = 256
+	// replaySize число последних обновлений, хранимых для переподключения
+	// по Last-Event-ID
+	replaySize = 1024
+)
+
+// Event обновление метрики с порядковым номером
+type Event struct {
+	ID     uint64
+	Metric models.Metrics
+	// data метрика в формате JSON
+	data []byte
+}
+
+// Filter отбор обновлений для подписчика
+type Filter struct {
+	// Prefix префикс имени метрики (пустой — все метрики)
+	Prefix string
+	// Type тип метрики (пустой — оба типа)
+	Type string
+	// Tenant арендатор подписчика: он видит только свои метрики
+	Tenant string
+}
+
+// Match проверяет, подходит ли метрика под фильтр
+func (f Filter) Match(m models.Metrics) bool {
+	return strings.HasPrefix(m.ID, tenant.Scope(f.Tenant, f.Prefix)) && (f.Type == "" || f.Type == m.MType)
+}
+
+// payload возвращает сообщение с обновлением для подписчика:
+// арендатор получает имя метрики без своего префикса
+func (f Filter) payload(e Event) []byte {
+	if f.Tenant == "" {
+		return e.data
+	}
+	m := e.Metric
+	m.ID, _ = tenant.Unscope(f.Tenant, m.ID)
+	data, _ := json.Marshal(m)
+	return data
+}
+
+// parseFilter читает фильтр из параметров prefix и type и арендатора запроса
+func parseFilter(w http.ResponseWriter, r *http.Request) (Filter, bool) {
+	f := Filter{
+		Prefix: r.URL.Query().Get("prefix"),
+		Type:   r.URL.Query().Get("type"),
+		Tenant: tenant.FromContext(r.Context()),
+	}
+	if f.Type != "" && f.Type != models.Gauge && f.Type != models.Counter {
+		http.Error(w, "Неподдерживаемый тип метрики. Допустимые типы: gauge, counter.", http.StatusBadRequest)
+		return f, false
+	}
+	return f, true
+}
+
+// subscriber подписчик на обновления
+type subscriber struct {
+	filter Filter
+	events chan Event
+	// slow закрывается, когда подписчик не успевает забирать обновления
+	slow chan struct{}
+	once sync.Once
+}
+
+// Hub брокер обновлений метрик: хранилище публикует в него каждое принятое
+// обновление, а обработчики потоков подписываются на него
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[*subscriber]struct{}
+	seq    uint64
+	replay []Event
+}
+
+// NewHub создаёт брокер без подписчиков
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*subscriber]struct{})}
+}
+
+// Publish присваивает обновлению номер и отправляет его всем подходящим
+// подписчикам. Не блокируется на медленных подписчиках.
+func (h *Hub) Publish(m models.Metrics) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	e := Event{ID: h.seq, Metric: m, data: data}
+	if len(h.replay) == replaySize {
+		h.replay = append(h.replay[:0], h.replay[1:]...)
+	}
+	h.replay = append(h.replay, e)
+
+	for s := range h.subs {
+		if !s.filter.Match(m) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			s.once.Do(func() { close(s.slow) })
+		}
+	}
+}
+
+// subscribe добавляет подписчика. Если resume, возвращает подходящие
+// обновления с номерами больше after, которые ещё хранятся для переподключения,
+// и false, если часть обновлений после after уже не хранится или сервер
+// перезапускался и номера начались заново.
+func (h *Hub) subscribe(f Filter, after uint64, resume bool) (*subscriber, []Event, bool) {
+	s := &subscriber{filter: f, events: make(chan Event, bufferSize), slow: make(chan struct{})}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[s] = struct{}{}
+	if !resume {
+		return s, nil, true
+	}
+	if after > h.seq || (len(h.replay) > 0 && h.replay[0].ID > after+1) {
+		return s, nil, false
+	}
+	var backlog []Event
+	for _, e := range h.replay {
+		if e.ID > after && f.Match(e.Metric) {
+			backlog = append(backlog, e)
+		}
+	}
+	return s, backlog, true
+}
+
+// LastID возвращает номер последнего опубликованного обновления.
+// Все обновления с номерами не больше него уже применены к хранилищу.
+func (h *Hub) LastID() uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.seq
+}
+
+// Close отключает всех подписчиков, чтобы остановка сервера не ждала
+// бесконечных потоков; клиенты переподключатся сами
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		s.once.Do(func() { close(s.slow) })
+	}
+}
+
+// unsubscribe удаляет подписчика
+func (h *Hub) unsubscribe(s *subscriber) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
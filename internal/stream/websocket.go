@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/iliodor1/metrics-service/internal/websocket"
+)
+
+// Handler обработчик GET /ws/metrics: переводит соединение на WebSocket и
+// отправляет каждое принятое обновление метрики отдельным сообщением JSON.
+// Параметры prefix и type ограничивают поток метриками с префиксом имени и типом.
+func (h *Hub) Handler(w http.ResponseWriter, r *http.Request) {
+	f, ok := parseFilter(w, r)
+	if !ok {
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	s, _, _ := h.subscribe(f, 0, false)
+	defer h.unsubscribe(s)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := conn.ReadLoop(); err != nil {
+			log.Printf("Подписчик %s отключился: %v", r.RemoteAddr, err)
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-s.slow:
+			conn.Close(websocket.CloseTryAgain)
+			<-done
+			return
+		case e := <-s.events:
+			if err := conn.WriteText(f.payload(e)); err != nil {
+				<-done
+				return
+			}
+		}
+	}
+}
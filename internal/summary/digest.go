@@ -0,0 +1,143 @@
+package summary
+
+import (
+	"math"
+	"sort"
+)
+
+// Параметры t-digest
+const (
+	// compression точность оценки: чем больше, тем больше центроидов
+	// и точнее квантили; 100 даёт ошибку порядка 0.1% у хвостов
+	compression = 100
+	// bufferSize число наблюдений, накапливаемых до слияния с центроидами
+	bufferSize = 5 * compression
+)
+
+// centroid центр группы наблюдений и их число
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// digest потоковая оценка квантилей t-digest (вариант со слиянием, Dunning).
+// Наблюдения объединяются в центроиды, размер которых ограничен тем сильнее,
+// чем ближе они к краям распределения, поэтому хвосты (p99) оцениваются
+// точнее середины при памяти O(compression).
+type digest struct {
+	centroids []centroid
+	buffer    []float64
+	count     float64
+	min, max  float64
+}
+
+// add добавляет наблюдение
+func (d *digest) add(x float64) {
+	if d.count == 0 || x < d.min {
+		d.min = x
+	}
+	if d.count == 0 || x > d.max {
+		d.max = x
+	}
+	d.count++
+	d.buffer = append(d.buffer, x)
+	if len(d.buffer) >= bufferSize {
+		d.compress()
+	}
+}
+
+// scale функция масштаба k1: допустимый размер центроида
+// в пространстве квантилей
+func scale(q float64) float64 {
+	return compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// scaleInverse обратная к scale
+func scaleInverse(k float64) float64 {
+	return (math.Sin(k*2*math.Pi/compression) + 1) / 2
+}
+
+// merged сообщает, что все наблюдения слиты с центроидами
+func (d *digest) merged() bool {
+	return len(d.buffer) == 0
+}
+
+// compress сливает накопленные наблюдения с центроидами
+func (d *digest) compress() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	all := make([]centroid, 0, len(d.centroids)+len(d.buffer))
+	all = append(all, d.centroids...)
+	for _, x := range d.buffer {
+		all = append(all, centroid{mean: x, weight: 1})
+	}
+	d.buffer = d.buffer[:0]
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := all[:1]
+	before := 0.0
+	limit := d.count * scaleInverse(scale(0)+1)
+	for _, c := range all[1:] {
+		last := &merged[len(merged)-1]
+		if before+last.weight+c.weight <= limit {
+			last.weight += c.weight
+			last.mean += (c.mean - last.mean) * c.weight / last.weight
+			continue
+		}
+		before += last.weight
+		limit = d.count * scaleInverse(scale(before/d.count)+1)
+		merged = append(merged, c)
+	}
+	d.centroids = append(d.centroids[:0], merged...)
+}
+
+// quantiles оценивает квантили qs распределения, один раз сливая
+// накопленные наблюдения
+func (d *digest) quantiles(qs []float64) []float64 {
+	d.compress()
+	values := make([]float64, len(qs))
+	for i, q := range qs {
+		values[i] = d.quantile(q)
+	}
+	return values
+}
+
+// quantile оценивает квантиль q распределения по центроидам; NaN, если
+// наблюдений нет. Вызывается после compress.
+func (d *digest) quantile(q float64) float64 {
+	if d.count == 0 {
+		return math.NaN()
+	}
+	cs := d.centroids
+	if len(cs) == 1 || q <= 0 {
+		if q >= 1 {
+			return d.max
+		}
+		if len(cs) == 1 {
+			return cs[0].mean
+		}
+		return d.min
+	}
+	if q >= 1 {
+		return d.max
+	}
+
+	// Наблюдения центроида считаются распределёнными вокруг его центра:
+	// между центрами соседних центроидов значение интерполируется линейно,
+	// а у краёв — между центроидом и наименьшим (наибольшим) наблюдением
+	index := q * d.count
+	if first := cs[0].weight / 2; index < first {
+		return d.min + (cs[0].mean-d.min)*index/first
+	}
+	cumulative := cs[0].weight / 2
+	for i := 1; i < len(cs); i++ {
+		step := (cs[i-1].weight + cs[i].weight) / 2
+		if index < cumulative+step {
+			return cs[i-1].mean + (cs[i].mean-cs[i-1].mean)*(index-cumulative)/step
+		}
+		cumulative += step
+	}
+	lastHalf := cs[len(cs)-1].weight / 2
+	return cs[len(cs)-1].mean + (d.max-cs[len(cs)-1].mean)*(index-cumulative)/lastHalf
+}
@@ -0,0 +1,96 @@
+package summary
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestDigestAccuracy(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		gen  func(r *rand.Rand) float64
+	}{
+		{name: "равномерное", n: 100000, gen: func(r *rand.Rand) float64 { return r.Float64() }},
+		{name: "нормальное", n: 100000, gen: func(r *rand.Rand) float64 { return 100 + 15*r.NormFloat64() }},
+		{name: "экспоненциальное", n: 100000, gen: func(r *rand.Rand) float64 { return r.ExpFloat64() }},
+		{name: "меньше буфера", n: 300, gen: func(r *rand.Rand) float64 { return r.Float64() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			var d digest
+			values := make([]float64, tt.n)
+			for i := range values {
+				values[i] = tt.gen(r)
+				d.add(values[i])
+			}
+			sort.Float64s(values)
+
+			qs := []float64{0.01, 0.1, 0.5, 0.9, 0.99, 0.999}
+			got := d.quantiles(qs)
+			for i, q := range qs {
+				// Ошибка измеряется в рангах: доля наблюдений между точным
+				// квантилем и оценкой. У хвостов t-digest точнее, чем в середине.
+				rank := float64(sort.SearchFloat64s(values, got[i])) / float64(tt.n)
+				maxErr := 0.005
+				if q < 0.05 || q > 0.95 {
+					maxErr = 0.001
+				}
+				if math.Abs(rank-q) > maxErr+1/float64(tt.n) {
+					t.Errorf("квантиль %v: оценка %v имеет ранг %v", q, got[i], rank)
+				}
+			}
+			if got := d.quantiles([]float64{0, 1}); got[0] != values[0] || got[1] != values[tt.n-1] {
+				t.Errorf("крайние квантили %v, ожидались %v и %v", got, values[0], values[tt.n-1])
+			}
+			if len(d.centroids) > 2*compression {
+				t.Errorf("центроидов %d, ожидалось не больше %d", len(d.centroids), 2*compression)
+			}
+		})
+	}
+}
+
+func TestDigestSmall(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		q      float64
+		want   float64
+	}{
+		{name: "нет наблюдений", q: 0.5, want: math.NaN()},
+		{name: "одно наблюдение", values: []float64{7}, q: 0.99, want: 7},
+		{name: "одинаковые", values: []float64{3, 3, 3}, q: 0.5, want: 3},
+		{name: "медиана двух", values: []float64{1, 3}, q: 0.5, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d digest
+			for _, v := range tt.values {
+				d.add(v)
+			}
+			got := d.quantiles([]float64{tt.q})[0]
+			if got != tt.want && !(math.IsNaN(got) && math.IsNaN(tt.want)) {
+				t.Errorf("квантиль %v = %v, ожидался %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestBuffer(t *testing.T) {
+	// Наблюдения сливаются с центроидами, только когда буфер заполнен
+	// или нужны оценки
+	var d digest
+	for i := 0; i < bufferSize-1; i++ {
+		d.add(float64(i))
+	}
+	if d.merged() || len(d.centroids) != 0 {
+		t.Fatal("наблюдения слиты до заполнения буфера")
+	}
+	d.add(bufferSize)
+	if !d.merged() {
+		t.Fatal("полный буфер не слит")
+	}
+}
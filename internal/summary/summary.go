@@ -0,0 +1,196 @@
+// Package summary реализует метрики типа summary: обновление записывает
+// наблюдение (например, задержку запроса), а чтение возвращает число
+// наблюдений, их сумму и оценки квантилей.
+//
+// Summary хранится в обычном хранилище рядами в духе Prometheus:
+//
+//	latency_count                 counter, число наблюдений
+//	latency_sum                   gauge, сумма наблюдений
+//	latency{quantile=0.5}         gauge, оценка квантиля (также 0.9 и 0.99)
+//
+// поэтому переживает перезапуск вместе со снимком, реплицируется и читается
+// обычным API. Квантили оцениваются потоковым t-digest в памяти процесса:
+// после перезапуска оценка начинается заново, а число и сумма продолжаются.
+// Число и сумма записываются при каждом наблюдении, а оценки квантилей —
+// когда t-digest сливает накопленные наблюдения, но не реже раза
+// в quantileInterval, пока наблюдения поступают.
+package summary
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// Окончания имён и метка рядов summary
+const (
+	CountSuffix   = "_count"
+	SumSuffix     = "_sum"
+	QuantileLabel = "quantile"
+)
+
+// Quantiles оцениваемые квантили
+var Quantiles = []float64{0.5, 0.9, 0.99}
+
+// quantileInterval наибольший промежуток между записями оценок квантилей
+// при непрерывных наблюдениях
+const quantileInterval = time.Second
+
+// Store хранилище рядов summary
+type Store interface {
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+	GetGauge(ctx context.Context, name string) (float64, error)
+	GetCounter(ctx context.Context, name string) (int64, error)
+}
+
+// Names имена рядов summary
+type Names struct {
+	Count     string
+	Sum       string
+	Quantiles []string
+}
+
+// NamesOf возвращает имена рядов summary name. Метки имени сохраняются
+// у всех рядов: latency{route=/a} хранится в latency_count{route=/a} и т. д.
+func NamesOf(name string) Names {
+	base, set, _ := labels.Parse(name)
+	n := Names{Count: labels.Format(base+CountSuffix, set), Sum: labels.Format(base+SumSuffix, set)}
+	for _, q := range Quantiles {
+		qs := make(map[string]string, len(set)+1)
+		for k, v := range set {
+			qs[k] = v
+		}
+		qs[QuantileLabel] = strconv.FormatFloat(q, 'g', -1, 64)
+		n.Quantiles = append(n.Quantiles, labels.Format(base, qs))
+	}
+	return n
+}
+
+// series оценка квантилей и сумма одного summary
+type series struct {
+	// mu защищает оценку и сумму; write упорядочивает запись рядов
+	// в хранилище и захватывается до освобождения mu, поэтому значения
+	// записываются в порядке наблюдений
+	mu    sync.Mutex
+	write sync.Mutex
+	// loaded сумма прочитана из хранилища
+	loaded bool
+	digest digest
+	sum    float64
+	// written время последней записи оценок квантилей
+	written time.Time
+}
+
+// Registry оценки квантилей summary процесса. Наблюдения разных summary
+// не ждут друг друга.
+type Registry struct {
+	mu     sync.Mutex
+	series map[string]*series
+	now    func() time.Time
+}
+
+// New создаёт реестр без summary
+func New() *Registry {
+	return &Registry{series: make(map[string]*series), now: time.Now}
+}
+
+// get возвращает оценку summary name, создавая её при первом наблюдении
+func (r *Registry) get(name string) *series {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sr, ok := r.series[name]
+	if !ok {
+		sr = &series{}
+		r.series[name] = sr
+	}
+	return sr
+}
+
+// Observe записывает наблюдение v summary name и обновляет его ряды в s.
+// Первым увеличивается число наблюдений: если хранилище отказало
+// (ограничения, заморозка), наблюдение не учитывается.
+func (r *Registry) Observe(ctx context.Context, s Store, name string, v float64) error {
+	n := NamesOf(name)
+	if err := s.UpdateCounter(ctx, n.Count, 1); err != nil {
+		return err
+	}
+
+	sr := r.get(name)
+	sr.mu.Lock()
+	if !sr.loaded {
+		// Сумма продолжается с сохранённой до перезапуска
+		sum, err := s.GetGauge(ctx, n.Sum)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			sr.mu.Unlock()
+			return err
+		}
+		sr.sum, sr.loaded = sum, true
+	}
+	sr.digest.add(v)
+	sr.sum += v
+	sum := sr.sum
+	var quantiles []float64
+	if now := r.now(); sr.digest.merged() || now.Sub(sr.written) >= quantileInterval {
+		quantiles = sr.digest.quantiles(Quantiles)
+		sr.written = now
+	}
+	sr.write.Lock()
+	sr.mu.Unlock()
+	defer sr.write.Unlock()
+
+	if err := s.UpdateGauge(ctx, n.Sum, sum); err != nil {
+		return err
+	}
+	for i, q := range quantiles {
+		if err := s.UpdateGauge(ctx, n.Quantiles[i], q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Quantile оценка одного квантиля
+type Quantile struct {
+	Q     float64
+	Value float64
+}
+
+// Value значение summary
+type Value struct {
+	Count int64
+	Sum   float64
+	// Quantiles оценки квантилей; NaN, если оценки ещё нет
+	Quantiles []Quantile
+}
+
+// Read читает значение summary name из рядов в s. Если наблюдений
+// не было, возвращается storage.ErrNotFound.
+func Read(ctx context.Context, s Store, name string) (Value, error) {
+	n := NamesOf(name)
+	count, err := s.GetCounter(ctx, n.Count)
+	if err != nil {
+		return Value{}, err
+	}
+	v := Value{Count: count}
+	if v.Sum, err = s.GetGauge(ctx, n.Sum); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return Value{}, err
+	}
+	for i, q := range Quantiles {
+		value, err := s.GetGauge(ctx, n.Quantiles[i])
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			value = math.NaN()
+		case err != nil:
+			return Value{}, err
+		}
+		v.Quantiles = append(v.Quantiles, Quantile{Q: q, Value: value})
+	}
+	return v, nil
+}
@@ -0,0 +1,108 @@
+package summary
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// countingStore считает записи gauge в хранилище
+type countingStore struct {
+	*storage.MemStorage
+	mu     sync.Mutex
+	gauges map[string]int
+}
+
+func (s *countingStore) UpdateGauge(ctx context.Context, name string, value float64) error {
+	s.mu.Lock()
+	s.gauges[name]++
+	s.mu.Unlock()
+	return s.MemStorage.UpdateGauge(ctx, name, value)
+}
+
+func TestObserveQuantileWrites(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		// step время между наблюдениями
+		step time.Duration
+		want int
+	}{
+		{name: "первое наблюдение", n: 1, want: 1},
+		{name: "подряд до слияния", n: bufferSize, want: 1},
+		{name: "подряд со слиянием", n: 2*bufferSize + 1, want: 3},
+		{name: "раз в интервал", n: 5, step: quantileInterval, want: 5},
+		{name: "чаще интервала", n: 10, step: quantileInterval / 4, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := &countingStore{MemStorage: storage.NewMemStorage(), gauges: make(map[string]int)}
+			r := New()
+			now := time.Unix(0, 0)
+			r.now = func() time.Time { return now }
+			for i := 0; i < tt.n; i++ {
+				if err := r.Observe(ctx, s, "latency", float64(i)); err != nil {
+					t.Fatal(err)
+				}
+				now = now.Add(tt.step)
+			}
+
+			n := NamesOf("latency")
+			if got := s.gauges[n.Sum]; got != tt.n {
+				t.Errorf("сумма записана %d раз, ожидалось %d", got, tt.n)
+			}
+			for _, q := range n.Quantiles {
+				if got := s.gauges[q]; got != tt.want {
+					t.Errorf("%s записан %d раз, ожидалось %d", q, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestObserveConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemStorage()
+	// Сумма продолжается с сохранённой до перезапуска
+	if err := s.UpdateGauge(ctx, "b_sum", 100); err != nil {
+		t.Fatal(err)
+	}
+	r := New()
+	const perSeries = 1000
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b"} {
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < perSeries/4; i++ {
+					if err := r.Observe(ctx, s, name, 1); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for name, wantSum := range map[string]float64{"a": perSeries, "b": perSeries + 100} {
+		v, err := Read(ctx, s, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Count != perSeries || v.Sum != wantSum {
+			t.Errorf("%s: число %d, сумма %v; ожидалось %d, %v", name, v.Count, v.Sum, perSeries, wantSum)
+		}
+		for _, q := range v.Quantiles {
+			if q.Value != 1 {
+				t.Errorf("%s: квантиль %s = %v, ожидалась 1", name, strconv.FormatFloat(q.Q, 'g', -1, 64), q.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Package synthetic генерирует правдоподобные меняющиеся ряды метрик,
+// чтобы настраивать панели и правила оповещений до подключения агентов.
+package synthetic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Виды рядов
+const (
+	// Sine синусоида с периодом Period между Min и Max
+	Sine = "sine"
+	// Walk случайное блуждание между Min и Max с шагом Step
+	Walk = "walk"
+	// Spikes значения около Min с редкими всплесками до Max
+	Spikes = "spikes"
+	// Counter counter, растущий в среднем на Rate в секунду
+	Counter = "counter"
+)
+
+// Kinds допустимые виды рядов
+var Kinds = []string{Sine, Walk, Spikes, Counter}
+
+// Store хранилище, в которое записываются значения
+type Store interface {
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+}
+
+// Config настройки генератора
+type Config struct {
+	// Interval частота обновления рядов, например "1s"
+	Interval string `json:"interval"`
+	// Series ряды; если не заданы, генерируется набор по умолчанию
+	Series []Series `json:"series"`
+}
+
+// Series генерируемый ряд
+type Series struct {
+	// Name имя метрики, может содержать метки: cpu{host=web1}
+	Name string `json:"name"`
+	// Kind вид ряда: sine, walk, spikes или counter
+	Kind string `json:"kind"`
+	// Min и Max границы значений gauge
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	// Period период синусоиды, например "5m"
+	Period string `json:"period,omitempty"`
+	// Step средний шаг случайного блуждания; по умолчанию 2% диапазона
+	Step float64 `json:"step,omitempty"`
+	// Probability вероятность всплеска при каждом обновлении; по умолчанию 0.02
+	Probability float64 `json:"probability,omitempty"`
+	// Rate средний прирост counter в секунду
+	Rate float64 `json:"rate,omitempty"`
+	// Noise доля случайного шума от диапазона (для counter — от Rate)
+	Noise float64 `json:"noise,omitempty"`
+}
+
+// DefaultSeries набор рядов по умолчанию
+func DefaultSeries() []Series {
+	return []Series{
+		{Name: "synthetic_cpu{host=web1}", Kind: Sine, Min: 10, Max: 70, Period: "5m", Noise: 0.05},
+		{Name: "synthetic_cpu{host=web2}", Kind: Sine, Min: 20, Max: 90, Period: "7m", Noise: 0.05},
+		{Name: "synthetic_memory_bytes", Kind: Walk, Min: 256 << 20, Max: 2 << 30},
+		{Name: "synthetic_latency_seconds", Kind: Spikes, Min: 0.05, Max: 2, Noise: 0.01},
+		{Name: "synthetic_requests{status=ok}", Kind: Counter, Rate: 100, Noise: 0.3},
+		{Name: "synthetic_requests{status=error}", Kind: Counter, Rate: 1, Noise: 1},
+	}
+}
+
+// series ряд вместе с состоянием генерации
+type series struct {
+	Series
+	period time.Duration
+	value  float64
+	rnd    *rand.Rand
+}
+
+// validate проверяет ряд и подставляет значения по умолчанию
+func (s *Series) validate() (time.Duration, error) {
+	if err := models.CheckName(s.Name); err != nil {
+		return 0, fmt.Errorf("ряд %q: %w", s.Name, err)
+	}
+	switch s.Kind {
+	case Sine, Walk, Spikes:
+		if !(s.Min < s.Max) {
+			return 0, fmt.Errorf("ряд %s: min должен быть меньше max", s.Name)
+		}
+	case Counter:
+		if s.Rate <= 0 {
+			return 0, fmt.Errorf("ряд %s: rate должен быть больше нуля", s.Name)
+		}
+	default:
+		return 0, fmt.Errorf("ряд %s: вид ряда sine, walk, spikes или counter", s.Name)
+	}
+	if s.Noise < 0 || s.Probability < 0 || s.Probability > 1 || s.Step < 0 {
+		return 0, fmt.Errorf("ряд %s: неверные параметры шума", s.Name)
+	}
+	if s.Kind == Walk && s.Step == 0 {
+		s.Step = (s.Max - s.Min) * 0.02
+	}
+	if s.Kind == Spikes && s.Probability == 0 {
+		s.Probability = 0.02
+	}
+	if s.Kind != Sine {
+		return 0, nil
+	}
+	if s.Period == "" {
+		s.Period = "5m"
+	}
+	period, err := time.ParseDuration(s.Period)
+	if err != nil || period <= 0 {
+		return 0, fmt.Errorf("ряд %s: неверный период %q", s.Name, s.Period)
+	}
+	return period, nil
+}
+
+// Generator периодически записывает значения рядов в хранилище
+type Generator struct {
+	store    Store
+	interval time.Duration
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// New проверяет ряды и создаёт генератор
+func New(store Store, cfg Config) (*Generator, error) {
+	g := &Generator{store: store, interval: time.Second, series: make(map[string]*series)}
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("неверный интервал генерации %q", cfg.Interval)
+		}
+		g.interval = d
+	}
+	list := cfg.Series
+	if len(list) == 0 {
+		list = DefaultSeries()
+	}
+	for _, s := range list {
+		if err := g.Put(s); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Put добавляет ряд или заменяет ряд с тем же именем
+func (g *Generator) Put(s Series) error {
+	period, err := s.validate()
+	if err != nil {
+		return err
+	}
+	sr := &series{Series: s, period: period, rnd: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))}
+	sr.value = s.Min + (s.Max-s.Min)*sr.rnd.Float64()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series[s.Name] = sr
+	return nil
+}
+
+// Delete удаляет ряд; возвращает false, если ряда нет.
+// Уже записанные значения остаются в хранилище.
+func (g *Generator) Delete(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.series[name]; !ok {
+		return false
+	}
+	delete(g.series, name)
+	return true
+}
+
+// Series возвращает ряды, упорядоченные по имени
+func (g *Generator) Series() []Series {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	list := make([]Series, 0, len(g.series))
+	for _, s := range g.series {
+		list = append(list, s.Series)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Run обновляет ряды до отмены контекста
+func (g *Generator) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := g.Tick(ctx, now); err != nil {
+				// Например, хранилище только для чтения: дальше генерировать незачем
+				log.Printf("Генерация тестовых данных остановлена: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// Tick записывает очередные значения всех рядов в момент now
+func (g *Generator) Tick(ctx context.Context, now time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, s := range g.series {
+		var err error
+		if s.Kind == Counter {
+			err = g.store.UpdateCounter(ctx, s.Name, s.delta(g.interval))
+		} else {
+			err = g.store.UpdateGauge(ctx, s.Name, s.next(now))
+		}
+		if err != nil {
+			return fmt.Errorf("ряд %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// next возвращает очередное значение gauge
+func (s *series) next(now time.Time) float64 {
+	span := s.Max - s.Min
+	noise := s.Noise * span * s.rnd.NormFloat64()
+	switch s.Kind {
+	case Sine:
+		phase := 2 * math.Pi * float64(now.UnixNano()%int64(s.period)) / float64(s.period)
+		s.value = s.Min + span*(1+math.Sin(phase))/2 + noise
+	case Walk:
+		s.value += s.Step*s.rnd.NormFloat64() + noise
+		// Отражаем от границ, чтобы ряд не прилипал к ним
+		if s.value > s.Max {
+			s.value = 2*s.Max - s.value
+		}
+		if s.value < s.Min {
+			s.value = 2*s.Min - s.value
+		}
+	case Spikes:
+		s.value = s.Min + math.Abs(noise)
+		if s.rnd.Float64() < s.Probability {
+			s.value = s.Min + span*(0.5+0.5*s.rnd.Float64())
+		}
+	}
+	return math.Max(s.Min, math.Min(s.Max, s.value))
+}
+
+// delta возвращает очередной прирост counter за интервал
+func (s *series) delta(interval time.Duration) int64 {
+	mean := s.Rate * interval.Seconds()
+	d := mean * (1 + s.Noise*s.rnd.NormFloat64())
+	return int64(math.Max(0, math.Round(d)))
+}
+
+// Handler обработчик административного API генератора:
+// GET /admin/synthetic — список рядов,
+// POST /admin/synthetic — добавить или заменить ряд,
+// DELETE /admin/synthetic/{name} — удалить ряд
+func (g *Generator) Handler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(g.Series())
+	case r.Method == http.MethodPost && name == "":
+		var s Series
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, "Неверный формат ряда.", http.StatusBadRequest)
+			return
+		}
+		if err := g.Put(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete && name != "":
+		if !g.Delete(name) {
+			http.Error(w, "Ряд не найден.", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Метод не разрешён.", http.StatusMethodNotAllowed)
+	}
+}
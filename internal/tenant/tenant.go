@@ -0,0 +1,230 @@
+// Package tenant изолирует метрики команд, использующих один сервер:
+// каждый API-ключ принадлежит арендатору, и все имена метрик запросов
+// с этим ключом хранятся с префиксом арендатора.
+package tenant
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/iliodor1/metrics-service/internal/middleware"
+)
+
+// Separator отделяет имя арендатора от имени метрики в хранилище
+const Separator = "/"
+
+// Internal пространство имён собственных метрик сервера; арендатора
+// с таким именем быть не может
+const Internal = "_internal"
+
+// ErrInvalidTenant неверное имя арендатора
+var ErrInvalidTenant = errors.New("имя арендатора должно быть непустым, не содержать " + Separator + " и не совпадать с " + Internal)
+
+// Config настройки арендаторов
+type Config struct {
+	// Keys арендаторы по API-ключам
+	Keys map[string]string `json:"keys"`
+}
+
+// KeyInfo сведения о ключе без самого ключа
+type KeyInfo struct {
+	// ID идентификатор ключа — начало его хеша SHA-256
+	ID     string `json:"id"`
+	Tenant string `json:"tenant"`
+}
+
+// Registry арендаторы по API-ключам
+type Registry struct {
+	mu   sync.RWMutex
+	keys map[string]string
+}
+
+// NewRegistry проверяет настройки и создаёт реестр ключей
+func NewRegistry(cfg Config) (*Registry, error) {
+	r := &Registry{keys: make(map[string]string, len(cfg.Keys))}
+	for key, tenant := range cfg.Keys {
+		if key == "" {
+			return nil, errors.New("пустой API-ключ")
+		}
+		if err := checkTenant(tenant); err != nil {
+			return nil, err
+		}
+		r.keys[key] = tenant
+	}
+	return r, nil
+}
+
+// checkTenant проверяет имя арендатора
+func checkTenant(tenant string) error {
+	if tenant == "" || tenant == Internal || strings.Contains(tenant, Separator) {
+		return ErrInvalidTenant
+	}
+	return nil
+}
+
+// KeyID возвращает идентификатор ключа, по которому им можно управлять
+func KeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Tenant возвращает арендатора ключа
+func (r *Registry) Tenant(key string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenant, ok := r.keys[key]
+	return tenant, ok
+}
+
+// Issue выпускает новый ключ арендатора
+func (r *Registry) Issue(tenant string) (string, error) {
+	if err := checkTenant(tenant); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(buf)
+
+	r.mu.Lock()
+	r.keys[key] = tenant
+	r.mu.Unlock()
+	return key, nil
+}
+
+// Revoke отзывает ключ с идентификатором id
+func (r *Registry) Revoke(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.keys {
+		if KeyID(key) == id {
+			delete(r.keys, key)
+			return true
+		}
+	}
+	return false
+}
+
+// Keys возвращает сведения о ключах, упорядоченные по арендатору
+func (r *Registry) Keys() []KeyInfo {
+	r.mu.RLock()
+	keys := make([]KeyInfo, 0, len(r.keys))
+	for key, tenant := range r.keys {
+		keys = append(keys, KeyInfo{ID: KeyID(key), Tenant: tenant})
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Tenant != keys[j].Tenant {
+			return keys[i].Tenant < keys[j].Tenant
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// tenantKey ключ арендатора в контексте запроса
+type tenantKey struct{}
+
+// FromContext возвращает арендатора запроса; пустая строка — запрос без арендатора
+func FromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// Scope возвращает имя метрики name в хранилище для арендатора tenant
+func Scope(tenant, name string) string {
+	if tenant == "" {
+		return name
+	}
+	return tenant + Separator + name
+}
+
+// Unscope возвращает имя метрики для арендатора tenant по имени в хранилище.
+// Метрики других арендаторов не принадлежат tenant.
+func Unscope(tenant, stored string) (string, bool) {
+	if tenant == "" {
+		return stored, true
+	}
+	return strings.CutPrefix(stored, tenant+Separator)
+}
+
+// Middleware определяет арендатора по API-ключу и передаёт его обработчику
+// в контексте запроса. Запросы без ключа или с неизвестным ключом отклоняются.
+// Арендатор, уже определённый Identify, повторно не ищется.
+func (r *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if FromContext(req.Context()) != "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		tenant, ok := r.Tenant(req.Header.Get(middleware.APIKeyHeader))
+		if !ok {
+			http.Error(w, "Требуется действительный API-ключ.", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), tenantKey{}, tenant)))
+	})
+}
+
+// Identify определяет арендатора по API-ключу, как Middleware, но запросы
+// без ключа или с неизвестным ключом пропускает без арендатора
+func (r *Registry) Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if tenant, ok := r.Tenant(req.Header.Get(middleware.APIKeyHeader)); ok {
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, tenant))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Handler обработчик административного API ключей:
+// GET /admin/tenants/keys — список ключей,
+// POST /admin/tenants/keys — выпуск ключа, тело {"tenant": "..."},
+// DELETE /admin/tenants/keys/{id} — отзыв ключа
+func (r *Registry) Handler(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+
+	switch {
+	case req.Method == http.MethodGet && id == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Keys())
+	case req.Method == http.MethodPost && id == "":
+		var body struct {
+			Tenant string `json:"tenant"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, "Неверный формат запроса.", http.StatusBadRequest)
+			return
+		}
+		key, err := r.Issue(body.Tenant)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrInvalidTenant) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"id": KeyID(key), "tenant": body.Tenant, "key": key})
+	case req.Method == http.MethodDelete && id != "":
+		if !r.Revoke(id) {
+			http.Error(w, "Ключ не найден.", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Метод не разрешён.", http.StatusMethodNotAllowed)
+	}
+}
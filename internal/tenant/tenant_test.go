@@ -0,0 +1,154 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/middleware"
+)
+
+func TestNewRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[string]string
+		wantErr bool
+	}{
+		{name: "арендаторы", keys: map[string]string{"k1": "a", "k2": "b"}},
+		{name: "без ключей"},
+		{name: "пустой ключ", keys: map[string]string{"": "a"}, wantErr: true},
+		{name: "пустой арендатор", keys: map[string]string{"k1": ""}, wantErr: true},
+		{name: "разделитель в имени", keys: map[string]string{"k1": "a/b"}, wantErr: true},
+		{name: "внутреннее имя", keys: map[string]string{"k1": Internal}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegistry(Config{Keys: tt.keys})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRegistry() = %v, ожидалась ошибка: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		tenant, name, stored string
+	}{
+		{tenant: "", name: "cpu", stored: "cpu"},
+		{tenant: "a", name: "cpu", stored: "a/cpu"},
+		{tenant: "a", name: "b/cpu", stored: "a/b/cpu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stored, func(t *testing.T) {
+			if got := Scope(tt.tenant, tt.name); got != tt.stored {
+				t.Errorf("Scope(%q, %q) = %q, ожидалось %q", tt.tenant, tt.name, got, tt.stored)
+			}
+			if got, ok := Unscope(tt.tenant, tt.stored); !ok || got != tt.name {
+				t.Errorf("Unscope(%q, %q) = %q, %t", tt.tenant, tt.stored, got, ok)
+			}
+		})
+	}
+
+	// Метрики других арендаторов и общие метрики арендатору не принадлежат
+	for _, stored := range []string{"b/cpu", "cpu", "ab/cpu"} {
+		if _, ok := Unscope("a", stored); ok {
+			t.Errorf("Unscope(a, %q) отнёс метрику арендатору a", stored)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r, err := NewRegistry(Config{Keys: map[string]string{"k1": "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, err := r.Issue("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantTenant string
+	}{
+		{name: "ключ из настроек", key: "k1", wantStatus: http.StatusOK, wantTenant: "a"},
+		{name: "выпущенный ключ", key: issued, wantStatus: http.StatusOK, wantTenant: "b"},
+		{name: "неизвестный ключ", key: "k2", wantStatus: http.StatusUnauthorized},
+		{name: "без ключа", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				got = FromContext(req.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/value/gauge/cpu", nil)
+			if tt.key != "" {
+				req.Header.Set(middleware.APIKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus || got != tt.wantTenant {
+				t.Errorf("код %d, арендатор %q; ожидалось %d, %q", w.Code, got, tt.wantStatus, tt.wantTenant)
+			}
+		})
+	}
+
+	// Отозванный ключ больше не действует
+	if !r.Revoke(KeyID(issued)) {
+		t.Fatal("ключ не отозван")
+	}
+	if _, ok := r.Tenant(issued); ok {
+		t.Error("отозванный ключ действует")
+	}
+	if FromContext(context.Background()) != "" {
+		t.Error("арендатор в пустом контексте")
+	}
+	if _, err := r.Issue("a/b"); !errors.Is(err, ErrInvalidTenant) {
+		t.Errorf("Issue(a/b) = %v, ожидалась %v", err, ErrInvalidTenant)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	r, err := NewRegistry(Config{Keys: map[string]string{"k1": "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantTenant string
+	}{
+		{name: "известный ключ", key: "k1", wantStatus: http.StatusOK, wantTenant: "a"},
+		{name: "неизвестный ключ", key: "k2", wantStatus: http.StatusUnauthorized},
+		{name: "без ключа", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Identify в цепочке пропускает любой запрос, отклоняет маршрут
+			var inChain, inRoute string
+			route := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				inRoute = FromContext(req.Context())
+			}))
+			h := r.Identify(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				inChain = FromContext(req.Context())
+				route.ServeHTTP(w, req)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/value/gauge/cpu", nil)
+			if tt.key != "" {
+				req.Header.Set(middleware.APIKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus || inChain != tt.wantTenant || inRoute != tt.wantTenant {
+				t.Errorf("код %d, арендатор в цепочке %q, на маршруте %q; ожидалось %d, %q",
+					w.Code, inChain, inRoute, tt.wantStatus, tt.wantTenant)
+			}
+		})
+	}
+}
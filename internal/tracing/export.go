@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Отправка спанов
+const (
+	// queueSize наибольшее число спанов, ожидающих отправки; при
+	// недоступном сборщике лишние спаны отбрасываются
+	queueSize = 4096
+	// batchSize наибольшее число спанов в одном запросе к сборщику
+	batchSize = 512
+	// flushInterval наибольшее время ожидания спана до отправки
+	flushInterval = 5 * time.Second
+	// exportTimeout время ожидания ответа сборщика
+	exportTimeout = 10 * time.Second
+)
+
+// scopeName имя библиотеки инструментирования в отправляемых спанах
+const scopeName = "github.com/iliodor1/metrics-service/internal/tracing"
+
+// exporter отправляет завершённые спаны сборщику OTLP/HTTP пакетами
+type exporter struct {
+	url      string
+	resource []otlpAttr
+	client   *http.Client
+	queue    chan otlpSpan
+	dropped  atomic.Int64
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// New создаёт трассировщик, отправляющий спаны сервиса service сборщику
+// по адресу endpoint, например http://collector:4318: спаны отправляются
+// на endpoint/v1/traces
+func New(endpoint, service string) (*Tracer, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("адрес сборщика OTLP должен начинаться с http:// или https://: %s", endpoint)
+	}
+	e := &exporter{
+		url:      strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		resource: []otlpAttr{attr("service.name", service)},
+		client:   &http.Client{Timeout: exportTimeout},
+		queue:    make(chan otlpSpan, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return &Tracer{exp: e}, nil
+}
+
+// Shutdown отправляет накопленные спаны и останавливает отправку
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	close(t.exp.stop)
+	select {
+	case <-t.exp.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// export ставит завершённый спан в очередь на отправку
+func (t *Tracer) export(s *Span, end time.Time) {
+	s.mu.Lock()
+	span := otlpSpan{
+		TraceID: hex.EncodeToString(s.sc.TraceID[:]),
+		SpanID:  hex.EncodeToString(s.sc.SpanID[:]),
+		Name:    s.name,
+		Kind:    s.kind,
+		Start:   strconv.FormatInt(s.start.UnixNano(), 10),
+		End:     strconv.FormatInt(end.UnixNano(), 10),
+		Status:  otlpStatus{Code: s.status, Message: s.msg},
+	}
+	for _, a := range s.attrs {
+		span.Attributes = append(span.Attributes, attr(a.key, a.value))
+	}
+	s.mu.Unlock()
+	if s.parent != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	select {
+	case t.exp.queue <- span:
+	default:
+		t.exp.dropped.Add(1)
+	}
+}
+
+// run собирает спаны в пакеты и отправляет их до остановки
+func (e *exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := make([]otlpSpan, 0, batchSize)
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-e.stop:
+			for len(e.queue) > 0 {
+				batch = append(batch, <-e.queue)
+			}
+			for len(batch) > 0 {
+				n := min(len(batch), batchSize)
+				e.send(batch[:n])
+				batch = batch[n:]
+			}
+			return
+		}
+		if len(batch) > 0 {
+			e.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// send отправляет пакет спанов сборщику
+func (e *exporter) send(batch []otlpSpan) {
+	if n := e.dropped.Swap(0); n > 0 {
+		log.Printf("Трассировка: очередь переполнена, отброшено спанов: %d", n)
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: e.resource},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: batch}},
+	}}})
+	if err != nil {
+		log.Printf("Трассировка: не удалось составить пакет спанов: %v", err)
+		return
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Трассировка: сборщик %s недоступен: %v", e.url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("Трассировка: сборщик %s отклонил %d спанов: %s", e.url, len(batch), resp.Status)
+	}
+}
+
+// Сообщения OTLP/HTTP в кодировке JSON (opentelemetry-proto, trace/v1)
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID      string     `json:"traceId"`
+		SpanID       string     `json:"spanId"`
+		ParentSpanID string     `json:"parentSpanId,omitempty"`
+		Name         string     `json:"name"`
+		Kind         int        `json:"kind"`
+		Start        string     `json:"startTimeUnixNano"`
+		End          string     `json:"endTimeUnixNano"`
+		Attributes   []otlpAttr `json:"attributes,omitempty"`
+		Status       otlpStatus `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttr struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		String *string  `json:"stringValue,omitempty"`
+		Bool   *bool    `json:"boolValue,omitempty"`
+		Int    *string  `json:"intValue,omitempty"`
+		Double *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// attr атрибут OTLP; значения других типов записываются строкой
+func attr(key string, value any) otlpAttr {
+	a := otlpAttr{Key: key}
+	switch v := value.(type) {
+	case string:
+		a.Value.String = &v
+	case bool:
+		a.Value.Bool = &v
+	case int:
+		s := strconv.Itoa(v)
+		a.Value.Int = &s
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		a.Value.Int = &s
+	case float64:
+		a.Value.Double = &v
+	default:
+		s := fmt.Sprint(v)
+		a.Value.String = &s
+	}
+	return a
+}
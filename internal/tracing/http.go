@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// statusWriter запоминает статус ответа
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader передаёт и запоминает статус ответа
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write передаёт тело ответа
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Hijack передаёт соединение обработчику WebSocket
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Flush отправляет клиенту записанные данные потоковых ответов
+func (w *statusWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Handler оборачивает обработчик маршрута route спаном сервера.
+// Родитель спана берётся из заголовка traceparent запроса.
+func (t *Tracer) Handler(route string, next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+			ctx = WithRemote(ctx, sc)
+		}
+		ctx, span := t.Start(ctx, r.Method+" "+route, KindServer)
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("http.route", route)
+		span.SetAttr("url.path", r.URL.Path)
+		span.SetAttr("client.address", r.RemoteAddr)
+
+		sw := &statusWriter{ResponseWriter: w}
+		start := time.Now()
+		defer func() {
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+			span.SetAttr("http.response.status_code", sw.status)
+			if sw.status >= http.StatusInternalServerError {
+				span.SetError(fmt.Errorf("%d %s за %s", sw.status, http.StatusText(sw.status), time.Since(start).Round(time.Microsecond)))
+			}
+			span.End()
+		}()
+		next.ServeHTTP(sw, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/iliodor1/metrics-service/internal/storage"
+)
+
+// Storage хранилище, записывающее каждое обращение спаном, дочерним
+// для спана контекста вызова
+type Storage struct {
+	storage.Storage
+	backend string
+}
+
+// WrapStorage оборачивает хранилище s спанами обращений. Без спана
+// в контексте ctx хранилище возвращается как есть.
+func WrapStorage(ctx context.Context, s storage.Storage) storage.Storage {
+	if FromContext(ctx) == nil {
+		return s
+	}
+	return &Storage{Storage: s, backend: backendType(s)}
+}
+
+// backendType тип хранилища под обёртками, например *storage.MemStorage
+func backendType(s storage.Storage) string {
+	for {
+		u, ok := s.(interface{ Unwrap() storage.Storage })
+		if !ok {
+			return fmt.Sprintf("%T", s)
+		}
+		s = u.Unwrap()
+	}
+}
+
+// start начинает спан обращения op к метрике name
+func (s *Storage) start(ctx context.Context, op, name string) *Span {
+	_, span := Start(ctx, "storage."+op)
+	span.SetAttr("storage.type", s.backend)
+	if name != "" {
+		span.SetAttr("metric.name", name)
+	}
+	return span
+}
+
+// UpdateGauge обновляет метрику в спане storage.UpdateGauge
+func (s *Storage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	span := s.start(ctx, "UpdateGauge", name)
+	defer span.End()
+	err := s.Storage.UpdateGauge(ctx, name, value)
+	span.SetError(err)
+	return err
+}
+
+// UpdateCounter обновляет метрику в спане storage.UpdateCounter
+func (s *Storage) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	span := s.start(ctx, "UpdateCounter", name)
+	defer span.End()
+	err := s.Storage.UpdateCounter(ctx, name, delta)
+	span.SetError(err)
+	return err
+}
+
+// GetGauge читает метрику в спане storage.GetGauge. Отсутствие
+// метрики ошибкой спана не считается.
+func (s *Storage) GetGauge(ctx context.Context, name string) (float64, error) {
+	span := s.start(ctx, "GetGauge", name)
+	defer span.End()
+	v, err := s.Storage.GetGauge(ctx, name)
+	if !errors.Is(err, storage.ErrNotFound) {
+		span.SetError(err)
+	}
+	return v, err
+}
+
+// GetCounter читает метрику в спане storage.GetCounter
+func (s *Storage) GetCounter(ctx context.Context, name string) (int64, error) {
+	span := s.start(ctx, "GetCounter", name)
+	defer span.End()
+	v, err := s.Storage.GetCounter(ctx, name)
+	if !errors.Is(err, storage.ErrNotFound) {
+		span.SetError(err)
+	}
+	return v, err
+}
+
+// GetAll читает все метрики в спане storage.GetAll
+func (s *Storage) GetAll(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	span := s.start(ctx, "GetAll", "")
+	defer span.End()
+	gauges, counters, err := s.Storage.GetAll(ctx)
+	span.SetError(err)
+	span.SetAttr("metrics.count", len(gauges)+len(counters))
+	return gauges, counters, err
+}
+
+// Unwrap возвращает обёрнутое хранилище
+func (s *Storage) Unwrap() storage.Storage {
+	return s.Storage
+}
@@ -0,0 +1,196 @@
+// Package tracing записывает трассировки обработки запросов в формате
+// OpenTelemetry и отправляет их сборщику по протоколу OTLP/HTTP (JSON).
+//
+// Контекст трассировки входящих запросов принимается из заголовка W3C
+// traceparent, так что спаны сервера продолжают трассировку агента или
+// прокси. Без родителя трассировка начинается заново и всегда записывается;
+// родитель без флага sampled трассировку отключает.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Виды спанов OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+)
+
+// statusError код состояния OTLP спана, завершившегося ошибкой
+const statusError = 2
+
+// TraceparentHeader заголовок контекста трассировки W3C
+const TraceparentHeader = "traceparent"
+
+// SpanContext идентификаторы спана, передаваемые между процессами
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid сообщает, что идентификаторы трассировки и спана заданы
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent возвращает значение заголовка traceparent
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent разбирает заголовок traceparent версии 00.
+// Заголовки будущих версий разбираются по полям версии 00, как требует W3C.
+func ParseTraceparent(h string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// attribute атрибут спана
+type attribute struct {
+	key   string
+	value any
+}
+
+// Span операция в трассировке. Методы nil-спана ничего не делают,
+// поэтому код с выключенной трассировкой не проверяет спан на nil.
+type Span struct {
+	tracer *Tracer
+	name   string
+	kind   int
+	sc     SpanContext
+	parent [8]byte
+	start  time.Time
+
+	mu     sync.Mutex
+	attrs  []attribute
+	status int
+	msg    string
+	ended  bool
+}
+
+// SetAttr задаёт атрибут спана: строку, bool, целое или число с плавающей точкой
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attribute{key: key, value: value})
+}
+
+// SetError отмечает спан ошибкой err
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.msg = statusError, err.Error()
+}
+
+// Context возвращает идентификаторы спана
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// End завершает спан и передаёт его на отправку
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.tracer.export(s, end)
+	}
+}
+
+// spanKey ключ спана в контексте
+type spanKey struct{}
+
+// remoteKey ключ контекста трассировки другого процесса
+type remoteKey struct{}
+
+// FromContext возвращает текущий спан контекста (nil, если его нет)
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// WithRemote возвращает контекст с родителем из другого процесса
+func WithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Tracer создаёт спаны и отправляет их сборщику. Nil-трассировщик
+// спанов не создаёт.
+type Tracer struct {
+	exp *exporter
+}
+
+// Start начинает спан name вида kind, дочерний для спана контекста ctx
+// или для родителя из другого процесса. Возвращает контекст со спаном.
+func (t *Tracer) Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent := FromContext(ctx); parent != nil {
+		s.sc.TraceID, s.parent, s.sc.Sampled = parent.sc.TraceID, parent.sc.SpanID, parent.sc.Sampled
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok && remote.IsValid() {
+		s.sc.TraceID, s.parent, s.sc.Sampled = remote.TraceID, remote.SpanID, remote.Sampled
+	} else {
+		rand.Read(s.sc.TraceID[:])
+		s.sc.Sampled = true
+	}
+	rand.Read(s.sc.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Start начинает спан name, дочерний для спана контекста ctx, тем же
+// трассировщиком. Без спана в контексте трассировка выключена и спан не создаётся.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, KindInternal)
+}
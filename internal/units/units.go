@@ -0,0 +1,204 @@
+package units
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownUnit возвращается для неизвестной единицы измерения
+var ErrUnknownUnit = errors.New("неизвестная единица измерения")
+
+// ErrIncompatible возвращается при попытке перевода между разными величинами
+var ErrIncompatible = errors.New("несовместимые единицы измерения")
+
+// unit описывает единицу измерения: величину и множитель к базовой единице
+// в виде дроби num/den, чтобы целые значения переводились точно
+type unit struct {
+	dimension string
+	num, den  int64
+}
+
+// factor множитель к базовой единице
+func (u unit) factor() float64 {
+	return float64(u.num) / float64(u.den)
+}
+
+// known поддерживаемые единицы измерения.
+// Базовые единицы: байт для объёма данных, секунда для времени.
+var known = map[string]unit{
+	"B":   {"bytes", 1, 1},
+	"KB":  {"bytes", 1e3, 1},
+	"MB":  {"bytes", 1e6, 1},
+	"GB":  {"bytes", 1e9, 1},
+	"KiB": {"bytes", 1 << 10, 1},
+	"MiB": {"bytes", 1 << 20, 1},
+	"GiB": {"bytes", 1 << 30, 1},
+	"ns":  {"time", 1, 1e9},
+	"us":  {"time", 1, 1e6},
+	"ms":  {"time", 1, 1e3},
+	"s":   {"time", 1, 1},
+	"m":   {"time", 60, 1},
+	"h":   {"time", 3600, 1},
+}
+
+// Valid сообщает, поддерживается ли единица измерения
+func Valid(u string) bool {
+	_, ok := known[u]
+	return ok
+}
+
+// units возвращает описания единиц from и to одной величины
+func units(from, to string) (unit, unit, error) {
+	f, ok := known[from]
+	if !ok {
+		return f, f, fmt.Errorf("%w: %s", ErrUnknownUnit, from)
+	}
+	t, ok := known[to]
+	if !ok {
+		return f, t, fmt.Errorf("%w: %s", ErrUnknownUnit, to)
+	}
+	if f.dimension != t.dimension {
+		return f, t, fmt.Errorf("%w: %s и %s", ErrIncompatible, from, to)
+	}
+	return f, t, nil
+}
+
+// Convert переводит значение из единицы from в единицу to
+func Convert(value float64, from, to string) (float64, error) {
+	f, t, err := units(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return value * f.factor() / t.factor(), nil
+}
+
+// ConvertInt переводит целое значение из единицы from в единицу to без
+// округления: результат — точная дробь, целая при переводе в меньшую
+// единицу. Так значения counter больше 2^53 не теряют точность.
+func ConvertInt(value int64, from, to string) (*big.Rat, error) {
+	f, t, err := units(from, to)
+	if err != nil {
+		return nil, err
+	}
+	num := new(big.Int).Mul(big.NewInt(value), big.NewInt(f.num*t.den))
+	return new(big.Rat).SetFrac(num, big.NewInt(f.den*t.num)), nil
+}
+
+// Registry хранит единицы измерения метрик и правила их перевода при выдаче.
+// Единицы закрепляются за метрикой с учётом типа: gauge и counter с одним
+// именем — разные метрики.
+type Registry struct {
+	mu    sync.RWMutex
+	units map[metricKey]string
+	rules map[string]string
+}
+
+// metricKey метрика в реестре
+type metricKey struct {
+	mType, name string
+}
+
+// NewRegistry создаёт реестр с правилами перевода rules (исходная единица → целевая)
+func NewRegistry(rules map[string]string) (*Registry, error) {
+	for from, to := range rules {
+		if _, err := Convert(0, from, to); err != nil {
+			return nil, fmt.Errorf("правило %s→%s: %w", from, to, err)
+		}
+	}
+	return &Registry{
+		units: make(map[metricKey]string),
+		rules: rules,
+	}, nil
+}
+
+// SetUnit закрепляет за метрикой типа mType единицу измерения
+func (r *Registry) SetUnit(mType, name, u string) error {
+	if !Valid(u) {
+		return fmt.Errorf("%w: %s", ErrUnknownUnit, u)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.units[metricKey{mType, name}] = u
+	return nil
+}
+
+// Unit возвращает единицу измерения метрики типа mType или пустую строку
+func (r *Registry) Unit(mType, name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.units[metricKey{mType, name}]
+}
+
+// target возвращает единицу метрики и единицу, в которую переводится
+// значение: to или по правилу перевода, если to не задана. Пустая
+// целевая единица — перевод не нужен.
+func (r *Registry) target(mType, name, to string) (string, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	from := r.units[metricKey{mType, name}]
+	if to == "" {
+		to = r.rules[from]
+	}
+	if to == "" || to == from {
+		return from, "", nil
+	}
+	if from == "" {
+		return "", "", fmt.Errorf("у метрики %s не задана единица измерения", name)
+	}
+	return from, to, nil
+}
+
+// Export переводит значение метрики типа mType в запрошенную единицу to.
+// Если to не задана, применяется правило перевода для единицы метрики.
+// Возвращает итоговое значение и его единицу измерения.
+func (r *Registry) Export(mType, name string, value float64, to string) (float64, string, error) {
+	from, to, err := r.target(mType, name, to)
+	if err != nil {
+		return 0, "", err
+	}
+	if to == "" {
+		return value, from, nil
+	}
+	converted, err := Convert(value, from, to)
+	if err != nil {
+		return 0, "", err
+	}
+	return converted, to, nil
+}
+
+// ExportInt переводит целое значение метрики типа mType, например counter,
+// как Export, но без округления до float64
+func (r *Registry) ExportInt(mType, name string, value int64, to string) (*big.Rat, string, error) {
+	from, to, err := r.target(mType, name, to)
+	if err != nil {
+		return nil, "", err
+	}
+	if to == "" {
+		return new(big.Rat).SetInt64(value), from, nil
+	}
+	converted, err := ConvertInt(value, from, to)
+	if err != nil {
+		return nil, "", err
+	}
+	return converted, to, nil
+}
+
+// ParsePairs разбирает список вида "a=b,c=d" в отображение
+func ParsePairs(s string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("неверный формат %q, ожидается ключ=значение", item)
+		}
+		pairs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return pairs, nil
+}
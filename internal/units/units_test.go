@@ -0,0 +1,89 @@
+package units
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestConvertInt(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    int64
+		from, to string
+		want     string
+		wantErr  error
+	}{
+		{name: "в меньшую единицу", value: 3, from: "KiB", to: "B", want: "3072"},
+		{name: "в большую единицу", value: 1536, from: "B", to: "KiB", want: "3/2"},
+		{name: "больше 2^53", value: math.MaxInt64 / 1024, from: "KiB", to: "B", want: "9223372036854774784"},
+		{name: "без округления", value: 1<<53 + 1, from: "s", to: "s", want: "9007199254740993"},
+		{name: "время", value: 90, from: "s", to: "m", want: "3/2"},
+		{name: "наносекунды", value: 2, from: "s", to: "ns", want: "2000000000"},
+		{name: "переполнение int64", value: math.MaxInt64, from: "GiB", to: "B", want: "9903520314283042198119251968"},
+		{name: "разные величины", value: 1, from: "B", to: "s", wantErr: ErrIncompatible},
+		{name: "неизвестная единица", value: 1, from: "B", to: "bit", wantErr: ErrUnknownUnit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertInt(tt.value, tt.from, tt.to)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ConvertInt() = %v, ожидалась %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.RatString() != tt.want {
+				t.Errorf("ConvertInt(%d, %s, %s) = %s, ожидалось %s", tt.value, tt.from, tt.to, got.RatString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryByType(t *testing.T) {
+	r, err := NewRegistry(map[string]string{"B": "KiB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetUnit("counter", "traffic", "B"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetUnit("gauge", "traffic", "ms"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		mType    string
+		to       string
+		value    float64
+		want     float64
+		wantUnit string
+		wantErr  bool
+	}{
+		{name: "counter по правилу", mType: "counter", value: 2048, want: 2, wantUnit: "KiB"},
+		{name: "gauge не затронут правилом counter", mType: "gauge", value: 1500, want: 1500, wantUnit: "ms"},
+		{name: "gauge в секунды", mType: "gauge", to: "s", value: 1500, want: 1.5, wantUnit: "s"},
+		{name: "gauge в байты", mType: "gauge", to: "B", value: 1, wantErr: true},
+		{name: "единица не задана", mType: "summary", to: "s", value: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, unit, err := r.Export(tt.mType, "traffic", tt.value, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Export() = %v, ожидалась ошибка: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got != tt.want || unit != tt.wantUnit) {
+				t.Errorf("Export() = %v %s, ожидалось %v %s", got, unit, tt.want, tt.wantUnit)
+			}
+		})
+	}
+
+	v, unit, err := r.ExportInt("counter", "traffic", 1<<62, "")
+	if err != nil || unit != "KiB" || v.RatString() != "4503599627370496" {
+		t.Errorf("ExportInt() = %v %s %v", v, unit, err)
+	}
+}
@@ -0,0 +1,266 @@
+// Package websocket реализует серверную часть протокола WebSocket (RFC 6455)
+// в объёме, достаточном для потоковой отправки сообщений клиентам:
+// рукопожатие, текстовые сообщения, ping/pong и закрытие соединения.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acceptGUID константа для вычисления Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Коды операций кадров
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Коды закрытия соединения
+const (
+	CloseNormal    = 1000
+	CloseGoingAway = 1001
+	CloseProtocol  = 1002
+	CloseTooBig    = 1009
+	CloseTryAgain  = 1013
+)
+
+const (
+	// maxControlPayload ограничение размера управляющего кадра по RFC 6455
+	maxControlPayload = 125
+	// maxMessageSize ограничение размера сообщения от клиента
+	maxMessageSize = 64 << 10
+)
+
+// writeTimeout время на отправку одного кадра
+const writeTimeout = 10 * time.Second
+
+// ErrClosed возвращается при записи в закрытое соединение
+var ErrClosed = errors.New("соединение WebSocket закрыто")
+
+// IsUpgrade сообщает, запрашивает ли клиент переход на WebSocket
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// headerContains проверяет, есть ли token среди значений заголовка через запятую
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Conn соединение WebSocket на стороне сервера
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Upgrade выполняет рукопожатие и перехватывает соединение.
+// При ошибке клиенту уже отправлен ответ с кодом ошибки.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешён. Используйте GET.", http.StatusMethodNotAllowed)
+		return nil, errors.New("неверный метод рукопожатия")
+	}
+	if !IsUpgrade(r) {
+		http.Error(w, "Ожидается запрос на переход на WebSocket.", http.StatusBadRequest)
+		return nil, errors.New("нет заголовков Upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Неподдерживаемая версия WebSocket.", http.StatusUpgradeRequired)
+		return nil, errors.New("неподдерживаемая версия")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Не задан Sec-WebSocket-Key.", http.StatusBadRequest)
+		return nil, errors.New("нет Sec-WebSocket-Key")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Соединение не поддерживает WebSocket.", http.StatusInternalServerError)
+		return nil, errors.New("ResponseWriter не поддерживает Hijack")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// Соединение перешло к WebSocket: сроки чтения и записи HTTP-сервера
+	// к нему больше не относятся
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, br: rw.Reader}, nil
+}
+
+// WriteText отправляет текстовое сообщение
+func (c *Conn) WriteText(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// Close отправляет кадр закрытия с кодом code и закрывает соединение
+func (c *Conn) Close(code int) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	c.writeFrame(opClose, payload)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return c.conn.Close()
+}
+
+// writeFrame отправляет один кадр; сервер не маскирует кадры
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	header := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n <= 125:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = binary.BigEndian.AppendUint16(append(header, 126), uint16(n))
+	default:
+		header = binary.BigEndian.AppendUint64(append(header, 127), uint64(n))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		c.closed = true
+		c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// ReadLoop читает кадры клиента до закрытия соединения: отвечает на ping,
+// подтверждает закрытие и отбрасывает сообщения данных.
+// Возвращает nil, если клиент закрыл соединение штатно.
+func (c *Conn) ReadLoop() error {
+	for {
+		op, payload, err := c.readFrame()
+		if err != nil {
+			var perr *protocolError
+			if errors.As(err, &perr) {
+				c.Close(perr.code)
+			} else {
+				c.Close(CloseGoingAway)
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		switch op {
+		case opClose:
+			c.Close(CloseNormal)
+			return nil
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// protocolError нарушение протокола клиентом
+type protocolError struct {
+	code int
+	msg  string
+}
+
+func (e *protocolError) Error() string {
+	return e.msg
+}
+
+// readFrame читает один кадр клиента и снимает с него маску
+func (c *Conn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return 0, nil, err
+	}
+	op := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	size := uint64(head[1] & 0x7F)
+
+	if !masked {
+		return 0, nil, &protocolError{CloseProtocol, "кадр клиента без маски"}
+	}
+	switch op {
+	case opContinuation, opText, opBinary, opClose, opPing, opPong:
+	default:
+		return 0, nil, &protocolError{CloseProtocol, fmt.Sprintf("неизвестный код операции %d", op)}
+	}
+
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= opClose && size > maxControlPayload {
+		return 0, nil, &protocolError{CloseProtocol, "слишком большой управляющий кадр"}
+	}
+	if size > maxMessageSize {
+		return 0, nil, &protocolError{CloseTooBig, "слишком большое сообщение"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
@@ -0,0 +1,263 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pipe возвращает серверное соединение WebSocket и клиентский конец
+func pipe(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return &Conn{conn: server, br: bufio.NewReader(server)}, client
+}
+
+// clientFrame собирает кадр клиента; masked — с маской, как требует RFC 6455
+func clientFrame(fin bool, op byte, payload []byte, masked bool) []byte {
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, maskBit|126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, maskBit|127), uint64(n))
+	}
+	if !masked {
+		return append(frame, payload...)
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// readServerFrame читает кадр сервера на стороне клиента
+func readServerFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatal(err)
+	}
+	if head[0]&0x80 == 0 {
+		t.Error("кадр сервера без FIN")
+	}
+	if head[1]&0x80 != 0 {
+		t.Error("кадр сервера с маской")
+	}
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(r, ext[:])
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	// Длины на границах 7-, 16- и 64-битной записи размера
+	for _, n := range []int{0, 1, 125, 126, 0xFFFF, 0x10000} {
+		payload := bytes.Repeat([]byte{'x'}, n)
+
+		c, client := pipe(t)
+		go c.WriteText(payload)
+		op, got := readServerFrame(t, client)
+		if op != opText || !bytes.Equal(got, payload) {
+			t.Errorf("запись %d байт: код %d, получено %d байт", n, op, len(got))
+		}
+
+		c, client = pipe(t)
+		go client.Write(clientFrame(true, opBinary, payload, true))
+		op, got, err := c.readFrame()
+		if err != nil || op != opBinary || !bytes.Equal(got, payload) {
+			t.Errorf("чтение %d байт: код %d, получено %d байт, ошибка %v", n, op, len(got), err)
+		}
+	}
+}
+
+func TestReadLoop(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		// wantPong ожидаемый ответ на ping перед закрытием
+		wantPong  []byte
+		wantClose int
+		wantErr   bool
+	}{
+		{
+			name:      "ping и закрытие",
+			in:        append(clientFrame(true, opPing, []byte("hi"), true), clientFrame(true, opClose, nil, true)...),
+			wantPong:  []byte("hi"),
+			wantClose: CloseNormal,
+		},
+		{
+			name:      "сообщения отбрасываются",
+			in:        append(clientFrame(true, opText, []byte("x"), true), clientFrame(true, opClose, nil, true)...),
+			wantClose: CloseNormal,
+		},
+		{
+			name:      "кадр без маски",
+			in:        clientFrame(true, opText, []byte("x"), false),
+			wantClose: CloseProtocol,
+			wantErr:   true,
+		},
+		{
+			name:      "неизвестный код операции",
+			in:        clientFrame(true, 0x3, nil, true),
+			wantClose: CloseProtocol,
+			wantErr:   true,
+		},
+		{
+			name:      "большой управляющий кадр",
+			in:        clientFrame(true, opPing, make([]byte, maxControlPayload+1), true),
+			wantClose: CloseProtocol,
+			wantErr:   true,
+		},
+		{
+			name:      "слишком большое сообщение",
+			in:        clientFrame(true, opText, make([]byte, maxMessageSize+1), true)[:14],
+			wantClose: CloseTooBig,
+			wantErr:   true,
+		},
+		{
+			name: "обрыв соединения",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, client := pipe(t)
+			done := make(chan error, 1)
+			go func() { done <- c.ReadLoop() }()
+			if tt.in == nil {
+				// Клиент пропадает, не закрыв соединение штатно
+				client.Close()
+				if err := <-done; err != nil {
+					t.Errorf("ReadLoop() = %v, ожидалось nil", err)
+				}
+				return
+			}
+
+			go client.Write(tt.in)
+			if tt.wantPong != nil {
+				op, payload := readServerFrame(t, client)
+				if op != opPong || !bytes.Equal(payload, tt.wantPong) {
+					t.Errorf("ответ на ping: код %d, %q", op, payload)
+				}
+			}
+			op, payload := readServerFrame(t, client)
+			if op != opClose || len(payload) != 2 || int(binary.BigEndian.Uint16(payload)) != tt.wantClose {
+				t.Errorf("кадр закрытия: код %d, данные %v; ожидался код закрытия %d", op, payload, tt.wantClose)
+			}
+			err := <-done
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadLoop() = %v, ошибка ожидалась: %v", err, tt.wantErr)
+			}
+			if err := c.WriteText([]byte("x")); !errors.Is(err, ErrClosed) {
+				t.Errorf("запись после закрытия: %v, ожидалась ErrClosed", err)
+			}
+		})
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	valid := func(r *http.Request) {
+		r.Header.Set("Connection", "keep-alive, Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	}
+	tests := []struct {
+		name    string
+		method  string
+		prepare func(r *http.Request)
+		want    int
+	}{
+		{name: "рукопожатие", prepare: valid, want: http.StatusSwitchingProtocols},
+		{name: "метод POST", method: http.MethodPost, prepare: valid, want: http.StatusMethodNotAllowed},
+		{name: "без Upgrade", prepare: func(r *http.Request) { valid(r); r.Header.Del("Upgrade") }, want: http.StatusBadRequest},
+		{name: "версия 8", prepare: func(r *http.Request) { valid(r); r.Header.Set("Sec-WebSocket-Version", "8") }, want: http.StatusUpgradeRequired},
+		{name: "без ключа", prepare: func(r *http.Request) { valid(r); r.Header.Del("Sec-WebSocket-Key") }, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c, err := Upgrade(w, r)
+				if err != nil {
+					return
+				}
+				c.WriteText([]byte("hello"))
+				c.ReadLoop()
+			}))
+			defer srv.Close()
+
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, _ := http.NewRequest(method, srv.URL+"/stream", nil)
+			tt.prepare(req)
+			if err := req.Write(conn); err != nil {
+				t.Fatal(err)
+			}
+			br := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(br, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Fatalf("код ответа %d, ожидался %d", resp.StatusCode, tt.want)
+			}
+			if tt.want != http.StatusSwitchingProtocols {
+				return
+			}
+
+			// Пример ключа и ответа из RFC 6455, раздел 1.3
+			if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+				t.Errorf("Sec-WebSocket-Accept = %q", got)
+			}
+			op, payload := readServerFrame(t, br)
+			if op != opText || string(payload) != "hello" {
+				t.Errorf("сообщение: код %d, %q", op, payload)
+			}
+			conn.Write(clientFrame(true, opClose, nil, true))
+			if op, _ := readServerFrame(t, br); op != opClose {
+				t.Errorf("ответ на закрытие: код %d", op)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+// Package zabbix принимает метрики по протоколу Zabbix sender (trapper)
+// через TCP, чтобы zabbix_sender и скрипты на его основе можно было
+// направить на этот сервер без изменений.
+//
+// Пакет протокола: "ZBXD", байт флагов (0x01 — протокол, 0x02 — сжатие
+// zlib, 0x04 — длины по 8 байт), длина данных и длина до сжатия
+// (little-endian), затем JSON:
+//
+//	{"request":"sender data","data":[{"host":"web1","key":"system.cpu.load[all,avg1]","value":"0.42"}]}
+package zabbix
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/labels"
+	"github.com/iliodor1/metrics-service/internal/namepolicy"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// Флаги заголовка пакета
+const (
+	flagProtocol   = 0x01
+	flagCompressed = 0x02
+	flagLarge      = 0x04
+)
+
+// maxPacketSize наибольший размер данных пакета
+const maxPacketSize = 64 << 20
+
+// ioTimeout время на чтение запроса и отправку ответа
+const ioTimeout = 30 * time.Second
+
+// HostLabel метка, в которую записывается узел элемента данных
+const HostLabel = "host"
+
+// Item метрика, в которую записываются значения элемента данных
+type Item struct {
+	// Name имя метрики, в том числе с метками (пустое — ключ элемента)
+	Name string `json:"name"`
+	// Type gauge (по умолчанию) или counter; значение counter прибавляется
+	Type string `json:"type"`
+}
+
+// Config настройки приёма
+type Config struct {
+	// Keys метрики для ключей элементов данных; остальные ключи
+	// записываются в gauge с именем, равным ключу
+	Keys map[string]Item `json:"keys"`
+	// IgnoreHost не добавлять к имени метрики метку host с узлом элемента
+	IgnoreHost bool `json:"ignore_host"`
+}
+
+// Storage хранилище, в которое записываются принятые метрики
+type Storage interface {
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+}
+
+// Listener принимает данные Zabbix sender и сохраняет их в хранилище
+type Listener struct {
+	addr    string
+	storage Storage
+	policy  *namepolicy.Policy
+	cfg     Config
+}
+
+// NewListener создаёт приёмник на TCP-адресе addr. Имена метрик
+// проверяются правилами policy, как и в HTTP API.
+func NewListener(addr string, storage Storage, policy *namepolicy.Policy, cfg Config) (*Listener, error) {
+	for key, item := range cfg.Keys {
+		if item.Type != "" && item.Type != models.Gauge && item.Type != models.Counter {
+			return nil, fmt.Errorf("ключ %s: %w", key, models.ErrInvalidType)
+		}
+	}
+	return &Listener{addr: addr, storage: storage, policy: policy, cfg: cfg}, nil
+}
+
+// Run принимает соединения до отмены контекста
+func (l *Listener) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("Ошибка приёма соединения Zabbix: %v", err)
+			continue
+		}
+		go l.serve(ctx, conn)
+	}
+}
+
+// request запрос Zabbix sender
+type request struct {
+	Request string  `json:"request"`
+	Data    []value `json:"data"`
+}
+
+// value значение элемента данных
+type value struct {
+	Host  string          `json:"host"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// response ответ на запрос
+type response struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// serve обрабатывает один запрос соединения
+func (l *Listener) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	data, err := readPacket(conn)
+	if err != nil {
+		log.Printf("Неверный пакет Zabbix от %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	var req request
+	resp := response{Response: "failed"}
+	switch err := json.Unmarshal(data, &req); {
+	case err != nil:
+		resp.Info = "invalid JSON: " + err.Error()
+	case req.Request != "sender data" && req.Request != "agent data":
+		resp.Info = "unsupported request: " + req.Request
+	default:
+		start := time.Now()
+		processed, failed := l.applyAll(ctx, req.Data)
+		resp.Response = "success"
+		resp.Info = fmt.Sprintf("processed: %d; failed: %d; total: %d; seconds spent: %.6f",
+			processed, failed, len(req.Data), time.Since(start).Seconds())
+	}
+	body, _ := json.Marshal(resp)
+	if err := writePacket(conn, body); err != nil {
+		log.Printf("Не удалось ответить Zabbix sender %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// applyAll сохраняет значения и возвращает число принятых и отклонённых
+func (l *Listener) applyAll(ctx context.Context, values []value) (processed, failed int) {
+	for _, v := range values {
+		if err := l.apply(ctx, v); err != nil {
+			log.Printf("Пропущено значение Zabbix %s:%s: %v", v.Host, v.Key, err)
+			failed++
+			continue
+		}
+		processed++
+	}
+	return processed, failed
+}
+
+// apply сохраняет одно значение
+func (l *Listener) apply(ctx context.Context, v value) error {
+	item := l.cfg.Keys[v.Key]
+	name := item.Name
+	if name == "" {
+		name = v.Key
+	}
+	if !l.cfg.IgnoreHost && v.Host != "" {
+		base, set, ok := labels.Parse(name)
+		if !ok {
+			set = make(map[string]string)
+		}
+		set[HostLabel] = v.Host
+		name = labels.Format(base, set)
+	}
+	if err := l.policy.Check(name); err != nil {
+		return err
+	}
+
+	// zabbix_sender передаёт значения строками, другие клиенты — и числами
+	text := string(v.Value)
+	var s string
+	if json.Unmarshal(v.Value, &s) == nil {
+		text = s
+	}
+	text = strings.TrimSpace(text)
+
+	if item.Type == models.Counter {
+		delta, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: значение counter должно быть целым", models.ErrInvalidValue)
+		}
+		return l.storage.UpdateCounter(ctx, name, delta)
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("%w: нечисловое значение", models.ErrInvalidValue)
+	}
+	if err := models.CheckGauge(f); err != nil {
+		return err
+	}
+	return l.storage.UpdateGauge(ctx, name, f)
+}
+
+// readPacket читает пакет протокола и возвращает его данные
+func readPacket(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "ZBXD" || header[4]&flagProtocol == 0 {
+		return nil, errors.New("нет заголовка ZBXD")
+	}
+	flags := header[4]
+
+	var size, reserved uint64
+	if flags&flagLarge != 0 {
+		var b [16]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		size, reserved = binary.LittleEndian.Uint64(b[:8]), binary.LittleEndian.Uint64(b[8:])
+	} else {
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		size, reserved = uint64(binary.LittleEndian.Uint32(b[:4])), uint64(binary.LittleEndian.Uint32(b[4:]))
+	}
+	if size > maxPacketSize || reserved > maxPacketSize {
+		return nil, fmt.Errorf("пакет больше %d байт", maxPacketSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if flags&flagCompressed == 0 {
+		return data, nil
+	}
+
+	// В reserved сжатого пакета записана длина данных до сжатия
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	plain, err := io.ReadAll(io.LimitReader(zr, int64(reserved)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(plain)) != reserved {
+		return nil, errors.New("длина распакованных данных не совпадает с заголовком")
+	}
+	return plain, nil
+}
+
+// writePacket отправляет данные пакетом протокола без сжатия
+func writePacket(w io.Writer, data []byte) error {
+	packet := make([]byte, 0, 13+len(data))
+	packet = append(packet, "ZBXD"...)
+	packet = append(packet, flagProtocol)
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(data)))
+	packet = binary.LittleEndian.AppendUint32(packet, 0)
+	packet = append(packet, data...)
+	_, err := w.Write(packet)
+	return err
+}
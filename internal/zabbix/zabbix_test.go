@@ -0,0 +1,57 @@
+package zabbix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/iliodor1/metrics-service/internal/namepolicy"
+	"github.com/iliodor1/metrics-service/internal/storage"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+func TestApplyChecksNames(t *testing.T) {
+	policy, err := namepolicy.New(namepolicy.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		v       value
+		want    string
+		wantErr bool
+	}{
+		{name: "ключ", v: value{Key: "cpu", Value: json.RawMessage(`"1.5"`)}, want: "cpu"},
+		{name: "ключ с узлом", v: value{Host: "web1", Key: "cpu", Value: json.RawMessage(`2`)}, want: "cpu{host=web1}"},
+		{name: "пробел в ключе", v: value{Key: "cpu load", Value: json.RawMessage(`1`)}, wantErr: true},
+		{name: "перевод строки в ключе", v: value{Key: "cpu\nevent", Value: json.RawMessage(`1`)}, wantErr: true},
+		{name: "разделитель арендатора", v: value{Key: "A/cpu", Value: json.RawMessage(`1`)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storage.NewMemStorage()
+			l, err := NewListener("", s, policy, Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			err = l.apply(ctx, tt.v)
+			if tt.wantErr {
+				if !errors.Is(err, models.ErrInvalidName) {
+					t.Errorf("apply = %v, ожидалась %v", err, models.ErrInvalidName)
+				}
+				if gauges, _, _ := s.GetAll(ctx); len(gauges) != 0 {
+					t.Errorf("записаны метрики %v", gauges)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if _, err := s.GetGauge(ctx, tt.want); err != nil {
+				t.Errorf("gauge %s: %v", tt.want, err)
+			}
+		})
+	}
+}
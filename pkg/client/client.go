@@ -0,0 +1,447 @@
+// Package client отправляет метрики на сервер и читает их оттуда.
+//
+// Клиент кодирует метрики в JSON, сжимает запросы gzip,
+// подписывает их ключом HMAC (если ключ задан) и повторяет
+// запросы при сетевых ошибках. Если сервер не принимает алгоритм
+// подписи клиента, клиент переходит на предпочтительный алгоритм
+// из заголовка ответа сервера.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/iliodor1/metrics-service/internal/netaddr"
+	"github.com/iliodor1/metrics-service/internal/sign"
+	"github.com/iliodor1/metrics-service/pkg/models"
+)
+
+// ErrNotFound возвращается, если метрика отсутствует на сервере
+var ErrNotFound = errors.New("метрика не найдена")
+
+// ErrBadSignature возвращается, если подпись ответа сервера не совпала
+var ErrBadSignature = errors.New("неверная подпись ответа сервера")
+
+// StatusError ответ сервера с неуспешным статусом
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error возвращает описание ошибки
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("сервер ответил %d: %s", e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+// Заголовки запросов
+const (
+	// idempotencyHeader заголовок ключа идемпотентности запроса
+	idempotencyHeader = "Idempotency-Key"
+	// apiKeyHeader заголовок API-ключа арендатора
+	apiKeyHeader = "X-API-Key"
+)
+
+// DefaultRetries паузы между повторами запроса по умолчанию
+var DefaultRetries = []time.Duration{time.Second, 3 * time.Second, 5 * time.Second}
+
+// Client клиент сервера метрик
+type Client struct {
+	baseURL string
+	key     string
+	hash    atomic.Pointer[sign.Algorithm]
+	apiKey  string
+	token   string
+	http    *http.Client
+	retries []time.Duration
+	proto   bool
+}
+
+// Option настройка клиента
+type Option func(*Client)
+
+// WithKey задаёт ключ подписи запросов
+func WithKey(key string) Option {
+	return func(c *Client) {
+		c.key = key
+	}
+}
+
+// WithSignHash задаёт алгоритм подписи запросов (nil — sha256)
+func WithSignHash(a *sign.Algorithm) Option {
+	return func(c *Client) {
+		if a != nil {
+			c.hash.Store(a)
+		}
+	}
+}
+
+// WithAPIKey задаёт API-ключ арендатора, с которым выполняются запросы
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithBearerToken задаёт токен доступа, который передаётся в заголовке
+// Authorization: Bearer
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient задаёт HTTP-клиент для запросов
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithProto кодирует запросы и ответы в формате Protocol Buffers
+// (application/x-protobuf) вместо JSON: пакеты метрик получаются
+// меньше и кодируются быстрее
+func WithProto() Option {
+	return func(c *Client) {
+		c.proto = true
+	}
+}
+
+// WithRetries задаёт паузы между повторами запроса; без аргументов повторы отключаются
+func WithRetries(delays ...time.Duration) Option {
+	return func(c *Client) {
+		c.retries = delays
+	}
+}
+
+// New создаёт клиента для сервера по адресу addr (host:port, URL
+// или unix:/путь/к/сокету)
+func New(addr string, opts ...Option) *Client {
+	baseURL, transport := netaddr.Client(addr, nil)
+	c := &Client{
+		baseURL: baseURL,
+		http:    &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		retries: DefaultRetries,
+	}
+	c.hash.Store(sign.SHA256)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// UpdateGauge устанавливает значение метрики типа gauge
+func (c *Client) UpdateGauge(ctx context.Context, name string, value float64) error {
+	return c.do(ctx, "/update/", models.NewGauge(name, value), nil)
+}
+
+// UpdateCounter увеличивает метрику типа counter на delta
+func (c *Client) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	return c.do(ctx, "/update/", models.NewCounter(name, delta), nil)
+}
+
+// UpdateBatch отправляет пакет метрик одним запросом
+func (c *Client) UpdateBatch(ctx context.Context, batch []models.Metrics) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	return c.do(ctx, "/updates/", batch, nil)
+}
+
+// GetMetric возвращает текущее значение метрики
+func (c *Client) GetMetric(ctx context.Context, mType, name string) (models.Metrics, error) {
+	var m models.Metrics
+	err := c.do(ctx, "/value/", models.Metrics{ID: name, MType: mType}, &m)
+	return m, err
+}
+
+// List возвращает все метрики сервера (арендатора, если задан API-ключ)
+func (c *Client) List(ctx context.Context) ([]models.Metrics, error) {
+	req, err := c.newGet(ctx, "/")
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	var list []models.Metrics
+	err = c.decode(resp, &list)
+	return list, err
+}
+
+// Watch получает поток обновлений метрик с именами, начинающимися
+// с prefix, и передаёт каждое в fn, пока не отменён контекст или сервер
+// не закрыл поток. Counter передаются с итоговым значением после обновления.
+func (c *Client) Watch(ctx context.Context, prefix string, fn func(models.Metrics)) error {
+	req, err := c.newGet(ctx, "/events?prefix="+url.QueryEscape(prefix))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	// Поток длится дольше ограничения времени обычных запросов
+	hc := *c.http
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return c.decode(resp, nil)
+	}
+	defer resp.Body.Close()
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	var event string
+	var data []byte
+	for sc.Scan() {
+		line := sc.Text()
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch {
+		case line == "":
+			// Пустая строка завершает событие
+			if event == "metric" {
+				var m models.Metrics
+				if err := json.Unmarshal(data, &m); err != nil {
+					return fmt.Errorf("неверное событие потока: %w", err)
+				}
+				fn(m)
+			}
+			event, data = "", nil
+		case field == "event":
+			event = value
+		case field == "data":
+			data = append(data, value...)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return errors.New("сервер закрыл поток")
+}
+
+// newGet создаёт запрос GET к серверу с API-ключом клиента
+func (c *Client) newGet(ctx context.Context, path string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setCredentials(req)
+	return req, nil
+}
+
+// setCredentials добавляет к запросу API-ключ арендатора и токен доступа
+func (c *Client) setCredentials(req *http.Request) {
+	if c.apiKey != "" {
+		req.Header.Set(apiKeyHeader, c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
+
+// marshal кодирует тело запроса в формате клиента
+func (c *Client) marshal(in any) ([]byte, error) {
+	if !c.proto {
+		return json.Marshal(in)
+	}
+	switch v := in.(type) {
+	case models.Metrics:
+		return models.AppendProto(nil, v), nil
+	case []models.Metrics:
+		return models.MarshalProtoList(v), nil
+	}
+	return nil, fmt.Errorf("тип %T не кодируется в Protocol Buffers", in)
+}
+
+// do отправляет запрос с повторами при сетевых ошибках. Все попытки
+// передают один ключ идемпотентности, поэтому сервер не применит обновление
+// дважды, если ответ на первую попытку потерялся.
+func (c *Client) do(ctx context.Context, path string, in, out any) error {
+	body, err := c.marshal(in)
+	if err != nil {
+		return err
+	}
+	key, ok := ctx.Value(idempotencyKeyCtx{}).(string)
+	if !ok {
+		key = NewIdempotencyKey()
+	}
+
+	alg := c.hash.Load()
+	err = c.send(ctx, path, key, body, out)
+	if err != nil && c.hash.Load() != alg {
+		// Сервер не принял алгоритм подписи: повторяем с предложенным им
+		err = c.send(ctx, path, key, body, out)
+	}
+	for _, delay := range c.retries {
+		if !retriable(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		err = c.send(ctx, path, key, body, out)
+	}
+	return err
+}
+
+// idempotencyKeyCtx ключ идемпотентности в контексте запроса
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey задаёт ключ идемпотентности обновлений, отправляемых
+// с контекстом ctx. Повтор обновления с тем же ключом, например после
+// перезапуска отправителя, сервер не применит второй раз в пределах своего
+// окна идемпотентности.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// NewIdempotencyKey создаёт случайный ключ идемпотентности
+func NewIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// send выполняет один запрос к серверу
+func (c *Client) send(ctx context.Context, path, key string, body []byte, out any) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, &buf)
+	if err != nil {
+		return err
+	}
+	if c.proto {
+		req.Header.Set("Content-Type", models.ContentTypeProto)
+		req.Header.Set("Accept", models.ContentTypeProto)
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set(idempotencyHeader, key)
+	c.setCredentials(req)
+	if c.key != "" {
+		alg := c.hash.Load()
+		req.Header.Set(alg.Header, alg.Sum(body, c.key))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	return c.decode(resp, out)
+}
+
+// adoptSignHash переходит на первый алгоритм подписи из списка сервера
+// advertised, если сервер не принимает текущий
+func (c *Client) adoptSignHash(advertised string) {
+	if advertised == "" {
+		return
+	}
+	algs, err := sign.ParseAlgorithms(advertised)
+	if err != nil {
+		return
+	}
+	current := c.hash.Load()
+	for _, a := range algs {
+		if a == current {
+			return
+		}
+	}
+	c.hash.Store(algs[0])
+}
+
+// decode проверяет ответ сервера и разбирает его тело в out (nil — тело
+// не нужно). Тело ответа закрывается.
+func (c *Client) decode(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+
+	// Транспорт сам распаковывает ответ, только если не выставлять Accept-Encoding
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		reader = zr
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	if c.key != "" {
+		for _, a := range sign.Algorithms {
+			if signature := resp.Header.Get(a.Header); signature != "" {
+				if !a.Verify(data, c.key, signature) {
+					return ErrBadSignature
+				}
+				break
+			}
+		}
+		c.adoptSignHash(resp.Header.Get(sign.AlgorithmsHeader))
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	if out == nil {
+		return nil
+	}
+	if m, ok := out.(*models.Metrics); ok && resp.Header.Get("Content-Type") == models.ContentTypeProto {
+		*m, err = models.UnmarshalProto(data)
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// retriable сообщает, имеет ли смысл повторить запрос
+func retriable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		// 409 — предыдущая попытка с тем же ключом ещё выполняется
+		return se.StatusCode == http.StatusConflict ||
+			se.StatusCode == http.StatusBadGateway ||
+			se.StatusCode == http.StatusServiceUnavailable ||
+			se.StatusCode == http.StatusGatewayTimeout
+	}
+	// Ошибки соединения
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
@@ -0,0 +1,51 @@
+//go:build gofuzz
+
+package models
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// FuzzParseMetric точка входа go-fuzz для разбора метрики из URL вида type/name/value:
+// go-fuzz-build ./pkg/models && go-fuzz -func FuzzParseMetric
+func FuzzParseMetric(data []byte) int {
+	parts := strings.SplitN(string(data), "/", 3)
+	if len(parts) != 3 {
+		return -1
+	}
+	if _, err := ParseMetric(parts[0], parts[1], parts[2]); err != nil {
+		return 0
+	}
+	return 1
+}
+
+// FuzzJSON точка входа go-fuzz для разбора пакета метрик в формате JSON:
+// go-fuzz-build ./pkg/models && go-fuzz -func FuzzJSON
+func FuzzJSON(data []byte) int {
+	var batch []Metrics
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return 0
+	}
+	for _, m := range batch {
+		if err := Validate(m); err != nil {
+			return 0
+		}
+	}
+	return 1
+}
+
+// FuzzProto точка входа go-fuzz для разбора пакета метрик в формате Protocol Buffers:
+// go-fuzz-build ./pkg/models && go-fuzz -func FuzzProto
+func FuzzProto(data []byte) int {
+	batch, err := UnmarshalProtoList(data)
+	if err != nil {
+		return 0
+	}
+	for _, m := range batch {
+		if err := Validate(m); err != nil {
+			return 0
+		}
+	}
+	return 1
+}
@@ -0,0 +1,63 @@
+// Package models описывает формат обмена метриками между агентом и сервером
+package models
+
+import (
+	"slices"
+	"strings"
+)
+
+// Типы метрик
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+	// Summary наблюдение в value: сервер ведёт число и сумму наблюдений
+	// и оценки квантилей
+	Summary = "summary"
+)
+
+// Metrics метрика в формате JSON
+type Metrics struct {
+	ID    string   `json:"id"`              // имя метрики
+	MType string   `json:"type"`            // параметр, принимающий значение gauge, counter или summary
+	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
+	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge или наблюдение summary
+}
+
+// NewGauge создаёт метрику типа gauge
+func NewGauge(name string, value float64) Metrics {
+	return Metrics{ID: name, MType: Gauge, Value: &value}
+}
+
+// NewSummary создаёт наблюдение метрики типа summary
+func NewSummary(name string, value float64) Metrics {
+	return Metrics{ID: name, MType: Summary, Value: &value}
+}
+
+// NewCounter создаёт метрику типа counter
+func NewCounter(name string, delta int64) Metrics {
+	return Metrics{ID: name, MType: Counter, Delta: &delta}
+}
+
+// Sort упорядочивает метрики по имени, а при совпадении имён — по типу,
+// чтобы листинги и выгрузки не зависели от порядка обхода map
+func Sort(metrics []Metrics) {
+	slices.SortFunc(metrics, func(a, b Metrics) int {
+		if c := strings.Compare(a.ID, b.ID); c != 0 {
+			return c
+		}
+		return strings.Compare(a.MType, b.MType)
+	})
+}
+
+// FromMaps собирает упорядоченный список метрик из значений gauge и counter
+func FromMaps(gauges map[string]float64, counters map[string]int64) []Metrics {
+	metrics := make([]Metrics, 0, len(gauges)+len(counters))
+	for name, value := range gauges {
+		metrics = append(metrics, NewGauge(name, value))
+	}
+	for name, delta := range counters {
+		metrics = append(metrics, NewCounter(name, delta))
+	}
+	Sort(metrics)
+	return metrics
+}
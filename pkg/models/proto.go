@@ -0,0 +1,169 @@
+package models
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// ContentTypeProto тип содержимого метрик в формате Protocol Buffers
+// по схеме metrics.proto
+const ContentTypeProto = "application/x-protobuf"
+
+// ErrInvalidProto тело не разбирается как сообщение metrics.proto
+var ErrInvalidProto = errors.New("неверное сообщение Protocol Buffers")
+
+// Номера полей и типы их кодирования из metrics.proto
+const (
+	fieldID      = 1
+	fieldType    = 2
+	fieldDelta   = 3
+	fieldValue   = 4
+	fieldMetrics = 1
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// appendTag дописывает ключ поля
+func appendTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wire))
+}
+
+// appendBytes дописывает поле с длиной
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendProto дописывает метрику m в формате сообщения Metric.
+// Значение своего типа записывается и тогда, когда оно нулевое.
+func AppendProto(b []byte, m Metrics) []byte {
+	b = appendBytes(b, fieldID, []byte(m.ID))
+	b = appendBytes(b, fieldType, []byte(m.MType))
+	if m.Delta != nil {
+		b = appendTag(b, fieldDelta, wireVarint)
+		b = binary.AppendUvarint(b, uint64(*m.Delta))
+	}
+	if m.Value != nil {
+		b = appendTag(b, fieldValue, wireFixed64)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(*m.Value))
+	}
+	return b
+}
+
+// MarshalProtoList кодирует пакет метрик в формате сообщения MetricList
+func MarshalProtoList(metrics []Metrics) []byte {
+	var b, buf []byte
+	for _, m := range metrics {
+		buf = AppendProto(buf[:0], m)
+		b = appendBytes(b, fieldMetrics, buf)
+	}
+	return b
+}
+
+// field поле сообщения
+type field struct {
+	num    int
+	wire   int
+	varint uint64
+	data   []byte
+}
+
+// nextField читает очередное поле сообщения b и возвращает остаток
+func nextField(b []byte) (field, []byte, error) {
+	key, n := binary.Uvarint(b)
+	if n <= 0 || key>>3 == 0 || key>>3 > math.MaxInt32 {
+		return field{}, nil, ErrInvalidProto
+	}
+	b = b[n:]
+	f := field{num: int(key >> 3), wire: int(key & 7)}
+	switch f.wire {
+	case wireVarint:
+		if f.varint, n = binary.Uvarint(b); n <= 0 {
+			return f, nil, ErrInvalidProto
+		}
+		b = b[n:]
+	case wireFixed64:
+		if len(b) < 8 {
+			return f, nil, ErrInvalidProto
+		}
+		f.varint = binary.LittleEndian.Uint64(b)
+		b = b[8:]
+	case wireFixed32:
+		if len(b) < 4 {
+			return f, nil, ErrInvalidProto
+		}
+		f.varint = uint64(binary.LittleEndian.Uint32(b))
+		b = b[4:]
+	case wireBytes:
+		size, n := binary.Uvarint(b)
+		if n <= 0 || size > uint64(len(b)-n) {
+			return f, nil, ErrInvalidProto
+		}
+		f.data = b[n : n+int(size)]
+		b = b[n+int(size):]
+	default:
+		return f, nil, ErrInvalidProto
+	}
+	return f, b, nil
+}
+
+// UnmarshalProto разбирает метрику из сообщения Metric. Значение
+// своего типа, отсутствующее в сообщении, считается нулевым, как принято
+// в proto3; значение другого типа отбрасывается. Неизвестные поля пропускаются.
+func UnmarshalProto(b []byte) (Metrics, error) {
+	var (
+		m     Metrics
+		delta int64
+		value float64
+	)
+	for len(b) > 0 {
+		f, rest, err := nextField(b)
+		if err != nil {
+			return m, err
+		}
+		b = rest
+		switch {
+		case f.num == fieldID && f.wire == wireBytes:
+			m.ID = string(f.data)
+		case f.num == fieldType && f.wire == wireBytes:
+			m.MType = string(f.data)
+		case f.num == fieldDelta && f.wire == wireVarint:
+			delta = int64(f.varint)
+		case f.num == fieldValue && f.wire == wireFixed64:
+			value = math.Float64frombits(f.varint)
+		}
+	}
+	switch m.MType {
+	case Gauge:
+		m.Value = &value
+	case Counter:
+		m.Delta = &delta
+	}
+	return m, nil
+}
+
+// UnmarshalProtoList разбирает пакет метрик из сообщения MetricList
+func UnmarshalProtoList(b []byte) ([]Metrics, error) {
+	metrics := []Metrics{}
+	for len(b) > 0 {
+		f, rest, err := nextField(b)
+		if err != nil {
+			return nil, err
+		}
+		b = rest
+		if f.num != fieldMetrics || f.wire != wireBytes {
+			continue
+		}
+		m, err := UnmarshalProto(f.data)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
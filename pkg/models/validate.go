@@ -0,0 +1,121 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// MaxNameLength максимальная длина имени метрики в байтах
+const MaxNameLength = 256
+
+// Ошибки проверки метрик
+var (
+	ErrEmptyName    = errors.New("имя метрики не может быть пустым")
+	ErrInvalidName  = errors.New("неверное имя метрики")
+	ErrInvalidType  = errors.New("неподдерживаемый тип метрики, допустимые типы: gauge, counter, summary")
+	ErrInvalidValue = errors.New("неверное значение метрики")
+)
+
+// CheckName проверяет, что имя непустое, в кодировке UTF-8 и не длиннее MaxNameLength
+func CheckName(name string) error {
+	switch {
+	case name == "":
+		return ErrEmptyName
+	case len(name) > MaxNameLength:
+		return fmt.Errorf("%w: длина превышает %d байт", ErrInvalidName, MaxNameLength)
+	case !utf8.ValidString(name):
+		return fmt.Errorf("%w: недопустимая последовательность UTF-8", ErrInvalidName)
+	}
+	return nil
+}
+
+// CheckGauge проверяет, что значение gauge конечно
+func CheckGauge(value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("%w: значение gauge должно быть конечным числом", ErrInvalidValue)
+	}
+	return nil
+}
+
+// checkObservation проверяет, что наблюдение summary конечно
+func checkObservation(value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("%w: наблюдение summary должно быть конечным числом", ErrInvalidValue)
+	}
+	return nil
+}
+
+// Validate проверяет метрику, полученную в формате JSON, из тех, что
+// хранятся как есть: gauge или counter
+func Validate(m Metrics) error {
+	if err := CheckName(m.ID); err != nil {
+		return err
+	}
+	switch m.MType {
+	case Gauge:
+		if m.Value == nil {
+			return fmt.Errorf("%w: для gauge не задано поле value", ErrInvalidValue)
+		}
+		return CheckGauge(*m.Value)
+	case Counter:
+		if m.Delta == nil {
+			return fmt.Errorf("%w: для counter не задано поле delta", ErrInvalidValue)
+		}
+		return nil
+	default:
+		return ErrInvalidType
+	}
+}
+
+// ValidateUpdate проверяет обновление от клиента: кроме метрик, которые
+// хранятся как есть (Validate), допускается наблюдение summary
+func ValidateUpdate(m Metrics) error {
+	if m.MType != Summary {
+		return Validate(m)
+	}
+	if err := CheckName(m.ID); err != nil {
+		return err
+	}
+	if m.Value == nil {
+		return fmt.Errorf("%w: для summary не задано поле value", ErrInvalidValue)
+	}
+	return checkObservation(*m.Value)
+}
+
+// ParseMetric разбирает метрику, переданную в URL в виде строк
+func ParseMetric(mType, name, raw string) (Metrics, error) {
+	if err := CheckName(name); err != nil {
+		return Metrics{}, err
+	}
+	switch mType {
+	case Gauge:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("%w: для gauge ожидается float64", ErrInvalidValue)
+		}
+		if err := CheckGauge(value); err != nil {
+			return Metrics{}, err
+		}
+		return NewGauge(name, value), nil
+	case Counter:
+		delta, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("%w: для counter ожидается int64", ErrInvalidValue)
+		}
+		return NewCounter(name, delta), nil
+	case Summary:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Metrics{}, fmt.Errorf("%w: для summary ожидается float64", ErrInvalidValue)
+		}
+		if err := checkObservation(value); err != nil {
+			return Metrics{}, err
+		}
+		return NewSummary(name, value), nil
+	default:
+		return Metrics{}, ErrInvalidType
+	}
+}
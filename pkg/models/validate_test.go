@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	delta := func(d int64) *int64 { return &d }
+	tests := []struct {
+		name    string
+		m       Metrics
+		update  bool
+		wantErr error
+	}{
+		{name: "gauge", m: NewGauge("cpu", 1.5)},
+		{name: "counter", m: NewCounter("hits", -3)},
+		{name: "пустое имя", m: NewGauge("", 1), wantErr: ErrEmptyName},
+		{name: "длинное имя", m: NewGauge(strings.Repeat("a", MaxNameLength+1), 1), wantErr: ErrInvalidName},
+		{name: "имя наибольшей длины", m: NewGauge(strings.Repeat("a", MaxNameLength), 1)},
+		{name: "не UTF-8", m: NewGauge("cpu\xff", 1), wantErr: ErrInvalidName},
+		{name: "gauge без value", m: Metrics{ID: "cpu", MType: Gauge, Delta: delta(1)}, wantErr: ErrInvalidValue},
+		{name: "counter без delta", m: Metrics{ID: "hits", MType: Counter, Value: value(1)}, wantErr: ErrInvalidValue},
+		{name: "NaN", m: NewGauge("cpu", math.NaN()), wantErr: ErrInvalidValue},
+		{name: "бесконечность", m: NewGauge("cpu", math.Inf(-1)), wantErr: ErrInvalidValue},
+		{name: "неизвестный тип", m: Metrics{ID: "cpu", MType: "histogram", Value: value(1)}, wantErr: ErrInvalidType},
+		{name: "summary хранится не как есть", m: NewSummary("latency", 1), wantErr: ErrInvalidType},
+		{name: "summary в обновлении", m: NewSummary("latency", 1), update: true},
+		{name: "summary без value", m: Metrics{ID: "latency", MType: Summary}, update: true, wantErr: ErrInvalidValue},
+		{name: "summary NaN", m: NewSummary("latency", math.NaN()), update: true, wantErr: ErrInvalidValue},
+		{name: "summary с пустым именем", m: NewSummary("", 1), update: true, wantErr: ErrEmptyName},
+		{name: "gauge в обновлении", m: NewGauge("cpu", 1), update: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validate := Validate
+			if tt.update {
+				validate = ValidateUpdate
+			}
+			err := validate(tt.m)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("ошибка %v", err)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ошибка %v, ожидалась %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseMetric(t *testing.T) {
+	tests := []struct {
+		name      string
+		mType     string
+		metric    string
+		raw       string
+		wantValue float64
+		wantDelta int64
+		wantErr   error
+	}{
+		{name: "gauge", mType: Gauge, metric: "cpu", raw: "1.5", wantValue: 1.5},
+		{name: "gauge в экспоненциальной записи", mType: Gauge, metric: "cpu", raw: "1e3", wantValue: 1000},
+		{name: "gauge отрицательный", mType: Gauge, metric: "cpu", raw: "-2", wantValue: -2},
+		{name: "gauge не число", mType: Gauge, metric: "cpu", raw: "abc", wantErr: ErrInvalidValue},
+		{name: "gauge NaN", mType: Gauge, metric: "cpu", raw: "NaN", wantErr: ErrInvalidValue},
+		{name: "gauge Inf", mType: Gauge, metric: "cpu", raw: "+Inf", wantErr: ErrInvalidValue},
+		{name: "counter", mType: Counter, metric: "hits", raw: "42", wantDelta: 42},
+		{name: "counter наибольший", mType: Counter, metric: "hits", raw: "9223372036854775807", wantDelta: math.MaxInt64},
+		{name: "counter дробный", mType: Counter, metric: "hits", raw: "1.5", wantErr: ErrInvalidValue},
+		{name: "counter переполнение", mType: Counter, metric: "hits", raw: "9223372036854775808", wantErr: ErrInvalidValue},
+		{name: "summary", mType: Summary, metric: "latency", raw: "0.25", wantValue: 0.25},
+		{name: "summary Inf", mType: Summary, metric: "latency", raw: "Inf", wantErr: ErrInvalidValue},
+		{name: "пустое значение", mType: Gauge, metric: "cpu", raw: "", wantErr: ErrInvalidValue},
+		{name: "пустое имя", mType: Gauge, raw: "1", wantErr: ErrEmptyName},
+		{name: "имя не UTF-8", mType: Gauge, metric: "\xc3", raw: "1", wantErr: ErrInvalidName},
+		{name: "неизвестный тип", mType: "histogram", metric: "cpu", raw: "1", wantErr: ErrInvalidType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseMetric(tt.mType, tt.metric, tt.raw)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseMetric() = %v, ожидалась %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMetric(): %v", err)
+			}
+			if m.ID != tt.metric || m.MType != tt.mType {
+				t.Errorf("метрика %s %s, ожидалась %s %s", m.MType, m.ID, tt.mType, tt.metric)
+			}
+			switch {
+			case tt.mType == Counter && (m.Delta == nil || *m.Delta != tt.wantDelta):
+				t.Errorf("delta %v, ожидалось %d", m.Delta, tt.wantDelta)
+			case tt.mType != Counter && (m.Value == nil || *m.Value != tt.wantValue):
+				t.Errorf("value %v, ожидалось %v", m.Value, tt.wantValue)
+			}
+			// Разобранная метрика проходит проверку обновления
+			if err := ValidateUpdate(m); err != nil {
+				t.Errorf("ValidateUpdate() = %v", err)
+			}
+		})
+	}
+}